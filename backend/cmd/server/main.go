@@ -3,12 +3,20 @@ package main
 import (
 	"bob-hackathon/internal/config"
 	"bob-hackathon/internal/controllers"
+	"bob-hackathon/internal/metrics"
 	"bob-hackathon/internal/middleware"
 	"bob-hackathon/internal/models"
 	"bob-hackathon/internal/services"
+	"bob-hackathon/internal/tracing"
+	"bob-hackathon/internal/utils"
+	"context"
+	"errors"
 	"fmt"
 	"log"
-	"strings"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -18,50 +26,95 @@ import (
 func main() {
 	// Cargar configuración
 	config.LoadConfig()
+	utils.USDToPEN = config.AppConfig.USDToPEN
 
 	// Configurar modo Gin (release o debug)
 	gin.SetMode(gin.ReleaseMode)
 
+	// Tracing (no-op sin OTEL_EXPORTER_OTLP_ENDPOINT)
+	shutdownTracing, err := tracing.Setup(context.Background(), config.AppConfig.OTLPEndpoint, "bob-backend")
+	if err != nil {
+		log.Fatalf("❌ OTEL_EXPORTER_OTLP_ENDPOINT inválido: %v", err)
+	}
+
 	// Inicializar servicios
 	log.Println("Inicializando servicios...")
 	services.GetFAQService()
-	services.GetBOBAPIService()
+	services.GetBOBAPIService().StartBackgroundRefresh(4 * time.Minute)
 	services.GetSessionService()
-	services.GetGeminiService()
+	if !config.AppConfig.DegradedMode {
+		services.GetGeminiService()
+	}
+
+	// Crear controllers
+	chatController := controllers.NewChatController()
+	leadController := controllers.NewLeadController()
+	adminController := controllers.NewAdminController(services.GetFAQService())
+
+	router, err := newRouter(chatController, leadController, adminController)
+	if err != nil {
+		log.Fatalf("❌ CORS_ORIGINS inválido: %v", err)
+	}
+
+	// Iniciar servidor
+	port := config.AppConfig.Port
+	log.Printf("Servidor corriendo en puerto %s", port)
+	log.Printf("URL: http://localhost:%s", port)
+	log.Printf("Health: http://localhost:%s/health", port)
 
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%s", port),
+		Handler: router,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("❌ Error al iniciar servidor: %v", err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	shutdown(srv, shutdownTracing, 10*time.Second)
+}
+
+// newRouter arma el router con middlewares y todas las rutas de la API. Solo falla
+// si la configuración de CORS es inválida.
+func newRouter(chatController *controllers.ChatController, leadController *controllers.LeadController, adminController *controllers.AdminController) (*gin.Engine, error) {
 	// Crear router con middleware manual
 	router := gin.New()
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
+	router.Use(middleware.RequestID())
+	router.Use(middleware.Tracing())
 
 	// Configurar trusted proxies (solo localhost en desarrollo)
 	router.SetTrustedProxies(nil)
 
-	// Configurar CORS
-	corsOrigins := strings.Split(config.AppConfig.CORSOrigins, ",")
-	router.Use(cors.New(cors.Config{
-		AllowOrigins:     corsOrigins,
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
-
-	// Crear controllers
-	chatController := controllers.NewChatController()
-	leadController := controllers.NewLeadController()
-	adminController := controllers.NewAdminController(services.GetFAQService())
+	// Configurar CORS (una configuración inválida detiene el arranque)
+	corsConfig, err := middleware.CORSConfig(config.AppConfig.CORSOrigins, config.AppConfig.CORSAllowCredentials)
+	if err != nil {
+		return nil, err
+	}
+	router.Use(cors.New(corsConfig))
 
-	// Health check
+	// Health check ("degraded" si el chat con IA no está disponible)
 	router.GET("/health", func(ctx *gin.Context) {
+		status := "ok"
+		if !chatController.AIAvailable() {
+			status = "degraded"
+		}
 		ctx.JSON(200, models.HealthResponse{
-			Status:    "ok",
+			Status:    status,
 			Timestamp: time.Now(),
 			Service:   "BOB Chatbot API - Go Version",
 		})
 	})
 
+	// Métricas Prometheus (duración de Gemini, scoring, mensajes de chat)
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+
 	// Ruta raíz con documentación
 	router.GET("/", func(ctx *gin.Context) {
 		ctx.JSON(200, gin.H{
@@ -69,21 +122,30 @@ func main() {
 			"version": "2.0.0",
 			"status":  "running",
 			"endpoints": gin.H{
-				"health": "GET /health",
+				"health":  "GET /health",
+				"metrics": "GET /metrics",
 				"chat": gin.H{
-					"message": "POST /api/chat/message",
-					"score":   "POST /api/chat/score",
-					"history": "GET /api/chat/history/:sessionId",
-					"delete":  "DELETE /api/chat/session/:sessionId",
+					"message":        "POST /api/chat/message",
+					"transcribe":     "POST /api/chat/transcribe",
+					"extract":        "POST /api/chat/extract",
+					"score":          "POST /api/chat/score",
+					"history":        "GET /api/chat/history/:sessionId",
+					"delete":         "DELETE /api/chat/session/:sessionId",
+					"feedback":       "POST /api/chat/feedback",
+					"feedback_get":   "GET /api/chat/feedback/:sessionId",
+					"feedback_stats": "GET /api/chat/feedback/stats",
 				},
 				"leads": gin.H{
-					"list":  "GET /api/leads",
-					"get":   "GET /api/leads/:sessionId",
-					"stats": "GET /api/leads/stats",
+					"list":    "GET /api/leads",
+					"get":     "GET /api/leads/:sessionId",
+					"stats":   "GET /api/leads/stats",
+					"stream":  "GET /api/leads/stream",
+					"rescore": "POST /api/leads/:sessionId/rescore",
 				},
 				"resources": gin.H{
 					"faqs":     "GET /api/faqs",
 					"vehicles": "GET /api/vehicles",
+					"search":   "GET /api/vehicles/search",
 					"vehicle":  "GET /api/vehicles/:id",
 				},
 				"admin": gin.H{
@@ -91,7 +153,13 @@ func main() {
 					"download_faqs":    "GET /api/admin/faqs/download",
 					"template_faqs":    "GET /api/admin/faqs/template",
 					"get_prompts":      "GET /api/admin/prompts",
+					"get_prompt":       "GET /api/admin/prompts/:agent",
 					"update_prompt":    "PUT /api/admin/prompts/:agent",
+					"rollback_prompt":  "POST /api/admin/prompts/:agent/rollback",
+					"resolve_handoff":  "DELETE /api/admin/handoff/:sessionId",
+					"rescore_all":      "POST /api/admin/leads/rescore-all",
+					"rescore_progress": "GET /api/admin/leads/rescore-all",
+					"rescore_cancel":   "DELETE /api/admin/leads/rescore-all",
 				},
 			},
 		})
@@ -101,10 +169,15 @@ func main() {
 	chatRoutes := router.Group("/api/chat")
 	{
 		chatRoutes.POST("/message", chatController.SendMessage)
+		chatRoutes.POST("/transcribe", middleware.InternalAuth(), chatController.Transcribe)
+		chatRoutes.POST("/extract", middleware.InternalAuth(), chatController.ExtractText)
 		chatRoutes.POST("/score", chatController.GetScore)
 		chatRoutes.GET("/history/:sessionId", chatController.GetHistory)
 		chatRoutes.GET("/sessions", chatController.GetAllSessions)
 		chatRoutes.DELETE("/session/:sessionId", chatController.DeleteSession)
+		chatRoutes.POST("/feedback", chatController.SubmitFeedback)
+		chatRoutes.GET("/feedback/stats", chatController.GetFeedbackStats)
+		chatRoutes.GET("/feedback/:sessionId", chatController.GetFeedback)
 	}
 
 	// Rutas de Leads
@@ -112,12 +185,15 @@ func main() {
 	{
 		leadRoutes.GET("", leadController.GetAllLeads)
 		leadRoutes.GET("/stats", leadController.GetLeadsStats)
+		leadRoutes.GET("/stream", leadController.StreamLeads)
 		leadRoutes.GET("/:sessionId", leadController.GetLead)
+		leadRoutes.POST("/:sessionId/rescore", middleware.AdminAuth(), chatController.RescoreLead)
 	}
 
 	// Rutas de Recursos
 	router.GET("/api/faqs", leadController.GetFAQs)
 	router.GET("/api/vehicles", leadController.GetVehicles)
+	router.GET("/api/vehicles/search", leadController.SearchVehicles)
 	router.GET("/api/vehicles/:id", leadController.GetVehicleByID)
 
 	// Rutas de Admin (protegidas con autenticación)
@@ -131,16 +207,50 @@ func main() {
 
 		// Prompts management
 		adminRoutes.GET("/prompts", adminController.GetPrompts)
+		adminRoutes.GET("/prompts/:agent", adminController.GetPrompt)
 		adminRoutes.PUT("/prompts/:agent", adminController.UpdatePrompt)
+		adminRoutes.POST("/prompts/:agent/rollback", adminController.RollbackPrompt)
+
+		// Handoff a humano
+		adminRoutes.DELETE("/handoff/:sessionId", adminController.ResolveHandoff)
+
+		// Re-scoring masivo de leads
+		adminRoutes.POST("/leads/rescore-all", chatController.RescoreAllLeads)
+		adminRoutes.GET("/leads/rescore-all", chatController.GetRescoreProgress)
+		adminRoutes.DELETE("/leads/rescore-all", chatController.CancelRescore)
 	}
 
-	// Iniciar servidor
-	port := config.AppConfig.Port
-	log.Printf("Servidor corriendo en puerto %s", port)
-	log.Printf("URL: http://localhost:%s", port)
-	log.Printf("Health: http://localhost:%s/health", port)
+	return router, nil
+}
+
+// Tiempo para exportar los spans pendientes, aparte del timeout del servidor
+const tracingShutdownTimeout = 5 * time.Second
+
+// shutdown apagado ordenado: deja terminar los requests en curso, guarda las sesiones
+// y cierra el proveedor de LLM una sola vez
+func shutdown(srv *http.Server, shutdownTracing func(context.Context) error, timeout time.Duration) {
+	log.Println("Apagando servidor...")
+
+	// Los streams SSE (/api/leads/stream) no terminan solos: se cierran sus suscripciones
+	// para que Shutdown no espere hasta el timeout
+	srv.RegisterOnShutdown(services.GetSessionService().CloseLeadSubscribers)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("⚠️  Error al apagar servidor: %v", err)
+	}
+
+	services.GetBOBAPIService().StopBackgroundRefresh()
+	services.GetSessionService().Flush()
+	if !config.AppConfig.DegradedMode {
+		services.GetGeminiService().Close()
+	}
 
-	if err := router.Run(fmt.Sprintf(":%s", port)); err != nil {
-		log.Fatalf("❌ Error al iniciar servidor: %v", err)
+	tracingCtx, cancelTracing := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	defer cancelTracing()
+	if err := shutdownTracing(tracingCtx); err != nil {
+		log.Printf("⚠️  Error al exportar spans pendientes: %v", err)
 	}
+	log.Println("✅ Apagado completo")
 }
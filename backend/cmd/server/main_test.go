@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"bob-hackathon/internal/config"
+	"bob-hackathon/internal/controllers"
+	"bob-hackathon/internal/models"
+	"bob-hackathon/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestMain gin en modo test y config de un arranque sin API key (modo degradado)
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	dir, err := os.MkdirTemp("", "server-test")
+	if err != nil {
+		panic(err)
+	}
+	config.AppConfig = &config.Config{
+		DataDir:            dir,
+		LLMProvider:        "gemini",
+		USDToPEN:           3.75,
+		ScoringMinMessages: 6,
+		DegradedMode:       true,
+		CORSOrigins:        "http://localhost:5173",
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newTestServer router completo como lo arma main()
+func newTestServer(t *testing.T) http.Handler {
+	t.Helper()
+	router, err := newRouter(controllers.NewChatController(), controllers.NewLeadController(), controllers.NewAdminController(services.GetFAQService()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return router
+}
+
+func request(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	var rd io.Reader
+	if body != "" {
+		rd = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, rd)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestDegradedModeBoot(t *testing.T) {
+	h := newTestServer(t)
+
+	w := request(h, http.MethodGet, "/health", "")
+	var health models.HealthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &health); err != nil || w.Code != http.StatusOK || health.Status != "degraded" {
+		t.Fatalf("/health = %d %s", w.Code, w.Body.String())
+	}
+
+	cases := []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodPost, "/api/chat/message", `{"sessionId":"degraded-1","message":"hola","channel":"web"}`, http.StatusServiceUnavailable},
+		{http.MethodPost, "/api/chat/score", `{"sessionId":"degraded-1"}`, http.StatusServiceUnavailable},
+		// endpoint interno del bot: sin WHATSAPP_ENGINE_TOKEN solo acepta llamadas locales
+		{http.MethodPost, "/api/chat/transcribe", `{}`, http.StatusForbidden},
+		// lo que no depende del LLM sigue funcionando
+		{http.MethodGet, "/api/chat/sessions", "", http.StatusOK},
+		{http.MethodGet, "/api/leads/stats", "", http.StatusOK},
+		{http.MethodGet, "/api/chat/feedback/stats", "", http.StatusOK},
+	}
+	for _, c := range cases {
+		t.Run(c.method+" "+c.path, func(t *testing.T) {
+			w := request(h, c.method, c.path, c.body)
+			if w.Code != c.status {
+				t.Fatalf("status = %d %s, want %d", w.Code, w.Body.String(), c.status)
+			}
+			if c.status == http.StatusServiceUnavailable {
+				var resp map[string]any
+				_ = json.Unmarshal(w.Body.Bytes(), &resp)
+				if resp["success"] != false || !strings.Contains(resp["error"].(string), "no está disponible") {
+					t.Fatalf("body = %s", w.Body.String())
+				}
+			}
+		})
+	}
+
+	// el mensaje rechazado no deja una sesión a medias
+	if services.GetSessionService().GetSession("degraded-1") != nil {
+		t.Fatal("degraded chat created a session")
+	}
+}
+
+func TestShutdownClosesLeadStreamsAndFlushes(t *testing.T) {
+	router := newTestServer(t)
+	srv := httptest.NewUnstartedServer(router)
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/leads/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	// esperar el evento "ready": la suscripción ya está registrada
+	buf := make([]byte, 64)
+	if _, err := resp.Body.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	services.GetSessionService().GetOrCreateSession("shutdown-1", "web")
+	sessionsFile := filepath.Join(config.AppConfig.DataDir, "sessions.json")
+	os.Remove(sessionsFile)
+
+	var tracingDeadline time.Duration
+	start := time.Now()
+	shutdown(srv.Config, func(ctx context.Context) error {
+		deadline, _ := ctx.Deadline()
+		tracingDeadline = time.Until(deadline)
+		return nil
+	}, 5*time.Second)
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("shutdown took %s with an open lead stream", elapsed)
+	}
+	data, err := os.ReadFile(sessionsFile)
+	if err != nil || !strings.Contains(string(data), "shutdown-1") {
+		t.Fatalf("sessions not flushed: %v", err)
+	}
+	if tracingDeadline <= tracingShutdownTimeout-time.Second {
+		t.Fatalf("tracing got %s to export, want its own %s", tracingDeadline, tracingShutdownTimeout)
+	}
+}
+
+func TestRouterRejectsInvalidCORS(t *testing.T) {
+	prev := *config.AppConfig
+	defer func() { *config.AppConfig = prev }()
+
+	cases := []struct {
+		name, origins string
+		credentials   bool
+		wantErr       bool
+	}{
+		{"wildcard with credentials", "*", true, true},
+		{"garbage origin", "localhost:5173", true, true},
+		{"padded list", " http://localhost:5173 , https://*.somosbob.com ", true, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			config.AppConfig.CORSOrigins = c.origins
+			config.AppConfig.CORSAllowCredentials = c.credentials
+			_, err := newRouter(controllers.NewChatController(), controllers.NewLeadController(), controllers.NewAdminController(services.GetFAQService()))
+			if (err != nil) != c.wantErr {
+				t.Fatalf("newRouter err = %v, wantErr %v", err, c.wantErr)
+			}
+		})
+	}
+}
@@ -2,31 +2,44 @@ package agents
 
 import (
 	"bob-hackathon/internal/config"
+	"bob-hackathon/internal/llm"
+	"bob-hackathon/internal/metrics"
+	"bob-hackathon/internal/models"
 	"bob-hackathon/internal/services"
+	"bob-hackathon/internal/tracing"
+	"bob-hackathon/internal/utils"
 	"context"
 	"fmt"
 	"strings"
-
-	"github.com/google/generative-ai-go/genai"
-	"google.golang.org/api/option"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 type AuctionAgent struct {
-	client         *genai.Client
-	model          *genai.GenerativeModel
-	bobAPIService  *services.BOBAPIService
+	provider      llm.Provider
+	opts          llm.Options
+	bobAPIService vehicleCatalog
 }
 
-func NewAuctionAgent() (*AuctionAgent, error) {
-	ctx := context.Background()
-	client, err := genai.NewClient(ctx, option.WithAPIKey(config.AppConfig.GeminiAPIKey))
-	if err != nil {
-		return nil, err
+// vehicleCatalog inventario de vehículos (BOBAPIService en producción)
+type vehicleCatalog interface {
+	GetSublots(forceRefresh bool) ([]models.Vehicle, error)
+	GetVehicleByID(id string) (*models.Vehicle, error)
+	SearchVehicles(marca, modelo string, precioMin, precioMax float64, tipoSubasta string, yearMin, yearMax int, status string, limit int) ([]models.Vehicle, error)
+}
+
+// Máximo de vehículos enriquecidos con enlace por respuesta
+const maxVehicleLinks = 3
+
+func NewAuctionAgent(provider llm.Provider) (*AuctionAgent, error) {
+	if provider == nil {
+		return nil, ErrNilProvider
 	}
 
 	return &AuctionAgent{
-		client:        client,
-		model:         client.GenerativeModel(config.AppConfig.GeminiModel),
+		provider:      provider,
+		opts:          llm.Options(config.AppConfig.AuctionGeneration),
 		bobAPIService: services.GetBOBAPIService(),
 	}, nil
 }
@@ -36,6 +49,8 @@ func (a *AuctionAgent) Name() string {
 }
 
 func (a *AuctionAgent) Process(ctx context.Context, input *AgentInput) (*AgentOutput, error) {
+	ctx, span := tracing.Start(ctx, "agent."+a.Name())
+	defer span.End()
 	vehicles, err := a.bobAPIService.GetSublots(false)
 	if err != nil {
 		// Si hay error en la API, retornar respuesta de fallback pero sin error
@@ -45,36 +60,188 @@ func (a *AuctionAgent) Process(ctx context.Context, input *AgentInput) (*AgentOu
 		}, nil
 	}
 
+	// Con presupuesto conocido se priorizan los vehículos que entran en él
+	// (los precios iniciales de BOB están en dólares)
+	if budgetUSD := toUSD(input.BudgetPEN); budgetUSD > 0 {
+		inBudget, err := a.bobAPIService.SearchVehicles("", "", 0, budgetUSD, "", 0, 0, "", 10)
+		if err == nil && len(inBudget) > 0 {
+			vehicles = inBudget
+		}
+	}
+
 	// Limitar a 10 vehículos
 	if len(vehicles) > 10 {
 		vehicles = vehicles[:10]
 	}
 
-	prompt := a.buildPrompt(input, vehicles)
-
-	resp, err := a.model.GenerateContent(ctx, genai.Text(prompt))
+	prompt, err := a.buildPrompt(input, vehicles)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return nil, fmt.Errorf("no response from model")
+	start := time.Now()
+	responseText, err := a.provider.Generate(ctx, promptParts(prompt, input), a.opts)
+	metrics.ObserveGemini(a.Name(), start, err)
+	if err != nil {
+		return nil, err
 	}
 
-	responseText := fmt.Sprintf("%v", resp.Candidates[0].Content.Parts[0])
+	responseText = strings.TrimSpace(responseText)
+	links := a.enrichVehicles(input.RequestID, responseText, vehicles)
 
 	return &AgentOutput{
-		Response: strings.TrimSpace(responseText),
+		Response: appendVehicleLinks(responseText, links),
+		Vehicles: links,
 	}, nil
 }
 
-func (a *AuctionAgent) buildPrompt(input *AgentInput, vehicles interface{}) string {
-	return fmt.Sprintf(`Eres el Agente de Subastas de BOB. Tu especialidad es ayudar a encontrar vehículos en subasta.
+// enrichVehicles resuelve los vehículos que el LLM mencionó en la respuesta y arma
+// su enlace de detalle e imagen. Solo consulta el detalle de los mencionados.
+func (a *AuctionAgent) enrichVehicles(requestID, responseText string, candidates []models.Vehicle) []models.VehicleLink {
+	text := strings.ToLower(responseText)
+	var links []models.VehicleLink
+	seen := make(map[string]bool)
+
+	for _, v := range candidates {
+		if len(links) >= maxVehicleLinks {
+			break
+		}
+		if v.ID == "" || seen[v.ID] || !mentionsVehicle(text, v) {
+			continue
+		}
+		seen[v.ID] = true
+
+		detail, err := a.bobAPIService.GetVehicleByID(v.ID)
+		if err != nil {
+			utils.Logf(requestID, "⚠️ No se pudo obtener detalle del vehículo %s: %v", v.ID, err)
+			continue
+		}
+		links = append(links, models.VehicleLink{
+			ID:           detail.ID,
+			Title:        strings.TrimSpace(fmt.Sprintf("%s %s %s", detail.Marca, detail.Modelo, detail.Ano)),
+			URL:          vehicleDetailURL(detail.ID),
+			Image:        detail.Imagen,
+			PrecioInicio: detail.PrecioInicio,
+		})
+	}
+	return links
+}
+
+// mentionsVehicle la respuesta (en minúsculas) nombra marca y modelo del vehículo;
+// si junto al modelo aparece un año, tiene que ser el del vehículo
+func mentionsVehicle(text string, v models.Vehicle) bool {
+	marca := strings.ToLower(strings.TrimSpace(v.Marca))
+	modelo := strings.ToLower(strings.TrimSpace(v.Modelo))
+	if marca == "" || modelo == "" || len(wordIndexes(text, marca)) == 0 {
+		return false
+	}
+	for _, idx := range wordIndexes(text, modelo) {
+		window := text[idx:min(len(text), idx+len(modelo)+12)]
+		if v.Ano == "" || !containsYear(window) || strings.Contains(window, v.Ano) {
+			return true
+		}
+	}
+	return false
+}
+
+// wordIndexes posiciones donde word aparece como palabra completa ("rio" no matchea "usuario")
+func wordIndexes(text, word string) []int {
+	var idxs []int
+	for offset := 0; ; {
+		idx := strings.Index(text[offset:], word)
+		if idx == -1 {
+			return idxs
+		}
+		start, end := offset+idx, offset+idx+len(word)
+		before, _ := utf8.DecodeLastRuneInString(text[:start])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		if !isWordRune(before) && !isWordRune(after) {
+			idxs = append(idxs, start)
+		}
+		offset = start + 1
+	}
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
 
-MENSAJE DEL USUARIO: "%s"
+// containsYear hay un año de 4 dígitos (19xx/20xx) en el texto
+func containsYear(text string) bool {
+	for i := 0; i+4 <= len(text); i++ {
+		if (strings.HasPrefix(text[i:], "19") || strings.HasPrefix(text[i:], "20")) &&
+			isDigit(text[i+2]) && isDigit(text[i+3]) {
+			return true
+		}
+	}
+	return false
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func vehicleDetailURL(id string) string {
+	return strings.TrimRight(config.AppConfig.BOBVehicleURL, "/") + "/" + id
+}
+
+// appendVehicleLinks agrega los enlaces al texto para canales sin render enriquecido
+func appendVehicleLinks(responseText string, links []models.VehicleLink) string {
+	if len(links) == 0 {
+		return responseText
+	}
+	var sb strings.Builder
+	sb.WriteString(responseText)
+	sb.WriteString("\n\n")
+	for _, l := range links {
+		sb.WriteString(fmt.Sprintf("🔗 %s: %s\n", l.Title, l.URL))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// toUSD presupuesto en soles pasado a dólares, la moneda de PrecioInicio; 0 si no se conoce
+func toUSD(budgetPEN float64) float64 {
+	if budgetPEN <= 0 || utils.USDToPEN <= 0 {
+		return 0
+	}
+	return budgetPEN / utils.USDToPEN
+}
+
+// budgetText línea de presupuesto para el prompt; vacía si no se conoce
+func budgetText(budgetPEN float64) string {
+	budgetUSD := toUSD(budgetPEN)
+	if budgetUSD <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("\nPRESUPUESTO DEL USUARIO: S/ %.0f, unos US$ %.0f (los precios iniciales están en dólares: los que superen US$ %.0f no son opción)", budgetPEN, budgetUSD, budgetUSD)
+}
+
+func (a *AuctionAgent) buildPrompt(input *AgentInput, vehicles interface{}) (string, error) {
+	prompt, err := services.GetPromptStore().Render("auction", services.PromptData{
+		Message:   input.Message,
+		SessionID: input.SessionID,
+		Channel:   input.Channel,
+		Vehicles:  fmt.Sprintf("%v", vehicles),
+		Budget:    budgetText(input.BudgetPEN),
+		Persona:   personaText(input),
+	})
+	if err != nil {
+		return "", err
+	}
+	return prompt, nil
+}
+
+func init() {
+	services.RegisterDefaultPrompt("auction", auctionPromptTemplate, "Message", "Vehicles")
+}
+
+// auctionPromptTemplate template por defecto (editable vía /api/admin/prompts/auction)
+const auctionPromptTemplate = `Eres el Agente de Subastas de BOB. Tu especialidad es ayudar a encontrar vehículos en subasta.
+
+MENSAJE DEL USUARIO: "{{.Message}}"{{.Budget}}
 
 VEHÍCULOS DISPONIBLES:
-%v
+{{.Vehicles}}
 
 INSTRUCCIONES:
 1. Analiza qué tipo de vehículo busca el usuario (marca, modelo, año, tipo)
@@ -83,7 +250,6 @@ INSTRUCCIONES:
 4. Sé específico con los detalles de cada vehículo
 5. Si no hay coincidencias exactas, sugiere alternativas similares
 6. Invita a ver más en https://www.somosbob.com/subastas
-7. Pregunta sobre presupuesto, urgencia y uso previsto para afinarlo scoring
+7. Pregunta sobre presupuesto, urgencia y uso previsto para afinarlo scoring{{.Persona}}
 
-Responde de manera útil y orientada a cerrar la venta.`, input.Message, vehicles)
-}
+Responde de manera útil y orientada a cerrar la venta.`
@@ -0,0 +1,162 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"bob-hackathon/internal/config"
+	"bob-hackathon/internal/llm"
+	"bob-hackathon/internal/models"
+	"bob-hackathon/internal/utils"
+)
+
+// fakeCatalog vehicleCatalog en memoria que registra los detalles consultados
+type fakeCatalog struct {
+	vehicles []models.Vehicle
+	lookups  []string
+	missing  map[string]bool
+	maxPrice float64 // último precioMax pedido a SearchVehicles
+}
+
+func (c *fakeCatalog) GetSublots(bool) ([]models.Vehicle, error) { return c.vehicles, nil }
+
+func (c *fakeCatalog) GetVehicleByID(id string) (*models.Vehicle, error) {
+	c.lookups = append(c.lookups, id)
+	if c.missing[id] {
+		return nil, errors.New("not found")
+	}
+	for _, v := range c.vehicles {
+		if v.ID == id {
+			v.Imagen = "https://img.example/" + id + ".jpg"
+			return &v, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+func (c *fakeCatalog) SearchVehicles(_, _ string, _, precioMax float64, _ string, _, _ int, _ string, _ int) ([]models.Vehicle, error) {
+	c.maxPrice = precioMax
+	var out []models.Vehicle
+	for _, v := range c.vehicles {
+		if v.PrecioInicio <= precioMax {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+var testCatalog = []models.Vehicle{
+	{ID: "v1", Marca: "Toyota", Modelo: "Hilux", Ano: "2019", PrecioInicio: 45000},
+	{ID: "v2", Marca: "Toyota", Modelo: "Hilux", Ano: "2015", PrecioInicio: 30000},
+	{ID: "v3", Marca: "Kia", Modelo: "Rio", Ano: "2020", PrecioInicio: 25000},
+	{ID: "v4", Marca: "Nissan", Modelo: "Sentra", Ano: "2018", PrecioInicio: 28000},
+	{ID: "v5", Marca: "Hyundai", Modelo: "Accent", Ano: "2021", PrecioInicio: 32000},
+	{ID: "v6", Marca: "Mazda", Modelo: "3", Ano: "2017", PrecioInicio: 27000},
+}
+
+func TestAuctionAgentEnrichesOnlyMentionedVehicles(t *testing.T) {
+	prev := config.AppConfig.BOBVehicleURL
+	config.AppConfig.BOBVehicleURL = "https://bob.example/subastas/"
+	defer func() { config.AppConfig.BOBVehicleURL = prev }()
+
+	cases := []struct {
+		name    string
+		reply   string
+		missing map[string]bool
+		lookups []string
+		links   []string
+	}{
+		{"none mentioned", "Tenemos varias opciones, ¿qué presupuesto manejas?", nil, nil, nil},
+		{"year disambiguates", "Te recomiendo la Toyota Hilux 2019, está impecable.", nil, []string{"v1"}, []string{"v1"}},
+		{"model without year matches every listing", "La Toyota Hilux es ideal para carga.", nil, []string{"v1", "v2"}, []string{"v1", "v2"}},
+		{"substring is not a mention", "Como usuario de Kia te gustará el Sorento.", nil, nil, nil},
+		{"capped at maxVehicleLinks", "Toyota Hilux 2019, Kia Rio 2020, Nissan Sentra 2018 y Hyundai Accent 2021.", nil, []string{"v1", "v3", "v4"}, []string{"v1", "v3", "v4"}},
+		{"failed lookup skipped", "Kia Rio 2020 o Nissan Sentra 2018.", map[string]bool{"v3": true}, []string{"v3", "v4"}, []string{"v4"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			catalog := &fakeCatalog{vehicles: testCatalog, missing: c.missing}
+			a := &AuctionAgent{provider: llm.NewMockProvider(c.reply), bobAPIService: catalog}
+			out, err := a.Process(context.Background(), &AgentInput{Message: "busco camioneta", SessionID: "auction-1", Channel: "web"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(catalog.lookups, c.lookups) {
+				t.Fatalf("lookups = %v, want %v", catalog.lookups, c.lookups)
+			}
+			var ids []string
+			for _, l := range out.Vehicles {
+				ids = append(ids, l.ID)
+				if l.URL != "https://bob.example/subastas/"+l.ID || l.Image != "https://img.example/"+l.ID+".jpg" || l.Title == "" {
+					t.Fatalf("link = %+v", l)
+				}
+				if !strings.Contains(out.Response, "🔗 "+l.Title+": "+l.URL) {
+					t.Fatalf("response missing link for %s: %q", l.ID, out.Response)
+				}
+			}
+			if !reflect.DeepEqual(ids, c.links) {
+				t.Fatalf("links = %v, want %v", ids, c.links)
+			}
+			if len(c.links) == 0 && out.Response != c.reply {
+				t.Fatalf("response changed without links: %q", out.Response)
+			}
+		})
+	}
+}
+
+func TestAuctionAgentBudgetInDollars(t *testing.T) {
+	prev := utils.USDToPEN
+	utils.USDToPEN = 3.75
+	defer func() { utils.USDToPEN = prev }()
+
+	// S/ 105,000 son US$ 28,000: entran Kia Rio, Nissan Sentra y Mazda 3; en soles entraría todo
+	catalog := &fakeCatalog{vehicles: testCatalog}
+	provider := llm.NewMockProvider("Tenemos opciones dentro de tu presupuesto.")
+	a := &AuctionAgent{provider: provider, bobAPIService: catalog}
+	if _, err := a.Process(context.Background(), &AgentInput{Message: "busco auto", SessionID: "auction-budget", Channel: "web", BudgetPEN: 105000}); err != nil {
+		t.Fatal(err)
+	}
+	if catalog.maxPrice != 28000 {
+		t.Fatalf("SearchVehicles precioMax = %v, want 28000 (USD)", catalog.maxPrice)
+	}
+	calls := provider.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("calls = %d", len(calls))
+	}
+	prompt := calls[0][0].Text
+	if !strings.Contains(prompt, "S/ 105000, unos US$ 28000") || !strings.Contains(prompt, "superen US$ 28000") {
+		t.Fatalf("prompt budget line missing or in the wrong currency:\n%s", prompt)
+	}
+	for _, id := range []string{"Toyota Hilux 2019", "Hyundai Accent 2021"} {
+		if strings.Contains(prompt, id) {
+			t.Fatalf("prompt lists %s over the budget", id)
+		}
+	}
+}
+
+func TestMentionsVehicle(t *testing.T) {
+	hilux := models.Vehicle{Marca: "Toyota", Modelo: "Hilux", Ano: "2019"}
+	cases := []struct {
+		text string
+		v    models.Vehicle
+		want bool
+	}{
+		{"la toyota hilux 2019", hilux, true},
+		{"la toyota hilux", hilux, true},
+		{"la toyota hilux 2015", hilux, false},
+		{"la hilux 2019", hilux, false}, // sin marca
+		{"toyota hiluxes", hilux, false},
+		{"toyota hilux 2015 y toyota hilux 2019", hilux, true},
+		{"kia rio", models.Vehicle{Marca: "Kia", Modelo: "Rio"}, true},
+		{"kia usuario", models.Vehicle{Marca: "Kia", Modelo: "Rio"}, false},
+		{"kia rio", models.Vehicle{Marca: "Kia"}, false},
+	}
+	for _, c := range cases {
+		if got := mentionsVehicle(c.text, c.v); got != c.want {
+			t.Errorf("mentionsVehicle(%q, %s %s %s) = %v, want %v", c.text, c.v.Marca, c.v.Modelo, c.v.Ano, got, c.want)
+		}
+	}
+}
@@ -1,8 +1,14 @@
 package agents
 
 import (
+	"bob-hackathon/internal/llm"
 	"bob-hackathon/internal/models"
+	"bob-hackathon/internal/services"
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
 )
 
 type Agent interface {
@@ -16,6 +22,14 @@ type AgentInput struct {
 	Channel        string
 	ConversationHistory []models.Message
 	LeadData       *models.LeadData
+	Behavior       *models.BehaviorSignals
+	Summary        string // resumen de los turnos anteriores a ConversationHistory
+	BudgetPEN      float64 // presupuesto mencionado por el usuario en soles (0 = no mencionado)
+	PromptVariant  string // variante del experimento A/B ("" = sin experimento)
+	RequestID      string // ID de correlación para los logs
+	Tier           string // tier del cliente ("premium", ...) para el tono (prompts persona_*)
+	Media          *services.ChatMediaData // imagen adjunta al mensaje (nil = solo texto)
+	MediaText      string // texto extraído por OCR de la imagen o documento adjunto
 }
 
 type AgentOutput struct {
@@ -25,6 +39,8 @@ type AgentOutput struct {
 	ScoringData    *models.ScoringData
 	IntentDetected string
 	Confidence     float64
+	Vehicles       []models.VehicleLink
+	HighIntent     bool // el usuario dio señales de compra concretas (presupuesto, urgencia)
 }
 
 type IntentType string
@@ -36,3 +52,104 @@ const (
 	IntentAmbiguo  IntentType = "ambiguo"
 	IntentGeneral  IntentType = "general"
 )
+
+// buildSummaryText encabeza el historial con el resumen de los turnos viejos; vacío si no hay
+func buildSummaryText(summary string) string {
+	if summary == "" {
+		return ""
+	}
+	return "\n\nRESUMEN DE LA CONVERSACIÓN ANTERIOR:\n" + summary
+}
+
+// personaText estilo de respuesta según tier y canal (prompts persona_*); vacío si no aplica
+func personaText(input *AgentInput) string {
+	persona := services.GetPromptStore().Persona(input.Tier, input.Channel)
+	if persona == "" {
+		return ""
+	}
+	return "\n\nESTILO DE RESPUESTA:\n" + persona
+}
+
+// ErrNilProvider los agentes comparten el proveedor de LLM; no se puede crear uno sin él
+var ErrNilProvider = errors.New("proveedor de LLM no inicializado")
+
+// mediaNote acompaña a la imagen para que el modelo sepa de dónde viene
+const mediaNote = "El usuario adjuntó esta imagen a su mensaje (por ejemplo, la foto de un vehículo que le interesa). Tenla en cuenta al responder:"
+
+// mediaTextNote encabeza el texto leído del adjunto (el OCR puede equivocarse en algún carácter)
+const mediaTextNote = "Texto leído del adjunto del usuario (OCR, puede tener errores). Úsalo si es relevante (placa, documento, modelo):"
+
+// promptParts el prompt de texto y, si el usuario adjuntó una imagen, la imagen (llamada multimodal)
+// y el texto que se le extrajo
+func promptParts(prompt string, input *AgentInput) []llm.Part {
+	parts := []llm.Part{llm.Text(prompt)}
+	if input.Media != nil {
+		parts = append(parts, llm.Text(mediaNote), llm.Blob(input.Media.MimeType, input.Media.Data))
+	}
+	if input.MediaText != "" {
+		parts = append(parts, llm.Text(mediaTextNote+"\n"+input.MediaText))
+	}
+	return parts
+}
+
+// ResponseLatency velocidad de respuesta del usuario derivada de los timestamps del historial
+type ResponseLatency struct {
+	Samples   int // respuestas del usuario que siguen a un mensaje del asistente
+	AvgSec    float64
+	MedianSec float64
+	Under5Min int // respuestas en menos de 5 minutos
+}
+
+// ComputeResponseLatency mide, por turno, cuánto tardó el usuario en contestar al asistente.
+// Se ignoran pares sin timestamp o con reloj invertido.
+func ComputeResponseLatency(history []models.Message) ResponseLatency {
+	var latencies []float64
+	for i := 1; i < len(history); i++ {
+		prev, msg := history[i-1], history[i]
+		if msg.Role != "user" || prev.Role != "assistant" || msg.Timestamp.IsZero() || prev.Timestamp.IsZero() {
+			continue
+		}
+		delta := msg.Timestamp.Sub(prev.Timestamp).Seconds()
+		if delta < 0 {
+			continue
+		}
+		latencies = append(latencies, delta)
+	}
+
+	result := ResponseLatency{Samples: len(latencies)}
+	if len(latencies) == 0 {
+		return result
+	}
+
+	total := 0.0
+	for _, l := range latencies {
+		total += l
+		if l < 5*60 {
+			result.Under5Min++
+		}
+	}
+	result.AvgSec = total / float64(len(latencies))
+
+	sort.Float64s(latencies)
+	mid := len(latencies) / 2
+	if len(latencies)%2 == 0 {
+		result.MedianSec = (latencies[mid-1] + latencies[mid]) / 2
+	} else {
+		result.MedianSec = latencies[mid]
+	}
+	return result
+}
+
+// buildLatencyText resumen de la velocidad de respuesta para los prompts; vacío sin muestras
+func buildLatencyText(history []models.Message) string {
+	l := ComputeResponseLatency(history)
+	if l.Samples == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n\nVELOCIDAD DE RESPUESTA DEL USUARIO (según timestamps): mediana %s, promedio %s, %d de %d respuestas en menos de 5 minutos",
+		formatSeconds(l.MedianSec), formatSeconds(l.AvgSec), l.Under5Min, l.Samples)
+}
+
+func formatSeconds(sec float64) string {
+	return time.Duration(sec * float64(time.Second)).Round(time.Second).String()
+}
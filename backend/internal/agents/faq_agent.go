@@ -2,33 +2,37 @@ package agents
 
 import (
 	"bob-hackathon/internal/config"
+	"bob-hackathon/internal/llm"
+	"bob-hackathon/internal/metrics"
 	"bob-hackathon/internal/models"
 	"bob-hackathon/internal/services"
+	"bob-hackathon/internal/tracing"
+	"bob-hackathon/internal/utils"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"strings"
-
-	"github.com/google/generative-ai-go/genai"
-	"google.golang.org/api/option"
+	"time"
 )
 
 type FAQAgent struct {
-	client     *genai.Client
-	model      *genai.GenerativeModel
+	provider   llm.Provider
+	opts       llm.Options
 	faqService *services.FAQService
+	cache      *services.ResponseCache // respuestas por pregunta normalizada
 }
 
-func NewFAQAgent() (*FAQAgent, error) {
-	ctx := context.Background()
-	client, err := genai.NewClient(ctx, option.WithAPIKey(config.AppConfig.GeminiAPIKey))
-	if err != nil {
-		return nil, err
+func NewFAQAgent(provider llm.Provider) (*FAQAgent, error) {
+	if provider == nil {
+		return nil, ErrNilProvider
 	}
 
 	return &FAQAgent{
-		client:     client,
-		model:      client.GenerativeModel(config.AppConfig.GeminiModel),
+		provider:   provider,
+		opts:       llm.Options(config.AppConfig.FAQGeneration),
 		faqService: services.GetFAQService(),
+		cache:      services.GetFAQAnswerCache(),
 	}, nil
 }
 
@@ -37,6 +41,20 @@ func (f *FAQAgent) Name() string {
 }
 
 func (f *FAQAgent) Process(ctx context.Context, input *AgentInput) (*AgentOutput, error) {
+	ctx, span := tracing.Start(ctx, "agent."+f.Name())
+	defer span.End()
+
+	// pregunta repetida: misma respuesta sin buscar ni llamar al LLM
+	cacheKey := f.cacheKey(input)
+	if cacheKey != "" {
+		if cached, ok := f.cache.Get(cacheKey); ok {
+			metrics.FAQCacheLookups.WithLabelValues("hit").Inc()
+			utils.Logf(input.RequestID, "💾 FAQ respondida desde cache")
+			return &AgentOutput{Response: cached}, nil
+		}
+		metrics.FAQCacheLookups.WithLabelValues("miss").Inc()
+	}
+
 	faqs := f.faqService.SearchFAQs(input.Message, "", "")
 
 	if len(faqs) == 0 {
@@ -45,25 +63,46 @@ func (f *FAQAgent) Process(ctx context.Context, input *AgentInput) (*AgentOutput
 		}, nil
 	}
 
-	prompt := f.buildPrompt(input, faqs)
-
-	resp, err := f.model.GenerateContent(ctx, genai.Text(prompt))
+	prompt, err := f.buildPrompt(input, faqs)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return nil, fmt.Errorf("no response from model")
+	start := time.Now()
+	responseText, err := f.provider.Generate(ctx, promptParts(prompt, input), f.opts)
+	metrics.ObserveGemini(f.Name(), start, err)
+	if err != nil {
+		return nil, err
 	}
 
-	responseText := fmt.Sprintf("%v", resp.Candidates[0].Content.Parts[0])
-
+	response := strings.TrimSpace(responseText)
+	if cacheKey != "" && response != "" {
+		f.cache.Set(cacheKey, response)
+	}
 	return &AgentOutput{
-		Response: strings.TrimSpace(responseText),
+		Response: response,
 	}, nil
 }
 
-func (f *FAQAgent) buildPrompt(input *AgentInput, faqs []models.FAQ) string {
+// cacheKey identidad de la respuesta: pregunta normalizada + versión de las FAQs + tono
+// (persona) + template vigente. "" = no cachear (cache apagado o turno con adjunto).
+func (f *FAQAgent) cacheKey(input *AgentInput) string {
+	if f.cache == nil || !f.cache.Enabled() || input.Media != nil || input.MediaText != "" {
+		return ""
+	}
+	query := services.NormalizeFAQQuery(input.Message)
+	if query == "" {
+		return ""
+	}
+	source, _, err := services.GetPromptStore().Source("faq")
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d\x00%s\x00%s\x00%s", f.faqService.Version(), query, personaText(input), source)))
+	return hex.EncodeToString(sum[:])
+}
+
+func (f *FAQAgent) buildPrompt(input *AgentInput, faqs []models.FAQ) (string, error) {
 	faqContext := "\n\nFAQs RELEVANTES:\n"
 	for i, faq := range faqs {
 		if i >= 5 {
@@ -72,10 +111,28 @@ func (f *FAQAgent) buildPrompt(input *AgentInput, faqs []models.FAQ) string {
 		faqContext += fmt.Sprintf("\nP: %s\nR: %s\n", faq.Pregunta, faq.Respuesta)
 	}
 
-	return fmt.Sprintf(`Eres el Agente de FAQ de BOB Subastas. Tu especialidad es responder preguntas frecuentes.
+	prompt, err := services.GetPromptStore().Render("faq", services.PromptData{
+		Message:   input.Message,
+		SessionID: input.SessionID,
+		Channel:   input.Channel,
+		FAQs:      faqContext,
+		Persona:   personaText(input),
+	})
+	if err != nil {
+		return "", err
+	}
+	return prompt, nil
+}
+
+func init() {
+	services.RegisterDefaultPrompt("faq", faqPromptTemplate, "Message", "FAQs")
+}
+
+// faqPromptTemplate template por defecto (editable vía /api/admin/prompts/faq)
+const faqPromptTemplate = `Eres el Agente de FAQ de BOB Subastas. Tu especialidad es responder preguntas frecuentes.
 
-PREGUNTA DEL USUARIO: "%s"
-%s
+PREGUNTA DEL USUARIO: "{{.Message}}"
+{{.FAQs}}
 
 INSTRUCCIONES:
 1. Responde la pregunta usando la información de las FAQs
@@ -84,7 +141,6 @@ INSTRUCCIONES:
 4. Usa un tono amigable y profesional
 5. Si la información no está en las FAQs, reconócelo y ofrece ayuda alternativa
 6. NO inventes información que no esté en las FAQs
-7. Incluye enlaces relevantes si están en las FAQs
+7. Incluye enlaces relevantes si están en las FAQs{{.Persona}}
 
-Responde de manera directa y útil.`, input.Message, faqContext)
-}
+Responde de manera directa y útil.`
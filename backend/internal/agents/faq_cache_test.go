@@ -0,0 +1,77 @@
+package agents
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"bob-hackathon/internal/config"
+	"bob-hackathon/internal/llm"
+	"bob-hackathon/internal/services"
+)
+
+// writeFAQs deja un faqs.csv con una sola FAQ y lo recarga como la subida por admin
+func writeFAQs(t *testing.T, respuesta string) {
+	t.Helper()
+	csv := "Id,Categoría,Empresa,Pregunta,Respuesta\n1,Pagos,Todos,¿Qué garantía pido?," + respuesta + "\n"
+	if err := os.WriteFile(filepath.Join(config.AppConfig.DataDir, "faqs.csv"), []byte(csv), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	services.ReloadFAQs()
+}
+
+func TestFAQAgentCacheHitAndInvalidation(t *testing.T) {
+	writeFAQs(t, "Un depósito de garantía del 10%.")
+	p := llm.NewMockProvider("La garantía es el 10% del precio base.", "Ahora la garantía es de S/ 500.")
+	f, err := NewFAQAgent(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.cache = services.NewResponseCache(time.Hour, 10)
+
+	ask := func(message string) string {
+		t.Helper()
+		out, err := f.Process(context.Background(), &AgentInput{SessionID: "faq-cache", Channel: "web", Message: message})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out.Response
+	}
+
+	first := ask("garantía")
+	// misma pregunta con otras mayúsculas, tildes y signos: sale del cache
+	if again := ask("¡GARANTIA!"); again != first {
+		t.Fatalf("cached = %q, want %q", again, first)
+	}
+	if calls := len(p.Calls()); calls != 1 {
+		t.Fatalf("LLM calls = %d, want 1", calls)
+	}
+
+	// subir FAQs nuevas invalida lo cacheado
+	writeFAQs(t, "Un depósito fijo de S/ 500.")
+	if got := ask("garantía"); got == first || len(p.Calls()) != 2 {
+		t.Fatalf("after upload = %q with %d calls", got, len(p.Calls()))
+	}
+}
+
+func TestFAQAgentCacheSkipsMedia(t *testing.T) {
+	writeFAQs(t, "Un depósito de garantía del 10%.")
+	p := llm.NewMockProvider("respuesta")
+	f, err := NewFAQAgent(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.cache = services.NewResponseCache(time.Hour, 10)
+
+	// con adjunto la respuesta depende del archivo: nunca se cachea
+	for i := 0; i < 2; i++ {
+		if _, err := f.Process(context.Background(), &AgentInput{SessionID: "faq-media", Channel: "web", Message: "garantía", MediaText: "Voucher S/ 1,500"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls := len(p.Calls()); calls != 2 || f.cache.Len() != 0 {
+		t.Fatalf("LLM calls = %d, cached = %d", calls, f.cache.Len())
+	}
+}
@@ -0,0 +1,84 @@
+package agents
+
+import (
+	"context"
+	"testing"
+
+	"bob-hackathon/internal/config"
+	"bob-hackathon/internal/llm"
+)
+
+// optsRecorder proveedor que guarda las opciones de muestreo de cada llamada
+type optsRecorder struct {
+	reply string
+	opts  []llm.Options
+}
+
+func (p *optsRecorder) Name() string { return "recorder" }
+
+func (p *optsRecorder) Generate(_ context.Context, _ []llm.Part, opts llm.Options) (string, error) {
+	p.opts = append(p.opts, opts)
+	return p.reply, nil
+}
+
+func (p *optsRecorder) GenerateStream(ctx context.Context, prompt []llm.Part, opts llm.Options, onChunk func(string) error) (string, error) {
+	text, err := p.Generate(ctx, prompt, opts)
+	if err == nil {
+		err = onChunk(text)
+	}
+	return text, err
+}
+
+func TestAgentsUseTheirGenerationConfig(t *testing.T) {
+	prev := *config.AppConfig
+	defer func() { *config.AppConfig = prev }()
+	config.AppConfig.OrchestratorGeneration = config.GenerationConfig{Temperature: 0.3, TopP: 0.9, TopK: 40}
+	config.AppConfig.FAQGeneration = config.GenerationConfig{Temperature: 0.4, TopP: 0.9, TopK: 40}
+	config.AppConfig.AuctionGeneration = config.GenerationConfig{Temperature: 0.7, TopP: 0.95, TopK: 40}
+	config.AppConfig.ScoringGeneration = config.GenerationConfig{Temperature: 0.1, TopP: 0.8, TopK: 20}
+
+	p := &optsRecorder{}
+	orchestrator, _ := NewOrchestratorAgent(p)
+	faq, _ := NewFAQAgent(p)
+	auction, _ := NewAuctionAgent(p)
+	scoring, _ := NewScoringAgent(p)
+
+	cases := []struct {
+		name string
+		got  llm.Options
+		want config.GenerationConfig
+	}{
+		{"orchestrator", orchestrator.opts, config.AppConfig.OrchestratorGeneration},
+		{"faq", faq.opts, config.AppConfig.FAQGeneration},
+		{"auction", auction.opts, config.AppConfig.AuctionGeneration},
+		{"scoring", scoring.opts, config.AppConfig.ScoringGeneration},
+	}
+	for _, c := range cases {
+		if c.got != llm.Options(c.want) {
+			t.Errorf("%s opts = %+v, want %+v", c.name, c.got, c.want)
+		}
+	}
+	if scoring.opts.Temperature > 0.2 {
+		t.Fatalf("scoring temperature = %v, want <= 0.2 for deterministic JSON", scoring.opts.Temperature)
+	}
+}
+
+func TestScoringAgentSendsLowTemperature(t *testing.T) {
+	prev := config.AppConfig.ScoringGeneration
+	config.AppConfig.ScoringGeneration = config.GenerationConfig{Temperature: 0, TopP: 0.8, TopK: 20}
+	defer func() { config.AppConfig.ScoringGeneration = prev }()
+
+	p := &optsRecorder{reply: `{"total_score": 50}`}
+	scoring, err := NewScoringAgent(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = scoring.Process(context.Background(), &AgentInput{Message: "hola", SessionID: "gen-1", Channel: "web"})
+	if len(p.opts) != 1 {
+		t.Fatalf("provider called %d times", len(p.opts))
+	}
+	// temperatura 0 se envía tal cual (no se reemplaza por el default del modelo)
+	if got := p.opts[0]; got.Temperature != 0 || got.TopK != 20 || got.TopP != 0.8 {
+		t.Fatalf("opts sent = %+v", got)
+	}
+}
@@ -0,0 +1,233 @@
+package agents
+
+import (
+	"bob-hackathon/internal/metrics"
+	"bob-hackathon/internal/services"
+	"bob-hackathon/internal/utils"
+	"context"
+	"sort"
+	"strings"
+)
+
+// IntentPredicate condición sobre el mensaje normalizado (sin mayúsculas, tildes ni signos)
+type IntentPredicate func(normalized string) bool
+
+// IntentRule regla rápida de intención, con el mismo esquema que pkg/rules del bot:
+// se aplica si se cumplen todos los predicados; mayor prioridad primero
+type IntentRule struct {
+	Name     string
+	Priority int
+	WhenAll  []IntentPredicate
+	Then     func(input *AgentInput) (*AgentOutput, error)
+}
+
+// IntentShortcut resuelve sin LLM los mensajes obvios (saludos, gracias, "precio del toyota")
+// y deja el resto al orquestador; lo que ninguna regla reconoce con certeza va al LLM
+type IntentShortcut struct {
+	rules    []IntentRule
+	fallback Agent
+}
+
+func NewIntentShortcut(fallback Agent, rules []IntentRule) *IntentShortcut {
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].Priority > rules[j].Priority })
+	return &IntentShortcut{rules: rules, fallback: fallback}
+}
+
+func (s *IntentShortcut) Name() string {
+	return s.fallback.Name()
+}
+
+func (s *IntentShortcut) Process(ctx context.Context, input *AgentInput) (*AgentOutput, error) {
+	// con adjunto el texto no cuenta toda la historia: decide el LLM
+	if input.Media == nil && input.MediaText == "" {
+		if out, rule := s.match(input); out != nil {
+			metrics.IntentShortcuts.WithLabelValues(rule).Inc()
+			utils.Logf(input.RequestID, "⚡ Intent %s resuelto por la regla %q (sin orquestador)", out.IntentDetected, rule)
+			return out, nil
+		}
+	}
+	return s.fallback.Process(ctx, input)
+}
+
+// match primera regla que se cumple y responde; nil si ninguna
+func (s *IntentShortcut) match(input *AgentInput) (*AgentOutput, string) {
+	normalized := services.NormalizeFAQQuery(input.Message)
+	if normalized == "" {
+		return nil, ""
+	}
+	for _, rule := range s.rules {
+		matched := true
+		for _, pred := range rule.WhenAll {
+			if !pred(normalized) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		out, err := rule.Then(input)
+		if err == nil && out != nil {
+			return out, rule.Name
+		}
+	}
+	return nil, ""
+}
+
+// Predicados
+
+// OnlyWords todas las palabras del mensaje están en vocab
+func OnlyWords(vocab ...string) IntentPredicate {
+	set := wordSet(vocab)
+	return func(normalized string) bool {
+		for _, w := range strings.Fields(normalized) {
+			if !set[w] {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// AnyWord alguna palabra (o frase de varias palabras) de words aparece completa en el mensaje
+func AnyWord(words ...string) IntentPredicate {
+	return func(normalized string) bool {
+		padded := " " + normalized + " "
+		for _, w := range words {
+			if strings.Contains(padded, " "+w+" ") {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MaxWords mensajes cortos: en los largos una palabra clave no alcanza para decidir
+func MaxWords(n int) IntentPredicate {
+	return func(normalized string) bool {
+		return len(strings.Fields(normalized)) <= n
+	}
+}
+
+// Not niega un predicado
+func Not(p IntentPredicate) IntentPredicate {
+	return func(normalized string) bool { return !p(normalized) }
+}
+
+func wordSet(words []string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		set[w] = true
+	}
+	return set
+}
+
+// Acciones
+
+// ReplyWith responde con el prompt name (editable vía /api/admin/prompts/<name>) sin rutear
+func ReplyWith(name string, intent IntentType) func(input *AgentInput) (*AgentOutput, error) {
+	return func(input *AgentInput) (*AgentOutput, error) {
+		reply, err := services.GetPromptStore().Render(name, services.PromptData{
+			Message:   input.Message,
+			SessionID: input.SessionID,
+			Channel:   input.Channel,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &AgentOutput{
+			Response:       strings.TrimSpace(reply),
+			IntentDetected: string(intent),
+			Confidence:     1,
+		}, nil
+	}
+}
+
+// routeFallbackReply lo que responde el controller si el agente especialista falla
+// (con el orquestador LLM es su propia respuesta)
+const routeFallbackReply = "Disculpa, no pude consultar esa información en este momento. ¿Podrías intentarlo de nuevo en unos minutos?"
+
+// RouteTo deriva al agente especialista sin pasar por el orquestador
+func RouteTo(agent string, intent IntentType) func(input *AgentInput) (*AgentOutput, error) {
+	return func(input *AgentInput) (*AgentOutput, error) {
+		return &AgentOutput{
+			Response:       routeFallbackReply,
+			ShouldRoute:    true,
+			RouteTo:        agent,
+			IntentDetected: string(intent),
+			Confidence:     1,
+		}, nil
+	}
+}
+
+// Vocabulario de las reglas por defecto (ya normalizado)
+var (
+	greetingWords = []string{"hola", "holi", "holaa", "buenas", "buenos", "buen", "dia", "dias", "tardes", "noches", "hey", "hi", "hello", "que", "tal", "saludos", "bob", "alo"}
+	greetingHeads = []string{"hola", "holi", "holaa", "buenas", "buenos", "buen", "hey", "hi", "hello", "saludos", "alo"}
+	thanksWords   = []string{"gracias", "muchas", "muchisimas", "mil", "ok", "okay", "oki", "genial", "perfecto", "excelente", "listo", "vale", "bueno", "entendido", "super", "muy", "amable", "te", "lo", "agradezco"}
+	thanksHeads   = []string{"gracias", "agradezco"}
+	goodbyeWords  = append([]string{"chau", "chao", "adios", "hasta", "luego", "pronto", "manana", "nos", "vemos", "bye"}, thanksWords...)
+	goodbyeHeads  = []string{"chau", "chao", "adios", "hasta luego", "hasta pronto", "hasta manana", "nos vemos", "bye"}
+
+	vehicleWords = []string{
+		"auto", "autos", "carro", "carros", "camioneta", "camionetas", "vehiculo", "vehiculos", "moto", "motos",
+		"camion", "camiones", "van", "bus", "sedan", "suv", "pickup", "furgoneta",
+		"toyota", "hyundai", "kia", "nissan", "chevrolet", "suzuki", "mitsubishi", "mazda", "honda", "volkswagen",
+		"ford", "subaru", "renault", "peugeot", "jac", "changan", "geely", "chery", "bmw", "mercedes", "audi",
+		"volvo", "isuzu", "hino", "jeep", "dodge", "fiat", "foton", "dfsk", "great wall",
+	}
+	priceWords = []string{"precio", "precios", "cuanto", "cuesta", "cuestan", "vale", "valen", "costo", "comprar", "compro", "ofertar", "subasta", "subastas", "busco", "disponible", "disponibles", "venden"}
+	faqWords   = []string{"registro", "registrarme", "registrar", "inscribirme", "inscripcion", "garantia", "comision", "participar", "participo", "requisitos", "como funciona"}
+)
+
+// DefaultIntentRules saludos, agradecimientos y despedidas se contestan directo;
+// preguntas cortas con palabras clave claras van al FAQ o al agente de subastas
+func DefaultIntentRules() []IntentRule {
+	return []IntentRule{
+		{
+			Name:     "greeting",
+			Priority: 100,
+			WhenAll:  []IntentPredicate{OnlyWords(greetingWords...), AnyWord(greetingHeads...)},
+			Then:     ReplyWith("shortcut_greeting", IntentGeneral),
+		},
+		{
+			Name:     "goodbye",
+			Priority: 90,
+			WhenAll:  []IntentPredicate{OnlyWords(goodbyeWords...), AnyWord(goodbyeHeads...)},
+			Then:     ReplyWith("shortcut_goodbye", IntentGeneral),
+		},
+		{
+			Name:     "thanks",
+			Priority: 80,
+			WhenAll:  []IntentPredicate{OnlyWords(thanksWords...), AnyWord(thanksHeads...)},
+			Then:     ReplyWith("shortcut_thanks", IntentGeneral),
+		},
+		{
+			// "¿cómo me registro?"; si además nombra un vehículo decide el LLM
+			Name:     "faq keywords",
+			Priority: 60,
+			WhenAll:  []IntentPredicate{MaxWords(8), AnyWord(faqWords...), Not(AnyWord(vehicleWords...))},
+			Then:     RouteTo("faq_agent", IntentFAQ),
+		},
+		{
+			// "precio del toyota", "busco camioneta"
+			Name:     "vehicle price",
+			Priority: 50,
+			WhenAll:  []IntentPredicate{MaxWords(8), AnyWord(vehicleWords...), AnyWord(priceWords...), Not(AnyWord(faqWords...))},
+			Then:     RouteTo("auction_agent", IntentSubasta),
+		},
+	}
+}
+
+func init() {
+	services.RegisterDefaultPrompt("shortcut_greeting", shortcutGreetingTemplate)
+	services.RegisterDefaultPrompt("shortcut_thanks", shortcutThanksTemplate)
+	services.RegisterDefaultPrompt("shortcut_goodbye", shortcutGoodbyeTemplate)
+}
+
+// Respuestas directas de las reglas (editables vía /api/admin/prompts/shortcut_*)
+const shortcutGreetingTemplate = `¡Hola! 👋 Soy el asistente de BOB Subastas. Te ayudo a encontrar vehículos en subasta y a resolver tus dudas sobre cómo registrarte y participar. ¿Qué estás buscando?`
+
+const shortcutThanksTemplate = `¡Con gusto! 😊 Si quieres te ayudo a buscar un vehículo o resolver otra duda.`
+
+const shortcutGoodbyeTemplate = `¡Hasta pronto! 👋 Cuando quieras seguimos buscando tu próximo vehículo en BOB Subastas.`
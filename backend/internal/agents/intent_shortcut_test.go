@@ -0,0 +1,72 @@
+package agents
+
+import (
+	"context"
+	"testing"
+
+	"bob-hackathon/internal/llm"
+	"bob-hackathon/internal/services"
+)
+
+// newShortcutOrchestrator reglas por defecto delante del orquestador real con un proveedor mock
+func newShortcutOrchestrator(t *testing.T) (*IntentShortcut, *llm.MockProvider) {
+	t.Helper()
+	p := llm.NewMockProvider(`{"intent":"ambiguo","confidence":0.4,"shouldRoute":false,"routeTo":"","response":"¿Me cuentas un poco más?"}`)
+	o, err := NewOrchestratorAgent(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewIntentShortcut(o, DefaultIntentRules()), p
+}
+
+func TestIntentShortcutWithoutLLM(t *testing.T) {
+	cases := []struct {
+		message string
+		intent  IntentType
+		routeTo string
+	}{
+		{"Hola", IntentGeneral, ""},
+		{"¡Buenas tardes!", IntentGeneral, ""},
+		{"hola, ¿qué tal?", IntentGeneral, ""},
+		{"Muchas gracias!!", IntentGeneral, ""},
+		{"ok gracias, chau", IntentGeneral, ""},
+		{"precio del toyota", IntentSubasta, "auction_agent"},
+		{"¿Busco camioneta Hyundai?", IntentSubasta, "auction_agent"},
+		{"¿Cómo me registro?", IntentFAQ, "faq_agent"},
+	}
+	for _, c := range cases {
+		s, p := newShortcutOrchestrator(t)
+		out, err := s.Process(context.Background(), &AgentInput{SessionID: "shortcut", Channel: "web", Message: c.message})
+		if err != nil {
+			t.Fatalf("%q: %v", c.message, err)
+		}
+		if out.IntentDetected != string(c.intent) || out.RouteTo != c.routeTo || out.ShouldRoute != (c.routeTo != "") || out.Response == "" {
+			t.Errorf("%q = %+v", c.message, out)
+		}
+		if calls := len(p.Calls()); calls != 0 {
+			t.Errorf("%q: LLM calls = %d, want 0", c.message, calls)
+		}
+	}
+}
+
+func TestIntentShortcutFallsBackToLLM(t *testing.T) {
+	for _, input := range []*AgentInput{
+		{Message: "hola, quería saber si la Hilux tiene choques"}, // saludo con una consulta real
+		{Message: "gracias pero no me convence"},
+		{Message: "¿cuánto es la comisión si compro el toyota?"}, // FAQ y vehículo a la vez
+		{Message: "tengo una duda con lo que me escribieron ayer sobre mi oferta y el precio final del carro"},
+		{Message: "mmm"},
+		{Message: "hola", MediaText: "Voucher de depósito S/ 1,500"}, // con adjunto decide el LLM
+		{Message: "hola", Media: &services.ChatMediaData{MimeType: "image/png", Data: []byte("png")}},
+	} {
+		s, p := newShortcutOrchestrator(t)
+		input.SessionID, input.Channel = "shortcut-llm", "web"
+		out, err := s.Process(context.Background(), input)
+		if err != nil {
+			t.Fatalf("%q: %v", input.Message, err)
+		}
+		if calls := len(p.Calls()); calls != 1 || out.IntentDetected != string(IntentAmbiguo) {
+			t.Errorf("%q: LLM calls = %d, intent %q; want the orchestrator", input.Message, calls, out.IntentDetected)
+		}
+	}
+}
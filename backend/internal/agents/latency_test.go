@@ -0,0 +1,104 @@
+package agents
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"bob-hackathon/internal/models"
+)
+
+func TestComputeResponseLatency(t *testing.T) {
+	t0 := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	at := func(sec int) time.Time { return t0.Add(time.Duration(sec) * time.Second) }
+	msg := func(role string, sec int) models.Message {
+		return models.Message{Role: role, Content: "x", Timestamp: at(sec)}
+	}
+
+	cases := []struct {
+		name    string
+		history []models.Message
+		want    ResponseLatency
+	}{
+		{name: "empty", history: nil},
+		{name: "only user messages", history: []models.Message{msg("user", 0), msg("user", 30)}},
+		{
+			name:    "single reply",
+			history: []models.Message{msg("user", 0), msg("assistant", 5), msg("user", 65)},
+			want:    ResponseLatency{Samples: 1, AvgSec: 60, MedianSec: 60, Under5Min: 1},
+		},
+		{
+			name: "odd samples",
+			history: []models.Message{
+				msg("assistant", 0), msg("user", 30),
+				msg("assistant", 40), msg("user", 640), // 600s
+				msg("assistant", 700), msg("user", 790), // 90s
+			},
+			want: ResponseLatency{Samples: 3, AvgSec: 240, MedianSec: 90, Under5Min: 2},
+		},
+		{
+			name: "even samples and consecutive user messages",
+			history: []models.Message{
+				msg("assistant", 0), msg("user", 10), msg("user", 500), // solo cuenta el primero
+				msg("assistant", 510), msg("user", 540),
+			},
+			want: ResponseLatency{Samples: 2, AvgSec: 20, MedianSec: 20, Under5Min: 2},
+		},
+		{
+			name: "missing and inverted timestamps ignored",
+			history: []models.Message{
+				msg("assistant", 100), msg("user", 50), // reloj invertido
+				{Role: "assistant"}, msg("user", 200), // sin timestamp
+				msg("assistant", 300), msg("user", 420),
+			},
+			want: ResponseLatency{Samples: 1, AvgSec: 120, MedianSec: 120, Under5Min: 1},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := ComputeResponseLatency(c.history); got != c.want {
+				t.Fatalf("ComputeResponseLatency = %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestBuildLatencyText(t *testing.T) {
+	t0 := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	if got := buildLatencyText([]models.Message{{Role: "user", Timestamp: t0}}); got != "" {
+		t.Fatalf("no samples = %q, want empty", got)
+	}
+	history := []models.Message{
+		{Role: "assistant", Timestamp: t0},
+		{Role: "user", Timestamp: t0.Add(90 * time.Second)},
+		{Role: "assistant", Timestamp: t0.Add(100 * time.Second)},
+		{Role: "user", Timestamp: t0.Add(100*time.Second + 10*time.Minute)},
+	}
+	got := buildLatencyText(history)
+	for _, want := range []string{"VELOCIDAD DE RESPUESTA", "mediana 5m45s", "promedio 5m45s", "1 de 2 respuestas en menos de 5 minutos"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("latency text %q missing %q", got, want)
+		}
+	}
+}
+
+func TestPromptsIncludeLatency(t *testing.T) {
+	t0 := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	input := &AgentInput{SessionID: "lat-1", Channel: "web", Message: "sí", ConversationHistory: []models.Message{
+		{Role: "assistant", Content: "¿Te interesa?", Timestamp: t0},
+		{Role: "user", Content: "sí", Timestamp: t0.Add(time.Minute)},
+	}}
+	scoring, err := (&ScoringAgent{}).buildPrompt(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orchestrator, err := (&OrchestratorAgent{}).buildPrompt(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, prompt := range map[string]string{"scoring": scoring, "orchestrator": orchestrator} {
+		if !strings.Contains(prompt, "VELOCIDAD DE RESPUESTA DEL USUARIO") {
+			t.Errorf("%s prompt missing latency summary", name)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package agents
+
+import (
+	"os"
+	"testing"
+
+	"bob-hackathon/internal/config"
+)
+
+// TestMain config mínima: prompts por defecto (DataDir vacío) y sin API key
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "agents-test")
+	if err != nil {
+		panic(err)
+	}
+	config.AppConfig = &config.Config{DataDir: dir, LLMProvider: "mock", USDToPEN: 3.75}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
@@ -2,30 +2,30 @@ package agents
 
 import (
 	"bob-hackathon/internal/config"
+	"bob-hackathon/internal/llm"
+	"bob-hackathon/internal/metrics"
+	"bob-hackathon/internal/services"
+	"bob-hackathon/internal/tracing"
+	"bob-hackathon/internal/utils"
 	"context"
 	"encoding/json"
 	"fmt"
-	"strings"
-
-	"github.com/google/generative-ai-go/genai"
-	"google.golang.org/api/option"
+	"time"
 )
 
 type OrchestratorAgent struct {
-	client *genai.Client
-	model  *genai.GenerativeModel
+	provider llm.Provider
+	opts     llm.Options
 }
 
-func NewOrchestratorAgent() (*OrchestratorAgent, error) {
-	ctx := context.Background()
-	client, err := genai.NewClient(ctx, option.WithAPIKey(config.AppConfig.GeminiAPIKey))
-	if err != nil {
-		return nil, err
+func NewOrchestratorAgent(provider llm.Provider) (*OrchestratorAgent, error) {
+	if provider == nil {
+		return nil, ErrNilProvider
 	}
 
 	return &OrchestratorAgent{
-		client: client,
-		model:  client.GenerativeModel(config.AppConfig.GeminiModel),
+		provider: provider,
+		opts:     llm.Options(config.AppConfig.OrchestratorGeneration),
 	}, nil
 }
 
@@ -34,37 +34,60 @@ func (o *OrchestratorAgent) Name() string {
 }
 
 func (o *OrchestratorAgent) Process(ctx context.Context, input *AgentInput) (*AgentOutput, error) {
-	prompt := o.buildPrompt(input)
-
-	resp, err := o.model.GenerateContent(ctx, genai.Text(prompt))
+	ctx, span := tracing.Start(ctx, "agent."+o.Name())
+	defer span.End()
+	prompt, err := o.buildPrompt(input)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return nil, fmt.Errorf("no response from model")
+	start := time.Now()
+	responseText, err := o.provider.Generate(ctx, promptParts(prompt, input), o.opts)
+	metrics.ObserveGemini(o.Name(), start, err)
+	if err != nil {
+		return nil, err
 	}
 
-	responseText := fmt.Sprintf("%v", resp.Candidates[0].Content.Parts[0])
-
 	decision := o.parseDecision(responseText)
 
 	return decision, nil
 }
 
-func (o *OrchestratorAgent) buildPrompt(input *AgentInput) string {
-	historyText := ""
+func (o *OrchestratorAgent) buildPrompt(input *AgentInput) (string, error) {
+	historyText := buildSummaryText(input.Summary)
 	if len(input.ConversationHistory) > 0 {
-		historyText = "\n\nHISTORIAL DE CONVERSACIÓN:\n"
+		historyText += "\n\nHISTORIAL DE CONVERSACIÓN:\n"
 		for _, msg := range input.ConversationHistory {
 			historyText += fmt.Sprintf("%s: %s\n", msg.Role, msg.Content)
 		}
 	}
 
-	return fmt.Sprintf(`Eres el Agente Orquestador de BOB Subastas. Tu tarea es analizar el mensaje del usuario y decidir cómo manejarlo.
+	name := services.PromptVariantName("orchestrator", input.PromptVariant)
+	prompt, err := services.GetPromptStore().Render(name, services.PromptData{
+		Message:   input.Message,
+		SessionID: input.SessionID,
+		Channel:   input.Channel,
+		History:   historyText,
+		Latency:   buildLatencyText(input.ConversationHistory),
+		Persona:   personaText(input),
+	})
+	if err != nil {
+		return "", err
+	}
+	return prompt, nil
+}
+
+func init() {
+	services.RegisterDefaultPrompt("orchestrator", orchestratorPromptTemplate, "Message")
+	// Variante B del experimento A/B: arranca igual a la A y se edita vía admin
+	services.RegisterDefaultPrompt("orchestrator_b", orchestratorPromptTemplate, "Message")
+}
 
-MENSAJE DEL USUARIO: "%s"
-CANAL: %s%s
+// orchestratorPromptTemplate template por defecto (editable vía /api/admin/prompts/orchestrator)
+const orchestratorPromptTemplate = `Eres el Agente Orquestador de BOB Subastas. Tu tarea es analizar el mensaje del usuario y decidir cómo manejarlo.
+
+MENSAJE DEL USUARIO: "{{.Message}}"
+CANAL: {{.Channel}}{{.History}}{{.Latency}}
 
 ANÁLISIS REQUERIDO:
 
@@ -94,7 +117,8 @@ FORMATO DE RESPUESTA (JSON):
   "shouldRoute": true/false,
   "routeTo": "faq_agent|auction_agent|null",
   "response": "tu respuesta si no se rutea",
-  "reasoning": "breve explicación de tu decisión"
+  "reasoning": "breve explicación de tu decisión",
+  "highIntent": true/false
 }
 
 IMPORTANTE:
@@ -102,9 +126,9 @@ IMPORTANTE:
 - Si detectas spam, sé educado pero firme
 - Si es ambiguo, pide específicamente qué necesita
 - Si es saludo inicial, da bienvenida cálida y explica cómo puedes ayudar
+- highIntent = true solo si el usuario menciona presupuesto, urgencia o plazo de compra, o pide visitar/ofertar{{.Persona}}
 
-Responde SOLO con el JSON, sin texto adicional.`, input.Message, input.Channel, historyText)
-}
+Responde SOLO con el JSON, sin texto adicional.`
 
 type OrchestratorDecision struct {
 	Intent      string  `json:"intent"`
@@ -113,15 +137,12 @@ type OrchestratorDecision struct {
 	RouteTo     string  `json:"routeTo"`
 	Response    string  `json:"response"`
 	Reasoning   string  `json:"reasoning"`
+	HighIntent  bool    `json:"highIntent"`
 }
 
 func (o *OrchestratorAgent) parseDecision(responseText string) *AgentOutput {
-	responseText = strings.TrimSpace(responseText)
-
-	start := strings.Index(responseText, "{")
-	end := strings.LastIndex(responseText, "}")
-
-	if start == -1 || end == -1 {
+	jsonStr, err := utils.ExtractJSON(responseText)
+	if err != nil {
 		return &AgentOutput{
 			Response:       "Lo siento, hubo un error procesando tu mensaje. ¿Podrías reformularlo?",
 			ShouldRoute:    false,
@@ -130,8 +151,6 @@ func (o *OrchestratorAgent) parseDecision(responseText string) *AgentOutput {
 		}
 	}
 
-	jsonStr := responseText[start : end+1]
-
 	var decision OrchestratorDecision
 	if err := json.Unmarshal([]byte(jsonStr), &decision); err != nil {
 		return &AgentOutput{
@@ -148,5 +167,6 @@ func (o *OrchestratorAgent) parseDecision(responseText string) *AgentOutput {
 		RouteTo:        decision.RouteTo,
 		IntentDetected: decision.Intent,
 		Confidence:     decision.Confidence,
+		HighIntent:     decision.HighIntent,
 	}
 }
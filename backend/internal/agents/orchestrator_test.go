@@ -0,0 +1,38 @@
+package agents
+
+import "testing"
+
+func TestParseDecision(t *testing.T) {
+	o := &OrchestratorAgent{}
+	cases := []struct {
+		name       string
+		in         string
+		intent     string
+		route      string
+		confidence float64
+	}{
+		{
+			name:       "fenced with prose",
+			in:         "Claro {nota}:\n```json\n{\"intent\":\"faq\",\"confidence\":0.9,\"shouldRoute\":true,\"routeTo\":\"faq_agent\",\"response\":\"\"}\n```",
+			intent:     "faq",
+			route:      "faq_agent",
+			confidence: 0.9,
+		},
+		{
+			name:       "response with braces and trailing commentary",
+			in:         `{"intent":"general","confidence":0.8,"shouldRoute":false,"response":"Hola {nombre}"} fin }`,
+			intent:     "general",
+			confidence: 0.8,
+		},
+		{name: "garbage", in: "no entiendo", intent: string(IntentAmbiguo)},
+		{name: "wrong types", in: `{"intent":"faq","confidence":"alta"}`, intent: string(IntentAmbiguo)},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := o.parseDecision(c.in)
+			if got.IntentDetected != c.intent || got.RouteTo != c.route || got.Confidence != c.confidence {
+				t.Fatalf("parseDecision = %+v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package agents
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPersonaPromptModifier(t *testing.T) {
+	const premium = "Cliente premium"
+	const whatsapp = "Estás en WhatsApp"
+	cases := []struct {
+		name, tier, channel string
+		want, notWant       []string
+	}{
+		{name: "premium tier", tier: "premium", channel: "web", want: []string{"ESTILO DE RESPUESTA", premium}, notWant: []string{whatsapp}},
+		{name: "premium on whatsapp", tier: "premium", channel: "whatsapp", want: []string{premium, whatsapp}},
+		{name: "free tier keeps base tone", tier: "free", channel: "web", notWant: []string{"ESTILO DE RESPUESTA", premium}},
+		{name: "no tier", channel: "web", notWant: []string{"ESTILO DE RESPUESTA"}},
+	}
+	o := &OrchestratorAgent{}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			prompt, err := o.buildPrompt(&AgentInput{SessionID: "s", Channel: c.channel, Tier: c.tier, Message: "hola"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, w := range c.want {
+				if !strings.Contains(prompt, w) {
+					t.Errorf("prompt missing %q", w)
+				}
+			}
+			for _, w := range c.notWant {
+				if strings.Contains(prompt, w) {
+					t.Errorf("prompt contains %q", w)
+				}
+			}
+		})
+	}
+}
+
+func TestPersonaInSubAgentPrompts(t *testing.T) {
+	input := &AgentInput{SessionID: "s", Channel: "web", Tier: "premium", Message: "¿requisitos?"}
+	faqPrompt, err := (&FAQAgent{}).buildPrompt(input, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auctionPrompt, err := (&AuctionAgent{}).buildPrompt(input, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, prompt := range map[string]string{"faq": faqPrompt, "auction": auctionPrompt} {
+		if !strings.Contains(prompt, "Cliente premium") {
+			t.Errorf("%s prompt missing premium modifier", name)
+		}
+	}
+}
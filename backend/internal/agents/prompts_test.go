@@ -0,0 +1,73 @@
+package agents
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"bob-hackathon/internal/config"
+	"bob-hackathon/internal/models"
+	"bob-hackathon/internal/services"
+)
+
+// Editar un prompt en el store cambia el próximo prompt que arma el agente
+func TestAgentPromptsFollowStore(t *testing.T) {
+	input := &AgentInput{SessionID: "s1", Channel: "web", Message: "¿cómo participo?"}
+	cases := []struct {
+		name   string
+		prompt string
+		source string
+		build  func() (string, error)
+		want   string
+	}{
+		{
+			name:   "faq",
+			prompt: "faq",
+			source: "FAQ EDITADO {{.Message}} {{.FAQs}}",
+			build: func() (string, error) {
+				return (&FAQAgent{}).buildPrompt(input, []models.FAQ{{Pregunta: "¿Cómo participo?", Respuesta: "Regístrate."}})
+			},
+			want: "FAQ EDITADO ¿cómo participo? \n\nFAQs RELEVANTES:\n\nP: ¿Cómo participo?\nR: Regístrate.\n",
+		},
+		{
+			name:   "orchestrator",
+			prompt: "orchestrator",
+			source: "ORQUESTADOR EDITADO {{.Message}}",
+			build:  func() (string, error) { return (&OrchestratorAgent{}).buildPrompt(input) },
+			want:   "ORQUESTADOR EDITADO ¿cómo participo?",
+		},
+		{
+			name:   "scoring",
+			prompt: "scoring",
+			source: "SCORING EDITADO{{.History}}",
+			build:  func() (string, error) { return (&ScoringAgent{}).buildPrompt(input) },
+			want:   "SCORING EDITADO",
+		},
+	}
+	store := services.GetPromptStore()
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			before, err := c.build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(before, "EDITADO") {
+				t.Fatalf("default prompt already edited: %q", before)
+			}
+			if err := store.Update(c.prompt, c.source); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				os.Remove(filepath.Join(config.AppConfig.DataDir, "prompts", c.prompt+".txt"))
+			})
+			after, err := c.build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if after != c.want {
+				t.Fatalf("prompt after edit = %q, want %q", after, c.want)
+			}
+		})
+	}
+}
@@ -2,32 +2,32 @@ package agents
 
 import (
 	"bob-hackathon/internal/config"
+	"bob-hackathon/internal/llm"
+	"bob-hackathon/internal/metrics"
 	"bob-hackathon/internal/models"
+	"bob-hackathon/internal/services"
+	"bob-hackathon/internal/tracing"
+	"bob-hackathon/internal/utils"
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"strings"
-
-	"github.com/google/generative-ai-go/genai"
-	"google.golang.org/api/option"
+	"time"
 )
 
 type ScoringAgent struct {
-	client *genai.Client
-	model  *genai.GenerativeModel
+	provider llm.Provider
+	opts     llm.Options
 }
 
-func NewScoringAgent() (*ScoringAgent, error) {
-	ctx := context.Background()
-	client, err := genai.NewClient(ctx, option.WithAPIKey(config.AppConfig.GeminiAPIKey))
-	if err != nil {
-		return nil, err
+func NewScoringAgent(provider llm.Provider) (*ScoringAgent, error) {
+	if provider == nil {
+		return nil, ErrNilProvider
 	}
 
 	return &ScoringAgent{
-		client: client,
-		model:  client.GenerativeModel(config.AppConfig.GeminiModel),
+		provider: provider,
+		opts:     llm.Options(config.AppConfig.ScoringGeneration),
 	}, nil
 }
 
@@ -35,21 +35,24 @@ func (s *ScoringAgent) Name() string {
 	return "Scoring_Agent"
 }
 
-func (s *ScoringAgent) Process(ctx context.Context, input *AgentInput) (*AgentOutput, error) {
-	prompt := s.buildPrompt(input)
+func (s *ScoringAgent) Process(ctx context.Context, input *AgentInput) (out *AgentOutput, err error) {
+	ctx, span := tracing.Start(ctx, "agent."+s.Name())
+	defer span.End()
+	defer func(begin time.Time) { metrics.ObserveScoring(begin, err) }(time.Now())
 
-	resp, err := s.model.GenerateContent(ctx, genai.Text(prompt))
+	prompt, err := s.buildPrompt(input)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return nil, fmt.Errorf("no response from model")
+	start := time.Now()
+	responseText, err := s.provider.Generate(ctx, []llm.Part{llm.Text(prompt)}, s.opts)
+	metrics.ObserveGemini(s.Name(), start, err)
+	if err != nil {
+		return nil, err
 	}
 
-	responseText := fmt.Sprintf("%v", resp.Candidates[0].Content.Parts[0])
-
-	scoringData := s.parseScoring(responseText)
+	scoringData := s.parseScoring(input.RequestID, responseText)
 
 	return &AgentOutput{
 		Response:    s.generateScoringMessage(scoringData),
@@ -58,20 +61,46 @@ func (s *ScoringAgent) Process(ctx context.Context, input *AgentInput) (*AgentOu
 	}, nil
 }
 
-func (s *ScoringAgent) buildPrompt(input *AgentInput) string {
-	historyText := ""
+func (s *ScoringAgent) buildPrompt(input *AgentInput) (string, error) {
+	historyText := buildSummaryText(input.Summary)
 	if len(input.ConversationHistory) > 0 {
-		historyText = "\n\nHISTORIAL COMPLETO DE CONVERSACIÓN:\n"
+		historyText += "\n\nHISTORIAL COMPLETO DE CONVERSACIÓN:\n"
 		for i, msg := range input.ConversationHistory {
 			historyText += fmt.Sprintf("[Mensaje %d] %s: %s\n", i+1, msg.Role, msg.Content)
 		}
 	}
 
-	return fmt.Sprintf(`Eres el Agente de Scoring de BOB Subastas. Tu tarea es analizar la conversación completa y calcular un score preciso de 0-100 puntos basado en 7 dimensiones oficiales.
+	behaviorText := buildBehaviorText(input.Behavior)
+	budget := ""
+	if input.BudgetPEN > 0 {
+		budget = fmt.Sprintf("\n\nPRESUPUESTO DETECTADO: S/ %.0f (normalizado a soles desde el texto del usuario; úsalo en DIMENSIÓN 3 como monto específico)", input.BudgetPEN)
+	}
+
+	prompt, err := services.GetPromptStore().Render("scoring", services.PromptData{
+		Message:   input.Message,
+		SessionID: input.SessionID,
+		Channel:   input.Channel,
+		History:   historyText,
+		Behavior:  behaviorText,
+		Budget:    budget,
+		Latency:   buildLatencyText(input.ConversationHistory),
+	})
+	if err != nil {
+		return "", err
+	}
+	return prompt, nil
+}
+
+func init() {
+	services.RegisterDefaultPrompt("scoring", scoringPromptTemplate, "History")
+}
+
+// scoringPromptTemplate template por defecto (editable vía /api/admin/prompts/scoring)
+const scoringPromptTemplate = `Eres el Agente de Scoring de BOB Subastas. Tu tarea es analizar la conversación completa y calcular un score preciso de 0-100 puntos basado en 7 dimensiones oficiales.
 
 CONVERSACIÓN A ANALIZAR:
-SessionID: %s
-Canal: %s%s
+SessionID: {{.SessionID}}
+Canal: {{.Channel}}{{.History}}{{.Behavior}}{{.Latency}}{{.Budget}}
 
 SISTEMA DE SCORING OFICIAL (Total: 0-100 puntos):
 
@@ -203,7 +232,41 @@ IMPORTANTE:
 5. La categoría debe corresponder exactamente al rango de puntos
 6. Responde SOLO con JSON válido, sin texto adicional
 
-Analiza y genera el scoring:`, input.SessionID, input.Channel, historyText)
+Analiza y genera el scoring:`
+
+// velocidadRespuesta traduce la latencia promedio al tramo de la Dimensión 2
+func velocidadRespuesta(avgSec float64) string {
+	switch {
+	case avgSec < 5*60:
+		return "<5min"
+	case avgSec < 30*60:
+		return "<30min"
+	default:
+		return ">30min"
+	}
+}
+
+// buildBehaviorText arma la sección de señales medidas por el canal; vacía si no hay datos
+func buildBehaviorText(b *models.BehaviorSignals) string {
+	if b == nil || (b.ResponseSamples == 0 && b.ReadSamples == 0) {
+		return ""
+	}
+
+	text := "\n\nSEÑALES DE COMPORTAMIENTO MEDIDAS (datos reales del canal, NO estimar):\n"
+	if b.ResponseSamples > 0 {
+		text += fmt.Sprintf("- Latencia promedio de respuesta del usuario: %.0f segundos (%d muestras) → velocidadRespuesta = \"%s\"\n",
+			b.AvgResponseLatencySec, b.ResponseSamples, velocidadRespuesta(b.AvgResponseLatencySec))
+	}
+	if b.ReadSamples > 0 {
+		text += fmt.Sprintf("- Tiempo promedio hasta leer nuestros mensajes: %.0f segundos (%d muestras)\n",
+			b.AvgReadLatencySec, b.ReadSamples)
+	}
+	if b.MsgIn > 0 || b.MsgOut > 0 {
+		text += fmt.Sprintf("- Mensajes del usuario/del bot: %d/%d, racha de %d día(s)\n",
+			b.MsgIn, b.MsgOut, b.StreakDays)
+	}
+	text += "Usa estas señales para la DIMENSIÓN 2 (Comportamiento Digital): la velocidad de respuesta debe salir de la latencia medida y la lectura rápida cuenta como engagement."
+	return text
 }
 
 type ScoringResponse struct {
@@ -268,18 +331,12 @@ type ScoringResponse struct {
 	ResumenEjecutivo   string   `json:"resumenEjecutivo"`
 }
 
-func (s *ScoringAgent) parseScoring(responseText string) *models.ScoringData {
-	responseText = strings.TrimSpace(responseText)
-
-	start := strings.Index(responseText, "{")
-	end := strings.LastIndex(responseText, "}")
-
-	if start == -1 || end == -1 {
+func (s *ScoringAgent) parseScoring(requestID, responseText string) *models.ScoringData {
+	jsonStr, err := utils.ExtractJSON(responseText)
+	if err != nil {
 		return s.defaultScoring("Error parseando respuesta del modelo")
 	}
 
-	jsonStr := responseText[start : end+1]
-
 	var scoring ScoringResponse
 	if err := json.Unmarshal([]byte(jsonStr), &scoring); err != nil {
 		return s.defaultScoring(fmt.Sprintf("Error JSON: %v", err))
@@ -336,17 +393,17 @@ func (s *ScoringAgent) parseScoring(responseText string) *models.ScoringData {
 	// Validar score
 	finalScore := scoring.TotalScore
 	if finalScore != calculatedScore {
-		log.Printf("⚠️ Warning: Gemini score %d != calculated %d, usando calculado", finalScore, calculatedScore)
+		utils.Logf(requestID, "⚠️ Warning: Gemini score %d != calculated %d, usando calculado", finalScore, calculatedScore)
 		finalScore = calculatedScore
 	}
 
 	// Limitar score a rango válido 0-100
 	if finalScore > 100 {
-		log.Printf("⚠️ Warning: Score %d excede 100, limitando", finalScore)
+		utils.Logf(requestID, "⚠️ Warning: Score %d excede 100, limitando", finalScore)
 		finalScore = 100
 	}
 	if finalScore < 0 {
-		log.Printf("⚠️ Warning: Score %d menor que 0, limitando", finalScore)
+		utils.Logf(requestID, "⚠️ Warning: Score %d menor que 0, limitando", finalScore)
 		finalScore = 0
 	}
 
@@ -0,0 +1,130 @@
+package agents
+
+import (
+	"strings"
+	"testing"
+
+	"bob-hackathon/internal/models"
+)
+
+func TestVelocidadRespuesta(t *testing.T) {
+	cases := []struct {
+		avgSec float64
+		want   string
+	}{
+		{0, "<5min"},
+		{299, "<5min"},
+		{300, "<30min"},
+		{1799, "<30min"},
+		{1800, ">30min"},
+		{86400, ">30min"},
+	}
+	for _, c := range cases {
+		if got := velocidadRespuesta(c.avgSec); got != c.want {
+			t.Errorf("velocidadRespuesta(%v) = %q, want %q", c.avgSec, got, c.want)
+		}
+	}
+}
+
+func TestBuildBehaviorText(t *testing.T) {
+	cases := []struct {
+		name    string
+		in      *models.BehaviorSignals
+		want    []string
+		wantNot []string
+	}{
+		{name: "nil", in: nil},
+		{name: "no samples", in: &models.BehaviorSignals{MsgIn: 3, MsgOut: 2}},
+		{
+			name:    "fast replies",
+			in:      &models.BehaviorSignals{AvgResponseLatencySec: 42, ResponseSamples: 4},
+			want:    []string{"42 segundos (4 muestras)", `velocidadRespuesta = "<5min"`, "DIMENSIÓN 2"},
+			wantNot: []string{"leer nuestros mensajes", "Mensajes del usuario"},
+		},
+		{
+			name: "slow replies with reads and counts",
+			in: &models.BehaviorSignals{
+				AvgResponseLatencySec: 3600, ResponseSamples: 2,
+				AvgReadLatencySec: 15, ReadSamples: 3,
+				MsgIn: 7, MsgOut: 5, StreakDays: 2,
+			},
+			want: []string{`velocidadRespuesta = ">30min"`, "leer nuestros mensajes: 15 segundos (3 muestras)", "7/5, racha de 2 día(s)"},
+		},
+		{
+			name:    "reads only",
+			in:      &models.BehaviorSignals{AvgReadLatencySec: 8, ReadSamples: 1},
+			want:    []string{"leer nuestros mensajes: 8 segundos"},
+			wantNot: []string{"velocidadRespuesta"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := buildBehaviorText(c.in)
+			if c.want == nil && got != "" {
+				t.Fatalf("buildBehaviorText = %q, want empty", got)
+			}
+			for _, w := range c.want {
+				if !strings.Contains(got, w) {
+					t.Errorf("missing %q in %q", w, got)
+				}
+			}
+			for _, w := range c.wantNot {
+				if strings.Contains(got, w) {
+					t.Errorf("unexpected %q in %q", w, got)
+				}
+			}
+		})
+	}
+}
+
+func TestScoringPromptIncludesBehavior(t *testing.T) {
+	s := &ScoringAgent{}
+	cases := []struct {
+		name     string
+		behavior *models.BehaviorSignals
+		want     bool
+	}{
+		{"with signals", &models.BehaviorSignals{AvgResponseLatencySec: 120, ResponseSamples: 3}, true},
+		{"without signals", nil, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			prompt, err := s.buildPrompt(&AgentInput{SessionID: "wa-519", Channel: "whatsapp", Message: "hola", Behavior: c.behavior})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Contains(prompt, "SEÑALES DE COMPORTAMIENTO MEDIDAS"); got != c.want {
+				t.Fatalf("behavior section present = %v, want %v", got, c.want)
+			}
+			if !strings.Contains(prompt, "SessionID: wa-519") {
+				t.Error("prompt missing session id")
+			}
+		})
+	}
+}
+
+func TestParseScoringExtractsJSON(t *testing.T) {
+	s := &ScoringAgent{}
+	const body = `{"dimension1_perfilDemografico":{"score":10,"reasoning":"Lima {centro}"},"dimension3_capacidadFinanciera":{"score":20},"totalScore":30}`
+	cases := []struct {
+		name  string
+		in    string
+		score int
+	}{
+		{"plain", body, 30},
+		{"fenced", "```json\n" + body + "\n```", 30},
+		{"prose after json", body + "\nNota: revisar {presupuesto} luego }", 30},
+		{"no json", "no pude calcular", 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := s.parseScoring("test", c.in)
+			if got.TotalScore != c.score {
+				t.Fatalf("TotalScore = %d, want %d (%+v)", got.TotalScore, c.score, got)
+			}
+			if c.score == 0 && got.Category != "discarded" {
+				t.Fatalf("fallback category = %q", got.Category)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"bob-hackathon/internal/llm"
+)
+
+func TestAgentsShareOneProvider(t *testing.T) {
+	p := llm.NewMockProvider(`{"intent":"general","confidence":0.9,"shouldRoute":false,"response":"hola"}`)
+
+	orchestrator, err := NewOrchestratorAgent(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	faq, err := NewFAQAgent(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auction, err := NewAuctionAgent(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scoring, err := NewScoringAgent(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, got := range map[string]llm.Provider{
+		"orchestrator": orchestrator.provider,
+		"faq":          faq.provider,
+		"auction":      auction.provider,
+		"scoring":      scoring.provider,
+	} {
+		if got != p {
+			t.Errorf("%s uses a different provider", name)
+		}
+	}
+
+	if _, err := orchestrator.Process(context.Background(), &AgentInput{Message: "hola", SessionID: "shared-1", Channel: "web"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scoring.Process(context.Background(), &AgentInput{Message: "hola", SessionID: "shared-1", Channel: "web"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(p.Calls()); n != 2 {
+		t.Fatalf("shared provider got %d calls, want 2", n)
+	}
+}
+
+func TestAgentConstructorsRejectNilProvider(t *testing.T) {
+	constructors := map[string]func() error{
+		"orchestrator": func() error { _, err := NewOrchestratorAgent(nil); return err },
+		"faq":          func() error { _, err := NewFAQAgent(nil); return err },
+		"auction":      func() error { _, err := NewAuctionAgent(nil); return err },
+		"scoring":      func() error { _, err := NewScoringAgent(nil); return err },
+	}
+	for name, build := range constructors {
+		if err := build(); !errors.Is(err, ErrNilProvider) {
+			t.Errorf("%s(nil) = %v, want ErrNilProvider", name, err)
+		}
+	}
+}
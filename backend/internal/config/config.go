@@ -3,6 +3,9 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -12,10 +15,99 @@ type Config struct {
 	GeminiModel     string
 	Port            string
 	BOBAPIBaseURL   string
+	BOBVehicleURL   string
+	BOBAPIRetries   int
+	BOBAPIBackoff   time.Duration
 	CORSOrigins     string
 	FrontendURL     string
 	DataDir         string
 	AdminAPIKey     string
+	AdminAPIKeys    []string // ADMIN_API_KEY separado por comas: varias keys válidas para rotar
+	AdminReadKeys   []string // ADMIN_READ_API_KEY: keys de solo lectura (analistas)
+
+	// CORS: CORSOrigins admite orígenes exactos y "https://*.dominio"; "*" solo sin credenciales
+	CORSAllowCredentials bool
+
+	// Confianza del orchestrator bajo la cual se sugiere derivar a un humano
+	HumanConfidenceThreshold float64
+
+	// Handoff a humano: webhook de eventos de leads y si el bot calla mientras está pendiente
+	LeadWebhookURL       string
+	SuppressBotOnHandoff bool
+
+	// Resumen de conversaciones largas: cada cuántos mensajes viejos se resume
+	// y cuántos mensajes recientes van siempre completos en los prompts
+	SummaryEvery      int
+	SummaryKeepRecent int
+
+	// Parámetros de generación de Gemini por agente (<AGENTE>_TEMPERATURE, _TOP_P, _TOP_K).
+	// Scoring va casi determinístico para que el JSON sea estable.
+	ChatGeneration         GenerationConfig
+	OrchestratorGeneration GenerationConfig
+	FAQGeneration          GenerationConfig
+	AuctionGeneration      GenerationConfig
+	ScoringGeneration      GenerationConfig
+
+	// Si el orchestrator falla, responder con GeminiService.ProcessMessage en vez de un 500
+	OrchestratorFallback bool
+
+	// Tipo de cambio para normalizar presupuestos en dólares a soles
+	USDToPEN float64
+
+	// Mensajes mínimos en la sesión para correr el ScoringAgent (salvo señal de alta intención)
+	ScoringMinMessages int
+
+	// Experimento A/B: la mitad de las sesiones usa el prompt "orchestrator_b"
+	PromptExperiment bool
+
+	// Re-scoring masivo: sesiones en paralelo y pausa mínima entre llamadas al ScoringAgent
+	RescoreConcurrency int
+	RescoreInterval    time.Duration
+
+	// Tracing OpenTelemetry: collector OTLP/HTTP (vacío = sin exportar)
+	OTLPEndpoint string
+
+	// Seguimientos automáticos por WhatsApp: API REST del engine (vacío = desactivados)
+	// y espera tras clasificar el lead como hot o warm. EngineAPIToken es el token compartido
+	// con el bot: también lo exige el backend en /api/chat/transcribe y /api/chat/extract, y en
+	// /api/chat/message solo hay seguimientos si el turno lo trae
+	EngineBaseURL     string
+	EngineAPIToken    string
+	FollowUpHotDelay  time.Duration
+	FollowUpWarmDelay time.Duration
+
+	// OCR de imágenes y PDFs adjuntos (placas, documentos): el texto va a los agentes.
+	// Adjuntos más pesados que OCRMaxBytes se procesan sin OCR.
+	OCREnabled  bool
+	OCRMaxBytes int
+
+	// Hosts desde los que el chat descarga media por url (exactos o "*.dominio");
+	// vacío = cualquier host público. Las IPs internas se rechazan siempre.
+	MediaAllowedHosts []string
+
+	// Proveedor de LLM de agentes y servicios: gemini (GEMINI_API_KEY/GEMINI_MODEL), openai
+	// (cualquier API compatible: OpenAI, Ollama, vLLM...) o mock (respuestas fijas, desarrollo)
+	LLMProvider string
+	LLMBaseURL  string
+	LLMAPIKey   string
+	LLMModel    string
+
+	// Cache de respuestas del FAQAgent para preguntas repetidas (TTL 0 = desactivado)
+	FAQCacheTTL  time.Duration
+	FAQCacheSize int
+
+	// Reglas rápidas (saludos, gracias, "precio del toyota") antes del orquestador LLM
+	IntentShortcuts bool
+
+	// Sin GEMINI_API_KEY (o sin LLM_MODEL con openai) el servidor arranca igual: health reporta "degraded" y el chat responde 503
+	DegradedMode bool
+}
+
+// GenerationConfig parámetros de muestreo de un modelo (llm.Options)
+type GenerationConfig struct {
+	Temperature float32
+	TopP        float32
+	TopK        int32
 }
 
 var AppConfig *Config
@@ -31,23 +123,105 @@ func LoadConfig() {
 		GeminiModel:   getEnv("GEMINI_MODEL", "gemini-2.0-flash-exp"),
 		Port:          getEnv("PORT", "3000"),
 		BOBAPIBaseURL: getEnv("BOB_API_BASE_URL", "https://apiv3.somosbob.com/v3"),
+		BOBVehicleURL: getEnv("BOB_VEHICLE_URL", "https://www.somosbob.com/subastas"),
+		BOBAPIRetries: getEnvInt("BOB_API_RETRIES", 2),
+		BOBAPIBackoff: getEnvDuration("BOB_API_RETRY_BACKOFF", 500*time.Millisecond),
 		CORSOrigins:   getEnv("CORS_ORIGINS", "http://localhost:5173,http://localhost:3000"),
 		FrontendURL:   getEnv("FRONTEND_URL", "http://localhost:5173"),
 		DataDir:       getEnv("DATA_DIR", "data"),
 		AdminAPIKey:   getEnv("ADMIN_API_KEY", ""),
+
+		CORSAllowCredentials: getEnvBool("CORS_ALLOW_CREDENTIALS", true),
+
+		HumanConfidenceThreshold: getEnvFloat("HUMAN_CONFIDENCE_THRESHOLD", 0.5),
+
+		LeadWebhookURL:       getEnv("LEAD_WEBHOOK_URL", ""),
+		SuppressBotOnHandoff: getEnvBool("SUPPRESS_BOT_ON_HANDOFF", false),
+
+		SummaryEvery:      getEnvInt("SUMMARY_EVERY", 10),
+		SummaryKeepRecent: getEnvInt("SUMMARY_KEEP_RECENT", 6),
+
+		ChatGeneration:         getEnvGeneration("GEMINI", GenerationConfig{Temperature: 0.7, TopP: 0.9, TopK: 40}),
+		OrchestratorGeneration: getEnvGeneration("ORCHESTRATOR", GenerationConfig{Temperature: 0.3, TopP: 0.9, TopK: 40}),
+		FAQGeneration:          getEnvGeneration("FAQ", GenerationConfig{Temperature: 0.4, TopP: 0.9, TopK: 40}),
+		AuctionGeneration:      getEnvGeneration("AUCTION", GenerationConfig{Temperature: 0.7, TopP: 0.9, TopK: 40}),
+		ScoringGeneration:      getEnvGeneration("SCORING", GenerationConfig{Temperature: 0.1, TopP: 0.8, TopK: 20}),
+
+		OrchestratorFallback: getEnvBool("ORCHESTRATOR_FALLBACK", false),
+
+		USDToPEN: getEnvFloat("USD_TO_PEN", 3.75),
+
+		ScoringMinMessages: getEnvInt("SCORING_MIN_MESSAGES", 6),
+
+		PromptExperiment: getEnvBool("PROMPT_EXPERIMENT", false),
+
+		RescoreConcurrency: getEnvInt("RESCORE_CONCURRENCY", 3),
+		RescoreInterval:    getEnvDuration("RESCORE_INTERVAL", 500*time.Millisecond),
+
+		OTLPEndpoint: getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+
+		EngineBaseURL:     getEnv("WHATSAPP_ENGINE_URL", ""),
+		EngineAPIToken:    getEnv("WHATSAPP_ENGINE_TOKEN", ""),
+		FollowUpHotDelay:  getEnvDuration("FOLLOWUP_HOT_DELAY", time.Hour),
+		FollowUpWarmDelay: getEnvDuration("FOLLOWUP_WARM_DELAY", 6*time.Hour),
+
+		OCREnabled:  getEnvBool("OCR_ENABLED", true),
+		OCRMaxBytes: getEnvInt("OCR_MAX_BYTES", 4<<20),
+
+		MediaAllowedHosts: splitKeys(getEnv("MEDIA_ALLOWED_HOSTS", "")),
+
+		LLMProvider: strings.ToLower(getEnv("LLM_PROVIDER", "gemini")),
+		LLMBaseURL:  getEnv("LLM_BASE_URL", "http://localhost:11434/v1"),
+		LLMAPIKey:   getEnv("LLM_API_KEY", ""),
+		LLMModel:    getEnv("LLM_MODEL", ""),
+
+		FAQCacheTTL:  getEnvDuration("FAQ_CACHE_TTL", time.Hour),
+		FAQCacheSize: getEnvInt("FAQ_CACHE_SIZE", 500),
+
+		IntentShortcuts: getEnvBool("INTENT_SHORTCUTS", true),
 	}
 
-	if AppConfig.GeminiAPIKey == "" {
-		log.Fatal("GEMINI_API_KEY es requerido")
+	switch {
+	case AppConfig.LLMProvider == "gemini" && AppConfig.GeminiAPIKey == "":
+		AppConfig.DegradedMode = true
+		log.Println("⚠️  GEMINI_API_KEY no configurado: modo degradado, el chat con IA no estará disponible")
+	case AppConfig.LLMProvider == "openai" && AppConfig.LLMModel == "":
+		AppConfig.DegradedMode = true
+		log.Println("⚠️  LLM_MODEL no configurado (LLM_PROVIDER=openai): modo degradado, el chat con IA no estará disponible")
 	}
 
-	if AppConfig.AdminAPIKey == "" {
-		log.Println("⚠️  WARNING: ADMIN_API_KEY not set - Admin endpoints will be UNPROTECTED!")
+	AppConfig.AdminAPIKeys = splitKeys(AppConfig.AdminAPIKey)
+	AppConfig.AdminReadKeys = splitKeys(getEnv("ADMIN_READ_API_KEY", ""))
+
+	if len(AppConfig.AdminAPIKeys) == 0 {
+		log.Printf("⚠️  WARNING: ADMIN_API_KEY not set - write-scope admin endpoints are disabled (%d read-only keys)", len(AppConfig.AdminReadKeys))
 	} else {
-		log.Println("✅ Admin API protection enabled")
+		log.Printf("✅ Admin API protection enabled (%d write keys, %d read-only keys)", len(AppConfig.AdminAPIKeys), len(AppConfig.AdminReadKeys))
 	}
 
-	log.Printf("Configuración cargada - Puerto: %s, Modelo: %s, DataDir: %s", AppConfig.Port, AppConfig.GeminiModel, AppConfig.DataDir)
+	log.Printf("Configuración cargada - Puerto: %s, LLM: %s, Modelo: %s, DataDir: %s", AppConfig.Port, AppConfig.LLMProvider, AppConfig.ModelName(), AppConfig.DataDir)
+}
+
+// ModelName modelo del proveedor de LLM configurado
+func (c *Config) ModelName() string {
+	switch c.LLMProvider {
+	case "gemini":
+		return c.GeminiModel
+	case "mock":
+		return "mock"
+	}
+	return c.LLMModel
+}
+
+// splitKeys lista separada por comas, sin espacios ni entradas vacías
+func splitKeys(raw string) []string {
+	var keys []string
+	for _, key := range strings.Split(raw, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
 }
 
 func getEnv(key, defaultValue string) string {
@@ -57,3 +231,64 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("⚠️  %s inválido (%q), usando %v", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("⚠️  %s inválido (%q), usando %v", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("⚠️  %s inválido (%q), usando %v", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvGeneration lee <PREFIX>_TEMPERATURE, <PREFIX>_TOP_P y <PREFIX>_TOP_K
+func getEnvGeneration(prefix string, defaults GenerationConfig) GenerationConfig {
+	return GenerationConfig{
+		Temperature: float32(getEnvFloat(prefix+"_TEMPERATURE", float64(defaults.Temperature))),
+		TopP:        float32(getEnvFloat(prefix+"_TOP_P", float64(defaults.TopP))),
+		TopK:        int32(getEnvInt(prefix+"_TOP_K", int(defaults.TopK))),
+	}
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("⚠️  %s inválido (%q), usando %v", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
@@ -0,0 +1,73 @@
+package config
+
+import "testing"
+
+func TestGetEnvGeneration(t *testing.T) {
+	defaults := GenerationConfig{Temperature: 0.7, TopP: 0.9, TopK: 40}
+	cases := []struct {
+		name             string
+		temp, topP, topK string
+		want             GenerationConfig
+	}{
+		{"defaults", "", "", "", defaults},
+		{"overrides", "0.1", "0.8", "20", GenerationConfig{Temperature: 0.1, TopP: 0.8, TopK: 20}},
+		{"zero temperature", "0", "", "", GenerationConfig{Temperature: 0, TopP: 0.9, TopK: 40}},
+		{"invalid falls back", "hot", "x", "many", defaults},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Setenv("SCORING_TEMPERATURE", c.temp)
+			t.Setenv("SCORING_TOP_P", c.topP)
+			t.Setenv("SCORING_TOP_K", c.topK)
+			if got := getEnvGeneration("SCORING", defaults); got != c.want {
+				t.Fatalf("getEnvGeneration = %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigDegradedMode(t *testing.T) {
+	cases := []struct {
+		name, provider, geminiKey, model string
+		degraded                         bool
+	}{
+		{"gemini without key", "gemini", "", "", true},
+		{"gemini with key", "gemini", "k", "", false},
+		{"openai without model", "openai", "", "", true},
+		{"openai with model", "OpenAI", "", "llama3", false},
+		{"mock", "mock", "", "", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Setenv("LLM_PROVIDER", c.provider)
+			t.Setenv("GEMINI_API_KEY", c.geminiKey)
+			t.Setenv("LLM_MODEL", c.model)
+			LoadConfig()
+			if AppConfig.DegradedMode != c.degraded {
+				t.Fatalf("DegradedMode = %v, want %v", AppConfig.DegradedMode, c.degraded)
+			}
+		})
+	}
+}
+
+func TestSplitKeys(t *testing.T) {
+	cases := []struct {
+		raw  string
+		want []string
+	}{
+		{"", nil},
+		{"solo", []string{"solo"}},
+		{" vieja , nueva ,,", []string{"vieja", "nueva"}},
+	}
+	for _, c := range cases {
+		got := splitKeys(c.raw)
+		if len(got) != len(c.want) {
+			t.Fatalf("splitKeys(%q) = %q, want %q", c.raw, got, c.want)
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Fatalf("splitKeys(%q) = %q, want %q", c.raw, got, c.want)
+			}
+		}
+	}
+}
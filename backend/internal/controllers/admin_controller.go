@@ -2,13 +2,16 @@ package controllers
 
 import (
 	"bob-hackathon/internal/config"
+	"bob-hackathon/internal/models"
 	"bob-hackathon/internal/services"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -24,8 +27,18 @@ func NewAdminController(faqService *services.FAQService) *AdminController {
 	}
 }
 
-// UploadFAQs maneja la subida de CSV de FAQs
+// UploadFAQs maneja la subida de CSV de FAQs. Valida columnas, filas vacías y duplicados
+// antes de tocar las FAQs vigentes; con ?dryRun=true solo devuelve el diff sin aplicar.
 func (a *AdminController) UploadFAQs(ctx *gin.Context) {
+	dryRun, err := strconv.ParseBool(ctx.DefaultQuery("dryRun", "false"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "dryRun debe ser true o false",
+		})
+		return
+	}
+
 	file, err := ctx.FormFile("file")
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{
@@ -55,47 +68,37 @@ func (a *AdminController) UploadFAQs(ctx *gin.Context) {
 	}
 	defer src.Close()
 
-	reader := csv.NewReader(src)
-	records, err := reader.ReadAll()
+	faqs, report, err := services.ParseFAQsCSV(src)
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"error":   "error al parsear CSV: " + err.Error(),
+			"error":   err.Error(),
 		})
 		return
 	}
-
-	// Validar formato (debe tener al menos header + 1 fila)
-	if len(records) < 2 {
+	if len(report.Errors) > 0 {
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"error":   "CSV debe tener al menos una fila de datos",
+			"error":   fmt.Sprintf("CSV con %d filas inválidas", len(report.Errors)),
+			"report":  report,
 		})
 		return
 	}
 
-	// Validar que tenga 4 columnas
-	if len(records[0]) != 4 {
-		ctx.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "CSV debe tener 4 columnas: categoria,empresa,pregunta,respuesta",
+	diff := services.DiffFAQs(a.faqService.GetAllFAQs(), faqs)
+	if dryRun {
+		ctx.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"dryRun":  true,
+			"applied": false,
+			"diff":    diff,
+			"report":  report,
 		})
 		return
 	}
 
-	// Guardar archivo en data/faqs.csv
-	dataDir := config.AppConfig.DataDir
-	destPath := filepath.Join(dataDir, "faqs.csv")
-
-	// Crear backup del archivo anterior
-	if _, err := os.Stat(destPath); err == nil {
-		backupPath := filepath.Join(dataDir, "faqs.csv.backup")
-		os.Rename(destPath, backupPath)
-		log.Printf("Backup creado: %s", backupPath)
-	}
-
-	// Guardar nuevo archivo
-	if err := ctx.SaveUploadedFile(file, destPath); err != nil {
+	if err := writeFAQsCSV(config.AppConfig.DataDir, faqs); err != nil {
+		log.Printf("Error guardando FAQs: %v", err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error":   "error al guardar archivo",
@@ -105,55 +108,119 @@ func (a *AdminController) UploadFAQs(ctx *gin.Context) {
 
 	// Recargar FAQs en memoria
 	services.ReloadFAQs()
+	log.Printf("FAQs actualizadas: +%d -%d ~%d", diff.Added, diff.Removed, diff.Changed)
 
 	ctx.JSON(http.StatusOK, gin.H{
 		"success":   true,
 		"message":   "FAQs actualizadas correctamente",
-		"total":     len(records) - 1,
+		"applied":   true,
+		"total":     len(faqs),
+		"diff":      diff,
+		"report":    report,
 		"timestamp": ctx.GetTime("timestamp"),
 	})
 }
 
-// GetPrompts devuelve los prompts de todos los agentes
+// writeFAQsCSV guarda las FAQs validadas en data/faqs.csv (con backup del anterior),
+// escribiendo primero a un temporal para no dejar el archivo a medias
+func writeFAQsCSV(dataDir string, faqs []models.FAQ) error {
+	destPath := filepath.Join(dataDir, "faqs.csv")
+	tmpPath := destPath + ".tmp"
+
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(tmp)
+	writer.Write([]string{"categoria", "empresa", "pregunta", "respuesta"})
+	for _, faq := range faqs {
+		writer.Write([]string{faq.Categoria, faq.Empresa, faq.Pregunta, faq.Respuesta})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// Crear backup del archivo anterior
+	if _, err := os.Stat(destPath); err == nil {
+		backupPath := filepath.Join(dataDir, "faqs.csv.backup")
+		os.Rename(destPath, backupPath)
+		log.Printf("Backup creado: %s", backupPath)
+	}
+
+	return os.Rename(tmpPath, destPath)
+}
+
+// GetPrompts devuelve los prompts vigentes de todos los agentes
 func (a *AdminController) GetPrompts(ctx *gin.Context) {
+	store := services.GetPromptStore()
 	prompts := make(map[string]string)
+	custom := make(map[string]bool)
 
-	agents := []string{"orchestrator", "faq", "auction", "scoring"}
-	dataDir := config.AppConfig.DataDir
-
-	for _, agent := range agents {
-		promptPath := filepath.Join(dataDir, "prompts", agent+".txt")
-		content, err := os.ReadFile(promptPath)
+	for _, agent := range store.Names() {
+		source, isCustom, err := store.Source(agent)
 		if err != nil {
-			// Si no existe, devolver mensaje indicativo
-			prompts[agent] = fmt.Sprintf("Prompt no configurado (usar default del sistema)")
+			log.Printf("Error leyendo prompt %s: %v", agent, err)
 			continue
 		}
-		prompts[agent] = string(content)
+		prompts[agent] = source
+		custom[agent] = isCustom
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"prompts": prompts,
+		"custom":  custom,
 	})
 }
 
-// UpdatePrompt actualiza el prompt de un agente específico
-func (a *AdminController) UpdatePrompt(ctx *gin.Context) {
+// GetPrompt devuelve el prompt vigente de un agente
+func (a *AdminController) GetPrompt(ctx *gin.Context) {
 	agentName := ctx.Param("agent")
+	store := services.GetPromptStore()
 
-	// Validar que sea un agente válido
-	validAgents := map[string]bool{
-		"orchestrator": true,
-		"faq":          true,
-		"auction":      true,
-		"scoring":      true,
+	if !store.Has(agentName) {
+		ctx.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "agente invalido. Debe ser: " + strings.Join(store.Names(), ", "),
+		})
+		return
+	}
+
+	source, isCustom, err := store.Source(agentName)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
 	}
 
-	if !validAgents[agentName] {
+	ctx.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"agent":    agentName,
+		"prompt":   source,
+		"custom":   isCustom,
+		"versions": store.Versions(agentName),
+	})
+}
+
+// UpdatePrompt actualiza el prompt de un agente específico.
+// Es un template (text/template) con campos como {{.Message}}; rige desde el próximo mensaje.
+// Responde 400 si no parsea o le faltan los placeholders requeridos del agente.
+func (a *AdminController) UpdatePrompt(ctx *gin.Context) {
+	agentName := ctx.Param("agent")
+	store := services.GetPromptStore()
+
+	// Validar que sea un agente válido
+	if !store.Has(agentName) {
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"error":   "agente invalido. Debe ser: orchestrator, faq, auction, scoring",
+			"error":   "agente invalido. Debe ser: " + strings.Join(store.Names(), ", "),
 		})
 		return
 	}
@@ -179,41 +246,88 @@ func (a *AdminController) UpdatePrompt(ctx *gin.Context) {
 		return
 	}
 
-	// Crear directorio si no existe
-	dataDir := config.AppConfig.DataDir
-	promptsDir := filepath.Join(dataDir, "prompts")
-	if err := os.MkdirAll(promptsDir, 0755); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
+	if err := store.Update(agentName, req.Prompt); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidPrompt) {
+			status = http.StatusBadRequest
+		}
+		ctx.JSON(status, gin.H{
 			"success": false,
-			"error":   "error al crear directorio de prompts",
+			"error":   err.Error(),
 		})
 		return
 	}
 
-	// Guardar prompt
-	promptPath := filepath.Join(promptsDir, agentName+".txt")
+	log.Printf("Prompt de %s actualizado", agentName)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": fmt.Sprintf("Prompt de %s actualizado correctamente", agentName),
+		"agent":   agentName,
+	})
+}
+
+// RollbackPrompt vuelve el prompt de un agente a su versión anterior
+func (a *AdminController) RollbackPrompt(ctx *gin.Context) {
+	agentName := ctx.Param("agent")
+	store := services.GetPromptStore()
 
-	// Crear backup si existe
-	if _, err := os.Stat(promptPath); err == nil {
-		backupPath := promptPath + ".backup"
-		os.Rename(promptPath, backupPath)
-		log.Printf("Backup de prompt creado: %s", backupPath)
+	if !store.Has(agentName) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "agente invalido. Debe ser: " + strings.Join(store.Names(), ", "),
+		})
+		return
 	}
 
-	if err := os.WriteFile(promptPath, []byte(req.Prompt), 0644); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
+	source, err := store.Rollback(agentName)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrNoPromptVersion):
+			status = http.StatusConflict
+		case errors.Is(err, services.ErrInvalidPrompt):
+			status = http.StatusUnprocessableEntity
+		}
+		ctx.JSON(status, gin.H{
 			"success": false,
-			"error":   "error al guardar prompt",
+			"error":   err.Error(),
 		})
 		return
 	}
 
-	log.Printf("Prompt de %s actualizado", agentName)
+	log.Printf("Prompt de %s revertido", agentName)
 
 	ctx.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": fmt.Sprintf("Prompt de %s actualizado correctamente", agentName),
-		"agent":   agentName,
+		"success":  true,
+		"message":  fmt.Sprintf("Prompt de %s revertido a la versión anterior", agentName),
+		"agent":    agentName,
+		"prompt":   source,
+		"versions": store.Versions(agentName),
+	})
+}
+
+// ResolveHandoff cierra el handoff de una sesión: el bot vuelve a responder
+func (a *AdminController) ResolveHandoff(ctx *gin.Context) {
+	sessionID := ctx.Param("sessionId")
+	sessionService := services.GetSessionService()
+
+	if sessionService.GetSession(sessionID) == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Sesión no encontrada",
+		})
+		return
+	}
+
+	sessionService.SetMetadata(sessionID, "handoff", "")
+	sessionService.SetMetadata(sessionID, "handoff_reason", "")
+	log.Printf("Handoff de %s resuelto", sessionID)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"sessionId": sessionID,
+		"message":   "Handoff resuelto, el bot vuelve a responder",
 	})
 }
 
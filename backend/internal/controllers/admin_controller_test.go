@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"bob-hackathon/internal/config"
+	"bob-hackathon/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uploadFAQs POST multipart con el CSV dado como "file"
+func uploadFAQs(t *testing.T, r http.Handler, query, filename, content string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(content))
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/faqs/upload"+query, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestUploadFAQs(t *testing.T) {
+	faqService := services.GetFAQService()
+	r := gin.New()
+	r.POST("/api/admin/faqs/upload", NewAdminController(faqService).UploadFAQs)
+	faqsPath := filepath.Join(config.AppConfig.DataDir, "faqs.csv")
+
+	const initial = "categoria,empresa,pregunta,respuesta\nPagos,BOB,¿Cuándo pago?,En 48h\nRegistro,BOB,¿Cómo me registro?,En la web\n"
+	if w := uploadFAQs(t, r, "", "faqs.csv", initial); w.Code != http.StatusOK {
+		t.Fatalf("initial upload = %d %s", w.Code, w.Body.String())
+	}
+
+	cases := []struct {
+		name, query, filename, csv string
+		status                     int
+	}{
+		{"not a csv", "", "faqs.xlsx", initial, http.StatusBadRequest},
+		{"bad dryRun flag", "?dryRun=tal-vez", "faqs.csv", initial, http.StatusBadRequest},
+		{"missing columns", "", "faqs.csv", "pregunta,respuesta\n¿Hola?,Hola\n", http.StatusBadRequest},
+		{"ragged csv", "", "faqs.csv", "categoria,empresa,pregunta,respuesta\nPagos,BOB\n", http.StatusBadRequest},
+		{"empty respuesta", "", "faqs.csv", "categoria,empresa,pregunta,respuesta\nPagos,BOB,¿Cuándo pago?,\n", http.StatusBadRequest},
+		{"dry run", "?dryRun=true", "faqs.csv", "categoria,empresa,pregunta,respuesta\nPagos,BOB,¿Cuándo pago?,En 72h\nGarantía,BOB,¿Tiene garantía?,No\n", http.StatusOK},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := uploadFAQs(t, r, c.query, c.filename, c.csv)
+			if w.Code != c.status {
+				t.Fatalf("status = %d %s, want %d", w.Code, w.Body.String(), c.status)
+			}
+			// nada de esto toca las FAQs vigentes
+			data, err := os.ReadFile(faqsPath)
+			if err != nil || string(data) != initial {
+				t.Fatalf("faqs.csv changed: %q %v", data, err)
+			}
+			if got := len(faqService.GetAllFAQs()); got != 2 {
+				t.Fatalf("live FAQs = %d", got)
+			}
+		})
+	}
+
+	t.Run("dry run diff", func(t *testing.T) {
+		w := uploadFAQs(t, r, "?dryRun=true", "faqs.csv", "categoria,empresa,pregunta,respuesta\nPagos,BOB,¿Cuándo pago?,En 72h\nGarantía,BOB,¿Tiene garantía?,No\n")
+		var resp struct {
+			Applied bool             `json:"applied"`
+			Diff    services.FAQDiff `json:"diff"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Applied || resp.Diff.Added != 1 || resp.Diff.Removed != 1 || resp.Diff.Changed != 1 || resp.Diff.Unchanged != 0 {
+			t.Fatalf("response = %s", w.Body.String())
+		}
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		w := uploadFAQs(t, r, "?dryRun=false", "FAQS.CSV", "categoria,empresa,pregunta,respuesta\nGarantía,BOB,¿Tiene garantía?,No\n")
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d %s", w.Code, w.Body.String())
+		}
+		faqs := faqService.GetAllFAQs()
+		if len(faqs) != 1 || faqs[0].Pregunta != "¿Tiene garantía?" {
+			t.Fatalf("live FAQs = %+v", faqs)
+		}
+		if backup, err := os.ReadFile(faqsPath + ".backup"); err != nil || string(backup) != initial {
+			t.Fatalf("backup = %q %v", backup, err)
+		}
+	})
+}
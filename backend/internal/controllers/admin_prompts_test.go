@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"bob-hackathon/internal/config"
+	"bob-hackathon/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newPromptsRouter rutas de prompts de admin (sin AdminAuth: se prueba aparte)
+func newPromptsRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	t.Cleanup(func() {
+		os.RemoveAll(filepath.Join(config.AppConfig.DataDir, "prompts"))
+	})
+	a := NewAdminController(nil)
+	r := gin.New()
+	r.GET("/api/admin/prompts", a.GetPrompts)
+	r.GET("/api/admin/prompts/:agent", a.GetPrompt)
+	r.PUT("/api/admin/prompts/:agent", a.UpdatePrompt)
+	r.POST("/api/admin/prompts/:agent/rollback", a.RollbackPrompt)
+	return r
+}
+
+func putPrompt(r http.Handler, agent, prompt string) (int, map[string]any) {
+	body, _ := json.Marshal(map[string]string{"prompt": prompt})
+	w := serve(r, http.MethodPut, "/api/admin/prompts/"+agent, string(body))
+	var resp map[string]any
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+func TestUpdatePromptDrivesNextPrompt(t *testing.T) {
+	r := newPromptsRouter(t)
+	render := func() string {
+		out, err := services.GetPromptStore().Render("faq", services.PromptData{Message: "¿cómo pago?", FAQs: "\nP: pago\nR: transferencia"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	if strings.HasPrefix(render(), "NUEVO") {
+		t.Fatal("prompt already edited")
+	}
+
+	code, resp := putPrompt(r, "faq", "NUEVO {{.Message}}{{.FAQs}}")
+	if code != http.StatusOK || resp["success"] != true {
+		t.Fatalf("PUT = %d %v", code, resp)
+	}
+	if got := render(); got != "NUEVO ¿cómo pago?\nP: pago\nR: transferencia" {
+		t.Fatalf("next prompt = %q", got)
+	}
+
+	w := serve(r, http.MethodGet, "/api/admin/prompts/faq", "")
+	var got struct {
+		Prompt string `json:"prompt"`
+		Custom bool   `json:"custom"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &got)
+	if w.Code != http.StatusOK || got.Prompt != "NUEVO {{.Message}}{{.FAQs}}" || !got.Custom {
+		t.Fatalf("GET = %d %+v", w.Code, got)
+	}
+}
+
+func TestGetPromptsListsAgents(t *testing.T) {
+	r := newPromptsRouter(t)
+	w := serve(r, http.MethodGet, "/api/admin/prompts", "")
+	var resp struct {
+		Prompts map[string]string `json:"prompts"`
+		Custom  map[string]bool   `json:"custom"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("GET = %d %v", w.Code, err)
+	}
+	for _, name := range []string{"orchestrator", "faq", "auction", "scoring", "system", "system_whatsapp"} {
+		if resp.Prompts[name] == "" || resp.Custom[name] {
+			t.Errorf("prompt %s = %q custom=%v", name, resp.Prompts[name], resp.Custom[name])
+		}
+	}
+}
+
+func TestUpdatePromptUnknownAgent(t *testing.T) {
+	r := newPromptsRouter(t)
+	if code, _ := putPrompt(r, "no_existe", "hola {{.Message}}"); code != http.StatusBadRequest {
+		t.Fatalf("PUT unknown agent = %d, want 400", code)
+	}
+	if w := serve(r, http.MethodGet, "/api/admin/prompts/no_existe", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("GET unknown agent = %d, want 404", w.Code)
+	}
+}
+
+func TestUpdatePromptValidation(t *testing.T) {
+	cases := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"missing required placeholder", `{"prompt":"Responde amable a {{.Message}}"}`, http.StatusBadRequest},
+		{"does not parse", `{"prompt":"{{.Message} {{.FAQs}}"}`, http.StatusBadRequest},
+		{"blank", `{"prompt":"   "}`, http.StatusBadRequest},
+		{"no body", ``, http.StatusBadRequest},
+		{"valid", `{"prompt":"{{.Message}}{{.FAQs}}"}`, http.StatusOK},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := newPromptsRouter(t)
+			w := serve(r, http.MethodPut, "/api/admin/prompts/faq", c.body)
+			if w.Code != c.status {
+				t.Fatalf("PUT = %d %s, want %d", w.Code, w.Body.String(), c.status)
+			}
+			_, custom, _ := services.GetPromptStore().Source("faq")
+			if custom != (c.status == http.StatusOK) {
+				t.Fatalf("custom = %v after status %d", custom, w.Code)
+			}
+		})
+	}
+}
+
+func TestRollbackPrompt(t *testing.T) {
+	r := newPromptsRouter(t)
+	for _, v := range []string{"v1 {{.Message}}", "v2 {{.Message}}"} {
+		if code, resp := putPrompt(r, "orchestrator", v); code != http.StatusOK {
+			t.Fatalf("PUT %q = %d %v", v, code, resp)
+		}
+	}
+	steps := []struct {
+		status int
+		prompt string
+	}{
+		{http.StatusOK, "v1 {{.Message}}"},
+		{http.StatusOK, ""}, // vuelve al default
+		{http.StatusConflict, ""},
+	}
+	for i, st := range steps {
+		w := serve(r, http.MethodPost, "/api/admin/prompts/orchestrator/rollback", "")
+		if w.Code != st.status {
+			t.Fatalf("rollback %d = %d %s, want %d", i, w.Code, w.Body.String(), st.status)
+		}
+		src, custom, _ := services.GetPromptStore().Source("orchestrator")
+		if st.prompt != "" && src != st.prompt {
+			t.Fatalf("rollback %d: prompt = %q, want %q", i, src, st.prompt)
+		}
+		if st.prompt == "" && custom {
+			t.Fatalf("rollback %d: still custom", i)
+		}
+	}
+	if w := serve(r, http.MethodPost, "/api/admin/prompts/no_existe/rollback", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("rollback unknown agent = %d", w.Code)
+	}
+}
@@ -2,12 +2,21 @@ package controllers
 
 import (
 	"bob-hackathon/internal/agents"
+	"bob-hackathon/internal/config"
+	"bob-hackathon/internal/metrics"
+	"bob-hackathon/internal/middleware"
 	"bob-hackathon/internal/models"
 	"bob-hackathon/internal/services"
+	"bob-hackathon/internal/tracing"
 	"bob-hackathon/internal/utils"
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -19,41 +28,263 @@ type ChatController struct {
 	auctionAgent   agents.Agent
 	scoringAgent   agents.Agent
 	sessionService *services.SessionService
+	leadWebhook    *services.LeadWebhookService
+	summaries      *services.SummaryService
+	followUps      *services.FollowUpService
+	transcriber    services.Transcriber   // notas de voz → texto
+	extractor      services.TextExtractor // OCR de imágenes/PDFs (nil = desactivado)
+	fallback       replyGenerator         // nil = sin fallback (ORCHESTRATOR_FALLBACK)
+
+	// Re-scoring masivo (uno a la vez)
+	rescoreMu sync.Mutex
+	rescore   *rescoreJob
+}
+
+// replyGenerator respuesta single-shot usada cuando falla el pipeline de agentes
+type replyGenerator interface {
+	ProcessMessage(sessionID, userMessage string) (string, error)
+}
+
+// Metadata de sesión para el handoff a humano
+const (
+	handoffKey       = "handoff"
+	handoffReasonKey = "handoff_reason"
+	handoffPending   = "pending"
+)
+
+// Metadata de sesión con el último presupuesto mencionado (soles)
+const budgetKey = "budget_pen"
+
+const handoffReply = "¡Claro! 🙌 Te paso con un asesor de BOB, te escribirá en breve por este mismo chat."
+
+// handoffPhrases frases (normalizadas, sin tildes) con las que el usuario pide a una persona
+var handoffPhrases = []string{
+	"hablar con un asesor",
+	"hablar con una asesora",
+	"hablar con asesor",
+	"hablar con una persona",
+	"hablar con alguien",
+	"hablar con un humano",
+	"hablar con un agente",
+	"hablar con un ejecutivo",
+	"hablar con un vendedor",
+	"quiero un asesor",
+	"necesito un asesor",
+	"pasame con un asesor",
+	"comunicarme con un asesor",
+	"comunicarme con alguien",
+	"agente humano",
+	"persona real",
+	"que me llame un asesor",
+	"que me llamen",
+}
+
+var accentReplacer = strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u")
+
+// detectHandoffRequest indica si el mensaje pide explícitamente hablar con un humano
+func detectHandoffRequest(message string) bool {
+	normalized := accentReplacer.Replace(strings.ToLower(message))
+	normalized = strings.Join(strings.Fields(normalized), " ")
+	for _, phrase := range handoffPhrases {
+		if strings.Contains(normalized, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldSuppressReply indica si el bot debe callar porque un asesor ya tiene la sesión
+func shouldSuppressReply(handoffStatus string, suppressOnHandoff bool) bool {
+	return suppressOnHandoff && handoffStatus == handoffPending
+}
+
+// startHandoff marca la sesión como derivada y emite el evento (solo la primera vez).
+// Devuelve true si el handoff es nuevo.
+func (c *ChatController) startHandoff(session *models.Session, reason, lastMessage string, leadScore int, category string) bool {
+	if c.sessionService.GetMetadata(session.SessionID, handoffKey) == handoffPending {
+		return false
+	}
+	c.sessionService.SetMetadata(session.SessionID, handoffKey, handoffPending)
+	c.sessionService.SetMetadata(session.SessionID, handoffReasonKey, reason)
+
+	if c.leadWebhook != nil {
+		summary, _ := c.sessionService.GetSummary(session.SessionID)
+		c.leadWebhook.Emit(models.LeadEvent{
+			Event:       "handoff",
+			SessionID:   session.SessionID,
+			Channel:     session.Channel,
+			Reason:      reason,
+			LeadScore:   leadScore,
+			Category:    category,
+			LastMessage: lastMessage,
+			Summary:     summary,
+		})
+	}
+	log.Printf("🙋 Handoff a humano: sesión %s (%s)", session.SessionID, reason)
+	return true
 }
 
+// updateBudget guarda el presupuesto si el mensaje menciona uno; devuelve el vigente
+// y si vino en este mensaje
+func (c *ChatController) updateBudget(sessionID, message string) (float64, bool) {
+	if amount, ok := utils.ParseBudget(message); ok {
+		c.sessionService.SetMetadata(sessionID, budgetKey, strconv.FormatFloat(amount, 'f', 2, 64))
+		log.Printf("💰 Presupuesto detectado en %s: S/ %.0f", sessionID, amount)
+		return amount, true
+	}
+	return c.sessionBudget(sessionID), false
+}
+
+// sessionBudget último presupuesto mencionado en la sesión (0 = nunca)
+func (c *ChatController) sessionBudget(sessionID string) float64 {
+	amount, err := strconv.ParseFloat(c.sessionService.GetMetadata(sessionID, budgetKey), 64)
+	if err != nil {
+		return 0
+	}
+	return amount
+}
+
+// conversationContext resume los turnos viejos si toca y devuelve resumen + mensajes recientes
+func (c *ChatController) conversationContext(session *models.Session) (string, []models.Message) {
+	if c.summaries == nil {
+		return session.Summary, c.sessionService.GetMessages(session.SessionID)
+	}
+	if _, err := c.summaries.MaybeSummarize(context.Background(), session.SessionID); err != nil {
+		log.Printf("⚠️ No se pudo resumir la sesión %s: %v", session.SessionID, err)
+	}
+	return c.summaries.Context(session.SessionID)
+}
+
+// Respuesta de los endpoints con IA en modo degradado
+const aiUnavailableMessage = "El asistente con IA no está disponible temporalmente. Intenta más tarde."
+
+// mediaOnlyMessage texto guardado cuando el usuario manda solo una imagen (o un audio sin voz)
+const mediaOnlyMessage = "[adjunto sin texto]"
+
+// maxChatRequestBytes tope del cuerpo de /api/chat/message: la media en base64 (4/3 de
+// MaxChatMediaBytes) más margen para el texto y los demás campos
+const maxChatRequestBytes = services.MaxChatMediaBytes*4/3 + 256<<10
+
 func NewChatController() *ChatController {
-	orchestrator, err := agents.NewOrchestratorAgent()
+	// Modo degradado: sin agentes; historial, sesiones y feedback siguen funcionando
+	degraded := &ChatController{
+		sessionService: services.GetSessionService(),
+		leadWebhook:    services.GetLeadWebhookService(),
+		followUps:      services.GetFollowUpService(),
+	}
+	if config.AppConfig.DegradedMode {
+		return degraded
+	}
+
+	// Un solo proveedor de LLM (LLM_PROVIDER) para todos los agentes
+	provider := services.GetGeminiService().Provider()
+
+	orchestrator, err := agents.NewOrchestratorAgent(provider)
 	if err != nil {
-		log.Fatalf("❌ Error creando OrchestratorAgent: %v", err)
+		log.Printf("❌ Error creando OrchestratorAgent: %v (modo degradado)", err)
+		return degraded
 	}
 
-	faqAgent, err := agents.NewFAQAgent()
+	faqAgent, err := agents.NewFAQAgent(provider)
 	if err != nil {
-		log.Fatalf("❌ Error creando FAQAgent: %v", err)
+		log.Printf("❌ Error creando FAQAgent: %v (modo degradado)", err)
+		return degraded
 	}
 
-	auctionAgent, err := agents.NewAuctionAgent()
+	auctionAgent, err := agents.NewAuctionAgent(provider)
 	if err != nil {
-		log.Fatalf("❌ Error creando AuctionAgent: %v", err)
+		log.Printf("❌ Error creando AuctionAgent: %v (modo degradado)", err)
+		return degraded
 	}
 
-	scoringAgent, err := agents.NewScoringAgent()
+	scoringAgent, err := agents.NewScoringAgent(provider)
 	if err != nil {
-		log.Fatalf("❌ Error creando ScoringAgent: %v", err)
+		log.Printf("❌ Error creando ScoringAgent: %v (modo degradado)", err)
+		return degraded
+	}
+
+	var fallback replyGenerator
+	if config.AppConfig.OrchestratorFallback {
+		fallback = services.GetGeminiService()
+	}
+
+	var extractor services.TextExtractor
+	if config.AppConfig.OCREnabled {
+		extractor = services.GetGeminiService()
+	}
+
+	// Saludos y palabras clave obvias se resuelven sin el LLM del orquestador
+	var router agents.Agent = orchestrator
+	if config.AppConfig.IntentShortcuts {
+		router = agents.NewIntentShortcut(orchestrator, agents.DefaultIntentRules())
 	}
 
 	return &ChatController{
-		orchestrator:   orchestrator,
+		orchestrator:   router,
 		faqAgent:       faqAgent,
 		auctionAgent:   auctionAgent,
 		scoringAgent:   scoringAgent,
 		sessionService: services.GetSessionService(),
+		leadWebhook:    services.GetLeadWebhookService(),
+		summaries:      services.GetSummaryService(),
+		followUps:      services.GetFollowUpService(),
+		transcriber:    services.GetGeminiService(),
+		extractor:      extractor,
+		fallback:       fallback,
+	}
+}
+
+// AIAvailable false si el controller arrancó en modo degradado
+func (c *ChatController) AIAvailable() bool {
+	return c.orchestrator != nil && c.scoringAgent != nil
+}
+
+// requireAI responde 503 si no hay IA; devuelve false en ese caso
+func (c *ChatController) requireAI(ctx *gin.Context) bool {
+	if c.AIAvailable() {
+		return true
+	}
+	ctx.JSON(http.StatusServiceUnavailable, gin.H{
+		"success": false,
+		"error":   aiUnavailableMessage,
+	})
+	return false
+}
+
+// followUpRecipient número al que puede escribir el seguimiento: solo en sesiones de WhatsApp
+// y si el turno lo mandó el bot (token del engine); si no, cualquiera podría hacer escribir
+// a cualquier número con un sessionId "wa-<teléfono>". "" = sin seguimiento
+func followUpRecipient(ctx *gin.Context, session *models.Session) string {
+	if session.Channel != "whatsapp" || !middleware.FromEngine(ctx) {
+		return ""
+	}
+	phone, ok := strings.CutPrefix(session.SessionID, "wa-")
+	if !ok {
+		return ""
 	}
+	return phone
 }
 
 func (c *ChatController) SendMessage(ctx *gin.Context) {
+	if !c.requireAI(ctx) {
+		return
+	}
+
+	// span del turno; los agentes corren sin la cancelación de la request pero dentro de la traza
+	spanCtx, span := tracing.Start(ctx.Request.Context(), "ChatController.SendMessage")
+	defer span.End()
+	aiCtx := context.WithoutCancel(spanCtx)
+
 	var req models.ChatRequest
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxChatRequestBytes)
 	if err := ctx.ShouldBindJSON(&req); err != nil {
+		if maxErr := (*http.MaxBytesError)(nil); errors.As(err, &maxErr) {
+			ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"success": false,
+				"error":   fmt.Sprintf("El mensaje supera %d bytes", maxErr.Limit),
+			})
+			return
+		}
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"error":   "Datos inválidos: " + err.Error(),
@@ -61,20 +292,25 @@ func (c *ChatController) SendMessage(ctx *gin.Context) {
 		return
 	}
 
+	// ID de correlación: header X-Request-ID (middleware) o, si no vino, el del body
+	requestID := middleware.GetRequestID(ctx)
+	if ctx.GetHeader(middleware.RequestIDHeader) == "" && middleware.ValidRequestID(req.RequestID) {
+		requestID = req.RequestID
+		middleware.SetRequestID(ctx, requestID)
+	}
+
 	// VALIDACIÓN Y SANITIZACIÓN DE INPUTS
-	// 1. Validar y sanitizar mensaje
-	sanitizedMessage, err := utils.ValidateAndSanitizeMessage(req.Message)
-	if err != nil {
+	// 1. Validar sessionID
+	if err := utils.ValidateSessionID(req.SessionID); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"error":   err.Error(),
 		})
 		return
 	}
-	req.Message = sanitizedMessage
 
-	// 2. Validar sessionID
-	if err := utils.ValidateSessionID(req.SessionID); err != nil {
+	// 2. Validar channel
+	if err := utils.ValidateChannel(req.Channel); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"error":   err.Error(),
@@ -82,8 +318,9 @@ func (c *ChatController) SendMessage(ctx *gin.Context) {
 		return
 	}
 
-	// 3. Validar channel
-	if err := utils.ValidateChannel(req.Channel); err != nil {
+	// 3. Validar tier (opcional)
+	tier, err := utils.ValidateTier(req.Tier)
+	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"error":   err.Error(),
@@ -91,23 +328,145 @@ func (c *ChatController) SendMessage(ctx *gin.Context) {
 		return
 	}
 
-	// Obtener o crear sesión
-	session := c.sessionService.GetOrCreateSession(req.SessionID, req.Channel)
+	// 4. Media adjunta (opcional): se descarga y valida antes de tocar la sesión.
+	// Una nota de voz se transcribe y el texto sigue el camino normal (agentes, scoring);
+	// de imágenes y PDFs se extrae el texto (OCR) como contexto extra para los agentes.
+	var media *services.ChatMediaData
+	var mediaRef *models.MediaRef
+	var mediaText string
+	if req.Media != nil {
+		media, err = services.LoadChatMedia(ctx.Request.Context(), req.Media)
+		if err != nil {
+			status := http.StatusBadGateway
+			var mediaErr *services.MediaError
+			if errors.As(err, &mediaErr) {
+				status = http.StatusBadRequest
+			}
+			ctx.JSON(status, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		mediaRef = media.Ref
+		if media.IsAudio() {
+			transcript, err := c.transcriber.Transcribe(aiCtx, media.MimeType, media.Data)
+			if err != nil {
+				utils.Logf(requestID, "❌ Error transcribiendo nota de voz: %v", err)
+				ctx.JSON(http.StatusBadGateway, gin.H{
+					"success": false,
+					"error":   "No se pudo transcribir la nota de voz",
+				})
+				return
+			}
+			utils.Logf(requestID, "🎙️ Nota de voz transcrita (%d bytes → %d caracteres)", len(media.Data), len(transcript))
+			req.Message = strings.TrimSpace(req.Message + "\n" + transcript)
+			mediaRef.Transcribed = true
+			media = nil // los agentes ven el texto, no el audio
+		} else {
+			mediaText = c.extractMediaText(aiCtx, requestID, media)
+			mediaRef.ExtractedText = mediaText
+			if media.IsDocument() {
+				media = nil // los agentes ven el texto, no el PDF
+			}
+		}
+	}
 
-	// Agregar mensaje del usuario
-	c.sessionService.AddMessage(session.SessionID, "user", req.Message)
+	// 5. Validar y sanitizar mensaje (media sin texto queda como mediaOnlyMessage)
+	if mediaRef != nil && strings.TrimSpace(req.Message) == "" {
+		req.Message = mediaOnlyMessage
+	}
+	sanitizedMessage, err := utils.ValidateAndSanitizeMessage(req.Message)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	req.Message = sanitizedMessage
+
+	// Obtener o crear sesión y agregar el mensaje del usuario (atómico)
+	session := c.sessionService.AddMessageToSession(req.SessionID, req.Channel, "user", req.Message, mediaRef)
+	metrics.ChatMessages.WithLabelValues(session.Channel).Inc()
+	// SEGUIMIENTO: el usuario respondió, el recordatorio pendiente ya no corresponde
+	c.followUps.QueueUserReplied(session.SessionID)
+	if req.Behavior != nil {
+		c.sessionService.UpdateBehavior(session.SessionID, req.Behavior)
+		session.Behavior = req.Behavior
+	}
+
+	// HANDOFF: con un asesor a cargo el bot puede quedar en silencio (config)
+	if shouldSuppressReply(c.sessionService.GetMetadata(session.SessionID, handoffKey), config.AppConfig.SuppressBotOnHandoff) {
+		utils.Logf(requestID, "🤐 Sesión %s en handoff, respuesta del bot suprimida", session.SessionID)
+		ctx.JSON(http.StatusOK, models.ChatResponse{
+			Success:    true,
+			SessionID:  session.SessionID,
+			LeadScore:  session.LeadScore,
+			Category:   session.Category,
+			Timestamp:  time.Now(),
+			Intent:     "handoff",
+			Confidence: 1,
+			Handoff:    true,
+			Suppressed: true,
+		})
+		return
+	}
+
+	// HANDOFF: el usuario pide hablar con una persona
+	if detectHandoffRequest(req.Message) {
+		c.startHandoff(session, "user_request", req.Message, session.LeadScore, session.Category)
+		c.sessionService.AddMessage(session.SessionID, "assistant", handoffReply)
+		ctx.JSON(http.StatusOK, models.ChatResponse{
+			Success:    true,
+			SessionID:  session.SessionID,
+			Reply:      handoffReply,
+			LeadScore:  session.LeadScore,
+			Category:   session.Category,
+			Timestamp:  time.Now(),
+			Intent:     "handoff",
+			Confidence: 1,
+			NeedsHuman: true,
+			Handoff:    true,
+		})
+		return
+	}
 
 	// FASE 1: ORCHESTRATOR - Analiza intención y rutea
+	summary, recent := c.conversationContext(session)
+	budget, budgetMentioned := c.updateBudget(session.SessionID, req.Message)
+	variant := ""
+	if config.AppConfig.PromptExperiment {
+		variant = c.sessionService.EnsurePromptVariant(session.SessionID)
+	}
 	agentInput := &agents.AgentInput{
 		Message:             req.Message,
 		SessionID:           session.SessionID,
 		Channel:             req.Channel,
-		ConversationHistory: session.Messages,
+		ConversationHistory: recent,
+		Behavior:            session.Behavior,
+		Summary:             summary,
+		BudgetPEN:           budget,
+		PromptVariant:       variant,
+		RequestID:           requestID,
+		Tier:                tier,
+		Media:               media,
+		MediaText:           mediaText,
 	}
 
-	orchestratorOutput, err := c.orchestrator.Process(context.Background(), agentInput)
+	orchestratorOutput, err := c.orchestrator.Process(aiCtx, agentInput)
+	if err != nil && c.fallback != nil {
+		utils.Logf(requestID, "❌ Error en Orchestrator: %v, usando fallback single-shot", err)
+		var reply string
+		if reply, err = c.fallback.ProcessMessage(session.SessionID, req.Message); err == nil {
+			orchestratorOutput = &agents.AgentOutput{
+				Response:       reply,
+				IntentDetected: "fallback",
+			}
+		}
+	}
 	if err != nil {
-		log.Printf("❌ Error en Orchestrator: %v", err)
+		utils.Logf(requestID, "❌ Error en Orchestrator: %v", err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error":   "Error procesando mensaje: " + err.Error(),
@@ -116,6 +475,11 @@ func (c *ChatController) SendMessage(ctx *gin.Context) {
 	}
 
 	var finalReply string
+	var vehicles []models.VehicleLink
+	needsHuman := needsHumanForConfidence(orchestratorOutput.Confidence, config.AppConfig.HumanConfidenceThreshold)
+	if needsHuman {
+		utils.Logf(requestID, "🙋 Confianza baja (%.2f) en intent %s, se sugiere humano", orchestratorOutput.Confidence, orchestratorOutput.IntentDetected)
+	}
 
 	// FASE 2: ROUTING - Según decisión del orchestrator
 	if orchestratorOutput.ShouldRoute {
@@ -123,21 +487,22 @@ func (c *ChatController) SendMessage(ctx *gin.Context) {
 
 		switch orchestratorOutput.RouteTo {
 		case "faq_agent":
-			log.Printf("🔀 Ruteando a FAQ Agent")
-			subAgentOutput, err = c.faqAgent.Process(context.Background(), agentInput)
+			utils.Logf(requestID, "🔀 Ruteando a FAQ Agent")
+			subAgentOutput, err = c.faqAgent.Process(aiCtx, agentInput)
 		case "auction_agent":
-			log.Printf("🔀 Ruteando a Auction Agent")
-			subAgentOutput, err = c.auctionAgent.Process(context.Background(), agentInput)
+			utils.Logf(requestID, "🔀 Ruteando a Auction Agent")
+			subAgentOutput, err = c.auctionAgent.Process(aiCtx, agentInput)
 		default:
-			log.Printf("⚠️ RouteTo desconocido: %s, usando respuesta del orchestrator", orchestratorOutput.RouteTo)
+			utils.Logf(requestID, "⚠️ RouteTo desconocido: %s, usando respuesta del orchestrator", orchestratorOutput.RouteTo)
 			finalReply = orchestratorOutput.Response
 		}
 
 		if err != nil {
-			log.Printf("❌ Error en SubAgent: %v", err)
+			utils.Logf(requestID, "❌ Error en SubAgent: %v", err)
 			finalReply = orchestratorOutput.Response // Fallback a respuesta del orchestrator
 		} else if subAgentOutput != nil {
 			finalReply = subAgentOutput.Response
+			vehicles = subAgentOutput.Vehicles
 		}
 	} else {
 		// El orchestrator maneja directamente (general, spam, ambiguo)
@@ -151,12 +516,14 @@ func (c *ChatController) SendMessage(ctx *gin.Context) {
 	var leadScore int
 	var category string
 
-	if len(session.Messages) >= 6 { // 3 pares user-assistant mínimo
-		log.Printf("📊 Calculando scoring con %d mensajes", len(session.Messages))
+	messageCount := len(c.sessionService.GetMessages(session.SessionID))
+	highIntent := orchestratorOutput.HighIntent || budgetMentioned
+	if shouldScore(messageCount, config.AppConfig.ScoringMinMessages, highIntent) {
+		utils.Logf(requestID, "📊 Calculando scoring con %d mensajes (alta intención: %v)", messageCount, highIntent)
 
-		scoringOutput, err := c.scoringAgent.Process(context.Background(), agentInput)
+		scoringOutput, err := c.scoringAgent.Process(aiCtx, agentInput)
 		if err != nil {
-			log.Printf("⚠️ Error en ScoringAgent: %v", err)
+			utils.Logf(requestID, "⚠️ Error en ScoringAgent: %v", err)
 			leadScore = 0
 			category = "cold"
 		} else if scoringOutput.ScoringData != nil {
@@ -165,38 +532,30 @@ func (c *ChatController) SendMessage(ctx *gin.Context) {
 			// Aplicar smoothing temporal para evitar saltos bruscos
 			existingLead := c.sessionService.GetLead(session.SessionID)
 			if existingLead != nil && existingLead.Score > 0 {
-				// Smoothing: 70% score previo + 30% score nuevo
 				prevScore := existingLead.Score
-				leadScore = int(float64(prevScore)*0.7 + float64(rawScore)*0.3)
-				log.Printf("📈 Smoothing aplicado: %d (prev) → %d (raw) → %d (final)", prevScore, rawScore, leadScore)
+				leadScore = smoothScore(prevScore, rawScore)
+				utils.Logf(requestID, "📈 Smoothing aplicado: %d (prev) → %d (raw) → %d (final)", prevScore, rawScore, leadScore)
 			} else {
 				leadScore = rawScore
 			}
 
 			// Recalcular categoría basada en score con smoothing
-			if leadScore >= 85 {
-				category = "hot"
-			} else if leadScore >= 65 {
-				category = "warm"
-			} else if leadScore >= 45 {
-				category = "cold"
-			} else {
-				category = "discarded"
-			}
+			category = categoryForScore(leadScore)
 
 			// Actualizar lead con scoring detallado
 			lead := &models.Lead{
-				SessionID:    session.SessionID,
-				Channel:      session.Channel,
-				Score:        leadScore,
-				Category:     category,
-				LastMessage:  req.Message,
-				CreatedAt:    session.CreatedAt,
-				UpdatedAt:    time.Now(),
+				SessionID:   session.SessionID,
+				Channel:     session.Channel,
+				Score:       leadScore,
+				Category:    category,
+				LastMessage: req.Message,
+				CreatedAt:   session.CreatedAt,
+				UpdatedAt:   time.Now(),
+				Scoring:     scoringOutput.ScoringData,
 			}
 			c.sessionService.CreateOrUpdateLead(lead)
 
-			log.Printf("✅ Score calculado: %d/100 - Categoría: %s", leadScore, category)
+			utils.Logf(requestID, "✅ Score calculado: %d/100 - Categoría: %s", leadScore, category)
 		}
 	} else {
 		// Score provisional para conversaciones cortas
@@ -210,6 +569,19 @@ func (c *ChatController) SendMessage(ctx *gin.Context) {
 	// Actualizar score en sesión
 	c.sessionService.UpdateScore(session.SessionID, leadScore, category)
 
+	// HANDOFF: lead caliente → avisar a un asesor
+	if category == "hot" {
+		c.startHandoff(session, "hot_lead", req.Message, leadScore, category)
+	}
+	handoff := c.sessionService.GetMetadata(session.SessionID, handoffKey) == handoffPending
+
+	// SEGUIMIENTO: recordatorio por WhatsApp según categoría (no si el bot calla por el handoff)
+	followUpCategory := category
+	if handoff && config.AppConfig.SuppressBotOnHandoff {
+		followUpCategory = ""
+	}
+	c.followUps.QueueClassified(session.SessionID, followUpRecipient(ctx, session), followUpCategory)
+
 	// Responder
 	response := models.ChatResponse{
 		Success:   true,
@@ -218,12 +590,87 @@ func (c *ChatController) SendMessage(ctx *gin.Context) {
 		LeadScore: leadScore,
 		Category:  category,
 		Timestamp: time.Now(),
+
+		Intent:     orchestratorOutput.IntentDetected,
+		Confidence: orchestratorOutput.Confidence,
+		NeedsHuman: needsHuman,
+		Handoff:    handoff,
+
+		Vehicles: vehicles,
+
+		RequestID: requestID,
 	}
 
 	ctx.JSON(http.StatusOK, response)
 }
 
+// shouldScore decide si correr el ScoringAgent: al llegar a minMessages mensajes
+// o antes si hay señales de alta intención
+func shouldScore(messageCount, minMessages int, highIntent bool) bool {
+	return highIntent || messageCount >= minMessages
+}
+
+// needsHumanForConfidence indica si la confianza del orchestrator es tan baja
+// que conviene derivar a un humano (threshold<=0 desactiva)
+func needsHumanForConfidence(confidence, threshold float64) bool {
+	return threshold > 0 && confidence < threshold
+}
+
+// smoothScore suaviza saltos bruscos: 70% score previo + 30% score nuevo
+func smoothScore(prevScore, rawScore int) int {
+	return int(float64(prevScore)*0.7 + float64(rawScore)*0.3)
+}
+
+// categoryForScore categoría del lead según su score final
+func categoryForScore(score int) string {
+	switch {
+	case score >= 85:
+		return "hot"
+	case score >= 65:
+		return "warm"
+	case score >= 45:
+		return "cold"
+	default:
+		return "discarded"
+	}
+}
+
+// scoringInput input del ScoringAgent para recalcular una sesión completa
+func (c *ChatController) scoringInput(requestID string, session *models.Session) *agents.AgentInput {
+	summary, recent := c.conversationContext(session)
+	return &agents.AgentInput{
+		Message:             "Calcular scoring completo",
+		SessionID:           session.SessionID,
+		Channel:             session.Channel,
+		ConversationHistory: recent,
+		Behavior:            session.Behavior,
+		Summary:             summary,
+		BudgetPEN:           c.sessionBudget(session.SessionID),
+		RequestID:           requestID,
+	}
+}
+
+// scoringReasons resume el scoring detallado en una lista legible
+func scoringReasons(data *models.ScoringData) []string {
+	reasons := []string{
+		data.AccionRecomendada,
+		"Tiempo contacto: " + data.TiempoContacto,
+		"Seguimiento: " + data.TipoSeguimiento,
+	}
+	for _, boost := range data.Boosts {
+		reasons = append(reasons, "✅ "+boost)
+	}
+	for _, penalty := range data.Penalizaciones {
+		reasons = append(reasons, "⚠️ "+penalty)
+	}
+	return reasons
+}
+
 func (c *ChatController) GetScore(ctx *gin.Context) {
+	if !c.requireAI(ctx) {
+		return
+	}
+
 	var req models.ScoreRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{
@@ -243,7 +690,7 @@ func (c *ChatController) GetScore(ctx *gin.Context) {
 	}
 
 	// Obtener sesión
-	session := c.sessionService.GetSession(req.SessionID)
+	session := c.sessionService.GetSnapshot(req.SessionID)
 	if session == nil {
 		ctx.JSON(http.StatusNotFound, gin.H{
 			"success": false,
@@ -253,14 +700,7 @@ func (c *ChatController) GetScore(ctx *gin.Context) {
 	}
 
 	// Usar ScoringAgent para calcular score detallado
-	agentInput := &agents.AgentInput{
-		Message:             "Calcular scoring completo",
-		SessionID:           session.SessionID,
-		Channel:             session.Channel,
-		ConversationHistory: session.Messages,
-	}
-
-	scoringOutput, err := c.scoringAgent.Process(context.Background(), agentInput)
+	scoringOutput, err := c.scoringAgent.Process(context.WithoutCancel(ctx.Request.Context()), c.scoringInput(middleware.GetRequestID(ctx), session))
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -282,27 +722,358 @@ func (c *ChatController) GetScore(ctx *gin.Context) {
 		Success: true,
 		Score:   scoringOutput.ScoringData.TotalScore,
 		Category: scoringOutput.ScoringData.Category,
-		Reasons: []string{
-			scoringOutput.ScoringData.AccionRecomendada,
-			"Tiempo contacto: " + scoringOutput.ScoringData.TiempoContacto,
-			"Seguimiento: " + scoringOutput.ScoringData.TipoSeguimiento,
-		},
+		Reasons:  scoringReasons(scoringOutput.ScoringData),
 	}
 
-	// Agregar boosts y penalizaciones a reasons
-	if len(scoringOutput.ScoringData.Boosts) > 0 {
-		for _, boost := range scoringOutput.ScoringData.Boosts {
-			scoreResponse.Reasons = append(scoreResponse.Reasons, "✅ "+boost)
+	ctx.JSON(http.StatusOK, scoreResponse)
+}
+
+// RescoreLead recalcula el score de una sesión con el ScoringAgent (y prompts) actual,
+// actualiza el lead con el desglose y lo devuelve. Con ?smooth=false el score nuevo
+// reemplaza al anterior en vez de promediarse.
+func (c *ChatController) RescoreLead(ctx *gin.Context) {
+	if !c.requireAI(ctx) {
+		return
+	}
+
+	sessionID := ctx.Param("sessionId")
+	if err := utils.ValidateSessionID(sessionID); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	smooth, err := strconv.ParseBool(ctx.DefaultQuery("smooth", "true"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "smooth debe ser true o false",
+		})
+		return
+	}
+
+	session := c.sessionService.GetSnapshot(sessionID)
+	if session == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Sesión no encontrada",
+		})
+		return
+	}
+
+	requestID := middleware.GetRequestID(ctx)
+	result, err := c.rescoreSession(context.Background(), requestID, session, smooth)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al calcular score: " + err.Error(),
+		})
+		return
+	}
+	lead, previousScore, data := result.Lead, result.PreviousScore, result.Lead.Scoring
+	utils.Logf(requestID, "🔁 Re-scoring de %s: %d → %d (raw %d, smoothing: %v)", sessionID, previousScore, lead.Score, data.TotalScore, smooth)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success":       true,
+		"lead":          lead,
+		"previousScore": previousScore,
+		"rawScore":      data.TotalScore,
+		"smoothed":      smooth && previousScore > 0,
+		"scoring":       data,
+	})
+}
+
+// rescoreResult lead actualizado por un re-scoring y el score que tenía antes
+type rescoreResult struct {
+	Lead          *models.Lead
+	PreviousScore int
+}
+
+// rescoreSession corre el ScoringAgent sobre la sesión y reemplaza su lead conservando
+// los datos que el scoring no recalcula. smooth=false hace el resultado idempotente.
+func (c *ChatController) rescoreSession(ctx context.Context, requestID string, session *models.Session, smooth bool) (*rescoreResult, error) {
+	scoringOutput, err := c.scoringAgent.Process(ctx, c.scoringInput(requestID, session))
+	if err != nil {
+		return nil, err
+	}
+	data := scoringOutput.ScoringData
+	if data == nil {
+		return nil, errors.New("no se pudo generar scoring")
+	}
+
+	lead := &models.Lead{
+		SessionID: session.SessionID,
+		Channel:   session.Channel,
+		Score:     data.TotalScore,
+		Reasons:   scoringReasons(data),
+		Scoring:   data,
+		CreatedAt: session.CreatedAt,
+	}
+	previousScore := 0
+	if prev := c.sessionService.GetLead(session.SessionID); prev != nil {
+		previousScore = prev.Score
+		lead.CreatedAt = prev.CreatedAt
+		lead.Urgency = prev.Urgency
+		lead.Budget = prev.Budget
+		lead.BusinessType = prev.BusinessType
+		lead.LastMessage = prev.LastMessage
+		lead.Metadata = prev.Metadata
+		if smooth && prev.Score > 0 {
+			lead.Score = smoothScore(prev.Score, data.TotalScore)
 		}
 	}
+	if lead.LastMessage == "" {
+		for i := len(session.Messages) - 1; i >= 0; i-- {
+			if session.Messages[i].Role == "user" {
+				lead.LastMessage = session.Messages[i].Content
+				break
+			}
+		}
+	}
+	lead.Category = categoryForScore(lead.Score)
+
+	c.sessionService.CreateOrUpdateLead(lead)
+	c.sessionService.UpdateScore(session.SessionID, lead.Score, lead.Category)
+	return &rescoreResult{Lead: lead, PreviousScore: previousScore}, nil
+}
+
+// extractMediaText OCR del adjunto; si falla o el archivo supera OCR_MAX_BYTES el mensaje
+// sigue sin texto extraído (la imagen igual llega a los agentes)
+func (c *ChatController) extractMediaText(ctx context.Context, requestID string, media *services.ChatMediaData) string {
+	if c.extractor == nil {
+		return ""
+	}
+	if len(media.Data) > config.AppConfig.OCRMaxBytes {
+		utils.Logf(requestID, "⚠️ Adjunto de %d bytes supera OCR_MAX_BYTES, sin OCR", len(media.Data))
+		return ""
+	}
+	text, err := c.extractor.ExtractText(ctx, media.MimeType, media.Data)
+	if err != nil {
+		utils.Logf(requestID, "⚠️ Error extrayendo texto del adjunto: %v", err)
+		return ""
+	}
+	if text != "" {
+		utils.Logf(requestID, "🔎 Texto extraído del adjunto (%s, %d caracteres)", media.MimeType, len(text))
+	}
+	return text
+}
+
+// Transcribe devuelve el texto de una nota de voz (mismo Transcriber que /api/chat/message)
+func (c *ChatController) Transcribe(ctx *gin.Context) {
+	if !c.requireAI(ctx) {
+		return
+	}
 
-	if len(scoringOutput.ScoringData.Penalizaciones) > 0 {
-		for _, penalty := range scoringOutput.ScoringData.Penalizaciones {
-			scoreResponse.Reasons = append(scoreResponse.Reasons, "⚠️ "+penalty)
+	var req models.TranscribeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Datos inválidos: " + err.Error(),
+		})
+		return
+	}
+
+	media, err := services.LoadChatMedia(ctx.Request.Context(), &req.Media)
+	if err == nil && !media.IsAudio() {
+		err = &services.MediaError{Message: "media: se esperaba una nota de voz"}
+	}
+	if err != nil {
+		status := http.StatusBadGateway
+		var mediaErr *services.MediaError
+		if errors.As(err, &mediaErr) {
+			status = http.StatusBadRequest
 		}
+		ctx.JSON(status, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
 	}
 
-	ctx.JSON(http.StatusOK, scoreResponse)
+	text, err := c.transcriber.Transcribe(ctx.Request.Context(), media.MimeType, media.Data)
+	if err != nil {
+		log.Printf("❌ Error transcribiendo nota de voz: %v", err)
+		ctx.JSON(http.StatusBadGateway, gin.H{
+			"success": false,
+			"error":   "No se pudo transcribir la nota de voz",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"text":    text,
+	})
+}
+
+// ExtractText devuelve el texto (OCR) de una imagen o PDF (mismo TextExtractor que /api/chat/message)
+func (c *ChatController) ExtractText(ctx *gin.Context) {
+	if !c.requireAI(ctx) {
+		return
+	}
+	if c.extractor == nil {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{
+			"success": false,
+			"error":   "OCR desactivado (OCR_ENABLED=false)",
+		})
+		return
+	}
+
+	var req models.ExtractRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Datos inválidos: " + err.Error(),
+		})
+		return
+	}
+
+	media, err := services.LoadChatMedia(ctx.Request.Context(), &req.Media)
+	if err == nil && media.IsAudio() {
+		err = &services.MediaError{Message: "media: se esperaba una imagen o un PDF"}
+	}
+	if err == nil && len(media.Data) > config.AppConfig.OCRMaxBytes {
+		err = &services.MediaError{Message: fmt.Sprintf("media: el archivo supera OCR_MAX_BYTES (%d)", config.AppConfig.OCRMaxBytes)}
+	}
+	if err != nil {
+		status := http.StatusBadGateway
+		var mediaErr *services.MediaError
+		if errors.As(err, &mediaErr) {
+			status = http.StatusBadRequest
+		}
+		ctx.JSON(status, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	text, err := c.extractor.ExtractText(ctx.Request.Context(), media.MimeType, media.Data)
+	if err != nil {
+		log.Printf("❌ Error extrayendo texto del adjunto: %v", err)
+		ctx.JSON(http.StatusBadGateway, gin.H{
+			"success": false,
+			"error":   "No se pudo leer el texto del adjunto",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"text":    text,
+	})
+}
+
+// SubmitFeedback guarda un voto (up/down) sobre una respuesta del asistente
+func (c *ChatController) SubmitFeedback(ctx *gin.Context) {
+	var req models.FeedbackRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Datos inválidos: " + err.Error(),
+		})
+		return
+	}
+
+	if err := utils.ValidateSessionID(req.SessionID); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	rating, err := utils.ValidateRating(req.Rating)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	comment, err := utils.SanitizeComment(req.Comment)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	session := c.sessionService.GetSession(req.SessionID)
+	if session == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Sesión no encontrada",
+		})
+		return
+	}
+
+	// Solo se vota sobre respuestas del asistente
+	messages := c.sessionService.GetMessages(session.SessionID)
+	index := *req.MessageIndex
+	if err := utils.ValidateMessageIndex(index, len(messages)); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	if messages[index].Role != "assistant" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "messageIndex debe apuntar a una respuesta del asistente",
+		})
+		return
+	}
+
+	feedback := &models.Feedback{
+		SessionID:    session.SessionID,
+		Channel:      session.Channel,
+		MessageIndex: index,
+		Rating:       rating,
+		Comment:      comment,
+		Reply:        messages[index].Content,
+		CreatedAt:    time.Now(),
+	}
+	c.sessionService.AddFeedback(feedback)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"feedback": feedback,
+	})
+}
+
+// GetFeedback devuelve los votos de una sesión
+func (c *ChatController) GetFeedback(ctx *gin.Context) {
+	sessionID := ctx.Param("sessionId")
+
+	if err := utils.ValidateSessionID(sessionID); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	feedback := c.sessionService.GetFeedback(sessionID)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"count":    len(feedback),
+		"feedback": feedback,
+	})
+}
+
+// GetFeedbackStats devuelve el agregado de votos (total, up/down, por canal)
+func (c *ChatController) GetFeedbackStats(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"stats":   c.sessionService.GetFeedbackStats(),
+	})
 }
 
 func (c *ChatController) GetHistory(ctx *gin.Context) {
@@ -317,7 +1088,7 @@ func (c *ChatController) GetHistory(ctx *gin.Context) {
 		return
 	}
 
-	session := c.sessionService.GetSession(sessionID)
+	session := c.sessionService.GetSnapshot(sessionID)
 	if session == nil {
 		ctx.JSON(http.StatusNotFound, gin.H{
 			"success": false,
@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"bob-hackathon/internal/agents"
+	"bob-hackathon/internal/config"
+	"bob-hackathon/internal/models"
+)
+
+func TestNeedsHumanForConfidence(t *testing.T) {
+	cases := []struct {
+		confidence, threshold float64
+		want                  bool
+	}{
+		{0.3, 0.5, true},
+		{0.5, 0.5, false},
+		{0.9, 0.5, false},
+		{0, 0, false}, // threshold 0 desactiva
+		{0.1, -1, false},
+	}
+	for _, c := range cases {
+		if got := needsHumanForConfidence(c.confidence, c.threshold); got != c.want {
+			t.Errorf("needsHumanForConfidence(%v, %v) = %v, want %v", c.confidence, c.threshold, got, c.want)
+		}
+	}
+}
+
+func TestSendMessageIntentAndConfidence(t *testing.T) {
+	prev := config.AppConfig.HumanConfidenceThreshold
+	config.AppConfig.HumanConfidenceThreshold = 0.5
+	defer func() { config.AppConfig.HumanConfidenceThreshold = prev }()
+
+	cases := []struct {
+		name       string
+		intent     string
+		confidence float64
+		needsHuman bool
+	}{
+		{"low confidence", "ambiguo", 0.2, true},
+		{"at threshold", "general", 0.5, false},
+		{"high confidence", "general", 0.95, false},
+	}
+	for i, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			orchestrator := &stubAgent{out: agents.AgentOutput{
+				Response:       "¿Me cuentas un poco más?",
+				IntentDetected: c.intent,
+				Confidence:     c.confidence,
+			}}
+			r := newChatRouter(newStubChatController(orchestrator, &stubAgent{}, &stubAgent{}, &stubAgent{}))
+			body := fmt.Sprintf(`{"sessionId":"intent-%d","message":"mmm","channel":"web"}`, i)
+			w := serve(r, http.MethodPost, "/api/chat/message", body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("POST = %d %s", w.Code, w.Body.String())
+			}
+			var resp models.ChatResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Intent != c.intent || resp.Confidence != c.confidence || resp.NeedsHuman != c.needsHuman {
+				t.Fatalf("response = intent %q confidence %v needsHuman %v, want %q %v %v",
+					resp.Intent, resp.Confidence, resp.NeedsHuman, c.intent, c.confidence, c.needsHuman)
+			}
+			if resp.Reply != "¿Me cuentas un poco más?" {
+				t.Fatalf("reply = %q", resp.Reply)
+			}
+		})
+	}
+}
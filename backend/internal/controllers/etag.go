@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondWithETag responde el payload como JSON con un ETag (hash del contenido) y
+// 304 Not Modified si el cliente ya tiene esa versión (If-None-Match). Con
+// Cache-Control: no-cache el navegador guarda la respuesta pero siempre revalida.
+// lastModified (opcional) va como Last-Modified, ej: la hora del cache de vehículos.
+func respondWithETag(ctx *gin.Context, payload any, lastModified time.Time) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error serializando respuesta: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "error al generar respuesta",
+		})
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	ctx.Header("ETag", etag)
+	ctx.Header("Cache-Control", "no-cache")
+	if !lastModified.IsZero() {
+		ctx.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if etagMatches(ctx.GetHeader("If-None-Match"), etag) {
+		ctx.Status(http.StatusNotModified)
+		return
+	}
+	ctx.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+// etagMatches evalúa If-None-Match: lista separada por comas, "*" o tags débiles (W/)
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
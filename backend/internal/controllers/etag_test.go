@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestETagMatches(t *testing.T) {
+	const etag = `"abc123"`
+	cases := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{`"abc123"`, true},
+		{`W/"abc123"`, true},
+		{`"otro", "abc123"`, true},
+		{"*", true},
+		{`"abc"`, false},
+		{`abc123`, false},
+	}
+	for _, c := range cases {
+		if got := etagMatches(c.header, etag); got != c.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", c.header, got, c.want)
+		}
+	}
+}
+
+// getWithETag GET path con If-None-Match opcional
+func getWithETag(r http.Handler, path, ifNoneMatch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestConditionalGet(t *testing.T) {
+	loadTestFAQs(t, "categoria,empresa,pregunta,respuesta\nPagos,BOB,¿Cuándo pago?,En 48h\n")
+	l := NewLeadController()
+	r := gin.New()
+	r.GET("/api/faqs", l.GetFAQs)
+	r.GET("/api/vehicles", l.GetVehicles)
+
+	for _, path := range []string{"/api/faqs", "/api/vehicles", "/api/faqs?categoria=pagos"} {
+		t.Run(path, func(t *testing.T) {
+			first := getWithETag(r, path, "")
+			etag := first.Header().Get("ETag")
+			if first.Code != http.StatusOK || etag == "" || first.Body.Len() == 0 {
+				t.Fatalf("first GET = %d etag %q", first.Code, etag)
+			}
+			if first.Header().Get("Cache-Control") != "no-cache" {
+				t.Fatalf("Cache-Control = %q", first.Header().Get("Cache-Control"))
+			}
+
+			cached := getWithETag(r, path, etag)
+			if cached.Code != http.StatusNotModified || cached.Body.Len() != 0 || cached.Header().Get("ETag") != etag {
+				t.Fatalf("conditional GET = %d body %q etag %q", cached.Code, cached.Body.String(), cached.Header().Get("ETag"))
+			}
+
+			if stale := getWithETag(r, path, `"viejo"`); stale.Code != http.StatusOK || stale.Body.String() != first.Body.String() {
+				t.Fatalf("stale ETag = %d", stale.Code)
+			}
+		})
+	}
+
+	// el inventario expone la hora del cache como Last-Modified
+	if lm := getWithETag(r, "/api/vehicles", "").Header().Get("Last-Modified"); lm == "" {
+		t.Fatal("vehicles without Last-Modified")
+	} else if _, err := time.Parse(http.TimeFormat, lm); err != nil {
+		t.Fatalf("Last-Modified = %q", lm)
+	}
+
+	// otro contenido, otro ETag: el cliente recibe el set nuevo
+	before := getWithETag(r, "/api/faqs", "").Header().Get("ETag")
+	loadTestFAQs(t, "categoria,empresa,pregunta,respuesta\nPagos,BOB,¿Cuándo pago?,En 24h\n")
+	after := getWithETag(r, "/api/faqs", before)
+	if after.Code != http.StatusOK || after.Header().Get("ETag") == before {
+		t.Fatalf("after FAQ change = %d etag %q", after.Code, after.Header().Get("ETag"))
+	}
+}
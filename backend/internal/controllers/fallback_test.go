@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"bob-hackathon/internal/models"
+)
+
+// stubReply replyGenerator de prueba
+type stubReply struct {
+	reply string
+	err   error
+	calls int
+}
+
+func (s *stubReply) ProcessMessage(sessionID, userMessage string) (string, error) {
+	s.calls++
+	return s.reply, s.err
+}
+
+func TestSendMessageOrchestratorFallback(t *testing.T) {
+	cases := []struct {
+		name     string
+		fallback *stubReply
+		status   int
+		reply    string
+	}{
+		{"fallback disabled", nil, http.StatusInternalServerError, ""},
+		{"fallback answers", &stubReply{reply: "Respuesta directa"}, http.StatusOK, "Respuesta directa"},
+		{"fallback also fails", &stubReply{err: errors.New("gemini caído")}, http.StatusInternalServerError, ""},
+	}
+	for i, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctrl := newStubChatController(&stubAgent{err: errors.New("orchestrator caído")}, &stubAgent{}, &stubAgent{}, &stubAgent{})
+			if c.fallback != nil {
+				ctrl.fallback = c.fallback
+			}
+			r := newChatRouter(ctrl)
+			body := fmt.Sprintf(`{"sessionId":"fallback-%d","message":"hola","channel":"web"}`, i)
+			w := serve(r, http.MethodPost, "/api/chat/message", body)
+			if w.Code != c.status {
+				t.Fatalf("POST = %d %s, want %d", w.Code, w.Body.String(), c.status)
+			}
+			if c.status != http.StatusOK {
+				return
+			}
+			var resp models.ChatResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Reply != c.reply || resp.Intent != "fallback" || c.fallback.calls != 1 {
+				t.Fatalf("response = %+v (fallback calls %d)", resp, c.fallback.calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"bob-hackathon/internal/config"
+	"bob-hackathon/internal/models"
+	"bob-hackathon/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadTestFAQs reemplaza data/faqs.csv y recarga el FAQService compartido
+func loadTestFAQs(t *testing.T, csv string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(config.AppConfig.DataDir, "faqs.csv"), []byte(csv), 0644); err != nil {
+		t.Fatal(err)
+	}
+	services.ReloadFAQs()
+}
+
+func TestGetFAQsFilters(t *testing.T) {
+	loadTestFAQs(t, "categoria,empresa,pregunta,respuesta\n"+
+		"Pagos,BOB,¿Cuándo pago?,En 48 horas por transferencia\n"+
+		"Pagos,Santander,¿Aceptan tarjeta?,\"Sí, crédito y débito\"\n"+
+		"Registro,BOB,¿Cómo me registro?,Desde la web con tu DNI\n"+
+		"Subastas,BOB,¿Cómo oferto?,Desde la app o la web\n")
+	r := gin.New()
+	r.GET("/api/faqs", NewLeadController().GetFAQs)
+
+	cases := []struct {
+		name  string
+		query url.Values
+		want  []string // preguntas esperadas, en orden
+	}{
+		{"no filters", nil, []string{"¿Cuándo pago?", "¿Aceptan tarjeta?", "¿Cómo me registro?", "¿Cómo oferto?"}},
+		{"categoria", url.Values{"categoria": {"pagos"}}, []string{"¿Cuándo pago?", "¿Aceptan tarjeta?"}},
+		{"empresa", url.Values{"empresa": {" bob "}}, []string{"¿Cuándo pago?", "¿Cómo me registro?", "¿Cómo oferto?"}},
+		{"q in respuesta without accents", url.Values{"q": {"web"}}, []string{"¿Cómo me registro?", "¿Cómo oferto?"}},
+		{"search alias", url.Values{"search": {"TARJETA"}}, []string{"¿Aceptan tarjeta?"}},
+		{"q wins over search", url.Values{"q": {"dni"}, "search": {"tarjeta"}}, []string{"¿Cómo me registro?"}},
+		{"categoria and empresa", url.Values{"categoria": {"Pagos"}, "empresa": {"Santander"}}, []string{"¿Aceptan tarjeta?"}},
+		{"all three", url.Values{"q": {"como"}, "categoria": {"Subastas"}, "empresa": {"BOB"}}, []string{"¿Cómo oferto?"}},
+		{"no match", url.Values{"categoria": {"Envíos"}}, []string{}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := serve(r, http.MethodGet, "/api/faqs?"+c.query.Encode(), "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d %s", w.Code, w.Body.String())
+			}
+			var resp struct {
+				Count int          `json:"count"`
+				FAQs  []models.FAQ `json:"faqs"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if len(c.want) == 0 && !strings.Contains(w.Body.String(), `"faqs":[]`) {
+				t.Fatalf("empty result must be [], got %s", w.Body.String())
+			}
+			var got []string
+			for _, faq := range resp.FAQs {
+				got = append(got, faq.Pregunta)
+			}
+			if resp.Count != len(c.want) || strings.Join(got, "|") != strings.Join(c.want, "|") {
+				t.Fatalf("faqs = %q (count %d), want %q", got, resp.Count, c.want)
+			}
+		})
+	}
+
+	for _, q := range []string{"q=" + strings.Repeat("a", maxFAQFilterLength+1), "categoria=pagos%00", "empresa=bo%0Ab"} {
+		if w := serve(r, http.MethodGet, "/api/faqs?"+q, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s = %d, want 400", q, w.Code)
+		}
+	}
+}
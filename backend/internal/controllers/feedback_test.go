@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"bob-hackathon/internal/models"
+	"bob-hackathon/internal/services"
+)
+
+// seedFeedbackSession sesión con [user, assistant, user, assistant]
+func seedFeedbackSession(t *testing.T, sessionID, channel string) {
+	t.Helper()
+	svc := services.GetSessionService()
+	svc.GetOrCreateSession(sessionID, channel)
+	svc.AddMessage(sessionID, "user", "hola")
+	svc.AddMessage(sessionID, "assistant", "¡Hola! ¿Qué buscas?")
+	svc.AddMessage(sessionID, "user", "una hilux")
+	svc.AddMessage(sessionID, "assistant", "Tenemos una Hilux 2019.")
+}
+
+func TestSubmitFeedbackValidation(t *testing.T) {
+	r := newChatRouter(NewChatController())
+	seedFeedbackSession(t, "fb-validation", "web")
+	cases := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"up on assistant", `{"sessionId":"fb-validation","messageIndex":1,"rating":"up"}`, http.StatusOK},
+		{"rating normalized", `{"sessionId":"fb-validation","messageIndex":3,"rating":" DOWN ","comment":"muy corto"}`, http.StatusOK},
+		{"bad rating", `{"sessionId":"fb-validation","messageIndex":1,"rating":"meh"}`, http.StatusBadRequest},
+		{"missing rating", `{"sessionId":"fb-validation","messageIndex":1}`, http.StatusBadRequest},
+		{"negative index", `{"sessionId":"fb-validation","messageIndex":-1,"rating":"up"}`, http.StatusBadRequest},
+		{"index out of range", `{"sessionId":"fb-validation","messageIndex":4,"rating":"up"}`, http.StatusBadRequest},
+		{"missing index", `{"sessionId":"fb-validation","rating":"up"}`, http.StatusBadRequest},
+		{"index on user message", `{"sessionId":"fb-validation","messageIndex":0,"rating":"up"}`, http.StatusBadRequest},
+		{"bad session id", `{"sessionId":"../etc","messageIndex":1,"rating":"up"}`, http.StatusBadRequest},
+		{"unknown session", `{"sessionId":"fb-none","messageIndex":1,"rating":"up"}`, http.StatusNotFound},
+		{"comment too long", `{"sessionId":"fb-validation","messageIndex":1,"rating":"up","comment":"` + strings.Repeat("a", 501) + `"}`, http.StatusBadRequest},
+		{"not json", `rating=up`, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := serve(r, http.MethodPost, "/api/chat/feedback", c.body)
+			if w.Code != c.status {
+				t.Fatalf("POST = %d %s, want %d", w.Code, w.Body.String(), c.status)
+			}
+			var resp map[string]any
+			_ = json.Unmarshal(w.Body.Bytes(), &resp)
+			if (resp["success"] == true) != (c.status == http.StatusOK) {
+				t.Fatalf("success = %v", resp["success"])
+			}
+		})
+	}
+}
+
+func TestGetFeedbackAndStats(t *testing.T) {
+	r := newChatRouter(NewChatController())
+	seedFeedbackSession(t, "fb-get-web", "web")
+	seedFeedbackSession(t, "fb-get-wa", "whatsapp")
+
+	statsOf := func() models.FeedbackStats {
+		w := serve(r, http.MethodGet, "/api/chat/feedback/stats", "")
+		var resp struct {
+			Stats models.FeedbackStats `json:"stats"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("stats = %d %v", w.Code, err)
+		}
+		return resp.Stats
+	}
+	before := statsOf()
+
+	for _, body := range []string{
+		`{"sessionId":"fb-get-web","messageIndex":1,"rating":"down"}`,
+		`{"sessionId":"fb-get-web","messageIndex":1,"rating":"up","comment":"mejor"}`, // reemplaza al anterior
+		`{"sessionId":"fb-get-web","messageIndex":3,"rating":"up"}`,
+		`{"sessionId":"fb-get-wa","messageIndex":3,"rating":"down"}`,
+	} {
+		if w := serve(r, http.MethodPost, "/api/chat/feedback", body); w.Code != http.StatusOK {
+			t.Fatalf("POST %s = %d %s", body, w.Code, w.Body.String())
+		}
+	}
+
+	w := serve(r, http.MethodGet, "/api/chat/feedback/fb-get-web", "")
+	var got struct {
+		Count    int               `json:"count"`
+		Feedback []models.Feedback `json:"feedback"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("GET = %d %v", w.Code, err)
+	}
+	if got.Count != 2 || len(got.Feedback) != 2 {
+		t.Fatalf("feedback = %+v, want 2 votes", got)
+	}
+	first := got.Feedback[0]
+	if first.MessageIndex != 1 || first.Rating != "up" || first.Comment != "mejor" || first.Reply != "¡Hola! ¿Qué buscas?" || first.Channel != "web" {
+		t.Fatalf("first vote = %+v", first)
+	}
+
+	after := statsOf()
+	if after.Total-before.Total != 3 || after.Up-before.Up != 2 || after.Down-before.Down != 1 {
+		t.Fatalf("stats delta = total %d up %d down %d", after.Total-before.Total, after.Up-before.Up, after.Down-before.Down)
+	}
+	if after.ByChannel["whatsapp"]-before.ByChannel["whatsapp"] != 1 || after.ByChannel["web"]-before.ByChannel["web"] != 2 {
+		t.Fatalf("by channel = %v (before %v)", after.ByChannel, before.ByChannel)
+	}
+	if after.UpRate <= 0 || after.UpRate > 1 {
+		t.Fatalf("up rate = %v", after.UpRate)
+	}
+
+	if w := serve(r, http.MethodGet, "/api/chat/feedback/bad%20id", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("GET bad id = %d", w.Code)
+	}
+}
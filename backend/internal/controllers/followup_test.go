@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"bob-hackathon/internal/config"
+	"bob-hackathon/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestFollowUpRecipientOnlyFromBot(t *testing.T) {
+	prev := config.AppConfig.EngineAPIToken
+	config.AppConfig.EngineAPIToken = "engine-secret"
+	t.Cleanup(func() { config.AppConfig.EngineAPIToken = prev })
+
+	cases := []struct {
+		name, sessionID, channel, auth, want string
+	}{
+		{"bot turn", "wa-51999999999", "whatsapp", "Bearer engine-secret", "51999999999"},
+		// el open relay: cualquiera puede mandar un sessionId "wa-<teléfono>"
+		{"public web request", "wa-51999999999", "web", "", ""},
+		{"public whatsapp request", "wa-51999999999", "whatsapp", "", ""},
+		{"wrong token", "wa-51999999999", "whatsapp", "Bearer otro", ""},
+		{"bot token on a web session", "wa-51999999999", "web", "Bearer engine-secret", ""},
+		{"not a wa- session", "web-51999999999", "whatsapp", "Bearer engine-secret", ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			ctx.Request = httptest.NewRequest(http.MethodPost, "/api/chat/message", nil)
+			ctx.Request.RemoteAddr = "203.0.113.7:5000"
+			if c.auth != "" {
+				ctx.Request.Header.Set("Authorization", c.auth)
+			}
+			got := followUpRecipient(ctx, &models.Session{SessionID: c.sessionID, Channel: c.channel})
+			if got != c.want {
+				t.Fatalf("followUpRecipient = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
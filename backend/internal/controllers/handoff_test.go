@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"bob-hackathon/internal/agents"
+	"bob-hackathon/internal/config"
+	"bob-hackathon/internal/models"
+	"bob-hackathon/internal/services"
+)
+
+func TestDetectHandoffRequest(t *testing.T) {
+	cases := []struct {
+		message string
+		want    bool
+	}{
+		{"Quiero hablar con un asesor", true},
+		{"¿Puedo HABLAR   CON una persona?", true},
+		{"necesito un asesor por favor", true},
+		{"pásame con un asesor", true},
+		{"pasame con un asesor", true},
+		{"quiero hablar con alguien real", true},
+		{"¿Cuándo es la próxima subasta?", false},
+		{"el asesor financiero del banco dijo que sí", false},
+		{"", false},
+	}
+	for _, c := range cases {
+		if got := detectHandoffRequest(c.message); got != c.want {
+			t.Errorf("detectHandoffRequest(%q) = %v, want %v", c.message, got, c.want)
+		}
+	}
+}
+
+func TestShouldSuppressReply(t *testing.T) {
+	cases := []struct {
+		status   string
+		suppress bool
+		want     bool
+	}{
+		{handoffPending, true, true},
+		{handoffPending, false, false},
+		{"", true, false},
+		{"resolved", true, false},
+	}
+	for _, c := range cases {
+		if got := shouldSuppressReply(c.status, c.suppress); got != c.want {
+			t.Errorf("shouldSuppressReply(%q, %v) = %v, want %v", c.status, c.suppress, got, c.want)
+		}
+	}
+}
+
+// postChat manda un mensaje y decodifica la respuesta
+func postChat(t *testing.T, r http.Handler, body string) models.ChatResponse {
+	t.Helper()
+	w := serve(r, http.MethodPost, "/api/chat/message", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST = %d %s", w.Code, w.Body.String())
+	}
+	var resp models.ChatResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestHandoffOnUserRequestAndSuppression(t *testing.T) {
+	for _, suppress := range []bool{false, true} {
+		name := map[bool]string{false: "bot keeps replying", true: "bot suppressed"}[suppress]
+		t.Run(name, func(t *testing.T) {
+			prev := config.AppConfig.SuppressBotOnHandoff
+			config.AppConfig.SuppressBotOnHandoff = suppress
+			defer func() { config.AppConfig.SuppressBotOnHandoff = prev }()
+
+			sessionID := map[bool]string{false: "handoff-reply", true: "handoff-suppress"}[suppress]
+			orchestrator := &stubAgent{out: agents.AgentOutput{Response: "Claro", IntentDetected: "general", Confidence: 0.9}}
+			r := newChatRouter(newStubChatController(orchestrator, &stubAgent{}, &stubAgent{}, &stubAgent{}))
+
+			resp := postChat(t, r, `{"sessionId":"`+sessionID+`","message":"Quiero hablar con un asesor","channel":"web"}`)
+			if !resp.Handoff || !resp.NeedsHuman || resp.Reply != handoffReply || orchestrator.calls != 0 {
+				t.Fatalf("handoff response = %+v (orchestrator calls %d)", resp, orchestrator.calls)
+			}
+			svc := services.GetSessionService()
+			if svc.GetMetadata(sessionID, handoffKey) != handoffPending || svc.GetMetadata(sessionID, handoffReasonKey) != "user_request" {
+				t.Fatalf("metadata = %q/%q", svc.GetMetadata(sessionID, handoffKey), svc.GetMetadata(sessionID, handoffReasonKey))
+			}
+
+			resp = postChat(t, r, `{"sessionId":"`+sessionID+`","message":"¿sigues ahí?","channel":"web"}`)
+			if resp.Suppressed != suppress || !resp.Handoff {
+				t.Fatalf("follow-up = %+v, want suppressed=%v", resp, suppress)
+			}
+			if suppress && (resp.Reply != "" || orchestrator.calls != 0) {
+				t.Fatalf("suppressed turn replied %q (orchestrator calls %d)", resp.Reply, orchestrator.calls)
+			}
+			if !suppress && (resp.Reply != "Claro" || orchestrator.calls != 1) {
+				t.Fatalf("unsuppressed turn replied %q (orchestrator calls %d)", resp.Reply, orchestrator.calls)
+			}
+		})
+	}
+}
+
+func TestHandoffOnHotLead(t *testing.T) {
+	orchestrator := &stubAgent{out: agents.AgentOutput{Response: "¡Genial!", IntentDetected: "subasta", Confidence: 0.9, HighIntent: true}}
+	scoring := &stubAgent{out: agents.AgentOutput{ScoringData: &models.ScoringData{TotalScore: 92}}}
+	r := newChatRouter(newStubChatController(orchestrator, &stubAgent{}, &stubAgent{}, scoring))
+
+	resp := postChat(t, r, `{"sessionId":"handoff-hot","message":"Compro hoy, tengo 40 mil soles","channel":"web"}`)
+	if resp.Category != "hot" || !resp.Handoff || resp.Reply != "¡Genial!" {
+		t.Fatalf("response = %+v", resp)
+	}
+	if got := services.GetSessionService().GetMetadata("handoff-hot", handoffReasonKey); got != "hot_lead" {
+		t.Fatalf("handoff reason = %q", got)
+	}
+}
+
+func TestResolveHandoff(t *testing.T) {
+	svc := services.GetSessionService()
+	svc.GetOrCreateSession("handoff-resolve", "web")
+	svc.SetMetadata("handoff-resolve", handoffKey, handoffPending)
+
+	r := newAdminRouter()
+	if w := serve(r, http.MethodDelete, "/api/admin/handoff/handoff-resolve", ""); w.Code != http.StatusOK {
+		t.Fatalf("DELETE = %d %s", w.Code, w.Body.String())
+	}
+	if got := svc.GetMetadata("handoff-resolve", handoffKey); got != "" {
+		t.Fatalf("handoff = %q after resolve", got)
+	}
+	if w := serve(r, http.MethodDelete, "/api/admin/handoff/handoff-none", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("DELETE unknown = %d", w.Code)
+	}
+}
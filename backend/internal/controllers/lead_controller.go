@@ -2,8 +2,15 @@ package controllers
 
 import (
 	"bob-hackathon/internal/services"
+	"bob-hackathon/internal/utils"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 )
@@ -53,6 +60,53 @@ func (l *LeadController) GetLead(ctx *gin.Context) {
 	})
 }
 
+// Cada cuánto se manda un ping para que proxies no corten el stream inactivo
+const leadStreamHeartbeat = 20 * time.Second
+
+// StreamLeads GET /api/leads/stream: Server-Sent Events con cada lead creado o
+// actualizado (evento "lead"); acepta los mismos filtros category/channel que /api/leads.
+// Con category también llegan los leads que salen de esa categoría (ej: hot → warm).
+func (l *LeadController) StreamLeads(ctx *gin.Context) {
+	category := ctx.Query("category")
+	channel := ctx.Query("channel")
+
+	updates, unsubscribe := l.sessionService.SubscribeLeads()
+	defer unsubscribe()
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no")
+
+	heartbeat := time.NewTicker(leadStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	ctx.SSEvent("ready", gin.H{"category": category, "channel": channel})
+	ctx.Writer.Flush()
+
+	ctx.Stream(func(w io.Writer) bool {
+		select {
+		case <-ctx.Request.Context().Done():
+			return false
+		case update, ok := <-updates:
+			if !ok {
+				return false
+			}
+			if category != "" && update.Lead.Category != category && update.PreviousCategory != category {
+				return true
+			}
+			if channel != "" && update.Lead.Channel != channel {
+				return true
+			}
+			ctx.SSEvent("lead", update)
+			return true
+		case <-heartbeat.C:
+			ctx.SSEvent("ping", time.Now().Unix())
+			return true
+		}
+	})
+}
+
 func (l *LeadController) GetLeadsStats(ctx *gin.Context) {
 	stats := l.sessionService.GetLeadsStats()
 
@@ -62,18 +116,50 @@ func (l *LeadController) GetLeadsStats(ctx *gin.Context) {
 	})
 }
 
+// Largo máximo de cada filtro de GET /api/faqs
+const maxFAQFilterLength = 100
+
+// GetFAQs lista las FAQs; ?categoria= y ?empresa= filtran (sin distinguir mayúsculas
+// ni tildes) y ?q= busca en pregunta y respuesta (?search= se mantiene como alias)
 func (l *LeadController) GetFAQs(ctx *gin.Context) {
-	search := ctx.Query("search")
-	categoria := ctx.Query("categoria")
-	empresa := ctx.Query("empresa")
+	var filters [3]string
+	for i, names := range [][]string{{"q", "search"}, {"categoria"}, {"empresa"}} {
+		value, err := parseFAQFilter(ctx, names...)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		filters[i] = value
+	}
 
-	faqs := l.faqService.SearchFAQs(search, categoria, empresa)
+	faqs := l.faqService.SearchFAQs(filters[0], filters[1], filters[2])
 
-	ctx.JSON(http.StatusOK, gin.H{
+	respondWithETag(ctx, gin.H{
 		"success": true,
 		"count":   len(faqs),
 		"faqs":    faqs,
-	})
+	}, time.Time{})
+}
+
+// parseFAQFilter primer parámetro no vacío entre names, validado
+func parseFAQFilter(ctx *gin.Context, names ...string) (string, error) {
+	for _, name := range names {
+		value := strings.TrimSpace(ctx.Query(name))
+		if value == "" {
+			continue
+		}
+		if utf8.RuneCountInString(value) > maxFAQFilterLength {
+			return "", &utils.ValidationError{Field: name, Message: fmt.Sprintf("%s no puede superar %d caracteres", name, maxFAQFilterLength)}
+		}
+		if strings.IndexFunc(value, unicode.IsControl) >= 0 {
+			return "", &utils.ValidationError{Field: name, Message: name + " contiene caracteres inválidos"}
+		}
+		return value, nil
+	}
+	return "", nil
 }
 
 func (l *LeadController) GetVehicles(ctx *gin.Context) {
@@ -83,10 +169,15 @@ func (l *LeadController) GetVehicles(ctx *gin.Context) {
 
 	precioMinStr := ctx.Query("precio_min")
 	precioMaxStr := ctx.Query("precio_max")
+	yearMinStr := ctx.Query("year_min")
+	yearMaxStr := ctx.Query("year_max")
+	estado := ctx.Query("estado")
 	limitStr := ctx.DefaultQuery("limit", "10")
 
 	precioMin := 0.0
 	precioMax := 0.0
+	yearMin := 0
+	yearMax := 0
 	limit := 10
 
 	if precioMinStr != "" {
@@ -101,11 +192,19 @@ func (l *LeadController) GetVehicles(ctx *gin.Context) {
 		}
 	}
 
+	if val, err := strconv.Atoi(yearMinStr); err == nil {
+		yearMin = val
+	}
+
+	if val, err := strconv.Atoi(yearMaxStr); err == nil {
+		yearMax = val
+	}
+
 	if val, err := strconv.Atoi(limitStr); err == nil {
 		limit = val
 	}
 
-	vehicles, err := l.bobAPIService.SearchVehicles(marca, modelo, precioMin, precioMax, tipoSubasta, limit)
+	vehicles, err := l.bobAPIService.SearchVehicles(marca, modelo, precioMin, precioMax, tipoSubasta, yearMin, yearMax, estado, limit)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -114,11 +213,123 @@ func (l *LeadController) GetVehicles(ctx *gin.Context) {
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{
+	respondWithETag(ctx, gin.H{
 		"success":  true,
 		"count":    len(vehicles),
 		"vehicles": vehicles,
-	})
+	}, l.bobAPIService.LastFetch())
+}
+
+// Máximo de resultados de /api/vehicles/search
+const maxVehicleSearchLimit = 50
+
+// vehicleSearchParams filtros de /api/vehicles/search ya validados
+type vehicleSearchParams struct {
+	Marca     string
+	Modelo    string
+	PrecioMin float64
+	PrecioMax float64
+	Tipo      string
+	YearMin   int
+	YearMax   int
+	Estado    string
+	Limit     int
+}
+
+// parseVehicleSearchParams lee y valida los query params; un número inválido es error
+func parseVehicleSearchParams(ctx *gin.Context) (*vehicleSearchParams, error) {
+	params := &vehicleSearchParams{
+		Marca:  strings.TrimSpace(ctx.Query("marca")),
+		Modelo: strings.TrimSpace(ctx.Query("modelo")),
+		Tipo:   strings.TrimSpace(ctx.Query("tipo")),
+		Estado: strings.TrimSpace(ctx.Query("estado")),
+		Limit:  10,
+	}
+
+	var err error
+	if params.PrecioMin, err = parseFloatQuery(ctx, "precioMin"); err != nil {
+		return nil, err
+	}
+	if params.PrecioMax, err = parseFloatQuery(ctx, "precioMax"); err != nil {
+		return nil, err
+	}
+	if params.PrecioMax > 0 && params.PrecioMin > params.PrecioMax {
+		return nil, &utils.ValidationError{Field: "precioMin", Message: "precioMin no puede ser mayor que precioMax"}
+	}
+	if params.YearMin, err = parseIntQuery(ctx, "yearMin"); err != nil {
+		return nil, err
+	}
+	if params.YearMax, err = parseIntQuery(ctx, "yearMax"); err != nil {
+		return nil, err
+	}
+	if params.YearMax > 0 && params.YearMin > params.YearMax {
+		return nil, &utils.ValidationError{Field: "yearMin", Message: "yearMin no puede ser mayor que yearMax"}
+	}
+
+	if ctx.Query("limit") != "" {
+		if params.Limit, err = parseIntQuery(ctx, "limit"); err != nil {
+			return nil, err
+		}
+		if params.Limit == 0 {
+			return nil, &utils.ValidationError{Field: "limit", Message: "limit debe ser mayor que 0"}
+		}
+	}
+	params.Limit = min(params.Limit, maxVehicleSearchLimit)
+
+	return params, nil
+}
+
+func parseFloatQuery(ctx *gin.Context, key string) (float64, error) {
+	raw := ctx.Query(key)
+	if raw == "" {
+		return 0, nil
+	}
+	val, err := strconv.ParseFloat(raw, 64)
+	if err != nil || val < 0 {
+		return 0, &utils.ValidationError{Field: key, Message: key + " debe ser un número mayor o igual a 0"}
+	}
+	return val, nil
+}
+
+func parseIntQuery(ctx *gin.Context, key string) (int, error) {
+	raw := ctx.Query(key)
+	if raw == "" {
+		return 0, nil
+	}
+	val, err := strconv.Atoi(raw)
+	if err != nil || val < 0 {
+		return 0, &utils.ValidationError{Field: key, Message: key + " debe ser un entero mayor o igual a 0"}
+	}
+	return val, nil
+}
+
+// SearchVehicles GET /api/vehicles/search?marca=&modelo=&precioMin=&precioMax=&tipo=&yearMin=&yearMax=&estado=&limit=
+func (l *LeadController) SearchVehicles(ctx *gin.Context) {
+	params, err := parseVehicleSearchParams(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	vehicles, err := l.bobAPIService.SearchVehicles(params.Marca, params.Modelo, params.PrecioMin, params.PrecioMax,
+		params.Tipo, params.YearMin, params.YearMax, params.Estado, params.Limit)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Error al buscar vehículos: " + err.Error(),
+		})
+		return
+	}
+
+	respondWithETag(ctx, gin.H{
+		"success":  true,
+		"count":    len(vehicles),
+		"limit":    params.Limit,
+		"vehicles": vehicles,
+	}, l.bobAPIService.LastFetch())
 }
 
 func (l *LeadController) GetVehicleByID(ctx *gin.Context) {
@@ -133,8 +344,8 @@ func (l *LeadController) GetVehicleByID(ctx *gin.Context) {
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{
+	respondWithETag(ctx, gin.H{
 		"success": true,
 		"vehicle": vehicle,
-	})
+	}, time.Time{})
 }
@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"bob-hackathon/internal/models"
+	"bob-hackathon/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sseEvent evento leído del stream
+type sseEvent struct {
+	name string
+	data string
+}
+
+// readSSE lee eventos del body y los manda por el canal hasta EOF
+func readSSE(body *bufio.Reader) <-chan sseEvent {
+	events := make(chan sseEvent, 16)
+	go func() {
+		defer close(events)
+		var ev sseEvent
+		for {
+			line, err := body.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\n")
+			switch {
+			case strings.HasPrefix(line, "event:"):
+				ev.name = strings.TrimPrefix(line, "event:")
+			case strings.HasPrefix(line, "data:"):
+				ev.data = strings.TrimPrefix(line, "data:")
+			case line == "" && ev.name != "":
+				events <- ev
+				ev = sseEvent{}
+			}
+		}
+	}()
+	return events
+}
+
+func nextEvent(t *testing.T, events <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatal("stream closed")
+		}
+		return ev
+	case <-time.After(3 * time.Second):
+		t.Fatal("no SSE event")
+	}
+	return sseEvent{}
+}
+
+func TestStreamLeads(t *testing.T) {
+	l := NewLeadController()
+	r := gin.New()
+	finished := make(chan struct{})
+	r.GET("/api/leads/stream", func(c *gin.Context) {
+		defer close(finished)
+		l.StreamLeads(c)
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/leads/stream?category=hot&channel=whatsapp", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	events := readSSE(bufio.NewReader(resp.Body))
+	if ev := nextEvent(t, events); ev.name != "ready" {
+		t.Fatalf("first event = %+v", ev)
+	}
+
+	svc := services.GetSessionService()
+	svc.CreateOrUpdateLead(&models.Lead{SessionID: "stream-web", Channel: "web", Score: 95, Category: "hot"})      // otro canal
+	svc.CreateOrUpdateLead(&models.Lead{SessionID: "stream-wa", Channel: "whatsapp", Score: 50, Category: "cold"}) // otra categoría
+	svc.CreateOrUpdateLead(&models.Lead{SessionID: "stream-wa", Channel: "whatsapp", Score: 90, Category: "hot"})
+	svc.CreateOrUpdateLead(&models.Lead{SessionID: "stream-wa", Channel: "whatsapp", Score: 70, Category: "warm"}) // sale de hot
+
+	for _, want := range []struct{ category, previous string }{{"hot", "cold"}, {"warm", "hot"}} {
+		ev := nextEvent(t, events)
+		var update models.LeadUpdate
+		if err := json.Unmarshal([]byte(ev.data), &update); err != nil || ev.name != "lead" {
+			t.Fatalf("event = %+v (%v)", ev, err)
+		}
+		if update.Lead.SessionID != "stream-wa" || update.Lead.Category != want.category || update.PreviousCategory != want.previous || !update.CategoryChanged {
+			t.Fatalf("update = %+v, want %s from %s", update, want.category, want.previous)
+		}
+	}
+
+	// al desconectarse el cliente el handler termina (y su defer libera la suscripción)
+	cancel()
+	select {
+	case <-finished:
+	case <-time.After(3 * time.Second):
+		t.Fatal("handler still streaming after client disconnect")
+	}
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"bob-hackathon/internal/agents"
+	"bob-hackathon/internal/config"
+	"bob-hackathon/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testSublots inventario que sirve la API de BOB falsa de TestMain
+const testSublots = `{"data":[
+	{"id":"1","brand":"Toyota","model":"Hilux","year":"2019","start_price":45000,"auction_type":"online","status":"disponible"},
+	{"id":"2","brand":"Kia","model":"Rio","year":"2020","start_price":25000,"auction_type":"presencial","status":"disponible"}
+]}`
+
+// TestMain gin en modo test y config mínima con DataDir temporal (sin API key: modo degradado)
+// y una API de BOB falsa para los endpoints de vehículos
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	dir, err := os.MkdirTemp("", "controllers-test")
+	if err != nil {
+		panic(err)
+	}
+	bobAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		io.WriteString(w, testSublots)
+	}))
+	config.AppConfig = &config.Config{
+		DataDir:            dir,
+		LLMProvider:        "mock",
+		USDToPEN:           3.75,
+		ScoringMinMessages: 6,
+		BOBAPIBaseURL:      bobAPI.URL,
+	}
+	code := m.Run()
+	bobAPI.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// serve ejecuta una request contra r y devuelve la respuesta
+func serve(r http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	var rd io.Reader
+	if body != "" {
+		rd = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, rd)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// newChatRouter rutas de /api/chat como en cmd/server (sin middlewares)
+func newChatRouter(c *ChatController) *gin.Engine {
+	r := gin.New()
+	chat := r.Group("/api/chat")
+	chat.POST("/message", c.SendMessage)
+	chat.POST("/score", c.GetScore)
+	chat.GET("/history/:sessionId", c.GetHistory)
+	chat.GET("/sessions", c.GetAllSessions)
+	chat.DELETE("/session/:sessionId", c.DeleteSession)
+	chat.POST("/feedback", c.SubmitFeedback)
+	chat.GET("/feedback/stats", c.GetFeedbackStats)
+	chat.GET("/feedback/:sessionId", c.GetFeedback)
+	return r
+}
+
+// stubAgent agente fijo: devuelve out (o err) y cuenta las llamadas
+type stubAgent struct {
+	out   agents.AgentOutput
+	err   error
+	calls int
+	last  *agents.AgentInput
+}
+
+func (s *stubAgent) Name() string { return "stub" }
+
+func (s *stubAgent) Process(_ context.Context, input *agents.AgentInput) (*agents.AgentOutput, error) {
+	s.calls++
+	s.last = input
+	if s.err != nil {
+		return nil, s.err
+	}
+	out := s.out
+	return &out, nil
+}
+
+// newStubChatController controller con agentes stub (sin resúmenes ni fallback)
+func newStubChatController(orchestrator, faq, auction, scoring agents.Agent) *ChatController {
+	return &ChatController{
+		orchestrator:   orchestrator,
+		faqAgent:       faq,
+		auctionAgent:   auction,
+		scoringAgent:   scoring,
+		sessionService: services.GetSessionService(),
+		followUps:      services.GetFollowUpService(),
+	}
+}
+
+// newAdminRouter rutas de /api/admin usadas por los tests (sin AdminAuth)
+func newAdminRouter() *gin.Engine {
+	a := NewAdminController(nil)
+	r := gin.New()
+	admin := r.Group("/api/admin")
+	admin.DELETE("/handoff/:sessionId", a.ResolveHandoff)
+	return r
+}
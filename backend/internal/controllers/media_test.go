@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+
+	"bob-hackathon/internal/agents"
+	"bob-hackathon/internal/llm"
+	"bob-hackathon/internal/services"
+)
+
+// testPNG cabecera PNG: basta para que LoadChatMedia detecte image/png
+var testPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR-auto-rojo")
+
+func TestSendMessageImageReachesModel(t *testing.T) {
+	provider := llm.NewMockProvider(`{"intent":"subasta","confidence":0.9,"shouldRoute":false,"response":"Es una Hilux 2019."}`)
+	orchestrator, err := agents.NewOrchestratorAgent(provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newChatRouter(newStubChatController(orchestrator, &stubAgent{}, &stubAgent{}, &stubAgent{}))
+
+	body := `{"sessionId":"media-1","message":"¿tienen uno así?","channel":"whatsapp","media":{"data":"` + base64.StdEncoding.EncodeToString(testPNG) + `"}}`
+	if w := serve(r, http.MethodPost, "/api/chat/message", body); w.Code != http.StatusOK {
+		t.Fatalf("POST = %d %s", w.Code, w.Body.String())
+	}
+
+	calls := provider.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("LLM calls = %d, want 1", len(calls))
+	}
+	var image *llm.Part
+	for i, p := range calls[0] {
+		if p.IsBlob() {
+			image = &calls[0][i]
+		}
+	}
+	if image == nil {
+		t.Fatalf("generate call has no image part: %+v", calls[0])
+	}
+	if image.MimeType != "image/png" || !bytes.Equal(image.Data, testPNG) {
+		t.Fatalf("image part = %s (%d bytes)", image.MimeType, len(image.Data))
+	}
+
+	// el mensaje guarda la referencia, no los bytes
+	msgs := services.GetSessionService().GetMessages("media-1")
+	if len(msgs) == 0 || msgs[0].Media == nil {
+		t.Fatalf("user message without media ref: %+v", msgs)
+	}
+	if ref := msgs[0].Media; ref.MimeType != "image/png" || ref.Size != len(testPNG) || len(ref.SHA256) != 64 {
+		t.Fatalf("media ref = %+v", ref)
+	}
+}
+
+func TestSendMessageImageWithoutText(t *testing.T) {
+	orchestrator := &stubAgent{out: agents.AgentOutput{Response: "Linda camioneta."}}
+	r := newChatRouter(newStubChatController(orchestrator, &stubAgent{}, &stubAgent{}, &stubAgent{}))
+
+	body := `{"sessionId":"media-2","channel":"whatsapp","media":{"data":"data:image/png;base64,` + base64.StdEncoding.EncodeToString(testPNG) + `"}}`
+	if w := serve(r, http.MethodPost, "/api/chat/message", body); w.Code != http.StatusOK {
+		t.Fatalf("POST = %d %s", w.Code, w.Body.String())
+	}
+	if in := orchestrator.last; in == nil || in.Media == nil || in.Message != mediaOnlyMessage {
+		t.Fatalf("orchestrator input = %+v", in)
+	}
+}
+
+func TestSendMessageRejectsInvalidMedia(t *testing.T) {
+	orchestrator := &stubAgent{out: agents.AgentOutput{Response: "hola"}}
+	r := newChatRouter(newStubChatController(orchestrator, &stubAgent{}, &stubAgent{}, &stubAgent{}))
+
+	for name, media := range map[string]string{
+		"not base64":      `{"data":"%%%"}`,
+		"url and data":    `{"url":"https://example.com/a.png","data":"aGVsbG8="}`,
+		"unsupported":     `{"data":"` + base64.StdEncoding.EncodeToString([]byte("texto plano")) + `"}`,
+		"empty":           `{}`,
+		"non-http scheme": `{"url":"file:///etc/passwd"}`,
+		"metadata url":    `{"url":"http://169.254.169.254/latest/meta-data/"}`,
+	} {
+		body := `{"sessionId":"media-bad","message":"hola","channel":"web","media":` + media + `}`
+		if w := serve(r, http.MethodPost, "/api/chat/message", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: POST = %d, want 400", name, w.Code)
+		}
+	}
+	if orchestrator.calls != 0 {
+		t.Fatalf("orchestrator called %d times with invalid media", orchestrator.calls)
+	}
+}
+
+func TestSendMessageBodyLimit(t *testing.T) {
+	orchestrator := &stubAgent{out: agents.AgentOutput{Response: "hola", IntentDetected: "general", Confidence: 0.9}}
+	r := newChatRouter(newStubChatController(orchestrator, &stubAgent{}, &stubAgent{}, &stubAgent{}))
+
+	// una imagen del tamaño máximo, en base64, entra
+	image := append(append([]byte{}, testPNG...), bytes.Repeat([]byte{0}, services.MaxChatMediaBytes-len(testPNG))...)
+	body := `{"sessionId":"media-max","message":"hola","channel":"web","media":{"data":"` + base64.StdEncoding.EncodeToString(image) + `"}}`
+	if w := serve(r, http.MethodPost, "/api/chat/message", body); w.Code != http.StatusOK {
+		t.Fatalf("max-size media: POST = %d %.200s", w.Code, w.Body.String())
+	}
+
+	// un cuerpo más grande se corta sin leerlo entero
+	body = `{"sessionId":"media-huge","message":"` + strings.Repeat("a", maxChatRequestBytes) + `","channel":"web"}`
+	if w := serve(r, http.MethodPost, "/api/chat/message", body); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized body: POST = %d %.200s, want 413", w.Code, w.Body.String())
+	}
+	if orchestrator.calls != 1 {
+		t.Fatalf("orchestrator calls = %d, want 1", orchestrator.calls)
+	}
+}
@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"bob-hackathon/internal/agents"
+	"bob-hackathon/internal/config"
+	"bob-hackathon/internal/llm"
+	"bob-hackathon/internal/services"
+)
+
+// stubExtractor OCR fijo: devuelve text (o err) y cuenta las llamadas
+type stubExtractor struct {
+	text     string
+	err      error
+	calls    int
+	mimeType string
+}
+
+func (s *stubExtractor) ExtractText(_ context.Context, mimeType string, _ []byte) (string, error) {
+	s.calls++
+	s.mimeType = mimeType
+	return s.text, s.err
+}
+
+// withOCRMaxBytes fija OCR_MAX_BYTES durante el test
+func withOCRMaxBytes(t *testing.T, n int) {
+	t.Helper()
+	prev := config.AppConfig.OCRMaxBytes
+	config.AppConfig.OCRMaxBytes = n
+	t.Cleanup(func() { config.AppConfig.OCRMaxBytes = prev })
+}
+
+func mediaBody(sessionID, message string, data []byte, mimeType string) string {
+	return `{"sessionId":"` + sessionID + `","message":"` + message + `","channel":"whatsapp","media":{"data":"` +
+		base64.StdEncoding.EncodeToString(data) + `","mimeType":"` + mimeType + `"}}`
+}
+
+func TestSendMessageOCRTextReachesSubAgentPrompt(t *testing.T) {
+	withOCRMaxBytes(t, 1<<20)
+	const plate = "PLACA: ABC-123"
+	provider := llm.NewMockProvider(`Esa placa corresponde a la Toyota Hilux 2019 en subasta.`)
+	auction, err := agents.NewAuctionAgent(provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orchestrator := &stubAgent{out: agents.AgentOutput{ShouldRoute: true, RouteTo: "auction_agent", Confidence: 0.9}}
+	c := newStubChatController(orchestrator, &stubAgent{}, auction, &stubAgent{})
+	ocr := &stubExtractor{text: plate}
+	c.extractor = ocr
+	r := newChatRouter(c)
+
+	if w := serve(r, http.MethodPost, "/api/chat/message", mediaBody("ocr-1", "¿está en subasta?", testPNG, "image/png")); w.Code != http.StatusOK {
+		t.Fatalf("POST = %d %s", w.Code, w.Body.String())
+	}
+	if ocr.calls != 1 || ocr.mimeType != "image/png" {
+		t.Fatalf("extractor calls = %d (%s)", ocr.calls, ocr.mimeType)
+	}
+
+	// el texto queda en la metadata del mensaje...
+	msgs := services.GetSessionService().GetMessages("ocr-1")
+	if len(msgs) == 0 || msgs[0].Media == nil || msgs[0].Media.ExtractedText != plate {
+		t.Fatalf("session messages = %+v", msgs)
+	}
+	// ...y llega al prompt del sub-agente junto con la imagen
+	calls := provider.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("LLM calls = %d, want 1", len(calls))
+	}
+	var hasText, hasImage bool
+	for _, p := range calls[0] {
+		hasText = hasText || strings.Contains(p.Text, plate)
+		hasImage = hasImage || p.IsBlob()
+	}
+	if !hasText || !hasImage {
+		t.Fatalf("auction prompt: OCR text %v, image %v", hasText, hasImage)
+	}
+}
+
+func TestSendMessagePDFSendsOnlyExtractedText(t *testing.T) {
+	withOCRMaxBytes(t, 1<<20)
+	orchestrator := &stubAgent{out: agents.AgentOutput{Response: "Recibí tu comprobante."}}
+	c := newStubChatController(orchestrator, &stubAgent{}, &stubAgent{}, &stubAgent{})
+	c.extractor = &stubExtractor{text: "Comprobante de depósito S/ 1,500"}
+	r := newChatRouter(c)
+
+	pdf := []byte("%PDF-1.4 comprobante")
+	if w := serve(r, http.MethodPost, "/api/chat/message", mediaBody("ocr-2", "", pdf, "application/pdf")); w.Code != http.StatusOK {
+		t.Fatalf("POST = %d %s", w.Code, w.Body.String())
+	}
+	if in := orchestrator.last; in == nil || in.Media != nil || in.MediaText != "Comprobante de depósito S/ 1,500" {
+		t.Fatalf("orchestrator input = %+v", in)
+	}
+}
+
+func TestSendMessageOCRSkippedOrFailed(t *testing.T) {
+	cases := []struct {
+		name     string
+		maxBytes int
+		ocr      *stubExtractor
+		calls    int
+	}{
+		{"over OCR_MAX_BYTES", 8, &stubExtractor{text: "no debería leerse"}, 0},
+		{"extractor error", 1 << 20, &stubExtractor{err: errors.New("vision caído")}, 1},
+	}
+	for i, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			withOCRMaxBytes(t, tc.maxBytes)
+			orchestrator := &stubAgent{out: agents.AgentOutput{Response: "ok"}}
+			c := newStubChatController(orchestrator, &stubAgent{}, &stubAgent{}, &stubAgent{})
+			c.extractor = tc.ocr
+			r := newChatRouter(c)
+
+			// sin texto extraído el mensaje sigue igual, con la imagen
+			sessionID := "ocr-skip-" + string(rune('a'+i))
+			if w := serve(r, http.MethodPost, "/api/chat/message", mediaBody(sessionID, "mira", testPNG, "image/png")); w.Code != http.StatusOK {
+				t.Fatalf("POST = %d %s", w.Code, w.Body.String())
+			}
+			if tc.ocr.calls != tc.calls {
+				t.Fatalf("extractor calls = %d, want %d", tc.ocr.calls, tc.calls)
+			}
+			if in := orchestrator.last; in == nil || in.Media == nil || in.MediaText != "" {
+				t.Fatalf("orchestrator input = %+v", in)
+			}
+		})
+	}
+}
+
+func TestExtractTextEndpoint(t *testing.T) {
+	withOCRMaxBytes(t, 1<<20)
+	c := newStubChatController(&stubAgent{}, &stubAgent{}, &stubAgent{}, &stubAgent{})
+	r := newChatRouter(c)
+	r.POST("/api/chat/extract", c.ExtractText)
+
+	body := `{"media":{"data":"` + base64.StdEncoding.EncodeToString(testPNG) + `"}}`
+	if w := serve(r, http.MethodPost, "/api/chat/extract", body); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("without extractor = %d, want 503", w.Code)
+	}
+
+	c.extractor = &stubExtractor{text: "ABC-123"}
+	if w := serve(r, http.MethodPost, "/api/chat/extract", body); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "ABC-123") {
+		t.Fatalf("POST = %d %s", w.Code, w.Body.String())
+	}
+	audio := `{"media":{"data":"` + base64.StdEncoding.EncodeToString(testOgg) + `"}}`
+	if w := serve(r, http.MethodPost, "/api/chat/extract", audio); w.Code != http.StatusBadRequest {
+		t.Fatalf("audio = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"bob-hackathon/internal/agents"
+	"bob-hackathon/internal/llm"
+)
+
+func TestSendMessageTierSelectsPersona(t *testing.T) {
+	cases := []struct {
+		name, tier  string
+		wantPremium bool
+	}{
+		{"premium", "Premium", true},
+		{"free", "free", false},
+		{"no tier", "", false},
+	}
+	for i, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			provider := llm.NewMockProvider(`{"intent":"general","confidence":0.9,"shouldRoute":false,"response":"hola"}`)
+			orchestrator, err := agents.NewOrchestratorAgent(provider)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := newChatRouter(newStubChatController(orchestrator, &stubAgent{}, &stubAgent{}, &stubAgent{}))
+
+			body := `{"sessionId":"tier-` + string(rune('a'+i)) + `","message":"hola","channel":"web","tier":"` + c.tier + `"}`
+			if w := serve(r, http.MethodPost, "/api/chat/message", body); w.Code != http.StatusOK {
+				t.Fatalf("POST = %d %s", w.Code, w.Body.String())
+			}
+			calls := provider.Calls()
+			if len(calls) != 1 {
+				t.Fatalf("LLM calls = %d", len(calls))
+			}
+			if got := strings.Contains(calls[0][0].Text, "Cliente premium"); got != c.wantPremium {
+				t.Fatalf("premium modifier in prompt = %v, want %v", got, c.wantPremium)
+			}
+		})
+	}
+}
+
+func TestSendMessageRejectsInvalidTier(t *testing.T) {
+	orchestrator := &stubAgent{out: agents.AgentOutput{Response: "hola"}}
+	r := newChatRouter(newStubChatController(orchestrator, &stubAgent{}, &stubAgent{}, &stubAgent{}))
+
+	w := serve(r, http.MethodPost, "/api/chat/message", `{"sessionId":"tier-bad","message":"hola","channel":"web","tier":"vip gold!"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("POST = %d, want 400", w.Code)
+	}
+	if orchestrator.calls != 0 {
+		t.Fatal("orchestrator called with an invalid tier")
+	}
+}
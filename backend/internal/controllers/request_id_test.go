@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"bob-hackathon/internal/agents"
+	"bob-hackathon/internal/middleware"
+	"bob-hackathon/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSendMessageRequestIDRoundTrip(t *testing.T) {
+	cases := []struct {
+		name, header, body, want string
+	}{
+		{"header", "hdr-123", "", "hdr-123"},
+		{"body when no header", "", "body-456", "body-456"},
+		{"header wins over body", "hdr-789", "body-000", "hdr-789"},
+		{"invalid body id ignored", "", "no válido", ""},
+	}
+	for i, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			orchestrator := &stubAgent{out: agents.AgentOutput{Response: "hola", IntentDetected: "general", Confidence: 0.9}}
+			r := gin.New()
+			r.Use(middleware.RequestID())
+			r.POST("/api/chat/message", newStubChatController(orchestrator, &stubAgent{}, &stubAgent{}, &stubAgent{}).SendMessage)
+
+			payload, _ := json.Marshal(map[string]string{
+				"sessionId": "reqid-" + string(rune('a'+i)),
+				"message":   "hola",
+				"channel":   "whatsapp",
+				"requestId": c.body,
+			})
+			req := httptest.NewRequest(http.MethodPost, "/api/chat/message", strings.NewReader(string(payload)))
+			req.Header.Set("Content-Type", "application/json")
+			if c.header != "" {
+				req.Header.Set(middleware.RequestIDHeader, c.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			var resp models.ChatResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+				t.Fatalf("POST = %d %s", w.Code, w.Body.String())
+			}
+			if resp.RequestID != w.Header().Get(middleware.RequestIDHeader) {
+				t.Fatalf("body %q vs header %q", resp.RequestID, w.Header().Get(middleware.RequestIDHeader))
+			}
+			if orchestrator.last.RequestID != resp.RequestID {
+				t.Fatalf("agents got %q, response %q", orchestrator.last.RequestID, resp.RequestID)
+			}
+			if c.want != "" && resp.RequestID != c.want {
+				t.Fatalf("request id = %q, want %q", resp.RequestID, c.want)
+			}
+			if c.want == "" && (resp.RequestID == c.body || resp.RequestID == "") {
+				t.Fatalf("request id = %q, want a generated one", resp.RequestID)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"bob-hackathon/internal/config"
+	"bob-hackathon/internal/models"
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rescoreJob re-scoring masivo en curso (o el último terminado)
+type rescoreJob struct {
+	mu       sync.Mutex
+	progress models.RescoreProgress
+	cancel   context.CancelFunc
+}
+
+func (j *rescoreJob) snapshot() models.RescoreProgress {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.progress
+}
+
+func (j *rescoreJob) record(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.progress.Processed++
+	if err != nil {
+		j.progress.Failed++
+	}
+}
+
+func (j *rescoreJob) finish(cancelled bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	j.progress.FinishedAt = &now
+	j.progress.Status = "completed"
+	if cancelled {
+		j.progress.Status = "cancelled"
+	}
+}
+
+// RescoreAllLeads inicia el re-scoring de todas las sesiones con suficientes mensajes
+// (POST /api/admin/leads/rescore-all). Corre en segundo plano sin smoothing, así que
+// volver a lanzarlo deja los mismos scores; 409 si ya hay uno corriendo.
+func (c *ChatController) RescoreAllLeads(ctx *gin.Context) {
+	if !c.requireAI(ctx) {
+		return
+	}
+
+	c.rescoreMu.Lock()
+	if c.rescore != nil && c.rescore.snapshot().Status == "running" {
+		progress := c.rescore.snapshot()
+		c.rescoreMu.Unlock()
+		ctx.JSON(http.StatusConflict, gin.H{
+			"success":  false,
+			"error":    "Ya hay un re-scoring en curso",
+			"progress": progress,
+		})
+		return
+	}
+
+	var sessions []*models.Session
+	for _, session := range c.sessionService.GetAllSessions() {
+		if len(session.Messages) >= config.AppConfig.ScoringMinMessages {
+			sessions = append(sessions, session)
+		}
+	}
+
+	jobCtx, cancel := context.WithCancel(context.Background())
+	job := &rescoreJob{
+		progress: models.RescoreProgress{
+			Status:    "running",
+			Total:     len(sessions),
+			StartedAt: time.Now(),
+		},
+		cancel: cancel,
+	}
+	c.rescore = job
+	c.rescoreMu.Unlock()
+
+	log.Printf("🔁 Re-scoring masivo iniciado: %d sesiones", len(sessions))
+	go c.runRescore(jobCtx, job, sessions, config.AppConfig.RescoreConcurrency, config.AppConfig.RescoreInterval)
+
+	ctx.JSON(http.StatusAccepted, gin.H{
+		"success":  true,
+		"progress": job.snapshot(),
+	})
+}
+
+// GetRescoreProgress avance del último re-scoring masivo
+func (c *ChatController) GetRescoreProgress(ctx *gin.Context) {
+	c.rescoreMu.Lock()
+	job := c.rescore
+	c.rescoreMu.Unlock()
+
+	if job == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "No se ha ejecutado ningún re-scoring",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"progress": job.snapshot(),
+	})
+}
+
+// CancelRescore detiene el re-scoring en curso; las sesiones ya procesadas quedan actualizadas
+func (c *ChatController) CancelRescore(ctx *gin.Context) {
+	c.rescoreMu.Lock()
+	job := c.rescore
+	c.rescoreMu.Unlock()
+
+	if job == nil || job.snapshot().Status != "running" {
+		ctx.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "No hay un re-scoring en curso",
+		})
+		return
+	}
+
+	job.cancel()
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Re-scoring cancelado",
+	})
+}
+
+// runRescore procesa las sesiones con a lo sumo concurrency llamadas simultáneas
+// y al menos interval entre el inicio de cada una (límite de rate de Gemini)
+func (c *ChatController) runRescore(ctx context.Context, job *rescoreJob, sessions []*models.Session, concurrency int, interval time.Duration) {
+	defer job.cancel()
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var throttle <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+loop:
+	for i, session := range sessions {
+		if throttle != nil && i > 0 {
+			select {
+			case <-ctx.Done():
+				break loop
+			case <-throttle:
+			}
+		}
+		select {
+		case <-ctx.Done():
+			break loop
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(session *models.Session) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			_, err := c.rescoreSession(ctx, "", session, false)
+			if err != nil && ctx.Err() != nil {
+				return // cortada por la cancelación: no cuenta como procesada
+			}
+			if err != nil {
+				log.Printf("⚠️ Re-scoring de %s falló: %v", session.SessionID, err)
+			}
+			job.record(err)
+		}(session)
+	}
+	wg.Wait()
+
+	cancelled := ctx.Err() != nil && job.snapshot().Processed < len(sessions)
+	job.finish(cancelled)
+	progress := job.snapshot()
+	log.Printf("🔁 Re-scoring masivo %s: %d/%d procesadas, %d fallidas", progress.Status, progress.Processed, progress.Total, progress.Failed)
+}
@@ -0,0 +1,223 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"bob-hackathon/internal/agents"
+	"bob-hackathon/internal/models"
+	"bob-hackathon/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// concurrentScorer scoring stub seguro para goroutines: mide cuántas llamadas
+// corren a la vez y, con block, espera a que se cancele el contexto
+type concurrentScorer struct {
+	score     int
+	failFor   string
+	block     bool
+	delay     time.Duration
+	inFlight  atomic.Int32
+	maxFlight atomic.Int32
+	calls     atomic.Int32
+	started   chan struct{}
+}
+
+func (s *concurrentScorer) Name() string { return "concurrent_stub" }
+
+func (s *concurrentScorer) Process(ctx context.Context, input *agents.AgentInput) (*agents.AgentOutput, error) {
+	s.calls.Add(1)
+	n := s.inFlight.Add(1)
+	defer s.inFlight.Add(-1)
+	for {
+		max := s.maxFlight.Load()
+		if n <= max || s.maxFlight.CompareAndSwap(max, n) {
+			break
+		}
+	}
+	if s.started != nil {
+		select {
+		case s.started <- struct{}{}:
+		default:
+		}
+	}
+	if s.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	time.Sleep(s.delay)
+	if input.SessionID == s.failFor {
+		return nil, errors.New("scoring caído")
+	}
+	return &agents.AgentOutput{ScoringData: &models.ScoringData{TotalScore: s.score}}, nil
+}
+
+// seedRescoreSessions n sesiones con messages mensajes cada una
+func seedRescoreSessions(t *testing.T, prefix string, n, messages int) []*models.Session {
+	t.Helper()
+	svc := services.GetSessionService()
+	var sessions []*models.Session
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("%s-%d", prefix, i)
+		for j := 0; j < messages; j++ {
+			svc.AddMessageToSession(id, "web", "user", "quiero ofertar", nil)
+		}
+		sessions = append(sessions, svc.GetSnapshot(id))
+	}
+	return sessions
+}
+
+func TestRunRescore(t *testing.T) {
+	tests := []struct {
+		name        string
+		sessions    int
+		concurrency int
+		failFor     int // índice de la sesión que falla; -1 ninguna
+		wantFailed  int
+	}{
+		{"sequential", 3, 1, -1, 0},
+		{"bounded concurrency", 6, 2, -1, 0},
+		{"concurrency below one", 2, 0, -1, 0},
+		{"failure counted", 4, 3, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefix := "rescore-all-" + tt.name
+			sessions := seedRescoreSessions(t, prefix, tt.sessions, 1)
+			scorer := &concurrentScorer{score: 88, delay: 10 * time.Millisecond}
+			if tt.failFor >= 0 {
+				scorer.failFor = sessions[tt.failFor].SessionID
+			}
+			c := newStubChatController(&stubAgent{}, &stubAgent{}, &stubAgent{}, scorer)
+
+			// dos pasadas: volver a lanzarlo deja el mismo resultado
+			for pass := 0; pass < 2; pass++ {
+				ctx, cancel := context.WithCancel(context.Background())
+				job := &rescoreJob{progress: models.RescoreProgress{Status: "running", Total: len(sessions)}, cancel: cancel}
+				c.runRescore(ctx, job, sessions, tt.concurrency, 0)
+
+				progress := job.snapshot()
+				if progress.Status != "completed" || progress.Processed != tt.sessions || progress.Failed != tt.wantFailed || progress.FinishedAt == nil {
+					t.Fatalf("pass %d progress = %+v", pass, progress)
+				}
+				for i, s := range sessions {
+					lead := services.GetSessionService().GetLead(s.SessionID)
+					if i == tt.failFor {
+						if lead != nil {
+							t.Fatalf("failed session %s got a lead", s.SessionID)
+						}
+						continue
+					}
+					if lead == nil || lead.Score != 88 || lead.Category != "hot" {
+						t.Fatalf("pass %d lead %s = %+v", pass, s.SessionID, lead)
+					}
+				}
+			}
+
+			limit := int32(tt.concurrency)
+			if limit < 1 {
+				limit = 1
+			}
+			if max := scorer.maxFlight.Load(); max > limit {
+				t.Fatalf("max concurrent calls = %d, limit %d", max, limit)
+			}
+			if got := scorer.calls.Load(); got != int32(2*tt.sessions) {
+				t.Fatalf("calls = %d, want %d", got, 2*tt.sessions)
+			}
+		})
+	}
+}
+
+func TestRunRescoreRateLimited(t *testing.T) {
+	sessions := seedRescoreSessions(t, "rescore-rate", 3, 1)
+	c := newStubChatController(&stubAgent{}, &stubAgent{}, &stubAgent{}, &concurrentScorer{score: 50})
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &rescoreJob{progress: models.RescoreProgress{Status: "running", Total: len(sessions)}, cancel: cancel}
+
+	start := time.Now()
+	c.runRescore(ctx, job, sessions, 3, 30*time.Millisecond)
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Fatalf("3 sessions at 30ms interval took %v", elapsed)
+	}
+	if p := job.snapshot(); p.Processed != 3 {
+		t.Fatalf("progress = %+v", p)
+	}
+}
+
+func TestRunRescoreCancel(t *testing.T) {
+	sessions := seedRescoreSessions(t, "rescore-cancel", 4, 1)
+	scorer := &concurrentScorer{block: true, started: make(chan struct{}, 1)}
+	c := newStubChatController(&stubAgent{}, &stubAgent{}, &stubAgent{}, scorer)
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &rescoreJob{progress: models.RescoreProgress{Status: "running", Total: len(sessions)}, cancel: cancel}
+
+	done := make(chan struct{})
+	go func() {
+		c.runRescore(ctx, job, sessions, 1, 0)
+		close(done)
+	}()
+	<-scorer.started
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("runRescore did not stop after cancel")
+	}
+
+	progress := job.snapshot()
+	if progress.Status != "cancelled" || progress.Processed != 0 || progress.Failed != 0 {
+		t.Fatalf("progress = %+v", progress)
+	}
+	if got := scorer.calls.Load(); got != 1 {
+		t.Fatalf("calls after cancel = %d, want 1", got)
+	}
+}
+
+func TestRescoreAllEndpoints(t *testing.T) {
+	// con ScoringMinMessages = 6 solo entran las sesiones con historial suficiente
+	seedRescoreSessions(t, "rescore-endpoint", 2, 6)
+	scorer := &concurrentScorer{block: true, started: make(chan struct{}, 1)}
+	c := newStubChatController(&stubAgent{}, &stubAgent{}, &stubAgent{}, scorer)
+	r := gin.New()
+	r.POST("/api/admin/leads/rescore-all", c.RescoreAllLeads)
+	r.GET("/api/admin/leads/rescore-all", c.GetRescoreProgress)
+	r.DELETE("/api/admin/leads/rescore-all", c.CancelRescore)
+	const path = "/api/admin/leads/rescore-all"
+
+	steps := []struct {
+		method string
+		status int
+	}{
+		{http.MethodGet, http.StatusNotFound},
+		{http.MethodDelete, http.StatusNotFound},
+		{http.MethodPost, http.StatusAccepted},
+		{http.MethodPost, http.StatusConflict},
+		{http.MethodGet, http.StatusOK},
+		{http.MethodDelete, http.StatusOK},
+	}
+	for _, s := range steps {
+		if s.method == http.MethodGet && s.status == http.StatusOK {
+			<-scorer.started
+		}
+		if w := serve(r, s.method, path, ""); w.Code != s.status {
+			t.Fatalf("%s = %d %s, want %d", s.method, w.Code, w.Body.String(), s.status)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for c.rescore.snapshot().Status == "running" {
+		if time.Now().After(deadline) {
+			t.Fatal("job still running after cancel")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := c.rescore.snapshot().Status; got != "cancelled" {
+		t.Fatalf("status = %q", got)
+	}
+}
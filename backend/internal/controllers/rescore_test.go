@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"bob-hackathon/internal/agents"
+	"bob-hackathon/internal/models"
+	"bob-hackathon/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newRescoreRouter POST /api/leads/:sessionId/rescore con el scoring dado (sin AdminAuth)
+func newRescoreRouter(scoring agents.Agent) *gin.Engine {
+	c := newStubChatController(&stubAgent{}, &stubAgent{}, &stubAgent{}, scoring)
+	r := gin.New()
+	r.POST("/api/leads/:sessionId/rescore", c.RescoreLead)
+	return r
+}
+
+func TestRescoreLead(t *testing.T) {
+	scoring := &stubAgent{out: agents.AgentOutput{ScoringData: &models.ScoringData{
+		TotalScore:      90,
+		DimensionScores: map[string]int{"capacidad_financiera": 25, "necesidad_urgencia": 20},
+	}}}
+	r := newRescoreRouter(scoring)
+	svc := services.GetSessionService()
+	created := time.Date(2026, 1, 10, 9, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name      string
+		sessionID string
+		prevScore int // 0 = sin lead previo
+		query     string
+		wantScore int
+		smoothed  bool
+	}{
+		{"no previous lead", "rescore-new", 0, "", 90, false},
+		{"smoothed by default", "rescore-smooth", 60, "", 69, true},
+		{"smoothing bypassed", "rescore-raw", 60, "?smooth=false", 90, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// ID único por corrida: el SessionService es compartido entre tests
+			c.sessionID = fmt.Sprintf("%s-%d", c.sessionID, time.Now().UnixNano())
+			svc.AddMessageToSession(c.sessionID, "web", "user", "tengo 40 mil y compro este mes", nil)
+			session := svc.GetSnapshot(c.sessionID)
+			if c.prevScore > 0 {
+				svc.CreateOrUpdateLead(&models.Lead{SessionID: c.sessionID, Channel: "web", Score: c.prevScore, Category: "cold", Budget: "40k"})
+				svc.GetLead(c.sessionID).CreatedAt = created
+			}
+
+			w := serve(r, http.MethodPost, "/api/leads/"+c.sessionID+"/rescore"+c.query, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("POST = %d %s", w.Code, w.Body.String())
+			}
+			var resp struct {
+				Lead          models.Lead        `json:"lead"`
+				PreviousScore int                `json:"previousScore"`
+				RawScore      int                `json:"rawScore"`
+				Smoothed      bool               `json:"smoothed"`
+				Scoring       models.ScoringData `json:"scoring"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Lead.Score != c.wantScore || resp.RawScore != 90 || resp.Smoothed != c.smoothed || resp.PreviousScore != c.prevScore {
+				t.Fatalf("response = %+v", resp)
+			}
+			if resp.Scoring.DimensionScores["capacidad_financiera"] != 25 {
+				t.Fatalf("dimensions = %v", resp.Scoring.DimensionScores)
+			}
+
+			stored := svc.GetLead(c.sessionID)
+			if stored.Score != c.wantScore || stored.Category != categoryForScore(c.wantScore) || stored.Scoring == nil {
+				t.Fatalf("stored lead = %+v", stored)
+			}
+			if stored.LastMessage != "tengo 40 mil y compro este mes" {
+				t.Fatalf("last message = %q", stored.LastMessage)
+			}
+			if got := svc.GetSnapshot(c.sessionID); got.LeadScore != c.wantScore {
+				t.Fatalf("session score = %d", got.LeadScore)
+			}
+			if c.prevScore > 0 {
+				if !stored.CreatedAt.Equal(created) || stored.Budget != "40k" {
+					t.Fatalf("previous lead data lost: created %v budget %q", stored.CreatedAt, stored.Budget)
+				}
+			} else if stored.CreatedAt.IsZero() || stored.CreatedAt.Before(session.CreatedAt) {
+				t.Fatalf("created at = %v (session %v)", stored.CreatedAt, session.CreatedAt)
+			}
+		})
+	}
+}
+
+func TestRescoreLeadErrors(t *testing.T) {
+	services.GetSessionService().GetOrCreateSession("rescore-err", "web")
+	cases := []struct {
+		name    string
+		scoring *stubAgent
+		path    string
+		status  int
+	}{
+		{"unknown session", &stubAgent{}, "/api/leads/rescore-none/rescore", http.StatusNotFound},
+		{"bad smooth flag", &stubAgent{}, "/api/leads/rescore-err/rescore?smooth=quizas", http.StatusBadRequest},
+		{"no scoring data", &stubAgent{}, "/api/leads/rescore-err/rescore", http.StatusInternalServerError},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if w := serve(newRescoreRouter(c.scoring), http.MethodPost, c.path, ""); w.Code != c.status {
+				t.Fatalf("POST = %d %s, want %d", w.Code, w.Body.String(), c.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"fmt"
+	"testing"
+
+	"bob-hackathon/internal/agents"
+	"bob-hackathon/internal/config"
+	"bob-hackathon/internal/models"
+)
+
+func TestShouldScore(t *testing.T) {
+	cases := []struct {
+		count, min int
+		highIntent bool
+		want       bool
+	}{
+		{2, 6, false, false},
+		{5, 6, false, false},
+		{6, 6, false, true},
+		{2, 6, true, true},
+		{1, 0, false, true},
+		{3, 10, false, false},
+	}
+	for _, c := range cases {
+		if got := shouldScore(c.count, c.min, c.highIntent); got != c.want {
+			t.Errorf("shouldScore(%d, %d, %v) = %v, want %v", c.count, c.min, c.highIntent, got, c.want)
+		}
+	}
+}
+
+func TestSendMessageScoringTrigger(t *testing.T) {
+	prev := config.AppConfig.ScoringMinMessages
+	config.AppConfig.ScoringMinMessages = 6
+	defer func() { config.AppConfig.ScoringMinMessages = prev }()
+
+	cases := []struct {
+		name       string
+		message    string
+		highIntent bool
+		turns      int // mensajes del usuario enviados (2 mensajes en sesión por turno)
+		scored     bool
+	}{
+		{"below threshold", "hola", false, 1, false},
+		{"high intent scores early", "quiero ofertar", true, 1, true},
+		{"budget mention scores early", "tengo 30 mil soles", false, 1, true},
+		{"threshold reached", "ok", false, 3, true},
+	}
+	for i, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			orchestrator := &stubAgent{out: agents.AgentOutput{Response: "Entendido", IntentDetected: "general", Confidence: 0.9, HighIntent: c.highIntent}}
+			scoring := &stubAgent{out: agents.AgentOutput{ScoringData: &models.ScoringData{TotalScore: 70}}}
+			r := newChatRouter(newStubChatController(orchestrator, &stubAgent{}, &stubAgent{}, scoring))
+
+			var resp models.ChatResponse
+			for turn := 0; turn < c.turns; turn++ {
+				resp = postChat(t, r, fmt.Sprintf(`{"sessionId":"trigger-%d","message":%q,"channel":"web"}`, i, c.message))
+			}
+			if (scoring.calls > 0) != c.scored {
+				t.Fatalf("scoring calls = %d, want scored=%v", scoring.calls, c.scored)
+			}
+			if c.scored && (resp.LeadScore != 70 || resp.Category != "warm") {
+				t.Fatalf("response = score %d %q", resp.LeadScore, resp.Category)
+			}
+			if !c.scored && resp.Category != "cold" {
+				t.Fatalf("provisional category = %q", resp.Category)
+			}
+		})
+	}
+}
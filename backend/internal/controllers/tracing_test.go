@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"bob-hackathon/internal/agents"
+	"bob-hackathon/internal/llm"
+	"bob-hackathon/internal/middleware"
+	"bob-hackathon/internal/tracing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSendMessageSpanTree(t *testing.T) {
+	if _, err := tracing.Setup(context.Background(), "", "test"); err != nil {
+		t.Fatal(err)
+	}
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	orchestrator, err := agents.NewOrchestratorAgent(llm.NewMockProvider(
+		`{"intent":"faq","confidence":0.9,"shouldRoute":true,"routeTo":"faq_agent","response":""}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	faq, err := agents.NewFAQAgent(llm.NewMockProvider("Necesitas tu DNI para registrarte."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(middleware.Tracing())
+	r.POST("/api/chat/message", newStubChatController(orchestrator, faq, &stubAgent{}, &stubAgent{}).SendMessage)
+
+	// traceparent como lo envía whserver en el hop bot → backend
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	const botSpanID = "00f067aa0ba902b7"
+	req := httptest.NewRequest(http.MethodPost, "/api/chat/message",
+		strings.NewReader(`{"sessionId":"trace-1","message":"¿qué documentos necesito?","channel":"whatsapp"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", "00-"+traceID+"-"+botSpanID+"-01")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST = %d %s", w.Code, w.Body.String())
+	}
+
+	byName := map[string]tracetest.SpanStub{}
+	for _, s := range exporter.GetSpans() {
+		byName[s.Name] = s
+		if got := s.SpanContext.TraceID().String(); got != traceID {
+			t.Fatalf("span %s in trace %s, want %s", s.Name, got, traceID)
+		}
+	}
+	parentOf := map[string]string{
+		"HTTP POST /api/chat/message": botSpanID,
+		"ChatController.SendMessage":  byName["HTTP POST /api/chat/message"].SpanContext.SpanID().String(),
+		"agent.Orchestrator":          byName["ChatController.SendMessage"].SpanContext.SpanID().String(),
+		"agent.FAQ_Agent":             byName["ChatController.SendMessage"].SpanContext.SpanID().String(),
+	}
+	for name, want := range parentOf {
+		s, ok := byName[name]
+		if !ok {
+			t.Fatalf("missing span %q (got %d spans)", name, len(byName))
+		}
+		if got := s.Parent.SpanID().String(); got != want {
+			t.Errorf("%s parent = %s, want %s", name, got, want)
+		}
+	}
+	if _, ok := byName["agent.Auction_Agent"]; ok {
+		t.Error("auction agent span recorded for a FAQ route")
+	}
+}
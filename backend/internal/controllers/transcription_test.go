@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"bob-hackathon/internal/agents"
+	"bob-hackathon/internal/services"
+)
+
+// stubTranscriber STT fijo: devuelve text (o err) y guarda el audio recibido
+type stubTranscriber struct {
+	text     string
+	err      error
+	mimeType string
+	audio    []byte
+}
+
+func (s *stubTranscriber) Transcribe(_ context.Context, mimeType string, audio []byte) (string, error) {
+	s.mimeType, s.audio = mimeType, audio
+	return s.text, s.err
+}
+
+// testOgg cabecera Ogg: se detecta como audio/ogg (nota de voz de WhatsApp)
+var testOgg = []byte("OggS\x00\x02 opus nota de voz")
+
+func voiceNoteBody(sessionID, message string) string {
+	return `{"sessionId":"` + sessionID + `","message":"` + message + `","channel":"whatsapp","media":{"data":"` +
+		base64.StdEncoding.EncodeToString(testOgg) + `","mimeType":"audio/ogg; codecs=opus"}}`
+}
+
+func TestSendMessageVoiceNoteTranscribed(t *testing.T) {
+	const transcript = "quiero ofertar por la hilux del sábado"
+	stt := &stubTranscriber{text: transcript}
+	orchestrator := &stubAgent{out: agents.AgentOutput{Response: "¡Claro! Te ayudo a registrarte."}}
+	c := newStubChatController(orchestrator, &stubAgent{}, &stubAgent{}, &stubAgent{})
+	c.transcriber = stt
+	r := newChatRouter(c)
+
+	if w := serve(r, http.MethodPost, "/api/chat/message", voiceNoteBody("voice-1", "")); w.Code != http.StatusOK {
+		t.Fatalf("POST = %d %s", w.Code, w.Body.String())
+	}
+	if stt.mimeType != "audio/ogg" || string(stt.audio) != string(testOgg) {
+		t.Fatalf("transcriber got %s (%d bytes)", stt.mimeType, len(stt.audio))
+	}
+
+	// el texto transcrito es el contenido del mensaje y lo que ven los agentes (sin el audio)
+	msgs := services.GetSessionService().GetMessages("voice-1")
+	if len(msgs) == 0 || msgs[0].Content != transcript {
+		t.Fatalf("session messages = %+v", msgs)
+	}
+	if ref := msgs[0].Media; ref == nil || !ref.Transcribed || ref.MimeType != "audio/ogg" {
+		t.Fatalf("media ref = %+v", ref)
+	}
+	if in := orchestrator.last; in == nil || in.Message != transcript || in.Media != nil {
+		t.Fatalf("orchestrator input = %+v", in)
+	}
+}
+
+func TestSendMessageVoiceNoteKeepsCaption(t *testing.T) {
+	stt := &stubTranscriber{text: "la roja de la foto"}
+	c := newStubChatController(&stubAgent{out: agents.AgentOutput{Response: "ok"}}, &stubAgent{}, &stubAgent{}, &stubAgent{})
+	c.transcriber = stt
+	r := newChatRouter(c)
+
+	if w := serve(r, http.MethodPost, "/api/chat/message", voiceNoteBody("voice-2", "mira")); w.Code != http.StatusOK {
+		t.Fatalf("POST = %d %s", w.Code, w.Body.String())
+	}
+	if msgs := services.GetSessionService().GetMessages("voice-2"); len(msgs) == 0 || msgs[0].Content != "mira\nla roja de la foto" {
+		t.Fatalf("session messages = %+v", msgs)
+	}
+}
+
+func TestSendMessageVoiceNoteTranscriptionFails(t *testing.T) {
+	orchestrator := &stubAgent{out: agents.AgentOutput{Response: "hola"}}
+	c := newStubChatController(orchestrator, &stubAgent{}, &stubAgent{}, &stubAgent{})
+	c.transcriber = &stubTranscriber{err: errors.New("stt caído")}
+	r := newChatRouter(c)
+
+	w := serve(r, http.MethodPost, "/api/chat/message", voiceNoteBody("voice-3", ""))
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("POST = %d, want 502", w.Code)
+	}
+	if orchestrator.calls != 0 || len(services.GetSessionService().GetMessages("voice-3")) != 0 {
+		t.Fatal("failed transcription reached the session or the agents")
+	}
+}
+
+func TestTranscribeEndpoint(t *testing.T) {
+	c := newStubChatController(&stubAgent{}, &stubAgent{}, &stubAgent{}, &stubAgent{})
+	c.transcriber = &stubTranscriber{text: "hola, ¿sigue disponible?"}
+	r := newChatRouter(c)
+	r.POST("/api/chat/transcribe", c.Transcribe)
+
+	body := `{"media":{"data":"` + base64.StdEncoding.EncodeToString(testOgg) + `"}}`
+	w := serve(r, http.MethodPost, "/api/chat/transcribe", body)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "hola, ¿sigue disponible?") {
+		t.Fatalf("POST = %d %s", w.Code, w.Body.String())
+	}
+	image := `{"media":{"data":"` + base64.StdEncoding.EncodeToString(testPNG) + `"}}`
+	if w := serve(r, http.MethodPost, "/api/chat/transcribe", image); w.Code != http.StatusBadRequest {
+		t.Fatalf("image = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseVehicleSearchParams(t *testing.T) {
+	cases := []struct {
+		query   string
+		want    vehicleSearchParams
+		wantErr bool
+	}{
+		{query: "", want: vehicleSearchParams{Limit: 10}},
+		{
+			query: "marca=+Toyota+&modelo=hilux&precioMin=1000&precioMax=50000.5&tipo=online&yearMin=2018&yearMax=2022&estado=disponible&limit=5",
+			want:  vehicleSearchParams{Marca: "Toyota", Modelo: "hilux", PrecioMin: 1000, PrecioMax: 50000.5, Tipo: "online", YearMin: 2018, YearMax: 2022, Estado: "disponible", Limit: 5},
+		},
+		{query: "limit=500", want: vehicleSearchParams{Limit: maxVehicleSearchLimit}},
+		{query: "precioMin=100&precioMax=0", want: vehicleSearchParams{PrecioMin: 100, Limit: 10}}, // 0 = sin máximo
+		{query: "precioMin=abc", wantErr: true},
+		{query: "precioMax=-1", wantErr: true},
+		{query: "precioMin=500&precioMax=100", wantErr: true},
+		{query: "yearMin=2020.5", wantErr: true},
+		{query: "yearMin=2022&yearMax=2020", wantErr: true},
+		{query: "limit=0", wantErr: true},
+		{query: "limit=diez", wantErr: true},
+		{query: "limit=-3", wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			ctx.Request = httptest.NewRequest(http.MethodGet, "/api/vehicles/search?"+c.query, nil)
+			got, err := parseVehicleSearchParams(ctx)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, c.wantErr)
+			}
+			if err == nil && *got != c.want {
+				t.Fatalf("params = %+v, want %+v", *got, c.want)
+			}
+		})
+	}
+}
+
+func TestSearchVehiclesRejectsInvalidParams(t *testing.T) {
+	l := NewLeadController()
+	r := gin.New()
+	r.GET("/api/vehicles/search", l.SearchVehicles)
+	for _, q := range []string{"precioMin=x", "yearMax=dosmil", "limit=0", "precioMin=9&precioMax=1"} {
+		if w := serve(r, http.MethodGet, "/api/vehicles/search?"+q, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s = %d %s, want 400", q, w.Code, w.Body.String())
+		}
+	}
+}
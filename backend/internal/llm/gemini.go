@@ -0,0 +1,110 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// GeminiProvider Provider sobre google/generative-ai-go; un solo cliente compartido por
+// todos los agentes (cada llamada arma un GenerativeModel liviano con sus Options)
+type GeminiProvider struct {
+	client *genai.Client
+	model  string
+}
+
+func NewGeminiProvider(ctx context.Context, apiKey, model string) (*GeminiProvider, error) {
+	if apiKey == "" {
+		return nil, errors.New("GEMINI_API_KEY no configurado")
+	}
+	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+	if err != nil {
+		return nil, err
+	}
+	return &GeminiProvider{client: client, model: model}, nil
+}
+
+func (g *GeminiProvider) Name() string {
+	return "gemini"
+}
+
+func (g *GeminiProvider) Generate(ctx context.Context, prompt []Part, opts Options) (string, error) {
+	resp, err := g.generativeModel(opts).GenerateContent(ctx, geminiParts(prompt)...)
+	if err != nil {
+		return "", err
+	}
+	text := geminiText(resp)
+	if text == "" {
+		return "", ErrNoResponse
+	}
+	return text, nil
+}
+
+func (g *GeminiProvider) GenerateStream(ctx context.Context, prompt []Part, opts Options, onChunk func(string) error) (string, error) {
+	iter := g.generativeModel(opts).GenerateContentStream(ctx, geminiParts(prompt)...)
+	var full strings.Builder
+	for {
+		resp, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return full.String(), err
+		}
+		chunk := geminiText(resp)
+		if chunk == "" {
+			continue
+		}
+		full.WriteString(chunk)
+		if err := onChunk(chunk); err != nil {
+			return full.String(), err
+		}
+	}
+	if full.Len() == 0 {
+		return "", ErrNoResponse
+	}
+	return full.String(), nil
+}
+
+// Close cierra el cliente compartido
+func (g *GeminiProvider) Close() error {
+	return g.client.Close()
+}
+
+func (g *GeminiProvider) generativeModel(opts Options) *genai.GenerativeModel {
+	model := g.client.GenerativeModel(g.model)
+	model.SetTemperature(opts.Temperature)
+	model.SetTopP(opts.TopP)
+	model.SetTopK(opts.TopK)
+	return model
+}
+
+func geminiParts(prompt []Part) []genai.Part {
+	parts := make([]genai.Part, 0, len(prompt))
+	for _, p := range prompt {
+		if p.IsBlob() {
+			parts = append(parts, genai.Blob{MIMEType: p.MimeType, Data: p.Data})
+		} else {
+			parts = append(parts, genai.Text(p.Text))
+		}
+	}
+	return parts
+}
+
+// geminiText texto del primer candidato ("" si no hay)
+func geminiText(resp *genai.GenerateContentResponse) string {
+	if resp == nil || len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return ""
+	}
+	var sb strings.Builder
+	for _, part := range resp.Candidates[0].Content.Parts {
+		if t, ok := part.(genai.Text); ok {
+			sb.WriteString(string(t))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,76 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// mockDefaultReply respuesta de LLM_PROVIDER=mock sin respuestas programadas
+const mockDefaultReply = `{"intent":"ambiguo","confidence":0.5,"shouldRoute":false,"response":"Respuesta de prueba (LLM_PROVIDER=mock)."}`
+
+// MockProvider Provider en memoria para desarrollo sin API key y para probar agentes:
+// devuelve las respuestas programadas en orden (la última se repite) y guarda los prompts.
+type MockProvider struct {
+	mu        sync.Mutex
+	responses []string
+	err       error
+	calls     [][]Part
+}
+
+func NewMockProvider(responses ...string) *MockProvider {
+	return &MockProvider{responses: responses}
+}
+
+// FailWith hace que las próximas llamadas devuelvan err (nil = volver a responder)
+func (m *MockProvider) FailWith(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+// Calls prompts recibidos, en orden
+func (m *MockProvider) Calls() [][]Part {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([][]Part(nil), m.calls...)
+}
+
+func (m *MockProvider) Name() string {
+	return "mock"
+}
+
+func (m *MockProvider) Generate(ctx context.Context, prompt []Part, opts Options) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, append([]Part(nil), prompt...))
+	if m.err != nil {
+		return "", m.err
+	}
+	switch len(m.responses) {
+	case 0:
+		return mockDefaultReply, nil
+	case 1:
+		return m.responses[0], nil
+	}
+	reply := m.responses[0]
+	m.responses = m.responses[1:]
+	return reply, nil
+}
+
+// GenerateStream entrega la respuesta de Generate palabra por palabra
+func (m *MockProvider) GenerateStream(ctx context.Context, prompt []Part, opts Options, onChunk func(string) error) (string, error) {
+	reply, err := m.Generate(ctx, prompt, opts)
+	if err != nil {
+		return "", err
+	}
+	for _, chunk := range strings.SplitAfter(reply, " ") {
+		if err := onChunk(chunk); err != nil {
+			return "", err
+		}
+	}
+	return reply, nil
+}
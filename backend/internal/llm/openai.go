@@ -0,0 +1,158 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAIProvider Provider sobre /chat/completions de cualquier API compatible con OpenAI
+// (OpenAI, Ollama, vLLM, LM Studio...). Acepta texto e imágenes; audio y PDF no.
+type OpenAIProvider struct {
+	baseURL    string
+	apiKey     string // vacío = sin Authorization (modelos locales)
+	model      string
+	httpClient *http.Client
+}
+
+func NewOpenAIProvider(baseURL, apiKey, model string) (*OpenAIProvider, error) {
+	if baseURL == "" || model == "" {
+		return nil, errors.New("LLM_BASE_URL y LLM_MODEL son obligatorios con LLM_PROVIDER=openai")
+	}
+	return &OpenAIProvider{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		model:   model,
+		httpClient: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+	}, nil
+}
+
+func (o *OpenAIProvider) Name() string {
+	return "openai"
+}
+
+func (o *OpenAIProvider) Generate(ctx context.Context, prompt []Part, opts Options) (string, error) {
+	resp, err := o.post(ctx, prompt, opts, false)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("respuesta inválida de %s: %w", o.baseURL, err)
+	}
+	if len(out.Choices) == 0 || out.Choices[0].Message.Content == "" {
+		return "", ErrNoResponse
+	}
+	return out.Choices[0].Message.Content, nil
+}
+
+// GenerateStream lee los eventos SSE ("data: {...}" hasta "data: [DONE]")
+func (o *OpenAIProvider) GenerateStream(ctx context.Context, prompt []Part, opts Options, onChunk func(string) error) (string, error) {
+	resp, err := o.post(ctx, prompt, opts, true)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var full strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+		var event struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return full.String(), fmt.Errorf("evento inválido de %s: %w", o.baseURL, err)
+		}
+		if len(event.Choices) == 0 || event.Choices[0].Delta.Content == "" {
+			continue
+		}
+		chunk := event.Choices[0].Delta.Content
+		full.WriteString(chunk)
+		if err := onChunk(chunk); err != nil {
+			return full.String(), err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return full.String(), err
+	}
+	if full.Len() == 0 {
+		return "", ErrNoResponse
+	}
+	return full.String(), nil
+}
+
+// post arma el request de chat completions (un solo mensaje "user" con todas las partes)
+func (o *OpenAIProvider) post(ctx context.Context, prompt []Part, opts Options, stream bool) (*http.Response, error) {
+	content := make([]map[string]any, 0, len(prompt))
+	for _, p := range prompt {
+		switch {
+		case !p.IsBlob():
+			content = append(content, map[string]any{"type": "text", "text": p.Text})
+		case strings.HasPrefix(p.MimeType, "image/"):
+			dataURL := "data:" + p.MimeType + ";base64," + base64.StdEncoding.EncodeToString(p.Data)
+			content = append(content, map[string]any{"type": "image_url", "image_url": map[string]string{"url": dataURL}})
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedMedia, p.MimeType)
+		}
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"model":       o.model,
+		"messages":    []map[string]any{{"role": "user", "content": content}},
+		"temperature": opts.Temperature,
+		"top_p":       opts.TopP,
+		"stream":      stream,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("%s devolvió status %d: %s", o.baseURL, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
@@ -0,0 +1,78 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Provider modelo de lenguaje detrás de los agentes y de GeminiService. Los agentes solo
+// arman el prompt y parsean el texto; cambiar de proveedor (LLM_PROVIDER) no los toca.
+type Provider interface {
+	// Name identifica al proveedor en logs ("gemini", "openai", "mock")
+	Name() string
+	// Generate devuelve la respuesta completa al prompt
+	Generate(ctx context.Context, prompt []Part, opts Options) (string, error)
+	// GenerateStream llama onChunk con cada fragmento a medida que llega y devuelve el texto
+	// completo; si onChunk devuelve error se corta la generación con ese error
+	GenerateStream(ctx context.Context, prompt []Part, opts Options, onChunk func(string) error) (string, error)
+}
+
+// Part fragmento del prompt: texto, o un archivo inline (imagen, audio, PDF) si MimeType != ""
+type Part struct {
+	Text     string
+	MimeType string
+	Data     []byte
+}
+
+// Text parte de texto
+func Text(s string) Part {
+	return Part{Text: s}
+}
+
+// Blob parte binaria (llamada multimodal)
+func Blob(mimeType string, data []byte) Part {
+	return Part{MimeType: mimeType, Data: data}
+}
+
+// IsBlob true si la parte es un archivo y no texto
+func (p Part) IsBlob() bool {
+	return p.MimeType != ""
+}
+
+// Options parámetros de muestreo de una llamada (mismos campos que config.GenerationConfig,
+// se convierte con llm.Options(cfg)). Se envían tal cual: temperatura 0 = determinístico.
+type Options struct {
+	Temperature float32
+	TopP        float32
+	TopK        int32
+}
+
+// ErrNoResponse el modelo respondió sin texto (bloqueo de seguridad, audio sin voz, ...)
+var ErrNoResponse = errors.New("no se recibió respuesta del modelo")
+
+// ErrUnsupportedMedia el proveedor no acepta ese tipo de archivo en el prompt
+var ErrUnsupportedMedia = errors.New("el proveedor no admite este tipo de archivo")
+
+// Config selección del proveedor (ver LLM_PROVIDER en config)
+type Config struct {
+	Provider string // gemini (por defecto) | openai | mock
+	Model    string
+	APIKey   string
+	BaseURL  string // openai: API compatible (OpenAI, Ollama, vLLM, LM Studio...)
+}
+
+// New crea el proveedor configurado
+func New(ctx context.Context, cfg Config) (Provider, error) {
+	switch strings.ToLower(strings.TrimSpace(cfg.Provider)) {
+	case "", "gemini":
+		return NewGeminiProvider(ctx, cfg.APIKey, cfg.Model)
+	case "openai":
+		return NewOpenAIProvider(cfg.BaseURL, cfg.APIKey, cfg.Model)
+	case "mock":
+		return NewMockProvider(), nil
+	default:
+		return nil, fmt.Errorf("LLM_PROVIDER desconocido: %q (gemini|openai|mock)", cfg.Provider)
+	}
+}
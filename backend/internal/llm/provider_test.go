@@ -0,0 +1,137 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewSelectsProvider(t *testing.T) {
+	cases := []struct {
+		cfg     Config
+		name    string
+		wantErr bool
+	}{
+		{Config{Provider: " Mock "}, "mock", false},
+		{Config{Provider: "openai", BaseURL: "http://localhost:11434/v1", Model: "llama3"}, "openai", false},
+		{Config{Provider: "openai", Model: "llama3"}, "", true}, // sin LLM_BASE_URL
+		{Config{Provider: "claude"}, "", true},
+	}
+	for _, c := range cases {
+		p, err := New(context.Background(), c.cfg)
+		if (err != nil) != c.wantErr {
+			t.Fatalf("New(%+v) err = %v", c.cfg, err)
+		}
+		if err == nil && p.Name() != c.name {
+			t.Fatalf("New(%+v) = %s, want %s", c.cfg, p.Name(), c.name)
+		}
+	}
+}
+
+func TestMockProviderResponsesInOrder(t *testing.T) {
+	m := NewMockProvider("uno", "dos")
+	for _, want := range []string{"uno", "dos", "dos"} {
+		if got, err := m.Generate(context.Background(), []Part{Text("hola")}, Options{}); err != nil || got != want {
+			t.Fatalf("Generate = %q, %v; want %q", got, err, want)
+		}
+	}
+
+	var chunks []string
+	full, err := NewMockProvider("respuesta en partes").GenerateStream(context.Background(), nil, Options{}, func(c string) error {
+		chunks = append(chunks, c)
+		return nil
+	})
+	if err != nil || full != "respuesta en partes" || strings.Join(chunks, "") != full || len(chunks) != 3 {
+		t.Fatalf("stream = %q %q, %v", full, chunks, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.Generate(ctx, nil, Options{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceled ctx = %v", err)
+	}
+}
+
+func TestOpenAIProvider(t *testing.T) {
+	var got struct {
+		Model    string `json:"model"`
+		Stream   bool   `json:"stream"`
+		Messages []struct {
+			Content []map[string]any `json:"content"`
+		} `json:"messages"`
+	}
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		if got.Stream {
+			io.WriteString(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Ho\"}}]}\n\n")
+			io.WriteString(w, "data: {\"choices\":[{\"delta\":{\"content\":\"la\"}}]}\n\n")
+			io.WriteString(w, "data: [DONE]\n\n")
+			return
+		}
+		io.WriteString(w, `{"choices":[{"message":{"content":"Hola desde el modelo local"}}]}`)
+	}))
+	defer srv.Close()
+
+	p, err := NewOpenAIProvider(srv.URL+"/v1/", "sk-test", "llama3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := p.Generate(context.Background(), []Part{Text("hola"), Blob("image/png", []byte("png"))}, Options{Temperature: 0.2})
+	if err != nil || text != "Hola desde el modelo local" {
+		t.Fatalf("Generate = %q, %v", text, err)
+	}
+	if got.Model != "llama3" || auth != "Bearer sk-test" || len(got.Messages) != 1 || len(got.Messages[0].Content) != 2 {
+		t.Fatalf("request = %+v auth %q", got, auth)
+	}
+	if got.Messages[0].Content[1]["type"] != "image_url" {
+		t.Fatalf("image part = %v", got.Messages[0].Content[1])
+	}
+
+	var chunks []string
+	full, err := p.GenerateStream(context.Background(), []Part{Text("hola")}, Options{}, func(c string) error {
+		chunks = append(chunks, c)
+		return nil
+	})
+	if err != nil || full != "Hola" || len(chunks) != 2 {
+		t.Fatalf("GenerateStream = %q %q, %v", full, chunks, err)
+	}
+
+	// audio/PDF no entran en chat completions
+	if _, err := p.Generate(context.Background(), []Part{Blob("audio/ogg", []byte("ogg"))}, Options{}); !errors.Is(err, ErrUnsupportedMedia) {
+		t.Fatalf("audio part = %v, want ErrUnsupportedMedia", err)
+	}
+}
+
+func TestOpenAIProviderErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			t.Error("local model got an Authorization header")
+		}
+		if strings.Contains(r.URL.Path, "empty") {
+			io.WriteString(w, `{"choices":[]}`)
+			return
+		}
+		http.Error(w, "model not loaded", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	down, _ := NewOpenAIProvider(srv.URL, "", "llama3")
+	if _, err := down.Generate(context.Background(), []Part{Text("hola")}, Options{}); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("503 = %v", err)
+	}
+	empty, _ := NewOpenAIProvider(srv.URL+"/empty", "", "llama3")
+	if _, err := empty.Generate(context.Background(), []Part{Text("hola")}, Options{}); !errors.Is(err, ErrNoResponse) {
+		t.Fatalf("empty choices = %v, want ErrNoResponse", err)
+	}
+}
@@ -0,0 +1,82 @@
+// Package metrics expone métricas Prometheus del backend en GET /metrics
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry propio (no el global) para no mezclar métricas de dependencias
+var Registry = prometheus.NewRegistry()
+
+var (
+	// GeminiCallDuration duración de cada llamada a Gemini por agente y resultado
+	GeminiCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "bob_gemini_call_duration_seconds",
+		Help:    "Duración de las llamadas a Gemini por agente.",
+		Buckets: []float64{0.25, 0.5, 1, 2, 4, 8, 15, 30},
+	}, []string{"agent", "status"})
+
+	// ScoringDuration duración completa del scoring de un lead (prompt + Gemini + parseo)
+	ScoringDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "bob_scoring_duration_seconds",
+		Help:    "Duración del scoring de leads.",
+		Buckets: []float64{0.25, 0.5, 1, 2, 4, 8, 15, 30},
+	}, []string{"status"})
+
+	// ChatMessages mensajes procesados por /api/chat/message por canal
+	ChatMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "bob_chat_messages_total",
+		Help: "Mensajes de chat procesados por canal.",
+	}, []string{"channel"})
+
+	// FAQCacheLookups consultas al cache de respuestas del FAQAgent (hit/miss)
+	FAQCacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "bob_faq_cache_lookups_total",
+		Help: "Consultas al cache de respuestas de FAQ por resultado.",
+	}, []string{"result"})
+
+	// IntentShortcuts mensajes resueltos por una regla rápida sin llamar al orquestador
+	IntentShortcuts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "bob_intent_shortcuts_total",
+		Help: "Mensajes resueltos por reglas de intención sin orquestador LLM, por regla.",
+	}, []string{"rule"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		GeminiCallDuration,
+		ScoringDuration,
+		ChatMessages,
+		FAQCacheLookups,
+		IntentShortcuts,
+	)
+}
+
+// Handler handler de /metrics sobre Registry
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveGemini registra una llamada a Gemini iniciada en start
+func ObserveGemini(agent string, start time.Time, err error) {
+	GeminiCallDuration.WithLabelValues(agent, status(err)).Observe(time.Since(start).Seconds())
+}
+
+// ObserveScoring registra un scoring iniciado en start
+func ObserveScoring(start time.Time, err error) {
+	ScoringDuration.WithLabelValues(status(err)).Observe(time.Since(start).Seconds())
+}
+
+func status(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sample valor actual de la serie name con esos labels (counter) o su
+// número de observaciones (histogram); -1 si la serie no existe
+func sample(t *testing.T, name string, labels map[string]string) float64 {
+	t.Helper()
+	families, err := Registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, mf := range families {
+		if mf.GetName() != name {
+			continue
+		}
+	metric:
+		for _, m := range mf.GetMetric() {
+			got := map[string]string{}
+			for _, lp := range m.GetLabel() {
+				got[lp.GetName()] = lp.GetValue()
+			}
+			for k, v := range labels {
+				if got[k] != v {
+					continue metric
+				}
+			}
+			if m.GetCounter() != nil {
+				return m.GetCounter().GetValue()
+			}
+			if m.GetHistogram() != nil {
+				return float64(m.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	return -1
+}
+
+func TestObserveGeminiAndScoring(t *testing.T) {
+	failed := map[string]string{"agent": "test_agent", "status": "error"}
+	ok := map[string]string{"status": "ok"}
+
+	if got := sample(t, "bob_gemini_call_duration_seconds", failed); got != -1 {
+		t.Fatalf("series exists before first observation: %v", got)
+	}
+	ObserveGemini("test_agent", time.Now(), errors.New("quota"))
+	if got := sample(t, "bob_gemini_call_duration_seconds", failed); got != 1 {
+		t.Fatalf("gemini error observations = %v, want 1", got)
+	}
+	ObserveGemini("test_agent", time.Now(), errors.New("quota"))
+	if got := sample(t, "bob_gemini_call_duration_seconds", failed); got != 2 {
+		t.Fatalf("gemini error observations = %v, want 2", got)
+	}
+
+	ScoringDuration.With(ok)
+	before := sample(t, "bob_scoring_duration_seconds", ok)
+	ObserveScoring(time.Now(), nil)
+	if got := sample(t, "bob_scoring_duration_seconds", ok); got != before+1 {
+		t.Fatalf("scoring observations = %v, want %v", got, before+1)
+	}
+}
+
+func TestChatMessagesIncrement(t *testing.T) {
+	labels := map[string]string{"channel": "test"}
+	ChatMessages.With(labels)
+	before := sample(t, "bob_chat_messages_total", labels)
+	ChatMessages.WithLabelValues("test").Inc()
+	ChatMessages.WithLabelValues("test").Inc()
+	if got := sample(t, "bob_chat_messages_total", labels); got != before+2 {
+		t.Fatalf("bob_chat_messages_total = %v, want %v", got, before+2)
+	}
+}
+
+func TestHandlerExposesMetricNames(t *testing.T) {
+	ObserveGemini("faq", time.Now(), nil)
+	ObserveScoring(time.Now(), errors.New("parse"))
+	ChatMessages.WithLabelValues("web").Inc()
+	FAQCacheLookups.WithLabelValues("hit").Inc()
+	IntentShortcuts.WithLabelValues("greeting").Inc()
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != 200 {
+		t.Fatalf("GET /metrics status = %d", rec.Code)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	for _, name := range []string{
+		`bob_gemini_call_duration_seconds_count{agent="faq",status="ok"}`,
+		`bob_scoring_duration_seconds_count{status="error"}`,
+		`bob_chat_messages_total{channel="web"}`,
+		`bob_faq_cache_lookups_total{result="hit"}`,
+		`bob_intent_shortcuts_total{rule="greeting"}`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(string(body), name) {
+			t.Errorf("/metrics missing %s", name)
+		}
+	}
+}
@@ -2,14 +2,76 @@ package middleware
 
 import (
 	"bob-hackathon/internal/config"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-// AdminAuth middleware para proteger endpoints administrativos
+// Scopes de las keys de admin: write incluye read
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// adminKey key de admin válida, guardada como hash para compararla en tiempo constante
+type adminKey struct {
+	hash  [sha256.Size]byte
+	id    string // huella corta para los logs de auditoría (nunca la key)
+	scope string
+}
+
+// newAdminKeys arma las keys a partir de un mapa scope → keys
+func newAdminKeys(keysByScope map[string][]string) []adminKey {
+	var out []adminKey
+	for scope, keys := range keysByScope {
+		for _, key := range keys {
+			hash := sha256.Sum256([]byte(key))
+			out = append(out, adminKey{hash: hash, id: hex.EncodeToString(hash[:4]), scope: scope})
+		}
+	}
+	return out
+}
+
+// requiredScope GET/HEAD solo leen; cualquier otro método modifica y exige write
+func requiredScope(method string) string {
+	if method == http.MethodGet || method == http.MethodHead {
+		return ScopeRead
+	}
+	return ScopeWrite
+}
+
+func (k *adminKey) allows(scope string) bool {
+	return k.scope == ScopeWrite || k.scope == scope
+}
+
+// matchAdminKey devuelve la key que coincide con la recibida (nil si ninguna).
+// Compara hashes de largo fijo con subtle.ConstantTimeCompare y recorre todas las
+// keys sin cortar al encontrarla, para no filtrar por tiempo ni largo ni posición.
+func matchAdminKey(provided string, keys []adminKey) *adminKey {
+	hash := sha256.Sum256([]byte(provided))
+	var match *adminKey
+	for i := range keys {
+		if subtle.ConstantTimeCompare(hash[:], keys[i].hash[:]) == 1 {
+			match = &keys[i]
+		}
+	}
+	return match
+}
+
+// AdminAuth middleware para proteger endpoints administrativos. Acepta cualquiera de
+// las keys de ADMIN_API_KEY (separadas por comas) para poder rotarlas con solapamiento.
+// Las keys de ADMIN_READ_API_KEY solo pueden usar GET (descargar FAQs, ver prompts).
 func AdminAuth() gin.HandlerFunc {
+	keys := newAdminKeys(map[string][]string{
+		ScopeWrite: config.AppConfig.AdminAPIKeys,
+		ScopeRead:  config.AppConfig.AdminReadKeys,
+	})
+
 	return func(c *gin.Context) {
 		// Soportar dos formatos de autenticación:
 		// 1. Header: X-Admin-Key: tu_key
@@ -35,7 +97,9 @@ func AdminAuth() gin.HandlerFunc {
 		}
 
 		// Verificar que la key es correcta
-		if apiKey != config.AppConfig.AdminAPIKey {
+		key := matchAdminKey(apiKey, keys)
+		if key == nil {
+			log.Printf("🔐 Admin key inválida: %s %s desde %s", c.Request.Method, c.Request.URL.Path, c.ClientIP())
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error": "Invalid admin API key",
 			})
@@ -43,7 +107,19 @@ func AdminAuth() gin.HandlerFunc {
 			return
 		}
 
+		// Verificar que la key alcanza para la operación
+		if scope := requiredScope(c.Request.Method); !key.allows(scope) {
+			log.Printf("🔐 Admin key %s (%s) sin permiso para %s %s", key.id, key.scope, c.Request.Method, c.Request.URL.Path)
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Admin API key is read-only",
+			})
+			c.Abort()
+			return
+		}
+
 		// Key válida, continuar
+		log.Printf("🔐 Admin %s %s con key %s (%s)", c.Request.Method, c.Request.URL.Path, key.id, key.scope)
+		c.Set("admin_key_id", key.id)
 		c.Next()
 	}
 }
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/cors"
+)
+
+// originMatcher orígenes permitidos: exactos y patrones de subdominio
+type originMatcher struct {
+	exact    map[string]bool
+	suffixes []originSuffix
+}
+
+// originSuffix patrón "https://*.somosbob.com" → scheme "https", suffix ".somosbob.com"
+type originSuffix struct {
+	scheme string
+	suffix string
+}
+
+func (m *originMatcher) allow(origin string) bool {
+	origin = normalizeOrigin(origin)
+	if m.exact[origin] {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	for _, s := range m.suffixes {
+		if u.Scheme == s.scheme && strings.HasSuffix(u.Host, s.suffix) && len(u.Host) > len(s.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// CORSConfig arma la configuración de CORS a partir de CORS_ORIGINS (separado por comas).
+// Acepta orígenes exactos ("https://bob.pe"), subdominios ("https://*.somosbob.com") y
+// "*" solo si no se envían credenciales. Devuelve error ante cualquier entrada inválida
+// para que el servidor no arranque con una configuración insegura.
+func CORSConfig(rawOrigins string, allowCredentials bool) (cors.Config, error) {
+	cfg := cors.Config{
+		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", RequestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", RequestIDHeader},
+		AllowCredentials: allowCredentials,
+		MaxAge:           12 * time.Hour,
+	}
+
+	matcher := &originMatcher{exact: make(map[string]bool)}
+	for _, entry := range strings.Split(rawOrigins, ",") {
+		origin := normalizeOrigin(entry)
+		if origin == "" {
+			continue
+		}
+
+		if origin == "*" {
+			if allowCredentials {
+				return cors.Config{}, errors.New(`"*" no se puede usar con credenciales (CORS_ALLOW_CREDENTIALS=true)`)
+			}
+			cfg.AllowAllOrigins = true
+			continue
+		}
+
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+			return cors.Config{}, fmt.Errorf("origen inválido %q: se espera scheme://host[:puerto]", entry)
+		}
+
+		if strings.Contains(u.Host, "*") {
+			rest, ok := strings.CutPrefix(u.Host, "*.")
+			if !ok || rest == "" || strings.Contains(rest, "*") {
+				return cors.Config{}, fmt.Errorf("patrón inválido %q: solo se admite *.dominio", entry)
+			}
+			matcher.suffixes = append(matcher.suffixes, originSuffix{scheme: u.Scheme, suffix: "." + rest})
+			continue
+		}
+		matcher.exact[origin] = true
+	}
+
+	if cfg.AllowAllOrigins {
+		if len(matcher.exact) > 0 || len(matcher.suffixes) > 0 {
+			return cors.Config{}, errors.New(`"*" no se puede combinar con otros orígenes`)
+		}
+		return cfg, cfg.Validate()
+	}
+	if len(matcher.exact) == 0 && len(matcher.suffixes) == 0 {
+		return cors.Config{}, errors.New("no hay orígenes permitidos")
+	}
+
+	cfg.AllowOriginFunc = matcher.allow
+	return cfg, cfg.Validate()
+}
+
+// normalizeOrigin quita espacios y la "/" final, y pasa a minúsculas (los navegadores
+// envían el Origin en minúsculas y sin path)
+func normalizeOrigin(origin string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+}
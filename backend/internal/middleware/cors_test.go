@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+func TestCORSConfigRejectsMisconfiguration(t *testing.T) {
+	cases := []struct {
+		name        string
+		origins     string
+		credentials bool
+	}{
+		{"wildcard with credentials", "*", true},
+		{"wildcard mixed with origins", "*,https://bob.pe", false},
+		{"empty list", " , ", true},
+		{"missing scheme", "bob.pe", true},
+		{"unsupported scheme", "ftp://bob.pe", true},
+		{"origin with path", "https://bob.pe/app", true},
+		{"wildcard in the middle", "https://bob.*.pe", true},
+		{"bare wildcard host", "https://*.", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := CORSConfig(c.origins, c.credentials); err == nil {
+				t.Fatalf("CORSConfig(%q, %v) accepted", c.origins, c.credentials)
+			}
+		})
+	}
+}
+
+func TestCORSOrigins(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		name        string
+		origins     string
+		credentials bool
+		origin      string
+		allowed     bool
+	}{
+		{"padded entry", " https://bob.pe , http://localhost:5173 ", true, "https://bob.pe", true},
+		{"trailing slash and case", "HTTPS://Bob.pe/", true, "https://bob.pe", true},
+		{"disallowed origin", "https://bob.pe", true, "https://evil.com", false},
+		{"scheme must match", "https://bob.pe", true, "http://bob.pe", false},
+		{"subdomain pattern", "https://*.somosbob.com", true, "https://admin.somosbob.com", true},
+		{"nested subdomain", "https://*.somosbob.com", true, "https://a.b.somosbob.com", true},
+		{"pattern excludes apex", "https://*.somosbob.com", true, "https://somosbob.com", false},
+		{"pattern suffix lookalike", "https://*.somosbob.com", true, "https://evilsomosbob.com", false},
+		{"wildcard without credentials", "*", false, "https://cualquiera.dev", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg, err := CORSConfig(c.origins, c.credentials)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := gin.New()
+			r.Use(cors.New(cfg))
+			r.GET("/", func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Origin", c.origin)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			got := w.Header().Get("Access-Control-Allow-Origin")
+			if c.allowed != (got != "") {
+				t.Fatalf("origin %q: Allow-Origin = %q, status %d", c.origin, got, w.Code)
+			}
+			if c.allowed && c.credentials && w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+				t.Fatal("credentials header missing")
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"bob-hackathon/internal/config"
+	"crypto/sha256"
+	"crypto/subtle"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InternalAuth endpoints que solo usa el bot de WhatsApp (transcribir notas de voz, OCR):
+// exige Authorization: Bearer <WHATSAPP_ENGINE_TOKEN>, el token compartido con el engine.
+// Sin token configurado solo acepta conexiones desde loopback.
+func InternalAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if status := internalStatus(c); status != http.StatusOK {
+			if status == http.StatusForbidden {
+				log.Printf("🔐 %s %s rechazado: sin WHATSAPP_ENGINE_TOKEN solo se aceptan llamadas locales (%s)", c.Request.Method, c.Request.URL.Path, c.RemoteIP())
+				c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "endpoint interno"})
+			} else {
+				log.Printf("🔐 Token interno inválido: %s %s desde %s", c.Request.Method, c.Request.URL.Path, c.ClientIP())
+				c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "token inválido"})
+			}
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// FromEngine true si la request la mandó el bot de WhatsApp (mismas reglas que InternalAuth),
+// para endpoints públicos que solo confían en algunos campos cuando vienen del bot
+func FromEngine(c *gin.Context) bool {
+	return internalStatus(c) == http.StatusOK
+}
+
+// internalStatus 200 si la request trae el token del engine (o, sin token configurado, viene
+// de loopback); si no, 401 o 403 según el caso
+func internalStatus(c *gin.Context) int {
+	token := config.AppConfig.EngineAPIToken
+	if token == "" {
+		if ip := net.ParseIP(c.RemoteIP()); ip == nil || !ip.IsLoopback() {
+			return http.StatusForbidden
+		}
+		return http.StatusOK
+	}
+
+	want := sha256.Sum256([]byte(token))
+	provided, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	got := sha256.Sum256([]byte(provided))
+	if !ok || subtle.ConstantTimeCompare(got[:], want[:]) != 1 {
+		return http.StatusUnauthorized
+	}
+	return http.StatusOK
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"bob-hackathon/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestInternalAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	prev := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = prev })
+
+	cases := []struct {
+		name, token, auth, remote string
+		status                    int
+	}{
+		{"token ok", "engine-secret", "Bearer engine-secret", "203.0.113.7:5000", http.StatusOK},
+		{"missing token", "engine-secret", "", "127.0.0.1:5000", http.StatusUnauthorized},
+		{"wrong token", "engine-secret", "Bearer otro", "203.0.113.7:5000", http.StatusUnauthorized},
+		{"no token set, loopback", "", "", "127.0.0.1:5000", http.StatusOK},
+		{"no token set, remote", "", "", "203.0.113.7:5000", http.StatusForbidden},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			config.AppConfig = &config.Config{EngineAPIToken: c.token}
+			r := gin.New()
+			r.POST("/api/chat/transcribe", InternalAuth(), func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+			fromEngine := false
+			r.POST("/api/chat/message", func(ctx *gin.Context) { fromEngine = FromEngine(ctx) })
+
+			for _, path := range []string{"/api/chat/transcribe", "/api/chat/message"} {
+				req := httptest.NewRequest(http.MethodPost, path, nil)
+				req.RemoteAddr = c.remote
+				if c.auth != "" {
+					req.Header.Set("Authorization", c.auth)
+				}
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				if path == "/api/chat/transcribe" && w.Code != c.status {
+					t.Fatalf("status = %d %s, want %d", w.Code, w.Body.String(), c.status)
+				}
+			}
+			// el endpoint público no corta, pero sabe si la request es del bot
+			if fromEngine != (c.status == http.StatusOK) {
+				t.Fatalf("FromEngine = %v, want %v", fromEngine, c.status == http.StatusOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader header con el ID de correlación (lo envía el bot de WhatsApp)
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDKey clave en el gin.Context
+const requestIDKey = "request_id"
+
+// IDs entrantes aceptados tal cual; cualquier otra cosa se reemplaza por uno nuevo
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID toma el X-Request-ID entrante (o genera uno), lo guarda en el contexto
+// y lo devuelve en la respuesta para correlacionar logs entre servicios
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = uuid.New().String()
+		}
+		SetRequestID(c, id)
+		c.Next()
+	}
+}
+
+// SetRequestID reemplaza el ID de la request (ej: si vino en el body y no en el header)
+func SetRequestID(c *gin.Context, id string) {
+	c.Set(requestIDKey, id)
+	c.Header(RequestIDHeader, id)
+}
+
+// GetRequestID ID de correlación de la request actual ("" si no pasó por el middleware)
+func GetRequestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+// ValidRequestID indica si un ID recibido del cliente se puede usar como correlación
+func ValidRequestID(id string) bool {
+	return validRequestID.MatchString(id)
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{"accepted", "a1b2c3d4e5f60708", true},
+		{"dots and dashes", "bot-1.2_x", true},
+		{"missing", "", false},
+		{"invalid chars", "id con espacios", false},
+		{"header injection", "abc\r\nX-Evil: 1", false},
+		{"too long", strings.Repeat("a", 65), false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var inHandler string
+			r := gin.New()
+			r.Use(RequestID())
+			r.GET("/", func(ctx *gin.Context) { inHandler = GetRequestID(ctx) })
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if c.incoming != "" {
+				req.Header.Set(RequestIDHeader, c.incoming)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			echoed := w.Header().Get(RequestIDHeader)
+			if echoed == "" || echoed != inHandler || !ValidRequestID(echoed) {
+				t.Fatalf("header %q, handler %q", echoed, inHandler)
+			}
+			if (echoed == c.incoming) != c.keep {
+				t.Fatalf("incoming %q → %q, keep=%v", c.incoming, echoed, c.keep)
+			}
+		})
+	}
+}
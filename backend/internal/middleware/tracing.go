@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"bob-hackathon/internal/tracing"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Tracing abre un span por request continuando el traceparent entrante (el bot
+// lo envía en /api/chat/message) y lo deja en ctx.Request.Context() para los handlers
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		parent := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx, span := tracing.Start(parent, fmt.Sprintf("HTTP %s %s", c.Request.Method, route),
+			attribute.String("http.method", c.Request.Method),
+			attribute.String("http.route", route),
+		)
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		span.SetAttributes(
+			attribute.Int("http.status_code", c.Writer.Status()),
+			attribute.String("request_id", GetRequestID(c)),
+		)
+	}
+}
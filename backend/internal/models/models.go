@@ -12,6 +12,23 @@ type Session struct {
 	LeadScore    int                 `json:"leadScore"`
 	Category     string              `json:"category"`
 	Metadata     map[string]string   `json:"metadata,omitempty"`
+	Behavior     *BehaviorSignals    `json:"behavior,omitempty"`
+
+	// Resumen de los mensajes [0, SummarizedUpTo) para prompts y handoff
+	Summary        string `json:"summary,omitempty"`
+	SummarizedUpTo int    `json:"summarizedUpTo,omitempty"`
+}
+
+// BehaviorSignals señales de comportamiento medidas por el canal (WhatsApp:
+// presencia y confirmaciones de lectura). Los promedios van en segundos.
+type BehaviorSignals struct {
+	AvgResponseLatencySec float64 `json:"avgResponseLatencySec"`
+	ResponseSamples       int     `json:"responseSamples"`
+	AvgReadLatencySec     float64 `json:"avgReadLatencySec"`
+	ReadSamples           int     `json:"readSamples"`
+	MsgIn                 int     `json:"msgIn,omitempty"`
+	MsgOut                int     `json:"msgOut,omitempty"`
+	StreakDays            int     `json:"streakDays,omitempty"`
 }
 
 // Message representa un mensaje en la conversación
@@ -19,6 +36,23 @@ type Message struct {
 	Role      string    `json:"role"`
 	Content   string    `json:"content"`
 	Timestamp time.Time `json:"timestamp"`
+
+	// Media adjunta por el usuario (solo la referencia, no los bytes)
+	Media *MediaRef `json:"media,omitempty"`
+}
+
+// MediaRef referencia a una imagen, documento o nota de voz recibida en el chat
+type MediaRef struct {
+	MimeType string `json:"mimeType"`
+	URL      string `json:"url,omitempty"` // vacío si llegó en base64
+	SHA256   string `json:"sha256"`
+	Size     int    `json:"size"`
+
+	// Nota de voz: Content del mensaje es la transcripción
+	Transcribed bool `json:"transcribed,omitempty"`
+
+	// Imagen o documento: texto leído por OCR (placas, DNI, tarjeta de propiedad...)
+	ExtractedText string `json:"extractedText,omitempty"`
 }
 
 // Lead representa un lead generado
@@ -35,6 +69,16 @@ type Lead struct {
 	CreatedAt    time.Time           `json:"createdAt"`
 	UpdatedAt    time.Time           `json:"updatedAt"`
 	Metadata     map[string]string   `json:"metadata,omitempty"`
+
+	// Desglose del último scoring (dimensiones, boosts, penalizaciones)
+	Scoring *ScoringData `json:"scoring,omitempty"`
+}
+
+// LeadUpdate evento emitido cada vez que se crea o actualiza un lead (stream SSE)
+type LeadUpdate struct {
+	Lead             Lead   `json:"lead"`
+	PreviousCategory string `json:"previousCategory,omitempty"`
+	CategoryChanged  bool   `json:"categoryChanged"`
 }
 
 // FAQ representa una pregunta frecuente
@@ -57,11 +101,51 @@ type Vehicle struct {
 	Imagen       string  `json:"imagen,omitempty"`
 }
 
+// VehicleLink vehículo recomendado con su enlace de detalle (render enriquecido en web/WhatsApp)
+type VehicleLink struct {
+	ID           string  `json:"id"`
+	Title        string  `json:"title"`
+	URL          string  `json:"url"`
+	Image        string  `json:"image,omitempty"`
+	PrecioInicio float64 `json:"precioInicio"`
+}
+
 // ChatRequest representa una solicitud de mensaje
 type ChatRequest struct {
 	SessionID string `json:"sessionId,omitempty"`
-	Message   string `json:"message" binding:"required"`
+	Message   string `json:"message"` // puede ir vacío si viene media (foto sin texto)
 	Channel   string `json:"channel" binding:"required"`
+
+	// Opcional: imagen (ej: foto de un auto) o nota de voz adjunta, por URL o en base64
+	Media *ChatMedia `json:"media,omitempty"`
+
+	// Opcional: señales de comportamiento calculadas por el canal
+	Behavior *BehaviorSignals `json:"behavior,omitempty"`
+
+	// Opcional: ID de correlación si el cliente no envía el header X-Request-ID
+	RequestID string `json:"requestId,omitempty"`
+
+	// Opcional: tier del cliente en el canal (ej: "premium"); elige el tono de la respuesta
+	Tier string `json:"tier,omitempty"`
+}
+
+// ChatMedia imagen o audio adjunto a un mensaje: url o data (base64), con su tipo MIME
+type ChatMedia struct {
+	URL      string `json:"url,omitempty"`
+	Data     string `json:"data,omitempty"`
+	MimeType string `json:"mimeType,omitempty"` // si falta se detecta del contenido
+}
+
+// TranscribeRequest nota de voz a transcribir sin pasar por el chat
+// (el bot de WhatsApp transcribe cada audio del lote antes de llamar a /api/chat/message)
+type TranscribeRequest struct {
+	Media ChatMedia `json:"media" binding:"required"`
+}
+
+// ExtractRequest imagen o PDF del que se quiere solo el texto (OCR); el bot de WhatsApp
+// lo usa con las fotos y documentos del lote
+type ExtractRequest struct {
+	Media ChatMedia `json:"media" binding:"required"`
 }
 
 // ChatResponse representa la respuesta del chat
@@ -72,6 +156,62 @@ type ChatResponse struct {
 	LeadScore int       `json:"leadScore"`
 	Category  string    `json:"category"`
 	Timestamp time.Time `json:"timestamp"`
+
+	// Decisión del orchestrator (faq|auction|general|spam|ambiguous) y su confianza 0-1
+	Intent     string  `json:"intent"`
+	Confidence float64 `json:"confidence"`
+	NeedsHuman bool    `json:"needsHuman"`
+
+	// Handoff: la sesión está derivada a un asesor; Suppressed = el bot no respondió
+	Handoff    bool `json:"handoff"`
+	Suppressed bool `json:"suppressed,omitempty"`
+
+	// Vehículos mencionados en la respuesta (solo auction_agent)
+	Vehicles []VehicleLink `json:"vehicles,omitempty"`
+
+	// ID de correlación con los logs del backend (también va en el header X-Request-ID)
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// LeadEvent representa un evento enviado al webhook de leads
+type LeadEvent struct {
+	Event       string    `json:"event"` // handoff
+	SessionID   string    `json:"sessionId"`
+	Channel     string    `json:"channel"`
+	Reason      string    `json:"reason"` // user_request | hot_lead
+	LeadScore   int       `json:"leadScore"`
+	Category    string    `json:"category"`
+	LastMessage string    `json:"lastMessage"`
+	Summary     string    `json:"summary,omitempty"` // brief para el asesor
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// FeedbackRequest representa un voto sobre una respuesta del asistente
+type FeedbackRequest struct {
+	SessionID    string `json:"sessionId" binding:"required"`
+	MessageIndex *int   `json:"messageIndex" binding:"required"`
+	Rating       string `json:"rating" binding:"required"`
+	Comment      string `json:"comment,omitempty"`
+}
+
+// Feedback representa el voto guardado (con la respuesta evaluada, para iterar prompts)
+type Feedback struct {
+	SessionID    string    `json:"sessionId"`
+	Channel      string    `json:"channel"`
+	MessageIndex int       `json:"messageIndex"`
+	Rating       string    `json:"rating"`
+	Comment      string    `json:"comment,omitempty"`
+	Reply        string    `json:"reply"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// FeedbackStats representa estadísticas agregadas de feedback
+type FeedbackStats struct {
+	Total     int            `json:"total"`
+	Up        int            `json:"up"`
+	Down      int            `json:"down"`
+	UpRate    float64        `json:"upRate"`
+	ByChannel map[string]int `json:"byChannel"`
 }
 
 // ScoreRequest representa una solicitud de scoring
@@ -79,6 +219,16 @@ type ScoreRequest struct {
 	SessionID string `json:"sessionId" binding:"required"`
 }
 
+// RescoreProgress avance del re-scoring masivo de leads
+type RescoreProgress struct {
+	Status     string     `json:"status"` // running | completed | cancelled
+	Total      int        `json:"total"`
+	Processed  int        `json:"processed"`
+	Failed     int        `json:"failed"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
 // ScoreResponse representa la respuesta de scoring
 type ScoreResponse struct {
 	Success      bool     `json:"success"`
@@ -99,6 +249,16 @@ type LeadStats struct {
 	Discarded  int     `json:"discarded"`
 	AvgScore   float64 `json:"avgScore"`
 	ByChannel  map[string]int `json:"byChannel"`
+
+	// Desglose por variante del experimento A/B de prompts (solo si hay sesiones asignadas)
+	ByVariant map[string]*VariantStats `json:"byVariant,omitempty"`
+}
+
+// VariantStats resultados de leads para una variante de prompt
+type VariantStats struct {
+	Leads    int     `json:"leads"`
+	Hot      int     `json:"hot"`
+	AvgScore float64 `json:"avgScore"`
 }
 
 // HealthResponse representa la respuesta del health check
@@ -8,6 +8,7 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -19,7 +20,12 @@ type BOBAPIService struct {
 	lastFetch     time.Time
 	cacheDuration time.Duration
 	httpClient    *http.Client
+	maxRetries    int           // reintentos ante 5xx o error de red
+	retryBackoff  time.Duration // espera base, se duplica en cada reintento
 	mu            sync.RWMutex
+	fetchMu       sync.Mutex // serializa las llamadas a la API (sin bloquear lecturas del cache)
+	refreshing    bool
+	stopRefresh   chan struct{}
 }
 
 var bobAPIServiceInstance *BOBAPIService
@@ -34,43 +40,165 @@ func GetBOBAPIService() *BOBAPIService {
 			httpClient: &http.Client{
 				Timeout: 10 * time.Second,
 			},
+			maxRetries:   config.AppConfig.BOBAPIRetries,
+			retryBackoff: config.AppConfig.BOBAPIBackoff,
 		}
 	})
 	return bobAPIServiceInstance
 }
 
+// LastFetch momento de la última descarga exitosa del inventario (cero si nunca)
+func (b *BOBAPIService) LastFetch() time.Time {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.lastFetch
+}
+
+// GetSublots devuelve el inventario. Con cache vencido responde igual con el cache
+// y lo refresca en segundo plano; si la API falla se sirve el último cache bueno.
+// Solo un cache vacío (o forceRefresh sin cache) espera a la API y puede fallar.
 func (b *BOBAPIService) GetSublots(forceRefresh bool) ([]models.Vehicle, error) {
+	b.mu.RLock()
+	cache := b.cache
+	age := time.Since(b.lastFetch)
+	b.mu.RUnlock()
+
+	if !forceRefresh && len(cache) > 0 {
+		if age < b.cacheDuration {
+			log.Printf("Usando cache de vehículos (%d items)", len(cache))
+		} else {
+			log.Printf("Cache de vehículos vencido (%s), refrescando en segundo plano", age.Round(time.Second))
+			b.refreshAsync()
+		}
+		return cache, nil
+	}
+
+	vehicles, err := b.refresh()
+	if err != nil {
+		if len(cache) > 0 {
+			log.Printf("⚠️ BOB API no disponible (%v), usando cache de hace %s", err, age.Round(time.Second))
+			return cache, nil
+		}
+		return nil, err
+	}
+	return vehicles, nil
+}
+
+// StartBackgroundRefresh refresca el cache cada interval para que las requests no
+// esperen a la API. Llamar una sola vez; StopBackgroundRefresh lo detiene.
+func (b *BOBAPIService) StartBackgroundRefresh(interval time.Duration) {
+	b.mu.Lock()
+	if b.stopRefresh != nil {
+		b.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	b.stopRefresh = stop
+	b.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		if _, err := b.refresh(); err != nil {
+			log.Printf("⚠️ Error en carga inicial de vehículos: %v", err)
+		}
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := b.refresh(); err != nil {
+					log.Printf("⚠️ Error refrescando vehículos en segundo plano: %v", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	log.Printf("Refresco de vehículos en segundo plano cada %s", interval)
+}
+
+func (b *BOBAPIService) StopBackgroundRefresh() {
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	if b.stopRefresh != nil {
+		close(b.stopRefresh)
+		b.stopRefresh = nil
+	}
+}
 
-	// Verificar cache
-	if !forceRefresh && time.Since(b.lastFetch) < b.cacheDuration && len(b.cache) > 0 {
-		log.Printf("Usando cache de vehículos (%d items)", len(b.cache))
-		return b.cache, nil
+// refreshAsync lanza un refresh si no hay otro en curso
+func (b *BOBAPIService) refreshAsync() {
+	b.mu.Lock()
+	if b.refreshing {
+		b.mu.Unlock()
+		return
 	}
+	b.refreshing = true
+	b.mu.Unlock()
+
+	go func() {
+		defer func() {
+			b.mu.Lock()
+			b.refreshing = false
+			b.mu.Unlock()
+		}()
+		if _, err := b.refresh(); err != nil {
+			log.Printf("⚠️ Error refrescando vehículos en segundo plano: %v", err)
+		}
+	}()
+}
 
-	// Fetch desde API
-	url := fmt.Sprintf("%s/sublots/details", b.baseURL)
-	resp, err := b.httpClient.Get(url)
+// refresh trae el inventario de la API y actualiza el cache si salió bien
+func (b *BOBAPIService) refresh() ([]models.Vehicle, error) {
+	b.fetchMu.Lock()
+	defer b.fetchMu.Unlock()
+
+	vehicles, err := b.fetchSublots()
 	if err != nil {
-		log.Printf("Error obteniendo vehiculos de BOB API: %v", err)
-		return nil, fmt.Errorf("error al obtener sublots: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	// Verificar status code
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("BOB API devolvio status %d", resp.StatusCode)
-		return nil, fmt.Errorf("bob api devolvio status %d", resp.StatusCode)
-	}
+	b.mu.Lock()
+	b.cache = vehicles
+	b.lastFetch = time.Now()
+	b.mu.Unlock()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error al leer respuesta: %w", err)
+	log.Printf("%d vehículos obtenidos de la API BOB", len(vehicles))
+	return vehicles, nil
+}
+
+// fetchSublots GET /sublots/details con reintentos y conversión a nuestro modelo
+func (b *BOBAPIService) fetchSublots() ([]models.Vehicle, error) {
+	url := fmt.Sprintf("%s/sublots/details", b.baseURL)
+
+	var body []byte
+	var err error
+	for attempt := 0; ; attempt++ {
+		var retryable bool
+		body, retryable, err = b.get(url)
+		if err == nil {
+			break
+		}
+		if !retryable || attempt >= b.maxRetries {
+			return nil, err
+		}
+		wait := b.retryBackoff << attempt
+		log.Printf("⚠️ BOB API falló (%v), reintento %d/%d en %s", err, attempt+1, b.maxRetries, wait)
+		time.Sleep(wait)
 	}
 
 	var apiResponse struct {
-		Data []struct {
+		Data []json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &apiResponse); err != nil {
+		return nil, fmt.Errorf("error al parsear respuesta: %w", err)
+	}
+
+	// Convertir a nuestro modelo; un registro malformado se salta sin perder el resto
+	vehicles := make([]models.Vehicle, 0, len(apiResponse.Data))
+	skipped := 0
+	for _, raw := range apiResponse.Data {
+		var item struct {
 			ID           string  `json:"id"`
 			Brand        string  `json:"brand"`
 			Model        string  `json:"model"`
@@ -79,16 +207,11 @@ func (b *BOBAPIService) GetSublots(forceRefresh bool) ([]models.Vehicle, error)
 			AuctionType  string  `json:"auction_type"`
 			Status       string  `json:"status"`
 			Image        string  `json:"image"`
-		} `json:"data"`
-	}
-
-	if err := json.Unmarshal(body, &apiResponse); err != nil {
-		return nil, fmt.Errorf("error al parsear respuesta: %w", err)
-	}
-
-	// Convertir a nuestro modelo
-	vehicles := make([]models.Vehicle, 0, len(apiResponse.Data))
-	for _, item := range apiResponse.Data {
+		}
+		if err := json.Unmarshal(raw, &item); err != nil || item.ID == "" {
+			skipped++
+			continue
+		}
 		vehicle := models.Vehicle{
 			ID:           item.ID,
 			Marca:        item.Brand,
@@ -102,14 +225,41 @@ func (b *BOBAPIService) GetSublots(forceRefresh bool) ([]models.Vehicle, error)
 		vehicles = append(vehicles, vehicle)
 	}
 
-	b.cache = vehicles
-	b.lastFetch = time.Now()
+	if skipped > 0 {
+		log.Printf("⚠️ BOB API: %d de %d vehículos malformados omitidos", skipped, len(apiResponse.Data))
+	}
+	if len(vehicles) == 0 && skipped > 0 {
+		return nil, fmt.Errorf("todos los vehículos de la respuesta son inválidos (%d)", skipped)
+	}
 
-	log.Printf("%d vehículos obtenidos de la API BOB", len(vehicles))
 	return vehicles, nil
 }
 
-func (b *BOBAPIService) SearchVehicles(marca, modelo string, precioMin, precioMax float64, tipoSubasta string, limit int) ([]models.Vehicle, error) {
+// get hace un GET e indica si el error amerita reintento (red o 5xx)
+func (b *BOBAPIService) get(url string) ([]byte, bool, error) {
+	resp, err := b.httpClient.Get(url)
+	if err != nil {
+		log.Printf("Error obteniendo vehiculos de BOB API: %v", err)
+		return nil, true, fmt.Errorf("error al obtener sublots: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Verificar status code
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("BOB API devolvio status %d", resp.StatusCode)
+		return nil, resp.StatusCode >= 500, fmt.Errorf("bob api devolvio status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, fmt.Errorf("error al leer respuesta: %w", err)
+	}
+	return body, false, nil
+}
+
+// SearchVehicles filtra el inventario; los filtros en cero/vacíos no se aplican.
+// Con yearMin/yearMax se excluyen los vehículos cuyo año no se puede interpretar.
+func (b *BOBAPIService) SearchVehicles(marca, modelo string, precioMin, precioMax float64, tipoSubasta string, yearMin, yearMax int, status string, limit int) ([]models.Vehicle, error) {
 	vehicles, err := b.GetSublots(false)
 	if err != nil {
 		return nil, err
@@ -143,6 +293,19 @@ func (b *BOBAPIService) SearchVehicles(marca, modelo string, precioMin, precioMa
 			continue
 		}
 
+		// Filtrar por año
+		if yearMin > 0 || yearMax > 0 {
+			year, ok := parseYear(v.Ano)
+			if !ok || (yearMin > 0 && year < yearMin) || (yearMax > 0 && year > yearMax) {
+				continue
+			}
+		}
+
+		// Filtrar por estado
+		if status != "" && !strings.EqualFold(strings.TrimSpace(v.Estado), status) {
+			continue
+		}
+
 		results = append(results, v)
 
 		// Limitar resultados
@@ -154,6 +317,22 @@ func (b *BOBAPIService) SearchVehicles(marca, modelo string, precioMin, precioMa
 	return results, nil
 }
 
+// parseYear interpreta el año del API ("2020", " 2020 ", "2020.0", "2020-2021" → 2020)
+func parseYear(ano string) (int, bool) {
+	ano = strings.TrimSpace(ano)
+	if len(ano) < 4 {
+		return 0, false
+	}
+	year, err := strconv.Atoi(ano[:4])
+	if err != nil || year < 1900 || year > 2100 {
+		return 0, false
+	}
+	if len(ano) > 4 && ano[4] >= '0' && ano[4] <= '9' {
+		return 0, false
+	}
+	return year, true
+}
+
 func (b *BOBAPIService) GetVehicleByID(id string) (*models.Vehicle, error) {
 	vehicles, err := b.GetSublots(false)
 	if err != nil {
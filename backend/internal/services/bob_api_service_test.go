@@ -0,0 +1,289 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"bob-hackathon/internal/models"
+)
+
+// fakeBOBAPI upstream de /sublots/details con status configurable y contador de hits
+type fakeBOBAPI struct {
+	*httptest.Server
+	mu     sync.Mutex
+	status int
+	body   string
+	fail   []int // status de las próximas respuestas antes de volver a status/body
+	hits   atomic.Int32
+}
+
+func newFakeBOBAPI(t *testing.T, body string) *fakeBOBAPI {
+	t.Helper()
+	f := &fakeBOBAPI{status: http.StatusOK, body: body}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.hits.Add(1)
+		f.mu.Lock()
+		status, body := f.status, f.body
+		if len(f.fail) > 0 {
+			status, body = f.fail[0], "error"
+			f.fail = f.fail[1:]
+		}
+		f.mu.Unlock()
+		if r.URL.Path != "/sublots/details" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeBOBAPI) set(status int, body string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status, f.body = status, body
+}
+
+// newTestBOBAPI servicio apuntando a url, sin reintentos
+func newTestBOBAPI(url string) *BOBAPIService {
+	return &BOBAPIService{
+		baseURL:       url,
+		cacheDuration: time.Minute,
+		httpClient:    &http.Client{Timeout: 2 * time.Second},
+	}
+}
+
+const twoSublots = `{"data":[
+	{"id":"1","brand":"Toyota","model":"Hilux","year":"2019","start_price":45000,"auction_type":"online","status":"disponible"},
+	{"id":"2","brand":"Kia","model":"Rio","year":"2020","start_price":25000,"auction_type":"presencial","status":"vendido"}
+]}`
+
+func TestGetSublotsStaleCacheOnError(t *testing.T) {
+	cases := []struct {
+		name      string
+		warm      bool
+		force     bool
+		wantErr   bool
+		wantCount int
+	}{
+		{"warm cache, forced refresh fails", true, true, false, 2},
+		{"cold cache fails", false, false, true, 0},
+		{"cold cache, forced refresh fails", false, true, true, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			api := newFakeBOBAPI(t, twoSublots)
+			b := newTestBOBAPI(api.URL)
+			if c.warm {
+				if _, err := b.GetSublots(true); err != nil {
+					t.Fatal(err)
+				}
+			}
+			api.set(http.StatusServiceUnavailable, "down")
+
+			got, err := b.GetSublots(c.force)
+			if (err != nil) != c.wantErr || len(got) != c.wantCount {
+				t.Fatalf("GetSublots = %d vehicles, %v", len(got), err)
+			}
+		})
+	}
+}
+
+func TestGetSublotsServesCacheAndRefreshesInBackground(t *testing.T) {
+	api := newFakeBOBAPI(t, twoSublots)
+	b := newTestBOBAPI(api.URL)
+	if _, err := b.GetSublots(false); err != nil {
+		t.Fatal(err)
+	}
+
+	// cache fresco: no toca la API
+	if _, err := b.GetSublots(false); err != nil || api.hits.Load() != 1 {
+		t.Fatalf("fresh cache hit upstream (%d hits, %v)", api.hits.Load(), err)
+	}
+
+	// cache vencido: responde el cache viejo y refresca en segundo plano
+	api.set(http.StatusOK, `{"data":[{"id":"3","brand":"Nissan","model":"Sentra","year":"2018"}]}`)
+	b.mu.Lock()
+	b.lastFetch = time.Now().Add(-2 * time.Minute)
+	b.mu.Unlock()
+	got, err := b.GetSublots(false)
+	if err != nil || len(got) != 2 {
+		t.Fatalf("stale GetSublots = %d, %v; want old cache", len(got), err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if got, _ := b.GetSublots(false); len(got) == 1 && got[0].ID == "3" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("background refresh did not update the cache")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBackgroundRefreshStartStop(t *testing.T) {
+	api := newFakeBOBAPI(t, twoSublots)
+	b := newTestBOBAPI(api.URL)
+	b.StartBackgroundRefresh(20 * time.Millisecond)
+	b.StartBackgroundRefresh(20 * time.Millisecond) // segunda llamada no lanza otro loop
+
+	deadline := time.Now().Add(2 * time.Second)
+	for api.hits.Load() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("only %d refreshes", api.hits.Load())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if b.LastFetch().IsZero() {
+		t.Fatal("LastFetch not set")
+	}
+	b.StopBackgroundRefresh()
+	time.Sleep(30 * time.Millisecond)
+	stopped := api.hits.Load()
+	time.Sleep(60 * time.Millisecond)
+	if api.hits.Load() != stopped {
+		t.Fatalf("refresh kept running after stop (%d → %d)", stopped, api.hits.Load())
+	}
+}
+
+func TestFetchSublotsRetries(t *testing.T) {
+	cases := []struct {
+		name    string
+		retries int
+		fail    []int
+		wantErr bool
+		hits    int32
+	}{
+		{"503 then 200", 2, []int{503}, false, 2},
+		{"two 502 then 200", 2, []int{502, 502}, false, 3},
+		{"retries exhausted", 1, []int{503, 503}, true, 2},
+		{"4xx not retried", 3, []int{404}, true, 1},
+		{"no retries configured", 0, []int{500}, true, 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			api := newFakeBOBAPI(t, twoSublots)
+			api.fail = c.fail
+			b := newTestBOBAPI(api.URL)
+			b.maxRetries = c.retries
+			b.retryBackoff = time.Millisecond
+
+			got, err := b.GetSublots(true)
+			if (err != nil) != c.wantErr || api.hits.Load() != c.hits {
+				t.Fatalf("GetSublots = %d vehicles, %v after %d hits; want err=%v, %d hits", len(got), err, api.hits.Load(), c.wantErr, c.hits)
+			}
+			if !c.wantErr && len(got) != 2 {
+				t.Fatalf("got %d vehicles", len(got))
+			}
+		})
+	}
+}
+
+func TestFetchSublotsSkipsMalformedRecords(t *testing.T) {
+	cases := []struct {
+		name    string
+		body    string
+		ids     []string
+		wantErr bool
+	}{
+		{
+			name: "one malformed among valid",
+			body: `{"data":[{"id":"1","brand":"Toyota"},{"id":2,"brand":"Kia"},{"brand":"sin id"},{"id":"3","start_price":"caro"},{"id":"4","brand":"Mazda"}]}`,
+			ids:  []string{"1", "4"},
+		},
+		{name: "all malformed", body: `{"data":[{"id":5},"texto"]}`, wantErr: true},
+		{name: "empty list", body: `{"data":[]}`},
+		{name: "broken envelope", body: `{"data":`, wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			api := newFakeBOBAPI(t, c.body)
+			got, err := newTestBOBAPI(api.URL).fetchSublots()
+			if (err != nil) != c.wantErr {
+				t.Fatalf("fetchSublots err = %v", err)
+			}
+			var ids []string
+			for _, v := range got {
+				ids = append(ids, v.ID)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(c.ids) {
+				t.Fatalf("ids = %v, want %v", ids, c.ids)
+			}
+		})
+	}
+}
+
+func TestSearchVehiclesYearAndStatus(t *testing.T) {
+	b := newTestBOBAPI("http://unused.invalid")
+	b.cache = []models.Vehicle{
+		{ID: "a", Marca: "Toyota", Modelo: "Hilux", Ano: "2019", PrecioInicio: 45000, Estado: "Disponible"},
+		{ID: "b", Marca: "Kia", Modelo: "Rio", Ano: " 2021 ", PrecioInicio: 25000, Estado: "disponible "},
+		{ID: "c", Marca: "Nissan", Modelo: "Sentra", Ano: "2015.0", PrecioInicio: 20000, Estado: "vendido"},
+		{ID: "d", Marca: "Mazda", Modelo: "3", Ano: "s/n", PrecioInicio: 27000, Estado: "disponible"},
+		{ID: "e", Marca: "Hyundai", Modelo: "Accent", Ano: "20201", PrecioInicio: 32000, Estado: "disponible"},
+		{ID: "f", Marca: "Toyota", Modelo: "Yaris", Ano: "2020-2021", PrecioInicio: 30000, Estado: "reservado"},
+	}
+	b.lastFetch = time.Now()
+
+	cases := []struct {
+		name             string
+		yearMin, yearMax int
+		status           string
+		precioMax        float64
+		limit            int
+		want             []string
+	}{
+		{name: "no filters keeps unparseable years", want: []string{"a", "b", "c", "d", "e", "f"}},
+		{name: "2020 and up", yearMin: 2020, want: []string{"b", "f"}},
+		{name: "up to 2019", yearMax: 2019, want: []string{"a", "c"}},
+		{name: "range", yearMin: 2016, yearMax: 2020, want: []string{"a", "f"}},
+		{name: "status case and spaces", status: "disponible", want: []string{"a", "b", "d", "e"}},
+		{name: "status with year", status: "disponible", yearMin: 2019, want: []string{"a", "b"}},
+		{name: "combined with price and limit", status: "disponible", precioMax: 40000, limit: 2, want: []string{"b", "d"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := b.SearchVehicles("", "", 0, c.precioMax, "", c.yearMin, c.yearMax, c.status, c.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, v := range got {
+				ids = append(ids, v.ID)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(c.want) {
+				t.Fatalf("ids = %v, want %v", ids, c.want)
+			}
+		})
+	}
+}
+
+func TestParseYear(t *testing.T) {
+	cases := []struct {
+		in   string
+		want int
+		ok   bool
+	}{
+		{"2020", 2020, true},
+		{" 2020 ", 2020, true},
+		{"2020.0", 2020, true},
+		{"2020-2021", 2020, true},
+		{"20201", 0, false},
+		{"s/n", 0, false},
+		{"", 0, false},
+		{"1850", 0, false},
+	}
+	for _, c := range cases {
+		if got, ok := parseYear(c.in); got != c.want || ok != c.ok {
+			t.Errorf("parseYear(%q) = %d, %v; want %d, %v", c.in, got, ok, c.want, c.ok)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"hash/fnv"
+	"time"
+)
+
+// Experimento A/B de prompts: cada sesión queda fija en una variante y la variante B
+// usa el prompt "<agente>_b" del PromptStore (editable por el admin como cualquier otro)
+const (
+	PromptVariantKey = "prompt_variant"
+	PromptVariantA   = "A"
+	PromptVariantB   = "B"
+)
+
+// AssignPromptVariant variante determinística por sessionID (mismo id → misma variante)
+func AssignPromptVariant(sessionID string) string {
+	h := fnv.New32a()
+	h.Write([]byte(sessionID))
+	if h.Sum32()%2 == 0 {
+		return PromptVariantA
+	}
+	return PromptVariantB
+}
+
+// PromptVariantName nombre del prompt a usar para la variante ("orchestrator" / "orchestrator_b")
+func PromptVariantName(base, variant string) string {
+	if variant == PromptVariantB {
+		return base + "_b"
+	}
+	return base
+}
+
+// EnsurePromptVariant devuelve la variante guardada en la sesión o asigna y guarda una
+func (s *SessionService) EnsurePromptVariant(sessionID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessions[sessionID]
+	if !exists {
+		return ""
+	}
+	if variant := session.Metadata[PromptVariantKey]; variant != "" {
+		return variant
+	}
+
+	if session.Metadata == nil {
+		session.Metadata = make(map[string]string)
+	}
+	variant := AssignPromptVariant(sessionID)
+	session.Metadata[PromptVariantKey] = variant
+	session.UpdatedAt = time.Now()
+
+	s.saveToDisk()
+	return variant
+}
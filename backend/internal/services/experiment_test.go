@@ -0,0 +1,101 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	"bob-hackathon/internal/models"
+)
+
+func TestAssignPromptVariantIsSticky(t *testing.T) {
+	counts := map[string]int{}
+	for i := 0; i < 200; i++ {
+		id := fmt.Sprintf("web-%d", i)
+		first := AssignPromptVariant(id)
+		for j := 0; j < 3; j++ {
+			if got := AssignPromptVariant(id); got != first {
+				t.Fatalf("AssignPromptVariant(%q) = %q then %q", id, first, got)
+			}
+		}
+		counts[first]++
+	}
+	// ambas variantes reciben tráfico razonable
+	if counts[PromptVariantA] < 60 || counts[PromptVariantB] < 60 {
+		t.Fatalf("unbalanced assignment: %v", counts)
+	}
+}
+
+func TestPromptVariantName(t *testing.T) {
+	cases := []struct{ variant, want string }{
+		{PromptVariantA, "orchestrator"},
+		{PromptVariantB, "orchestrator_b"},
+		{"", "orchestrator"},
+	}
+	for _, c := range cases {
+		if got := PromptVariantName("orchestrator", c.variant); got != c.want {
+			t.Errorf("PromptVariantName(%q) = %q, want %q", c.variant, got, c.want)
+		}
+	}
+}
+
+func TestEnsurePromptVariant(t *testing.T) {
+	s := newTestSessionService(t)
+	if got := s.EnsurePromptVariant("missing"); got != "" {
+		t.Fatalf("unknown session variant = %q", got)
+	}
+
+	s.GetOrCreateSession("exp-1", "web")
+	first := s.EnsurePromptVariant("exp-1")
+	if first != AssignPromptVariant("exp-1") || s.GetMetadata("exp-1", PromptVariantKey) != first {
+		t.Fatalf("variant = %q, stored %q", first, s.GetMetadata("exp-1", PromptVariantKey))
+	}
+
+	// la variante guardada manda aunque el hash diga otra cosa
+	other := PromptVariantA
+	if first == PromptVariantA {
+		other = PromptVariantB
+	}
+	s.SetMetadata("exp-1", PromptVariantKey, other)
+	if got := s.EnsurePromptVariant("exp-1"); got != other {
+		t.Fatalf("stored variant overridden: %q", got)
+	}
+}
+
+func TestLeadsStatsByVariant(t *testing.T) {
+	s := newTestSessionService(t)
+	leads := []struct {
+		id, variant, category string
+		score                 int
+	}{
+		{"var-a1", PromptVariantA, "hot", 90},
+		{"var-a2", PromptVariantA, "cold", 50},
+		{"var-b1", PromptVariantB, "warm", 70},
+		{"var-none", "", "hot", 88},
+	}
+	for _, l := range leads {
+		s.GetOrCreateSession(l.id, "web")
+		if l.variant != "" {
+			s.SetMetadata(l.id, PromptVariantKey, l.variant)
+		}
+		s.CreateOrUpdateLead(&models.Lead{SessionID: l.id, Channel: "web", Score: l.score, Category: l.category})
+	}
+
+	stats := s.GetLeadsStats()
+	if stats.Total != 4 || len(stats.ByVariant) != 2 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	want := map[string]models.VariantStats{
+		PromptVariantA: {Leads: 2, Hot: 1, AvgScore: 70},
+		PromptVariantB: {Leads: 1, Hot: 0, AvgScore: 70},
+	}
+	for variant, w := range want {
+		if got := stats.ByVariant[variant]; got == nil || *got != w {
+			t.Errorf("ByVariant[%s] = %+v, want %+v", variant, got, w)
+		}
+	}
+
+	// sin sesiones asignadas no hay desglose
+	if empty := newTestSessionService(t).GetLeadsStats(); empty.ByVariant != nil {
+		t.Fatalf("ByVariant without experiment = %+v", empty.ByVariant)
+	}
+}
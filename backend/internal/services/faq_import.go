@@ -0,0 +1,133 @@
+package services
+
+import (
+	"bob-hackathon/internal/models"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// faqColumns columnas requeridas del CSV de FAQs, en el orden de models.FAQ
+var faqColumns = []string{"categoria", "empresa", "pregunta", "respuesta"}
+
+var headerFolder = strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "\ufeff", "")
+
+// FAQImportReport resultado de validar un CSV de FAQs
+type FAQImportReport struct {
+	Rows       int      `json:"rows"`
+	Valid      int      `json:"valid"`
+	Duplicates []string `json:"duplicates,omitempty"` // preguntas repetidas (se conserva la primera)
+	Errors     []string `json:"errors,omitempty"`     // filas inválidas, con su número de línea
+}
+
+// ParseFAQsCSV lee un CSV de FAQs por nombre de columna: exige categoria, empresa,
+// pregunta y respuesta (sin importar mayúsculas, tildes ni columnas extra como Id).
+// Las filas sin pregunta o respuesta van a Errors y las preguntas repetidas (misma
+// empresa) se descartan. Devuelve error si el CSV no se puede leer o le faltan columnas.
+func ParseFAQsCSV(r io.Reader) ([]models.FAQ, *FAQImportReport, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error al parsear CSV: %w", err)
+	}
+	if len(records) < 2 {
+		return nil, nil, errors.New("CSV debe tener al menos una fila de datos")
+	}
+
+	index := make(map[string]int)
+	for i, name := range records[0] {
+		index[foldFAQText(name)] = i
+	}
+	var missing []string
+	for _, col := range faqColumns {
+		if _, ok := index[col]; !ok {
+			missing = append(missing, col)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, nil, fmt.Errorf("faltan columnas: %s (se esperan: %s)", strings.Join(missing, ", "), strings.Join(faqColumns, ","))
+	}
+
+	report := &FAQImportReport{Rows: len(records) - 1}
+	seen := make(map[string]bool)
+	var faqs []models.FAQ
+	for i, record := range records[1:] {
+		faq := models.FAQ{
+			Categoria: strings.TrimSpace(record[index["categoria"]]),
+			Empresa:   strings.TrimSpace(record[index["empresa"]]),
+			Pregunta:  strings.TrimSpace(record[index["pregunta"]]),
+			Respuesta: strings.TrimSpace(record[index["respuesta"]]),
+		}
+		line := i + 2 // el header es la línea 1
+		if faq.Pregunta == "" || faq.Respuesta == "" {
+			report.Errors = append(report.Errors, fmt.Sprintf("línea %d: pregunta y respuesta son obligatorias", line))
+			continue
+		}
+		key := faqKey(faq)
+		if seen[key] {
+			report.Duplicates = append(report.Duplicates, fmt.Sprintf("línea %d: %s", line, faq.Pregunta))
+			continue
+		}
+		seen[key] = true
+		faqs = append(faqs, faq)
+	}
+	report.Valid = len(faqs)
+	return faqs, report, nil
+}
+
+// foldFAQText minúsculas, sin tildes y con los espacios colapsados (comparar headers, filtros y preguntas)
+func foldFAQText(s string) string {
+	return strings.Join(strings.Fields(headerFolder.Replace(strings.ToLower(s))), " ")
+}
+
+// faqKey identidad de una FAQ: empresa + pregunta normalizadas
+func faqKey(faq models.FAQ) string {
+	return foldFAQText(faq.Empresa) + "|" + foldFAQText(faq.Pregunta)
+}
+
+// FAQDiff cambios entre el set de FAQs vigente y uno nuevo
+type FAQDiff struct {
+	Added     int      `json:"added"`
+	Removed   int      `json:"removed"`
+	Changed   int      `json:"changed"` // misma pregunta con otra respuesta o categoría
+	Unchanged int      `json:"unchanged"`
+	AddedQ    []string `json:"addedPreguntas,omitempty"`
+	RemovedQ  []string `json:"removedPreguntas,omitempty"`
+	ChangedQ  []string `json:"changedPreguntas,omitempty"`
+}
+
+// DiffFAQs compara por empresa + pregunta
+func DiffFAQs(current, incoming []models.FAQ) FAQDiff {
+	var diff FAQDiff
+	existing := make(map[string]models.FAQ, len(current))
+	for _, faq := range current {
+		existing[faqKey(faq)] = faq
+	}
+
+	for _, faq := range incoming {
+		key := faqKey(faq)
+		old, ok := existing[key]
+		switch {
+		case !ok:
+			diff.Added++
+			diff.AddedQ = append(diff.AddedQ, faq.Pregunta)
+		case old.Respuesta != faq.Respuesta || old.Categoria != faq.Categoria:
+			diff.Changed++
+			diff.ChangedQ = append(diff.ChangedQ, faq.Pregunta)
+		default:
+			diff.Unchanged++
+		}
+		delete(existing, key)
+	}
+
+	for _, faq := range current {
+		key := faqKey(faq)
+		if _, ok := existing[key]; ok {
+			diff.Removed++
+			diff.RemovedQ = append(diff.RemovedQ, faq.Pregunta)
+			delete(existing, key)
+		}
+	}
+	return diff
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"bob-hackathon/internal/models"
+)
+
+func TestParseFAQsCSV(t *testing.T) {
+	cases := []struct {
+		name       string
+		csv        string
+		wantErr    string
+		valid      int
+		errors     int
+		duplicates int
+	}{
+		{
+			name:  "columns by name in any order",
+			csv:   "Id,Pregunta,Respuesta,Empresa,Categoría\n1,¿Cómo oferto?,Desde la app,BOB,Subastas\n",
+			valid: 1,
+		},
+		{
+			name:  "bom and accents in header",
+			csv:   "\ufeffcategoria,empresa,pregunta,respuesta\nPagos,BOB,¿Cuándo pago?,En 48h\n",
+			valid: 1,
+		},
+		{name: "missing column", csv: "categoria,empresa,pregunta\nPagos,BOB,¿Cuándo pago?\n", wantErr: "faltan columnas: respuesta"},
+		{name: "header only", csv: "categoria,empresa,pregunta,respuesta\n", wantErr: "al menos una fila"},
+		{name: "ragged rows", csv: "categoria,empresa,pregunta,respuesta\nPagos,BOB\n", wantErr: "error al parsear CSV"},
+		{
+			name:   "empty pregunta or respuesta",
+			csv:    "categoria,empresa,pregunta,respuesta\nPagos,BOB,,En 48h\nPagos,BOB,¿Cuándo?,  \nPagos,BOB,¿Dónde?,Online\n",
+			valid:  1,
+			errors: 2,
+		},
+		{
+			name:       "duplicates by empresa and folded pregunta",
+			csv:        "categoria,empresa,pregunta,respuesta\nPagos,BOB,¿Cuándo pago?,En 48h\nPagos,bob,¿cuando  pago?,Otra\nPagos,Otra,¿Cuándo pago?,En 24h\n",
+			valid:      2,
+			duplicates: 1,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			faqs, report, err := ParseFAQsCSV(strings.NewReader(c.csv))
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Fatalf("err = %v, want %q", err, c.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(faqs) != c.valid || report.Valid != c.valid || len(report.Errors) != c.errors || len(report.Duplicates) != c.duplicates {
+				t.Fatalf("faqs %d, report %+v", len(faqs), report)
+			}
+		})
+	}
+
+	faqs, _, _ := ParseFAQsCSV(strings.NewReader("Id,Pregunta,Respuesta,Empresa,Categoría\n1, ¿Cómo oferto? ,Desde la app,BOB,Subastas\n"))
+	want := models.FAQ{Categoria: "Subastas", Empresa: "BOB", Pregunta: "¿Cómo oferto?", Respuesta: "Desde la app"}
+	if faqs[0] != want {
+		t.Fatalf("faq = %+v, want %+v", faqs[0], want)
+	}
+}
+
+func TestDiffFAQs(t *testing.T) {
+	current := []models.FAQ{
+		{Categoria: "Pagos", Empresa: "BOB", Pregunta: "¿Cuándo pago?", Respuesta: "En 48h"},
+		{Categoria: "Registro", Empresa: "BOB", Pregunta: "¿Cómo me registro?", Respuesta: "En la web"},
+		{Categoria: "Envíos", Empresa: "BOB", Pregunta: "¿Hacen envíos?", Respuesta: "No"},
+	}
+	cases := []struct {
+		name                               string
+		incoming                           []models.FAQ
+		added, removed, changed, unchanged int
+	}{
+		{"identical", current, 0, 0, 0, 3},
+		{"empty set removes all", nil, 0, 3, 0, 0},
+		{
+			name: "mixed",
+			incoming: []models.FAQ{
+				{Categoria: "Pagos", Empresa: "BOB", Pregunta: "¿cuando pago?", Respuesta: "En 72h"},
+				{Categoria: "Registro", Empresa: "BOB", Pregunta: "¿Cómo me registro?", Respuesta: "En la web"},
+				{Categoria: "Garantía", Empresa: "BOB", Pregunta: "¿Tiene garantía?", Respuesta: "No"},
+			},
+			added: 1, removed: 1, changed: 1, unchanged: 1,
+		},
+		{
+			name:     "category change counts as changed",
+			incoming: []models.FAQ{{Categoria: "Otros", Empresa: "BOB", Pregunta: "¿Hacen envíos?", Respuesta: "No"}},
+			removed:  2, changed: 1,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d := DiffFAQs(current, c.incoming)
+			if d.Added != c.added || d.Removed != c.removed || d.Changed != c.changed || d.Unchanged != c.unchanged {
+				t.Fatalf("diff = %+v", d)
+			}
+			if len(d.AddedQ) != d.Added || len(d.RemovedQ) != d.Removed || len(d.ChangedQ) != d.Changed {
+				t.Fatalf("question lists out of sync: %+v", d)
+			}
+		})
+	}
+}
@@ -3,17 +3,18 @@ package services
 import (
 	"bob-hackathon/internal/config"
 	"bob-hackathon/internal/models"
-	"encoding/csv"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"unicode"
 )
 
 type FAQService struct {
-	faqs []models.FAQ
-	mu   sync.RWMutex
+	faqs    []models.FAQ
+	version uint64 // sube con cada carga: invalida respuestas cacheadas con FAQs viejas
+	mu      sync.RWMutex
 }
 
 var faqServiceInstance *FAQService
@@ -30,65 +31,60 @@ func GetFAQService() *FAQService {
 }
 
 func (f *FAQService) loadFAQs() {
-	dataDir := config.AppConfig.DataDir
-	file, err := os.Open(filepath.Join(dataDir, "faqs.csv"))
+	faqs, err := readFAQsFile()
 	if err != nil {
-		log.Printf("Error al abrir FAQs: %v", err)
+		log.Printf("Error al cargar FAQs: %v", err)
 		return
 	}
-	defer file.Close()
+	f.faqs = faqs
+	f.version++
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+	log.Printf("%d FAQs cargadas", len(f.faqs))
+}
+
+// readFAQsFile lee data/faqs.csv con las mismas reglas que la subida por admin
+func readFAQsFile() ([]models.FAQ, error) {
+	file, err := os.Open(filepath.Join(config.AppConfig.DataDir, "faqs.csv"))
 	if err != nil {
-		log.Printf("Error al leer FAQs: %v", err)
-		return
+		return nil, err
 	}
+	defer file.Close()
 
-	// Saltar header
-	for i, record := range records {
-		if i == 0 {
-			continue
-		}
-
-		if len(record) >= 4 {
-			faq := models.FAQ{
-				Categoria: record[0],
-				Empresa:   record[1],
-				Pregunta:  record[2],
-				Respuesta: record[3],
-			}
-			f.faqs = append(f.faqs, faq)
-		}
+	faqs, report, err := ParseFAQsCSV(file)
+	if err != nil {
+		return nil, err
 	}
-
-	log.Printf("%d FAQs cargadas", len(f.faqs))
+	for _, problem := range append(report.Errors, report.Duplicates...) {
+		log.Printf("⚠️ FAQ omitida: %s", problem)
+	}
+	return faqs, nil
 }
 
+// SearchFAQs filtra por categoría y empresa (exactas) y busca query en pregunta y
+// respuesta; todo sin distinguir mayúsculas ni tildes. Sin resultados devuelve [] (no nil).
 func (f *FAQService) SearchFAQs(query, categoria, empresa string) []models.FAQ {
 	f.mu.RLock()
 	defer f.mu.RUnlock()
 
-	var results []models.FAQ
-	queryLower := strings.ToLower(query)
+	results := []models.FAQ{}
+	queryFolded := foldFAQText(query)
+	categoria = foldFAQText(categoria)
+	empresa = foldFAQText(empresa)
 
 	for _, faq := range f.faqs {
 		// Filtrar por categoría si se especifica
-		if categoria != "" && !strings.EqualFold(faq.Categoria, categoria) {
+		if categoria != "" && foldFAQText(faq.Categoria) != categoria {
 			continue
 		}
 
 		// Filtrar por empresa si se especifica
-		if empresa != "" && !strings.EqualFold(faq.Empresa, empresa) {
+		if empresa != "" && foldFAQText(faq.Empresa) != empresa {
 			continue
 		}
 
 		// Si hay query, buscar en pregunta y respuesta
-		if query != "" {
-			preguntaLower := strings.ToLower(faq.Pregunta)
-			respuestaLower := strings.ToLower(faq.Respuesta)
-
-			if !strings.Contains(preguntaLower, queryLower) && !strings.Contains(respuestaLower, queryLower) {
+		if queryFolded != "" {
+			if !strings.Contains(foldFAQText(faq.Pregunta), queryFolded) && !strings.Contains(foldFAQText(faq.Respuesta), queryFolded) {
 				continue
 			}
 		}
@@ -99,6 +95,25 @@ func (f *FAQService) SearchFAQs(query, categoria, empresa string) []models.FAQ {
 	return results
 }
 
+// Version versión del set de FAQs cargado (cambia con cada recarga)
+func (f *FAQService) Version() uint64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.version
+}
+
+// NormalizeFAQQuery forma canónica de una pregunta para cachear respuestas: sin mayúsculas,
+// tildes ni signos ("¿Cómo me registro?" == "como me registro")
+func NormalizeFAQQuery(query string) string {
+	stripped := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return ' '
+	}, query)
+	return foldFAQText(stripped)
+}
+
 func (f *FAQService) GetAllFAQs() []models.FAQ {
 	f.mu.RLock()
 	defer f.mu.RUnlock()
@@ -127,47 +142,21 @@ func (f *FAQService) GetFAQsContext() string {
 	return context.String()
 }
 
-// ReloadFAQs recarga los FAQs desde el archivo CSV
+// ReloadFAQs recarga los FAQs desde el archivo CSV (si falla, se conservan las actuales)
 func ReloadFAQs() {
 	service := GetFAQService()
-	service.mu.Lock()
-	defer service.mu.Unlock()
-
-	// Limpiar FAQs actuales
-	service.faqs = []models.FAQ{}
-
-	// Recargar desde archivo
-	dataDir := config.AppConfig.DataDir
-	file, err := os.Open(filepath.Join(dataDir, "faqs.csv"))
-	if err != nil {
-		log.Printf("Error al abrir FAQs: %v", err)
-		return
-	}
-	defer file.Close()
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+	faqs, err := readFAQsFile()
 	if err != nil {
-		log.Printf("Error al leer FAQs: %v", err)
+		log.Printf("Error al recargar FAQs: %v", err)
 		return
 	}
 
-	// Saltar header
-	for i, record := range records {
-		if i == 0 {
-			continue
-		}
-
-		if len(record) >= 4 {
-			faq := models.FAQ{
-				Categoria: record[0],
-				Empresa:   record[1],
-				Pregunta:  record[2],
-				Respuesta: record[3],
-			}
-			service.faqs = append(service.faqs, faq)
-		}
-	}
+	service.mu.Lock()
+	service.faqs = faqs
+	service.version++
+	service.mu.Unlock()
+	GetFAQAnswerCache().Purge()
 
-	log.Printf("%d FAQs recargadas", len(service.faqs))
+	log.Printf("%d FAQs recargadas", len(faqs))
 }
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"bob-hackathon/internal/config"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metadata de sesión con el seguimiento programado en el engine
+const (
+	followUpIDKey       = "followup_id"
+	followUpCategoryKey = "followup_category"
+)
+
+// FollowUpScheduler programa y cancela mensajes en el engine de WhatsApp
+type FollowUpScheduler interface {
+	Schedule(ctx context.Context, recipient, message string, delay time.Duration) (string, error)
+	Cancel(ctx context.Context, id string) error
+}
+
+// FollowUpService programa un mensaje de seguimiento para los leads hot y warm de WhatsApp
+// (la espera depende de la categoría) y lo cancela si el usuario vuelve a escribir antes.
+// El texto sale de los prompts "followup_<categoría>".
+type FollowUpService struct {
+	scheduler FollowUpScheduler // nil = seguimientos desactivados
+	sessions  *SessionService
+	delays    map[string]time.Duration // categoría → espera; sin entrada = sin seguimiento
+	mu        sync.Mutex               // protege queues (nunca se retiene durante las llamadas al engine)
+	queues    map[string][]func()      // operaciones pendientes por sesión; con entrada = hay un worker
+}
+
+var followUpServiceInstance *FollowUpService
+var followUpServiceOnce sync.Once
+
+func GetFollowUpService() *FollowUpService {
+	followUpServiceOnce.Do(func() {
+		var scheduler FollowUpScheduler
+		if config.AppConfig.EngineBaseURL != "" {
+			scheduler = NewEngineScheduleClient(config.AppConfig.EngineBaseURL, config.AppConfig.EngineAPIToken)
+		} else {
+			log.Println("WHATSAPP_ENGINE_URL no configurado: seguimientos automáticos desactivados")
+		}
+		followUpServiceInstance = NewFollowUpService(scheduler, GetSessionService(), map[string]time.Duration{
+			"hot":  config.AppConfig.FollowUpHotDelay,
+			"warm": config.AppConfig.FollowUpWarmDelay,
+		})
+	})
+	return followUpServiceInstance
+}
+
+func NewFollowUpService(scheduler FollowUpScheduler, sessions *SessionService, delays map[string]time.Duration) *FollowUpService {
+	return &FollowUpService{scheduler: scheduler, sessions: sessions, delays: delays, queues: map[string][]func(){}}
+}
+
+// QueueUserReplied UserReplied en segundo plano, en orden con los demás turnos de la sesión
+func (f *FollowUpService) QueueUserReplied(sessionID string) {
+	if f.scheduler == nil {
+		return
+	}
+	f.enqueue(sessionID, func() { f.UserReplied(context.Background(), sessionID) })
+}
+
+// QueueClassified Classified en segundo plano, en orden con los demás turnos de la sesión:
+// un turno viejo nunca reemplaza el seguimiento de uno más nuevo
+func (f *FollowUpService) QueueClassified(sessionID, recipient, category string) {
+	if f.scheduler == nil || recipient == "" {
+		return
+	}
+	f.enqueue(sessionID, func() { f.Classified(context.Background(), sessionID, recipient, category) })
+}
+
+// enqueue agrega op a la cola de la sesión; un worker por sesión las corre de a una,
+// así que las sesiones no se esperan entre sí
+func (f *FollowUpService) enqueue(sessionID string, op func()) {
+	f.mu.Lock()
+	pending, running := f.queues[sessionID]
+	f.queues[sessionID] = append(pending, op)
+	f.mu.Unlock()
+	if !running {
+		go f.drain(sessionID)
+	}
+}
+
+func (f *FollowUpService) drain(sessionID string) {
+	for {
+		f.mu.Lock()
+		pending := f.queues[sessionID]
+		if len(pending) == 0 {
+			delete(f.queues, sessionID)
+			f.mu.Unlock()
+			return
+		}
+		op := pending[0]
+		f.queues[sessionID] = pending[1:]
+		f.mu.Unlock()
+		op()
+	}
+}
+
+// Classified reemplaza el seguimiento pendiente tras clasificar el turno: queda uno nuevo
+// para recipient contando desde la última respuesta del bot, o ninguno si la categoría no
+// tiene espera (cold/discarded). Solo sesiones de WhatsApp; recipient lo decide quien llama
+// (el controller solo lo pasa en turnos que mandó el bot), nunca se deduce del sessionId.
+// Síncrono: las llamadas de una misma sesión no deben solaparse (el controller usa QueueClassified)
+func (f *FollowUpService) Classified(ctx context.Context, sessionID, recipient, category string) {
+	if f.scheduler == nil || recipient == "" {
+		return
+	}
+	if session := f.sessions.GetSnapshot(sessionID); session == nil || session.Channel != "whatsapp" {
+		return
+	}
+	if !f.cancel(ctx, sessionID) {
+		return // sin cancelar el anterior podrían salir dos
+	}
+	delay := f.delays[category]
+	if delay <= 0 {
+		return
+	}
+
+	message, err := GetPromptStore().Render("followup_"+category, PromptData{SessionID: sessionID, Channel: "whatsapp"})
+	if err != nil {
+		log.Printf("⚠️ Error en prompt followup_%s: %v", category, err)
+		return
+	}
+	id, err := f.scheduler.Schedule(ctx, recipient, strings.TrimSpace(message), delay)
+	if err != nil {
+		log.Printf("⚠️ No se pudo programar el seguimiento de %s: %v", sessionID, err)
+		return
+	}
+	f.sessions.SetMetadata(sessionID, followUpIDKey, id)
+	f.sessions.SetMetadata(sessionID, followUpCategoryKey, category)
+	log.Printf("⏰ Seguimiento %s programado para %s en %s (lead %s)", id, sessionID, delay, category)
+}
+
+// UserReplied cancela el seguimiento pendiente: el usuario volvió a escribir
+// (síncrono, como Classified; el controller usa QueueUserReplied)
+func (f *FollowUpService) UserReplied(ctx context.Context, sessionID string) {
+	if f.scheduler == nil {
+		return
+	}
+	f.cancel(ctx, sessionID)
+}
+
+// cancel false si no se pudo cancelar (el id queda en metadata para reintentar)
+func (f *FollowUpService) cancel(ctx context.Context, sessionID string) bool {
+	id := f.sessions.GetMetadata(sessionID, followUpIDKey)
+	if id == "" {
+		return true
+	}
+	err := f.scheduler.Cancel(ctx, id)
+	if err != nil && !errors.Is(err, ErrFollowUpGone) {
+		log.Printf("⚠️ No se pudo cancelar el seguimiento %s de %s: %v", id, sessionID, err)
+		return false
+	}
+	f.sessions.SetMetadata(sessionID, followUpIDKey, "")
+	f.sessions.SetMetadata(sessionID, followUpCategoryKey, "")
+	if err == nil {
+		log.Printf("⏰ Seguimiento %s de %s cancelado", id, sessionID)
+	}
+	return true
+}
+
+// ErrFollowUpGone el programado ya salió o ya estaba cancelado
+var ErrFollowUpGone = errors.New("seguimiento ya enviado o cancelado")
+
+// EngineScheduleClient cliente de /api/schedule del engine de WhatsApp
+type EngineScheduleClient struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+func NewEngineScheduleClient(baseURL, token string) *EngineScheduleClient {
+	return &EngineScheduleClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		httpClient: &http.Client{
+			Timeout: 5 * time.Second,
+		},
+	}
+}
+
+// Schedule POST /api/schedule con delay; devuelve el id del programado
+func (e *EngineScheduleClient) Schedule(ctx context.Context, recipient, message string, delay time.Duration) (string, error) {
+	body, err := json.Marshal(map[string]string{
+		"recipient": recipient,
+		"message":   message,
+		"delay":     delay.String(),
+	})
+	if err != nil {
+		return "", err
+	}
+	resp, err := e.do(ctx, http.MethodPost, "/api/schedule", body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("engine devolvió status %d", resp.StatusCode)
+	}
+	var out struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("respuesta inválida del engine: %w", err)
+	}
+	return strconv.FormatInt(out.ID, 10), nil
+}
+
+// Cancel DELETE /api/schedule/{id}; 404 = ErrFollowUpGone
+func (e *EngineScheduleClient) Cancel(ctx context.Context, id string) error {
+	resp, err := e.do(ctx, http.MethodDelete, "/api/schedule/"+id, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrFollowUpGone
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("engine devolvió status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (e *EngineScheduleClient) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, e.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if e.token != "" {
+		req.Header.Set("Authorization", "Bearer "+e.token)
+	}
+	return e.httpClient.Do(req)
+}
+
+func init() {
+	RegisterDefaultPrompt("followup_hot", followUpHotTemplate)
+	RegisterDefaultPrompt("followup_warm", followUpWarmTemplate)
+}
+
+// Mensajes de seguimiento por categoría (editables vía /api/admin/prompts/followup_*)
+const followUpHotTemplate = `¡Hola! 👋 Te escribo de BOB Subastas. ¿Pudiste revisar las opciones que conversamos? Si quieres te ayudo a registrarte para ofertar o te paso con un asesor.`
+
+const followUpWarmTemplate = `¡Hola! 😊 Te escribo de BOB Subastas por si te quedó alguna duda. Cada semana entran vehículos nuevos: cuéntame qué buscas y te aviso cuando haya uno que encaje.`
@@ -0,0 +1,237 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubScheduler registra lo programado y lo cancelado, sin engine
+type stubScheduler struct {
+	mu        sync.Mutex
+	block     map[string]chan struct{} // recipient → Schedule espera hasta que se cierre
+	nextID    int
+	scheduled map[string]scheduledFollowUp
+	canceled  []string
+	cancelErr error
+}
+
+type scheduledFollowUp struct {
+	recipient, message string
+	delay              time.Duration
+}
+
+func newStubScheduler() *stubScheduler {
+	return &stubScheduler{scheduled: map[string]scheduledFollowUp{}}
+}
+
+func (s *stubScheduler) Schedule(ctx context.Context, recipient, message string, delay time.Duration) (string, error) {
+	if gate := s.block[recipient]; gate != nil {
+		<-gate
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	id := strconv.Itoa(s.nextID)
+	s.scheduled[id] = scheduledFollowUp{recipient, message, delay}
+	return id, nil
+}
+
+func (s *stubScheduler) Cancel(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancelErr != nil {
+		return s.cancelErr
+	}
+	s.canceled = append(s.canceled, id)
+	return nil
+}
+
+func newTestFollowUps(t *testing.T) (*FollowUpService, *stubScheduler, *SessionService) {
+	t.Helper()
+	sched := newStubScheduler()
+	sessions := newTestSessionService(t)
+	f := NewFollowUpService(sched, sessions, map[string]time.Duration{"hot": time.Hour, "warm": 6 * time.Hour})
+	return f, sched, sessions
+}
+
+func TestFollowUpHotLeadScheduledAndCanceledOnReply(t *testing.T) {
+	f, sched, sessions := newTestFollowUps(t)
+	const sessionID, phone = "wa-51911000090", "51911000090"
+	sessions.GetOrCreateSession(sessionID, "whatsapp")
+
+	f.Classified(context.Background(), sessionID, phone, "hot")
+	got, ok := sched.scheduled["1"]
+	if !ok {
+		t.Fatalf("hot lead not scheduled: %+v", sched.scheduled)
+	}
+	if got.recipient != "51911000090" || got.delay != time.Hour || !strings.Contains(got.message, "BOB Subastas") {
+		t.Fatalf("scheduled = %+v", got)
+	}
+	if id := sessions.GetMetadata(sessionID, followUpIDKey); id != "1" {
+		t.Fatalf("followup_id = %q, want 1", id)
+	}
+
+	// el usuario escribe antes de que salga: se cancela
+	f.UserReplied(context.Background(), sessionID)
+	if len(sched.canceled) != 1 || sched.canceled[0] != "1" {
+		t.Fatalf("canceled = %v, want [1]", sched.canceled)
+	}
+	if id := sessions.GetMetadata(sessionID, followUpIDKey); id != "" {
+		t.Fatalf("followup_id = %q after reply", id)
+	}
+	f.UserReplied(context.Background(), sessionID)
+	if len(sched.canceled) != 1 {
+		t.Fatalf("second reply canceled again: %v", sched.canceled)
+	}
+}
+
+func TestFollowUpReclassification(t *testing.T) {
+	f, sched, sessions := newTestFollowUps(t)
+	const sessionID, phone = "wa-51911000091", "51911000091"
+	sessions.GetOrCreateSession(sessionID, "whatsapp")
+
+	f.Classified(context.Background(), sessionID, phone, "warm")
+	if got := sched.scheduled["1"]; got.delay != 6*time.Hour {
+		t.Fatalf("warm delay = %s", got.delay)
+	}
+	// pasa a hot: reemplaza el pendiente, nunca quedan dos
+	f.Classified(context.Background(), sessionID, phone, "hot")
+	if len(sched.canceled) != 1 || sched.canceled[0] != "1" || sched.scheduled["2"].delay != time.Hour {
+		t.Fatalf("canceled = %v scheduled = %+v", sched.canceled, sched.scheduled)
+	}
+	// cold: sin seguimiento
+	f.Classified(context.Background(), sessionID, phone, "cold")
+	if len(sched.scheduled) != 2 || sessions.GetMetadata(sessionID, followUpIDKey) != "" {
+		t.Fatalf("cold lead kept a follow-up: %+v", sched.scheduled)
+	}
+}
+
+func TestFollowUpSkipsWhenCancelFails(t *testing.T) {
+	f, sched, sessions := newTestFollowUps(t)
+	const sessionID, phone = "wa-51911000092", "51911000092"
+	sessions.GetOrCreateSession(sessionID, "whatsapp")
+
+	f.Classified(context.Background(), sessionID, phone, "hot")
+	sched.cancelErr = errors.New("engine caído")
+	f.Classified(context.Background(), sessionID, phone, "hot")
+	if len(sched.scheduled) != 1 || sessions.GetMetadata(sessionID, followUpIDKey) != "1" {
+		t.Fatalf("scheduled a second follow-up without canceling the first: %+v", sched.scheduled)
+	}
+
+	// ya enviado o cancelado en el engine cuenta como cancelado
+	sched.cancelErr = ErrFollowUpGone
+	f.UserReplied(context.Background(), sessionID)
+	if id := sessions.GetMetadata(sessionID, followUpIDKey); id != "" {
+		t.Fatalf("followup_id = %q after ErrFollowUpGone", id)
+	}
+}
+
+func TestFollowUpQueueKeepsTurnOrder(t *testing.T) {
+	f, sched, sessions := newTestFollowUps(t)
+	const slow, other = "wa-51911000094", "wa-51911000095"
+	sessions.GetOrCreateSession(slow, "whatsapp")
+	sessions.GetOrCreateSession(other, "whatsapp")
+	release := make(chan struct{})
+	sched.block = map[string]chan struct{}{"51911000094": release}
+
+	// tres turnos de la misma sesión; el primero queda colgado en el engine
+	f.QueueClassified(slow, "51911000094", "hot")
+	f.QueueUserReplied(slow)
+	f.QueueClassified(slow, "51911000094", "warm")
+
+	// otra sesión no espera a la que está colgada
+	done := make(chan struct{})
+	go func() {
+		f.Classified(context.Background(), other, "51911000095", "hot")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("a slow engine call blocked another session")
+	}
+
+	close(release)
+	deadline := time.Now().Add(2 * time.Second)
+	for sessions.GetMetadata(slow, followUpCategoryKey) != "warm" {
+		if time.Now().After(deadline) {
+			t.Fatalf("followup_category = %q, want the last turn (warm)", sessions.GetMetadata(slow, followUpCategoryKey))
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// el hot del primer turno se canceló al responder; solo queda el warm
+	sched.mu.Lock()
+	defer sched.mu.Unlock()
+	id := sessions.GetMetadata(slow, followUpIDKey)
+	if sched.scheduled[id].delay != 6*time.Hour || len(sched.canceled) != 1 || sched.canceled[0] == id {
+		t.Fatalf("followup %s, canceled %v", id, sched.canceled)
+	}
+}
+
+func TestFollowUpOnlyWhatsApp(t *testing.T) {
+	f, sched, sessions := newTestFollowUps(t)
+	sessions.GetOrCreateSession("web-1", "web")
+	f.Classified(context.Background(), "web-1", "51911000093", "hot")
+	// un "wa-" creado desde la web sigue siendo web
+	sessions.GetOrCreateSession("wa-51911000096", "web")
+	f.Classified(context.Background(), "wa-51911000096", "51911000096", "hot")
+	// sin recipient (el turno no vino del bot) tampoco
+	sessions.GetOrCreateSession("wa-51911000097", "whatsapp")
+	f.Classified(context.Background(), "wa-51911000097", "", "hot")
+	f.QueueClassified("wa-51911000097", "", "hot")
+	if len(sched.scheduled) != 0 {
+		t.Fatalf("follow-up scheduled outside a bot WhatsApp turn: %+v", sched.scheduled)
+	}
+
+	// sin engine configurado no hace nada
+	off := NewFollowUpService(nil, sessions, map[string]time.Duration{"hot": time.Hour})
+	off.Classified(context.Background(), "wa-51911000093", "51911000093", "hot")
+	off.UserReplied(context.Background(), "wa-51911000093")
+}
+
+func TestEngineScheduleClient(t *testing.T) {
+	var body map[string]string
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/schedule":
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Errorf("decode: %v", err)
+			}
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"success":true,"id":42}`))
+		case r.Method == http.MethodDelete && r.URL.Path == "/api/schedule/42":
+			_, _ = w.Write([]byte(`{"success":true}`))
+		case r.Method == http.MethodDelete:
+			http.Error(w, "not found", http.StatusNotFound)
+		default:
+			http.Error(w, "unexpected", http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewEngineScheduleClient(srv.URL+"/", "secreto")
+	id, err := c.Schedule(context.Background(), "51911000094", "hola", 90*time.Minute)
+	if err != nil || id != "42" {
+		t.Fatalf("Schedule = %q, %v", id, err)
+	}
+	if body["recipient"] != "51911000094" || body["message"] != "hola" || body["delay"] != "1h30m0s" || auth != "Bearer secreto" {
+		t.Fatalf("request body = %v auth = %q", body, auth)
+	}
+	if err := c.Cancel(context.Background(), "42"); err != nil {
+		t.Fatalf("Cancel = %v", err)
+	}
+	if err := c.Cancel(context.Background(), "43"); !errors.Is(err, ErrFollowUpGone) {
+		t.Fatalf("Cancel missing = %v, want ErrFollowUpGone", err)
+	}
+}
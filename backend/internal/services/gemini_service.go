@@ -2,23 +2,27 @@ package services
 
 import (
 	"bob-hackathon/internal/config"
+	"bob-hackathon/internal/llm"
+	"bob-hackathon/internal/metrics"
 	"bob-hackathon/internal/models"
+	"bob-hackathon/internal/utils"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"strings"
 	"sync"
 	"time"
-
-	"github.com/google/generative-ai-go/genai"
-	"google.golang.org/api/option"
 )
 
+// GeminiService chat single-shot, scoring legacy, resúmenes, transcripción y OCR sobre el
+// proveedor de LLM configurado (LLM_PROVIDER; el nombre viene de cuando solo había Gemini)
 type GeminiService struct {
-	client *genai.Client
-	model  *genai.GenerativeModel
-	mu     sync.Mutex
+	provider  llm.Provider
+	opts      llm.Options
+	mu        sync.Mutex
+	closeOnce sync.Once
 }
 
 var geminiServiceInstance *GeminiService
@@ -26,27 +30,31 @@ var geminiServiceOnce sync.Once
 
 func GetGeminiService() *GeminiService {
 	geminiServiceOnce.Do(func() {
-		ctx := context.Background()
-		client, err := genai.NewClient(ctx, option.WithAPIKey(config.AppConfig.GeminiAPIKey))
+		provider, err := llm.New(context.Background(), llmConfig())
 		if err != nil {
-			log.Fatalf("Error al crear cliente Gemini: %v", err)
+			log.Fatalf("Error al crear proveedor de LLM: %v", err)
 		}
 
-		model := client.GenerativeModel(config.AppConfig.GeminiModel)
-		model.SetTemperature(0.7)
-		model.SetTopP(0.9)
-		model.SetTopK(40)
-
-		geminiServiceInstance = &GeminiService{
-			client: client,
-			model:  model,
-		}
+		geminiServiceInstance = NewGeminiService(provider, llm.Options(config.AppConfig.ChatGeneration))
 
-		log.Printf("Servicio Gemini inicializado con modelo: %s", config.AppConfig.GeminiModel)
+		log.Printf("Servicio LLM inicializado: %s, modelo: %s", provider.Name(), config.AppConfig.ModelName())
 	})
 	return geminiServiceInstance
 }
 
+func NewGeminiService(provider llm.Provider, opts llm.Options) *GeminiService {
+	return &GeminiService{provider: provider, opts: opts}
+}
+
+// llmConfig proveedor según LLM_PROVIDER (gemini usa GEMINI_API_KEY y GEMINI_MODEL)
+func llmConfig() llm.Config {
+	cfg := config.AppConfig
+	if cfg.LLMProvider == "gemini" {
+		return llm.Config{Provider: "gemini", APIKey: cfg.GeminiAPIKey, Model: cfg.GeminiModel}
+	}
+	return llm.Config{Provider: cfg.LLMProvider, BaseURL: cfg.LLMBaseURL, APIKey: cfg.LLMAPIKey, Model: cfg.LLMModel}
+}
+
 func (g *GeminiService) ProcessMessage(sessionID, userMessage string) (string, error) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
@@ -58,12 +66,21 @@ func (g *GeminiService) ProcessMessage(sessionID, userMessage string) (string, e
 	// Obtener historial de conversación
 	sessionService := GetSessionService()
 	messages := sessionService.GetMessages(sessionID)
+	// Si el controlador ya guardó el mensaje del usuario, no duplicarlo en el prompt
+	if n := len(messages); n > 0 && messages[n-1].Role == "user" && messages[n-1].Content == userMessage {
+		messages = messages[:n-1]
+	}
 
 	// Construir contexto
 	faqService := GetFAQService()
 	bobAPIService := GetBOBAPIService()
 
-	systemPrompt := g.buildSystemPrompt()
+	channel := ""
+	if session := sessionService.GetSession(sessionID); session != nil {
+		channel = session.Channel
+	}
+
+	systemPrompt := g.buildSystemPrompt(channel)
 	faqContext := faqService.GetFAQsContext()
 	vehiclesContext := bobAPIService.GetVehiclesContext(5)
 
@@ -84,17 +101,13 @@ func (g *GeminiService) ProcessMessage(sessionID, userMessage string) (string, e
 	conversationHistory.WriteString("assistant: ")
 
 	// Generar respuesta
-	resp, err := g.model.GenerateContent(ctx, genai.Text(conversationHistory.String()))
+	start := time.Now()
+	reply, err := g.provider.Generate(ctx, []llm.Part{llm.Text(conversationHistory.String())}, g.opts)
+	metrics.ObserveGemini("gemini_chat", start, err)
 	if err != nil {
 		return "", fmt.Errorf("error al generar respuesta: %w", err)
 	}
 
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return "", fmt.Errorf("no se recibió respuesta del modelo")
-	}
-
-	reply := fmt.Sprintf("%v", resp.Candidates[0].Content.Parts[0])
-
 	log.Printf("Respuesta generada para sesión %s", sessionID)
 	return reply, nil
 }
@@ -152,22 +165,16 @@ Criterios de scoring:
 - Intención de compra explícita: +10 puntos
 - Solo curiosidad o preguntas muy generales: -20 puntos`, conversationText.String())
 
-	resp, err := g.model.GenerateContent(ctx, genai.Text(scoringPrompt))
+	start := time.Now()
+	responseText, err := g.provider.Generate(ctx, []llm.Part{llm.Text(scoringPrompt)}, g.opts)
+	metrics.ObserveGemini("gemini_scoring", start, err)
 	if err != nil {
 		return nil, fmt.Errorf("error al calcular score: %w", err)
 	}
 
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return nil, fmt.Errorf("no se recibió respuesta del modelo para scoring")
-	}
-
-	responseText := fmt.Sprintf("%v", resp.Candidates[0].Content.Parts[0])
-
 	// Extraer JSON de la respuesta
-	jsonStart := strings.Index(responseText, "{")
-	jsonEnd := strings.LastIndex(responseText, "}")
-
-	if jsonStart == -1 || jsonEnd == -1 {
+	jsonText, err := utils.ExtractJSON(responseText)
+	if err != nil {
 		log.Printf("No se pudo parsear respuesta de scoring: %s", responseText)
 		return &models.ScoreResponse{
 			Success:      true,
@@ -180,8 +187,6 @@ Criterios de scoring:
 		}, nil
 	}
 
-	jsonText := responseText[jsonStart : jsonEnd+1]
-
 	var scoreData struct {
 		Score        int      `json:"score"`
 		Category     string   `json:"category"`
@@ -218,8 +223,98 @@ Criterios de scoring:
 	return scoreResponse, nil
 }
 
-func (g *GeminiService) buildSystemPrompt() string {
-	return `Eres un asistente virtual de BOB Subastas, una plataforma líder en Perú para subastas de vehículos e inmuebles.
+// buildSystemPrompt elige el prompt de sistema según el canal de la sesión:
+// "system_<canal>" si existe (editable vía /api/admin/prompts), si no "system".
+// Generate implementa TextGenerator con el proveedor de LLM
+func (g *GeminiService) Generate(ctx context.Context, prompt string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	text, err := g.provider.Generate(ctx, []llm.Part{llm.Text(prompt)}, g.opts)
+	metrics.ObserveGemini("gemini_generate", start, err)
+	if err != nil {
+		return "", fmt.Errorf("error al generar respuesta: %w", err)
+	}
+	return text, nil
+}
+
+func (g *GeminiService) buildSystemPrompt(channel string) string {
+	store := GetPromptStore()
+	name := "system"
+	if channel = strings.ToLower(strings.TrimSpace(channel)); channel != "" && store.Has("system_"+channel) {
+		name = "system_" + channel
+	}
+	data := PromptData{Channel: channel}
+	prompt, err := store.Render(name, data)
+	if err != nil {
+		log.Printf("⚠️ Error en prompt %s, usando default: %v", name, err)
+		return defaultSystemPrompt
+	}
+	return prompt
+}
+
+func init() {
+	RegisterDefaultPrompt("system", defaultSystemPrompt)
+	for channel, prompt := range channelSystemPrompts {
+		RegisterDefaultPrompt("system_"+channel, prompt)
+	}
+}
+
+// channelSystemPrompts variantes por canal (se pueden sobreescribir por admin)
+var channelSystemPrompts = map[string]string{
+	"whatsapp": `Eres un asistente virtual de BOB Subastas, una plataforma líder en Perú para subastas de vehículos e inmuebles. Estás respondiendo por WhatsApp.
+
+PERSONALIDAD:
+- Amigable, profesional y conversacional
+- Muy breve: máximo 2-3 líneas por respuesta, como un chat entre personas
+- Usa emojis ocasionalmente
+- Tutea al usuario
+
+FORMATO (WhatsApp):
+- Solo texto plano: NADA de tablas, encabezados (#) ni enlaces markdown
+- Para resaltar usa *asteriscos simples*, nunca **dobles**
+- Si necesitas enumerar, máximo 3 ítems en líneas cortas
+- Termina con una sola pregunta para seguir la conversación
+
+OBJETIVO:
+- Ayudar a encontrar vehículos en subasta
+- Responder preguntas sobre el proceso
+- Calificar el interés del lead
+
+Ejemplo:
+Usuario: "Busco un auto"
+Tú: "¡Perfecto! 🚗 Tenemos varias opciones en subasta. ¿Tienes alguna marca en mente y qué presupuesto manejas?"`,
+
+	"web": `Eres un asistente virtual de BOB Subastas, una plataforma líder en Perú para subastas de vehículos e inmuebles. Estás respondiendo en el chat de la web.
+
+PERSONALIDAD:
+- Amigable, profesional y conversacional
+- Breve y directo (máximo 5 líneas)
+- Usa emojis ocasionalmente
+- Tutea al usuario
+
+FORMATO (web):
+- Puedes usar markdown: **negritas**, listas cortas y, si comparas vehículos, una tabla pequeña
+- No repitas información que ya diste en la conversación
+
+OBJETIVO:
+- Ayudar a encontrar vehículos en subasta
+- Responder preguntas sobre el proceso
+- Calificar el interés del lead
+
+REGLAS:
+1. Si preguntan por vehículos, usa los datos disponibles
+2. Si no sabes algo, revisa las FAQs
+3. Invita a dar más detalles sobre necesidades
+
+Ejemplo:
+Usuario: "Busco un auto"
+Tú: "¡Perfecto! 🚗 Tenemos varias opciones en subasta. ¿Tienes alguna **marca o modelo** en mente? ¿Y qué presupuesto manejas?"`,
+}
+
+// defaultSystemPrompt se usa para canales sin variante (p. ej. api)
+const defaultSystemPrompt = `Eres un asistente virtual de BOB Subastas, una plataforma líder en Perú para subastas de vehículos e inmuebles.
 
 PERSONALIDAD:
 - Amigable, profesional y conversacional
@@ -242,10 +337,17 @@ REGLAS:
 Ejemplo:
 Usuario: "Busco un auto"
 Tú: "¡Perfecto! 🚗 Tenemos varias opciones en subasta. ¿Tienes alguna marca o modelo en mente? ¿Y qué presupuesto manejas?"`
+
+// Provider proveedor compartido por el servicio y todos los agentes (una sola conexión)
+func (g *GeminiService) Provider() llm.Provider {
+	return g.provider
 }
 
+// Close cierra el proveedor compartido si tiene conexión propia; llamadas posteriores no hacen nada
 func (g *GeminiService) Close() {
-	if g.client != nil {
-		g.client.Close()
-	}
+	g.closeOnce.Do(func() {
+		if closer, ok := g.provider.(io.Closer); ok {
+			closer.Close()
+		}
+	})
 }
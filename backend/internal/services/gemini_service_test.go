@@ -0,0 +1,81 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"bob-hackathon/internal/llm"
+)
+
+func TestBuildSystemPromptPerChannel(t *testing.T) {
+	g := &GeminiService{}
+	cases := []struct {
+		channel string
+		want    string
+		wantNot string
+	}{
+		{"whatsapp", "Estás respondiendo por WhatsApp", "chat de la web"},
+		{" WhatsApp ", "Estás respondiendo por WhatsApp", "chat de la web"},
+		{"web", "Estás respondiendo en el chat de la web", "WhatsApp"},
+		{"api", "Sé conversacional, no uses bullet points", "WhatsApp"},
+		{"", "Sé conversacional, no uses bullet points", "WhatsApp"},
+	}
+	for _, c := range cases {
+		got := g.buildSystemPrompt(c.channel)
+		if !strings.Contains(got, c.want) {
+			t.Errorf("channel %q: prompt missing %q", c.channel, c.want)
+		}
+		if strings.Contains(got, c.wantNot) {
+			t.Errorf("channel %q: prompt contains %q", c.channel, c.wantNot)
+		}
+	}
+}
+
+func TestBuildSystemPromptAdminOverride(t *testing.T) {
+	store := GetPromptStore()
+	if err := store.Update("system_whatsapp", "Prompt editado para {{.Channel}}"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Remove(filepath.Join(testDataDir, "prompts", "system_whatsapp.txt"))
+		os.RemoveAll(filepath.Join(testDataDir, "prompts", "versions"))
+	})
+
+	g := &GeminiService{}
+	if got := g.buildSystemPrompt("whatsapp"); got != "Prompt editado para whatsapp" {
+		t.Fatalf("whatsapp prompt = %q", got)
+	}
+	// la edición de un canal no toca a los otros
+	if got := g.buildSystemPrompt("web"); !strings.Contains(got, "chat de la web") {
+		t.Fatalf("web prompt changed: %q", got)
+	}
+}
+
+// closeCounter proveedor con conexión propia (io.Closer)
+type closeCounter struct {
+	*llm.MockProvider
+	closed int
+}
+
+func (c *closeCounter) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestGeminiServiceClosesProviderOnce(t *testing.T) {
+	p := &closeCounter{MockProvider: llm.NewMockProvider()}
+	g := NewGeminiService(p, llm.Options{})
+	if g.Provider() != p {
+		t.Fatal("Provider() is not the injected provider")
+	}
+	g.Close()
+	g.Close()
+	if p.closed != 1 {
+		t.Fatalf("provider closed %d times, want 1", p.closed)
+	}
+
+	// un proveedor sin Close (mock/openai) no rompe el apagado
+	NewGeminiService(llm.NewMockProvider(), llm.Options{}).Close()
+}
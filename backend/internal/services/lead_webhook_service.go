@@ -0,0 +1,66 @@
+package services
+
+import (
+	"bob-hackathon/internal/config"
+	"bob-hackathon/internal/models"
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// LeadWebhookService notifica eventos de leads (ej: handoff a humano) a un webhook externo
+type LeadWebhookService struct {
+	url        string
+	httpClient *http.Client
+}
+
+var leadWebhookServiceInstance *LeadWebhookService
+var leadWebhookServiceOnce sync.Once
+
+func GetLeadWebhookService() *LeadWebhookService {
+	leadWebhookServiceOnce.Do(func() {
+		leadWebhookServiceInstance = &LeadWebhookService{
+			url: config.AppConfig.LeadWebhookURL,
+			httpClient: &http.Client{
+				Timeout: 5 * time.Second,
+			},
+		}
+		if leadWebhookServiceInstance.url == "" {
+			log.Println("LEAD_WEBHOOK_URL no configurado: los eventos de leads solo se registran en el log")
+		}
+	})
+	return leadWebhookServiceInstance
+}
+
+// Emit envía el evento en segundo plano; sin URL solo lo registra en el log
+func (w *LeadWebhookService) Emit(event models.LeadEvent) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	log.Printf("📣 Evento de lead %s: sesión %s (%s)", event.Event, event.SessionID, event.Reason)
+	if w.url == "" {
+		return
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error serializando evento de lead: %v", err)
+		return
+	}
+
+	go func() {
+		resp, err := w.httpClient.Post(w.url, "application/json", bytes.NewReader(data))
+		if err != nil {
+			log.Printf("Error enviando evento %s al webhook de leads: %v", event.Event, err)
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Printf("Webhook de leads devolvió status %d para evento %s", resp.StatusCode, event.Event)
+		}
+	}()
+}
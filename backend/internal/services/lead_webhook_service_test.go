@@ -0,0 +1,51 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"bob-hackathon/internal/models"
+)
+
+func TestLeadWebhookEmit(t *testing.T) {
+	got := make(chan models.LeadEvent, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event models.LeadEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		got <- event
+	}))
+	defer srv.Close()
+
+	w := &LeadWebhookService{url: srv.URL, httpClient: srv.Client()}
+	w.Emit(models.LeadEvent{Event: "handoff", SessionID: "s1", Reason: "hot_lead", LeadScore: 90})
+
+	select {
+	case event := <-got:
+		if event.Event != "handoff" || event.SessionID != "s1" || event.Reason != "hot_lead" || event.LeadScore != 90 {
+			t.Fatalf("event = %+v", event)
+		}
+		if event.Timestamp.IsZero() {
+			t.Fatal("timestamp not set")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook not called")
+	}
+}
+
+func TestLeadWebhookEmitWithoutURL(t *testing.T) {
+	// sin URL solo se registra en el log: no debe intentar ninguna request
+	w := &LeadWebhookService{httpClient: &http.Client{Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+		t.Fatal("unexpected request")
+		return nil, nil
+	})}}
+	w.Emit(models.LeadEvent{Event: "handoff", SessionID: "s2"})
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
@@ -0,0 +1,24 @@
+package services
+
+import (
+	"os"
+	"testing"
+
+	"bob-hackathon/internal/config"
+)
+
+// testDataDir DATA_DIR temporal compartido por los singletons del paquete
+var testDataDir string
+
+// TestMain config mínima: DataDir temporal (prompts por defecto, sin CSVs) y sin API key
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "services-test")
+	if err != nil {
+		panic(err)
+	}
+	testDataDir = dir
+	config.AppConfig = &config.Config{DataDir: dir, LLMProvider: "mock", USDToPEN: 3.75, ScoringMinMessages: 6}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
@@ -0,0 +1,247 @@
+package services
+
+import (
+	"bob-hackathon/internal/config"
+	"bob-hackathon/internal/models"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Tope de una imagen, documento o nota de voz adjunta al chat (Gemini acepta hasta ~20 MB inline;
+// las fotos y audios de WhatsApp pesan mucho menos)
+const MaxChatMediaBytes = 5 << 20
+
+// Tipos de imagen, documento y audio que acepta Gemini (las notas de voz de WhatsApp son audio/ogg opus)
+var chatMediaTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/webp":      true,
+	"image/heic":      true,
+	"image/heif":      true,
+	"application/pdf": true,
+	"audio/ogg":       true,
+	"audio/mpeg":      true,
+	"audio/mp3":       true,
+	"audio/mp4":       true,
+	"audio/aac":       true,
+	"audio/wav":       true,
+	"audio/flac":      true,
+}
+
+var mediaHTTPClient = newMediaHTTPClient()
+
+// errMediaAddress la url (o un redirect) apunta a una IP interna o a un host fuera de MEDIA_ALLOWED_HOSTS
+var errMediaAddress = errors.New("media: la url apunta a una dirección no permitida")
+
+// newMediaHTTPClient cliente para las url de media que evita SSRF: la IP se valida al
+// conectar (después de resolver DNS), así que también cubre cada redirect.
+func newMediaHTTPClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return errMediaAddress
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // un proxy saltaría el chequeo de IP
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 3 {
+				return errors.New("media: demasiados redirects")
+			}
+			if !allowedMediaURL(req.URL) {
+				return errMediaAddress
+			}
+			return nil
+		},
+	}
+}
+
+// isPublicIP descarta loopback, redes privadas, link-local (metadata de la nube),
+// multicast y no especificadas
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// allowedMediaURL http(s) y, si MEDIA_ALLOWED_HOSTS no está vacío, un host de la lista
+// (exacto o "*.dominio")
+func allowedMediaURL(u *url.URL) bool {
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return false
+	}
+	allowed := config.AppConfig.MediaAllowedHosts
+	if len(allowed) == 0 {
+		return true
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(pattern)
+		if host == pattern || (strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+// ChatMediaData imagen, documento o audio listo para el modelo, con la referencia que se guarda en el mensaje
+type ChatMediaData struct {
+	MimeType string
+	Data     []byte
+	Ref      *models.MediaRef
+}
+
+// IsAudio nota de voz: se transcribe en vez de pasarla a los agentes
+func (m *ChatMediaData) IsAudio() bool {
+	return strings.HasPrefix(m.MimeType, "audio/")
+}
+
+// IsDocument PDF: los agentes reciben solo el texto extraído
+func (m *ChatMediaData) IsDocument() bool {
+	return m.MimeType == "application/pdf"
+}
+
+// MediaError la media del request no es válida (400 para el cliente)
+type MediaError struct {
+	Message string
+}
+
+func (e *MediaError) Error() string {
+	return e.Message
+}
+
+// LoadChatMedia descarga (url) o decodifica (data base64) la media adjunta y valida
+// tamaño y tipo. El tipo declarado manda; si falta, se detecta del contenido.
+func LoadChatMedia(ctx context.Context, m *models.ChatMedia) (*ChatMediaData, error) {
+	var data []byte
+	var contentType string
+	switch {
+	case m.URL != "" && m.Data != "":
+		return nil, &MediaError{"media: url y data son excluyentes"}
+	case m.Data != "":
+		raw := m.Data
+		// admite data URIs ("data:image/jpeg;base64,...")
+		if header, payload, ok := strings.Cut(raw, ","); ok && strings.HasPrefix(header, "data:") {
+			raw = payload
+			contentType = strings.TrimSuffix(strings.TrimPrefix(header, "data:"), ";base64")
+		}
+		decoded, err := base64.StdEncoding.DecodeString(raw)
+		if err != nil {
+			return nil, &MediaError{"media: data no es base64 válido"}
+		}
+		data = decoded
+	case m.URL != "":
+		fetched, ct, err := fetchChatMedia(ctx, m.URL)
+		if err != nil {
+			return nil, err
+		}
+		data, contentType = fetched, ct
+	default:
+		return nil, &MediaError{"media: falta url o data"}
+	}
+
+	if len(data) == 0 {
+		return nil, &MediaError{"media: archivo vacío"}
+	}
+	if len(data) > MaxChatMediaBytes {
+		return nil, &MediaError{fmt.Sprintf("media: el archivo supera %d bytes", MaxChatMediaBytes)}
+	}
+
+	mimeType := normalizeMime(m.MimeType)
+	if mimeType == "" {
+		mimeType = normalizeMime(contentType)
+	}
+	if !chatMediaTypes[mimeType] {
+		mimeType = normalizeMime(http.DetectContentType(data))
+	}
+	if !chatMediaTypes[mimeType] {
+		return nil, &MediaError{"media: solo se aceptan imágenes (jpeg, png, webp, heic), documentos PDF o notas de voz (ogg, mp3, m4a, aac, wav, flac)"}
+	}
+
+	sum := sha256.Sum256(data)
+	return &ChatMediaData{
+		MimeType: mimeType,
+		Data:     data,
+		Ref: &models.MediaRef{
+			MimeType: mimeType,
+			URL:      m.URL,
+			SHA256:   hex.EncodeToString(sum[:]),
+			Size:     len(data),
+		},
+	}, nil
+}
+
+// fetchChatMedia GET del archivo con tope de tamaño; devuelve el Content-Type recibido.
+// Solo hosts públicos (y de MEDIA_ALLOWED_HOSTS si está configurado), también tras redirects.
+func fetchChatMedia(ctx context.Context, rawURL string) ([]byte, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, "", &MediaError{"media: url inválida (http/https)"}
+	}
+	if !allowedMediaURL(u) {
+		return nil, "", &MediaError{errMediaAddress.Error()}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", &MediaError{"media: url inválida"}
+	}
+	resp, err := mediaHTTPClient.Do(req)
+	if errors.Is(err, errMediaAddress) {
+		return nil, "", &MediaError{errMediaAddress.Error()}
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("descargando media: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", &MediaError{fmt.Sprintf("media: la url respondió %d", resp.StatusCode)}
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxChatMediaBytes+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("descargando media: %w", err)
+	}
+	return data, resp.Header.Get("Content-Type"), nil
+}
+
+func normalizeMime(s string) string {
+	if s == "" {
+		return ""
+	}
+	t, _, err := mime.ParseMediaType(s)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(s))
+	}
+	switch t {
+	case "image/jpg":
+		return "image/jpeg"
+	case "application/ogg", "audio/opus":
+		return "audio/ogg"
+	case "audio/x-wav", "audio/wave":
+		return "audio/wav"
+	case "audio/x-m4a", "audio/m4a":
+		return "audio/mp4"
+	}
+	return t
+}
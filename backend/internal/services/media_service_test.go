@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"bob-hackathon/internal/config"
+	"bob-hackathon/internal/models"
+)
+
+func TestLoadChatMediaFromURL(t *testing.T) {
+	jpeg := "\xff\xd8\xff\xe0 foto de un auto"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/auto.jpg":
+			w.Header().Set("Content-Type", "image/jpg")
+			w.Write([]byte(jpeg))
+		case "/grande.jpg":
+			w.Write([]byte(strings.Repeat("x", MaxChatMediaBytes+1)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	// el servidor de prueba escucha en loopback: sin el guard de IPs internas
+	prev := mediaHTTPClient
+	mediaHTTPClient = srv.Client()
+	defer func() { mediaHTTPClient = prev }()
+
+	m, err := LoadChatMedia(context.Background(), &models.ChatMedia{URL: srv.URL + "/auto.jpg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.MimeType != "image/jpeg" || string(m.Data) != jpeg || m.Ref.URL != srv.URL+"/auto.jpg" || m.Ref.Size != len(jpeg) {
+		t.Fatalf("media = %s %+v", m.MimeType, m.Ref)
+	}
+
+	for name, path := range map[string]string{"not found": "/nada.jpg", "too large": "/grande.jpg"} {
+		_, err := LoadChatMedia(context.Background(), &models.ChatMedia{URL: srv.URL + path})
+		var mediaErr *MediaError
+		if !errors.As(err, &mediaErr) {
+			t.Errorf("%s: err = %v, want MediaError", name, err)
+		}
+	}
+}
+
+func TestLoadChatMediaRejectsInternalAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("\xff\xd8\xff\xe0 secreto"))
+	}))
+	defer srv.Close()
+
+	for _, rawURL := range []string{srv.URL + "/a.jpg", "http://169.254.169.254/latest/meta-data/", "http://[::1]:1/a.jpg", "http://10.0.0.5/a.jpg"} {
+		_, err := LoadChatMedia(context.Background(), &models.ChatMedia{URL: rawURL})
+		var mediaErr *MediaError
+		if !errors.As(err, &mediaErr) {
+			t.Errorf("%s: err = %v, want MediaError", rawURL, err)
+		}
+	}
+
+	for ip, want := range map[string]bool{
+		"8.8.8.8": true, "2606:4700::1111": true,
+		"127.0.0.1": false, "192.168.1.10": false, "172.16.0.1": false, "169.254.169.254": false, "fd00::1": false, "0.0.0.0": false,
+	} {
+		if got := isPublicIP(net.ParseIP(ip)); got != want {
+			t.Errorf("isPublicIP(%s) = %v", ip, got)
+		}
+	}
+}
+
+func TestMediaAllowedHosts(t *testing.T) {
+	prev := config.AppConfig.MediaAllowedHosts
+	config.AppConfig.MediaAllowedHosts = []string{"mmg.whatsapp.net", "*.bob.com.pe"}
+	defer func() { config.AppConfig.MediaAllowedHosts = prev }()
+
+	for raw, want := range map[string]bool{
+		"https://mmg.whatsapp.net/v/a.jpg":  true,
+		"https://fotos.bob.com.pe/a.jpg":    true,
+		"https://evil.com/a.jpg":            false,
+		"https://bob.com.pe.evil.com/a.jpg": false,
+		"ftp://mmg.whatsapp.net/a.jpg":      false,
+	} {
+		u, _ := url.Parse(raw)
+		if got := allowedMediaURL(u); got != want {
+			t.Errorf("allowedMediaURL(%s) = %v", raw, got)
+		}
+	}
+
+	// los redirects pasan por el mismo filtro
+	redirect, _ := http.NewRequest(http.MethodGet, "https://evil.com/a.jpg", nil)
+	if err := newMediaHTTPClient().CheckRedirect(redirect, nil); !errors.Is(err, errMediaAddress) {
+		t.Fatalf("redirect to a foreign host = %v", err)
+	}
+}
+
+func TestLoadChatMediaDeclaredType(t *testing.T) {
+	// el tipo declarado manda sobre el detectado; uno no admitido se detecta del contenido
+	png := "\x89PNG\r\n\x1a\n..."
+	cases := []struct {
+		declared, want string
+	}{
+		{"image/webp", "image/webp"},
+		{"IMAGE/JPG", "image/jpeg"},
+		{"", "image/png"},
+		{"text/plain", "image/png"},
+	}
+	for _, c := range cases {
+		m, err := LoadChatMedia(context.Background(), &models.ChatMedia{Data: "iVBORw0KGgouLi4=", MimeType: c.declared})
+		if err != nil {
+			t.Fatalf("declared %q: %v", c.declared, err)
+		}
+		if m.MimeType != c.want || string(m.Data) != png {
+			t.Errorf("declared %q = %s, want %s", c.declared, m.MimeType, c.want)
+		}
+	}
+}
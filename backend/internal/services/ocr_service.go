@@ -0,0 +1,50 @@
+package services
+
+import (
+	"bob-hackathon/internal/llm"
+	"bob-hackathon/internal/metrics"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TextExtractor lee el texto de una imagen o documento (placas, DNI, tarjetas de propiedad...).
+// GeminiService lo implementa con el proveedor de LLM (visión); cualquier OCR (Tesseract,
+// Vision API...) puede reemplazarlo.
+type TextExtractor interface {
+	ExtractText(ctx context.Context, mimeType string, data []byte) (string, error)
+}
+
+// ExtractText implementa TextExtractor: la imagen/PDF va inline junto al prompt "ocr"
+func (g *GeminiService) ExtractText(ctx context.Context, mimeType string, data []byte) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	prompt, err := GetPromptStore().Render("ocr", PromptData{})
+	if err != nil {
+		return "", err
+	}
+
+	start := time.Now()
+	text, err := g.provider.Generate(ctx, []llm.Part{llm.Text(prompt), llm.Blob(mimeType, data)}, g.opts)
+	metrics.ObserveGemini("gemini_ocr", start, err)
+	if errors.Is(err, llm.ErrNoResponse) {
+		return "", nil // sin texto legible
+	}
+	if err != nil {
+		return "", fmt.Errorf("error al extraer texto: %w", err)
+	}
+	return strings.TrimSpace(text), nil
+}
+
+func init() {
+	RegisterDefaultPrompt("ocr", ocrPromptTemplate)
+}
+
+// ocrPromptTemplate template por defecto (editable vía /api/admin/prompts/ocr)
+const ocrPromptTemplate = `Extrae textualmente todo el texto legible de esta imagen o documento enviado por un cliente de BOB Subastas
+(por ejemplo, una placa de vehículo, un DNI, una tarjeta de propiedad o un comprobante).
+Devuelve SOLO el texto, una línea por bloque, sin comentarios ni descripciones de la imagen. Conserva placas, números y fechas tal como aparecen.
+Si no hay texto legible, responde vacío.`
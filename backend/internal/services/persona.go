@@ -0,0 +1,43 @@
+package services
+
+import (
+	"log"
+	"strings"
+)
+
+// Persona modificadores de tono para un tier y un canal: "persona_<tier>" y
+// "persona_<canal>" si existen (editables vía /api/admin/prompts), unidos.
+// Sin tier conocido ni canal con persona devuelve "" y el prompt queda igual.
+func (p *PromptStore) Persona(tier, channel string) string {
+	var parts []string
+	for _, key := range []string{tier, channel} {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "" || !p.Has("persona_"+key) {
+			continue
+		}
+		text, err := p.Render("persona_"+key, PromptData{Channel: channel})
+		if err != nil {
+			log.Printf("⚠️ Error en prompt persona_%s, se omite: %v", key, err)
+			continue
+		}
+		if text = strings.TrimSpace(text); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func init() {
+	for name, prompt := range defaultPersonas {
+		RegisterDefaultPrompt("persona_"+name, prompt)
+	}
+}
+
+// defaultPersonas tono por tier ("premium") o canal ("whatsapp"); "free" usa el tono base
+var defaultPersonas = map[string]string{
+	"premium": `- Cliente premium: respuestas más completas y detalladas (hasta 8-10 líneas)
+- Da datos concretos (fechas, montos, requisitos) y los próximos pasos
+- Ofrece la atención de un asesor dedicado si lo necesita`,
+	"whatsapp": `- Estás en WhatsApp: solo texto plano, sin tablas, encabezados ni enlaces markdown
+- Párrafos cortos; para resaltar usa *asteriscos simples*`,
+}
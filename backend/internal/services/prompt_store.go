@@ -0,0 +1,400 @@
+package services
+
+import (
+	"bob-hackathon/internal/config"
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// PromptData campos dinámicos disponibles en los templates de prompts
+// (ej: {{.Message}}, {{.History}}). Cada agente llena los que usa.
+type PromptData struct {
+	Message   string
+	SessionID string
+	Channel   string
+	History   string // historial ya formateado por el agente (incluye encabezado)
+	FAQs      string // contexto de FAQs (faq)
+	Vehicles  string // inventario (auction)
+	Behavior  string // señales de comportamiento (scoring)
+	Summary   string // resumen de los turnos viejos de la sesión
+	Budget    string // presupuesto normalizado a soles, si el usuario lo mencionó
+	Latency   string // velocidad de respuesta del usuario según timestamps
+	Persona   string // tono/extensión según tier y canal (prompts persona_*)
+}
+
+// ErrInvalidPrompt el prompt enviado no es aceptable (el cliente debe corregirlo)
+var ErrInvalidPrompt = errors.New("prompt inválido")
+
+// ErrNoPromptVersion no hay versión anterior a la que volver
+var ErrNoPromptVersion = errors.New("no hay versiones anteriores del prompt")
+
+// Versiones anteriores que se conservan por prompt
+const promptVersionsKept = 10
+
+// Prompts por defecto registrados por cada agente/servicio (nombre → template)
+var (
+	defaultPromptsMu sync.RWMutex
+	defaultPrompts   = map[string]string{}
+	requiredFields   = map[string][]string{}
+)
+
+// RegisterDefaultPrompt registra el template por defecto de un prompt y los
+// campos de PromptData que toda edición debe usar (ej: "Message" → {{.Message}}).
+// Se llama desde init() de cada agente; el nombre es el que usa /api/admin/prompts/:agent.
+func RegisterDefaultPrompt(name, tmpl string, required ...string) {
+	defaultPromptsMu.Lock()
+	defer defaultPromptsMu.Unlock()
+	defaultPrompts[name] = tmpl
+	requiredFields[name] = required
+}
+
+// ValidatePrompt verifica que source parsee, se pueda ejecutar y use todos
+// los campos requeridos de name. Los errores envuelven ErrInvalidPrompt.
+func ValidatePrompt(name, source string) error {
+	defaultPromptsMu.RLock()
+	_, known := defaultPrompts[name]
+	required := requiredFields[name]
+	defaultPromptsMu.RUnlock()
+	if !known {
+		return fmt.Errorf("%w: prompt desconocido: %s", ErrInvalidPrompt, name)
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(source)
+	if err != nil {
+		return fmt.Errorf("%w: template no parsea: %v", ErrInvalidPrompt, err)
+	}
+
+	// Se ejecuta con marcadores: si el marcador de un campo no aparece, falta el placeholder
+	marker := func(field string) string { return "\x00" + field + "\x00" }
+	probe := PromptData{
+		Message:   marker("Message"),
+		SessionID: marker("SessionID"),
+		Channel:   marker("Channel"),
+		History:   marker("History"),
+		FAQs:      marker("FAQs"),
+		Vehicles:  marker("Vehicles"),
+		Behavior:  marker("Behavior"),
+		Summary:   marker("Summary"),
+		Budget:    marker("Budget"),
+		Latency:   marker("Latency"),
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, probe); err != nil {
+		return fmt.Errorf("%w: template no se puede ejecutar: %v", ErrInvalidPrompt, err)
+	}
+	var missing []string
+	for _, field := range required {
+		if !strings.Contains(buf.String(), marker(field)) {
+			missing = append(missing, "{{."+field+"}}")
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: faltan placeholders requeridos: %s", ErrInvalidPrompt, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func defaultPrompt(name string) (string, bool) {
+	defaultPromptsMu.RLock()
+	defer defaultPromptsMu.RUnlock()
+	tmpl, ok := defaultPrompts[name]
+	return tmpl, ok
+}
+
+// PromptStore mantiene los prompts editables en data/prompts/<name>.txt.
+// Se recarga en caliente: si el archivo cambia (mtime) se vuelve a parsear.
+type PromptStore struct {
+	dir     string
+	mu      sync.Mutex
+	entries map[string]*promptEntry
+}
+
+type promptEntry struct {
+	source   string
+	tmpl     *template.Template
+	modTime  time.Time // mtime del archivo (cero si es el default)
+	fromFile bool
+}
+
+var promptStoreInstance *PromptStore
+var promptStoreOnce sync.Once
+
+func GetPromptStore() *PromptStore {
+	promptStoreOnce.Do(func() {
+		promptStoreInstance = NewPromptStore(filepath.Join(config.AppConfig.DataDir, "prompts"))
+	})
+	return promptStoreInstance
+}
+
+func NewPromptStore(dir string) *PromptStore {
+	return &PromptStore{
+		dir:     dir,
+		entries: make(map[string]*promptEntry),
+	}
+}
+
+// Names devuelve los prompts conocidos (los que tienen default registrado)
+func (p *PromptStore) Names() []string {
+	defaultPromptsMu.RLock()
+	names := make([]string, 0, len(defaultPrompts))
+	for name := range defaultPrompts {
+		names = append(names, name)
+	}
+	defaultPromptsMu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// Has indica si name es un prompt conocido
+func (p *PromptStore) Has(name string) bool {
+	_, ok := defaultPrompt(name)
+	return ok
+}
+
+func (p *PromptStore) path(name string) string {
+	return filepath.Join(p.dir, name+".txt")
+}
+
+// load devuelve el template vigente de name, recargando si el archivo cambió.
+// Un archivo que no parsea se ignora (se loguea) y se sigue con lo anterior.
+// Debe llamarse con p.mu tomado.
+func (p *PromptStore) load(name string) (*promptEntry, error) {
+	cur := p.entries[name]
+
+	info, err := os.Stat(p.path(name))
+	if err == nil {
+		if cur != nil && cur.fromFile && info.ModTime().Equal(cur.modTime) {
+			return cur, nil
+		}
+		content, err := os.ReadFile(p.path(name))
+		if err == nil && strings.TrimSpace(string(content)) != "" {
+			tmpl, err := template.New(name).Parse(string(content))
+			if err == nil {
+				entry := &promptEntry{source: string(content), tmpl: tmpl, modTime: info.ModTime(), fromFile: true}
+				p.entries[name] = entry
+				if cur != nil {
+					log.Printf("🔄 Prompt %s recargado desde disco", name)
+				}
+				return entry, nil
+			}
+			log.Printf("⚠️ Prompt %s inválido en disco, se mantiene el anterior: %v", name, err)
+			if cur != nil {
+				return cur, nil
+			}
+		}
+	} else if cur != nil && !cur.fromFile {
+		return cur, nil
+	}
+
+	// Sin archivo (o ilegible): default registrado
+	src, ok := defaultPrompt(name)
+	if !ok {
+		return nil, fmt.Errorf("prompt desconocido: %s", name)
+	}
+	tmpl, err := template.New(name).Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("prompt default %s inválido: %w", name, err)
+	}
+	entry := &promptEntry{source: src, tmpl: tmpl}
+	p.entries[name] = entry
+	return entry, nil
+}
+
+// Source devuelve el texto vigente del prompt y si es una edición (archivo) o el default
+func (p *PromptStore) Source(name string) (source string, custom bool, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry, err := p.load(name)
+	if err != nil {
+		return "", false, err
+	}
+	return entry.source, entry.fromFile, nil
+}
+
+// Render ejecuta el template vigente de name con data.
+// Si una edición falla al ejecutarse se usa el default para no dejar al agente sin prompt.
+func (p *PromptStore) Render(name string, data PromptData) (string, error) {
+	p.mu.Lock()
+	entry, err := p.load(name)
+	p.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	err = entry.tmpl.Execute(&buf, data)
+	if err == nil {
+		return buf.String(), nil
+	}
+	if !entry.fromFile {
+		return "", err
+	}
+	log.Printf("⚠️ Error ejecutando prompt %s, usando default: %v", name, err)
+
+	src, _ := defaultPrompt(name)
+	tmpl, err := template.New(name).Parse(src)
+	if err != nil {
+		return "", err
+	}
+	buf.Reset()
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Update valida y guarda el prompt; queda vigente en el acto.
+// El archivo anterior pasa a versions/<name>/ (se conservan las últimas promptVersionsKept).
+func (p *PromptStore) Update(name, source string) error {
+	if err := ValidatePrompt(name, source); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := os.MkdirAll(p.dir, 0755); err != nil {
+		return fmt.Errorf("error al crear directorio de prompts: %w", err)
+	}
+	if err := p.saveVersionLocked(name); err != nil {
+		return err
+	}
+	return p.writeLocked(name, source)
+}
+
+// writeLocked escribe el prompt vigente y actualiza la caché. Debe llamarse con p.mu tomado.
+func (p *PromptStore) writeLocked(name, source string) error {
+	tmpl, err := template.New(name).Parse(source)
+	if err != nil {
+		return fmt.Errorf("%w: template no parsea: %v", ErrInvalidPrompt, err)
+	}
+
+	promptPath := p.path(name)
+	if err := os.WriteFile(promptPath, []byte(source), 0644); err != nil {
+		return fmt.Errorf("error al guardar prompt: %w", err)
+	}
+
+	entry := &promptEntry{source: source, tmpl: tmpl, fromFile: true}
+	if info, err := os.Stat(promptPath); err == nil {
+		entry.modTime = info.ModTime()
+	}
+	p.entries[name] = entry
+	return nil
+}
+
+// PromptVersion versión anterior guardada de un prompt
+type PromptVersion struct {
+	ID      string    `json:"id"`
+	SavedAt time.Time `json:"savedAt"`
+}
+
+func (p *PromptStore) versionsDir(name string) string {
+	return filepath.Join(p.dir, "versions", name)
+}
+
+// versionsLocked lista las versiones de name, de la más reciente a la más antigua.
+// El ID es el UnixNano del momento en que se reemplazó. Debe llamarse con p.mu tomado.
+func (p *PromptStore) versionsLocked(name string) []PromptVersion {
+	files, err := os.ReadDir(p.versionsDir(name))
+	if err != nil {
+		return nil
+	}
+	var versions []PromptVersion
+	for _, f := range files {
+		id := strings.TrimSuffix(f.Name(), ".txt")
+		nanos, err := strconv.ParseInt(id, 10, 64)
+		if f.IsDir() || err != nil || !strings.HasSuffix(f.Name(), ".txt") {
+			continue
+		}
+		versions = append(versions, PromptVersion{ID: id, SavedAt: time.Unix(0, nanos)})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].SavedAt.After(versions[j].SavedAt) })
+	return versions
+}
+
+// Versions devuelve las versiones anteriores de name (más reciente primero)
+func (p *PromptStore) Versions(name string) []PromptVersion {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.versionsLocked(name)
+}
+
+// saveVersionLocked mueve el archivo vigente a versions/ y poda las más antiguas.
+// Sin archivo (se usa el default) no hay nada que guardar. Debe llamarse con p.mu tomado.
+func (p *PromptStore) saveVersionLocked(name string) error {
+	promptPath := p.path(name)
+	if _, err := os.Stat(promptPath); err != nil {
+		return nil
+	}
+	dir := p.versionsDir(name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error al crear directorio de versiones: %w", err)
+	}
+	versionPath := filepath.Join(dir, strconv.FormatInt(time.Now().UnixNano(), 10)+".txt")
+	if err := os.Rename(promptPath, versionPath); err != nil {
+		return fmt.Errorf("error al versionar prompt: %w", err)
+	}
+	log.Printf("Versión de prompt guardada: %s", versionPath)
+
+	versions := p.versionsLocked(name)
+	for _, v := range versions[min(len(versions), promptVersionsKept):] {
+		os.Remove(filepath.Join(dir, v.ID+".txt"))
+	}
+	return nil
+}
+
+// Rollback vuelve a la versión anterior más reciente (que sale del historial).
+// Sin versiones, una edición vuelve al default; si ya es el default → ErrNoPromptVersion.
+// Devuelve el texto que queda vigente.
+func (p *PromptStore) Rollback(name string) (string, error) {
+	if !p.Has(name) {
+		return "", fmt.Errorf("%w: prompt desconocido: %s", ErrInvalidPrompt, name)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	versions := p.versionsLocked(name)
+	if len(versions) == 0 {
+		if err := os.Remove(p.path(name)); err != nil {
+			if os.IsNotExist(err) {
+				return "", ErrNoPromptVersion
+			}
+			return "", fmt.Errorf("error al restaurar default: %w", err)
+		}
+		delete(p.entries, name)
+		entry, err := p.load(name)
+		if err != nil {
+			return "", err
+		}
+		log.Printf("Prompt de %s restaurado al default", name)
+		return entry.source, nil
+	}
+
+	versionPath := filepath.Join(p.versionsDir(name), versions[0].ID+".txt")
+	content, err := os.ReadFile(versionPath)
+	if err != nil {
+		return "", fmt.Errorf("error al leer versión %s: %w", versions[0].ID, err)
+	}
+	// una versión guardada antes de sumar requisitos podría ya no ser válida
+	if err := ValidatePrompt(name, string(content)); err != nil {
+		return "", fmt.Errorf("la versión %s no es válida: %w", versions[0].ID, err)
+	}
+	if err := p.writeLocked(name, string(content)); err != nil {
+		return "", err
+	}
+	os.Remove(versionPath)
+	log.Printf("Prompt de %s restaurado a la versión %s", name, versions[0].ID)
+	return string(content), nil
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func init() {
+	RegisterDefaultPrompt("test_prompt", "default: {{.Message}}", "Message")
+	RegisterDefaultPrompt("test_pair", "{{.Message}} {{.FAQs}}", "Message", "FAQs")
+}
+
+func TestPromptStoreRender(t *testing.T) {
+	dir := t.TempDir()
+	store := NewPromptStore(dir)
+	render := func() string {
+		t.Helper()
+		out, err := store.Render("test_prompt", PromptData{Message: "hola"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	steps := []struct {
+		name string
+		do   func()
+		want string
+	}{
+		{"default", func() {}, "default: hola"},
+		{"update is live", func() {
+			if err := store.Update("test_prompt", "editado: {{.Message}}"); err != nil {
+				t.Fatal(err)
+			}
+		}, "editado: hola"},
+		{"hot reload from disk", func() {
+			writePromptFile(t, dir, "test_prompt", "disco: {{.Message}}")
+		}, "disco: hola"},
+		{"broken file keeps previous", func() {
+			writePromptFile(t, dir, "test_prompt", "roto: {{.Message")
+		}, "disco: hola"},
+		{"deleted file falls back to default", func() {
+			os.Remove(filepath.Join(dir, "test_prompt.txt"))
+		}, "default: hola"},
+	}
+	for _, st := range steps {
+		st.do()
+		if got := render(); got != st.want {
+			t.Fatalf("%s: Render = %q, want %q", st.name, got, st.want)
+		}
+	}
+
+	if _, err := store.Render("no_existe", PromptData{}); err == nil {
+		t.Fatal("unknown prompt rendered without error")
+	}
+}
+
+// writePromptFile escribe el archivo con un mtime nuevo (la recarga compara mtime)
+func writePromptFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name+".txt")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Duration(len(content)) * time.Second)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPromptStoreSourceAndNames(t *testing.T) {
+	store := NewPromptStore(t.TempDir())
+	src, custom, err := store.Source("test_prompt")
+	if err != nil || custom || src != "default: {{.Message}}" {
+		t.Fatalf("Source = %q custom=%v err=%v", src, custom, err)
+	}
+	if err := store.Update("test_prompt", "nuevo {{.Message}}"); err != nil {
+		t.Fatal(err)
+	}
+	if src, custom, _ = store.Source("test_prompt"); !custom || !strings.HasPrefix(src, "nuevo") {
+		t.Fatalf("Source after update = %q custom=%v", src, custom)
+	}
+	if !store.Has("system") || store.Has("no_existe") {
+		t.Fatal("Has does not follow the registered defaults")
+	}
+	found := false
+	for _, n := range store.Names() {
+		found = found || n == "test_prompt"
+	}
+	if !found {
+		t.Fatalf("Names() = %v, missing test_prompt", store.Names())
+	}
+}
+
+func TestValidatePrompt(t *testing.T) {
+	cases := []struct {
+		name, prompt, source string
+		ok                   bool
+	}{
+		{"valid", "test_pair", "Responde {{.Message}} con {{.FAQs}}", true},
+		{"extra fields allowed", "test_pair", "{{.Channel}} {{.Message}} {{.FAQs}} {{.Persona}}", true},
+		{"missing required", "test_pair", "Responde {{.Message}}", false},
+		{"required inside if counts", "test_pair", "{{.Message}}{{if .FAQs}}{{.FAQs}}{{end}}", true},
+		{"does not parse", "test_pair", "{{.Message} {{.FAQs}}", false},
+		{"unknown field", "test_pair", "{{.Message}} {{.FAQs}} {{.NoExiste}}", false},
+		{"unknown prompt", "no_existe", "{{.Message}}", false},
+		{"no requirements", "system", "Eres BOB.", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ValidatePrompt(c.prompt, c.source)
+			if (err == nil) != c.ok {
+				t.Fatalf("ValidatePrompt = %v, want ok=%v", err, c.ok)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidPrompt) {
+				t.Fatalf("error %v does not wrap ErrInvalidPrompt", err)
+			}
+		})
+	}
+}
+
+func TestPromptStoreUpdateRejectsInvalid(t *testing.T) {
+	store := NewPromptStore(t.TempDir())
+	if err := store.Update("test_prompt", "sin placeholder"); !errors.Is(err, ErrInvalidPrompt) {
+		t.Fatalf("Update = %v, want ErrInvalidPrompt", err)
+	}
+	if src, custom, _ := store.Source("test_prompt"); custom || src != "default: {{.Message}}" {
+		t.Fatalf("rejected edit changed the prompt: %q custom=%v", src, custom)
+	}
+}
+
+func TestPromptStoreVersionsAndRollback(t *testing.T) {
+	store := NewPromptStore(t.TempDir())
+	current := func() string {
+		src, _, err := store.Source("test_prompt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return src
+	}
+	for _, v := range []string{"v1 {{.Message}}", "v2 {{.Message}}", "v3 {{.Message}}"} {
+		if err := store.Update("test_prompt", v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(store.Versions("test_prompt")); n != 2 {
+		t.Fatalf("versions = %d, want 2 (the default is not a version)", n)
+	}
+
+	steps := []struct {
+		want    string
+		wantErr error
+	}{
+		{"v2 {{.Message}}", nil},
+		{"v1 {{.Message}}", nil},
+		{"default: {{.Message}}", nil},
+		{"default: {{.Message}}", ErrNoPromptVersion},
+	}
+	for i, st := range steps {
+		got, err := store.Rollback("test_prompt")
+		if !errors.Is(err, st.wantErr) {
+			t.Fatalf("rollback %d: err = %v, want %v", i, err, st.wantErr)
+		}
+		if err == nil && got != st.want {
+			t.Fatalf("rollback %d = %q, want %q", i, got, st.want)
+		}
+		if c := current(); c != st.want {
+			t.Fatalf("rollback %d: current = %q, want %q", i, c, st.want)
+		}
+	}
+}
+
+func TestPromptStoreKeepsLastVersions(t *testing.T) {
+	store := NewPromptStore(t.TempDir())
+	for i := 0; i < promptVersionsKept+5; i++ {
+		if err := store.Update("test_prompt", fmt.Sprintf("v%d {{.Message}}", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(store.Versions("test_prompt")); n != promptVersionsKept {
+		t.Fatalf("versions = %d, want %d", n, promptVersionsKept)
+	}
+	// la más reciente primero
+	if got, _ := store.Rollback("test_prompt"); got != fmt.Sprintf("v%d {{.Message}}", promptVersionsKept+3) {
+		t.Fatalf("rollback = %q", got)
+	}
+}
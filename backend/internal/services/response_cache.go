@@ -0,0 +1,113 @@
+package services
+
+import (
+	"bob-hackathon/internal/config"
+	"sync"
+	"time"
+)
+
+// ResponseCache respuestas generadas por clave, con TTL y tope de entradas
+// (al llenarse se descartan las vencidas y, si no alcanza, la más próxima a vencer)
+type ResponseCache struct {
+	ttl     time.Duration // 0 = cache desactivado
+	max     int
+	mu      sync.Mutex
+	entries map[string]cachedResponse
+	now     func() time.Time
+}
+
+type cachedResponse struct {
+	value   string
+	expires time.Time
+}
+
+var faqAnswerCacheInstance *ResponseCache
+var faqAnswerCacheOnce sync.Once
+
+// GetFAQAnswerCache respuestas del FAQAgent (FAQ_CACHE_TTL, FAQ_CACHE_SIZE); se vacía al recargar FAQs
+func GetFAQAnswerCache() *ResponseCache {
+	faqAnswerCacheOnce.Do(func() {
+		faqAnswerCacheInstance = NewResponseCache(config.AppConfig.FAQCacheTTL, config.AppConfig.FAQCacheSize)
+	})
+	return faqAnswerCacheInstance
+}
+
+func NewResponseCache(ttl time.Duration, max int) *ResponseCache {
+	return &ResponseCache{
+		ttl:     ttl,
+		max:     max,
+		entries: make(map[string]cachedResponse),
+		now:     time.Now,
+	}
+}
+
+// Enabled false con TTL 0 o tope 0
+func (c *ResponseCache) Enabled() bool {
+	return c.ttl > 0 && c.max > 0
+}
+
+// Get respuesta vigente para key
+func (c *ResponseCache) Get(key string) (string, bool) {
+	if !c.Enabled() {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	if !c.now().Before(entry.expires) {
+		delete(c.entries, key)
+		return "", false
+	}
+	return entry.value, true
+}
+
+// Set guarda value para key durante el TTL
+func (c *ResponseCache) Set(key, value string) {
+	if !c.Enabled() {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.max {
+		c.evictLocked(now)
+	}
+	c.entries[key] = cachedResponse{value: value, expires: now.Add(c.ttl)}
+}
+
+// evictLocked libera al menos una entrada: todas las vencidas o, si no hay, la más vieja
+func (c *ResponseCache) evictLocked(now time.Time) {
+	var oldestKey string
+	var oldest time.Time
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+			continue
+		}
+		if oldestKey == "" || entry.expires.Before(oldest) {
+			oldestKey, oldest = key, entry.expires
+		}
+	}
+	if len(c.entries) >= c.max && oldestKey != "" {
+		delete(c.entries, oldestKey)
+	}
+}
+
+// Purge vacía el cache
+func (c *ResponseCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]cachedResponse)
+}
+
+// Len entradas guardadas (incluye vencidas aún no descartadas)
+func (c *ResponseCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
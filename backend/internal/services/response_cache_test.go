@@ -0,0 +1,73 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResponseCacheTTLAndEviction(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	c := NewResponseCache(time.Minute, 2)
+	c.now = func() time.Time { return now }
+
+	c.Set("a", "uno")
+	now = now.Add(10 * time.Second)
+	c.Set("b", "dos")
+	if v, ok := c.Get("a"); !ok || v != "uno" {
+		t.Fatalf("Get(a) = %q, %v", v, ok)
+	}
+
+	// lleno: sale la entrada más próxima a vencer
+	c.Set("c", "tres")
+	if _, ok := c.Get("a"); ok || c.Len() != 2 {
+		t.Fatalf("a not evicted (len %d)", c.Len())
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := c.Get("b"); ok {
+		t.Fatal("b served after TTL")
+	}
+
+	c.Purge()
+	if c.Len() != 0 {
+		t.Fatalf("Len after Purge = %d", c.Len())
+	}
+
+	off := NewResponseCache(0, 10)
+	off.Set("a", "uno")
+	if _, ok := off.Get("a"); ok || off.Enabled() {
+		t.Fatal("TTL 0 cache stored a value")
+	}
+}
+
+func TestNormalizeFAQQuery(t *testing.T) {
+	for _, q := range []string{"¿Cómo me registro?", "como me  REGISTRO", "¡¡cómo me registro!!"} {
+		if got := NormalizeFAQQuery(q); got != "como me registro" {
+			t.Errorf("NormalizeFAQQuery(%q) = %q", q, got)
+		}
+	}
+}
+
+func TestReloadFAQsBumpsVersion(t *testing.T) {
+	path := filepath.Join(testDataDir, "faqs.csv")
+	if err := os.WriteFile(path, []byte("Id,Categoría,Empresa,Pregunta,Respuesta\n1,General,Todos,¿Qué es BOB?,Una plataforma de subastas.\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	before := GetFAQService().Version()
+	ReloadFAQs()
+	if GetFAQService().Version() == before || len(GetFAQService().SearchFAQs("subastas", "", "")) != 1 {
+		t.Fatalf("version %d -> %d", before, GetFAQService().Version())
+	}
+
+	// si el archivo no se puede leer se conservan las FAQs y la versión
+	os.Remove(path)
+	v := GetFAQService().Version()
+	ReloadFAQs()
+	if GetFAQService().Version() != v {
+		t.Fatal("failed reload bumped the version")
+	}
+}
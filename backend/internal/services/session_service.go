@@ -16,11 +16,20 @@ import (
 type SessionService struct {
 	sessions     map[string]*models.Session
 	leads        map[string]*models.Lead
+	feedback     map[string][]*models.Feedback
 	mu           sync.RWMutex
 	sessionsFile string
 	leadsFile    string
+	feedbackFile string
+
+	// Suscriptores de actualizaciones de leads (stream SSE)
+	subsMu   sync.Mutex
+	leadSubs map[chan models.LeadUpdate]struct{}
 }
 
+// Buffer por suscriptor; si un cliente lento lo llena, se descartan eventos para él
+const leadSubscriberBuffer = 16
+
 var sessionServiceInstance *SessionService
 var sessionServiceOnce sync.Once
 
@@ -30,8 +39,10 @@ func GetSessionService() *SessionService {
 		sessionServiceInstance = &SessionService{
 			sessions:     make(map[string]*models.Session),
 			leads:        make(map[string]*models.Lead),
+			feedback:     make(map[string][]*models.Feedback),
 			sessionsFile: filepath.Join(dataDir, "sessions.json"),
 			leadsFile:    filepath.Join(dataDir, "leads.json"),
+			feedbackFile: filepath.Join(dataDir, "feedback.json"),
 		}
 		sessionServiceInstance.loadFromDisk()
 	})
@@ -42,6 +53,32 @@ func (s *SessionService) GetOrCreateSession(sessionID, channel string) *models.S
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	return s.getOrCreateLocked(sessionID, channel)
+}
+
+// AddMessageToSession crea la sesión si no existe y agrega el mensaje en una sola
+// sección crítica, así un delete/create concurrente no deja el mensaje afuera.
+// Devuelve una copia de la sesión ya con el mensaje.
+func (s *SessionService) AddMessageToSession(sessionID, channel, role, content string, media *models.MediaRef) *models.Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session := s.getOrCreateLocked(sessionID, channel)
+	now := time.Now()
+	session.Messages = append(session.Messages, models.Message{
+		Role:      role,
+		Content:   content,
+		Timestamp: now,
+		Media:     media,
+	})
+	session.UpdatedAt = now
+
+	s.saveToDisk()
+	return copySession(session)
+}
+
+// getOrCreateLocked requiere s.mu tomado en escritura
+func (s *SessionService) getOrCreateLocked(sessionID, channel string) *models.Session {
 	// Si no hay sessionID, generar uno nuevo
 	if sessionID == "" {
 		sessionID = channel + "-" + uuid.New().String()
@@ -101,6 +138,19 @@ func (s *SessionService) GetSession(sessionID string) *models.Session {
 	return s.sessions[sessionID]
 }
 
+// GetSnapshot copia de la sesión para leerla sin carreras con AddMessage/UpdateScore
+func (s *SessionService) GetSnapshot(sessionID string) *models.Session {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, exists := s.sessions[sessionID]
+	if !exists {
+		return nil
+	}
+	return copySession(session)
+}
+
+// GetMessages devuelve una copia del historial (el slice de la sesión sigue creciendo)
 func (s *SessionService) GetMessages(sessionID string) []models.Message {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -110,7 +160,7 @@ func (s *SessionService) GetMessages(sessionID string) []models.Message {
 		return []models.Message{}
 	}
 
-	return session.Messages
+	return append([]models.Message(nil), session.Messages...)
 }
 
 func (s *SessionService) GetAllSessions() []*models.Session {
@@ -119,12 +169,25 @@ func (s *SessionService) GetAllSessions() []*models.Session {
 
 	sessions := make([]*models.Session, 0, len(s.sessions))
 	for _, session := range s.sessions {
-		sessions = append(sessions, session)
+		sessions = append(sessions, copySession(session))
 	}
 
 	return sessions
 }
 
+// copySession copia profunda de lo que se modifica en el lugar (mensajes y metadata)
+func copySession(session *models.Session) *models.Session {
+	cp := *session
+	cp.Messages = append([]models.Message(nil), session.Messages...)
+	if session.Metadata != nil {
+		cp.Metadata = make(map[string]string, len(session.Metadata))
+		for k, v := range session.Metadata {
+			cp.Metadata[k] = v
+		}
+	}
+	return &cp
+}
+
 func (s *SessionService) UpdateScore(sessionID string, score int, category string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -141,13 +204,99 @@ func (s *SessionService) UpdateScore(sessionID string, score int, category strin
 	s.saveToDisk()
 }
 
+// SetMetadata guarda un valor en la metadata de la sesión (value vacío lo borra)
+func (s *SessionService) SetMetadata(sessionID, key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessions[sessionID]
+	if !exists {
+		return
+	}
+
+	if session.Metadata == nil {
+		session.Metadata = make(map[string]string)
+	}
+	if value == "" {
+		delete(session.Metadata, key)
+	} else {
+		session.Metadata[key] = value
+	}
+	session.UpdatedAt = time.Now()
+
+	s.saveToDisk()
+}
+
+func (s *SessionService) GetMetadata(sessionID, key string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, exists := s.sessions[sessionID]
+	if !exists {
+		return ""
+	}
+	return session.Metadata[key]
+}
+
+// UpdateBehavior guarda las últimas señales de comportamiento que envió el canal
+func (s *SessionService) UpdateBehavior(sessionID string, behavior *models.BehaviorSignals) {
+	if behavior == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessions[sessionID]
+	if !exists {
+		return
+	}
+
+	session.Behavior = behavior
+	session.UpdatedAt = time.Now()
+
+	s.saveToDisk()
+}
+
+// UpdateSummary guarda el resumen que cubre los mensajes [0, upTo)
+func (s *SessionService) UpdateSummary(sessionID, summary string, upTo int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessions[sessionID]
+	if !exists {
+		return
+	}
+
+	session.Summary = summary
+	session.SummarizedUpTo = upTo
+	session.UpdatedAt = time.Now()
+
+	s.saveToDisk()
+}
+
+// GetSummary devuelve el resumen vigente y hasta qué mensaje cubre
+func (s *SessionService) GetSummary(sessionID string) (string, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, exists := s.sessions[sessionID]
+	if !exists {
+		return "", 0
+	}
+	return session.Summary, session.SummarizedUpTo
+}
+
 func (s *SessionService) CreateOrUpdateLead(leadData *models.Lead) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	leadData.UpdatedAt = time.Now()
 
-	if _, exists := s.leads[leadData.SessionID]; !exists {
+	previousCategory := ""
+	if previous, exists := s.leads[leadData.SessionID]; exists {
+		previousCategory = previous.Category
+	} else {
 		leadData.CreatedAt = time.Now()
 	}
 
@@ -155,6 +304,61 @@ func (s *SessionService) CreateOrUpdateLead(leadData *models.Lead) {
 	s.saveToDisk()
 
 	log.Printf("Lead actualizado: %s - Score: %d (%s)", leadData.SessionID, leadData.Score, leadData.Category)
+
+	s.publishLead(models.LeadUpdate{
+		Lead:             *leadData,
+		PreviousCategory: previousCategory,
+		CategoryChanged:  previousCategory != leadData.Category,
+	})
+}
+
+// SubscribeLeads registra un suscriptor de actualizaciones de leads. Llamar a la
+// función devuelta al terminar (desconexión del cliente) para liberar el canal.
+func (s *SessionService) SubscribeLeads() (<-chan models.LeadUpdate, func()) {
+	ch := make(chan models.LeadUpdate, leadSubscriberBuffer)
+
+	s.subsMu.Lock()
+	if s.leadSubs == nil {
+		s.leadSubs = make(map[chan models.LeadUpdate]struct{})
+	}
+	s.leadSubs[ch] = struct{}{}
+	s.subsMu.Unlock()
+
+	return ch, func() {
+		s.subsMu.Lock()
+		defer s.subsMu.Unlock()
+		// CloseLeadSubscribers pudo haberlo cerrado ya
+		if _, ok := s.leadSubs[ch]; ok {
+			delete(s.leadSubs, ch)
+			close(ch)
+		}
+	}
+}
+
+// CloseLeadSubscribers cierra todos los canales de suscriptores (apagado del servidor):
+// los streams ven el canal cerrado y terminan
+func (s *SessionService) CloseLeadSubscribers() {
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+
+	for ch := range s.leadSubs {
+		delete(s.leadSubs, ch)
+		close(ch)
+	}
+}
+
+// publishLead reparte el evento a todos los suscriptores sin bloquear
+func (s *SessionService) publishLead(update models.LeadUpdate) {
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+
+	for ch := range s.leadSubs {
+		select {
+		case ch <- update:
+		default:
+			log.Printf("⚠️ Suscriptor de leads lento, evento de %s descartado", update.Lead.SessionID)
+		}
+	}
 }
 
 func (s *SessionService) GetAllLeads(category, channel string) []*models.Lead {
@@ -201,10 +405,29 @@ func (s *SessionService) GetLeadsStats() *models.LeadStats {
 	}
 
 	totalScore := 0
+	variantScores := make(map[string]int)
 
 	for _, lead := range s.leads {
 		totalScore += lead.Score
 
+		if session, ok := s.sessions[lead.SessionID]; ok {
+			if variant := session.Metadata[PromptVariantKey]; variant != "" {
+				if stats.ByVariant == nil {
+					stats.ByVariant = make(map[string]*models.VariantStats)
+				}
+				vs := stats.ByVariant[variant]
+				if vs == nil {
+					vs = &models.VariantStats{}
+					stats.ByVariant[variant] = vs
+				}
+				vs.Leads++
+				if lead.Category == "hot" {
+					vs.Hot++
+				}
+				variantScores[variant] += lead.Score
+			}
+		}
+
 		switch lead.Category {
 		case "hot":
 			stats.Hot++
@@ -222,6 +445,62 @@ func (s *SessionService) GetLeadsStats() *models.LeadStats {
 	if stats.Total > 0 {
 		stats.AvgScore = float64(totalScore) / float64(stats.Total)
 	}
+	for variant, vs := range stats.ByVariant {
+		vs.AvgScore = float64(variantScores[variant]) / float64(vs.Leads)
+	}
+
+	return stats
+}
+
+// AddFeedback guarda el voto; un nuevo voto sobre el mismo mensaje reemplaza al anterior
+func (s *SessionService) AddFeedback(feedback *models.Feedback) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := s.feedback[feedback.SessionID]
+	for i, existing := range list {
+		if existing.MessageIndex == feedback.MessageIndex {
+			list[i] = feedback
+			s.saveToDisk()
+			return
+		}
+	}
+	s.feedback[feedback.SessionID] = append(list, feedback)
+
+	s.saveToDisk()
+}
+
+func (s *SessionService) GetFeedback(sessionID string) []*models.Feedback {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]*models.Feedback{}, s.feedback[sessionID]...)
+}
+
+func (s *SessionService) GetFeedbackStats() *models.FeedbackStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := &models.FeedbackStats{
+		ByChannel: make(map[string]int),
+	}
+
+	for _, list := range s.feedback {
+		for _, feedback := range list {
+			stats.Total++
+			switch feedback.Rating {
+			case "up":
+				stats.Up++
+			case "down":
+				stats.Down++
+			}
+			stats.ByChannel[feedback.Channel]++
+		}
+	}
+
+	if stats.Total > 0 {
+		stats.UpRate = float64(stats.Up) / float64(stats.Total)
+	}
 
 	return stats
 }
@@ -244,20 +523,51 @@ func (s *SessionService) loadFromDisk() {
 			log.Printf("%d leads cargados desde disco", len(s.leads))
 		}
 	}
+
+	// Cargar feedback
+	if data, err := os.ReadFile(s.feedbackFile); err == nil {
+		if err := json.Unmarshal(data, &s.feedback); err != nil {
+			log.Printf("Error al cargar feedback: %v", err)
+		}
+	}
+}
+
+// Flush persiste el estado actual; al tomar el lock espera a que termine cualquier escritura en curso
+func (s *SessionService) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveToDisk()
+	log.Printf("💾 Sesiones, leads y feedback guardados en disco")
 }
 
 func (s *SessionService) saveToDisk() {
 	// Guardar sesiones
 	if data, err := json.MarshalIndent(s.sessions, "", "  "); err == nil {
-		if err := os.WriteFile(s.sessionsFile, data, 0644); err != nil {
+		if err := writeFileAtomic(s.sessionsFile, data); err != nil {
 			log.Printf("Error al guardar sesiones: %v", err)
 		}
 	}
 
 	// Guardar leads
 	if data, err := json.MarshalIndent(s.leads, "", "  "); err == nil {
-		if err := os.WriteFile(s.leadsFile, data, 0644); err != nil {
+		if err := writeFileAtomic(s.leadsFile, data); err != nil {
 			log.Printf("Error al guardar leads: %v", err)
 		}
 	}
+
+	// Guardar feedback
+	if data, err := json.MarshalIndent(s.feedback, "", "  "); err == nil {
+		if err := writeFileAtomic(s.feedbackFile, data); err != nil {
+			log.Printf("Error al guardar feedback: %v", err)
+		}
+	}
+}
+
+// writeFileAtomic escribe a un temporal y renombra, para no dejar un JSON a medias si el proceso muere
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
 }
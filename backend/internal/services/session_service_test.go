@@ -0,0 +1,173 @@
+package services
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"bob-hackathon/internal/models"
+)
+
+// newTestSessionService instancia aislada (no el singleton) que persiste en t.TempDir()
+func newTestSessionService(t *testing.T) *SessionService {
+	t.Helper()
+	dir := t.TempDir()
+	return &SessionService{
+		sessions:     make(map[string]*models.Session),
+		leads:        make(map[string]*models.Lead),
+		feedback:     make(map[string][]*models.Feedback),
+		sessionsFile: filepath.Join(dir, "sessions.json"),
+		leadsFile:    filepath.Join(dir, "leads.json"),
+		feedbackFile: filepath.Join(dir, "feedback.json"),
+	}
+}
+
+func TestConcurrentCreateAndAppendLosesNoMessages(t *testing.T) {
+	cases := []struct {
+		name string
+		add  func(s *SessionService, id, content string)
+	}{
+		{"GetOrCreateSession + AddMessage", func(s *SessionService, id, content string) {
+			s.GetOrCreateSession(id, "web")
+			s.AddMessage(id, "user", content)
+		}},
+		{"AddMessageToSession", func(s *SessionService, id, content string) {
+			s.AddMessageToSession(id, "web", "user", content, nil)
+		}},
+	}
+	const goroutines, perGoroutine = 16, 10
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := newTestSessionService(t)
+			const id = "race-session"
+
+			start := make(chan struct{})
+			var wg sync.WaitGroup
+			for g := 0; g < goroutines; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					<-start
+					for i := 0; i < perGoroutine; i++ {
+						c.add(s, id, fmt.Sprintf("%d-%d", g, i))
+						_ = s.GetMessages(id) // lecturas concurrentes con las escrituras
+					}
+				}(g)
+			}
+			close(start)
+			wg.Wait()
+
+			messages := s.GetMessages(id)
+			if len(messages) != goroutines*perGoroutine {
+				t.Fatalf("got %d messages, want %d", len(messages), goroutines*perGoroutine)
+			}
+			seen := make(map[string]bool, len(messages))
+			for _, m := range messages {
+				if seen[m.Content] {
+					t.Fatalf("duplicate message %q", m.Content)
+				}
+				seen[m.Content] = true
+			}
+			if len(s.GetAllSessions()) != 1 {
+				t.Fatalf("got %d sessions, want 1", len(s.GetAllSessions()))
+			}
+		})
+	}
+}
+
+func TestSessionReadsAreCopies(t *testing.T) {
+	s := newTestSessionService(t)
+	snap := s.AddMessageToSession("copy-1", "web", "user", "hola", nil)
+	s.SetMetadata("copy-1", "k", "v")
+
+	snap.Messages[0].Content = "modificado"
+	s.GetMessages("copy-1")[0].Content = "modificado"
+	got := s.GetSnapshot("copy-1")
+	got.Metadata["k"] = "otro"
+
+	if m := s.GetMessages("copy-1"); len(m) != 1 || m[0].Content != "hola" {
+		t.Fatalf("stored messages changed through a copy: %+v", m)
+	}
+	if v := s.GetMetadata("copy-1", "k"); v != "v" {
+		t.Fatalf("metadata changed through a copy: %q", v)
+	}
+	if s.GetSnapshot("missing") != nil || len(s.GetMessages("missing")) != 0 {
+		t.Fatal("missing session should read as empty")
+	}
+}
+
+func TestSubscribeLeads(t *testing.T) {
+	s := newTestSessionService(t)
+	updates, unsubscribe := s.SubscribeLeads()
+	other, unsubscribeOther := s.SubscribeLeads()
+	defer unsubscribeOther()
+
+	s.CreateOrUpdateLead(&models.Lead{SessionID: "sub-1", Channel: "web", Score: 70, Category: "warm"})
+	s.CreateOrUpdateLead(&models.Lead{SessionID: "sub-1", Channel: "web", Score: 90, Category: "hot"})
+	s.CreateOrUpdateLead(&models.Lead{SessionID: "sub-1", Channel: "web", Score: 91, Category: "hot"})
+
+	want := []struct {
+		category, previous string
+		changed            bool
+	}{
+		{"warm", "", true},
+		{"hot", "warm", true},
+		{"hot", "hot", false},
+	}
+	for _, ch := range []<-chan models.LeadUpdate{updates, other} {
+		for i, w := range want {
+			u := <-ch
+			if u.Lead.Category != w.category || u.PreviousCategory != w.previous || u.CategoryChanged != w.changed {
+				t.Fatalf("update %d = %+v, want %+v", i, u, w)
+			}
+		}
+	}
+
+	unsubscribe()
+	unsubscribe() // idempotente
+	if _, ok := <-updates; ok {
+		t.Fatal("channel still open after unsubscribe")
+	}
+	s.CreateOrUpdateLead(&models.Lead{SessionID: "sub-2", Category: "cold"})
+	if u := <-other; u.Lead.SessionID != "sub-2" {
+		t.Fatalf("remaining subscriber got %+v", u)
+	}
+}
+
+func TestSlowLeadSubscriberDoesNotBlock(t *testing.T) {
+	s := newTestSessionService(t)
+	_, unsubscribe := s.SubscribeLeads() // nunca lee
+	defer unsubscribe()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < leadSubscriberBuffer*2; i++ {
+			s.CreateOrUpdateLead(&models.Lead{SessionID: fmt.Sprintf("slow-%d", i), Category: "cold"})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("CreateOrUpdateLead blocked on a full subscriber")
+	}
+}
+
+func TestCloseLeadSubscribers(t *testing.T) {
+	s := newTestSessionService(t)
+	a, unsubscribeA := s.SubscribeLeads()
+	b, unsubscribeB := s.SubscribeLeads()
+
+	s.CloseLeadSubscribers()
+	for _, ch := range []<-chan models.LeadUpdate{a, b} {
+		if _, ok := <-ch; ok {
+			t.Fatal("subscriber channel still open")
+		}
+	}
+	// los handlers igual llaman a su unsubscribe al salir: no debe cerrar dos veces
+	unsubscribeA()
+	unsubscribeB()
+	s.CreateOrUpdateLead(&models.Lead{SessionID: "closed-1", Category: "cold"})
+}
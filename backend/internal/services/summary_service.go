@@ -0,0 +1,144 @@
+package services
+
+import (
+	"bob-hackathon/internal/config"
+	"bob-hackathon/internal/models"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// TextGenerator genera texto a partir de un prompt (GeminiService en producción)
+type TextGenerator interface {
+	Generate(ctx context.Context, prompt string) (string, error)
+}
+
+// SummaryService mantiene un resumen acumulado de las sesiones largas: los turnos
+// viejos se resumen y a los agentes solo les llega resumen + turnos recientes.
+type SummaryService struct {
+	llm        TextGenerator
+	sessions   *SessionService
+	every      int // resumir cuando haya al menos N mensajes viejos sin resumir
+	keepRecent int // mensajes recientes que siempre van completos
+	mu         sync.Mutex
+	inflight   map[string]bool
+}
+
+var summaryServiceInstance *SummaryService
+var summaryServiceOnce sync.Once
+
+func GetSummaryService() *SummaryService {
+	summaryServiceOnce.Do(func() {
+		summaryServiceInstance = NewSummaryService(
+			GetGeminiService(),
+			GetSessionService(),
+			config.AppConfig.SummaryEvery,
+			config.AppConfig.SummaryKeepRecent,
+		)
+	})
+	return summaryServiceInstance
+}
+
+func NewSummaryService(llm TextGenerator, sessions *SessionService, every, keepRecent int) *SummaryService {
+	return &SummaryService{
+		llm:        llm,
+		sessions:   sessions,
+		every:      every,
+		keepRecent: keepRecent,
+		inflight:   make(map[string]bool),
+	}
+}
+
+// MaybeSummarize resume los mensajes viejos de la sesión si ya se acumularon
+// every sin resumir. Devuelve true si generó un resumen nuevo.
+func (s *SummaryService) MaybeSummarize(ctx context.Context, sessionID string) (bool, error) {
+	if s.every <= 0 {
+		return false, nil
+	}
+
+	session := s.sessions.GetSession(sessionID)
+	if session == nil {
+		return false, nil
+	}
+	messages := s.sessions.GetMessages(sessionID)
+	previous, upTo := s.sessions.GetSummary(sessionID)
+
+	cut := len(messages) - s.keepRecent
+	if cut-upTo < s.every {
+		return false, nil
+	}
+
+	// un solo resumen en curso por sesión
+	s.mu.Lock()
+	if s.inflight[sessionID] {
+		s.mu.Unlock()
+		return false, nil
+	}
+	s.inflight[sessionID] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.inflight, sessionID)
+		s.mu.Unlock()
+	}()
+
+	var history strings.Builder
+	for _, msg := range messages[upTo:cut] {
+		history.WriteString(fmt.Sprintf("%s: %s\n", msg.Role, msg.Content))
+	}
+
+	prompt, err := GetPromptStore().Render("summary", PromptData{
+		SessionID: sessionID,
+		Channel:   session.Channel,
+		Summary:   previous,
+		History:   history.String(),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	summary, err := s.llm.Generate(ctx, prompt)
+	if err != nil {
+		return false, fmt.Errorf("error al resumir sesión %s: %w", sessionID, err)
+	}
+	summary = strings.TrimSpace(summary)
+	if summary == "" {
+		return false, fmt.Errorf("resumen vacío para sesión %s", sessionID)
+	}
+
+	s.sessions.UpdateSummary(sessionID, summary, cut)
+	log.Printf("📝 Resumen de %s actualizado (mensajes 0-%d)", sessionID, cut)
+	return true, nil
+}
+
+// Context devuelve el resumen vigente y los mensajes que aún no cubre
+func (s *SummaryService) Context(sessionID string) (string, []models.Message) {
+	messages := s.sessions.GetMessages(sessionID)
+	summary, upTo := s.sessions.GetSummary(sessionID)
+	if upTo > len(messages) {
+		upTo = len(messages)
+	}
+	return summary, messages[upTo:]
+}
+
+func init() {
+	RegisterDefaultPrompt("summary", summaryPromptTemplate, "History")
+}
+
+// summaryPromptTemplate template por defecto (editable vía /api/admin/prompts/summary)
+const summaryPromptTemplate = `Eres el asistente que resume conversaciones de ventas de BOB Subastas para los agentes y para un asesor humano.
+{{if .Summary}}
+RESUMEN ANTERIOR:
+{{.Summary}}
+{{end}}
+MENSAJES NUEVOS A INCORPORAR:
+{{.History}}
+Escribe un resumen actualizado en español de máximo 8 líneas que integre el resumen anterior y los mensajes nuevos:
+- Qué busca el usuario (vehículo/inmueble, marca, modelo, presupuesto, urgencia)
+- Datos que dio de sí mismo (nombre, ubicación, empresa, experiencia en subastas)
+- Preguntas pendientes o compromisos (visitas, llamadas)
+- Tono e interés percibido
+
+Responde solo con el resumen, sin encabezados.`
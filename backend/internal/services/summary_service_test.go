@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// stubGenerator TextGenerator de prueba: cuenta llamadas y guarda el último prompt
+type stubGenerator struct {
+	calls  int
+	prompt string
+	err    error
+}
+
+func (g *stubGenerator) Generate(_ context.Context, prompt string) (string, error) {
+	g.calls++
+	g.prompt = prompt
+	if g.err != nil {
+		return "", g.err
+	}
+	return fmt.Sprintf("  resumen %d  ", g.calls), nil
+}
+
+func TestSummaryOncePerThresholdCrossing(t *testing.T) {
+	sessions := GetSessionService()
+	gen := &stubGenerator{}
+	s := NewSummaryService(gen, sessions, 4, 2)
+	const id = "summary-threshold"
+	sessions.GetOrCreateSession(id, "web")
+
+	// mensajes totales → resúmenes esperados (cut = total-2; resume al acumular 4 sin resumir)
+	steps := []struct {
+		total     int
+		generated bool
+		calls     int
+		upTo      int
+	}{
+		{1, false, 0, 0},
+		{5, false, 0, 0},
+		{6, true, 1, 4},  // primer cruce
+		{7, false, 1, 4}, // se reutiliza
+		{9, false, 1, 4},
+		{10, true, 2, 8}, // segundo cruce
+		{10, false, 2, 8},
+	}
+	added := 0
+	for _, st := range steps {
+		for ; added < st.total; added++ {
+			sessions.AddMessage(id, []string{"user", "assistant"}[added%2], fmt.Sprintf("mensaje %d", added))
+		}
+		generated, err := s.MaybeSummarize(context.Background(), id)
+		if err != nil {
+			t.Fatalf("total %d: %v", st.total, err)
+		}
+		summary, upTo := sessions.GetSummary(id)
+		if generated != st.generated || gen.calls != st.calls || upTo != st.upTo {
+			t.Fatalf("total %d: generated=%v calls=%d upTo=%d, want %v %d %d", st.total, generated, gen.calls, upTo, st.generated, st.calls, st.upTo)
+		}
+		if st.calls > 0 && summary != fmt.Sprintf("resumen %d", st.calls) {
+			t.Fatalf("total %d: summary = %q", st.total, summary)
+		}
+	}
+
+	// el segundo resumen integra el anterior y solo los mensajes nuevos
+	if !strings.Contains(gen.prompt, "resumen 1") || !strings.Contains(gen.prompt, "mensaje 4") || strings.Contains(gen.prompt, "mensaje 3\n") {
+		t.Fatalf("second prompt = %q", gen.prompt)
+	}
+
+	summary, recent := s.Context(id)
+	if summary != "resumen 2" || len(recent) != 2 || recent[0].Content != "mensaje 8" {
+		t.Fatalf("Context = %q, %d recent (%+v)", summary, len(recent), recent)
+	}
+}
+
+func TestSummaryDisabledAndErrors(t *testing.T) {
+	sessions := GetSessionService()
+	const id = "summary-errors"
+	sessions.GetOrCreateSession(id, "web")
+	for i := 0; i < 8; i++ {
+		sessions.AddMessage(id, "user", fmt.Sprintf("m%d", i))
+	}
+
+	cases := []struct {
+		name  string
+		every int
+		err   error
+		id    string
+	}{
+		{"disabled", 0, nil, id},
+		{"unknown session", 2, nil, "summary-none"},
+		{"llm error", 2, errors.New("boom"), id},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := NewSummaryService(&stubGenerator{err: c.err}, sessions, c.every, 2)
+			generated, err := s.MaybeSummarize(context.Background(), c.id)
+			if generated || (err != nil) != (c.err != nil) {
+				t.Fatalf("MaybeSummarize = %v, %v", generated, err)
+			}
+			if summary, upTo := sessions.GetSummary(id); summary != "" || upTo != 0 {
+				t.Fatalf("summary stored on failure: %q %d", summary, upTo)
+			}
+		})
+	}
+}
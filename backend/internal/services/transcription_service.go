@@ -0,0 +1,48 @@
+package services
+
+import (
+	"bob-hackathon/internal/llm"
+	"bob-hackathon/internal/metrics"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Transcriber convierte una nota de voz en texto. GeminiService lo implementa con el
+// proveedor de LLM (multimodal); cualquier otro STT (Whisper, Google STT...) puede reemplazarlo.
+type Transcriber interface {
+	Transcribe(ctx context.Context, mimeType string, audio []byte) (string, error)
+}
+
+// Transcribe implementa Transcriber: el audio va inline junto al prompt "transcription"
+func (g *GeminiService) Transcribe(ctx context.Context, mimeType string, audio []byte) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	prompt, err := GetPromptStore().Render("transcription", PromptData{})
+	if err != nil {
+		return "", err
+	}
+
+	start := time.Now()
+	text, err := g.provider.Generate(ctx, []llm.Part{llm.Text(prompt), llm.Blob(mimeType, audio)}, g.opts)
+	metrics.ObserveGemini("gemini_transcribe", start, err)
+	if errors.Is(err, llm.ErrNoResponse) {
+		return "", nil // audio sin voz
+	}
+	if err != nil {
+		return "", fmt.Errorf("error al transcribir audio: %w", err)
+	}
+	return strings.TrimSpace(text), nil
+}
+
+func init() {
+	RegisterDefaultPrompt("transcription", transcriptionPromptTemplate)
+}
+
+// transcriptionPromptTemplate template por defecto (editable vía /api/admin/prompts/transcription)
+const transcriptionPromptTemplate = `Transcribe textualmente esta nota de voz de un cliente de BOB Subastas (español de Perú).
+Devuelve SOLO el texto dicho, sin comillas, comentarios ni marcas de tiempo. Conserva montos, marcas, modelos y años tal como se dicen.
+Si no se entiende nada o no hay voz, responde vacío.`
@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// USDToPEN tipo de cambio para convertir presupuestos en dólares (se sobreescribe desde config)
+var USDToPEN = 3.75
+
+// Montos expresados solo con una palabra clave ("presupuesto de 500") por debajo de esto se ignoran
+const minKeywordBudget = 100
+
+var budgetRegex = regexp.MustCompile(
+	`(s/\.?|us\$|usd|\$)?\s*` + // prefijo de moneda
+		`(\d+(?:[.,\s]\d{3})*(?:[.,]\d+)?)` + // número con separadores
+		`\s*(k|mil|lucas?|millon(?:es)?)?\b` + // multiplicador
+		`\s*(soles|sol|dolares|dolar|usd|pen)?`) // moneda al final
+
+// Unidades que, justo después del número, indican que no es dinero ("50 mil km", "150 hp")
+var nonMoneyUnitRegex = regexp.MustCompile(`^\s*(km|kms|kilometros?|cc|hp)\b`)
+
+var budgetKeywords = []string{"presupuesto", "hasta", "maximo", "cuento con", "dispongo", "invertir", "pagar", "gastar"}
+
+var accentFolder = strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "Á", "a", "É", "e", "Í", "i", "Ó", "o", "Ú", "u")
+
+// ParseBudget extrae el primer monto de dinero de un mensaje y lo devuelve en soles.
+// Reconoce las formas comunes en Perú: "S/ 20,000", "20 mil soles", "20k", "20 lucas",
+// "$15,000", "15 mil dólares", "1.5 millones". Números sueltos sin moneda, multiplicador
+// ni palabra de presupuesto cerca (ej: "del 2020") no cuentan, tampoco los años de modelo
+// ("hasta 2020") ni los números seguidos de km, cc o hp.
+func ParseBudget(text string) (float64, bool) {
+	lower := accentFolder.Replace(strings.ToLower(text))
+
+	for _, m := range budgetRegex.FindAllStringSubmatchIndex(lower, -1) {
+		prefix := submatch(lower, m, 1)
+		number := submatch(lower, m, 2)
+		mult := submatch(lower, m, 3)
+		suffix := submatch(lower, m, 4)
+
+		// no tomar dígitos pegados a letras (ej: "modelo x5", "4x4")
+		if m[4] > 0 && isASCIILetter(lower[m[4]-1]) && prefix == "" {
+			continue
+		}
+
+		// kilometraje, cilindrada o potencia, no un monto
+		if nonMoneyUnitRegex.MatchString(lower[m[1]:]) {
+			continue
+		}
+
+		amount, ok := parseAmount(number)
+		if !ok || amount <= 0 {
+			continue
+		}
+
+		switch {
+		case mult == "k" || mult == "mil" || strings.HasPrefix(mult, "luca"):
+			amount *= 1000
+		case strings.HasPrefix(mult, "millon"):
+			amount *= 1000000
+		}
+
+		hasCue := prefix != "" || mult != "" || suffix != ""
+		if !hasCue && (amount < minKeywordBudget || isYear(number) || !hasBudgetKeyword(lower[:m[0]])) {
+			continue
+		}
+
+		if prefix == "$" || prefix == "us$" || prefix == "usd" || strings.HasPrefix(suffix, "dolar") || suffix == "usd" {
+			amount *= USDToPEN
+		}
+		return amount, true
+	}
+	return 0, false
+}
+
+func submatch(s string, m []int, i int) string {
+	if m[2*i] < 0 {
+		return ""
+	}
+	return s[m[2*i]:m[2*i+1]]
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// isYear un número suelto de cuatro cifras entre 1900 y 2099 es un año de modelo
+// ("del 2015 hasta 2020"), aunque tenga una palabra de presupuesto delante
+func isYear(number string) bool {
+	if len(number) != 4 {
+		return false
+	}
+	year, err := strconv.Atoi(number)
+	return err == nil && year >= 1900 && year <= 2099
+}
+
+// hasBudgetKeyword hay una palabra de presupuesto poco antes del número
+func hasBudgetKeyword(before string) bool {
+	if len(before) > 30 {
+		before = before[len(before)-30:]
+	}
+	for _, kw := range budgetKeywords {
+		if strings.Contains(before, kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAmount interpreta separadores: "20,000" y "20.000" son miles, "2,5" y "1.5" decimales,
+// y en "20,000.50" el último separador es el decimal
+func parseAmount(number string) (float64, bool) {
+	number = strings.ReplaceAll(number, " ", "")
+
+	lastDot := strings.LastIndex(number, ".")
+	lastComma := strings.LastIndex(number, ",")
+
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		// ambos: el último es el decimal
+		dec := max(lastDot, lastComma)
+		number = strings.NewReplacer(".", "", ",", "").Replace(number[:dec]) + "." + number[dec+1:]
+	case lastDot >= 0 || lastComma >= 0:
+		sep := "."
+		idx := lastDot
+		if lastComma >= 0 {
+			sep, idx = ",", lastComma
+		}
+		decimals := len(number) - idx - 1
+		if strings.Count(number, sep) > 1 || decimals == 3 {
+			number = strings.ReplaceAll(number, sep, "")
+		} else {
+			number = strings.Replace(number, sep, ".", 1)
+		}
+	}
+
+	amount, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, false
+	}
+	return amount, true
+}
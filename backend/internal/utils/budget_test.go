@@ -0,0 +1,53 @@
+package utils
+
+import "testing"
+
+func TestParseBudget(t *testing.T) {
+	cases := []struct {
+		in   string
+		want float64
+		ok   bool
+	}{
+		{"tengo 20 lucas", 20000, true},
+		{"S/ 20,000", 20000, true},
+		{"S/. 20 000 soles", 20000, true},
+		{"s/20000", 20000, true},
+		{"20k", 20000, true},
+		{"unos 20K nomás", 20000, true},
+		{"20 mil soles", 20000, true},
+		{"20 mil", 20000, true},
+		{"$15,000", 56250, true},
+		{"US$ 15000", 56250, true},
+		{"15 mil dólares", 56250, true},
+		{"15k dolares", 56250, true},
+		{"1.5 millones", 1500000, true},
+		{"un millón de soles", 0, false},
+		{"2,5k", 2500, true},
+		{"20.000 soles", 20000, true},
+		{"1.500.000 soles", 1500000, true},
+		{"20,000.50 soles", 20000.50, true},
+		{"mi presupuesto es 18000", 18000, true},
+		{"hasta 25.000", 25000, true},
+		{"busco algo del 2020", 0, false},
+		{"tengo 3 hijos", 0, false},
+		{"un hilux 4x4", 0, false},
+		{"un bmw x5 2019", 0, false},
+		{"presupuesto de 50", 0, false},
+		{"hola", 0, false},
+		{"unos 30 mil soles o 35k", 30000, true},
+		// años de modelo y kilometraje no son presupuesto
+		{"modelos del 2015 hasta 2020", 0, false},
+		{"quiero pagar 2019 o 2020", 0, false},
+		{"un auto con 50 mil km", 0, false},
+		{"tiene 120 mil kilometros", 0, false},
+		{"tiene 120 mil kilómetros y cuesta 40 mil soles", 40000, true},
+		{"motor de 1600 cc", 0, false},
+		{"hasta 2020 y con presupuesto de 30 mil", 30000, true},
+	}
+	for _, c := range cases {
+		got, ok := ParseBudget(c.in)
+		if ok != c.ok || got != c.want {
+			t.Errorf("ParseBudget(%q) = %v, %v; want %v, %v", c.in, got, ok, c.want, c.ok)
+		}
+	}
+}
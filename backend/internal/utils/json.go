@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ErrNoJSON la respuesta del modelo no contiene un objeto JSON válido
+var ErrNoJSON = errors.New("no se encontró un objeto JSON en la respuesta")
+
+// ExtractJSON devuelve el primer objeto JSON balanceado y válido de una respuesta
+// del LLM. Prioriza el contenido de bloques ```json ... ``` y tolera texto antes
+// o después del JSON, llaves dentro de strings y objetos anidados.
+func ExtractJSON(text string) (string, error) {
+	for _, block := range fencedBlocks(text) {
+		if obj, ok := firstJSONObject(block); ok {
+			return obj, nil
+		}
+	}
+	if obj, ok := firstJSONObject(text); ok {
+		return obj, nil
+	}
+	return "", ErrNoJSON
+}
+
+// fencedBlocks contenido de los bloques de código markdown (sin la línea del lenguaje)
+func fencedBlocks(text string) []string {
+	var blocks []string
+	for {
+		start := strings.Index(text, "```")
+		if start == -1 {
+			return blocks
+		}
+		rest := text[start+3:]
+		// saltar el tag de lenguaje (```json)
+		if nl := strings.IndexByte(rest, '\n'); nl != -1 && !strings.Contains(rest[:nl], "{") {
+			rest = rest[nl+1:]
+		}
+		end := strings.Index(rest, "```")
+		if end == -1 {
+			return append(blocks, rest)
+		}
+		blocks = append(blocks, rest[:end])
+		text = rest[end+3:]
+	}
+}
+
+// firstJSONObject prueba cada '{' como inicio y busca su cierre respetando strings;
+// devuelve el primer candidato que además sea JSON válido
+func firstJSONObject(text string) (string, bool) {
+	for start := strings.IndexByte(text, '{'); start != -1; {
+		if end := matchingBrace(text, start); end != -1 {
+			candidate := text[start : end+1]
+			if json.Valid([]byte(candidate)) {
+				return candidate, true
+			}
+		}
+		next := strings.IndexByte(text[start+1:], '{')
+		if next == -1 {
+			break
+		}
+		start += next + 1
+	}
+	return "", false
+}
+
+// matchingBrace índice de la '}' que cierra la '{' en start, o -1
+func matchingBrace(text string, start int) int {
+	depth := 0
+	inString := false
+	escaped := false
+	for i := start; i < len(text); i++ {
+		c := text[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
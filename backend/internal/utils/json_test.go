@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExtractJSON(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want string
+		err  error
+	}{
+		{"plain", `{"a":1}`, `{"a":1}`, nil},
+		{"fenced", "```json\n{\"a\":1}\n```", `{"a":1}`, nil},
+		{"fenced without language", "```\n{\"a\":1}\n```", `{"a":1}`, nil},
+		{"prose with braces before fence", "Uso {esto} como ejemplo:\n```json\n{\"a\":1}\n```\nListo {fin}", `{"a":1}`, nil},
+		{"prose after json", `{"a":{"b":2}} y luego comento algo } más`, `{"a":{"b":2}}`, nil},
+		{"nested braces", `Resultado: {"d":{"e":{"f":3}},"g":4}`, `{"d":{"e":{"f":3}},"g":4}`, nil},
+		{"braces inside strings", `{"response":"usa {llaves} y \"comillas\" }"}`, `{"response":"usa {llaves} y \"comillas\" }"}`, nil},
+		{"invalid candidate skipped", `{no es json} {"ok":true}`, `{"ok":true}`, nil},
+		{"unclosed fence", "```json\n{\"a\":1}", `{"a":1}`, nil},
+		{"no json", "lo siento, no puedo", "", ErrNoJSON},
+		{"unbalanced", `{"a":1`, "", ErrNoJSON},
+		{"empty", "", "", ErrNoJSON},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := ExtractJSON(c.in)
+			if got != c.want || !errors.Is(err, c.err) {
+				t.Fatalf("ExtractJSON = %q, %v; want %q, %v", got, err, c.want, c.err)
+			}
+		})
+	}
+}
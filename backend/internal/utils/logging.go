@@ -0,0 +1,11 @@
+package utils
+
+import "log"
+
+// Logf log.Printf con el ID de correlación de la request como prefijo (si hay)
+func Logf(requestID, format string, args ...any) {
+	if requestID != "" {
+		format = "[req=" + requestID + "] " + format
+	}
+	log.Printf(format, args...)
+}
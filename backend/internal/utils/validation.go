@@ -10,6 +10,7 @@ const (
 	MaxMessageLength = 2000
 	MinMessageLength = 1
 	MaxSessionIDLength = 100
+	MaxCommentLength   = 500
 )
 
 // ValidateAndSanitizeMessage valida y sanitiza mensajes de chat
@@ -75,6 +76,50 @@ func ValidateChannel(channel string) error {
 	return nil
 }
 
+// ValidateTier normaliza el tier del cliente ("free", "premium", ...); vacío = sin tier
+func ValidateTier(tier string) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(tier))
+	if normalized == "" {
+		return "", nil
+	}
+	if matched, _ := regexp.MatchString(`^[a-z0-9_-]{1,32}$`, normalized); !matched {
+		return "", &ValidationError{Field: "tier", Message: "Tier no válido (letras, números, - y _; máximo 32)"}
+	}
+	return normalized, nil
+}
+
+// ValidateRating valida el voto de feedback ("up" o "down") y lo normaliza
+func ValidateRating(rating string) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(rating))
+	if normalized != "up" && normalized != "down" {
+		return "", &ValidationError{Field: "rating", Message: "Rating no válido (use: up, down)"}
+	}
+	return normalized, nil
+}
+
+// ValidateMessageIndex valida que index apunte a un mensaje existente (0..total-1)
+func ValidateMessageIndex(index, total int) error {
+	if index < 0 || index >= total {
+		return &ValidationError{Field: "messageIndex", Message: "messageIndex fuera de rango"}
+	}
+	return nil
+}
+
+// SanitizeComment valida y sanitiza el comentario opcional de un feedback
+func SanitizeComment(comment string) (string, error) {
+	trimmed := strings.TrimSpace(comment)
+	if utf8.RuneCountInString(trimmed) > MaxCommentLength {
+		return "", &ValidationError{Field: "comment", Message: "El comentario es demasiado largo (máximo 500 caracteres)"}
+	}
+
+	sanitized := sanitizeControlChars(trimmed)
+	if isInjectionAttempt(sanitized) {
+		return "", &ValidationError{Field: "comment", Message: "Comentario contiene patrones no permitidos"}
+	}
+
+	return sanitized, nil
+}
+
 // sanitizeControlChars elimina caracteres de control peligrosos pero mantiene saltos de línea y emojis
 func sanitizeControlChars(s string) string {
 	// Eliminar caracteres de control excepto \n, \r, \t
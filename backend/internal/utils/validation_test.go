@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateRating(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"up", "up", true},
+		{"down", "down", true},
+		{" UP ", "up", true},
+		{"Down", "down", true},
+		{"", "", false},
+		{"meh", "", false},
+		{"👍", "", false},
+	}
+	for _, c := range cases {
+		got, err := ValidateRating(c.in)
+		if (err == nil) != c.ok || got != c.want {
+			t.Errorf("ValidateRating(%q) = %q, %v; want %q ok=%v", c.in, got, err, c.want, c.ok)
+		}
+	}
+}
+
+func TestValidateMessageIndex(t *testing.T) {
+	cases := []struct {
+		index, total int
+		ok           bool
+	}{
+		{0, 1, true},
+		{3, 4, true},
+		{4, 4, false},
+		{-1, 4, false},
+		{0, 0, false},
+	}
+	for _, c := range cases {
+		if err := ValidateMessageIndex(c.index, c.total); (err == nil) != c.ok {
+			t.Errorf("ValidateMessageIndex(%d, %d) = %v, want ok=%v", c.index, c.total, err, c.ok)
+		}
+	}
+}
+
+func TestSanitizeComment(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want string
+		ok   bool
+	}{
+		{"empty", "", "", true},
+		{"trimmed", "  muy útil 👍  ", "muy útil 👍", true},
+		{"control chars removed", "bien\x00\x07 hecho", "bien hecho", true},
+		{"newlines kept", "línea 1\nlínea 2", "línea 1\nlínea 2", true},
+		{"max length in runes", strings.Repeat("ñ", MaxCommentLength), strings.Repeat("ñ", MaxCommentLength), true},
+		{"too long", strings.Repeat("a", MaxCommentLength+1), "", false},
+		{"injection", "<script>alert(1)</script>", "", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := SanitizeComment(c.in)
+			if (err == nil) != c.ok || got != c.want {
+				t.Fatalf("SanitizeComment(%q) = %q, %v; want %q ok=%v", c.in, got, err, c.want, c.ok)
+			}
+		})
+	}
+}
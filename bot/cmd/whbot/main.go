@@ -5,9 +5,11 @@ import (
 	"context"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/investigadorinexperto/bot/engine"
 	"github.com/investigadorinexperto/bot/internal/config"
+	"github.com/investigadorinexperto/bot/pkg/typing"
 	"github.com/joho/godotenv"
 	"go.mau.fi/whatsmeow/types/events"
 )
@@ -30,11 +32,47 @@ func main() {
 		BackupEvery:        cfgApp.BackupEvery,
 		MaxConnAttempts:    cfgApp.MaxConnAttempts,
 		ReconnectBaseDelay: cfgApp.ReconnectBaseDelay,
+		ReconnectMaxDelay:  cfgApp.ReconnectMaxDelay,
 		HTTPPort:           cfgApp.HTTPPort,
+		RateLimits: engine.RateLimits{
+			Send:   engine.RateLimit{Every: cfgApp.RateSendEvery, Burst: cfgApp.RateSendBurst},
+			Media:  engine.RateLimit{Every: cfgApp.RateMediaEvery, Burst: cfgApp.RateMediaBurst},
+			Status: engine.RateLimit{Every: cfgApp.RateStatusEvery, Burst: cfgApp.RateStatusBurst},
+		},
+		SendQueueSize:     cfgApp.SendQueueSize,
+		AdminSecret:       cfgApp.EngineAdminKey,
+		APIToken:          cfgApp.EngineAPIToken,
+		AllowNoTokenDev:   cfgApp.EngineNoAuthDev,
+		RESTBodyLimit:     cfgApp.EngineBodyLimit,
+		MediaBaseDir:      cfgApp.MediaBaseDir,
+		MaxMediaBytes:     cfgApp.MaxMediaBytes,
+		MediaFetchTimeout: cfgApp.MediaFetchTO,
+		MsgRetention:      time.Duration(cfgApp.MsgRetentionDays) * 24 * time.Hour,
+		MsgPruneEvery:     cfgApp.MsgPruneEvery,
+		HistoryMaxPerChat: cfgApp.HistoryMaxPerChat,
+		ChatNameTTL:       cfgApp.ChatNameTTL,
+		PresenceMode:      cfgApp.PresenceMode,
+		PresenceAwayAfter: cfgApp.PresenceAwayAfter,
+		ScheduleTick:      cfgApp.ScheduleTick,
+		QuietHours:        cfgApp.QuietHours,
+		QuietTimezone:     cfgApp.QuietTimezone,
+		QuietMode:         cfgApp.QuietMode,
+		QuietReplyWindow:  cfgApp.QuietReplyWindow,
+		Typing: typing.Timing{
+			Base:    cfgApp.ReplyBaseWait,
+			PerChar: time.Duration(cfgApp.ReplyPerCharMs) * time.Millisecond,
+			Jitter:  time.Duration(cfgApp.ReplyJitterMs) * time.Millisecond,
+			Min:     cfgApp.ReplyMinWait,
+			Max:     cfgApp.ReplyMaxWait,
+		},
 		Forward: engine.ForwardingConfig{
 			Mode:         forwardMode,         // folder u off (webhook va aparte)
 			ContextDepth: cfgApp.ContextDepth, // contexto N últimos mensajes
 			OutFolder:    cfgApp.Outbox,       // usado si Mode=folder
+			MaxFileBytes: cfgApp.OutboxMaxBytes,
+			GzipRotated:  cfgApp.OutboxGzip,
+			RetainParts:  cfgApp.OutboxRetain,
+			FsyncWrites:  cfgApp.OutboxFsync,
 			ExtraParams:  cfgApp.ForwardExtraJSON,
 			Webhook: engine.WebhookConfig{
 				Enabled: cfgApp.WebhookEnabled,
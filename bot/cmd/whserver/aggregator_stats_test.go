@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/investigadorinexperto/bot/pkg/pipeline"
+)
+
+func TestAggregatorStatsHandler(t *testing.T) {
+	agg := pipeline.NewAggregator(time.Hour, nil, nil)
+	for chat, n := range map[string]int{"a@s.whatsapp.net": 2, "b@s.whatsapp.net": 1, "c@g.us": 4} {
+		for i := 0; i < n; i++ {
+			agg.Add(chat)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	aggregatorStatsHandler(agg)(rec, httptest.NewRequest(http.MethodGet, "/debug/aggregator", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("status = %d, content-type = %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var got struct {
+		PendingChats    int `json:"pending_chats"`
+		PendingMessages int `json:"pending_messages"`
+		Chats           map[string]struct {
+			Count       int   `json:"count"`
+			FlushesInMs int64 `json:"flushes_in_ms"`
+		} `json:"chats"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.PendingChats != 3 || got.PendingMessages != 7 {
+		t.Fatalf("got %d chats / %d messages, want 3 / 7", got.PendingChats, got.PendingMessages)
+	}
+	tests := []struct {
+		chat string
+		want int
+	}{
+		{"a@s.whatsapp.net", 2},
+		{"b@s.whatsapp.net", 1},
+		{"c@g.us", 4},
+	}
+	for _, tt := range tests {
+		c := got.Chats[tt.chat]
+		if c.Count != tt.want || c.FlushesInMs <= 0 {
+			t.Errorf("%s = %+v, want count %d", tt.chat, c, tt.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateBackendURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{"http://localhost:3000/api/chat/message", false},
+		{"https://bob.example.com/api/chat/message", false},
+		{"  http://10.0.0.5:3000/api/chat/message  ", false},
+		{"", true},
+		{"localhost:3000/api/chat/message", true},
+		{"ftp://bob.example.com/x", true},
+		{"http:///api/chat/message", true},
+		{"http://bad host/", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if err := validateBackendURL(tt.url); (err != nil) != tt.wantErr {
+				t.Fatalf("validateBackendURL(%q) = %v, wantErr %v", tt.url, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBOBBackendSendsPayload(t *testing.T) {
+	type captured struct {
+		method, path, contentType, requestID, auth string
+		body                                       map[string]any
+	}
+	prev := engineToken
+	engineToken = "engine-secret"
+	defer func() { engineToken = prev }()
+
+	got := make(chan captured, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		c := captured{method: r.Method, path: r.URL.Path, contentType: r.Header.Get("Content-Type"), requestID: r.Header.Get(requestIDHeader), auth: r.Header.Get("Authorization")}
+		_ = json.Unmarshal(raw, &c.body)
+		got <- c
+		_, _ = w.Write([]byte(`{"reply":"ok"}`))
+	}))
+	defer srv.Close()
+
+	b := testBOBBackend(srv.URL + "/api/chat/message")
+	reply := b.Call(context.Background(), "51911111111", []string{"hola", "¿precio?"}, nil, "", jlog{})
+	if reply.Text != "ok" {
+		t.Fatalf("reply = %+v", reply)
+	}
+	c := <-got
+	if c.method != http.MethodPost || c.path != "/api/chat/message" || c.contentType != "application/json" {
+		t.Fatalf("request = %s %s (%s)", c.method, c.path, c.contentType)
+	}
+	if c.requestID == "" || c.requestID != reply.RequestID || c.body["requestId"] != reply.RequestID {
+		t.Fatalf("request id header %q body %v reply %q", c.requestID, c.body["requestId"], reply.RequestID)
+	}
+	// el token del engine: el backend solo programa seguimientos para turnos del bot
+	if c.auth != "Bearer engine-secret" {
+		t.Fatalf("Authorization = %q", c.auth)
+	}
+	want := map[string]any{
+		"sessionId": "wa-51911111111",
+		"message":   "hola\n¿precio?",
+		"channel":   "whatsapp",
+	}
+	for k, v := range want {
+		if c.body[k] != v {
+			t.Errorf("%s = %v, want %v", k, c.body[k], v)
+		}
+	}
+	if msgs, _ := c.body["messages"].([]any); len(msgs) != 2 || msgs[0] != "hola" || msgs[1] != "¿precio?" {
+		t.Errorf("messages = %v", c.body["messages"])
+	}
+	for _, k := range []string{"behavior", "tier"} {
+		if _, ok := c.body[k]; ok {
+			t.Errorf("%s sent without a value", k)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAddLatency(t *testing.T) {
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		since   time.Time
+		now     time.Time
+		wantSum int64
+		wantN   int
+	}{
+		{"adds", base, base.Add(1500 * time.Millisecond), 1500, 1},
+		{"zero since ignored", time.Time{}, base, 0, 0},
+		{"clock going back ignored", base, base.Add(-time.Second), 0, 0},
+		{"same instant", base, base, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sum int64
+			var n int
+			addLatency(&sum, &n, tt.since, tt.now)
+			if sum != tt.wantSum || n != tt.wantN {
+				t.Fatalf("sum/n = %d/%d, want %d/%d", sum, n, tt.wantSum, tt.wantN)
+			}
+		})
+	}
+}
+
+func TestAvgSeconds(t *testing.T) {
+	tests := []struct {
+		sum  int64
+		n    int
+		want float64
+	}{
+		{0, 0, 0},
+		{3000, 0, 0},
+		{3000, 2, 1.5},
+		{90000, 3, 30},
+	}
+	for _, tt := range tests {
+		if got := avgSeconds(tt.sum, tt.n); got != tt.want {
+			t.Errorf("avgSeconds(%d, %d) = %v, want %v", tt.sum, tt.n, got, tt.want)
+		}
+	}
+}
+
+// OUT → respuesta del usuario → receipt "read": cada latencia se cuenta una vez por OUT
+func TestBehaviorSignalsFromProfile(t *testing.T) {
+	const chat = "51911111111@s.whatsapp.net"
+	r, _ := newTestRouter(t)
+	if r.behaviorFor(chat) != nil {
+		t.Fatal("behavior without profile must be nil")
+	}
+
+	ctx := context.Background()
+	r.OnMessage(ctx, inboundText(chat, "A", "hola")) // sin OUT previo: no es latencia
+	r.incOutboundFor(chat)
+	time.Sleep(20 * time.Millisecond)
+	r.OnReceipt(ctx, Envelope{EventType: "receipt", ChatJID: chat, SenderJID: chat, ReceiptType: "read", MessageID: "OUT1"})
+	r.OnReceipt(ctx, Envelope{EventType: "receipt", ChatJID: chat, SenderJID: chat, ReceiptType: "read", MessageID: "OUT1"}) // repetido
+	r.OnReceipt(ctx, Envelope{EventType: "receipt", ChatJID: chat, SenderJID: chat, ReceiptType: "delivered", MessageID: "OUT1"})
+	time.Sleep(20 * time.Millisecond)
+	r.OnMessage(ctx, inboundText(chat, "B", "¿precio?"))
+	r.OnMessage(ctx, inboundText(chat, "C", "¿y el año?")) // segundo IN sin OUT de por medio
+
+	b := r.behaviorFor(chat)
+	tests := []struct {
+		key  string
+		want any
+	}{
+		{"responseSamples", 1},
+		{"readSamples", 1},
+		{"msgIn", 3},
+		{"msgOut", 1},
+		{"streakDays", 1},
+	}
+	for _, tt := range tests {
+		if b[tt.key] != tt.want {
+			t.Errorf("%s = %v, want %v", tt.key, b[tt.key], tt.want)
+		}
+	}
+	resp, _ := b["avgResponseLatencySec"].(float64)
+	read, _ := b["avgReadLatencySec"].(float64)
+	if resp < 0.04 || resp > 1 || read < 0.02 || read >= resp {
+		t.Errorf("latencies = response %vs, read %vs", resp, read)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetBlockValidation(t *testing.T) {
+	r, _ := newTestRouter(t)
+	now := time.Now()
+	tests := []struct {
+		name    string
+		chat    string
+		req     *BlockRequest
+		wantErr string
+	}{
+		{"no chat", " ", &BlockRequest{Permanent: true}, "chat required"},
+		{"no expiry", "51911000080@s.whatsapp.net", &BlockRequest{Spam: true}, "permanent, until or duration required"},
+		{"bad until", "51911000080@s.whatsapp.net", &BlockRequest{Until: "mañana"}, "bad until"},
+		{"until in the past", "51911000080@s.whatsapp.net", &BlockRequest{Until: now.Add(-time.Hour).Format(time.RFC3339)}, "until must be in the future"},
+		{"bad duration", "51911000080@s.whatsapp.net", &BlockRequest{Duration: "dos horas"}, "bad duration"},
+		{"negative duration", "51911000080@s.whatsapp.net", &BlockRequest{Duration: "-1h"}, "bad duration"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := r.setBlock(tt.chat, tt.req, now); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBlockExpiryAndPermanent(t *testing.T) {
+	r, _ := newTestRouter(t)
+	now := time.Now()
+	const temp, perm = "51911000081@s.whatsapp.net", "51911000082@s.whatsapp.net"
+
+	if _, err := r.setBlock(temp, &BlockRequest{Spam: true, Duration: "2h"}, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.setBlock(perm, &BlockRequest{Malicious: true, Permanent: true}, now); err != nil {
+		t.Fatal(err)
+	}
+	checks := []struct {
+		chat string
+		at   time.Time
+		want bool
+	}{
+		{temp, now.Add(time.Hour), true},
+		{temp, now.Add(3 * time.Hour), false}, // Until vencido
+		{perm, now.Add(24 * 365 * time.Hour), true},
+		{"51911000083@s.whatsapp.net", now, false},
+	}
+	for _, c := range checks {
+		if got := r.isBlocked(c.chat, c.at); got != c.want {
+			t.Errorf("isBlocked(%s, +%v) = %v, want %v", c.chat, c.at.Sub(now).Round(time.Hour), got, c.want)
+		}
+	}
+
+	// persistido de inmediato (sobrevive a un reinicio)
+	if p, err := loadProfileFromDisk(perm); err != nil || !p.Block.Permanent || !p.Block.Malicious {
+		t.Fatalf("persisted block = %+v (%v)", p.Block, err)
+	}
+
+	if _, err := r.setBlock(perm, nil, now); err != nil {
+		t.Fatal(err)
+	}
+	if r.isBlocked(perm, now) {
+		t.Fatal("unblock did not clear the permanent block")
+	}
+}
+
+func TestOnMessageSkipsBlockedChat(t *testing.T) {
+	r, sent := newTestRouter(t)
+	const chat = "51911000084@s.whatsapp.net"
+	if _, err := r.setBlock(chat, &BlockRequest{Spam: true, Permanent: true}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	r.OnMessage(context.Background(), Envelope{
+		EventType: "message", Direction: "in", ChatJID: chat, SenderJID: chat, MessageID: "B1",
+		Location: map[string]any{"type": "location", "latitude": -12.0, "longitude": -77.0},
+	})
+
+	p, _ := r.lookupProfile(chat)
+	if p.Metrics.MsgIn != 1 {
+		t.Fatalf("blocked message must still count: msg_in = %d", p.Metrics.MsgIn)
+	}
+	if len(p.Media.In) != 0 || len(sent.all()) != 0 {
+		t.Fatalf("blocked chat was processed: media %v, sent %v", p.Media.In, sent.all())
+	}
+}
+
+func TestRequireAdminToken(t *testing.T) {
+	ok := func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusNoContent) }
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{"disabled without token", "", "Bearer x", http.StatusForbidden},
+		{"missing header", "admin", "", http.StatusUnauthorized},
+		{"wrong token", "admin", "Bearer nope", http.StatusUnauthorized},
+		{"valid", "admin", "Bearer admin", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/profiles/x/block", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			requireAdminToken(tt.token, ok)(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("code = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
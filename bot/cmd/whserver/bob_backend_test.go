@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyBackend responde `fails` veces con failStatus y luego un reply válido
+func flakyBackend(t *testing.T, fails int32, failStatus int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= fails {
+			w.WriteHeader(failStatus)
+			_, _ = w.Write([]byte(`not json`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"reply":"hola","leadScore":72,"category":"caliente"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func testBOBBackend(url string) *bobBackend {
+	b := newBOBBackend(url, time.Second)
+	b.backoff = time.Millisecond
+	return b
+}
+
+func TestBOBBackendRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		fails      int32
+		status     int
+		wantText   string
+		wantCalls  int32
+		wantLead   bool
+		wantClosed bool // el breaker sigue sin fallos
+	}{
+		{"first try", 0, 0, "hola", 1, true, true},
+		{"recovers after 5xx", 2, http.StatusServiceUnavailable, "hola", 3, true, true},
+		{"recovers after 429", 1, http.StatusTooManyRequests, "hola", 2, true, true},
+		{"gives up after retries", 3, http.StatusBadGateway, bobFallbackError, 3, false, false},
+		{"4xx is not retried", 1, http.StatusBadRequest, bobFallbackDecode, 1, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := flakyBackend(t, tt.fails, tt.status)
+			b := testBOBBackend(srv.URL)
+			got := b.Call(context.Background(), "51911111111", []string{"hola"}, nil, "", jlog{})
+			if got.Text != tt.wantText || got.HasLead != tt.wantLead {
+				t.Fatalf("reply = %+v, want text %q lead %v", got, tt.wantText, tt.wantLead)
+			}
+			if tt.wantLead && (got.LeadScore != 72 || got.Category != "caliente") {
+				t.Fatalf("lead = %d %q", got.LeadScore, got.Category)
+			}
+			if n := calls.Load(); n != tt.wantCalls {
+				t.Fatalf("backend calls = %d, want %d", n, tt.wantCalls)
+			}
+			if closed := b.breaker.fails == 0; closed != tt.wantClosed {
+				t.Fatalf("breaker fails = %d", b.breaker.fails)
+			}
+		})
+	}
+}
+
+func TestBOBBackendTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	b := newBOBBackend(srv.URL, 50*time.Millisecond)
+	b.retries, b.backoff = 0, 0
+	start := time.Now()
+	if got := b.Call(context.Background(), "519", []string{"hola"}, nil, "", jlog{}); got.Text != bobFallbackError {
+		t.Fatalf("reply = %+v, want fallback", got)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("call took %v, client timeout not applied", d)
+	}
+}
+
+func TestBOBBackendCircuitBreaker(t *testing.T) {
+	var healthy atomic.Bool
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`{"reply":"volví"}`))
+	}))
+	defer srv.Close()
+
+	b := testBOBBackend(srv.URL)
+	b.retries = 0
+	b.breaker = newCircuitBreaker(2, 100*time.Millisecond)
+	call := func() string {
+		return b.Call(context.Background(), "519", []string{"hola"}, nil, "", jlog{}).Text
+	}
+
+	// dos fallos seguidos abren el circuito
+	call()
+	call()
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("calls = %d, want 2", n)
+	}
+	// abierto: responde el fallback sin tocar el backend
+	if got := call(); got != bobFallbackError || calls.Load() != 2 {
+		t.Fatalf("open circuit: reply %q, calls %d", got, calls.Load())
+	}
+
+	// vencido el cooldown pasa una prueba; el backend ya se recuperó y el circuito cierra
+	time.Sleep(120 * time.Millisecond)
+	healthy.Store(true)
+	if got := call(); got != "volví" {
+		t.Fatalf("half-open probe reply = %q", got)
+	}
+	if got := call(); got != "volví" || calls.Load() != 4 {
+		t.Fatalf("closed circuit: reply %q, calls %d", got, calls.Load())
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps string // f=failure s=success a=allow(true) x=allow(false) w=esperar cooldown
+	}{
+		{"stays closed below threshold", "affa"},
+		{"opens at threshold", "fffx"},
+		{"success resets count", "ffsffa"},
+		{"single half-open probe", "fffxwax"},
+		{"failed probe reopens", "fffwafx"},
+		{"successful probe closes", "fffwasaa"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newCircuitBreaker(3, 30*time.Millisecond)
+			for i, s := range tt.steps {
+				switch s {
+				case 'f':
+					c.failure()
+				case 's':
+					c.success()
+				case 'w':
+					time.Sleep(40 * time.Millisecond)
+				case 'a', 'x':
+					if got := c.allow(); got != (s == 'a') {
+						t.Fatalf("step %d: allow() = %v", i, got)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestBOBBackendRequestID(t *testing.T) {
+	type seen struct{ header, body string }
+	got := make(chan seen, 4)
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			RequestID string `json:"requestId"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		got <- seen{r.Header.Get(requestIDHeader), payload.RequestID}
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable) // el reintento reusa el mismo ID
+			return
+		}
+		_, _ = w.Write([]byte(`{"reply":"hola"}`))
+	}))
+	defer srv.Close()
+
+	reply := testBOBBackend(srv.URL).Call(context.Background(), "51911111111", []string{"hola"}, nil, "", jlog{})
+	if reply.RequestID == "" || reply.Text != "hola" {
+		t.Fatalf("reply = %+v", reply)
+	}
+	for i := 0; i < 2; i++ {
+		s := <-got
+		if s.header != reply.RequestID || s.body != reply.RequestID {
+			t.Fatalf("attempt %d sent header %q body %q, want %q", i+1, s.header, s.body, reply.RequestID)
+		}
+	}
+
+	other := testBOBBackend(srv.URL).Call(context.Background(), "51911111111", []string{"otra"}, nil, "", jlog{})
+	<-got
+	if other.RequestID == reply.RequestID {
+		t.Fatal("request ID reused across calls")
+	}
+}
+
+func TestBOBBackendSendsTier(t *testing.T) {
+	got := make(chan map[string]any, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		got <- payload
+		_, _ = w.Write([]byte(`{"reply":"hola"}`))
+	}))
+	defer srv.Close()
+
+	b := testBOBBackend(srv.URL)
+	b.Call(context.Background(), "51911111111", []string{"hola"}, nil, "premium", jlog{})
+	if p := <-got; p["tier"] != "premium" {
+		t.Fatalf("tier = %v, want premium", p["tier"])
+	}
+	b.Call(context.Background(), "51911111111", []string{"hola"}, nil, "", jlog{})
+	if p := <-got; p["tier"] != nil {
+		t.Fatalf("tier sent without a profile tier: %v", p["tier"])
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRejectNonJSON(t *testing.T) {
+	tests := []struct {
+		name         string
+		contentType  string
+		allowMissing bool
+		wantRejected bool
+		wantReason   string
+	}{
+		{"json", "application/json", false, false, ""},
+		{"json utf-8", "application/json; charset=utf-8", false, false, ""},
+		{"json UTF-8", "application/json; charset=UTF-8", false, false, ""},
+		{"text/plain", "text/plain", false, true, "expected application/json, got text/plain"},
+		{"form", "application/x-www-form-urlencoded", false, true, "expected application/json"},
+		{"latin1 charset", "application/json; charset=latin1", false, true, "unsupported charset latin1"},
+		{"malformed", "application/json; charset", false, true, "bad content-type"},
+		{"missing in prod", "", false, true, "missing content-type"},
+		{"missing in dev", "", true, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/wh", strings.NewReader(`{"event_type":"message"}`))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			if got := rejectNonJSON(rec, req, tt.allowMissing); got != tt.wantRejected {
+				t.Fatalf("rejected = %v, want %v", got, tt.wantRejected)
+			}
+			if !tt.wantRejected {
+				if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+					t.Fatalf("accepted request wrote a response: %d %s", rec.Code, rec.Body.String())
+				}
+				return
+			}
+			if rec.Code != http.StatusUnsupportedMediaType || !strings.Contains(rec.Body.String(), tt.wantReason) {
+				t.Fatalf("response = %d %q, want 415 %q", rec.Code, rec.Body.String(), tt.wantReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestClaimCooldown(t *testing.T) {
+	base := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		cooldown time.Duration
+		last     time.Duration // hace cuánto fue el último envío (0 = nunca)
+		want     bool
+		wantWait time.Duration
+	}{
+		{"disabled", 0, time.Millisecond, true, 0},
+		{"never replied", 3 * time.Second, 0, true, 0},
+		{"within cooldown", 3 * time.Second, time.Second, false, 2 * time.Second},
+		{"cooldown elapsed", 3 * time.Second, 3 * time.Second, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := newTestRouter(t)
+			r.replyCooldown = tt.cooldown
+			if tt.last > 0 {
+				r.markReplied("c", base.Add(-tt.last))
+			}
+			got, wait := r.claimCooldown("c", base)
+			if got != tt.want || wait != tt.wantWait {
+				t.Fatalf("claimCooldown = %v, %v; want %v, %v", got, wait, tt.want, tt.wantWait)
+			}
+			// un turno reservado mueve el marcador: el siguiente cae en cooldown
+			if got && tt.cooldown > 0 {
+				if again, _ := r.claimCooldown("c", base); again {
+					t.Fatal("second claim in the same instant succeeded")
+				}
+			}
+		})
+	}
+}
+
+// Dos flushes dentro del cooldown: sale una sola respuesta al instante y los textos
+// del segundo se responden solos cuando vence, sin esperar un mensaje nuevo
+func TestFlushChatCooldownRearms(t *testing.T) {
+	const chat = "51911111111@s.whatsapp.net"
+	r, sent := newTestRouter(t)
+	srv, calls := bobRecorder(t, "ok")
+	r.bob = testBOBBackend(srv.URL)
+	r.replyDedup = 0
+	r.replyCooldown = 200 * time.Millisecond
+
+	r.OnMessage(context.Background(), inboundText(chat, "A", "hola"))
+	start := time.Now()
+	r.flushChat(chat, 1)
+	r.OnMessage(context.Background(), inboundText(chat, "B", "precio?"))
+	r.flushChat(chat, 1)
+
+	if got := <-calls; !slices.Equal(got, []string{"hola"}) {
+		t.Fatalf("first call = %q", got)
+	}
+	if got := sent.all(); len(got) != 1 {
+		t.Fatalf("sent within cooldown = %q, want 1 reply", got)
+	}
+
+	select {
+	case got := <-calls:
+		if !slices.Equal(got, []string{"precio?"}) {
+			t.Fatalf("rearmed call = %q", got)
+		}
+		if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+			t.Fatalf("rearmed flush ran after %v, inside the cooldown", elapsed)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("deferred texts never flushed after the cooldown")
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(sent.all()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := sent.all(); len(got) != 2 {
+		t.Fatalf("sent = %q, want 2 replies", got)
+	}
+}
+
+// Varios flushes postergados re-arman un solo flush que se lleva toda la cola; si
+// un lote nuevo se la lleva antes, el re-armado no responde de nuevo
+func TestFlushChatCooldownSingleRearm(t *testing.T) {
+	const chat = "51911111111@s.whatsapp.net"
+	r, sent := newTestRouter(t)
+	srv, calls := bobRecorder(t, "ok")
+	r.bob = testBOBBackend(srv.URL)
+	r.replyDedup = 0
+	r.replyCooldown = 150 * time.Millisecond
+
+	r.OnMessage(context.Background(), inboundText(chat, "A", "hola"))
+	r.flushChat(chat, 1)
+	<-calls
+	for i, text := range []string{"uno", "dos", "tres"} {
+		r.OnMessage(context.Background(), inboundText(chat, "B"+string(rune('0'+i)), text))
+		r.flushChat(chat, 1)
+	}
+
+	select {
+	case got := <-calls:
+		if !slices.Equal(got, []string{"uno", "dos", "tres"}) {
+			t.Fatalf("rearmed call = %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("deferred texts never flushed")
+	}
+	select {
+	case got := <-calls:
+		t.Fatalf("extra backend call %q", got)
+	case <-time.After(300 * time.Millisecond):
+	}
+	if got := sent.all(); len(got) != 2 {
+		t.Fatalf("sent = %q, want 2 replies", got)
+	}
+}
+
+// Un mensaje OUT (operador o eco) mueve el marcador: el flush siguiente se posterga
+func TestOutboundResetsCooldown(t *testing.T) {
+	const chat = "51911111111@s.whatsapp.net"
+	r, sent := newTestRouter(t)
+	srv, calls := bobRecorder(t, "ok")
+	r.bob = testBOBBackend(srv.URL)
+	r.replyCooldown = time.Hour
+
+	r.OnMessage(context.Background(), Envelope{EventType: "message", Direction: "out", ChatJID: chat, SenderJID: chat, MessageID: "O1", Text: "te escribe un asesor"})
+	r.OnMessage(context.Background(), inboundText(chat, "A", "hola"))
+	r.flushChat(chat, 1)
+
+	select {
+	case got := <-calls:
+		t.Fatalf("backend called within cooldown: %q", got)
+	default:
+	}
+	if got := sent.all(); len(got) != 0 {
+		t.Fatalf("sent = %q", got)
+	}
+	r.muLast.Lock()
+	pending := len(r.pendingByChat[chat])
+	r.muLast.Unlock()
+	if pending != 1 {
+		t.Fatalf("pending = %d, want the text kept for later", pending)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestIsFirstContact(t *testing.T) {
+	tests := []struct {
+		name    string
+		inbound bool
+		replies int
+		want    bool
+	}{
+		{"unknown chat", false, 0, true},
+		{"inbound only", true, 0, true},
+		{"bot already replied", true, 1, false},
+		{"outbound only", false, 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := newTestRouter(t)
+			const chat = "51999000111@s.whatsapp.net"
+			if tt.inbound {
+				r.touchProfileFromInbound(Envelope{ChatJID: chat, SenderJID: chat, Text: "hola"})
+			}
+			for i := 0; i < tt.replies; i++ {
+				r.incOutboundFor(chat)
+			}
+			if got := r.isFirstContact(chat); got != tt.want {
+				t.Fatalf("isFirstContact = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
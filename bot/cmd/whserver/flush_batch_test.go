@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+// bobRecorder backend BOB falso: guarda el "messages" de cada llamada
+func bobRecorder(t *testing.T, reply string) (*httptest.Server, chan []string) {
+	t.Helper()
+	calls := make(chan []string, 8)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []string `json:"messages"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		calls <- body.Messages
+		_ = json.NewEncoder(w).Encode(map[string]any{"reply": reply})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, calls
+}
+
+func inboundText(chat, id, text string) Envelope {
+	return Envelope{EventType: "message", Direction: "in", ChatJID: chat, SenderJID: chat, MessageID: id, Text: text}
+}
+
+func TestFlushChatSendsWholeBurst(t *testing.T) {
+	const chat = "51911111111@s.whatsapp.net"
+	tests := []struct {
+		name  string
+		texts []string
+	}{
+		{"single message", []string{"hola"}},
+		{"burst", []string{"hola", "vi la hilux", "¿sigue disponible?"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, sent := newTestRouter(t)
+			srv, calls := bobRecorder(t, "¡Sí, sigue!")
+			r.bob = testBOBBackend(srv.URL)
+			for i, text := range tt.texts {
+				r.OnMessage(context.Background(), inboundText(chat, "M"+string(rune('0'+i)), text))
+			}
+			r.flushChat(chat, len(tt.texts))
+
+			if got := <-calls; !slices.Equal(got, tt.texts) {
+				t.Fatalf("backend messages = %q, want %q", got, tt.texts)
+			}
+			if got := sent.all(); len(got) != 1 || got[0] != chat+"|¡Sí, sigue!" {
+				t.Fatalf("sent = %q", got)
+			}
+		})
+	}
+}
+
+// Un mensaje que llega durante la pre-pausa es del lote siguiente: no se suma a este
+// flush ni se pierde
+func TestFlushChatTakesBatchBeforePreReplyDelay(t *testing.T) {
+	const chat = "51911111111@s.whatsapp.net"
+	r, _ := newTestRouter(t)
+	srv, calls := bobRecorder(t, "ok")
+	r.bob = testBOBBackend(srv.URL)
+	r.preReplyDelay = 150 * time.Millisecond
+
+	r.OnMessage(context.Background(), inboundText(chat, "A", "hola"))
+	r.OnMessage(context.Background(), inboundText(chat, "B", "precio?"))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.flushChat(chat, 2)
+	}()
+	time.Sleep(50 * time.Millisecond) // dentro de la pre-pausa
+	r.OnMessage(context.Background(), inboundText(chat, "C", "¿y el año?"))
+	<-done
+
+	if got := <-calls; !slices.Equal(got, []string{"hola", "precio?"}) {
+		t.Fatalf("first flush messages = %q", got)
+	}
+	r.muLast.Lock()
+	pending := r.pendingByChat[chat]
+	r.muLast.Unlock()
+	if len(pending) != 1 || pending[0].Text != "¿y el año?" {
+		t.Fatalf("pending after flush = %+v, want only the late message", pending)
+	}
+
+	r.flushChat(chat, 1)
+	if got := <-calls; !slices.Equal(got, []string{"¿y el año?"}) {
+		t.Fatalf("second flush messages = %q", got)
+	}
+}
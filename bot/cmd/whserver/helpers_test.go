@@ -0,0 +1,36 @@
+package main
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/investigadorinexperto/bot/pkg/filters"
+)
+
+// sentLog registra lo que el router manda a sendFn
+type sentLog struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (s *sentLog) send(to, msg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.msgs = append(s.msgs, to+"|"+msg)
+	return nil
+}
+
+func (s *sentLog) all() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.msgs...)
+}
+
+// newTestRouter router sin esperas, con perfiles persistidos en un OUTBOX_BASE temporal
+func newTestRouter(t *testing.T) (*SimpleRouter, *sentLog) {
+	t.Helper()
+	t.Setenv("OUTBOX_BASE", t.TempDir())
+	sent := &sentLog{}
+	r := NewSimpleRouter(jlog{}, sent.send, nil, 0, 0, 0, 0, 0, 0, nil, nil, filters.Chain{})
+	return r, sent
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFlushChatStoresLeadInfo(t *testing.T) {
+	const chat = "51911111111@s.whatsapp.net"
+	tests := []struct {
+		name         string
+		responses    []map[string]any // una por flush, en orden
+		wantScore    int
+		wantCategory string
+		wantUpdated  bool
+	}{
+		{
+			name:         "score and category",
+			responses:    []map[string]any{{"reply": "hola", "leadScore": 72, "category": "caliente"}},
+			wantScore:    72,
+			wantCategory: "caliente",
+			wantUpdated:  true,
+		},
+		{
+			name:      "reply without lead info",
+			responses: []map[string]any{{"reply": "hola"}},
+		},
+		{
+			name: "later score without category keeps category",
+			responses: []map[string]any{
+				{"reply": "hola", "leadScore": 40, "category": "tibio"},
+				{"reply": "genial", "leadScore": 85},
+			},
+			wantScore:    85,
+			wantCategory: "tibio",
+			wantUpdated:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := newTestRouter(t)
+			next := make(chan map[string]any, len(tt.responses))
+			for _, resp := range tt.responses {
+				next <- resp
+			}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				_ = json.NewEncoder(w).Encode(<-next)
+			}))
+			defer srv.Close()
+			r.bob = testBOBBackend(srv.URL)
+
+			for i := range tt.responses {
+				r.OnMessage(context.Background(), inboundText(chat, "M"+string(rune('0'+i)), "mensaje"))
+				r.flushChat(chat, 1)
+			}
+
+			p, ok := r.lookupProfile(chat)
+			if !ok {
+				t.Fatal("profile not found")
+			}
+			if p.LeadScore != tt.wantScore || p.Category != tt.wantCategory || p.LeadUpdatedAt.IsZero() == tt.wantUpdated {
+				t.Fatalf("profile lead = %d %q (updated %v)", p.LeadScore, p.Category, p.LeadUpdatedAt)
+			}
+			// persistido: sobrevive a una lectura fresca del disco
+			disk, err := loadProfileFromDisk(chat)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if disk.LeadScore != tt.wantScore || disk.Category != tt.wantCategory {
+				t.Fatalf("disk lead = %d %q", disk.LeadScore, disk.Category)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestOnMessageStoresLocation(t *testing.T) {
+	r, _ := newTestRouter(t)
+
+	// envelope tal como lo emite el engine para un LocationMessage entrante
+	raw := `{"event_type":"message","direction":"in","chat_jid":"51999888777@s.whatsapp.net",
+		"sender_jid":"51999888777@s.whatsapp.net","message_id":"LOC1","at":"2026-01-02T15:04:05Z",
+		"location":{"type":"location","latitude":-12.046374,"longitude":-77.042793,
+		"name":"Plaza de Armas","address":"Jr. de la Unión, Lima","url":"https://maps.example/loc"}}`
+	var e Envelope
+	if err := json.Unmarshal([]byte(raw), &e); err != nil {
+		t.Fatal(err)
+	}
+	r.OnMessage(context.Background(), e)
+
+	p, ok := r.lookupProfile(e.ChatJID)
+	if !ok {
+		t.Fatal("profile not created")
+	}
+	if len(p.Media.In) != 1 {
+		t.Fatalf("media in = %d entries, want 1", len(p.Media.In))
+	}
+	got := p.Media.In[0]
+	if got.Type != "location" || got.Latitude != -12.046374 || got.Longitude != -77.042793 {
+		t.Errorf("entry = %+v", got)
+	}
+	if got.LocationName != "Plaza de Armas" || got.Address != "Jr. de la Unión, Lima" || got.URL != "https://maps.example/loc" {
+		t.Errorf("entry name/address/url = %q %q %q", got.LocationName, got.Address, got.URL)
+	}
+}
+
+func TestF64FromMap(t *testing.T) {
+	m := map[string]any{"f": 1.5, "i": 3, "s": " -2.25 ", "bad": "x"}
+	for key, want := range map[string]float64{"f": 1.5, "i": 3, "s": -2.25, "bad": 0, "missing": 0} {
+		if got := f64FromMap(m, key); got != want {
+			t.Errorf("f64FromMap(%q) = %v, want %v", key, got, want)
+		}
+	}
+	if got := f64FromMap(nil, "f"); got != 0 {
+		t.Errorf("f64FromMap(nil) = %v", got)
+	}
+}
@@ -3,31 +3,47 @@ package main
 
 import (
 	"bytes"
+	"container/list"
 	"context"
-	"crypto/hmac"
-	"crypto/sha256"
+	crand "crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"hash/fnv"
 	"io"
 	"log"
+	"maps"
 	"math/rand"
+	"mime"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
+	"unicode"
 
 	"github.com/joho/godotenv"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/investigadorinexperto/bot/internal/config"
 	"github.com/investigadorinexperto/bot/pkg/filters"
+	"github.com/investigadorinexperto/bot/pkg/metrics"
 	"github.com/investigadorinexperto/bot/pkg/pipeline"
 	"github.com/investigadorinexperto/bot/pkg/rules"
+	"github.com/investigadorinexperto/bot/pkg/tracing"
+	"github.com/investigadorinexperto/bot/pkg/typing"
+	"github.com/investigadorinexperto/bot/pkg/webhooksig"
 )
 
 //
@@ -48,9 +64,37 @@ type Envelope struct {
 	ReceiptType string           `json:"receipt_type"` // read|played|sender|""
 	Text        string           `json:"text"`
 	Media       map[string]any   `json:"media"`
-	Context     []map[string]any `json:"context"`
+	Location    map[string]any   `json:"location"` // location|live_location: latitude/longitude/name/address
+	Contacts    []map[string]any `json:"contacts"` // event_type=contact: display_name/vcard
+	Reaction    map[string]any   `json:"reaction"` // event_type=reaction: emoji/target_id/removed
+	Context     []map[string]any `json:"context"`  // hilo: se llena con el mensaje citado (role=quoted)
 	Extra       map[string]any   `json:"extra"`
 	At          string           `json:"at"`
+
+	// Respuesta citando un mensaje previo
+	QuotedMessageID string `json:"quoted_message_id"`
+	QuotedSender    string `json:"quoted_sender"`
+	QuotedText      string `json:"quoted_text"`
+
+	MentionedJIDs []string `json:"mentioned_jids"`
+}
+
+// withQuotedContext agrega el mensaje citado a Context (una sola vez)
+func (e *Envelope) withQuotedContext() {
+	if strings.TrimSpace(e.QuotedMessageID) == "" {
+		return
+	}
+	for _, c := range e.Context {
+		if strFromMap(c, "message_id") == e.QuotedMessageID {
+			return
+		}
+	}
+	e.Context = append(e.Context, map[string]any{
+		"role":       "quoted",
+		"message_id": e.QuotedMessageID,
+		"sender_jid": e.QuotedSender,
+		"text":       e.QuotedText,
+	})
 }
 
 // Entrada de media guardada en el perfil
@@ -71,6 +115,12 @@ type MediaEntry struct {
 	FileEncSHA256B64 string    `json:"file_enc_sha256_b64,omitempty"`
 	FileLength       uint64    `json:"file_length,omitempty"`
 	Seconds          uint32    `json:"seconds,omitempty"` // útil en audio/notas de voz
+
+	// Ubicación (type=location|live_location)
+	Latitude     float64 `json:"latitude,omitempty"`
+	Longitude    float64 `json:"longitude,omitempty"`
+	LocationName string  `json:"location_name,omitempty"`
+	Address      string  `json:"address,omitempty"`
 }
 
 type Profile struct {
@@ -85,6 +135,11 @@ type Profile struct {
 	LastChat  string    `json:"last_chat"`
 	LastText  string    `json:"last_text"`
 
+	// Calidad del lead según el backend BOB (última respuesta con score)
+	LeadScore     int       `json:"lead_score"`
+	Category      string    `json:"category,omitempty"`
+	LeadUpdatedAt time.Time `json:"lead_updated_at,omitempty"`
+
 	// Historial compacto de multimedia por dirección
 	Media struct {
 		In  []MediaEntry `json:"in"`
@@ -105,9 +160,28 @@ type Profile struct {
 		LastMsgID     string    `json:"last_msg_id"`
 		StreakDays    int       `json:"streak_days"`
 		StreakLastDay string    `json:"streak_last_day"`
+
+		// Señales de comportamiento para el scoring del backend
+		LastOutAt         time.Time `json:"last_out_at,omitempty"`
+		AwaitingReply     bool      `json:"awaiting_reply,omitempty"` // hubo OUT sin respuesta aún
+		AwaitingRead      bool      `json:"awaiting_read,omitempty"`  // hubo OUT sin receipt "read" aún
+		ReplyLatencySumMs int64     `json:"reply_latency_sum_ms"`
+		ReplyLatencyN     int       `json:"reply_latency_n"`
+		ReadLatencySumMs  int64     `json:"read_latency_sum_ms"`
+		ReadLatencyN      int       `json:"read_latency_n"`
 	} `json:"metrics"`
 }
 
+// clone copia profunda: una copia por valor seguiría compartiendo Tags y Media con el
+// perfil vivo. Llamar bajo muProf antes de serializar o devolver el perfil fuera del lock.
+func (p *Profile) clone() Profile {
+	cp := *p
+	cp.Tags = maps.Clone(p.Tags)
+	cp.Media.In = slices.Clone(p.Media.In)
+	cp.Media.Out = slices.Clone(p.Media.Out)
+	return cp
+}
+
 //
 // =======================
 // Logging helper
@@ -154,48 +228,77 @@ func previewText(s string, max int) string {
 	return string(r[:max]) + "…"
 }
 
+// checkSignature resuelve las cuatro combinaciones (requireSig, secreto):
+//   - secreto + requireSig   → verifica; mismatch rechaza
+//   - secreto sin requireSig → verifica; mismatch solo avisa (soft-fail)
+//   - sin secreto + requireSig → rechaza siempre (fail-closed; main ni siquiera arranca así)
+//   - sin secreto ni requireSig → modo dev (WH_ALLOW_NO_SECRET_DEV); avisa
 //
-// =======================
-/* Seguridad / firmas */
-// =======================
+// warn != "" indica algo que loguear aunque la request pase.
+func checkSignature(secret string, requireSig bool, body []byte, sigHeader string) (ok bool, warn string) {
+	switch {
+	case secret != "" && requireSig:
+		if !webhooksig.Verify(secret, body, sigHeader) {
+			return false, "signature_invalid"
+		}
+		return true, ""
+	case secret != "":
+		if !webhooksig.Verify(secret, body, sigHeader) {
+			return true, "signature_invalid_soft_fail"
+		}
+		return true, ""
+	case requireSig:
+		return false, "signature_required_but_no_secret"
+	default:
+		return true, "signature_not_required_dev_mode"
+	}
+}
 
-func verifySignature(secret string, body []byte, headerSig string) bool {
-	if secret == "" {
-		return false
+// checkNonce exige un nonce firmado junto al timestamp (si hay secreto) y que no se
+// haya visto dentro de la ventana de nonces.
+func checkNonce(nonces *deduper, secret string, h http.Header, body []byte) (ok bool, reason string) {
+	ts := h.Get(webhooksig.HeaderTimestamp)
+	nonce := strings.TrimSpace(h.Get(webhooksig.HeaderNonce))
+	if nonce == "" {
+		return false, "missing nonce"
 	}
-	headerSig = strings.TrimSpace(headerSig)
-	if !strings.HasPrefix(headerSig, "sha256=") {
-		return false
+	if secret != "" && !webhooksig.VerifyBound(secret, ts, nonce, body, h.Get(webhooksig.HeaderSignatureBound)) {
+		return false, "invalid bound signature"
+	}
+	if nonces.Seen(nonce) {
+		return false, "replayed nonce"
 	}
-	got := strings.TrimPrefix(headerSig, "sha256=")
-	mac := hmac.New(sha256.New, []byte(secret))
-	mac.Write(body)
-	expected := hex.EncodeToString(mac.Sum(nil))
-	return hmac.Equal([]byte(got), []byte(expected))
+	return true, ""
 }
 
-func verifyTimestamp(tsHeader string, skew time.Duration) error {
-	if tsHeader == "" {
-		return errors.New("missing timestamp")
+// rejectNonJSON responde 415 (y devuelve true) si el Content-Type no es JSON
+func rejectNonJSON(w http.ResponseWriter, r *http.Request, allowMissing bool) bool {
+	if ok, reason := checkJSONContentType(r.Header.Get("Content-Type"), allowMissing); !ok {
+		http.Error(w, "unsupported media type: "+reason, http.StatusUnsupportedMediaType)
+		return true
 	}
-	var ts time.Time
-	if n, err := strconv.ParseInt(tsHeader, 10, 64); err == nil {
-		ts = time.Unix(n, 0)
-	} else {
-		t, err2 := time.Parse(time.RFC3339, tsHeader)
-		if err2 != nil {
-			return errors.New("bad timestamp format")
+	return false
+}
+
+// checkJSONContentType acepta application/json con charset opcional (solo utf-8)
+func checkJSONContentType(ct string, allowMissing bool) (bool, string) {
+	if strings.TrimSpace(ct) == "" {
+		if allowMissing {
+			return true, ""
 		}
-		ts = t
+		return false, "missing content-type"
 	}
-	diff := time.Since(ts)
-	if diff < 0 {
-		diff = -diff
+	mt, params, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false, "bad content-type"
 	}
-	if diff > skew {
-		return errors.New("timestamp skew too large")
+	if mt != "application/json" {
+		return false, "expected application/json, got " + mt
 	}
-	return nil
+	if cs, ok := params["charset"]; ok && !strings.EqualFold(cs, "utf-8") {
+		return false, "unsupported charset " + cs
+	}
+	return true, ""
 }
 
 //
@@ -262,10 +365,15 @@ type SimpleRouter struct {
 	perCharMs        int
 	jitterMs         int
 	maxWait          time.Duration
+	minWait          time.Duration // piso: ni una respuesta de una palabra sale al instante
+	bubbleMax        int           // >0: largo (runas) a partir del cual se parte en burbujas
+	bubblePause      time.Duration // pausa entre burbujas, antes de volver a "escribir"
 	filterChain      filters.Chain
 	aggregator       *pipeline.Aggregator
 	muLast           sync.Mutex
 	lastByChat       map[string]rules.Envelope
+	pendingByChat    map[string][]rules.Envelope    // ráfaga del lote en curso (bajo muLast)
+	spansByChat      map[string][]trace.SpanContext // spans del webhook de cada mensaje del lote (bajo muLast)
 	lastActiveChat   string
 	muMap            sync.Mutex
 	lastChatBySender map[string]string
@@ -273,9 +381,39 @@ type SimpleRouter struct {
 	lastTypingAt   map[string]time.Time
 	typingDebounce time.Duration
 	muProf         sync.Mutex
-	profiles       map[string]*Profile // key: ChatJID (ver getOrCreateProfileByKey)
+	profiles       *profileLRU // key: ChatJID (ver getOrCreateProfileByKey); protegido por muProf
+	// Persistencia diferida: keys con cambios sin escribir (bajo muProf); flushEvery=0 → síncrono
+	dirty      map[string]struct{}
+	flushEvery time.Duration
+	flushStop  chan struct{}
+	flushDone  chan struct{}
+	// Zona para el día calendario de la racha (nil = UTC)
+	streakLoc *time.Location
+	// Espejo de Profile.Block para el filtro de la cadena (puede ser nil)
+	blockList *filters.BlockList
+	// Backend BOB (URL/timeout desde config)
+	bob *bobBackend
+	// Notas de voz e imágenes/PDF → texto (STT/OCR) antes de llamar al backend (nil = se ignoran)
+	media *mediaReader
+	// Anti doble envío: última respuesta por chat (hash del texto + cuándo)
+	muReply     sync.Mutex
+	lastReplies map[string]sentReply
+	replyDedup  time.Duration
+	// Anti bucle: último envío/OUT por chat; un flush dentro de replyCooldown se posterga
+	lastRepliedAt   map[string]time.Time
+	replyCooldown   time.Duration
+	cooldownFlushes map[string]*time.Timer // flush re-armado al vencer el cooldown (bajo muReply)
+}
+
+// sentReply: huella de la última respuesta enviada a un chat
+type sentReply struct {
+	hash uint64
+	at   time.Time
 }
 
+// Ventana en la que una respuesta idéntica al mismo chat se descarta
+const defaultReplyDedup = 5 * time.Second
+
 func NewSimpleRouter(
 	l jlog,
 	sendFn func(to, msg string) error,
@@ -303,28 +441,44 @@ func NewSimpleRouter(
 		jitterMs:         jitterMs,
 		maxWait:          maxWait,
 		lastByChat:       make(map[string]rules.Envelope),
+		pendingByChat:    make(map[string][]rules.Envelope),
+		spansByChat:      make(map[string][]trace.SpanContext),
 		lastChatBySender: make(map[string]string),
 		lastTypingAt:     make(map[string]time.Time),
 		typingDebounce:   700 * time.Millisecond,
-		profiles:         make(map[string]*Profile),
+		profiles:         newProfileLRU(defaultProfileCache),
+		dirty:            make(map[string]struct{}),
+		lastReplies:      make(map[string]sentReply),
+		replyDedup:       defaultReplyDedup,
+		lastRepliedAt:    make(map[string]time.Time),
+		cooldownFlushes:  make(map[string]*time.Timer),
 	}
 }
 
 func (r *SimpleRouter) OnMessage(ctx context.Context, e Envelope) {
 	// 1) Mensajes OUT: métricas + guardar media + salir
 	if strings.EqualFold(e.Direction, "out") {
+		metrics.Messages.WithLabelValues(metrics.ComponentWhserver, metrics.DirectionOut).Inc()
 		if strings.TrimSpace(e.ChatJID) != "" {
-			// guarda media OUT si viene (image/video/audio/document)
+			// guarda media OUT si viene (image/video/audio/document/location)
 			r.appendMedia(e.ChatJID, e, 200) // cap de historial por dirección
 			r.incOutboundFor(e.ChatJID)      // crea si no existe, incrementa MsgOut, toca LastMsgAt y persiste
+			r.markReplied(e.ChatJID, time.Now())
 		}
 		r.log.Info("filtered", "reason", "direction_out", "chat", e.ChatJID)
 		return
 	}
 
 	// 2) Mensajes IN: toca/crea perfil ANTES de filtros para conservar métricas y rutas
+	metrics.Messages.WithLabelValues(metrics.ComponentWhserver, metrics.DirectionIn).Inc()
 	r.touchProfileFromInbound(e)
 
+	// 2.0) Chat bloqueado: se registra la métrica pero no hay agregador ni backend
+	if r.isBlocked(e.ChatJID, time.Now()) {
+		r.log.Info("filtered", "reason", "chat_blocked", "chat", e.ChatJID, "from", e.SenderJID)
+		return
+	}
+
 	// 2.1) Capturar multimedia IN (si hay)
 	if strings.TrimSpace(e.ChatJID) != "" {
 		r.appendMedia(e.ChatJID, e, 200)
@@ -332,9 +486,12 @@ func (r *SimpleRouter) OnMessage(ctx context.Context, e Envelope) {
 
 	// 3) Filtros
 	view := filters.EnvView{
-		Direction: e.Direction,
-		SenderJID: e.SenderJID,
-		ChatJID:   e.ChatJID,
+		EventType:     e.EventType,
+		Direction:     e.Direction,
+		SenderJID:     e.SenderJID,
+		ChatJID:       e.ChatJID,
+		MentionedJIDs: e.MentionedJIDs,
+		QuotedSender:  e.QuotedSender,
 	}
 	if !r.filterChain.Pass(view) {
 		r.log.Info(
@@ -349,6 +506,9 @@ func (r *SimpleRouter) OnMessage(ctx context.Context, e Envelope) {
 
 	// 4) Agregador y últimos vistos
 	if r.aggregator != nil {
+		if r.isFirstContact(e.ChatJID) {
+			r.aggregator.MarkFirstContact(e.ChatJID)
+		}
 		r.aggregator.Add(e.ChatJID)
 	}
 	if strings.TrimSpace(e.SenderJID) != "" && strings.TrimSpace(e.ChatJID) != "" {
@@ -367,20 +527,37 @@ func (r *SimpleRouter) OnMessage(ctx context.Context, e Envelope) {
 	    return
 	}
 	// 6) Adaptar envelope para el engine de reglas
+	e.withQuotedContext()
 	env := rules.Envelope{
-		EventType: e.EventType,
-		ChatJID:   e.ChatJID,
-		SenderJID: e.SenderJID,
-		ChatName:  e.ChatName,
-		MessageID: e.MessageID,
-		Text:      e.Text,
-		At:        time.Now(),
+		EventType:  e.EventType,
+		ChatJID:    e.ChatJID,
+		SenderJID:  e.SenderJID,
+		ChatName:   e.ChatName,
+		MessageID:  e.MessageID,
+		Text:       e.Text,
+		QuotedText: e.QuotedText,
+		At:         time.Now(),
 	}
 	if t, err := time.Parse(time.RFC3339, strings.TrimSpace(e.At)); err == nil {
 		env.At = t
 	}
+	// nota de voz / imagen / documento: entra al lote y se lee (STT u OCR) al hacer flush
+	if r.media != nil {
+		switch {
+		case r.media.transcribeURL != "" && strings.TrimSpace(env.Text) == "" && isVoiceNote(e.Media):
+			env.Voice = e.Media
+		case r.media.extractURL != "" && isOCRMedia(e.Media):
+			env.Attachment = e.Media
+		}
+	}
 	r.muLast.Lock()
 	r.lastByChat[e.ChatJID] = env
+	if strings.TrimSpace(env.Text) != "" || env.Voice != nil || env.Attachment != nil {
+		r.pendingByChat[e.ChatJID] = keepLastN(append(r.pendingByChat[e.ChatJID], env), maxBatchTexts)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.spansByChat[e.ChatJID] = keepLastN(append(r.spansByChat[e.ChatJID], sc), maxBatchTexts)
+	}
 	r.muLast.Unlock()
 
 	// 7) Log
@@ -394,11 +571,15 @@ func (r *SimpleRouter) OnMessage(ctx context.Context, e Envelope) {
 }
 
 func (r *SimpleRouter) OnReceipt(ctx context.Context, e Envelope) {
-	view := filters.EnvView{Direction: e.Direction, SenderJID: e.SenderJID, ChatJID: e.ChatJID}
+	view := filters.EnvView{EventType: e.EventType, Direction: e.Direction, SenderJID: e.SenderJID, ChatJID: e.ChatJID}
 	if !r.filterChain.Pass(view) {
 		r.log.Info("filtered", "reason", "filter_chain_reject", "dir", e.Direction, "chat", e.ChatJID, "from", e.SenderJID)
 		return
 	}
+	// "read" del otro lado (los propios llegan como read-self)
+	if strings.TrimSpace(e.ReceiptType) == "read" && strings.TrimSpace(e.ChatJID) != "" {
+		r.markReadFor(e.ChatJID, time.Now())
+	}
 	if len(e.MessageIDs) > 0 {
 		r.log.Info("receipt", "chat", e.ChatJID, "count", len(e.MessageIDs), "type", strings.TrimSpace(e.ReceiptType))
 		return
@@ -453,6 +634,7 @@ func (r *SimpleRouter) OnAny(ctx context.Context, e Envelope) {
 
 	// 2) Resto de eventos → filtros normales y log informativo
 	view := filters.EnvView{
+		EventType: e.EventType,
 		Direction: e.Direction,
 		SenderJID: e.SenderJID,
 		ChatJID:   e.ChatJID,
@@ -461,6 +643,15 @@ func (r *SimpleRouter) OnAny(ctx context.Context, e Envelope) {
 		r.log.Info("filtered", "reason", "filter_chain_reject", "dir", e.Direction, "chat", e.ChatJID, "from", e.SenderJID)
 		return
 	}
+	if strings.EqualFold(strings.TrimSpace(e.EventType), "reaction") {
+		r.log.Info("reaction",
+			"chat", e.ChatJID,
+			"from", e.SenderJID,
+			"emoji", strFromMap(e.Reaction, "emoji"),
+			"target_id", strFromMap(e.Reaction, "target_id"),
+		)
+		return
+	}
 	r.log.Info("event_any",
 		"type", strings.TrimSpace(e.EventType),
 		"chat", e.ChatJID,
@@ -468,28 +659,292 @@ func (r *SimpleRouter) OnAny(ctx context.Context, e Envelope) {
 	)
 }
 
-func (r *SimpleRouter) replyWithTyping(chat, msg string) time.Duration {
-	if r.typingFn != nil {
-		_ = r.typingFn(chat, true, "text")
+// replyHash: huella del texto (sin espacios de borde) para comparar respuestas
+func replyHash(msg string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(strings.TrimSpace(msg)))
+	return h.Sum64()
+}
+
+// claimReply reserva el envío de msg a chat; false si el mismo texto salió
+// (o está saliendo) hace menos de replyDedup. Se reserva ANTES de la espera
+// de typing para que dos flushes concurrentes no envíen ambos.
+func (r *SimpleRouter) claimReply(chat, msg string, now time.Time) bool {
+	if r.replyDedup <= 0 {
+		return true
+	}
+	h := replyHash(msg)
+	r.muReply.Lock()
+	defer r.muReply.Unlock()
+	if last, ok := r.lastReplies[chat]; ok && last.hash == h && now.Sub(last.at) < r.replyDedup {
+		return false
+	}
+	r.lastReplies[chat] = sentReply{hash: h, at: now}
+	// limpieza perezosa para que el mapa no crezca sin límite
+	if len(r.lastReplies) > 1024 {
+		for k, v := range r.lastReplies {
+			if now.Sub(v.at) >= r.replyDedup {
+				delete(r.lastReplies, k)
+			}
+		}
+	}
+	return true
+}
+
+// claimCooldown reserva un turno de respuesta para chat. Si hubo un envío (o un
+// mensaje OUT) hace menos de replyCooldown devuelve false y cuánto falta para que
+// venza. Corta los ping-pong rápidos y los ecos re-inyectados antes de llamar al backend.
+func (r *SimpleRouter) claimCooldown(chat string, now time.Time) (bool, time.Duration) {
+	if r.replyCooldown <= 0 {
+		return true, 0
+	}
+	r.muReply.Lock()
+	defer r.muReply.Unlock()
+	if last, ok := r.lastRepliedAt[chat]; ok && now.Sub(last) < r.replyCooldown {
+		return false, r.replyCooldown - now.Sub(last)
+	}
+	r.markRepliedLocked(chat, now)
+	return true, 0
+}
+
+// rearmAfterCooldown agenda un flush de chat para cuando venza el cooldown (uno por
+// chat), así los textos devueltos a la cola no quedan esperando un mensaje nuevo.
+// Si para entonces otro flush ya se llevó la ráfaga, no hace nada.
+func (r *SimpleRouter) rearmAfterCooldown(chat string, wait time.Duration) {
+	r.muReply.Lock()
+	defer r.muReply.Unlock()
+	if _, ok := r.cooldownFlushes[chat]; ok {
+		return
+	}
+	r.cooldownFlushes[chat] = time.AfterFunc(wait, func() {
+		r.muReply.Lock()
+		delete(r.cooldownFlushes, chat)
+		r.muReply.Unlock()
+
+		r.muLast.Lock()
+		count := len(r.pendingByChat[chat])
+		r.muLast.Unlock()
+		if count == 0 {
+			return
+		}
+		r.log.Info("flush_rearmed_cooldown", "chat", chat, "count", count)
+		r.flushChat(chat, count)
+	})
+}
+
+// markReplied mueve el marcador de "última respuesta" (mensajes OUT, propios u
+// operador) para que el cooldown cuente desde ahí
+func (r *SimpleRouter) markReplied(chat string, now time.Time) {
+	if r.replyCooldown <= 0 || strings.TrimSpace(chat) == "" {
+		return
+	}
+	r.muReply.Lock()
+	defer r.muReply.Unlock()
+	r.markRepliedLocked(chat, now)
+}
+
+func (r *SimpleRouter) markRepliedLocked(chat string, now time.Time) {
+	r.lastRepliedAt[chat] = now
+	// limpieza perezosa, igual que lastReplies
+	if len(r.lastRepliedAt) > 1024 {
+		for k, at := range r.lastRepliedAt {
+			if now.Sub(at) >= r.replyCooldown {
+				delete(r.lastRepliedAt, k)
+			}
+		}
+	}
+}
+
+// typingWait: base + por carácter + jitter, con piso minWait y luego tope maxWait
+func (r *SimpleRouter) typingWait(msg string) time.Duration {
+	return typing.Timing{
+		Base:    r.baseWait,
+		PerChar: time.Duration(r.perCharMs) * time.Millisecond,
+		Jitter:  time.Duration(r.jitterMs) * time.Millisecond,
+		Min:     r.minWait,
+		Max:     r.maxWait,
+	}.Wait(msg)
+}
+
+// splitBubbles parte msg en burbujas de a lo más max runas, cortando en el
+// límite más "natural" que quepa: párrafo, luego oración/línea, luego palabra.
+// Nunca corta una palabra ni dentro de un bloque ``` (si no caben, salen solos
+// aunque excedan max). max<=0 → una sola burbuja.
+func splitBubbles(msg string, max int) []string {
+	msg = strings.TrimSpace(msg)
+	if max <= 0 || runeLen(msg) <= max {
+		return []string{msg}
+	}
+	var units []bubbleUnit
+	for _, blk := range splitCodeBlocks(msg) {
+		if blk.code {
+			units = append(units, bubbleUnit{text: blk.text, sep: "\n\n"})
+			continue
+		}
+		for _, para := range strings.Split(blk.text, "\n\n") {
+			para = strings.TrimSpace(para)
+			if para == "" {
+				continue
+			}
+			if runeLen(para) <= max {
+				units = append(units, bubbleUnit{text: para, sep: "\n\n"})
+				continue
+			}
+			for i, sent := range splitSentences(para) {
+				if i == 0 {
+					sent.sep = "\n\n"
+				}
+				if runeLen(sent.text) <= max {
+					units = append(units, sent)
+					continue
+				}
+				for j, w := range strings.Fields(sent.text) {
+					u := bubbleUnit{text: w, sep: " "}
+					if j == 0 {
+						u.sep = sent.sep
+					}
+					units = append(units, u)
+				}
+			}
+		}
+	}
+
+	// Empaque voraz: se unen unidades mientras quepan
+	var out []string
+	cur := ""
+	for _, u := range units {
+		if cur == "" {
+			cur = u.text
+			continue
+		}
+		if runeLen(cur)+runeLen(u.sep)+runeLen(u.text) <= max {
+			cur += u.sep + u.text
+			continue
+		}
+		out = append(out, cur)
+		cur = u.text
+	}
+	if cur != "" {
+		out = append(out, cur)
+	}
+	return out
+}
+
+// bubbleUnit: trozo indivisible y el separador que lo une al anterior
+type bubbleUnit struct {
+	text string
+	sep  string
+}
+
+type textBlock struct {
+	text string
+	code bool
+}
+
+// splitCodeBlocks separa prosa y bloques ``` (con sus cercas); un bloque sin
+// cerrar llega hasta el final.
+func splitCodeBlocks(msg string) []textBlock {
+	var out []textBlock
+	var buf []string
+	inCode := false
+	flush := func(code bool) {
+		if t := strings.Trim(strings.Join(buf, "\n"), "\n"); strings.TrimSpace(t) != "" {
+			out = append(out, textBlock{text: t, code: code})
+		}
+		buf = buf[:0]
+	}
+	for _, line := range strings.Split(msg, "\n") {
+		fence := strings.HasPrefix(strings.TrimSpace(line), "```")
+		switch {
+		case fence && !inCode:
+			flush(false)
+			buf = append(buf, line)
+			inCode = true
+		case fence && inCode:
+			buf = append(buf, line)
+			flush(true)
+			inCode = false
+		default:
+			buf = append(buf, line)
+		}
+	}
+	flush(inCode)
+	return out
+}
+
+// splitSentences corta un párrafo tras . ! ? … seguidos de espacio, y en cada
+// salto de línea (listas). El separador conserva el salto si lo había.
+func splitSentences(para string) []bubbleUnit {
+	var out []bubbleUnit
+	sep := ""
+	start := 0
+	rs := []rune(para)
+	for i := 0; i < len(rs); i++ {
+		end := -1
+		switch {
+		case rs[i] == '\n':
+			end = i
+		case strings.ContainsRune(".!?…", rs[i]) && i+1 < len(rs) && unicode.IsSpace(rs[i+1]):
+			end = i + 1
+		}
+		if end < 0 {
+			continue
+		}
+		if t := strings.TrimSpace(string(rs[start:end])); t != "" {
+			out = append(out, bubbleUnit{text: t, sep: sep})
+		}
+		// consumir el espacio que sigue; si incluye un salto, se conserva
+		j := end
+		nextSep := " "
+		for j < len(rs) && unicode.IsSpace(rs[j]) {
+			if rs[j] == '\n' {
+				nextSep = "\n"
+			}
+			j++
+		}
+		if len(out) > 0 {
+			sep = nextSep
+		}
+		start, i = j, j-1
 	}
-	perChar := time.Duration(r.perCharMs) * time.Millisecond
-	jitter := time.Duration(0)
-	if r.jitterMs > 0 {
-		jitter = time.Duration(rand.Intn(r.jitterMs)) * time.Millisecond
+	if t := strings.TrimSpace(string(rs[start:])); t != "" {
+		out = append(out, bubbleUnit{text: t, sep: sep})
 	}
-	wait := r.baseWait + time.Duration(len([]rune(msg)))*perChar + jitter
-	if wait > r.maxWait {
-		wait = r.maxWait
+	return out
+}
+
+func runeLen(s string) int { return len([]rune(s)) }
+
+// replyWithTyping simula "escribiendo" por cada burbuja y la envía; devuelve la espera total.
+func (r *SimpleRouter) replyWithTyping(ctx context.Context, chat, msg string) time.Duration {
+	_, span := tracing.Start(ctx, "reply.send", trace.WithAttributes(attribute.String("chat", chat)))
+	defer span.End()
+	if !r.claimReply(chat, msg, time.Now()) {
+		r.log.Info("reply_suppressed", "reason", "duplicate", "chat", chat)
+		return 0
 	}
-	time.Sleep(wait)
-	if r.sendFn != nil {
-		_ = r.sendFn(chat, msg)
+	var total time.Duration
+	for i, bubble := range splitBubbles(msg, r.bubbleMax) {
+		if i > 0 && r.bubblePause > 0 {
+			time.Sleep(r.bubblePause)
+			total += r.bubblePause
+		}
+		if r.typingFn != nil {
+			_ = r.typingFn(chat, true, "text")
+		}
+		wait := r.typingWait(bubble)
+		time.Sleep(wait)
+		total += wait
+		if r.sendFn != nil {
+			_ = r.sendFn(chat, bubble)
+		}
 	}
 	if r.typingFn != nil {
 		time.Sleep(r.typingPause)
 		_ = r.typingFn(chat, false, "text")
 	}
-	return wait
+	metrics.ReplyWait.Observe(total.Seconds())
+	return total
 }
 
 // Heurística amplia para detectar "usuario está escribiendo"
@@ -664,17 +1119,39 @@ func u32FromMap(m map[string]any, key string) uint32 {
 	return uint32(u64FromMap(m, key))
 }
 
+func f64FromMap(m map[string]any, key string) float64 {
+	if m == nil {
+		return 0
+	}
+	switch t := m[key].(type) {
+	case float64:
+		return t
+	case float32:
+		return float64(t)
+	case int:
+		return float64(t)
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(t), 64); err == nil {
+			return f
+		}
+	}
+	return 0
+}
+
 // Añade una entrada de media al perfil y persiste snapshot.
 // maxPerDir limita el largo de cada arreglo (In/Out) para no crecer infinito.
 func (r *SimpleRouter) appendMedia(chatKey string, e Envelope, maxPerDir int) {
 	if strings.TrimSpace(chatKey) == "" {
 		return
 	}
-	// sin media no hay nada que guardar
-	if e.Media == nil {
+	// sin media ni ubicación no hay nada que guardar
+	if e.Media == nil && e.Location == nil {
 		return
 	}
 	typ := strings.ToLower(strings.TrimSpace(strFromMap(e.Media, "type")))
+	if typ == "" {
+		typ = strings.ToLower(strings.TrimSpace(strFromMap(e.Location, "type")))
+	}
 	if typ == "" {
 		return
 	}
@@ -704,6 +1181,15 @@ func (r *SimpleRouter) appendMedia(chatKey string, e Envelope, maxPerDir int) {
 		FileLength:       u64FromMap(e.Media, "file_length"),
 		Seconds:          u32FromMap(e.Media, "seconds"),
 	}
+	if e.Location != nil {
+		entry.Latitude = f64FromMap(e.Location, "latitude")
+		entry.Longitude = f64FromMap(e.Location, "longitude")
+		entry.LocationName = strings.TrimSpace(strFromMap(e.Location, "name"))
+		entry.Address = strings.TrimSpace(strFromMap(e.Location, "address"))
+		if entry.URL == "" {
+			entry.URL = strings.TrimSpace(strFromMap(e.Location, "url"))
+		}
+	}
 
 	// si At viene en Envelope.At, úsalo
 	if t, err := time.Parse(time.RFC3339, strings.TrimSpace(e.At)); err == nil {
@@ -718,15 +1204,99 @@ func (r *SimpleRouter) appendMedia(chatKey string, e Envelope, maxPerDir int) {
 		p.Media.In = append(p.Media.In, entry)
 		p.Media.In = keepLastN(p.Media.In, maxPerDir)
 	}
-	// snapshot defensivo
-	cp := *p
 	r.muProf.Unlock()
 
-	persistProfileSnapshotByChat(&cp, chatKey)
+	r.markDirty(chatKey, p)
 }
 
 // ===== Gestión en memoria por KEY (ChatJID) =====
 
+const defaultProfileCache = 1000
+
+// profileLRU acota los perfiles en memoria; los expulsados siguen en disco
+// y getOrCreateProfileByKey los rehidrata. No es thread-safe: usar bajo muProf.
+type profileLRU struct {
+	cap int
+	ll  *list.List // frente = más reciente
+	idx map[string]*list.Element
+}
+
+type profileLRUEntry struct {
+	key string
+	p   *Profile
+}
+
+func newProfileLRU(capacity int) *profileLRU {
+	if capacity <= 0 {
+		capacity = defaultProfileCache
+	}
+	return &profileLRU{cap: capacity, ll: list.New(), idx: make(map[string]*list.Element)}
+}
+
+func (c *profileLRU) get(key string) (*Profile, bool) {
+	el, ok := c.idx[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*profileLRUEntry).p, true
+}
+
+// put inserta (o refresca) y devuelve los expulsados por capacidad
+func (c *profileLRU) put(key string, p *Profile) []profileLRUEntry {
+	if el, ok := c.idx[key]; ok {
+		el.Value.(*profileLRUEntry).p = p
+		c.ll.MoveToFront(el)
+		return nil
+	}
+	c.idx[key] = c.ll.PushFront(&profileLRUEntry{key: key, p: p})
+	var evicted []profileLRUEntry
+	for c.ll.Len() > c.cap {
+		el := c.ll.Back()
+		en := el.Value.(*profileLRUEntry)
+		c.ll.Remove(el)
+		delete(c.idx, en.key)
+		evicted = append(evicted, *en)
+	}
+	return evicted
+}
+
+func (c *profileLRU) len() int { return c.ll.Len() }
+
+// snapshot copia los perfiles en memoria (para serializar fuera del lock)
+func (c *profileLRU) snapshot() map[string]Profile {
+	out := make(map[string]Profile, c.ll.Len())
+	for k, el := range c.idx {
+		out[k] = el.Value.(*profileLRUEntry).p.clone()
+	}
+	return out
+}
+
+// cacheProfile inserta en el LRU; si otro goroutine ya cargó la key, gana el existente.
+// Los expulsados con cambios sin escribir se persisten después de soltar muProf.
+func (r *SimpleRouter) cacheProfile(key string, p *Profile) *Profile {
+	r.muProf.Lock()
+	if cur, ok := r.profiles.get(key); ok {
+		r.muProf.Unlock()
+		return cur
+	}
+	var pending []profileLRUEntry
+	for _, ev := range r.profiles.put(key, p) {
+		if _, ok := r.dirty[ev.key]; ok {
+			delete(r.dirty, ev.key)
+			cp := ev.p.clone()
+			pending = append(pending, profileLRUEntry{key: ev.key, p: &cp})
+		}
+		r.log.Info("profile_evicted", "chat", ev.key, "cached", r.profiles.len())
+	}
+	r.muProf.Unlock()
+
+	for _, ev := range pending {
+		persistProfileSnapshotByChat(ev.p, ev.key)
+	}
+	return p
+}
+
 // Getter que usa ChatJID (o key) como índice de r.profiles
 func (r *SimpleRouter) getOrCreateProfileByKey(key string) *Profile {
 	key = strings.TrimSpace(key)
@@ -734,17 +1304,14 @@ func (r *SimpleRouter) getOrCreateProfileByKey(key string) *Profile {
 		return nil
 	}
 	r.muProf.Lock()
-	if p, ok := r.profiles[key]; ok {
+	if p, ok := r.profiles.get(key); ok {
 		r.muProf.Unlock()
 		return p
 	}
 	// Intentar rehidratar desde disco (fuera de lock para evitar bloquear I/O largo)
 	r.muProf.Unlock()
 	if pDisk, err := loadProfileFromDisk(key); err == nil && pDisk != nil {
-		r.muProf.Lock()
-		r.profiles[key] = pDisk
-		r.muProf.Unlock()
-		return pDisk
+		return r.cacheProfile(key, pDisk)
 	}
 	// No había en disco -> crear nuevo
 	now := time.Now()
@@ -756,127 +1323,1047 @@ func (r *SimpleRouter) getOrCreateProfileByKey(key string) *Profile {
 		FirstSeen: now,
 		LastConn:  now,
 	}
-	r.muProf.Lock()
-	r.profiles[key] = p
-	r.muProf.Unlock()
-	return p
+	return r.cacheProfile(key, p)
 }
 
-func (r *SimpleRouter) touchProfileFromInbound(e Envelope) {
-	// Clave principal: ChatJID (para 1:1 y grupos)
-	key := strings.TrimSpace(e.ChatJID)
-	if key == "" {
-		// Fallback extremo a sender si no viene chat
-		key = strings.TrimSpace(e.SenderJID)
+const streakDayLayout = "2006-01-02"
+
+// nextStreak cuenta días calendario consecutivos en loc (nil = UTC).
+// La resta se hace entre fechas a medianoche UTC, así un cambio de horario (23h/25h) no rompe la cuenta.
+// Mismo día → sin cambios; día siguiente → +1; hueco o sin historial → 1;
+// día anterior (reloj/TZ movidos hacia atrás) → sin cambios.
+func nextStreak(days int, lastDay string, now time.Time, loc *time.Location) (int, string) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	y, m, d := now.In(loc).Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	todayStr := today.Format(streakDayLayout)
+
+	last, err := time.Parse(streakDayLayout, lastDay)
+	if err != nil || days <= 0 {
+		return 1, todayStr
+	}
+	switch diff := int(today.Sub(last).Hours() / 24); {
+	case diff == 0:
+		return days, lastDay
+	case diff == 1:
+		return days + 1, todayStr
+	case diff < 0:
+		return days, lastDay
+	default:
+		return 1, todayStr
 	}
-	p := r.getOrCreateProfileByKey(key)
+}
+
+// ===== Bloqueos (Profile.Block) =====
+
+// BlockRequest: Permanent, o Until (RFC3339) / Duration ("2h") para un bloqueo temporal
+type BlockRequest struct {
+	Spam      bool   `json:"spam"`
+	Malicious bool   `json:"malicious"`
+	Permanent bool   `json:"permanent"`
+	Until     string `json:"until,omitempty"`
+	Duration  string `json:"duration,omitempty"`
+}
+
+// blockedAt: permanente, o con Until aún en el futuro (Spam/Malicious son solo el motivo)
+func blockedAt(p *Profile, now time.Time) bool {
 	if p == nil {
-		return
+		return false
 	}
+	return p.Block.Permanent || now.Before(p.Block.Until)
+}
 
-	now := time.Now()
+func (r *SimpleRouter) isBlocked(chat string, now time.Time) bool {
+	key := strings.TrimSpace(chat)
+	if key == "" {
+		return false
+	}
+	p := r.getOrCreateProfileByKey(key)
 	r.muProf.Lock()
+	defer r.muProf.Unlock()
+	return blockedAt(p, now)
+}
 
-	p.LastConn = now
-	p.LastChat = e.ChatJID
-	p.LastText = e.Text
-	p.Metrics.MsgIn++
-	p.Metrics.LastMsgAt = now
-	p.Metrics.LastMsgID = e.MessageID
-
-	day := now.Format("2006-01-02")
-	if p.Metrics.StreakLastDay != day {
-		if p.Metrics.StreakLastDay == now.Add(-24*time.Hour).Format("2006-01-02") {
-			p.Metrics.StreakDays++
-		} else {
-			p.Metrics.StreakDays = 1
+// setBlock aplica (o con req=nil, levanta) el bloqueo y persiste de inmediato
+func (r *SimpleRouter) setBlock(chat string, req *BlockRequest, now time.Time) (Profile, error) {
+	key := strings.TrimSpace(chat)
+	if key == "" {
+		return Profile{}, errors.New("chat required")
+	}
+	var until time.Time
+	if req != nil && !req.Permanent {
+		switch {
+		case strings.TrimSpace(req.Until) != "":
+			t, err := time.Parse(time.RFC3339, strings.TrimSpace(req.Until))
+			if err != nil {
+				return Profile{}, errors.New("bad until (RFC3339)")
+			}
+			until = t
+		case strings.TrimSpace(req.Duration) != "":
+			d, err := time.ParseDuration(strings.TrimSpace(req.Duration))
+			if err != nil || d <= 0 {
+				return Profile{}, errors.New("bad duration")
+			}
+			until = now.Add(d)
+		default:
+			return Profile{}, errors.New("permanent, until or duration required")
+		}
+		if !until.After(now) {
+			return Profile{}, errors.New("until must be in the future")
 		}
-		p.Metrics.StreakLastDay = day
 	}
 
-	// rutas NDJSON
-	if strings.TrimSpace(e.ChatJID) != "" && !strings.HasSuffix(e.ChatJID, "@g.us") {
-		p.Tags["out.contacts_ndjson"] = ndjsonContactPath(e.ChatJID)
-	}
-	if strings.Contains(e.ChatJID, "@g.us") {
-		p.Tags["out.group."+e.ChatJID] = ndjsonGroupPath(e.ChatJID)
+	p := r.getOrCreateProfileByKey(key)
+	r.muProf.Lock()
+	if req == nil {
+		p.Block.Spam, p.Block.Malicious, p.Block.Permanent, p.Block.Until = false, false, false, time.Time{}
+	} else {
+		p.Block.Spam, p.Block.Malicious, p.Block.Permanent, p.Block.Until = req.Spam, req.Malicious, req.Permanent, until
 	}
-
-	// Copia para persist fuera del lock
-	cp := *p
+	cp := p.clone()
 	r.muProf.Unlock()
 
-	// Persistir snapshot por ChatJID
+	// el bloqueo no espera al flusher: debe sobrevivir a un reinicio inmediato
 	persistProfileSnapshotByChat(&cp, key)
+	r.mirrorBlock(key, &cp, now)
+	return cp, nil
 }
 
-func (r *SimpleRouter) incOutboundFor(chatKey string) {
-	// chatKey es ChatJID (1:1 o grupo)
-	if chatKey == "" {
+func (r *SimpleRouter) mirrorBlock(key string, p *Profile, now time.Time) {
+	if r.blockList == nil {
 		return
 	}
-	p := r.getOrCreateProfileByKey(chatKey)
+	switch {
+	case p.Block.Permanent:
+		r.blockList.Block(key, time.Time{})
+	case now.Before(p.Block.Until):
+		r.blockList.Block(key, p.Block.Until)
+	default:
+		r.blockList.Unblock(key)
+	}
+}
+
+// syncBlockListFromDisk carga en el filtro los bloqueos vigentes de los perfiles persistidos
+func (r *SimpleRouter) syncBlockListFromDisk() {
+	if r.blockList == nil {
+		return
+	}
+	files, _ := filepath.Glob(filepath.Join(profilesBase(), "*.json"))
 	now := time.Now()
-	r.muProf.Lock()
-	p.Metrics.MsgOut++
-	p.Metrics.LastMsgAt = now
-	// Copia para persist fuera del lock
-	cp := *p
-	r.muProf.Unlock()
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		var p Profile
+		if json.Unmarshal(b, &p) != nil || strings.TrimSpace(p.SenderJID) == "" {
+			continue
+		}
+		if blockedAt(&p, now) {
+			r.mirrorBlock(p.SenderJID, &p, now)
+		}
+	}
+}
 
-	// Persistir snapshot por ChatJID
-	persistProfileSnapshotByChat(&cp, chatKey)
+// requireAdminToken protege endpoints admin con Bearer; sin token configurado quedan deshabilitados
+func requireAdminToken(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if token == "" {
+			http.Error(w, "admin endpoints disabled (WH_SERVER_ADMIN_TOKEN)", http.StatusForbidden)
+			return
+		}
+		got := strings.TrimSpace(strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer "))
+		if got == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, req)
+	}
 }
 
-//
-// =======================
+// ===== Consulta de perfiles (/profiles) =====
+
+type ProfileSummary struct {
+	ChatJID    string    `json:"chat_jid"`
+	Name       string    `json:"name,omitempty"`
+	LastText   string    `json:"last_text"`
+	MsgIn      int       `json:"msg_in"`
+	MsgOut     int       `json:"msg_out"`
+	StreakDays int       `json:"streak_days"`
+	LastMsgAt  time.Time `json:"last_msg_at"`
+	LeadScore  int       `json:"lead_score"`
+	Category   string    `json:"category,omitempty"`
+}
+
+// profilesHandler GET /profiles?chat=<jid> → perfil completo | /profiles?limit=&offset= → resúmenes paginados
+func (r *SimpleRouter) profilesHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := req.URL.Query()
+	w.Header().Set("Content-Type", "application/json")
+	if chat := strings.TrimSpace(q.Get("chat")); chat != "" {
+		p, ok := r.lookupProfile(chat)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]any{"error": "profile not found", "chat": chat})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(p)
+		return
+	}
+	limit, offset := 50, 0
+	if v, err := strconv.Atoi(q.Get("limit")); err == nil && v > 0 {
+		limit = min(v, 500)
+	}
+	if v, err := strconv.Atoi(q.Get("offset")); err == nil && v > 0 {
+		offset = v
+	}
+	all := r.profileSummaries()
+	page := []ProfileSummary{}
+	if offset < len(all) {
+		page = all[offset:min(offset+limit, len(all))]
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"total":  len(all),
+		"limit":  limit,
+		"offset": offset,
+		"items":  page,
+	})
+}
+
+func summaryOf(p *Profile) ProfileSummary {
+	return ProfileSummary{
+		ChatJID:    p.SenderJID,
+		Name:       p.Name,
+		LastText:   p.LastText,
+		MsgIn:      p.Metrics.MsgIn,
+		MsgOut:     p.Metrics.MsgOut,
+		StreakDays: p.Metrics.StreakDays,
+		LastMsgAt:  p.Metrics.LastMsgAt,
+		LeadScore:  p.LeadScore,
+		Category:   p.Category,
+	}
+}
+
+// lookupProfile devuelve una copia (memoria o disco) sin meterla al LRU
+func (r *SimpleRouter) lookupProfile(key string) (Profile, bool) {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return Profile{}, false
+	}
+	r.muProf.Lock()
+	if p, ok := r.profiles.get(key); ok {
+		cp := p.clone()
+		r.muProf.Unlock()
+		return cp, true
+	}
+	r.muProf.Unlock()
+	p, err := loadProfileFromDisk(key)
+	if err != nil || p == nil {
+		return Profile{}, false
+	}
+	return *p, true
+}
+
+// profileSummaries junta disco + memoria (memoria gana: puede ir por delante del disco),
+// ordenado por último mensaje (desc) y luego JID para paginar estable.
+func (r *SimpleRouter) profileSummaries() []ProfileSummary {
+	byKey := map[string]ProfileSummary{}
+	files, _ := filepath.Glob(filepath.Join(profilesBase(), "*.json"))
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		var p Profile
+		if json.Unmarshal(b, &p) != nil || strings.TrimSpace(p.SenderJID) == "" {
+			continue
+		}
+		byKey[p.SenderJID] = summaryOf(&p)
+	}
+	r.muProf.Lock()
+	snap := r.profiles.snapshot()
+	r.muProf.Unlock()
+	for k, p := range snap {
+		s := summaryOf(&p)
+		s.ChatJID = k
+		byKey[k] = s
+	}
+
+	out := make([]ProfileSummary, 0, len(byKey))
+	for _, s := range byKey {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].LastMsgAt.Equal(out[j].LastMsgAt) {
+			return out[i].LastMsgAt.After(out[j].LastMsgAt)
+		}
+		return out[i].ChatJID < out[j].ChatJID
+	})
+	return out
+}
+
+func (r *SimpleRouter) touchProfileFromInbound(e Envelope) {
+	// Clave principal: ChatJID (para 1:1 y grupos)
+	key := strings.TrimSpace(e.ChatJID)
+	if key == "" {
+		// Fallback extremo a sender si no viene chat
+		key = strings.TrimSpace(e.SenderJID)
+	}
+	p := r.getOrCreateProfileByKey(key)
+	if p == nil {
+		return
+	}
+
+	now := time.Now()
+	r.muProf.Lock()
+
+	p.LastConn = now
+	p.LastChat = e.ChatJID
+	p.LastText = e.Text
+	p.Metrics.MsgIn++
+	p.Metrics.LastMsgAt = now
+	p.Metrics.LastMsgID = e.MessageID
+
+	p.Metrics.StreakDays, p.Metrics.StreakLastDay = nextStreak(p.Metrics.StreakDays, p.Metrics.StreakLastDay, now, r.streakLoc)
+
+	// primera respuesta tras un OUT nuestro: latencia de respuesta
+	if p.Metrics.AwaitingReply {
+		addLatency(&p.Metrics.ReplyLatencySumMs, &p.Metrics.ReplyLatencyN, p.Metrics.LastOutAt, now)
+		p.Metrics.AwaitingReply = false
+	}
+
+	// rutas NDJSON
+	if strings.TrimSpace(e.ChatJID) != "" && !strings.HasSuffix(e.ChatJID, "@g.us") {
+		p.Tags["out.contacts_ndjson"] = ndjsonContactPath(e.ChatJID)
+	}
+	if strings.Contains(e.ChatJID, "@g.us") {
+		p.Tags["out.group."+e.ChatJID] = ndjsonGroupPath(e.ChatJID)
+	}
+
+	r.muProf.Unlock()
+
+	// Persistir snapshot por ChatJID (diferido si hay flusher)
+	r.markDirty(key, p)
+}
+
+// isFirstContact: el bot todavía no le respondió nunca a este chat
+func (r *SimpleRouter) isFirstContact(chat string) bool {
+	p, ok := r.lookupProfile(chat)
+	return !ok || p.Metrics.MsgOut == 0
+}
+
+func (r *SimpleRouter) incOutboundFor(chatKey string) {
+	// chatKey es ChatJID (1:1 o grupo)
+	if chatKey == "" {
+		return
+	}
+	p := r.getOrCreateProfileByKey(chatKey)
+	now := time.Now()
+	r.muProf.Lock()
+	p.Metrics.MsgOut++
+	p.Metrics.LastMsgAt = now
+	p.Metrics.LastOutAt = now
+	p.Metrics.AwaitingReply = true
+	p.Metrics.AwaitingRead = true
+	r.muProf.Unlock()
+
+	r.markDirty(chatKey, p)
+}
+
+// addLatency suma now-since (ms) a un promedio acumulado; ignora relojes raros.
+func addLatency(sumMs *int64, n *int, since, now time.Time) {
+	if since.IsZero() || now.Before(since) {
+		return
+	}
+	*sumMs += now.Sub(since).Milliseconds()
+	*n++
+}
+
+// avgSeconds: promedio en segundos de un acumulado (0 sin muestras)
+func avgSeconds(sumMs int64, n int) float64 {
+	if n <= 0 {
+		return 0
+	}
+	return float64(sumMs) / float64(n) / 1000
+}
+
+// markReadFor registra la latencia de lectura del último OUT (receipt "read" del otro lado);
+// el perfil se rehidrata si fue expulsado del LRU
+func (r *SimpleRouter) markReadFor(chatKey string, now time.Time) {
+	p := r.getOrCreateProfileByKey(chatKey)
+	if p == nil {
+		return
+	}
+	r.muProf.Lock()
+	if !p.Metrics.AwaitingRead {
+		r.muProf.Unlock()
+		return
+	}
+	addLatency(&p.Metrics.ReadLatencySumMs, &p.Metrics.ReadLatencyN, p.Metrics.LastOutAt, now)
+	p.Metrics.AwaitingRead = false
+	r.muProf.Unlock()
+	r.markDirty(chatKey, p)
+}
+
+// behaviorFor arma el objeto "behavior" que va al backend (nil si el chat no tiene mensajes);
+// el perfil se rehidrata si fue expulsado del LRU
+func (r *SimpleRouter) behaviorFor(chatKey string) map[string]any {
+	p := r.getOrCreateProfileByKey(chatKey)
+	if p == nil {
+		return nil
+	}
+	r.muProf.Lock()
+	defer r.muProf.Unlock()
+	m := p.Metrics
+	if m.MsgIn == 0 && m.MsgOut == 0 {
+		return nil
+	}
+	return map[string]any{
+		"avgResponseLatencySec": avgSeconds(m.ReplyLatencySumMs, m.ReplyLatencyN),
+		"responseSamples":       m.ReplyLatencyN,
+		"avgReadLatencySec":     avgSeconds(m.ReadLatencySumMs, m.ReadLatencyN),
+		"readSamples":           m.ReadLatencyN,
+		"msgIn":                 m.MsgIn,
+		"msgOut":                m.MsgOut,
+		"streakDays":            m.StreakDays,
+	}
+}
+
+// tierFor Profile.Tier del chat ("" si no hay perfil)
+func (r *SimpleRouter) tierFor(chatKey string) string {
+	p, ok := r.lookupProfile(chatKey)
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(p.Tier)
+}
+
+// ===== Persistencia diferida de perfiles =====
+
+// markDirty agenda el snapshot de key; sin flusher escribe en el acto (comportamiento previo).
+// Si p ya no es el perfil cacheado (expulsado entre el get y la mutación) se escribe directo.
+func (r *SimpleRouter) markDirty(key string, p *Profile) {
+	r.muProf.Lock()
+	if cur, ok := r.profiles.get(key); r.flushEvery > 0 && ok && cur == p {
+		r.dirty[key] = struct{}{}
+		r.muProf.Unlock()
+		return
+	}
+	cp := p.clone()
+	r.muProf.Unlock()
+	persistProfileSnapshotByChat(&cp, key)
+}
+
+// flushProfiles escribe (tmp+rename) una sola vez cada perfil sucio; devuelve cuántos escribió
+func (r *SimpleRouter) flushProfiles() int {
+	r.muProf.Lock()
+	if len(r.dirty) == 0 {
+		r.muProf.Unlock()
+		return 0
+	}
+	snaps := make(map[string]Profile, len(r.dirty))
+	for k := range r.dirty {
+		if p, ok := r.profiles.get(k); ok {
+			snaps[k] = p.clone()
+		}
+		delete(r.dirty, k)
+	}
+	r.muProf.Unlock()
+
+	for k, cp := range snaps {
+		persistProfileSnapshotByChat(&cp, k)
+	}
+	return len(snaps)
+}
+
+// StartProfileFlusher arranca el flusher periódico; StopProfileFlusher hace el flush final
+func (r *SimpleRouter) StartProfileFlusher(every time.Duration) {
+	if every <= 0 {
+		return
+	}
+	r.muProf.Lock()
+	r.flushEvery = every
+	r.muProf.Unlock()
+	r.flushStop = make(chan struct{})
+	r.flushDone = make(chan struct{})
+	go func() {
+		defer close(r.flushDone)
+		t := time.NewTicker(every)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				r.flushProfiles()
+			case <-r.flushStop:
+				r.flushProfiles()
+				return
+			}
+		}
+	}()
+}
+
+func (r *SimpleRouter) StopProfileFlusher() {
+	if r.flushStop == nil {
+		return
+	}
+	close(r.flushStop)
+	<-r.flushDone
+	r.flushStop = nil
+}
+
+//
+// =======================
 // Integración con Backend BOB (Kevin)
 // =======================
 //
 
-func callBOBBackend(fromPhone string, message string, logger jlog) string {
+const (
+	bobFallbackError  = "Lo siento, hubo un error procesando tu mensaje."
+	bobFallbackDecode = "Error procesando la respuesta."
+	bobFallbackEmpty  = "No se pudo obtener respuesta del sistema."
+)
+
+// circuitBreaker abre tras `threshold` fallos seguidos y deja pasar una sola
+// prueba (half-open) cuando vence el cooldown.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	fails     int
+	openUntil time.Time
+	probing   bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow indica si se puede llamar ahora
+func (c *circuitBreaker) allow() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fails < c.threshold {
+		return true
+	}
+	if time.Now().Before(c.openUntil) || c.probing {
+		return false
+	}
+	c.probing = true
+	return true
+}
+
+func (c *circuitBreaker) success() {
+	c.mu.Lock()
+	c.fails, c.probing = 0, false
+	c.mu.Unlock()
+}
+
+// failure devuelve true si este fallo abre (o reabre) el circuito
+func (c *circuitBreaker) failure() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fails++
+	c.probing = false
+	if c.fails >= c.threshold {
+		c.openUntil = time.Now().Add(c.cooldown)
+		return true
+	}
+	return false
+}
+
+// bobBackend: cliente con timeout, reintentos con backoff y circuit breaker
+type bobBackend struct {
+	url     string
+	client  *http.Client
+	retries int           // intentos extra ante fallos transitorios (red, 5xx, 429)
+	backoff time.Duration // base exponencial entre intentos
+	breaker *circuitBreaker
+}
+
+func newBOBBackend(url string, timeout time.Duration) *bobBackend {
+	return &bobBackend{
+		url:     url,
+		client:  &http.Client{Timeout: timeout},
+		retries: 2,
+		backoff: 300 * time.Millisecond,
+		breaker: newCircuitBreaker(5, 30*time.Second),
+	}
+}
+
+// validateBackendURL exige http/https con host (se valida al arrancar, no en cada mensaje)
+func validateBackendURL(raw string) error {
+	u, err := neturl.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https, got %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return errors.New("missing host")
+	}
+	return nil
+}
+
+// isVoiceNote media de un audio (nota de voz o archivo de audio)
+func isVoiceNote(media map[string]any) bool {
+	t, _ := media["type"].(string)
+	return t == "audio"
+}
+
+// isOCRMedia imagen, o documento PDF/imagen, del que vale la pena leer el texto
+func isOCRMedia(media map[string]any) bool {
+	t, _ := media["type"].(string)
+	mimeType, _ := media["mimetype"].(string)
+	switch t {
+	case "image":
+		return true
+	case "document":
+		return mimeType == "application/pdf" || strings.HasPrefix(mimeType, "image/")
+	}
+	return false
+}
+
+// mediaReader baja la media del engine (/api/media/download) y la convierte en texto en el
+// backend BOB: notas de voz vía /api/chat/transcribe, imágenes y PDFs vía /api/chat/extract (OCR).
+// El backend decide el proveedor de STT/OCR.
+type mediaReader struct {
+	mediaURL      string
+	transcribeURL string // vacío = notas de voz sin transcribir
+	extractURL    string // vacío = sin OCR
+	maxSeconds    int    // notas más largas no se transcriben (0 = sin tope)
+	maxBytes      int64  // imágenes/documentos más pesados no pasan por OCR (0 = sin tope)
+	client        *http.Client
+}
+
+func newMediaReader(mediaURL, transcribeURL, extractURL string, maxSeconds int, maxBytes int64, timeout time.Duration) *mediaReader {
+	return &mediaReader{
+		mediaURL:      mediaURL,
+		transcribeURL: transcribeURL,
+		extractURL:    extractURL,
+		maxSeconds:    maxSeconds,
+		maxBytes:      maxBytes,
+		client:        &http.Client{Timeout: timeout},
+	}
+}
+
+// Transcribe devuelve el texto de la nota de voz; "" si no se entendió nada
+func (m *mediaReader) Transcribe(ctx context.Context, media map[string]any) (string, error) {
+	if secs, _ := media["seconds"].(float64); m.maxSeconds > 0 && int(secs) > m.maxSeconds {
+		return "", fmt.Errorf("voice note too long (%ds > %ds)", int(secs), m.maxSeconds)
+	}
+	audio, mimeType, err := m.download(ctx, media, maxBackendMediaBytes)
+	if err != nil {
+		return "", err
+	}
+	return m.backendText(ctx, m.transcribeURL, audio, mimeType)
+}
+
+// ExtractText devuelve el texto legible de la imagen o documento; "" si no tiene
+func (m *mediaReader) ExtractText(ctx context.Context, media map[string]any) (string, error) {
+	if size, _ := media["file_length"].(float64); m.maxBytes > 0 && int64(size) > m.maxBytes {
+		return "", fmt.Errorf("attachment too large (%d > %d bytes)", int64(size), m.maxBytes)
+	}
+	limit := m.maxBytes
+	if limit <= 0 || limit > maxBackendMediaBytes {
+		limit = maxBackendMediaBytes
+	}
+	data, mimeType, err := m.download(ctx, media, limit)
+	if err != nil {
+		return "", err
+	}
+	return m.backendText(ctx, m.extractURL, data, mimeType)
+}
+
+// backendText POST {"media":{data,mimeType}} al endpoint del backend y devuelve su "text"
+func (m *mediaReader) backendText(ctx context.Context, url string, data []byte, mimeType string) (string, error) {
+	body, _ := json.Marshal(map[string]any{
+		"media": map[string]string{
+			"data":     base64.StdEncoding.EncodeToString(data),
+			"mimeType": mimeType,
+		},
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if engineToken != "" {
+		req.Header.Set("Authorization", "Bearer "+engineToken) // el backend exige el token compartido
+	}
+	tracing.Inject(ctx, req.Header)
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("media text: %w", err)
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Success bool   `json:"success"`
+		Text    string `json:"text"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("media text: status %d: %w", resp.StatusCode, err)
+	}
+	if !out.Success {
+		return "", fmt.Errorf("media text: status %d: %s", resp.StatusCode, out.Error)
+	}
+	return strings.TrimSpace(out.Text), nil
+}
+
+// maxBackendMediaBytes tope de un adjunto que el backend acepta (MaxChatMediaBytes): más grande
+// ni se descarga entero
+const maxBackendMediaBytes = 5 << 20
+
+// download bytes descifrados de la media vía el engine (el ticket del envelope va tal cual);
+// falla si pesan más de maxBytes
+func (m *mediaReader) download(ctx context.Context, media map[string]any, maxBytes int64) ([]byte, string, error) {
+	body, _ := json.Marshal(media)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.mediaURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if engineToken != "" {
+		req.Header.Set("Authorization", "Bearer "+engineToken)
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("media download: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, "", fmt.Errorf("media download: status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("media download: %w", err)
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, "", fmt.Errorf("attachment too large (> %d bytes)", maxBytes)
+	}
+	mimeType, _ := media["mimetype"].(string)
+	if mimeType == "" {
+		mimeType = resp.Header.Get("Content-Type")
+	}
+	return data, mimeType, nil
+}
+
+// ocrLabel antecede al texto leído de una imagen/documento en el lote que va al backend
+const ocrLabel = "[Texto en la imagen/documento]: "
+
+// readMediaTexts reemplaza las notas de voz del lote por su transcripción y agrega a las
+// imágenes/documentos el texto leído por OCR; las que fallan quedan como estaban
+// (batchTexts omite las notas sin texto)
+func (r *SimpleRouter) readMediaTexts(ctx context.Context, batch []rules.Envelope) {
+	for i := range batch {
+		env := &batch[i]
+		start := time.Now()
+		switch {
+		case env.Voice != nil && strings.TrimSpace(env.Text) == "":
+			text, err := r.media.Transcribe(ctx, env.Voice)
+			if err != nil {
+				r.log.Warn("voice_transcribe_failed", "chat", env.ChatJID, "message_id", env.MessageID, "err", err.Error())
+				continue
+			}
+			env.Text = text
+			r.log.Info("voice_transcribed", "chat", env.ChatJID, "message_id", env.MessageID,
+				"text_len", len([]rune(text)), "t_ms", time.Since(start).Milliseconds())
+		case env.Attachment != nil && !strings.Contains(env.Text, ocrLabel):
+			text, err := r.media.ExtractText(ctx, env.Attachment)
+			if err != nil {
+				r.log.Warn("ocr_failed", "chat", env.ChatJID, "message_id", env.MessageID, "err", err.Error())
+				continue
+			}
+			if text != "" {
+				env.Text = strings.TrimSpace(env.Text + "\n" + ocrLabel + text)
+			}
+			r.log.Info("ocr_extracted", "chat", env.ChatJID, "message_id", env.MessageID,
+				"text_len", len([]rune(text)), "t_ms", time.Since(start).Milliseconds())
+		}
+	}
+}
+
+// errTransient marca fallos que vale la pena reintentar
+type errTransient struct{ error }
+
+// Header de correlación con los logs del backend (el backend lo devuelve igual)
+const requestIDHeader = "X-Request-ID"
+
+// newRequestID ID corto y único por llamada al backend
+func newRequestID() string {
+	var b [8]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+func (b *bobBackend) post(ctx context.Context, jsonData []byte, requestID string) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.url, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(requestIDHeader, requestID)
+	if engineToken != "" {
+		req.Header.Set("Authorization", "Bearer "+engineToken) // el backend solo programa seguimientos si viene del bot
+	}
+	tracing.Inject(ctx, req.Header) // traceparent: el backend continúa la misma traza
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, errTransient{err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil, errTransient{fmt.Errorf("backend status %d", resp.StatusCode)}
+	}
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+	return result, nil
+}
+
+// bobReply: texto a responder + calificación del lead (si el backend la envió)
+type bobReply struct {
+	Text      string
+	LeadScore int
+	Category  string
+	HasLead   bool
+	Silent    bool   // el backend suprimió la respuesta (handoff a asesor): no contestar
+	RequestID string // correlación con los logs del backend
+}
+
+// Call envía la ráfaga: "message" es la unión (lo que lee el orquestador hoy) y
+// "messages" la lista por separado.
+// behavior (opcional) son las señales de Profile.Metrics para el scoring.
+// tier (opcional) es Profile.Tier: el backend ajusta el tono de la respuesta.
+func (b *bobBackend) Call(ctx context.Context, fromPhone string, messages []string, behavior map[string]any, tier string, logger jlog) bobReply {
 	sessionId := "wa-" + fromPhone
+	requestID := newRequestID()
+	ctx, span := tracing.Start(ctx, "bob.call", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("request_id", requestID), attribute.Int("messages", len(messages))))
+	defer span.End()
 
-	payload := map[string]string{
+	payload := map[string]any{
 		"sessionId": sessionId,
-		"message":   message,
+		"message":   strings.Join(messages, "\n"),
+		"messages":  messages,
 		"channel":   "whatsapp",
+		"requestId": requestID,
+	}
+	if behavior != nil {
+		payload["behavior"] = behavior
+	}
+	if tier != "" {
+		payload["tier"] = tier
 	}
 	jsonData, _ := json.Marshal(payload)
 
-	resp, err := http.Post(
-		"http://localhost:3000/api/chat/message",
-		"application/json",
-		bytes.NewBuffer(jsonData),
-	)
-	if err != nil {
-		logger.Warn("bob_backend_error", "err", err)
-		return "Lo siento, hubo un error procesando tu mensaje."
+	if !b.breaker.allow() {
+		logger.Warn("bob_backend_circuit_open", "from", fromPhone, "request_id", requestID)
+		return bobReply{Text: bobFallbackError, RequestID: requestID}
 	}
-	defer resp.Body.Close()
 
 	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		logger.Warn("bob_backend_decode_error", "err", err)
-		return "Error procesando la respuesta."
+	var err error
+	start := time.Now()
+	for attempt := 0; attempt <= b.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(b.backoff * time.Duration(1<<(attempt-1)))
+		}
+		result, err = b.post(ctx, jsonData, requestID)
+		var te errTransient
+		if err == nil || !errors.As(err, &te) {
+			break
+		}
+		logger.Warn("bob_backend_retry", "request_id", requestID, "attempt", attempt+1, "err", err.Error())
+	}
+	metrics.BackendCall.WithLabelValues(metrics.Result(err)).Observe(metrics.Since(start))
+	if err != nil {
+		tracing.Fail(span, err)
+		if b.breaker.failure() {
+			logger.Warn("bob_backend_circuit_opened", "request_id", requestID, "cooldown", b.breaker.cooldown.String())
+		}
+		var te errTransient
+		if errors.As(err, &te) {
+			logger.Warn("bob_backend_error", "request_id", requestID, "err", err.Error())
+			return bobReply{Text: bobFallbackError, RequestID: requestID}
+		}
+		logger.Warn("bob_backend_decode_error", "request_id", requestID, "err", err.Error())
+		return bobReply{Text: bobFallbackDecode, RequestID: requestID}
 	}
+	b.breaker.success()
 
 	if reply, ok := result["reply"].(string); ok {
-		// Log del lead score si viene
+		out := bobReply{Text: reply, RequestID: requestID}
+		if suppressed, _ := result["suppressed"].(bool); suppressed {
+			out.Silent = true
+			logger.Info("bob_backend_suppressed", "from", fromPhone, "request_id", requestID, "reason", "handoff")
+		}
+		// Lead score/categoría si vienen (se guardan en el Profile)
 		if score, ok2 := result["leadScore"].(float64); ok2 {
-			if category, ok3 := result["category"].(string); ok3 {
-				logger.Info("bob_backend_reply",
-					"from", fromPhone,
-					"score", int(score),
-					"category", category,
-					"reply_len", len([]rune(reply)),
-				)
+			out.LeadScore, out.HasLead = int(score), true
+			out.Category, _ = result["category"].(string)
+			logger.Info("bob_backend_reply",
+				"from", fromPhone,
+				"request_id", requestID,
+				"score", out.LeadScore,
+				"category", out.Category,
+				"reply_len", len([]rune(reply)),
+			)
+		}
+		return out
+	}
+
+	return bobReply{Text: bobFallbackEmpty, RequestID: requestID}
+}
+
+// takeBatch retira (bajo muLast) la ráfaga pendiente del chat y sus spans, junto con
+// el último envelope memorizado
+func (r *SimpleRouter) takeBatch(chat string) (env rules.Envelope, ok bool, batch []rules.Envelope, spans []trace.SpanContext) {
+	r.muLast.Lock()
+	defer r.muLast.Unlock()
+	env, ok = r.lastByChat[chat]
+	batch, spans = r.pendingByChat[chat], r.spansByChat[chat]
+	delete(r.pendingByChat, chat)
+	delete(r.spansByChat, chat)
+	return env, ok, batch, spans
+}
+
+// flushChat (onFlush del agregador) responde la ráfaga cerrada de chat vía el backend BOB
+func (r *SimpleRouter) flushChat(chat string, count int) {
+	metrics.AggregatorFlushes.Inc()
+	// La ráfaga se toma al cerrar la ventana, antes de la pre-pausa: lo que llegue
+	// durante la pausa ya es del lote siguiente (que el agregador cerrará aparte)
+	env, ok, batch, spans := r.takeBatch(chat)
+	// Pequeña pre-pausa separada de la ventana
+	time.Sleep(r.preReplyDelay)
+
+	// el flush cuelga del webhook del último mensaje; los anteriores del lote van como links
+	parent := context.Background()
+	var links []trace.Link
+	if n := len(spans); n > 0 {
+		parent = trace.ContextWithSpanContext(parent, spans[n-1])
+		for _, sc := range spans[:n-1] {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
+	}
+	ctx, span := tracing.Start(parent, "aggregator.flush", trace.WithLinks(links...),
+		trace.WithAttributes(attribute.String("chat", chat), attribute.Int("count", count)))
+	defer span.End()
+
+	// bloqueado durante la ventana: no se llama al backend ni se responde
+	if r.isBlocked(chat, time.Now()) {
+		r.log.Info("flush_skipped_blocked", "chat", chat, "count", count)
+		return
+	}
+
+	// cooldown: se posterga el turno; los textos vuelven a la cola y se re-arma un
+	// flush para cuando venza (o los toma antes el lote de un mensaje nuevo)
+	if claimed, wait := r.claimCooldown(chat, time.Now()); !claimed {
+		if len(batch) > 0 {
+			r.muLast.Lock()
+			r.pendingByChat[chat] = keepLastN(append(batch, r.pendingByChat[chat]...), maxBatchTexts)
+			r.muLast.Unlock()
+			r.rearmAfterCooldown(chat, wait)
+		}
+		r.log.Info("flush_skipped_cooldown", "chat", chat, "count", count, "cooldown_ms", r.replyCooldown.Milliseconds(), "retry_in_ms", wait.Milliseconds())
+		return
+	}
+
+	// notas de voz e imágenes → texto; el último envelope toma su transcripción/OCR
+	if r.media != nil {
+		r.readMediaTexts(ctx, batch)
+		if ok && (env.Voice != nil || env.Attachment != nil) {
+			for _, b := range batch {
+				if b.MessageID == env.MessageID {
+					env.Text = b.Text
+				}
 			}
 		}
-		return reply
 	}
 
-	return "No se pudo obtener respuesta del sistema."
+	if ok && strings.TrimSpace(env.Text) != "" {
+		// Llamar al backend BOB de Kevin en vez del engine de reglas
+		res := r.bob.Call(ctx, env.SenderJID, batchTexts(batch, env), r.behaviorFor(chat), r.tierFor(chat), r.log)
+		if res.HasLead {
+			r.setLeadInfo(chat, res.LeadScore, res.Category)
+		}
+		reply := res.Text
+		if res.Silent {
+			return
+		}
+
+		if strings.TrimSpace(reply) != "" {
+			wait := r.replyWithTyping(ctx, chat, reply)
+			r.log.Info("reply_bob_backend",
+				"chat", chat,
+				"request_id", res.RequestID,
+				"count", count,
+				"reply_len", len([]rune(reply)),
+				"reply_preview", previewText(reply, maxLogText),
+				"t_pre_delay_ms", r.preReplyDelay.Milliseconds(),
+				"t_typing_ms", wait.Milliseconds(),
+			)
+			return
+		}
+	}
+	// Fallback si no hubo respuesta del backend
+	msg := "Llegaron " + strconv.Itoa(count) + " mensaje(s) en la ventana."
+	r.replyWithTyping(ctx, chat, msg)
+}
+
+// setLeadInfo guarda score/categoría del backend en el perfil del chat
+func (r *SimpleRouter) setLeadInfo(chat string, score int, category string) {
+	p := r.getOrCreateProfileByKey(chat)
+	if p == nil {
+		return
+	}
+	r.muProf.Lock()
+	p.LeadScore = score
+	if category != "" {
+		p.Category = category
+	}
+	p.LeadUpdatedAt = time.Now()
+	r.muProf.Unlock()
+	r.markDirty(chat, p)
+}
+
+// Tope de mensajes por lote que se reenvían al backend (los más recientes)
+const maxBatchTexts = 20
+
+// batchTexts arma la ráfaga completa (cada mensaje con su cita, si la tiene);
+// sin ráfaga registrada cae al último envelope.
+func batchTexts(batch []rules.Envelope, last rules.Envelope) []string {
+	if len(batch) == 0 {
+		batch = []rules.Envelope{last}
+	}
+	out := make([]string, 0, len(batch))
+	for _, e := range batch {
+		if t := strings.TrimSpace(e.Text); t != "" {
+			out = append(out, withQuote(e.Text, e.QuotedText))
+		}
+	}
+	return out
+}
+
+// withQuote antepone el mensaje citado para que el LLM sepa a qué se refiere
+// ("¿y ese cuánto cuesta?" respondiendo a la ficha de un vehículo).
+func withQuote(text, quoted string) string {
+	quoted = strings.TrimSpace(quoted)
+	if quoted == "" {
+		return text
+	}
+	return "[En respuesta a: \"" + previewText(quoted, 300) + "\"]\n" + text
 }
 
 //
@@ -887,10 +2374,16 @@ func callBOBBackend(fromPhone string, message string, logger jlog) string {
 
 var httpc = &http.Client{Timeout: 5 * time.Second}
 
+// Bearer para el REST del engine (WH_ENGINE_API_TOKEN); vacío = sin header
+var engineToken string
+
 func postJSON(url string, body any) (*http.Response, error) {
 	b, _ := json.Marshal(body)
 	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(b))
 	req.Header.Set("Content-Type", "application/json")
+	if engineToken != "" {
+		req.Header.Set("Authorization", "Bearer "+engineToken)
+	}
 	return httpc.Do(req)
 }
 
@@ -975,6 +2468,29 @@ func makeMarkReadFn(url string, log jlog) func(chat, sender string, ids []string
 // =======================
 //
 
+// aggregatorStatsHandler GET /debug/aggregator → lotes pendientes por chat (edades en ms)
+func aggregatorStatsHandler(agg *pipeline.Aggregator) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		st := agg.Stats()
+		chats := make(map[string]any, len(st.Chats))
+		for chat, cs := range st.Chats {
+			chats[chat] = map[string]any{
+				"count":         cs.Count,
+				"age_ms":        cs.Age.Milliseconds(),
+				"flushes_in_ms": cs.FlushesIn.Milliseconds(),
+				"capped":        cs.Capped,
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"pending_chats":         st.PendingChats,
+			"pending_messages":      st.PendingMessages,
+			"oldest_pending_age_ms": st.OldestPendingAge.Milliseconds(),
+			"chats":                 chats,
+		})
+	}
+}
+
 func init() {
 	rand.Seed(time.Now().UnixNano())
 }
@@ -994,18 +2510,41 @@ func main() {
 	dedupeWindow := cfg.ServerDedupeWindow
 	enableTimestamp := cfg.ServerUseTimestamp
 	allowNoSecretDev := cfg.ServerAllowNoSecretDev
+	requireNonce := cfg.ServerRequireNonce
+	requireJSONCT := cfg.ServerRequireJSONCT
 
 	// Integración hacia engine
 	engineSendURL := cfg.ServerEngineSendURL
 	engineTypingURL := cfg.ServerEngineTypingURL
 	engineMarkReadURL := cfg.ServerEngineMarkReadURL // p. ej. http://127.0.0.1:8080/api/markread
+	engineToken = cfg.EngineAPIToken
 
 	logger := jlog{json: logJSON}
 
-	if requireSig && secret == "" && !allowNoSecretDev {
-		logger.Error("WH_WEBHOOK_SECRET required (prod mode)")
+	// Tracing: no-op sin OTEL_EXPORTER_OTLP_ENDPOINT (el traceparent se propaga igual)
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.ServerOTLPEndpoint, "whserver")
+	if err != nil {
+		logger.Error("otlp_setup_failed", "err", err.Error())
+		os.Exit(1)
+	}
+
+	if requireSig && secret == "" {
+		logger.Error("WH_WEBHOOK_SECRET required when WH_REQUIRE_SIG=1 (dev local: WH_REQUIRE_SIG=0 y WH_ALLOW_NO_SECRET_DEV=1)")
+		os.Exit(1)
+	}
+	if secret == "" && !allowNoSecretDev {
+		logger.Error("unsigned webhooks need WH_ALLOW_NO_SECRET_DEV=1 (dev only)")
+		os.Exit(1)
+	}
+	if err := validateBackendURL(cfg.BOBBackendURL); err != nil {
+		logger.Error("invalid WH_BOB_BACKEND_URL", "url", cfg.BOBBackendURL, "err", err.Error())
 		os.Exit(1)
 	}
+	timeout := cfg.BOBBackendTimeout
+	if timeout <= 0 {
+		timeout = 20 * time.Second
+	}
+	bob := newBOBBackend(cfg.BOBBackendURL, timeout)
 
 	// Helpers hacia engine
 	sendFn := makeSendFn(engineSendURL, logger)
@@ -1022,13 +2561,25 @@ func main() {
 	}
 
 	// Cadena de filtros (pkg/filters)
+	blockList := filters.NewBlockList()
+	if err := blockList.LoadFile(cfg.ServerBlockListFile); err != nil {
+		logger.Warn("blocklist_load_failed", "path", cfg.ServerBlockListFile, "err", err.Error())
+	}
 	chain := filters.Chain{
 		Filters: []filters.Filter{
 			filters.NotOut{},
 			filters.RequireSender{},
+			blockList,
+			filters.NewRateLimitPerChat(cfg.ServerRatePerChatMax, cfg.ServerRatePerChatWin),
 			// agrega más filtros aquí…
 		},
 	}
+	if cfg.ServerGroupMentionOnly {
+		if len(cfg.ServerBotJIDs) == 0 {
+			logger.Warn("group_mention_only_without_bot_jids", "msg", "WH_BOT_JIDS vacío: el filtro no aplica")
+		}
+		chain.Filters = append(chain.Filters, filters.GroupMentionOnly{SelfJIDs: cfg.ServerBotJIDs})
+	}
 
 	// Router sin cooldown, con pre-pausa
 	router := NewSimpleRouter(
@@ -1045,40 +2596,28 @@ func main() {
 		nil,
 		chain,
 	)
+	router.profiles = newProfileLRU(cfg.ServerProfileCache)
+	router.blockList = blockList
+	router.bob = bob
+	if cfg.ServerEngineMediaURL != "" && (cfg.BOBTranscribeURL != "" || cfg.BOBExtractURL != "") {
+		router.media = newMediaReader(cfg.ServerEngineMediaURL, cfg.BOBTranscribeURL, cfg.BOBExtractURL, cfg.VoiceMaxSeconds, cfg.OCRMaxBytes, timeout)
+	}
+	router.minWait = cfg.ReplyMinWait
+	router.bubbleMax = cfg.ReplyBubbleMax
+	router.bubblePause = cfg.ReplyBubblePause
+	router.replyCooldown = cfg.ReplyCooldown
+	router.syncBlockListFromDisk()
+	router.StartProfileFlusher(cfg.ServerProfileFlush)
+	if loc, err := time.LoadLocation(strings.TrimSpace(cfg.ServerStreakTZ)); err == nil {
+		router.streakLoc = loc
+	} else {
+		logger.Warn("streak_tz_invalid_using_utc", "tz", cfg.ServerStreakTZ, "err", err.Error())
+	}
 	aggWindow := cfg.AggWindow
 	if aggWindow <= 0 {
 		aggWindow = 3 * time.Second
 	}
 
-	onFlush := func(chat string, count int) {
-		// Pequeña pre-pausa separada de la ventana
-		time.Sleep(cfg.PreReplyDelay)
-		// Recupera el último envelope memorizado
-		router.muLast.Lock()
-		env, ok := router.lastByChat[chat]
-		router.muLast.Unlock()
-
-		if ok && strings.TrimSpace(env.Text) != "" {
-			// Llamar al backend BOB de Kevin en vez del engine de reglas
-			reply := callBOBBackend(env.SenderJID, env.Text, logger)
-
-			if strings.TrimSpace(reply) != "" {
-				wait := router.replyWithTyping(chat, reply)
-				logger.Info("reply_bob_backend",
-					"chat", chat,
-					"count", count,
-					"reply_len", len([]rune(reply)),
-					"reply_preview", previewText(reply, maxLogText),
-					"t_pre_delay_ms", cfg.PreReplyDelay.Milliseconds(),
-					"t_typing_ms", wait.Milliseconds(),
-				)
-				return
-			}
-		}
-		// Fallback si no hubo respuesta del backend
-		msg := "Llegaron " + strconv.Itoa(count) + " mensaje(s) en la ventana."
-		router.replyWithTyping(chat, msg)
-	}
 	// Callback de onReset para logs explícitos
 	onReset := func(chat string, reason string, count int, win time.Duration) {
 		secs := int(win / time.Second)
@@ -1097,6 +2636,19 @@ func main() {
 				"ventana_seg", secs,
 				"mensajes_acumulados", count,
 			)
+		case "max_batch":
+			logger.Info("agg_flush_max_batch",
+				"msg", "se alcanzó el máximo de mensajes por lote; respondiendo sin esperar la ventana",
+				"chat", chat,
+				"mensajes_acumulados", count,
+			)
+		case "max_wait":
+			logger.Info("agg_flush_max_wait",
+				"msg", "se cumplió el tiempo máximo de espera desde el primer mensaje; respondiendo",
+				"chat", chat,
+				"esperado_ms", win.Milliseconds(),
+				"mensajes_acumulados", count,
+			)
 		case "typing":
 			logger.Info("agg_window_reset_typing",
 				"msg", "detectado que usuario está escribiendo; ventana de espera reiniciada",
@@ -1107,10 +2659,18 @@ func main() {
 		}
 	}
 
-	agg := pipeline.NewAggregator(aggWindow, onFlush, onReset)
+	agg := pipeline.NewAggregator(aggWindow, router.flushChat, onReset)
+	agg.SetMaxBatch(cfg.AggMaxBatch)
+	agg.SetMaxWait(cfg.AggMaxWait)
+	agg.SetTypingWindow(cfg.AggTypingWin)
+	agg.SetFirstContact(cfg.AggFirstWindow, cfg.AggFirstMinMsgs)
+	for jid, d := range cfg.AggWindows {
+		agg.SetChatWindow(jid, d)
+	}
 	router.aggregator = agg
 
 	ded := newDeduper(dedupeWindow)
+	nonces := newDeduper(2 * tsSkew) // ±skew: un nonce más viejo ya lo rechaza el timestamp
 	mux := http.NewServeMux()
 
 	// Health endpoints
@@ -1122,12 +2682,42 @@ func main() {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ready"))
 	})
+	// Prometheus: mensajes, flushes del agregador, espera de typing, backend BOB
+	mux.Handle("/metrics", metrics.Handler())
 	mux.HandleFunc("/debug/profiles", func(w http.ResponseWriter, _ *http.Request) {
 		router.muProf.Lock()
-		defer router.muProf.Unlock()
+		snap := router.profiles.snapshot() // solo los perfiles calientes (LRU)
+		router.muProf.Unlock()
 		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(router.profiles)
+		_ = json.NewEncoder(w).Encode(snap)
 	})
+	mux.HandleFunc("/debug/aggregator", aggregatorStatsHandler(agg))
+	// /profiles?chat=<jid> | /profiles?limit=&offset=
+	mux.HandleFunc("/profiles", router.profilesHandler)
+	// /profiles/{chat}/block (admin): POST bloquea, DELETE desbloquea
+	blockHandler := func(w http.ResponseWriter, req *http.Request) {
+		var breq *BlockRequest
+		if req.Method == http.MethodPost {
+			breq = &BlockRequest{}
+			dec := json.NewDecoder(http.MaxBytesReader(w, req.Body, 64<<10))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(breq); err != nil {
+				http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		p, err := router.setBlock(req.PathValue("chat"), breq, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		logger.Warn("profile_block_updated", "chat", p.SenderJID, "permanent", p.Block.Permanent, "until", p.Block.Until.Format(time.RFC3339))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"chat": p.SenderJID, "block": p.Block, "blocked": blockedAt(&p, time.Now())})
+	}
+	mux.HandleFunc("POST /profiles/{chat}/block", requireAdminToken(cfg.ServerAdminToken, blockHandler))
+	mux.HandleFunc("DELETE /profiles/{chat}/block", requireAdminToken(cfg.ServerAdminToken, blockHandler))
+
 	mux.HandleFunc("/", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("whserver up"))
@@ -1139,6 +2729,13 @@ func main() {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
+		reqCtx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), "wh.receive", trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+
+		// Content-Type antes de leer nada (sin cabecera se tolera solo en dev, sin secreto)
+		if requireJSONCT && rejectNonJSON(w, r, secret == "") {
+			return
+		}
 
 		// Body limit + lectura
 		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
@@ -1148,22 +2745,30 @@ func main() {
 			return
 		}
 
-		// Timestamp opcional
-		if enableTimestamp {
-			if err := verifyTimestamp(r.Header.Get("X-Whatsbot-Timestamp"), tsSkew); err != nil {
+		// Timestamp opcional (obligatorio con nonce: acota cuánto hay que recordar nonces)
+		if enableTimestamp || requireNonce {
+			if err := webhooksig.CheckTimestamp(r.Header.Get(webhooksig.HeaderTimestamp), tsSkew); err != nil {
 				http.Error(w, "invalid timestamp", http.StatusUnauthorized)
 				return
 			}
 		}
 
-		// Firma HMAC (si está habilitada)
-		if requireSig {
-			if !verifySignature(secret, body, r.Header.Get("X-Whatsbot-Signature")) {
-				http.Error(w, "invalid signature", http.StatusUnauthorized)
+		// Firma HMAC: con secreto siempre se verifica; requireSig decide si el fallo rechaza
+		if ok, warn := checkSignature(secret, requireSig, body, r.Header.Get(webhooksig.HeaderSignature)); !ok {
+			logger.Warn(warn)
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		} else if warn != "" {
+			logger.Warn(warn)
+		}
+
+		// Anti-replay: el nonce debe ir firmado junto al timestamp y no repetirse dentro de la ventana
+		if requireNonce {
+			if ok, reason := checkNonce(nonces, secret, r.Header, body); !ok {
+				logger.Warn("nonce_rejected", "reason", reason, "nonce", r.Header.Get(webhooksig.HeaderNonce))
+				http.Error(w, reason, http.StatusUnauthorized)
 				return
 			}
-		} else if secret == "" {
-			logger.Warn("signature_not_required_dev_mode")
 		}
 
 		// Decodificar envelope
@@ -1173,6 +2778,11 @@ func main() {
 			return
 		}
 
+		span.SetAttributes(
+			attribute.String("event_type", strings.TrimSpace(env.EventType)),
+			attribute.String("chat", env.ChatJID),
+		)
+
 		// Log básico del evento
 		logger.Info(
 			"event",
@@ -1184,7 +2794,7 @@ func main() {
 		)
 
 		// Dedupe por message_id (solo para mensajes reales)
-		if env.EventType == "message" && ded.Seen(env.MessageID) {
+		if (env.EventType == "message" || env.EventType == "contact") && ded.Seen(env.MessageID) {
 			w.WriteHeader(http.StatusOK)
 			_, _ = w.Write([]byte(`{"ok":true,"dup":true}`))
 			return
@@ -1194,10 +2804,11 @@ func main() {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte(`{"ok":true}`))
 
-		// Procesamiento async
+		// Procesamiento async (sin la cancelación de la request, dentro de la traza del webhook)
+		procCtx := context.WithoutCancel(reqCtx)
 		go func(e Envelope) {
-			ctx := context.Background()
-			if e.EventType == "message" && !strings.EqualFold(e.Direction, "out") && strings.TrimSpace(e.MessageID) != "" {
+			ctx := procCtx
+			if (e.EventType == "message" || e.EventType == "contact") && !strings.EqualFold(e.Direction, "out") && strings.TrimSpace(e.MessageID) != "" {
 				mrStart := time.Now()
 				var err error
 				if strings.Contains(e.ChatJID, "@g.us") {
@@ -1213,7 +2824,7 @@ func main() {
 			}
 
 			switch e.EventType {
-			case "message":
+			case "message", "contact":
 				router.OnMessage(ctx, e)
 			case "receipt":
 				router.OnReceipt(ctx, e)
@@ -1247,5 +2858,9 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	_ = srv.Shutdown(ctx)
+	router.StopProfileFlusher() // flush final de perfiles sucios
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Warn("otlp_shutdown_failed", "err", err.Error())
+	}
 	logger.Info("graceful shutdown complete")
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/investigadorinexperto/bot/pkg/webhooksig"
+)
+
+// signedHeaders cabeceras como las arma el engine para body
+func signedHeaders(secret, nonce string, body []byte) http.Header {
+	ts := time.Now().UTC().Format(time.RFC3339)
+	h := http.Header{}
+	h.Set(webhooksig.HeaderTimestamp, ts)
+	h.Set(webhooksig.HeaderNonce, nonce)
+	h.Set(webhooksig.HeaderSignature, webhooksig.Sign(secret, body))
+	h.Set(webhooksig.HeaderSignatureBound, webhooksig.SignBound(secret, ts, nonce, body))
+	return h
+}
+
+func TestCheckNonceRejectsReplayWithinWindow(t *testing.T) {
+	const secret = "compartido"
+	body := []byte(`{"event_type":"message"}`)
+	nonces := newDeduper(time.Minute)
+
+	first := signedHeaders(secret, webhooksig.NewNonce(), body)
+	if ok, reason := checkNonce(nonces, secret, first, body); !ok {
+		t.Fatalf("first request rejected: %s", reason)
+	}
+	if ok, reason := checkNonce(nonces, secret, first, body); ok || reason != "replayed nonce" {
+		t.Fatalf("replay = %v %q, want replayed nonce", ok, reason)
+	}
+	if ok, reason := checkNonce(nonces, secret, signedHeaders(secret, webhooksig.NewNonce(), body), body); !ok {
+		t.Fatalf("fresh nonce rejected: %s", reason)
+	}
+}
+
+func TestCheckNonceAcceptsNonceAfterWindow(t *testing.T) {
+	nonces := newDeduper(20 * time.Millisecond)
+	h := signedHeaders("s", "n-1", []byte("{}"))
+	if ok, _ := checkNonce(nonces, "s", h, []byte("{}")); !ok {
+		t.Fatal("first request rejected")
+	}
+	time.Sleep(40 * time.Millisecond)
+	// fuera de la ventana el timestamp (no el nonce) es quien lo frena
+	if ok, reason := checkNonce(nonces, "s", h, []byte("{}")); !ok {
+		t.Fatalf("nonce after window rejected: %s", reason)
+	}
+}
+
+func TestCheckNonceRejectsBadInput(t *testing.T) {
+	const secret = "compartido"
+	body := []byte(`{"event_type":"message"}`)
+	valid := signedHeaders(secret, "n-valid", body)
+
+	swapped := valid.Clone()
+	swapped.Set(webhooksig.HeaderNonce, "n-other") // body firmado reusado con otro nonce
+
+	missing := valid.Clone()
+	missing.Del(webhooksig.HeaderNonce)
+
+	noBound := valid.Clone()
+	noBound.Del(webhooksig.HeaderSignatureBound)
+
+	tests := []struct {
+		name   string
+		secret string
+		h      http.Header
+		want   string
+	}{
+		{"missing nonce", secret, missing, "missing nonce"},
+		{"nonce swapped", secret, swapped, "invalid bound signature"},
+		{"no bound signature", secret, noBound, "invalid bound signature"},
+		{"wrong secret", "otro", valid, "invalid bound signature"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ok, reason := checkNonce(newDeduper(time.Minute), tt.secret, tt.h, body); ok || reason != tt.want {
+				t.Fatalf("checkNonce = %v %q, want %q", ok, reason, tt.want)
+			}
+		})
+	}
+	// sin secreto (dev) basta con que el nonce sea nuevo
+	if ok, reason := checkNonce(newDeduper(time.Minute), "", noBound, body); !ok {
+		t.Fatalf("dev mode rejected: %s", reason)
+	}
+}
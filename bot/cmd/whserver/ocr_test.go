@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func inboundAttachment(chat, id, caption, kind, mimeType, ticket string) Envelope {
+	env := inboundText(chat, id, caption)
+	env.Media = map[string]any{"type": kind, "mimetype": mimeType, "url": ticket}
+	return env
+}
+
+func TestIsOCRMedia(t *testing.T) {
+	cases := []struct {
+		kind, mimeType string
+		want           bool
+	}{
+		{"image", "image/jpeg", true},
+		{"document", "application/pdf", true},
+		{"document", "image/png", true},
+		{"document", "application/vnd.ms-excel", false},
+		{"audio", "audio/ogg", false},
+		{"video", "video/mp4", false},
+	}
+	for _, c := range cases {
+		if got := isOCRMedia(map[string]any{"type": c.kind, "mimetype": c.mimeType}); got != c.want {
+			t.Errorf("isOCRMedia(%s, %s) = %v", c.kind, c.mimeType, got)
+		}
+	}
+}
+
+func TestFlushChatAttachesOCRText(t *testing.T) {
+	const chat = "51911000120@s.whatsapp.net"
+	media := mediaTextServer(t, map[string]string{
+		"/api/chat/extract|image/jpeg|placa":    "ABC-123",
+		"/api/chat/extract|application/pdf|dni": "DNI 45678912",
+		"/api/chat/extract|image/jpeg|paisaje":  "",
+	})
+	r, _ := newTestRouter(t)
+	r.media = newMediaReader(media.URL+"/api/media/download", "", media.URL+"/api/chat/extract", 0, 1<<20, time.Second)
+	srv, calls := bobRecorder(t, "Gracias, lo reviso.")
+	r.bob = testBOBBackend(srv.URL)
+
+	r.OnMessage(context.Background(), inboundAttachment(chat, "O1", "esta placa", "image", "image/jpeg", "placa"))
+	r.OnMessage(context.Background(), inboundAttachment(chat, "O2", "", "image", "image/jpeg", "paisaje")) // sin texto legible: se omite
+	r.OnMessage(context.Background(), inboundAttachment(chat, "O3", "", "document", "application/pdf", "dni"))
+	r.flushChat(chat, 3)
+
+	want := []string{"esta placa\n" + ocrLabel + "ABC-123", ocrLabel + "DNI 45678912"}
+	if got := <-calls; !slices.Equal(got, want) {
+		t.Fatalf("backend messages = %q, want %q", got, want)
+	}
+}
+
+func TestOCRSkipsLargeAttachments(t *testing.T) {
+	const chat = "51911000121@s.whatsapp.net"
+	media := mediaTextServer(t, map[string]string{"/api/chat/extract|image/jpeg|placa": "ABC-123"})
+	r, _ := newTestRouter(t)
+	r.media = newMediaReader(media.URL+"/api/media/download", "", media.URL+"/api/chat/extract", 0, 4, time.Second)
+	srv, calls := bobRecorder(t, "ok")
+	r.bob = testBOBBackend(srv.URL)
+
+	// OCR_MAX_BYTES = 4: la imagen de 5 bytes va solo con su texto
+	r.OnMessage(context.Background(), inboundAttachment(chat, "L1", "mira", "image", "image/jpeg", "placa"))
+	r.flushChat(chat, 1)
+	if got := <-calls; !slices.Equal(got, []string{"mira"}) {
+		t.Fatalf("backend messages = %q", got)
+	}
+}
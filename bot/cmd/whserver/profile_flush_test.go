@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/investigadorinexperto/bot/pkg/filters"
+)
+
+func TestRapidMessagesCoalesceIntoOneFlush(t *testing.T) {
+	r, _ := newTestRouter(t)
+	r.flushEvery = time.Hour // diferido sin ticker: el test decide cuándo se "cumple" el intervalo
+
+	const chat = "51911000060@s.whatsapp.net"
+	for i := 0; i < 50; i++ {
+		r.touchProfileFromInbound(Envelope{ChatJID: chat, MessageID: fmt.Sprint("M", i), Text: fmt.Sprint("mensaje ", i)})
+		r.incOutboundFor(chat)
+	}
+	if _, err := loadProfileFromDisk(chat); err == nil {
+		t.Fatal("profile written before the flush interval")
+	}
+	if n := r.flushProfiles(); n != 1 {
+		t.Fatalf("first flush wrote %d profiles, want 1", n)
+	}
+	if n := r.flushProfiles(); n != 0 {
+		t.Fatalf("second flush in the same interval wrote %d profiles, want 0", n)
+	}
+	p, err := loadProfileFromDisk(chat)
+	if err != nil || p.Metrics.MsgIn != 50 || p.Metrics.MsgOut != 50 || p.LastText != "mensaje 49" {
+		t.Fatalf("flushed profile = %+v (%v)", p, err)
+	}
+}
+
+func TestProfileFlusherWritesPeriodicallyAndOnStop(t *testing.T) {
+	r, _ := newTestRouter(t)
+	r.StartProfileFlusher(20 * time.Millisecond)
+
+	const chat = "51911000061@s.whatsapp.net"
+	r.touchProfileFromInbound(Envelope{ChatJID: chat, Text: "hola"})
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if p, err := loadProfileFromDisk(chat); err == nil && p.LastText == "hola" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("periodic flush never wrote the profile")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// lo que queda sucio al apagar se escribe en StopProfileFlusher
+	r.touchProfileFromInbound(Envelope{ChatJID: chat, Text: "chau"})
+	r.StopProfileFlusher()
+	if p, err := loadProfileFromDisk(chat); err != nil || p.LastText != "chau" {
+		t.Fatalf("final flush = %+v (%v)", p, err)
+	}
+}
+
+func TestSynchronousPersistenceWithoutFlusher(t *testing.T) {
+	r, _ := newTestRouter(t)
+	const chat = "51911000062@s.whatsapp.net"
+	r.touchProfileFromInbound(Envelope{ChatJID: chat, Text: "hola"})
+	if p, err := loadProfileFromDisk(chat); err != nil || p.LastText != "hola" {
+		t.Fatalf("flushEvery=0 must persist immediately: %+v (%v)", p, err)
+	}
+	if n := r.flushProfiles(); n != 0 {
+		t.Fatalf("nothing should be dirty, flushed %d", n)
+	}
+}
+
+func BenchmarkTouchProfile(b *testing.B) {
+	for _, tc := range []struct {
+		name  string
+		every time.Duration
+	}{{"sync", 0}, {"batched", time.Hour}} {
+		b.Run(tc.name, func(b *testing.B) {
+			b.Setenv("OUTBOX_BASE", b.TempDir())
+			r := NewSimpleRouter(jlog{}, nil, nil, 0, 0, 0, 0, 0, 0, nil, nil, filters.Chain{})
+			r.flushEvery = tc.every
+			env := Envelope{ChatJID: "51911000063@s.whatsapp.net", Text: "hola"}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r.touchProfileFromInbound(env)
+			}
+			b.StopTimer()
+			r.flushProfiles()
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProfileLRUEviction(t *testing.T) {
+	c := newProfileLRU(2)
+	put := func(key string) []string {
+		var out []string
+		for _, ev := range c.put(key, &Profile{SenderJID: key}) {
+			out = append(out, ev.key)
+		}
+		return out
+	}
+	steps := []struct {
+		op          string // "put:<key>" o "get:<key>"
+		wantEvicted []string
+		wantLen     int
+	}{
+		{"put:a", nil, 1},
+		{"put:b", nil, 2},
+		{"get:a", nil, 2}, // a pasa a ser el más reciente
+		{"put:c", []string{"b"}, 2},
+		{"put:a", nil, 2}, // refrescar no expulsa
+		{"put:d", []string{"c"}, 2},
+	}
+	for _, st := range steps {
+		op, key, _ := strings.Cut(st.op, ":")
+		var evicted []string
+		if op == "put" {
+			evicted = put(key)
+		} else if _, ok := c.get(key); !ok {
+			t.Fatalf("%s: key missing", st.op)
+		}
+		if strings.Join(evicted, ",") != strings.Join(st.wantEvicted, ",") || c.len() != st.wantLen {
+			t.Fatalf("%s: evicted %v (len %d), want %v (len %d)", st.op, evicted, c.len(), st.wantEvicted, st.wantLen)
+		}
+	}
+	if _, ok := c.get("b"); ok {
+		t.Fatal("b should have been evicted")
+	}
+	if snap := c.snapshot(); len(snap) != 2 || snap["a"].SenderJID != "a" || snap["d"].SenderJID != "d" {
+		t.Fatalf("snapshot = %v", snap)
+	}
+}
+
+func TestEvictedProfileReloadsFromDisk(t *testing.T) {
+	r, _ := newTestRouter(t)
+	r.profiles = newProfileLRU(2)
+
+	const chat = "51911000040@s.whatsapp.net"
+	p := r.getOrCreateProfileByKey(chat)
+	r.muProf.Lock()
+	p.Tags["interes"] = "hilux"
+	r.muProf.Unlock()
+	r.markDirty(chat, p)
+
+	// presión de capacidad: chat queda como el menos reciente y sale de memoria
+	r.getOrCreateProfileByKey("51911000041@s.whatsapp.net")
+	r.getOrCreateProfileByKey("51911000042@s.whatsapp.net")
+	r.muProf.Lock()
+	_, cached := r.profiles.get(chat)
+	n := r.profiles.len()
+	r.muProf.Unlock()
+	if cached || n != 2 {
+		t.Fatalf("cached = %v, len = %d; want evicted with len 2", cached, n)
+	}
+
+	again := r.getOrCreateProfileByKey(chat)
+	if again == p {
+		t.Fatal("expected a fresh instance rehydrated from disk")
+	}
+	if again.Tags["interes"] != "hilux" || again.SenderJID != chat {
+		t.Fatalf("reloaded profile = %+v", again)
+	}
+}
+
+func TestEvictionPersistsDirtyProfile(t *testing.T) {
+	r, _ := newTestRouter(t)
+	r.profiles = newProfileLRU(1)
+	r.flushEvery = time.Hour // diferido: el cambio solo queda marcado como sucio
+
+	const chat = "51911000043@s.whatsapp.net"
+	p := r.getOrCreateProfileByKey(chat)
+	r.muProf.Lock()
+	p.Tags["etapa"] = "negociacion"
+	r.muProf.Unlock()
+	r.markDirty(chat, p)
+
+	r.getOrCreateProfileByKey("51911000044@s.whatsapp.net") // expulsa chat antes del flush
+	r.muProf.Lock()
+	_, stillDirty := r.dirty[chat]
+	r.muProf.Unlock()
+	if stillDirty {
+		t.Fatal("evicted profile still marked dirty")
+	}
+	if got := r.getOrCreateProfileByKey(chat); got.Tags["etapa"] != "negociacion" {
+		t.Fatalf("dirty change lost on eviction: %+v", got.Tags)
+	}
+}
+
+func TestReceiptAndBehaviorForEvictedProfile(t *testing.T) {
+	r, _ := newTestRouter(t)
+	r.profiles = newProfileLRU(1)
+	ctx := context.Background()
+
+	const chat = "51911000045@s.whatsapp.net"
+	r.OnMessage(ctx, inboundText(chat, "A", "hola"))
+	r.incOutboundFor(chat)
+	r.getOrCreateProfileByKey("51911000046@s.whatsapp.net") // expulsa chat esperando el "read"
+
+	r.OnReceipt(ctx, Envelope{EventType: "receipt", ChatJID: chat, SenderJID: chat, ReceiptType: "read", MessageID: "OUT1"})
+	r.getOrCreateProfileByKey("51911000046@s.whatsapp.net") // y otra vez antes de armar el behavior
+
+	b := r.behaviorFor(chat)
+	if b == nil || b["readSamples"] != 1 || b["msgIn"] != 1 || b["msgOut"] != 1 {
+		t.Fatalf("behavior of evicted chat = %v", b)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// seedProfiles crea n perfiles con LastMsgAt creciente (chat 0 es el más antiguo)
+func seedProfiles(t *testing.T, r *SimpleRouter, n int) {
+	t.Helper()
+	base := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("5191100%04d@s.whatsapp.net", i)
+		p := r.getOrCreateProfileByKey(key)
+		r.muProf.Lock()
+		p.LastText = fmt.Sprintf("mensaje %d", i)
+		p.Metrics.MsgIn = i
+		p.Metrics.LastMsgAt = base.Add(time.Duration(i) * time.Minute)
+		r.muProf.Unlock()
+		r.markDirty(key, p)
+	}
+}
+
+func getProfiles(t *testing.T, r *SimpleRouter, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	r.profilesHandler(rec, httptest.NewRequest(http.MethodGet, "/profiles"+query, nil))
+	return rec
+}
+
+func TestProfilesSingleLookup(t *testing.T) {
+	r, _ := newTestRouter(t)
+	seedProfiles(t, r, 3)
+	// el perfil 0 solo queda en disco
+	r.profiles = newProfileLRU(2)
+	r.getOrCreateProfileByKey("51911000001@s.whatsapp.net")
+	r.getOrCreateProfileByKey("51911000002@s.whatsapp.net")
+
+	tests := []struct {
+		name     string
+		chat     string
+		wantCode int
+		wantText string
+	}{
+		{"in memory", "51911000002@s.whatsapp.net", http.StatusOK, "mensaje 2"},
+		{"disk only", "51911000000@s.whatsapp.net", http.StatusOK, "mensaje 0"},
+		{"not found", "51999999999@s.whatsapp.net", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := getProfiles(t, r, "?chat="+tt.chat)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("code = %d %s", rec.Code, rec.Body.String())
+			}
+			if tt.wantText == "" {
+				return
+			}
+			var p Profile
+			if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil || p.LastText != tt.wantText || p.SenderJID != tt.chat {
+				t.Fatalf("profile = %+v (%v)", p, err)
+			}
+		})
+	}
+}
+
+func TestProfilesPaging(t *testing.T) {
+	r, _ := newTestRouter(t)
+	seedProfiles(t, r, 5)
+
+	tests := []struct {
+		query   string
+		wantIDs []int // índices de seedProfiles, más reciente primero
+	}{
+		{"?limit=2", []int{4, 3}},
+		{"?limit=2&offset=2", []int{2, 1}},
+		{"?limit=2&offset=4", []int{0}},
+		{"?limit=2&offset=9", []int{}},
+		{"", []int{4, 3, 2, 1, 0}},
+		{"?limit=-1&offset=-3", []int{4, 3, 2, 1, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := getProfiles(t, r, tt.query)
+			var body struct {
+				Total int              `json:"total"`
+				Items []ProfileSummary `json:"items"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Total != 5 || len(body.Items) != len(tt.wantIDs) {
+				t.Fatalf("total = %d, items = %d; want 5, %d", body.Total, len(body.Items), len(tt.wantIDs))
+			}
+			for i, idx := range tt.wantIDs {
+				if want := fmt.Sprintf("5191100%04d@s.whatsapp.net", idx); body.Items[i].ChatJID != want || body.Items[i].MsgIn != idx {
+					t.Fatalf("item %d = %+v, want %s", i, body.Items[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestLookupProfileReturnsDeepCopy(t *testing.T) {
+	r, _ := newTestRouter(t)
+	const chat = "51911000050@s.whatsapp.net"
+	p := r.getOrCreateProfileByKey(chat)
+	r.muProf.Lock()
+	p.Tags["interes"] = "hilux"
+	p.Media.In = append(p.Media.In, MediaEntry{MessageID: "IMG1"})
+	r.muProf.Unlock()
+
+	cp, ok := r.lookupProfile(chat)
+	if !ok {
+		t.Fatal("profile not found")
+	}
+	cp.Tags["interes"] = "otro"
+	cp.Media.In[0].MessageID = "X"
+	if p.Tags["interes"] != "hilux" || p.Media.In[0].MessageID != "IMG1" {
+		t.Fatalf("lookup copy aliases the live profile: tags %v, media %v", p.Tags, p.Media.In)
+	}
+
+	snap := r.profiles.snapshot()[chat]
+	snap.Tags["interes"] = "otro"
+	if p.Tags["interes"] != "hilux" {
+		t.Fatal("snapshot aliases the live profile tags")
+	}
+}
+
+// con -race: leer copias mientras el router escribe Tags/Media no debe competir
+func TestLookupProfileConcurrentWithWrites(t *testing.T) {
+	r, _ := newTestRouter(t)
+	const chat = "51911000051@s.whatsapp.net"
+	p := r.getOrCreateProfileByKey(chat)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			r.muProf.Lock()
+			p.Tags[fmt.Sprint("k", i%10)] = fmt.Sprint(i)
+			p.Media.In = keepLastN(append(p.Media.In, MediaEntry{MessageID: fmt.Sprint(i)}), 5)
+			r.muProf.Unlock()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			cp, _ := r.lookupProfile(chat)
+			_, _ = json.Marshal(cp)
+			_ = r.profileSummaries()
+		}
+	}()
+	wg.Wait()
+}
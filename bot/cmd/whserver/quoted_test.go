@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/investigadorinexperto/bot/pkg/rules"
+)
+
+func TestWithQuotedContext(t *testing.T) {
+	e := Envelope{QuotedMessageID: "OUT7", QuotedSender: "bob", QuotedText: "Toyota Hilux 2019"}
+	e.withQuotedContext()
+	e.withQuotedContext() // idempotente
+	if len(e.Context) != 1 {
+		t.Fatalf("context = %v, want one quoted entry", e.Context)
+	}
+	c := e.Context[0]
+	if c["role"] != "quoted" || c["message_id"] != "OUT7" || c["text"] != "Toyota Hilux 2019" {
+		t.Errorf("context entry = %v", c)
+	}
+
+	var plain Envelope
+	plain.withQuotedContext()
+	if plain.Context != nil {
+		t.Errorf("context without quote = %v", plain.Context)
+	}
+}
+
+func TestBatchTextsIncludesQuote(t *testing.T) {
+	batch := []rules.Envelope{
+		{Text: "hola"},
+		{Text: "¿y ese cuánto cuesta?", QuotedText: "Toyota Hilux 2019 - subasta el viernes"},
+	}
+	got := batchTexts(batch, rules.Envelope{})
+	if len(got) != 2 || got[0] != "hola" {
+		t.Fatalf("batchTexts = %q", got)
+	}
+	want := "[En respuesta a: \"Toyota Hilux 2019 - subasta el viernes\"]\n¿y ese cuánto cuesta?"
+	if got[1] != want {
+		t.Errorf("quoted text = %q, want %q", got[1], want)
+	}
+	if q := withQuote("ok", strings.Repeat("x", 400)); !strings.HasPrefix(q, "[En respuesta a: \"") || len([]rune(q)) > 330 {
+		t.Errorf("long quote not trimmed: %d runes", len([]rune(q)))
+	}
+}
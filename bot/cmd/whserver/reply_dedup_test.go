@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReplyWithTypingDedup(t *testing.T) {
+	type reply struct {
+		chat, msg string
+		after     time.Duration // espera antes de este envío
+	}
+	tests := []struct {
+		name     string
+		dedup    time.Duration
+		replies  []reply
+		wantSent int
+	}{
+		{"identical twice", time.Second, []reply{{"a", "hola", 0}, {"a", "hola", 0}}, 1},
+		{"different text", time.Second, []reply{{"a", "hola", 0}, {"a", "chau", 0}}, 2},
+		{"different chat", time.Second, []reply{{"a", "hola", 0}, {"b", "hola", 0}}, 2},
+		{"after window", 30 * time.Millisecond, []reply{{"a", "hola", 0}, {"a", "hola", 50 * time.Millisecond}}, 2},
+		{"A B A resends", time.Second, []reply{{"a", "hola", 0}, {"a", "chau", 0}, {"a", "hola", 0}}, 3},
+		{"disabled", 0, []reply{{"a", "hola", 0}, {"a", "hola", 0}}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, sent := newTestRouter(t)
+			r.replyDedup = tt.dedup
+			for _, rp := range tt.replies {
+				time.Sleep(rp.after)
+				r.replyWithTyping(context.Background(), rp.chat, rp.msg)
+			}
+			if got := sent.all(); len(got) != tt.wantSent {
+				t.Fatalf("sent %d (%q), want %d", len(got), got, tt.wantSent)
+			}
+		})
+	}
+}
+
+// Dos flushes simultáneos con la misma respuesta: sale una sola
+func TestReplyWithTypingDedupConcurrent(t *testing.T) {
+	r, sent := newTestRouter(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.replyWithTyping(context.Background(), "a", "¡Hola! ¿En qué te ayudo?")
+		}()
+	}
+	wg.Wait()
+	if got := sent.all(); len(got) != 1 {
+		t.Fatalf("sent %d replies, want 1", len(got))
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/investigadorinexperto/bot/pkg/webhooksig"
+)
+
+func TestCheckSignature(t *testing.T) {
+	body := []byte(`{"event_type":"message"}`)
+	good := webhooksig.Sign("secreto", body)
+	bad := webhooksig.Sign("otro", body)
+
+	tests := []struct {
+		name       string
+		secret     string
+		requireSig bool
+		header     string
+		wantOK     bool
+		wantWarn   string
+	}{
+		// secreto + requireSig: verifica y rechaza
+		{"secret+require valid", "secreto", true, good, true, ""},
+		{"secret+require mismatch", "secreto", true, bad, false, "signature_invalid"},
+		{"secret+require missing", "secreto", true, "", false, "signature_invalid"},
+		// secreto sin requireSig: verifica pero solo avisa
+		{"secret only valid", "secreto", false, good, true, ""},
+		{"secret only mismatch", "secreto", false, bad, true, "signature_invalid_soft_fail"},
+		{"secret only missing", "secreto", false, "", true, "signature_invalid_soft_fail"},
+		// sin secreto + requireSig: fail-closed aunque venga una cabecera
+		{"require without secret", "", true, good, false, "signature_required_but_no_secret"},
+		{"require without secret unsigned", "", true, "", false, "signature_required_but_no_secret"},
+		// sin secreto ni requireSig: modo dev
+		{"dev mode", "", false, "", true, "signature_not_required_dev_mode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, warn := checkSignature(tt.secret, tt.requireSig, body, tt.header)
+			if ok != tt.wantOK || warn != tt.wantWarn {
+				t.Fatalf("checkSignature = %v %q, want %v %q", ok, warn, tt.wantOK, tt.wantWarn)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitBubbles(t *testing.T) {
+	code := "```\nfor i := 0; i < 3; i++ {\n\tfmt.Println(i)\n}\n```"
+	tests := []struct {
+		name string
+		max  int
+		msg  string
+		want []string
+	}{
+		{"fits", 50, "Hola, ¿cómo estás?", []string{"Hola, ¿cómo estás?"}},
+		{"disabled", 0, strings.Repeat("palabra ", 50), []string{strings.TrimSpace(strings.Repeat("palabra ", 50))}},
+		{
+			name: "paragraphs first",
+			max:  40,
+			msg:  "Primer párrafo corto.\n\nSegundo párrafo también corto.",
+			want: []string{"Primer párrafo corto.", "Segundo párrafo también corto."},
+		},
+		{
+			name: "packs short paragraphs",
+			max:  50,
+			msg:  "Hola.\n\nSoy Bob.\n\nTe ayudo con subastas y vehículos del catálogo.",
+			want: []string{"Hola.\n\nSoy Bob.", "Te ayudo con subastas y vehículos del catálogo."},
+		},
+		{
+			name: "sentence boundaries",
+			max:  30,
+			msg:  "La Hilux es 2019. Tiene 80 mil km. ¿Te interesa? ¡Avísame!",
+			want: []string{"La Hilux es 2019.", "Tiene 80 mil km. ¿Te interesa?", "¡Avísame!"},
+		},
+		{
+			name: "list lines keep their breaks",
+			max:  27,
+			msg:  "Opciones:\n- Hilux 2019\n- Corolla 2020\n- Civic 2018",
+			want: []string{"Opciones:\n- Hilux 2019", "- Corolla 2020\n- Civic 2018"},
+		},
+		{
+			name: "no good split point falls back to words",
+			max:  12,
+			msg:  "uno dos tres cuatro cinco seis",
+			want: []string{"uno dos tres", "cuatro cinco", "seis"},
+		},
+		{
+			name: "never cuts a word",
+			max:  5,
+			msg:  "supercalifragilístico ok",
+			want: []string{"supercalifragilístico", "ok"},
+		},
+		{
+			name: "code block kept whole",
+			max:  30,
+			msg:  "Así se hace:\n\n" + code + "\n\nListo.",
+			want: []string{"Así se hace:", code, "Listo."},
+		},
+		{
+			name: "unclosed code block runs to the end",
+			max:  10,
+			msg:  "Mira:\n```\nx := 1\ny := 2",
+			want: []string{"Mira:", "```\nx := 1\ny := 2"},
+		},
+		{
+			name: "counts runes",
+			max:  6,
+			msg:  "ñañaña ñoño",
+			want: []string{"ñañaña", "ñoño"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitBubbles(tt.msg, tt.max)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+				t.Fatalf("splitBubbles() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Partir y volver a unir no pierde palabras
+func TestSplitBubblesKeepsAllWords(t *testing.T) {
+	msg := "Tenemos tres opciones. La primera es una Hilux 2019!\n\nLa segunda, un Corolla… ¿Y la tercera? Un Civic."
+	for max := 5; max <= 120; max += 7 {
+		got := strings.Fields(strings.Join(splitBubbles(msg, max), " "))
+		if want := strings.Fields(msg); strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Fatalf("max %d: words = %q, want %q", max, got, want)
+		}
+	}
+}
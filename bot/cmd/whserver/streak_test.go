@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextStreak(t *testing.T) {
+	lima, err := time.LoadLocation("America/Lima")
+	if err != nil {
+		t.Skipf("tzdata no disponible: %v", err)
+	}
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("tzdata no disponible: %v", err)
+	}
+	tests := []struct {
+		name     string
+		days     int
+		lastDay  string
+		now      time.Time
+		loc      *time.Location
+		wantDays int
+		wantLast string
+	}{
+		{"first message", 0, "", time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC), nil, 1, "2026-03-10"},
+		{"same day", 3, "2026-03-10", time.Date(2026, 3, 10, 23, 59, 0, 0, time.UTC), nil, 3, "2026-03-10"},
+		{"next day", 3, "2026-03-10", time.Date(2026, 3, 11, 0, 1, 0, 0, time.UTC), nil, 4, "2026-03-11"},
+		{"gap day", 3, "2026-03-10", time.Date(2026, 3, 12, 9, 0, 0, 0, time.UTC), nil, 1, "2026-03-12"},
+		{"clock moved back", 3, "2026-03-10", time.Date(2026, 3, 9, 9, 0, 0, 0, time.UTC), nil, 3, "2026-03-10"},
+		{"corrupt last day", 5, "ayer", time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC), nil, 1, "2026-03-10"},
+		{"month boundary", 2, "2026-02-28", time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC), nil, 3, "2026-03-01"},
+		// 03:00 UTC del 11 sigue siendo el 10 en Lima (UTC-5): mismo día, no suma
+		{"user timezone same day", 2, "2026-03-10", time.Date(2026, 3, 11, 3, 0, 0, 0, time.UTC), lima, 2, "2026-03-10"},
+		{"user timezone next day", 2, "2026-03-10", time.Date(2026, 3, 11, 6, 0, 0, 0, time.UTC), lima, 3, "2026-03-11"},
+		// 8 de marzo 2026: NY pasa a horario de verano (día de 23h)
+		{"dst spring forward", 4, "2026-03-07", time.Date(2026, 3, 8, 23, 30, 0, 0, ny), ny, 5, "2026-03-08"},
+		{"after dst spring forward", 5, "2026-03-08", time.Date(2026, 3, 9, 0, 30, 0, 0, ny), ny, 6, "2026-03-09"},
+		// 1 de noviembre 2026: vuelve a horario estándar (día de 25h)
+		{"dst fall back", 4, "2026-10-31", time.Date(2026, 11, 1, 23, 30, 0, 0, ny), ny, 5, "2026-11-01"},
+		{"gap across dst", 4, "2026-10-31", time.Date(2026, 11, 2, 0, 30, 0, 0, ny), ny, 1, "2026-11-02"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			days, last := nextStreak(tt.days, tt.lastDay, tt.now, tt.loc)
+			if days != tt.wantDays || last != tt.wantLast {
+				t.Fatalf("nextStreak = %d, %q; want %d, %q", days, last, tt.wantDays, tt.wantLast)
+			}
+		})
+	}
+}
+
+func TestTouchProfileStreakUsesRouterTimezone(t *testing.T) {
+	r, _ := newTestRouter(t)
+	loc := time.FixedZone("UTC+14", 14*3600)
+	r.streakLoc = loc
+	const chat = "51911000070@s.whatsapp.net"
+	p := r.getOrCreateProfileByKey(chat)
+	yesterday := time.Now().In(loc).AddDate(0, 0, -1).Format(streakDayLayout)
+	r.muProf.Lock()
+	p.Metrics.StreakDays, p.Metrics.StreakLastDay = 2, yesterday
+	r.muProf.Unlock()
+
+	r.touchProfileFromInbound(Envelope{ChatJID: chat, Text: "hola"})
+	r.muProf.Lock()
+	defer r.muProf.Unlock()
+	if p.Metrics.StreakDays != 3 || p.Metrics.StreakLastDay != time.Now().In(loc).Format(streakDayLayout) {
+		t.Fatalf("streak = %d, %q", p.Metrics.StreakDays, p.Metrics.StreakLastDay)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/investigadorinexperto/bot/pkg/tracing"
+)
+
+// inMemoryTracing instala un TracerProvider síncrono con exporter en memoria
+func inMemoryTracing(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	if _, err := tracing.Setup(context.Background(), "", "test"); err != nil {
+		t.Fatal(err)
+	}
+	exporter := tracetest.NewInMemoryExporter()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return exporter
+}
+
+func TestBOBCallSpanTree(t *testing.T) {
+	exporter := inMemoryTracing(t)
+
+	var gotTraceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTraceparent = r.Header.Get("traceparent")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"reply":"hola"}`))
+	}))
+	defer srv.Close()
+
+	// wh.receive → aggregator.flush → bob.call → reply.send, como en main
+	ctx, receive := tracing.Start(context.Background(), "wh.receive")
+	flushCtx, flush := tracing.Start(ctx, "aggregator.flush")
+	res := testBOBBackend(srv.URL).Call(flushCtx, "51911111111", []string{"hola"}, nil, "", jlog{})
+	_, reply := tracing.Start(flushCtx, "reply.send")
+	reply.End()
+	flush.End()
+	receive.End()
+	if res.Text != "hola" {
+		t.Fatalf("reply = %+v", res)
+	}
+
+	byName := map[string]tracetest.SpanStub{}
+	for _, s := range exporter.GetSpans() {
+		byName[s.Name] = s
+	}
+	call, ok := byName["bob.call"]
+	if !ok {
+		t.Fatalf("missing bob.call span (got %d spans)", len(byName))
+	}
+	flushID := byName["aggregator.flush"].SpanContext.SpanID()
+	if call.Parent.SpanID() != flushID || byName["reply.send"].Parent.SpanID() != flushID {
+		t.Fatal("bob.call and reply.send must hang from aggregator.flush")
+	}
+	if byName["aggregator.flush"].Parent.SpanID() != byName["wh.receive"].SpanContext.SpanID() {
+		t.Fatal("aggregator.flush must hang from wh.receive")
+	}
+
+	// el backend recibe la traza con bob.call como padre
+	want := "00-" + call.SpanContext.TraceID().String() + "-" + call.SpanContext.SpanID().String() + "-01"
+	if gotTraceparent != want {
+		t.Fatalf("traceparent = %q, want %q", gotTraceparent, want)
+	}
+}
+
+func TestBOBCallSpanRecordsFailure(t *testing.T) {
+	exporter := inMemoryTracing(t)
+	srv, _ := flakyBackend(t, 1, http.StatusBadRequest)
+
+	testBOBBackend(srv.URL).Call(context.Background(), "51911111111", []string{"hola"}, nil, "", jlog{})
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "bob.call" {
+		t.Fatalf("spans = %+v", spans)
+	}
+	if spans[0].Status.Code != codes.Error || len(spans[0].Events) == 0 {
+		t.Fatalf("status = %+v, events = %d", spans[0].Status, len(spans[0].Events))
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTypingWaitBounds(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     time.Duration
+		perCharM int
+		min, max time.Duration
+		msg      string
+		want     time.Duration
+	}{
+		{"proportional", 100 * time.Millisecond, 10, 0, 0, "hola", 140 * time.Millisecond},
+		{"counts runes not bytes", 0, 10, 0, 0, "¿año?", 50 * time.Millisecond},
+		{"min floor on one word", 0, 10, 800 * time.Millisecond, 5 * time.Second, "ok", 800 * time.Millisecond},
+		{"long reply above min", 0, 10, 800 * time.Millisecond, 5 * time.Second, strings.Repeat("a", 100), time.Second},
+		{"max cap", 0, 10, 800 * time.Millisecond, 2 * time.Second, strings.Repeat("a", 1000), 2 * time.Second},
+		{"max wins over min", 0, 10, 3 * time.Second, 2 * time.Second, "ok", 2 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := newTestRouter(t)
+			r.baseWait, r.perCharMs, r.jitterMs = tt.base, tt.perCharM, 0
+			r.minWait, r.maxWait = tt.min, tt.max
+			if got := r.typingWait(tt.msg); got != tt.want {
+				t.Fatalf("typingWait(%q) = %v, want %v", tt.msg, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplyWithTypingBubbles(t *testing.T) {
+	long := "Tenemos una Toyota Hilux 2019 en subasta el viernes. La base es 15 mil dólares. ¿Quieres que te envíe la ficha completa?"
+	tests := []struct {
+		name      string
+		bubbleMax int
+		msg       string
+		want      []string
+	}{
+		{"short reply one bubble", 80, "¡Hola!", []string{"¡Hola!"}},
+		{"split disabled", 0, long, []string{long}},
+		{"long reply split", 60, long, []string{
+			"Tenemos una Toyota Hilux 2019 en subasta el viernes.",
+			"La base es 15 mil dólares.",
+			"¿Quieres que te envíe la ficha completa?",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, sent := newTestRouter(t)
+			var typing []bool
+			r.typingFn = func(_ string, on bool, _ string) error {
+				typing = append(typing, on)
+				return nil
+			}
+			r.bubbleMax = tt.bubbleMax
+			r.bubblePause = 5 * time.Millisecond
+			r.minWait = 10 * time.Millisecond
+
+			total := r.replyWithTyping(context.Background(), "a", tt.msg)
+			got := sent.all()
+			if len(got) != len(tt.want) {
+				t.Fatalf("sent %d bubbles %q, want %d", len(got), got, len(tt.want))
+			}
+			for i, w := range tt.want {
+				if got[i] != "a|"+w {
+					t.Errorf("bubble %d = %q, want %q", i, got[i], w)
+				}
+			}
+			// "escribiendo" antes de cada burbuja y un apagado al final
+			if len(typing) != len(tt.want)+1 || typing[len(typing)-1] {
+				t.Errorf("typing calls = %v", typing)
+			}
+			// piso por burbuja + pausa entre burbujas
+			n := time.Duration(len(tt.want))
+			if min := n*r.minWait + (n-1)*r.bubblePause; total < min {
+				t.Errorf("total wait = %v, want >= %v", total, min)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mediaTextServer engine + backend falsos: /api/media/download devuelve los bytes del
+// ticket ("url") y /api/chat/transcribe y /api/chat/extract responden texts[bytes]
+func mediaTextServer(t *testing.T, texts map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/media/download":
+			var ticket map[string]any
+			_ = json.NewDecoder(r.Body).Decode(&ticket)
+			url, _ := ticket["url"].(string)
+			if url == "" {
+				http.Error(w, "media expired", http.StatusGone)
+				return
+			}
+			w.Write([]byte(url))
+		case "/api/chat/transcribe", "/api/chat/extract":
+			var body struct {
+				Media struct {
+					Data     string `json:"data"`
+					MimeType string `json:"mimeType"`
+				} `json:"media"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			data, _ := base64.StdEncoding.DecodeString(body.Media.Data)
+			text, ok := texts[r.URL.Path+"|"+body.Media.MimeType+"|"+string(data)]
+			_ = json.NewEncoder(w).Encode(map[string]any{"success": ok, "text": text, "error": "unexpected media"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func inboundVoice(chat, id, ticket string, seconds float64) Envelope {
+	env := inboundText(chat, id, "")
+	env.Media = map[string]any{"type": "audio", "mimetype": "audio/ogg; codecs=opus", "url": ticket, "seconds": seconds}
+	return env
+}
+
+func TestFlushChatTranscribesVoiceNotes(t *testing.T) {
+	const chat = "51911000110@s.whatsapp.net"
+	media := mediaTextServer(t, map[string]string{
+		"/api/chat/transcribe|audio/ogg; codecs=opus|nota-1": "quiero ver la hilux",
+	})
+	r, sent := newTestRouter(t)
+	r.media = newMediaReader(media.URL+"/api/media/download", media.URL+"/api/chat/transcribe", "", 60, 0, time.Second)
+	srv, calls := bobRecorder(t, "¡Claro! Te paso el link.")
+	r.bob = testBOBBackend(srv.URL)
+
+	r.OnMessage(context.Background(), inboundText(chat, "V0", "hola"))
+	r.OnMessage(context.Background(), inboundVoice(chat, "V1", "", 3))         // no se pudo bajar: se omite
+	r.OnMessage(context.Background(), inboundVoice(chat, "V2", "nota-2", 600)) // supera VOICE_MAX_SECONDS
+	r.OnMessage(context.Background(), inboundVoice(chat, "V3", "nota-1", 4))
+	r.flushChat(chat, 4)
+
+	if got, want := <-calls, []string{"hola", "quiero ver la hilux"}; !slices.Equal(got, want) {
+		t.Fatalf("backend messages = %q, want %q", got, want)
+	}
+	if got := sent.all(); len(got) != 1 || !strings.HasSuffix(got[0], "¡Claro! Te paso el link.") {
+		t.Fatalf("sent = %q", got)
+	}
+}
+
+func TestFlushChatVoiceNoteAlone(t *testing.T) {
+	const chat = "51911000111@s.whatsapp.net"
+	media := mediaTextServer(t, map[string]string{
+		"/api/chat/transcribe|audio/ogg; codecs=opus|nota-sola": "¿cuándo es la próxima subasta?",
+	})
+	r, _ := newTestRouter(t)
+	r.media = newMediaReader(media.URL+"/api/media/download", media.URL+"/api/chat/transcribe", "", 0, 0, time.Second)
+	srv, calls := bobRecorder(t, "El sábado.")
+	r.bob = testBOBBackend(srv.URL)
+
+	// el último mensaje es la nota de voz: su transcripción cuenta como texto del turno
+	r.OnMessage(context.Background(), inboundVoice(chat, "S1", "nota-sola", 5))
+	r.flushChat(chat, 1)
+	if got := <-calls; len(got) != 1 || got[0] != "¿cuándo es la próxima subasta?" {
+		t.Fatalf("backend messages = %q", got)
+	}
+}
+
+func TestVoiceNotesIgnoredWithoutTranscriber(t *testing.T) {
+	const chat = "51911000112@s.whatsapp.net"
+	r, _ := newTestRouter(t)
+	r.OnMessage(context.Background(), inboundVoice(chat, "N1", "nota", 5))
+	r.muLast.Lock()
+	defer r.muLast.Unlock()
+	if n := len(r.pendingByChat[chat]); n != 0 {
+		t.Fatalf("voice note queued without a transcriber (%d pending)", n)
+	}
+}
+
+func TestMediaReaderLimitsAndToken(t *testing.T) {
+	prev := engineToken
+	engineToken = "engine-secret"
+	defer func() { engineToken = prev }()
+
+	var auth []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = append(auth, r.Header.Get("Authorization"))
+		if r.URL.Path == "/api/media/download" {
+			w.Write([]byte("0123456789"))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"success": true, "text": "ABC-123"})
+	}))
+	defer srv.Close()
+	m := newMediaReader(srv.URL+"/api/media/download", srv.URL+"/api/chat/transcribe", srv.URL+"/api/chat/extract", 0, 0, time.Second)
+
+	// el cuerpo se corta en el tope: uno más grande no se lee entero
+	if _, _, err := m.download(context.Background(), map[string]any{"url": "x"}, 9); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Fatalf("download over the limit = %v", err)
+	}
+	if data, _, err := m.download(context.Background(), map[string]any{"url": "x"}, 10); err != nil || len(data) != 10 {
+		t.Fatalf("download at the limit = %d bytes, %v", len(data), err)
+	}
+
+	// el backend recibe el mismo token que el engine
+	auth = nil
+	if text, err := m.ExtractText(context.Background(), map[string]any{"url": "x", "mimetype": "image/jpeg"}); err != nil || text != "ABC-123" {
+		t.Fatalf("ExtractText = %q, %v", text, err)
+	}
+	if len(auth) != 2 || auth[0] != "Bearer engine-secret" || auth[1] != "Bearer engine-secret" {
+		t.Fatalf("Authorization headers = %q", auth)
+	}
+}
@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string // APIToken configurado
+		noToken  bool   // AllowNoTokenDev
+		header   string
+		wantCode int
+	}{
+		{"missing header", "tok", false, "", http.StatusUnauthorized},
+		{"wrong token", "tok", false, "Bearer nope", http.StatusUnauthorized},
+		{"not bearer", "tok", false, "tok", http.StatusUnauthorized},
+		{"authorized", "tok", false, "Bearer tok", http.StatusOK},
+		{"no token configured fails closed", "", false, "", http.StatusUnauthorized},
+		{"no token configured, dev bypass", "", true, "", http.StatusOK},
+		{"dev bypass ignored when a token is set", "tok", true, "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Engine{cfg: Config{APIToken: tt.token, AllowNoTokenDev: tt.noToken}}
+			called := false
+			h := e.requireToken(func(w http.ResponseWriter, r *http.Request) { called = true })
+
+			req := httptest.NewRequest(http.MethodGet, "/api/session", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			h(rec, req)
+			if rec.Code != tt.wantCode || called != (tt.wantCode == http.StatusOK) {
+				t.Errorf("code = %d called = %v, want %d", rec.Code, called, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRESTRoutesRequireToken(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) { cfg.APIToken = testAPIToken })
+	h := e.restHandler()
+	for _, path := range []string{"/api/session", "/api/send", "/api/typing", "/api/markread", "/api/unread"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s without token = %d, want 401", path, rec.Code)
+		}
+	}
+	// /healthz y /readyz quedan abiertos para el orquestador
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("/healthz = %d", rec.Code)
+	}
+}
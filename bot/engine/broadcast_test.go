@@ -0,0 +1,127 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestBroadcastOrderRateLimitAndPartialFailure(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) {
+		cfg.RateLimits = DefaultRateLimits()
+		cfg.RateLimits.Send = RateLimit{Every: 20 * time.Millisecond, Burst: 1}
+	})
+	e.conn.markOnline()
+	failing := mustJID(t, "51911000072@s.whatsapp.net")
+
+	var order []string
+	var sentAt []time.Time
+	// como sendTextNow: espera el limiter de envío y luego "envía"
+	send := func(ctx context.Context, to types.JID) (string, error) {
+		return e.EnqueueSend(ctx, &SendJob{To: to, run: func(ctx context.Context) (string, error) {
+			if err := e.limiterSend.Wait(ctx); err != nil {
+				return "", err
+			}
+			order = append(order, to.User)
+			sentAt = append(sentAt, time.Now())
+			if to == failing {
+				return "", errors.New("not on WhatsApp")
+			}
+			return "ID-" + to.User, nil
+		}})
+	}
+
+	recipients := []string{
+		"51911000070", "51911000071@s.whatsapp.net", "",
+		"51911000072", "51911000070", "51911000073",
+	}
+	results := e.Broadcast(context.Background(), recipients, send)
+
+	if len(results) != len(recipients) {
+		t.Fatalf("results = %d, want %d", len(results), len(recipients))
+	}
+	for i, res := range results {
+		if res.Recipient != recipients[i] {
+			t.Fatalf("result %d is for %q, want request order", i, res.Recipient)
+		}
+	}
+	want := []struct {
+		ok bool
+		id string
+	}{{true, "ID-51911000070"}, {true, "ID-51911000071"}, {false, ""}, {false, ""}, {false, ""}, {true, "ID-51911000073"}}
+	for i, w := range want {
+		if results[i].Success != w.ok || results[i].MessageID != w.id || (!w.ok && results[i].Error == "") {
+			t.Errorf("result %d = %+v", i, results[i])
+		}
+	}
+	if results[4].Error != "duplicate recipient" || results[3].Error != "not on WhatsApp" {
+		t.Fatalf("errors = %q, %q", results[3].Error, results[4].Error)
+	}
+
+	// solo los válidos llegan al envío, en orden y al ritmo del limiter
+	if got := len(order); got != 4 || order[0] != "51911000070" || order[3] != "51911000073" {
+		t.Fatalf("send order = %v", order)
+	}
+	for i := 1; i < len(sentAt); i++ {
+		if gap := sentAt[i].Sub(sentAt[i-1]); gap < 15*time.Millisecond {
+			t.Fatalf("send %d only %s after the previous one (limiter every 20ms)", i, gap)
+		}
+	}
+}
+
+func TestBroadcastStopsOnCancel(t *testing.T) {
+	e := newTestEngine(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	send := func(ctx context.Context, to types.JID) (string, error) {
+		calls++
+		cancel() // se cancela a mitad del broadcast
+		return "ID1", nil
+	}
+	results := e.Broadcast(ctx, []string{"51911000074", "51911000075", "51911000076"}, send)
+	if calls != 1 || !results[0].Success {
+		t.Fatalf("calls = %d, first = %+v", calls, results[0])
+	}
+	for _, res := range results[1:] {
+		if res.Success || res.Error == "" {
+			t.Fatalf("pending recipient reported as %+v", res)
+		}
+	}
+}
+
+func TestRESTBroadcastDryRun(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) { cfg.APIToken = testAPIToken })
+
+	// dry-run no necesita conexión ni envía nada
+	rec := serveREST(e, http.MethodPost, "/api/broadcast", `{"recipients":["51911000077",""],"message":"Nueva subasta","dry_run":true}`, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("dry run = %d %s", rec.Code, rec.Body.String())
+	}
+	var body struct {
+		Results []BroadcastResult `json:"results"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Results) != 2 || !body.Results[0].Success || body.Results[0].MessageID != "" || body.Results[1].Success {
+		t.Fatalf("results = %+v", body.Results)
+	}
+
+	for name, payload := range map[string]string{
+		"no recipients":   `{"recipients":[],"message":"hola"}`,
+		"no content":      `{"recipients":["51911000077"]}`,
+		"exclusive media": `{"recipients":["51911000077"],"media_path":"a.jpg","media_url":"https://x/a.jpg"}`,
+	} {
+		if rec := serveREST(e, http.MethodPost, "/api/broadcast", payload, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s = %d, want 400", name, rec.Code)
+		}
+	}
+	if rec := serveREST(e, http.MethodPost, "/api/broadcast", `{"recipients":["51911000077"],"message":"hola"}`, nil); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("real send while offline = %d, want 503", rec.Code)
+	}
+}
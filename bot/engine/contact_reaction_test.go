@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func inboundMessage(chat types.JID, id string, m *waProto.Message) *events.Message {
+	return &events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: chat, Sender: chat},
+			ID:            id,
+			Timestamp:     time.Now(),
+		},
+		Message: m,
+	}
+}
+
+func TestHandleEventContactAndReactionEnvelopes(t *testing.T) {
+	chat := mustJID(t, "51911222333@s.whatsapp.net")
+	vcard := "BEGIN:VCARD\nVERSION:3.0\nFN:Ana Ruiz\nTEL:+51911000111\nEND:VCARD"
+
+	tests := []struct {
+		name  string
+		msg   *waProto.Message
+		check func(t *testing.T, env ForwardEnvelope)
+	}{
+		{
+			name: "contact",
+			msg: &waProto.Message{ContactMessage: &waProto.ContactMessage{
+				DisplayName: proto.String("Ana Ruiz"),
+				Vcard:       proto.String(vcard),
+			}},
+			check: func(t *testing.T, env ForwardEnvelope) {
+				if env.EventType != "contact" || env.Direction != "in" || env.Text != "Ana Ruiz" {
+					t.Errorf("envelope = %+v", env)
+				}
+				if len(env.Contacts) != 1 || env.Contacts[0]["display_name"] != "Ana Ruiz" || env.Contacts[0]["vcard"] != vcard {
+					t.Errorf("contacts = %v", env.Contacts)
+				}
+			},
+		},
+		{
+			name: "contacts array",
+			msg: &waProto.Message{ContactsArrayMessage: &waProto.ContactsArrayMessage{Contacts: []*waProto.ContactMessage{
+				{DisplayName: proto.String("Ana"), Vcard: proto.String("A")},
+				{DisplayName: proto.String("Luis"), Vcard: proto.String("L")},
+			}}},
+			check: func(t *testing.T, env ForwardEnvelope) {
+				if env.EventType != "contact" || len(env.Contacts) != 2 || env.Text != "Ana, Luis" {
+					t.Errorf("envelope = %+v", env)
+				}
+			},
+		},
+		{
+			name: "reaction",
+			msg: &waProto.Message{ReactionMessage: &waProto.ReactionMessage{
+				Key:  &waProto.MessageKey{RemoteJID: proto.String(chat.String()), FromMe: proto.Bool(true), ID: proto.String("OUT42")},
+				Text: proto.String("👍"),
+			}},
+			check: func(t *testing.T, env ForwardEnvelope) {
+				if env.EventType != "reaction" || env.Direction != "in" || env.Text != "👍" {
+					t.Errorf("envelope = %+v", env)
+				}
+				r := env.Reaction
+				if r["emoji"] != "👍" || r["target_id"] != "OUT42" || r["target_from_me"] != true || r["removed"] != false {
+					t.Errorf("reaction = %v", r)
+				}
+			},
+		},
+		{
+			name: "reaction removed",
+			msg: &waProto.Message{ReactionMessage: &waProto.ReactionMessage{
+				Key:  &waProto.MessageKey{RemoteJID: proto.String(chat.String()), ID: proto.String("OUT42")},
+				Text: proto.String(""),
+			}},
+			check: func(t *testing.T, env ForwardEnvelope) {
+				if env.EventType != "reaction" || env.Reaction["removed"] != true {
+					t.Errorf("envelope = %+v", env)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEngine(t, nil)
+			knownName(e, chat, "Cliente")
+			e.handleEvent(context.Background(), Handlers{}, inboundMessage(chat, "M1", tt.msg))
+
+			envs := outboxEnvelopes(t, e, "contacts", sanitizePathPart(chat.String())+".ndjson")
+			if len(envs) != 1 {
+				t.Fatalf("got %d envelopes, want 1", len(envs))
+			}
+			if envs[0].ChatJID != chat.String() || envs[0].MessageID != "M1" {
+				t.Errorf("chat/id = %s/%s", envs[0].ChatJID, envs[0].MessageID)
+			}
+			tt.check(t, envs[0])
+		})
+	}
+}
+
+func TestReactionsAreNotStoredAsMessages(t *testing.T) {
+	e := newTestEngine(t, nil)
+	chat := mustJID(t, "51911222333@s.whatsapp.net")
+	knownName(e, chat, "Cliente")
+	e.handleEvent(context.Background(), Handlers{}, inboundMessage(chat, "R1", &waProto.Message{ReactionMessage: &waProto.ReactionMessage{
+		Key: &waProto.MessageKey{ID: proto.String("X")}, Text: proto.String("❤️"),
+	}}))
+	msgs, err := e.msgStore.GetRecentMessages(chat.String(), 10, time.Time{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 0 {
+		t.Errorf("stored %d messages for a reaction, want 0", len(msgs))
+	}
+}
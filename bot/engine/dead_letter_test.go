@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// deadLetters registros de la cola de muertos (vacío si el archivo no existe)
+func deadLetters(t *testing.T, e *Engine) []DeadLetter {
+	t.Helper()
+	path := filepath.Join(e.fileSink.base, deadCategory, hostID()+".ndjson")
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	var out []DeadLetter
+	for _, l := range readLines(t, path) {
+		var d DeadLetter
+		if err := json.Unmarshal([]byte(l), &d); err != nil {
+			t.Fatalf("invalid dead-letter line %q: %v", l, err)
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+func TestWebhookFailureLandsInDeadLetter(t *testing.T) {
+	hook, srv := newWebhookRecorder(t, http.StatusInternalServerError)
+	e := newTestEngine(t, withWebhook(srv.URL))
+
+	e.sendEnvelopeToWebhook(context.Background(), &ForwardEnvelope{EventType: "message", ChatJID: "51911000030@s.whatsapp.net", MessageID: "DEAD1", Text: "hola"})
+
+	// 3 intentos con backoff (250+500+1000ms) antes de rendirse
+	deadline := time.Now().Add(10 * time.Second)
+	for len(deadLetters(t, e)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("envelope never reached the dead-letter file")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	dl := deadLetters(t, e)
+	if len(dl) != 1 || dl[0].Attempts != webhookAttempts || dl[0].Reason != "webhook non-2xx: 500" || dl[0].DeadAt == "" {
+		t.Fatalf("dead letters = %+v", dl)
+	}
+	var env ForwardEnvelope
+	if err := json.Unmarshal(dl[0].Envelope, &env); err != nil || env.MessageID != "DEAD1" || env.Text != "hola" {
+		t.Fatalf("stored envelope = %s (%v)", dl[0].Envelope, err)
+	}
+	if got := len(hook.ids()); got != webhookAttempts {
+		t.Fatalf("webhook hit %d times, want %d", got, webhookAttempts)
+	}
+}
+
+func TestReplayDead(t *testing.T) {
+	hook, srv := newWebhookRecorder(t, http.StatusOK)
+	e := newTestEngine(t, withWebhook(srv.URL))
+	for _, id := range []string{"D1", "D2"} {
+		b, _ := json.Marshal(ForwardEnvelope{EventType: "message", MessageID: id})
+		e.deadLetter(b, errWebhookTest, webhookAttempts)
+	}
+
+	res, err := e.ReplayDead(context.Background(), ReplayOptions{DryRun: true})
+	if err != nil || res.Matched != 2 || res.Sent != 0 || len(deadLetters(t, e)) != 2 {
+		t.Fatalf("dry run = %+v, %v", res, err)
+	}
+
+	res, err = e.ReplayDead(context.Background(), ReplayOptions{Every: time.Millisecond})
+	if err != nil || res.Sent != 2 || res.Failed != 0 {
+		t.Fatalf("replay = %+v, %v", res, err)
+	}
+	if got := hook.ids(); len(got) != 2 || got[0] != "D1" || got[1] != "D2" || hook.replayed != 2 {
+		t.Fatalf("webhook got %v (replayed %d)", got, hook.replayed)
+	}
+	if left := deadLetters(t, e); len(left) != 0 {
+		t.Fatalf("dead letters left after replay: %+v", left)
+	}
+}
+
+func TestReplayDeadRequeuesFailuresWithAttempts(t *testing.T) {
+	_, srv := newWebhookRecorder(t, http.StatusBadGateway)
+	e := newTestEngine(t, withWebhook(srv.URL))
+	b, _ := json.Marshal(ForwardEnvelope{EventType: "message", MessageID: "D3"})
+	e.deadLetter(b, errWebhookTest, webhookAttempts)
+
+	res, err := e.ReplayDead(context.Background(), ReplayOptions{Every: time.Millisecond})
+	if err != nil || res.Failed != 1 || res.Sent != 0 {
+		t.Fatalf("replay = %+v, %v", res, err)
+	}
+	dl := deadLetters(t, e)
+	if len(dl) != 1 || dl[0].Attempts != 2*webhookAttempts || dl[0].Reason != "webhook non-2xx: 502" {
+		t.Fatalf("dead letters = %+v", dl)
+	}
+}
+
+var errWebhookTest = errors.New("webhook non-2xx: 500")
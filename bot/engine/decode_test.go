@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSONBody(t *testing.T) {
+	type payload struct {
+		Recipient string `json:"recipient"`
+		Message   string `json:"message"`
+	}
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{"valid", `{"recipient":"51900000001","message":"hola"}`, ""},
+		{"unknown field", `{"recipient":"51900000001","mesage":"hola"}`, `unknown field "mesage"`},
+		{"oversized", `{"message":"` + strings.Repeat("x", 200) + `"}`, "body exceeds 64 bytes"},
+		{"empty", ``, "empty body"},
+		{"trailing data", `{"message":"a"} {"message":"b"}`, "unexpected data after json object"},
+		{"malformed", `{"message":`, "invalid json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Engine{cfg: Config{RESTBodyLimit: 64}}
+			var dst payload
+			req := httptest.NewRequest(http.MethodPost, "/api/send", strings.NewReader(tt.body))
+			err := e.decodeJSONBody(httptest.NewRecorder(), req, &dst)
+			if tt.wantErr == "" {
+				if err != nil || dst.Message != "hola" {
+					t.Fatalf("err = %v, dst = %+v", err, dst)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRESTRejectsBadBodies(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) {
+		cfg.APIToken = testAPIToken
+		cfg.RESTBodyLimit = 128
+	})
+	e.conn.markOnline()
+	if rec := serveREST(e, http.MethodPost, "/api/typing", `{"recipient":"51900000001","typing":true,"extra":1}`, nil); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "unknown field") {
+		t.Errorf("unknown field = %d %s", rec.Code, rec.Body.String())
+	}
+	big := `{"recipient":"51900000001","typing":true,"x":"` + strings.Repeat("x", 500) + `"}`
+	if rec := serveREST(e, http.MethodPost, "/api/typing", big, nil); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "body exceeds") {
+		t.Errorf("oversized = %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestMediaBodyLimit(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want int64
+	}{
+		{"default media cap", Config{}, int64(base64.StdEncoding.EncodedLen(16<<20)) + 64<<10},
+		{"custom media cap", Config{MaxMediaBytes: 3000, RESTBodyLimit: 128}, 4000 + 64<<10},
+		{"default rest limit is larger", Config{MaxMediaBytes: 3000}, 1 << 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Engine{cfg: tt.cfg}
+			if got := e.mediaBodyLimit(); got != tt.want {
+				t.Fatalf("mediaBodyLimit() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRESTSendAcceptsMediaB64AboveRESTLimit(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) {
+		cfg.APIToken = testAPIToken
+		cfg.RESTBodyLimit = 128
+		cfg.MaxMediaBytes = 1024
+	})
+	e.conn.markOnline()
+	// el body pasa el tope (128 B < media en base64) y recién el tope de media lo rechaza
+	b64 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0xAB}, 1500))
+	body := `{"recipient":"51900000001","media_b64":"` + b64 + `"}`
+	rec := serveREST(e, http.MethodPost, "/api/send", body, nil)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "media exceeds 1024 bytes") {
+		t.Fatalf("media_b64 = %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRESTRecipientParsingShared(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) { cfg.APIToken = testAPIToken })
+	e.conn.markOnline()
+	for path, body := range map[string]string{
+		"/api/send":     `{"recipient":"","message":"hola"}`,
+		"/api/typing":   `{"recipient":"","typing":true}`,
+		"/api/markread": `{"recipient":"","message_ids":["A1"]}`,
+	} {
+		rec := serveREST(e, http.MethodPost, path, body, nil)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "recipient required") {
+			t.Errorf("%s = %d %s", path, rec.Code, rec.Body.String())
+		}
+	}
+	rec := serveREST(e, http.MethodPost, "/api/markread", `{"recipient":"51900000001","sender":"1:2:3@s.whatsapp.net","message_ids":["A1"]}`, nil)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "bad sender jid") {
+		t.Errorf("bad sender = %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,162 @@
+package engine
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/investigadorinexperto/bot/pkg/metrics"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestEditAndRevokeProto(t *testing.T) {
+	chat := types.NewJID("51911222333", types.DefaultUserServer)
+	e := &Engine{} // BuildEdit/BuildRevoke no necesitan conexión
+
+	edit := e.client.BuildEdit(chat, "OUT1", &waProto.Message{Conversation: proto.String("precio corregido: $18,500")})
+	pm := edit.GetEditedMessage().GetMessage().GetProtocolMessage()
+	if pm.GetType() != waProto.ProtocolMessage_MESSAGE_EDIT || pm.GetKey().GetID() != "OUT1" || !pm.GetKey().GetFromMe() {
+		t.Fatalf("edit protocol = %v", pm)
+	}
+	if pm.GetEditedMessage().GetConversation() != "precio corregido: $18,500" {
+		t.Fatalf("edited text = %q", pm.GetEditedMessage().GetConversation())
+	}
+
+	revoke := e.client.BuildRevoke(chat, types.EmptyJID, "OUT1")
+	pm = revoke.GetProtocolMessage()
+	if pm.GetType() != waProto.ProtocolMessage_REVOKE || pm.GetKey().GetID() != "OUT1" || pm.GetKey().GetRemoteJID() != chat.String() || !pm.GetKey().GetFromMe() {
+		t.Fatalf("revoke protocol = %v", pm)
+	}
+}
+
+func TestOwnMessageCheck(t *testing.T) {
+	e := newTestEngine(t, nil)
+	chat := mustJID(t, "51911222333@s.whatsapp.net")
+	now := time.Now()
+	if err := e.msgStore.SaveMessage(chat.String(), "OUT1", "me", "hola", now, true, sql.NullString{}, sql.NullString{}, sql.NullString{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.msgStore.SaveMessage(chat.String(), "IN1", chat.String(), "buenas", now, false, sql.NullString{}, sql.NullString{}, sql.NullString{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		id       string
+		wantErr  string
+		notFound bool
+	}{
+		{"own message", "OUT1", "", false},
+		{"empty id", " ", "message id required", false},
+		{"unknown id", "NOPE", "message not found: NOPE in " + chat.String(), true},
+		{"customer message", "IN1", "was not sent by us", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := e.ownMessageCheck(chat, tt.id)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("err = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) || errors.Is(err, ErrMessageNotFound) != tt.notFound {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRESTRevokeAndEditUnknownMessage(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) { cfg.APIToken = testAPIToken })
+	for _, tt := range []struct{ path, body string }{
+		{"/api/revoke", `{"recipient":"51911222333","message_id":"NOPE"}`},
+		{"/api/edit", `{"recipient":"51911222333","message_id":"NOPE","message":"x"}`},
+	} {
+		rec := serveREST(e, http.MethodPost, tt.path, tt.body, nil)
+		if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "message not found: NOPE") {
+			t.Errorf("%s = %d %s", tt.path, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestEditAndRevokeKeepStoreAndOutboxConsistent(t *testing.T) {
+	e := newTestEngine(t, nil)
+	chat := mustJID(t, "51911222333@s.whatsapp.net")
+	knownName(e, chat, "Cliente Hilux")
+	if err := e.msgStore.SaveMessage(chat.String(), "OUT1", "me", "precio: $18,000", time.Now(), true, sql.NullString{}, sql.NullString{}, sql.NullString{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.msgStore.UpdateMessageContent(chat.String(), "OUT1", "precio: $18,500"); err != nil {
+		t.Fatal(err)
+	}
+	e.forwardOutgoingProtocol(chat, "message_edit", "OUT1", "precio: $18,500")
+	msgs, _ := e.msgStore.GetRecentMessages(chat.String(), 10, time.Time{}, "")
+	if len(msgs) != 1 || msgs[0]["content"] != "precio: $18,500" {
+		t.Fatalf("after edit = %v", msgs)
+	}
+
+	if err := e.msgStore.MarkRevoked(chat.String(), "OUT1"); err != nil {
+		t.Fatal(err)
+	}
+	e.forwardOutgoingProtocol(chat, "message_revoke", "OUT1", "")
+	msgs, _ = e.msgStore.GetRecentMessages(chat.String(), 10, time.Time{}, "")
+	if len(msgs) != 1 || msgs[0]["content"] != "" || msgs[0]["media_type"] != "revoked" {
+		t.Fatalf("after revoke = %v", msgs)
+	}
+
+	envs := outboxEnvelopes(t, e, "contacts", sanitizePathPart(chat.String())+".ndjson")
+	if len(envs) != 2 {
+		t.Fatalf("got %d envelopes, want 2", len(envs))
+	}
+	if envs[0].EventType != "message_edit" || envs[0].Direction != "out" || envs[0].MessageID != "OUT1" || envs[0].Text != "precio: $18,500" {
+		t.Errorf("edit envelope = %+v", envs[0])
+	}
+	if envs[1].EventType != "message_revoke" || envs[1].MessageID != "OUT1" || envs[1].Text != "" {
+		t.Errorf("revoke envelope = %+v", envs[1])
+	}
+}
+
+// outgoingMessages contador whatsbot_messages_total{component=engine,direction=out}
+func outgoingMessages(t *testing.T) float64 {
+	t.Helper()
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range families {
+		if mf.GetName() != "whatsbot_messages_total" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			labels := map[string]string{}
+			for _, lp := range m.GetLabel() {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+			if labels["component"] == metrics.ComponentEngine && labels["direction"] == metrics.DirectionOut {
+				return m.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestOutgoingReactionAndProtocolCounted(t *testing.T) {
+	e := newTestEngine(t, nil)
+	chat := mustJID(t, "51911222334@s.whatsapp.net")
+	knownName(e, chat, "Cliente Hilux")
+
+	before := outgoingMessages(t)
+	e.forwardOutgoingReaction(chat, "R1", map[string]any{"emoji": "👍", "target_id": "IN1"})
+	e.forwardOutgoingProtocol(chat, "message_edit", "OUT1", "precio: $18,500")
+	e.forwardOutgoingProtocol(chat, "message_revoke", "OUT1", "")
+	if got := outgoingMessages(t) - before; got != 3 {
+		t.Fatalf("outgoing messages counted = %v, want 3", got)
+	}
+}
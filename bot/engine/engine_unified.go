@@ -2,29 +2,37 @@
 package engine
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/hmac"
-	"crypto/sha256"
 	"database/sql"
 	"encoding/base64"
 	"encoding/binary"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"math"
 	"math/rand"
 	"mime"
+	"net"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"os/signal"
+	"path"
 	"path/filepath"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
+	"unicode"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/mdp/qrterminal"
@@ -35,11 +43,16 @@ import (
 	// WhatsMeow core
 	wm "go.mau.fi/whatsmeow"
 	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/proto/waHistorySync"
 	"go.mau.fi/whatsmeow/store/sqlstore"
 	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
 	waLog "go.mau.fi/whatsmeow/util/log"
 
+	"github.com/investigadorinexperto/bot/pkg/metrics"
+	"github.com/investigadorinexperto/bot/pkg/typing"
+	"github.com/investigadorinexperto/bot/pkg/webhooksig"
+
 	"google.golang.org/protobuf/proto"
 )
 
@@ -69,6 +82,10 @@ type ForwardingConfig struct {
 	Mode         ForwardMode
 	ContextDepth int // mantenido por compatibilidad (no se incluye en NDJSON)
 	OutFolder    string
+	MaxFileBytes int64 // rotación de NDJSON por tamaño (0 = sin rotar, append infinito)
+	GzipRotated  bool  // comprime cada .partN rotado a .partN.gz
+	RetainParts  int   // máximo de partes rotadas a conservar (0 = todas)
+	FsyncWrites  bool  // fsync tras cada línea (más lento, no se pierde nada ante un crash)
 	ExtraParams  map[string]any
 	Webhook      WebhookConfig
 }
@@ -80,6 +97,52 @@ type WebhookConfig struct {
 	Headers map[string]string
 }
 
+// ===== Rate limits (por cuenta: algunos números toleran menos ráfaga) =====
+type RateLimit struct {
+	Every time.Duration // intervalo mínimo entre envíos
+	Burst int
+}
+
+type RateLimits struct {
+	Send   RateLimit
+	Media  RateLimit
+	Status RateLimit
+}
+
+func DefaultRateLimits() RateLimits {
+	return RateLimits{
+		Send:   RateLimit{Every: 50 * time.Millisecond, Burst: 5},
+		Media:  RateLimit{Every: 150 * time.Millisecond, Burst: 2},
+		Status: RateLimit{Every: 500 * time.Millisecond, Burst: 1},
+	}
+}
+
+// withDefaults completa los limiters no configurados (cero) con los valores por defecto
+func (rl RateLimits) withDefaults() RateLimits {
+	def := DefaultRateLimits()
+	if rl.Send == (RateLimit{}) {
+		rl.Send = def.Send
+	}
+	if rl.Media == (RateLimit{}) {
+		rl.Media = def.Media
+	}
+	if rl.Status == (RateLimit{}) {
+		rl.Status = def.Status
+	}
+	return rl
+}
+
+func (rl RateLimits) validate() error {
+	for name, l := range map[string]RateLimit{"send": rl.Send, "media": rl.Media, "status": rl.Status} {
+		if l.Every <= 0 || l.Burst <= 0 {
+			return fmt.Errorf("invalid %s rate limit: every=%s burst=%d", name, l.Every, l.Burst)
+		}
+	}
+	return nil
+}
+
+func (l RateLimit) limiter() *rate.Limiter { return rate.NewLimiter(rate.Every(l.Every), l.Burst) }
+
 type Config struct {
 	DBPath             string
 	MsgDBPath          string
@@ -87,7 +150,32 @@ type Config struct {
 	BackupEvery        time.Duration
 	MaxConnAttempts    int
 	ReconnectBaseDelay time.Duration
+	ReconnectMaxDelay  time.Duration // tope del backoff exponencial (0 = 60s)
 	HTTPPort           int
+	RateLimits         RateLimits
+	SendQueueSize      int           // capacidad por prioridad de la cola de salida (0 = 256)
+	AdminSecret        string        // X-Engine-Admin-Secret para /api/logout (vacío = deshabilitado)
+	APIToken           string        // Bearer requerido en /api/* del REST
+	AllowNoTokenDev    bool          // permite /api/* sin token si APIToken está vacío (solo dev)
+	RESTBodyLimit      int64         // tope de body en /api/* (0 = 1 MiB); /api/send admite media_b64 de hasta MaxMediaBytes
+	MediaBaseDir       string        // única carpeta desde la que /api/send puede leer media_path
+	MaxMediaBytes      int64         // tope de media a enviar (0 = 16 MiB)
+	MediaFetchTimeout  time.Duration // timeout de descarga para media_url (0 = 15s)
+	MsgRetention       time.Duration // antigüedad máxima de los mensajes guardados (0 = sin poda)
+	MsgPruneEvery      time.Duration // cada cuánto corre la poda si hay retención (0 = 24h)
+	HistoryMaxPerChat  int           // mensajes más recientes a importar por chat en un HistorySync (0 = todos, <0 = no importar)
+	ChatNameTTL        time.Duration // caché de nombres de grupos/contactos (0 = 10m, <0 = sin caché)
+	PresenceMode       string        // available|unavailable al conectar (vacío = available)
+	PresenceAwayAfter  time.Duration // sin envíos durante este tiempo pasa a unavailable (0 = off)
+	Typing             typing.Timing // duración del "escribiendo" de /api/send con simulate_typing
+	ScheduleTick       time.Duration // cada cuánto se revisan los mensajes programados (0 = 5s)
+	QuietHours         string        // horario de silencio "HH:MM-HH:MM" (vacío = sin horario)
+	QuietTimezone      string        // zona IANA del horario de silencio (vacío = hora local)
+	QuietMode          string        // defer|drop: qué pasa con un envío en horario de silencio (vacío = defer; solo se difiere texto, media y ubicaciones se rechazan)
+	QuietReplyWindow   time.Duration // si el contacto escribió hace menos de esto, se responde igual (0 = nunca)
+
+	// RecipientLocation zona horaria propia del destinatario (nil o resultado nil = QuietTimezone)
+	RecipientLocation func(to types.JID) *time.Location
 
 	Forward ForwardingConfig
 }
@@ -102,6 +190,21 @@ type Engine struct {
 	limiterSend  *rate.Limiter
 	limiterMedia *rate.Limiter
 	limiterStat  *rate.Limiter
+	sendQ        *sendQueue
+	conn         *connState
+	lastEventAt  atomic.Int64              // unix nanos del último evento de whatsmeow
+	clientRef    atomic.Pointer[wm.Client] // e.client visible para REST antes de conectar
+	historyMu    sync.Mutex                // un HistorySync a la vez (llegan en varios chunks)
+	names        *nameCache                // nombres de grupos/contactos ya resueltos
+	presence     *presenceState
+	quiet        *quietHours // nil = sin horario de silencio
+
+	// clientConnected estado del socket de whatsmeow (reemplazable en tests, sin red)
+	clientConnected func() bool
+	// chatPresence "escribiendo"/pausa en un chat (reemplazable en tests, sin red)
+	chatPresence func(ctx context.Context, chat types.JID, state types.ChatPresence, media types.ChatPresenceMedia) error
+	// mediaHTTP cliente de media_url; sólo marca IPs públicas (reemplazable en tests)
+	mediaHTTP *http.Client
 
 	fileSink *FlatSink
 }
@@ -120,17 +223,33 @@ type Store interface {
 	RunBackup(ctx context.Context) error
 }
 
+// Parámetros de conexión del MessageStore (go-sqlite3 los aplica en cada conexión del pool):
+//   - WAL: las lecturas no bloquean la escritura y viceversa (IN/OUT concurrentes)
+//   - busy_timeout: un escritor espera el lock hasta 5s en vez de fallar con "database is locked"
+//   - txlock=immediate: las transacciones toman el lock de escritura al empezar (sin upgrade que choque)
+//   - auto_vacuum=incremental: solo aplica a bases nuevas; las existentes se convierten en la primera poda
+//   - synchronous=NORMAL: seguro con WAL y bastante más rápido que FULL
+const msgStoreDSNParams = "?_foreign_keys=on&_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate&_auto_vacuum=incremental&_synchronous=NORMAL"
+
+// SQLite admite un solo escritor: pocas conexiones (lecturas en paralelo) y el resto espera en el pool
+const msgStoreMaxConns = 4
+
 // Implementación simple de mensajes (historial)
-type MessageStore struct{ db *sql.DB }
+type MessageStore struct {
+	db  *sql.DB
+	fts bool // messages_fts disponible (go-sqlite3 compilado con -tags sqlite_fts5); si no, LIKE
+}
 
 func NewMessageStore(path string) (*MessageStore, error) {
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return nil, fmt.Errorf("create store dir: %w", err)
 	}
-	db, err := sql.Open("sqlite3", "file:"+path+"?_foreign_keys=on")
+	db, err := sql.Open("sqlite3", "file:"+path+msgStoreDSNParams)
 	if err != nil {
 		return nil, err
 	}
+	db.SetMaxOpenConns(msgStoreMaxConns)
+	db.SetMaxIdleConns(msgStoreMaxConns)
 	_, err = db.Exec(`
 	CREATE TABLE IF NOT EXISTS chats (
 		jid TEXT PRIMARY KEY,
@@ -154,12 +273,86 @@ func NewMessageStore(path string) (*MessageStore, error) {
 		PRIMARY KEY (id, chat_jid),
 		FOREIGN KEY (chat_jid) REFERENCES chats(jid)
 	);
+	CREATE TABLE IF NOT EXISTS receipts (
+		chat_jid TEXT,
+		message_id TEXT,
+		receipt_type TEXT,
+		sender TEXT,
+		from_me BOOLEAN,
+		timestamp TIMESTAMP,
+		PRIMARY KEY (chat_jid, message_id, receipt_type, from_me)
+	);
+	CREATE TABLE IF NOT EXISTS scheduled_messages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		recipient TEXT NOT NULL,
+		message TEXT NOT NULL,
+		send_at INTEGER NOT NULL,
+		created_at INTEGER NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		message_id TEXT,
+		error TEXT,
+		sent_at INTEGER
+	);
+	CREATE INDEX IF NOT EXISTS scheduled_messages_due ON scheduled_messages (status, send_at);
 	`)
 	if err != nil {
 		_ = db.Close()
 		return nil, err
 	}
-	return &MessageStore{db: db}, nil
+	s := &MessageStore{db: db}
+	s.fts = s.ensureFTS() == nil
+	return s, nil
+}
+
+// ensureFTS crea el índice FTS5 del contenido y los triggers que lo mantienen.
+// Error (típicamente "no such module: fts5") = la búsqueda usa LIKE; en ese caso se
+// quitan los triggers de un arranque anterior con FTS5 para no romper los INSERT.
+// Si faltaba algún trigger el índice se reconstruye desde messages.
+// El trigger de INSERT borra antes la fila previa: SaveMessage usa INSERT OR REPLACE,
+// que no dispara los triggers de DELETE.
+func (s *MessageStore) ensureFTS() error {
+	_, err := s.db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(chat_jid UNINDEXED, id UNINDEXED, content)`)
+	if err == nil {
+		_, err = s.db.Exec(`SELECT 1 FROM messages_fts LIMIT 1`)
+	}
+	if err != nil {
+		_, _ = s.db.Exec(`
+		DROP TRIGGER IF EXISTS messages_fts_ai;
+		DROP TRIGGER IF EXISTS messages_fts_au;
+		DROP TRIGGER IF EXISTS messages_fts_ad;`)
+		return err
+	}
+
+	var triggers int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'messages_fts_%'`).Scan(&triggers); err != nil {
+		return err
+	}
+	if triggers == 3 {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.Exec(`
+	CREATE TRIGGER IF NOT EXISTS messages_fts_ai AFTER INSERT ON messages BEGIN
+		DELETE FROM messages_fts WHERE chat_jid = new.chat_jid AND id = new.id;
+		INSERT INTO messages_fts (chat_jid, id, content) VALUES (new.chat_jid, new.id, new.content);
+	END;
+	CREATE TRIGGER IF NOT EXISTS messages_fts_au AFTER UPDATE OF content ON messages BEGIN
+		DELETE FROM messages_fts WHERE chat_jid = old.chat_jid AND id = old.id;
+		INSERT INTO messages_fts (chat_jid, id, content) VALUES (new.chat_jid, new.id, new.content);
+	END;
+	CREATE TRIGGER IF NOT EXISTS messages_fts_ad AFTER DELETE ON messages BEGIN
+		DELETE FROM messages_fts WHERE chat_jid = old.chat_jid AND id = old.id;
+	END;
+	DELETE FROM messages_fts;
+	INSERT INTO messages_fts (chat_jid, id, content) SELECT chat_jid, id, content FROM messages;
+	`); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 func b64(b []byte) string {
 	if len(b) == 0 {
@@ -172,8 +365,227 @@ func (s *MessageStore) ensureChat(jid string) error {
 	return err
 }
 
+// PruneMessages borra los mensajes anteriores a olderThan, los acuses de esa época y
+// los chats que quedan sin mensajes (en ese orden: messages referencia a chats).
+// El índice FTS se limpia con su trigger de DELETE. Si borró algo compacta el archivo.
+// Devuelve cuántos mensajes borró.
+func (s *MessageStore) PruneMessages(olderThan time.Time) (int, error) {
+	// los TIMESTAMP se guardan como texto con la zona de cada time.Time: se comparan en
+	// segundos unix (UTC) para que filas con otro offset no queden fuera de orden
+	cutoff := olderThan.Unix()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`DELETE FROM messages WHERE CAST(strftime('%s', timestamp) AS INTEGER) < ?`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("prune messages: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	if _, err := tx.Exec(`DELETE FROM receipts WHERE CAST(strftime('%s', timestamp) AS INTEGER) < ?`, cutoff); err != nil {
+		return 0, fmt.Errorf("prune receipts: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM chats WHERE NOT EXISTS (SELECT 1 FROM messages m WHERE m.chat_jid = chats.jid)`); err != nil {
+		return 0, fmt.Errorf("prune chats: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	if n > 0 {
+		if err := s.vacuum(); err != nil {
+			return int(n), fmt.Errorf("vacuum: %w", err)
+		}
+	}
+	return int(n), nil
+}
+
+// vacuum devuelve al disco las páginas libres. La primera vez pasa la base a
+// auto_vacuum=INCREMENTAL con un VACUUM completo; después basta incremental_vacuum.
+// Todo en la misma conexión: el cambio de auto_vacuum solo aplica al VACUUM de esa conexión.
+func (s *MessageStore) vacuum() error {
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var mode int
+	if err := conn.QueryRowContext(ctx, `PRAGMA auto_vacuum`).Scan(&mode); err != nil {
+		return err
+	}
+	if mode == 2 { // INCREMENTAL
+		_, err = conn.ExecContext(ctx, `PRAGMA incremental_vacuum`)
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, `PRAGMA auto_vacuum = INCREMENTAL`); err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, `VACUUM`)
+	return err
+}
+
+// LastIncoming hora del último mensaje recibido en el chat (sql.ErrNoRows si no hay)
+func (s *MessageStore) LastIncoming(chatJID string) (time.Time, error) {
+	var ts time.Time
+	err := s.db.QueryRow(`SELECT timestamp FROM messages WHERE chat_jid = ? AND is_from_me = 0 ORDER BY timestamp DESC LIMIT 1`, chatJID).Scan(&ts)
+	return ts, err
+}
+
+// ===== Mensajes programados =====
+// Horas en unix ms (no TIMESTAMP): el worker compara send_at <= ahora y la comparación
+// textual de TIMESTAMP depende de la zona con que se guardó.
+
+// Estados de scheduled_messages
+const (
+	ScheduledPending  = "pending"
+	ScheduledSending  = "sending"
+	ScheduledSent     = "sent"
+	ScheduledFailed   = "failed"
+	ScheduledCanceled = "canceled"
+)
+
+var ErrScheduledNotFound = errors.New("scheduled message not found or not pending")
+
+// ScheduledMessage fila de scheduled_messages
+type ScheduledMessage struct {
+	ID        int64      `json:"id"`
+	Recipient string     `json:"recipient"`
+	Message   string     `json:"message"`
+	SendAt    time.Time  `json:"send_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	Status    string     `json:"status"`
+	MessageID string     `json:"message_id,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	SentAt    *time.Time `json:"sent_at,omitempty"`
+}
+
+// ScheduleMessage guarda un envío para sendAt; devuelve su id
+func (s *MessageStore) ScheduleMessage(recipient, message string, sendAt time.Time) (int64, error) {
+	res, err := s.db.Exec(`
+		INSERT INTO scheduled_messages (recipient, message, send_at, created_at, status)
+		VALUES (?, ?, ?, ?, ?)`,
+		recipient, message, sendAt.UnixMilli(), time.Now().UnixMilli(), ScheduledPending,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// ListScheduled programados por send_at; status "" = todos
+func (s *MessageStore) ListScheduled(status string, limit int) ([]ScheduledMessage, error) {
+	q := `SELECT id, recipient, message, send_at, created_at, status, message_id, error, sent_at FROM scheduled_messages`
+	args := []any{}
+	if status != "" {
+		q += ` WHERE status = ?`
+		args = append(args, status)
+	}
+	rows, err := s.db.Query(q+` ORDER BY send_at, id LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	return scanScheduled(rows)
+}
+
+// ClaimDueScheduled pasa a "sending" los pendientes con send_at <= now y los devuelve.
+// El UPDATE condicionado a pending evita que un cancel concurrente se pierda.
+func (s *MessageStore) ClaimDueScheduled(now time.Time, limit int) ([]ScheduledMessage, error) {
+	rows, err := s.db.Query(`
+		UPDATE scheduled_messages SET status = ?
+		WHERE id IN (
+			SELECT id FROM scheduled_messages
+			WHERE status = ? AND send_at <= ?
+			ORDER BY send_at, id LIMIT ?
+		)
+		RETURNING id, recipient, message, send_at, created_at, status, message_id, error, sent_at`,
+		ScheduledSending, ScheduledPending, now.UnixMilli(), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := scanScheduled(rows)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].SendAt.Before(msgs[j].SendAt) })
+	return msgs, nil
+}
+
+// FinishScheduled registra el resultado de un envío reclamado
+func (s *MessageStore) FinishScheduled(id int64, msgID string, sendErr error) error {
+	status, errText := ScheduledSent, ""
+	if sendErr != nil {
+		status, errText = ScheduledFailed, sendErr.Error()
+	}
+	_, err := s.db.Exec(`
+		UPDATE scheduled_messages SET status = ?, message_id = NULLIF(?, ''), error = NULLIF(?, ''), sent_at = ?
+		WHERE id = ?`,
+		status, msgID, errText, time.Now().UnixMilli(), id,
+	)
+	return err
+}
+
+// RescheduleScheduled devuelve a pendiente un programado reclamado, con nueva hora
+func (s *MessageStore) RescheduleScheduled(id int64, sendAt time.Time) error {
+	_, err := s.db.Exec(`UPDATE scheduled_messages SET status = ?, send_at = ? WHERE id = ? AND status = ?`,
+		ScheduledPending, sendAt.UnixMilli(), id, ScheduledSending)
+	return err
+}
+
+// CancelScheduled cancela un programado que aún no salió
+func (s *MessageStore) CancelScheduled(id int64) error {
+	res, err := s.db.Exec(`UPDATE scheduled_messages SET status = ? WHERE id = ? AND status = ?`, ScheduledCanceled, id, ScheduledPending)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrScheduledNotFound
+	}
+	return nil
+}
+
+// FailInterruptedScheduled marca como fallidos los que quedaron en "sending" por un
+// reinicio a mitad de envío: no se reintentan para no duplicar un mensaje que quizá salió.
+func (s *MessageStore) FailInterruptedScheduled() (int, error) {
+	res, err := s.db.Exec(`UPDATE scheduled_messages SET status = ?, error = 'interrupted by restart' WHERE status = ?`, ScheduledFailed, ScheduledSending)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+func scanScheduled(rows *sql.Rows) ([]ScheduledMessage, error) {
+	defer rows.Close()
+	out := []ScheduledMessage{}
+	for rows.Next() {
+		var m ScheduledMessage
+		var sendAt, createdAt int64
+		var msgID, errText sql.NullString
+		var sentAt sql.NullInt64
+		if err := rows.Scan(&m.ID, &m.Recipient, &m.Message, &sendAt, &createdAt, &m.Status, &msgID, &errText, &sentAt); err != nil {
+			return nil, err
+		}
+		m.SendAt, m.CreatedAt = time.UnixMilli(sendAt).UTC(), time.UnixMilli(createdAt).UTC()
+		m.MessageID, m.Error = msgID.String, errText.String
+		if sentAt.Valid {
+			t := time.UnixMilli(sentAt.Int64).UTC()
+			m.SentAt = &t
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
 func (s *MessageStore) Close() error { return s.db.Close() }
 
+func (s *MessageStore) Ping() error { return s.db.Ping() }
+
 // Guarda un mensaje entrante/saliente (IN/OUT) para dar contexto a la IA
 func (s *MessageStore) SaveMessage(chatJID, id, sender, content string, ts time.Time, isFromMe bool, mediaType, filename, url sql.NullString) error {
 	if err := s.ensureChat(chatJID); err != nil {
@@ -188,19 +600,230 @@ func (s *MessageStore) SaveMessage(chatJID, id, sender, content string, ts time.
 	return err
 }
 
-func (s *MessageStore) GetRecentMessages(chatJID string, limit int) ([]map[string]any, error) {
+// StoredMessage fila de messages para guardar en lote (historial)
+type StoredMessage struct {
+	ChatJID   string
+	ID        string
+	Sender    string
+	Content   string
+	Timestamp time.Time
+	IsFromMe  bool
+	MediaType sql.NullString
+	Filename  sql.NullString
+	URL       sql.NullString
+}
+
+// SaveHistory guarda mensajes del historial en una transacción con INSERT OR IGNORE:
+// un (id, chat_jid) ya guardado no se toca (lo visto en vivo es igual o más completo, y
+// un HistorySync repetido no duplica ni retrocede filas). chatNames completa el nombre
+// de los chats que aún no tienen. Devuelve cuántos mensajes eran nuevos.
+func (s *MessageStore) SaveHistory(msgs []StoredMessage, chatNames map[string]string) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	for jid, name := range chatNames {
+		if _, err := tx.Exec(`
+			INSERT INTO chats (jid, name) VALUES (?, NULLIF(?, ''))
+			ON CONFLICT(jid) DO UPDATE SET name = COALESCE(chats.name, excluded.name)`,
+			jid, name,
+		); err != nil {
+			return 0, err
+		}
+	}
+
+	inserted := 0
+	for _, m := range msgs {
+		if m.ChatJID == "" || m.ID == "" {
+			continue
+		}
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO chats (jid) VALUES (?)`, m.ChatJID); err != nil {
+			return 0, err
+		}
+		res, err := tx.Exec(`
+			INSERT OR IGNORE INTO messages
+			(id, chat_jid, sender, content, timestamp, is_from_me, media_type, filename, url)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			m.ID, m.ChatJID, m.Sender, m.Content, m.Timestamp, m.IsFromMe, m.MediaType, m.Filename, m.URL,
+		)
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			inserted++
+		}
+	}
+	return inserted, tx.Commit()
+}
+
+var ErrMessageNotFound = errors.New("message not found")
+
+// GetMessageFromMe indica si el mensaje existe y si lo enviamos nosotros
+func (s *MessageStore) GetMessageFromMe(chatJID, id string) (bool, error) {
+	var fromMe bool
+	err := s.db.QueryRow(`SELECT is_from_me FROM messages WHERE chat_jid = ? AND id = ?`, chatJID, id).Scan(&fromMe)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrMessageNotFound
+	}
+	return fromMe, err
+}
+
+func (s *MessageStore) UpdateMessageContent(chatJID, id, content string) error {
+	_, err := s.db.Exec(`UPDATE messages SET content = ? WHERE chat_jid = ? AND id = ?`, content, chatJID, id)
+	return err
+}
+
+// MarkRevoked vacía el contenido y marca media_type=revoked (se conserva la fila para el hilo)
+func (s *MessageStore) MarkRevoked(chatJID, id string) error {
+	_, err := s.db.Exec(`UPDATE messages SET content = '', media_type = 'revoked', filename = NULL, url = NULL WHERE chat_jid = ? AND id = ?`, chatJID, id)
+	return err
+}
+
+// SaveReceipt registra un acuse (entregado/leído/reproducido) por mensaje.
+// fromMe=true cuando el acuse lo emitimos nosotros (este u otro dispositivo de la cuenta).
+// Se conserva la primera hora vista por tipo (un duplicado tardío no la pisa).
+func (s *MessageStore) SaveReceipt(chatJID string, ids []string, receiptType, sender string, fromMe bool, ts time.Time) error {
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		if _, err := s.db.Exec(`
+			INSERT OR IGNORE INTO receipts
+			(chat_jid, message_id, receipt_type, sender, from_me, timestamp)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			chatJID, id, receiptType, sender, fromMe, ts,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Progresión de estado de un mensaje saliente (nunca retrocede)
+var receiptStatusRank = map[string]int{"sent": 0, "sender": 0, "": 1, "delivered": 1, "read": 2, "played": 3}
+
+func receiptStatusName(rt string) string {
+	switch rt {
+	case "", "delivered":
+		return "delivered"
+	case "sender":
+		return "sent"
+	}
+	return rt
+}
+
+// GetMessageStatus devuelve el estado más avanzado alcanzado (sent/delivered/read/played)
+// según los acuses del destinatario, junto con la hora de cada estado visto.
+func (s *MessageStore) GetMessageStatus(chatJID, msgID string) (string, map[string]string, error) {
+	if _, err := s.GetMessageFromMe(chatJID, msgID); err != nil {
+		return "", nil, err
+	}
+	rows, err := s.db.Query(`
+		SELECT receipt_type, timestamp FROM receipts
+		WHERE chat_jid = ? AND message_id = ? AND from_me = 0`, chatJID, msgID)
+	if err != nil {
+		return "", nil, err
+	}
+	defer rows.Close()
+
+	status, best := "sent", 0
+	seen := map[string]string{}
+	for rows.Next() {
+		var rt sql.NullString
+		var ts time.Time
+		if err := rows.Scan(&rt, &ts); err != nil {
+			return "", nil, err
+		}
+		rank, ok := receiptStatusRank[rt.String]
+		if !ok {
+			continue // retry/server-error/etc. no cuentan como progreso
+		}
+		seen[receiptStatusName(rt.String)] = ts.UTC().Format(time.RFC3339)
+		if rank > best {
+			status, best = receiptStatusName(rt.String), rank
+		}
+	}
+	return status, seen, rows.Err()
+}
+
+// GetUnreadChats devuelve los chats cuyo último mensaje entrante no tiene acuse de lectura propio.
+// unread_count cuenta los entrantes posteriores al último entrante que sí marcamos como leído.
+func (s *MessageStore) GetUnreadChats() ([]map[string]any, error) {
 	rows, err := s.db.Query(`
+		SELECT m.chat_jid, c.name, m.id, m.sender, m.content, m.timestamp,
+			(SELECT COUNT(*) FROM messages u
+			 WHERE u.chat_jid = m.chat_jid AND u.is_from_me = 0
+			   AND u.timestamp > COALESCE((
+				SELECT MAX(r2.timestamp) FROM messages r2
+				JOIN receipts rr ON rr.chat_jid = r2.chat_jid AND rr.message_id = r2.id
+				WHERE r2.chat_jid = m.chat_jid AND r2.is_from_me = 0
+				  AND rr.from_me = 1 AND rr.receipt_type IN ('read', 'read-self', 'played', 'played-self')
+			   ), ''))
+		FROM messages m
+		LEFT JOIN chats c ON c.jid = m.chat_jid
+		WHERE m.is_from_me = 0
+		  AND m.timestamp = (SELECT MAX(timestamp) FROM messages l WHERE l.chat_jid = m.chat_jid AND l.is_from_me = 0)
+		  AND NOT EXISTS (
+			SELECT 1 FROM receipts r
+			WHERE r.chat_jid = m.chat_jid AND r.message_id = m.id
+			  AND r.from_me = 1 AND r.receipt_type IN ('read', 'read-self', 'played', 'played-self')
+		  )
+		ORDER BY m.timestamp DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []map[string]any{}
+	for rows.Next() {
+		var chat, name, id, sender, content sql.NullString
+		var ts time.Time
+		var unread int
+		if err := rows.Scan(&chat, &name, &id, &sender, &content, &ts, &unread); err != nil {
+			return nil, err
+		}
+		out = append(out, map[string]any{
+			"chat_jid": chat.String, "name": name.String,
+			"last_message_id": id.String, "last_sender": sender.String, "last_text": content.String,
+			"last_message_at": ts.UTC().Format(time.RFC3339), "unread_count": unread,
+		})
+	}
+	return out, rows.Err()
+}
+
+// GetRecentMessages devuelve los últimos limit mensajes del chat en orden cronológico.
+// before/beforeID (cursor) pagina hacia atrás: solo mensajes anteriores a (segundo, id) del
+// más antiguo de la página anterior, así los del mismo segundo no se saltan; sin beforeID,
+// los anteriores a ese segundo. before cero = sin cursor. Se compara en segundos unix:
+// los timestamps guardados llevan el offset de cada uno (ver PruneMessages).
+func (s *MessageStore) GetRecentMessages(chatJID string, limit int, before time.Time, beforeID string) ([]map[string]any, error) {
+	query := `
 		SELECT id, sender, content, timestamp, is_from_me, media_type, filename, url
 		FROM messages
-		WHERE chat_jid = ?
-		ORDER BY timestamp DESC
-		LIMIT ?`, chatJID, limit)
+		WHERE chat_jid = ?`
+	args := []any{chatJID}
+	if !before.IsZero() {
+		if beforeID != "" {
+			query += ` AND (CAST(strftime('%s', timestamp) AS INTEGER) < ?
+				OR (CAST(strftime('%s', timestamp) AS INTEGER) = ? AND id < ?))`
+			args = append(args, before.Unix(), before.Unix(), beforeID)
+		} else {
+			query += ` AND CAST(strftime('%s', timestamp) AS INTEGER) < ?`
+			args = append(args, before.Unix())
+		}
+	}
+	query += `
+		ORDER BY CAST(strftime('%s', timestamp) AS INTEGER) DESC, id DESC
+		LIMIT ?`
+	rows, err := s.db.Query(query, append(args, limit)...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var out []map[string]any
+	out := []map[string]any{}
 	for rows.Next() {
 		var id, sender, content, mediaType, filename, url sql.NullString
 		var ts time.Time
@@ -210,10 +833,14 @@ func (s *MessageStore) GetRecentMessages(chatJID string, limit int) ([]map[strin
 		}
 		out = append(out, map[string]any{
 			"id": id.String, "sender": sender.String, "content": content.String,
-			"timestamp": ts.UTC().Format(time.RFC3339), "is_from_me": isFromMe,
+			// el timestamp y el id del más antiguo son el cursor de la página siguiente
+			"timestamp": ts.UTC().Format(time.RFC3339Nano), "is_from_me": isFromMe,
 			"media_type": mediaType.String, "filename": filename.String, "url": url.String,
 		})
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 	// invertimos para cronología natural (antiguo -> nuevo)
 	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
 		out[i], out[j] = out[j], out[i]
@@ -221,6 +848,107 @@ func (s *MessageStore) GetRecentMessages(chatJID string, limit int) ([]map[strin
 	return out, nil
 }
 
+// SearchMessages busca mensajes cuyo texto contenga todos los términos de query
+// (FTS5 si está disponible, si no LIKE sin distinguir mayúsculas ASCII), más recientes primero.
+func (s *MessageStore) SearchMessages(query string, limit int) ([]map[string]any, error) {
+	// las comillas se descartan: cada término se busca tal cual (sin sintaxis FTS)
+	terms := strings.FieldsFunc(query, func(r rune) bool { return unicode.IsSpace(r) || r == '"' })
+	if len(terms) == 0 {
+		return []map[string]any{}, nil
+	}
+
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	if s.fts {
+		// cada término como frase entre comillas: la entrada del usuario no es sintaxis FTS
+		quoted := make([]string, len(terms))
+		for i, t := range terms {
+			quoted[i] = `"` + t + `"`
+		}
+		rows, err = s.db.Query(`
+			SELECT m.chat_jid, c.name, m.id, m.sender, m.content, m.timestamp, m.is_from_me
+			FROM messages_fts f
+			JOIN messages m ON m.chat_jid = f.chat_jid AND m.id = f.id
+			LEFT JOIN chats c ON c.jid = m.chat_jid
+			WHERE messages_fts MATCH ?
+			ORDER BY m.timestamp DESC
+			LIMIT ?`, strings.Join(quoted, " "), limit)
+	} else {
+		where := make([]string, len(terms))
+		args := make([]any, 0, len(terms)+1)
+		for i, t := range terms {
+			where[i] = `m.content LIKE ? ESCAPE '\'`
+			args = append(args, "%"+likeEscaper.Replace(t)+"%")
+		}
+		rows, err = s.db.Query(`
+			SELECT m.chat_jid, c.name, m.id, m.sender, m.content, m.timestamp, m.is_from_me
+			FROM messages m
+			LEFT JOIN chats c ON c.jid = m.chat_jid
+			WHERE `+strings.Join(where, " AND ")+`
+			ORDER BY m.timestamp DESC
+			LIMIT ?`, append(args, limit)...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []map[string]any{}
+	for rows.Next() {
+		var chat, name, id, sender, content sql.NullString
+		var ts time.Time
+		var isFromMe bool
+		if err := rows.Scan(&chat, &name, &id, &sender, &content, &ts, &isFromMe); err != nil {
+			return nil, err
+		}
+		out = append(out, map[string]any{
+			"chat_jid": chat.String, "chat_name": name.String,
+			"id": id.String, "sender": sender.String, "content": content.String,
+			"timestamp": ts.UTC().Format(time.RFC3339), "is_from_me": isFromMe,
+		})
+	}
+	return out, rows.Err()
+}
+
+// likeEscaper escapa los comodines de LIKE (con ESCAPE '\')
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Página de /api/transcript: por defecto y tope
+const (
+	transcriptDefaultLimit = 100
+	transcriptMaxLimit     = 1000
+)
+
+// /api/messages/search: resultados por defecto, tope y largo máximo de q
+const (
+	searchDefaultLimit = 50
+	searchMaxLimit     = 500
+	searchMaxQuery     = 100
+)
+
+// formatTranscript una línea por mensaje: "<timestamp> [IN|OUT] <sender>: <texto> [media]"
+func formatTranscript(msgs []map[string]any) string {
+	var b strings.Builder
+	for _, m := range msgs {
+		dir, sender := "IN", fmt.Sprint(m["sender"])
+		if fromMe, _ := m["is_from_me"].(bool); fromMe {
+			dir, sender = "OUT", "me"
+		}
+		line := fmt.Sprintf("%s [%s] %s: %s", m["timestamp"], dir, sender, m["content"])
+		if mt, _ := m["media_type"].(string); mt != "" {
+			line += " [" + mt
+			if fn, _ := m["filename"].(string); fn != "" {
+				line += ": " + fn
+			}
+			line += "]"
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
 //
 // ===============================
 // 2) Decoradores (RL + retries)
@@ -262,27 +990,189 @@ func WithRetry(attempts int, delay time.Duration, next SendFunc) SendFunc {
 }
 
 //
-// ========================================
-// 3) Session Manager (checks “recursivos”)
-// ========================================
+// ==========================================
+// 2.1) Cola de salida (prioridad + backpressure)
+// ==========================================
 //
 
-func (e *Engine) CheckSession(ctx context.Context) error {
-	dbLog := waLog.Stdout("Database", "INFO", term.IsTerminal(int(os.Stdout.Fd())))
-	container, err := sqlstore.New(ctx, "sqlite3", "file:"+e.cfg.DBPath+"?_foreign_keys=on", dbLog)
-	if err != nil {
-		return err
-	}
-	device, err := container.GetFirstDevice(ctx)
-	if err == sql.ErrNoRows {
-		device = container.NewDevice()
-	} else if err != nil {
-		return err
-	}
-	e.client = wm.NewClient(device, e.logger)
-	if e.client == nil {
+type SendPriority int
+
+const (
+	PriorityLow  SendPriority = iota // media / envíos masivos
+	PriorityHigh                     // respuestas de texto sensibles al tiempo
+)
+
+var ErrQueueClosed = errors.New("send queue closed")
+
+// SendJob es una unidad de envío: texto si Media es nil, media en otro caso.
+type SendJob struct {
+	To       types.JID
+	Text     string
+	Media    *MediaInput
+	Priority SendPriority
+
+	run       func(ctx context.Context) (string, error) // envíos especiales (ubicación, reacción…)
+	quiet     bool                                      // con run: es un mensaje (ubicación) y respeta el horario de silencio
+	skipQuiet bool                                      // el horario de silencio ya se revisó (scheduler)
+	ctx       context.Context
+	done      chan sendResult
+}
+
+type sendResult struct {
+	id  string
+	err error
+}
+
+type sendQueue struct {
+	high chan *SendJob
+	low  chan *SendJob
+	quit chan struct{}
+	once sync.Once
+}
+
+func newSendQueue(size int) *sendQueue {
+	if size <= 0 {
+		size = 256
+	}
+	return &sendQueue{
+		high: make(chan *SendJob, size),
+		low:  make(chan *SendJob, size),
+		quit: make(chan struct{}),
+	}
+}
+
+func (q *sendQueue) close() { q.once.Do(func() { close(q.quit) }) }
+
+func (q *sendQueue) pending() int { return len(q.high) + len(q.low) }
+
+// drain completa con ErrQueueClosed los jobs que quedaron encolados al cerrar.
+func (q *sendQueue) drain() {
+	for {
+		select {
+		case j := <-q.high:
+			j.done <- sendResult{err: ErrQueueClosed}
+		case j := <-q.low:
+			j.done <- sendResult{err: ErrQueueClosed}
+		default:
+			return
+		}
+	}
+}
+
+// next devuelve el siguiente job dando siempre preferencia a la cola alta.
+func (q *sendQueue) next() (*SendJob, bool) {
+	select {
+	case j := <-q.high:
+		return j, true
+	default:
+	}
+	select {
+	case j := <-q.high:
+		return j, true
+	case j := <-q.low:
+		return j, true
+	case <-q.quit:
+		return nil, false
+	}
+}
+
+// EnqueueSend encola el job y espera su resultado. Si la cola está llena
+// bloquea (backpressure) hasta que haya espacio o se cancele ctx.
+func (e *Engine) EnqueueSend(ctx context.Context, job *SendJob) (string, error) {
+	if job == nil {
+		return "", errors.New("nil send job")
+	}
+	// horario de silencio: solo mensajes (texto/media/ubicación); reacciones, ediciones, etc. salen igual
+	if (job.run == nil || job.quiet) && !job.skipQuiet {
+		if until, quiet := e.quietUntil(job.To, time.Now()); quiet {
+			return "", e.deferQuiet(job, until)
+		}
+	}
+	job.ctx = ctx
+	job.done = make(chan sendResult, 1)
+	ch := e.sendQ.low
+	if job.Priority == PriorityHigh {
+		ch = e.sendQ.high
+	}
+	select {
+	case ch <- job:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-e.sendQ.quit:
+		return "", ErrQueueClosed
+	}
+	select {
+	case res := <-job.done:
+		return res.id, res.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-e.sendQ.quit:
+		return "", ErrQueueClosed
+	}
+}
+
+// runSendQueue drena la cola en orden de prioridad a través de los limiters existentes.
+// Al cerrarse la cola, los jobs pendientes terminan con ErrQueueClosed.
+func (e *Engine) runSendQueue() {
+	defer e.sendQ.drain()
+	for {
+		job, ok := e.sendQ.next()
+		if !ok {
+			return
+		}
+		// Sin conexión: retener el job hasta reconectar (o cancelación)
+		select {
+		case <-e.conn.gate():
+		case <-job.ctx.Done():
+		case <-e.sendQ.quit:
+			job.done <- sendResult{err: ErrQueueClosed}
+			return
+		}
+		if err := job.ctx.Err(); err != nil {
+			job.done <- sendResult{err: err}
+			continue
+		}
+		// auto-away: volver a available antes de enviar
+		if e.presence.touch() {
+			_ = e.client.SendPresence(job.ctx, types.PresenceAvailable)
+		}
+		var res sendResult
+		if job.run != nil {
+			res.id, res.err = job.run(job.ctx)
+		} else if job.Media != nil {
+			res.id, res.err = e.sendMediaNow(job.ctx, job.To, *job.Media)
+		} else {
+			res.id, res.err = e.sendTextNow(job.ctx, job.To, job.Text)
+		}
+		job.done <- res
+	}
+}
+
+//
+// ========================================
+// 3) Session Manager (checks “recursivos”)
+// ========================================
+//
+
+func (e *Engine) CheckSession(ctx context.Context) error {
+	dbLog := waLog.Stdout("Database", "INFO", term.IsTerminal(int(os.Stdout.Fd())))
+	container, err := sqlstore.New(ctx, "sqlite3", "file:"+e.cfg.DBPath+"?_foreign_keys=on", dbLog)
+	if err != nil {
+		return err
+	}
+	device, err := container.GetFirstDevice(ctx)
+	if err == sql.ErrNoRows {
+		device = container.NewDevice()
+	} else if err != nil {
+		return err
+	}
+	e.client = wm.NewClient(device, e.logger)
+	if e.client == nil {
 		return errors.New("failed to create client")
 	}
+	// La reconexión la maneja reconnectLoop (backoff exponencial + envelope "reconnected")
+	e.client.EnableAutoReconnect = false
+	e.clientRef.Store(e.client)
 
 	if e.client.Store.ID == nil {
 		qrChan, _ := e.client.GetQRChannel(ctx)
@@ -305,7 +1195,8 @@ func (e *Engine) CheckSession(ctx context.Context) error {
 	if err := e.connectWithRetry(ctx, e.cfg.MaxConnAttempts, e.cfg.ReconnectBaseDelay); err != nil {
 		return err
 	}
-	_ = e.client.SendPresence(ctx, types.PresenceAvailable)
+	e.conn.markOnline()
+	_ = e.client.SendPresence(ctx, e.presence.current())
 	e.caps = Capabilities{
 		Status:         e.cfg.EnableStatus && e.detectStatusSupport(ctx),
 		BroadcastLists: false,
@@ -314,9 +1205,13 @@ func (e *Engine) CheckSession(ctx context.Context) error {
 	return nil
 }
 
+// attempts <= 0 reintenta indefinidamente (reconexión en caliente).
 func (e *Engine) connectWithRetry(ctx context.Context, attempts int, delay time.Duration) error {
 	var err error
-	for i := 0; i < attempts; i++ {
+	for i := 0; attempts <= 0 || i < attempts; i++ {
+		if ctx.Err() != nil {
+			return ctx.Err() // apagando: no abrir otra conexión
+		}
 		if e.client.IsConnected() {
 			return nil
 		}
@@ -324,7 +1219,7 @@ func (e *Engine) connectWithRetry(ctx context.Context, attempts int, delay time.
 			return nil
 		}
 		select {
-		case <-time.After(delay + time.Duration(i)*250*time.Millisecond):
+		case <-time.After(backoffDelay(delay, e.cfg.ReconnectMaxDelay, i)):
 		case <-ctx.Done():
 			return ctx.Err()
 		}
@@ -332,6 +1227,341 @@ func (e *Engine) connectWithRetry(ctx context.Context, attempts int, delay time.
 	return err
 }
 
+// backoffDelay: base*2^attempt con tope y ±20% de jitter
+func backoffDelay(base, max time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		base = time.Second
+	}
+	if max <= 0 {
+		max = 60 * time.Second
+	}
+	d := base
+	for i := 0; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	jitter := time.Duration(rand.Int63n(int64(d)/5 + 1))
+	if rand.Intn(2) == 0 {
+		return d - jitter
+	}
+	return d + jitter
+}
+
+// ===== Estado de conexión (gate de la cola de salida) =====
+
+type connState struct {
+	mu           sync.Mutex
+	online       chan struct{} // cerrado mientras hay conexión
+	isOnline     bool
+	everOnline   bool
+	downSince    time.Time
+	reconnecting bool
+}
+
+func newConnState() *connState { return &connState{online: make(chan struct{})} }
+
+// markOnline abre el gate; devuelve si veníamos de una caída y cuánto duró.
+func (c *connState) markOnline() (reconnected bool, downtime time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.isOnline {
+		return false, 0
+	}
+	reconnected = c.everOnline
+	if !c.downSince.IsZero() {
+		downtime = time.Since(c.downSince)
+	}
+	c.isOnline, c.everOnline = true, true
+	c.downSince = time.Time{}
+	close(c.online)
+	return reconnected, downtime
+}
+
+func (c *connState) markOffline() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.isOnline {
+		return
+	}
+	c.isOnline = false
+	c.downSince = time.Now()
+	c.online = make(chan struct{})
+}
+
+// up indica si hay conexión; tras true, e.client ya está inicializado.
+func (c *connState) up() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.isOnline
+}
+
+func (c *connState) gate() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.online
+}
+
+// ===== Presencia global (modo + auto-away) =====
+
+// parsePresenceMode modo de presencia de la config o de /api/presence
+func parsePresenceMode(s string) (types.Presence, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "available", "online":
+		return types.PresenceAvailable, nil
+	case "unavailable", "offline":
+		return types.PresenceUnavailable, nil
+	}
+	return "", fmt.Errorf("invalid presence mode %q (available|unavailable)", s)
+}
+
+// presenceState presencia que debe anunciarse: el modo elegido, salvo que el auto-away
+// la haya pasado a unavailable por no enviar nada en awayAfter (solo en modo available).
+type presenceState struct {
+	mu        sync.Mutex
+	mode      types.Presence
+	awayAfter time.Duration
+	lastSend  time.Time
+	away      bool
+	now       func() time.Time
+}
+
+func newPresenceState(mode types.Presence, awayAfter time.Duration) *presenceState {
+	return &presenceState{mode: mode, awayAfter: awayAfter, lastSend: time.Now(), now: time.Now}
+}
+
+func (p *presenceState) current() types.Presence {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.away {
+		return types.PresenceUnavailable
+	}
+	return p.mode
+}
+
+// set cambia el modo y reinicia el contador de inactividad
+func (p *presenceState) set(mode types.Presence) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.mode, p.away, p.lastSend = mode, false, p.now()
+}
+
+// touch registra un envío; true = estaba en auto-away y hay que anunciar available
+func (p *presenceState) touch() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastSend = p.now()
+	wasAway := p.away
+	p.away = false
+	return wasAway
+}
+
+// idle true = se cumplió awayAfter sin envíos y hay que anunciar unavailable (una sola vez)
+func (p *presenceState) idle() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.awayAfter <= 0 || p.away || p.mode != types.PresenceAvailable {
+		return false
+	}
+	if p.now().Sub(p.lastSend) < p.awayAfter {
+		return false
+	}
+	p.away = true
+	return true
+}
+
+// runAutoAway revisa la inactividad de envíos y pasa la cuenta a unavailable
+func (e *Engine) runAutoAway(ctx context.Context) {
+	every := max(e.cfg.PresenceAwayAfter/4, time.Second)
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if !e.conn.up() || !e.presence.idle() {
+				continue
+			}
+			if err := e.client.SendPresence(ctx, types.PresenceUnavailable); err != nil {
+				e.humanWarnf(colorize(ansiWARN, "[ESTADO] ")+"Auto-away falló: %v", err)
+				continue
+			}
+			e.humanInfof(colorize(ansiSTATE, "[ESTADO] ")+"Sin envíos hace %s: presencia unavailable.", e.cfg.PresenceAwayAfter)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// ===== Horario de silencio =====
+
+// quietHours ventana diaria [start, end) en minutos desde la medianoche; si end < start
+// cruza la medianoche ("22:00-08:00"). Solo afecta mensajes salientes: recibos, typing
+// y presencia siguen normales.
+type quietHours struct {
+	start, end   int
+	loc          *time.Location
+	drop         bool
+	replyWindow  time.Duration
+	recipientLoc func(types.JID) *time.Location
+}
+
+// parseQuietHours horario de silencio de la config; spec vacío = nil (sin horario)
+func parseQuietHours(spec, tz, mode string) (*quietHours, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	from, to, ok := strings.Cut(spec, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid quiet hours %q (HH:MM-HH:MM)", spec)
+	}
+	q := &quietHours{loc: time.Local}
+	var err error
+	if q.start, err = parseClock(from); err != nil {
+		return nil, fmt.Errorf("invalid quiet hours %q: %w", spec, err)
+	}
+	if q.end, err = parseClock(to); err != nil {
+		return nil, fmt.Errorf("invalid quiet hours %q: %w", spec, err)
+	}
+	if q.start == q.end {
+		return nil, fmt.Errorf("invalid quiet hours %q: empty window", spec)
+	}
+	if tz = strings.TrimSpace(tz); tz != "" {
+		if q.loc, err = time.LoadLocation(tz); err != nil {
+			return nil, fmt.Errorf("invalid quiet hours timezone %q: %w", tz, err)
+		}
+	}
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", "defer":
+	case "drop":
+		q.drop = true
+	default:
+		return nil, fmt.Errorf("invalid quiet mode %q (defer|drop)", mode)
+	}
+	return q, nil
+}
+
+// parseClock "HH:MM" → minutos desde la medianoche
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("bad time %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// until fin de la ventana si t cae dentro (en la zona loc); false = fuera del horario.
+// time.Date normaliza los minutos, así el fin respeta los cambios de horario.
+func (q *quietHours) until(t time.Time, loc *time.Location) (time.Time, bool) {
+	lt := t.In(loc)
+	y, m, d := lt.Date()
+	now := lt.Hour()*60 + lt.Minute()
+	switch {
+	case q.start < q.end && now >= q.start && now < q.end:
+		return time.Date(y, m, d, 0, q.end, 0, 0, loc), true
+	case q.start > q.end && now >= q.start:
+		return time.Date(y, m, d+1, 0, q.end, 0, 0, loc), true
+	case q.start > q.end && now < q.end:
+		return time.Date(y, m, d, 0, q.end, 0, 0, loc), true
+	}
+	return time.Time{}, false
+}
+
+// QuietHoursError el envío cayó en horario de silencio y no salió. ScheduledID > 0 =
+// quedó programado en /api/schedule para Until; 0 = descartado o, con Err, rechazado.
+type QuietHoursError struct {
+	Until       time.Time
+	ScheduledID int64
+	Err         error // por qué no se difirió en modo defer (ErrQuietNotDeferrable)
+}
+
+// ErrQuietNotDeferrable scheduled_messages solo guarda texto: media y ubicaciones no se
+// difieren ni en modo defer, se rechazan y quien envía debe reintentar después de Until
+var ErrQuietNotDeferrable = errors.New("only text messages can be deferred")
+
+func (e *QuietHoursError) Error() string {
+	if e.ScheduledID > 0 {
+		return fmt.Sprintf("quiet hours: deferred to %s (scheduled #%d)", e.Until.Format(time.RFC3339), e.ScheduledID)
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("quiet hours until %s: not sent (%v), retry after then", e.Until.Format(time.RFC3339), e.Err)
+	}
+	return fmt.Sprintf("quiet hours until %s: not sent", e.Until.Format(time.RFC3339))
+}
+
+func (e *QuietHoursError) Unwrap() error { return e.Err }
+
+// quietUntil fin del horario de silencio para to; false = se puede enviar ya. Una
+// conversación activa (el contacto escribió hace menos de replyWindow) no espera.
+func (e *Engine) quietUntil(to types.JID, now time.Time) (time.Time, bool) {
+	q := e.quiet
+	if q == nil {
+		return time.Time{}, false
+	}
+	loc := q.loc
+	if q.recipientLoc != nil {
+		if l := q.recipientLoc(to); l != nil {
+			loc = l
+		}
+	}
+	until, quiet := q.until(now, loc)
+	if !quiet {
+		return time.Time{}, false
+	}
+	if q.replyWindow > 0 && e.msgStore != nil {
+		last, err := e.msgStore.LastIncoming(storageChatJID(to.String()))
+		if err == nil && now.Sub(last) < q.replyWindow {
+			return time.Time{}, false
+		}
+	}
+	return until, true
+}
+
+// deferQuiet programa el texto para el fin del horario (modo defer) o lo descarta (modo
+// drop). Media y ubicaciones no caben en scheduled_messages: en modo defer se rechazan
+// con ErrQuietNotDeferrable en vez de descartarlas en silencio.
+func (e *Engine) deferQuiet(job *SendJob, until time.Time) error {
+	qerr := &QuietHoursError{Until: until}
+	if !e.quiet.drop && (job.Media != nil || job.run != nil) {
+		qerr.Err = ErrQuietNotDeferrable
+		e.humanWarnf(colorize(ansiWARN, "[QUIET] ")+"Envío a %s rechazado: horario de silencio hasta %s y solo el texto se difiere", job.To, until.Format("15:04"))
+		return qerr
+	}
+	if e.quiet.drop || e.msgStore == nil {
+		e.humanWarnf(colorize(ansiWARN, "[QUIET] ")+"Envío a %s descartado: horario de silencio hasta %s", job.To, until.Format("15:04"))
+		return qerr
+	}
+	id, err := e.msgStore.ScheduleMessage(job.To.String(), job.Text, until)
+	if err != nil {
+		return fmt.Errorf("quiet hours: cannot defer: %w", err)
+	}
+	qerr.ScheduledID = id
+	e.humanInfof(colorize(ansiSTATE, "[QUIET] ")+"Envío a %s diferido a %s (programado #%d)", job.To, until.Format(time.RFC3339), id)
+	return qerr
+}
+
+// reconnectLoop reconecta con backoff exponencial tras un Disconnected.
+// Solo corre un loop a la vez.
+func (e *Engine) reconnectLoop(ctx context.Context) {
+	e.conn.mu.Lock()
+	if e.conn.reconnecting {
+		e.conn.mu.Unlock()
+		return
+	}
+	e.conn.reconnecting = true
+	e.conn.mu.Unlock()
+	defer func() {
+		e.conn.mu.Lock()
+		e.conn.reconnecting = false
+		e.conn.mu.Unlock()
+	}()
+
+	if err := e.connectWithRetry(ctx, 0, e.cfg.ReconnectBaseDelay); err != nil {
+		e.humanWarnf(colorize(ansiWARN, "[ESTADO] ")+"Reconexión abortada: %v", err)
+	}
+}
+
 //nolint:unusedparams
 func (e *Engine) detectStatusSupport(_ context.Context) bool { return false }
 
@@ -446,16 +1676,29 @@ func seenReceiptOnce(key string) bool {
 // =======================
 //
 
+type FlatSinkOptions struct {
+	MaxBytes int64 // 0 = sin rotación
+	Gzip     bool
+	Retain   int
+	Fsync    bool
+}
+
 type FlatSink struct {
-	base     string
-	maxBytes int64
+	base  string
+	opts  FlatSinkOptions
+	locks sync.Map // path -> *sync.Mutex (una línea JSON por escritura, sin intercalar)
 }
 
-func NewFlatSink(base string, maxBytes int64) *FlatSink {
+func NewFlatSink(base string, opts FlatSinkOptions) *FlatSink {
 	if base == "" {
 		base = "outbox"
 	}
-	return &FlatSink{base: base, maxBytes: maxBytes}
+	return &FlatSink{base: base, opts: opts}
+}
+
+func (s *FlatSink) lockFor(path string) *sync.Mutex {
+	mu, _ := s.locks.LoadOrStore(path, &sync.Mutex{})
+	return mu.(*sync.Mutex)
 }
 
 func (s *FlatSink) ensureDir(p string) error { return os.MkdirAll(p, 0o755) }
@@ -496,138 +1739,634 @@ func categoryAndFileNoDate(env *ForwardEnvelope) (category, filename string) {
 	}
 	// 4) device/system
 	switch env.EventType {
-	case "connected", "logged_out", "history_sync", "offline_sync_completed", "events.IdentityChange":
+	case "connected", "reconnected", "disconnected", "logged_out", "history_sync", "offline_sync_completed", "events.IdentityChange":
 		return "devices", hostID() + ".ndjson"
 	default:
 		return "system", sanitizePathPart(env.EventType) + ".ndjson"
 	}
 }
 
-func (s *FlatSink) maybeRotate(path string) (string, error) {
-	if s.maxBytes <= 0 {
-		return path, nil
+// partFile es un trozo rotado de un NDJSON (archivo.ndjson.partN[.gz])
+type partFile struct {
+	n    int
+	path string
+	gz   bool
+}
+
+// listParts devuelve las partes rotadas de path, de la más antigua a la más nueva
+func listParts(path string) []partFile {
+	matches, _ := filepath.Glob(path + ".part*")
+	var out []partFile
+	for _, m := range matches {
+		suffix := strings.TrimPrefix(m, path+".part")
+		gz := strings.HasSuffix(suffix, ".gz")
+		n, err := strconv.Atoi(strings.TrimSuffix(suffix, ".gz"))
+		if err != nil || n <= 0 {
+			continue
+		}
+		out = append(out, partFile{n: n, path: m, gz: gz})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].n < out[j].n })
+	return out
+}
+
+// maybeRotate mueve path a path.partN (N = siguiente libre) cuando supera maxBytes;
+// el archivo vivo siempre es path, así el orden cronológico es part1..partN y luego path.
+func (s *FlatSink) maybeRotate(path string) error {
+	if s.opts.MaxBytes <= 0 {
+		return nil
 	}
 	info, err := os.Stat(path)
-	if err != nil {
-		return path, nil
+	if err != nil || info.Size() < s.opts.MaxBytes {
+		return nil
 	}
-	if info.Size() < s.maxBytes {
-		return path, nil
+	next := 1
+	if parts := listParts(path); len(parts) > 0 {
+		next = parts[len(parts)-1].n + 1
 	}
-	for i := 1; i < 1000; i++ {
-		next := fmt.Sprintf("%s.part%d", path, i)
-		if _, err := os.Stat(next); errors.Is(err, os.ErrNotExist) {
-			return next, nil
+	rotated := fmt.Sprintf("%s.part%d", path, next)
+	if err := os.Rename(path, rotated); err != nil {
+		return err
+	}
+	if s.opts.Gzip {
+		if err := gzipFile(rotated); err != nil {
+			return err
 		}
 	}
-	return path, nil
+	s.prune(path)
+	return nil
+}
+
+// gzipFile comprime src a src.gz y borra src solo si la compresión terminó bien
+func gzipFile(src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	dst := src + ".gz"
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(dst)
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		_ = out.Close()
+		_ = os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// prune borra las partes más antiguas por encima de retain
+func (s *FlatSink) prune(path string) {
+	if s.opts.Retain <= 0 {
+		return
+	}
+	parts := listParts(path)
+	for i := 0; i < len(parts)-s.opts.Retain; i++ {
+		_ = os.Remove(parts[i].path)
+	}
 }
 
 func (s *FlatSink) Append(env *ForwardEnvelope, payload []byte) error {
 	cat, file := categoryAndFileNoDate(env)
+	return s.AppendTo(cat, file, payload)
+}
+
+// AppendTo escribe una línea en <base>/<cat>/<file> (usado también por la cola de muertos)
+func (s *FlatSink) AppendTo(cat, file string, payload []byte) error {
 	base := filepath.Join(s.base, cat)
 	if err := s.ensureDir(base); err != nil {
 		return err
 	}
 	path := filepath.Join(base, file)
-	path, _ = s.maybeRotate(path)
+
+	// el lock cubre rotación + escritura: nadie escribe en un archivo que se está moviendo
+	mu := s.lockFor(path)
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := s.maybeRotate(path); err != nil {
+		return err
+	}
 
 	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	if _, err := f.Write(payload); err != nil {
+	line := make([]byte, 0, len(payload)+1)
+	line = append(append(line, payload...), '\n')
+	if _, err := f.Write(line); err != nil {
+		_ = f.Close()
 		return err
 	}
-	if _, err := f.Write([]byte("\n")); err != nil {
-		return err
+	if s.opts.Fsync {
+		if err := f.Sync(); err != nil {
+			_ = f.Close()
+			return err
+		}
 	}
-	return nil
+	return f.Close()
 }
 
 //
-// ====================
-// 5) Event Loop
-// ====================
+// ==============================
+// 4.2) Replay de NDJSON → webhook
+// ==============================
 //
 
-type Handlers struct {
-	OnMessage     func(ctx context.Context, m *events.Message) error
-	OnReceipt     func(ctx context.Context, r *events.Receipt) error
-	OnPresence    func(ctx context.Context, p *events.Presence) error
-	OnGroupUpdate func(ctx context.Context, g *events.GroupInfo) error
-	OnStatus      func(ctx context.Context, s any) error
-	OnError       func(ctx context.Context, err error)
+var replayCategories = map[string]bool{"contacts": true, "groups": true, "devices": true, "system": true}
+
+type ReplayOptions struct {
+	Since  time.Time     // solo envelopes con At >= Since (cero = todos)
+	DryRun bool          // cuenta sin enviar
+	Every  time.Duration // intervalo entre envíos (0 = 100ms)
 }
 
-// ===== Envelope estándar =====
-type ForwardEnvelope struct {
-	EventType   string         `json:"event_type"`
-	Direction   string         `json:"direction,omitempty"` // "in" | "out"
-	EventRaw    any            `json:"event_raw"`           // se nulifica al guardar
-	ChatJID     string         `json:"chat_jid,omitempty"`
-	SenderJID   string         `json:"sender_jid,omitempty"`
-	ChatName    string         `json:"chat_name,omitempty"`
-	MessageID   string         `json:"message_id,omitempty"`
-	MessageIDs  []string       `json:"message_ids,omitempty"`
-	ReceiptType string         `json:"receipt_type,omitempty"`
-	Text        string         `json:"text,omitempty"`
-	Media       map[string]any `json:"media,omitempty"`
-	Extra       map[string]any `json:"extra,omitempty"`
-	At          string         `json:"at"`
+type ReplayResult struct {
+	Files   int  `json:"files"`
+	Matched int  `json:"matched"`
+	Sent    int  `json:"sent"`
+	Failed  int  `json:"failed"`
+	DryRun  bool `json:"dry_run"`
 }
 
-func (e *Engine) marshalEnvelopeForIO(env *ForwardEnvelope) ([]byte, error) {
-	env.At = time.Now().UTC().Format(time.RFC3339)
-	if env.Extra == nil && e.cfg.Forward.ExtraParams != nil {
-		env.Extra = e.cfg.Forward.ExtraParams
-	}
-	slim := *env
-	slim.EventRaw = nil
-	return json.Marshal(&slim)
+type replayItem struct {
+	at   time.Time
+	line []byte
 }
 
-func (e *Engine) writeEnvelopeToFolder(env *ForwardEnvelope) error {
-	if e.cfg.Forward.Mode != ForwardFolder {
-		return nil
-	}
-	if e.fileSink == nil {
-		return errors.New("file sink not initialized")
-	}
-	b, err := e.marshalEnvelopeForIO(env)
+// readNDJSON recorre un NDJSON (plano o .gz) línea a línea
+func readNDJSON(path string, gz bool, fn func(line []byte)) error {
+	f, err := os.Open(path)
 	if err != nil {
 		return err
 	}
-	return e.fileSink.Append(env, b)
-}
-
-func (e *Engine) signBodyHMACSHA256(secret string, body []byte) string {
-	if secret == "" {
-		return ""
+	defer f.Close()
+	var r io.Reader = f
+	if gz {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 8<<20)
+	for sc.Scan() {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		fn(append([]byte(nil), sc.Bytes()...))
+	}
+	return sc.Err()
+}
+
+// ndjsonFilesInOrder devuelve, por cada archivo vivo, sus partes rotadas (antiguas primero) y luego el vivo
+func ndjsonFilesInOrder(dir string) ([]partFile, error) {
+	live, err := filepath.Glob(filepath.Join(dir, "*.ndjson"))
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var out []partFile
+	add := func(p string) {
+		out = append(out, listParts(p)...)
+		if _, err := os.Stat(p); err == nil {
+			out = append(out, partFile{path: p})
+		}
+		seen[p] = true
+	}
+	for _, p := range live {
+		add(p)
+	}
+	// archivos que solo sobreviven como partes (el vivo aún no se recreó)
+	orphans, _ := filepath.Glob(filepath.Join(dir, "*.ndjson.part*"))
+	for _, o := range orphans {
+		p := o[:strings.Index(o, ".ndjson.part")+len(".ndjson")]
+		if !seen[p] {
+			add(p)
+		}
+	}
+	return out, nil
+}
+
+// ReplayFolder relee los NDJSON de una categoría del outbox y los reenvía al webhook en orden de At
+func (e *Engine) ReplayFolder(ctx context.Context, category string, opts ReplayOptions) (ReplayResult, error) {
+	res := ReplayResult{DryRun: opts.DryRun}
+	if !replayCategories[category] {
+		return res, fmt.Errorf("unknown category %q", category)
+	}
+	if !opts.DryRun && (!e.cfg.Forward.Webhook.Enabled || e.cfg.Forward.Webhook.URL == "") {
+		return res, errors.New("webhook disabled")
+	}
+	if e.fileSink == nil {
+		return res, errors.New("file sink not initialized")
+	}
+	files, err := ndjsonFilesInOrder(filepath.Join(e.fileSink.base, category))
+	if err != nil {
+		return res, err
+	}
+	res.Files = len(files)
+
+	var items []replayItem
+	for _, pf := range files {
+		err := readNDJSON(pf.path, pf.gz, func(line []byte) {
+			var head struct {
+				At string `json:"at"`
+			}
+			if json.Unmarshal(line, &head) != nil {
+				return
+			}
+			at, _ := time.Parse(time.RFC3339, head.At)
+			if !opts.Since.IsZero() && at.Before(opts.Since) {
+				return
+			}
+			items = append(items, replayItem{at: at, line: line})
+		})
+		if err != nil {
+			return res, fmt.Errorf("read %s: %w", pf.path, err)
+		}
+	}
+	// estable: mismo segundo conserva el orden de archivo
+	sort.SliceStable(items, func(i, j int) bool { return items[i].at.Before(items[j].at) })
+	res.Matched = len(items)
+	if opts.DryRun {
+		return res, nil
+	}
+
+	every := opts.Every
+	if every <= 0 {
+		every = 100 * time.Millisecond
+	}
+	lim := rate.NewLimiter(rate.Every(every), 1)
+	for _, it := range items {
+		if err := lim.Wait(ctx); err != nil {
+			return res, err
+		}
+		if err := e.postEnvelopeBytes(ctx, it.line, map[string]string{"X-Whatsbot-Replay": "1"}); err != nil {
+			res.Failed++
+			if e.logger != nil {
+				e.logger.Warnf("replay post failed: %v", err)
+			}
+			continue
+		}
+		res.Sent++
+	}
+	return res, nil
+}
+
+// ReplayDead reintenta la cola de muertos: toma los archivos (rename) para no competir con
+// escrituras nuevas; lo que vuelve a fallar se re-encola con attempts acumulados.
+func (e *Engine) ReplayDead(ctx context.Context, opts ReplayOptions) (ReplayResult, error) {
+	res := ReplayResult{DryRun: opts.DryRun}
+	if !opts.DryRun && (!e.cfg.Forward.Webhook.Enabled || e.cfg.Forward.Webhook.URL == "") {
+		return res, errors.New("webhook disabled")
+	}
+	if e.fileSink == nil {
+		return res, errors.New("file sink not initialized")
+	}
+	dir := filepath.Join(e.fileSink.base, deadCategory)
+	files, err := ndjsonFilesInOrder(dir)
+	if err != nil {
+		return res, err
+	}
+	res.Files = len(files)
+
+	// restos de un replay interrumpido (crash a mitad): se procesan tal cual
+	var taken []partFile
+	if !opts.DryRun {
+		leftovers, _ := filepath.Glob(filepath.Join(dir, "*.replay-*"))
+		for _, l := range leftovers {
+			taken = append(taken, partFile{path: l, gz: strings.Contains(l, ".gz.replay-")})
+		}
+	}
+	for _, pf := range files {
+		if opts.DryRun {
+			taken = append(taken, pf)
+			continue
+		}
+		live := strings.TrimSuffix(strings.TrimSuffix(pf.path, ".gz"), fmt.Sprintf(".part%d", pf.n))
+		mu := e.fileSink.lockFor(live)
+		mu.Lock()
+		tmp := fmt.Sprintf("%s.replay-%d", pf.path, time.Now().UnixNano())
+		err := os.Rename(pf.path, tmp)
+		mu.Unlock()
+		if err != nil {
+			continue
+		}
+		taken = append(taken, partFile{n: pf.n, path: tmp, gz: pf.gz})
+	}
+
+	every := opts.Every
+	if every <= 0 {
+		every = 100 * time.Millisecond
+	}
+	lim := rate.NewLimiter(rate.Every(every), 1)
+	for _, pf := range taken {
+		var dl []DeadLetter
+		if err := readNDJSON(pf.path, pf.gz, func(line []byte) {
+			var d DeadLetter
+			if json.Unmarshal(line, &d) == nil && len(d.Envelope) > 0 {
+				dl = append(dl, d)
+			}
+		}); err != nil {
+			return res, fmt.Errorf("read %s: %w", pf.path, err)
+		}
+		res.Matched += len(dl)
+		if opts.DryRun {
+			continue
+		}
+		for _, d := range dl {
+			if err := lim.Wait(ctx); err != nil {
+				// contexto cancelado: lo pendiente vuelve a la cola sin sumar intentos
+				e.deadLetter(d.Envelope, errors.New(d.Reason), d.Attempts)
+				continue
+			}
+			if err := e.postEnvelopeBytes(ctx, d.Envelope, map[string]string{"X-Whatsbot-Replay": "1"}); err != nil {
+				res.Failed++
+				e.deadLetter(d.Envelope, err, d.Attempts+webhookAttempts)
+				continue
+			}
+			res.Sent++
+		}
+		_ = os.Remove(pf.path)
+	}
+	return res, nil
+}
+
+//
+// ====================
+// 5) Event Loop
+// ====================
+//
+
+type Handlers struct {
+	OnMessage     func(ctx context.Context, m *events.Message) error
+	OnReceipt     func(ctx context.Context, r *events.Receipt) error
+	OnPresence    func(ctx context.Context, p *events.Presence) error
+	OnGroupUpdate func(ctx context.Context, g *events.GroupInfo) error
+	OnStatus      func(ctx context.Context, s any) error
+	OnError       func(ctx context.Context, err error)
+}
+
+// ===== Envelope estándar =====
+type ForwardEnvelope struct {
+	EventType   string           `json:"event_type"`
+	Direction   string           `json:"direction,omitempty"` // "in" | "out"
+	EventRaw    any              `json:"event_raw"`           // se nulifica al guardar
+	ChatJID     string           `json:"chat_jid,omitempty"`
+	SenderJID   string           `json:"sender_jid,omitempty"`
+	ChatName    string           `json:"chat_name,omitempty"`
+	MessageID   string           `json:"message_id,omitempty"`
+	MessageIDs  []string         `json:"message_ids,omitempty"`
+	ReceiptType string           `json:"receipt_type,omitempty"`
+	Text        string           `json:"text,omitempty"`
+	Media       map[string]any   `json:"media,omitempty"`
+	Location    map[string]any   `json:"location,omitempty"` // lat/lng/name/address (location y live_location)
+	Contacts    []map[string]any `json:"contacts,omitempty"` // event_type=contact: display_name + vcard
+	Reaction    map[string]any   `json:"reaction,omitempty"` // event_type=reaction: emoji + target_id
+	Extra       map[string]any   `json:"extra,omitempty"`
+	At          string           `json:"at"`
+
+	// Respuesta citando un mensaje previo (ContextInfo.StanzaID/QuotedMessage)
+	QuotedMessageID string `json:"quoted_message_id,omitempty"`
+	QuotedSender    string `json:"quoted_sender,omitempty"`
+	QuotedText      string `json:"quoted_text,omitempty"`
+
+	// @menciones del mensaje (ContextInfo.MentionedJID)
+	MentionedJIDs []string `json:"mentioned_jids,omitempty"`
+}
+
+// ContextInfo del mensaje (solo tipos que pueden citar a otro mensaje)
+func contextInfoOf(m *waProto.Message) *waProto.ContextInfo {
+	if m == nil {
+		return nil
+	}
+	switch {
+	case m.GetExtendedTextMessage() != nil:
+		return m.GetExtendedTextMessage().GetContextInfo()
+	case m.GetImageMessage() != nil:
+		return m.GetImageMessage().GetContextInfo()
+	case m.GetVideoMessage() != nil:
+		return m.GetVideoMessage().GetContextInfo()
+	case m.GetAudioMessage() != nil:
+		return m.GetAudioMessage().GetContextInfo()
+	case m.GetDocumentMessage() != nil:
+		return m.GetDocumentMessage().GetContextInfo()
+	case m.GetStickerMessage() != nil:
+		return m.GetStickerMessage().GetContextInfo()
+	case m.GetLocationMessage() != nil:
+		return m.GetLocationMessage().GetContextInfo()
+	case m.GetContactMessage() != nil:
+		return m.GetContactMessage().GetContextInfo()
+	}
+	return nil
+}
+
+// Texto "visible" de un mensaje: conversación, texto extendido o caption
+func plainTextOf(m *waProto.Message) string {
+	if m == nil {
+		return ""
+	}
+	switch {
+	case m.GetExtendedTextMessage() != nil && m.GetExtendedTextMessage().GetText() != "":
+		return m.GetExtendedTextMessage().GetText()
+	case m.GetConversation() != "":
+		return m.GetConversation()
+	case m.GetImageMessage() != nil && m.GetImageMessage().GetCaption() != "":
+		return m.GetImageMessage().GetCaption()
+	case m.GetVideoMessage() != nil && m.GetVideoMessage().GetCaption() != "":
+		return m.GetVideoMessage().GetCaption()
+	case m.GetDocumentMessage() != nil && m.GetDocumentMessage().GetCaption() != "":
+		return m.GetDocumentMessage().GetCaption()
+	}
+	return ""
+}
+
+// Rellena quoted_* si el mensaje responde (cita) a otro
+func fillQuoted(env *ForwardEnvelope, m *waProto.Message) {
+	ci := contextInfoOf(m)
+	if ci == nil {
+		return
+	}
+	if mj := ci.GetMentionedJID(); len(mj) > 0 {
+		env.MentionedJIDs = append([]string(nil), mj...)
+	}
+	if ci.GetStanzaID() == "" {
+		return
+	}
+	env.QuotedMessageID = ci.GetStanzaID()
+	env.QuotedSender = ci.GetParticipant()
+	env.QuotedText = plainTextOf(ci.GetQuotedMessage())
+	if env.QuotedText == "" {
+		if loc := locationFromMessage(ci.GetQuotedMessage()); loc != nil {
+			env.QuotedText = locationSummary(loc)
+		}
+	}
+}
+
+// Extrae ubicación (estática o en vivo) con las mismas claves que espera whserver
+func locationFromMessage(m *waProto.Message) map[string]any {
+	if m == nil {
+		return nil
+	}
+	if loc := m.GetLocationMessage(); loc != nil {
+		return map[string]any{
+			"type":       "location",
+			"latitude":   loc.GetDegreesLatitude(),
+			"longitude":  loc.GetDegreesLongitude(),
+			"name":       loc.GetName(),
+			"address":    loc.GetAddress(),
+			"url":        loc.GetURL(),
+			"comment":    loc.GetComment(),
+			"accuracy_m": loc.GetAccuracyInMeters(),
+			"is_live":    loc.GetIsLive(),
+		}
+	}
+	if live := m.GetLiveLocationMessage(); live != nil {
+		return map[string]any{
+			"type":       "live_location",
+			"latitude":   live.GetDegreesLatitude(),
+			"longitude":  live.GetDegreesLongitude(),
+			"comment":    live.GetCaption(),
+			"accuracy_m": live.GetAccuracyInMeters(),
+			"speed_mps":  live.GetSpeedInMps(),
+			"sequence":   live.GetSequenceNumber(),
+			"is_live":    true,
+		}
+	}
+	return nil
+}
+
+// Extrae tarjetas de contacto (ContactMessage o ContactsArrayMessage)
+func contactsFromMessage(m *waProto.Message) []map[string]any {
+	if m == nil {
+		return nil
+	}
+	var list []*waProto.ContactMessage
+	if c := m.GetContactMessage(); c != nil {
+		list = append(list, c)
+	}
+	if arr := m.GetContactsArrayMessage(); arr != nil {
+		list = append(list, arr.GetContacts()...)
+	}
+	if len(list) == 0 {
+		return nil
 	}
-	h := hmac.New(sha256.New, []byte(secret))
-	h.Write(body)
-	return "sha256=" + hex.EncodeToString(h.Sum(nil))
+	out := make([]map[string]any, 0, len(list))
+	for _, c := range list {
+		out = append(out, map[string]any{
+			"display_name": c.GetDisplayName(),
+			"vcard":        c.GetVcard(),
+		})
+	}
+	return out
+}
+
+// Nombres de los contactos compartidos separados por coma (para Text/logs)
+func contactNames(cs []map[string]any) string {
+	names := make([]string, 0, len(cs))
+	for _, c := range cs {
+		if n, _ := c["display_name"].(string); n != "" {
+			names = append(names, n)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// Extrae una reacción; emoji vacío significa que se quitó la reacción
+func reactionFromMessage(m *waProto.Message) map[string]any {
+	if m == nil || m.GetReactionMessage() == nil {
+		return nil
+	}
+	r := m.GetReactionMessage()
+	key := r.GetKey()
+	return map[string]any{
+		"emoji":          r.GetText(),
+		"target_id":      key.GetID(),
+		"target_chat":    canonicalChatJID(key.GetRemoteJID()),
+		"target_from_me": key.GetFromMe(),
+		"removed":        r.GetText() == "",
+	}
+}
+
+// Texto legible para persistir/loguear una ubicación
+func locationSummary(loc map[string]any) string {
+	if loc == nil {
+		return ""
+	}
+	lat, _ := loc["latitude"].(float64)
+	lng, _ := loc["longitude"].(float64)
+	coords := fmt.Sprintf("%.6f,%.6f", lat, lng)
+	if name, _ := loc["name"].(string); name != "" {
+		return name + " (" + coords + ")"
+	}
+	return coords
+}
+
+func (e *Engine) marshalEnvelopeForIO(env *ForwardEnvelope) ([]byte, error) {
+	env.At = time.Now().UTC().Format(time.RFC3339)
+	if env.Extra == nil && e.cfg.Forward.ExtraParams != nil {
+		env.Extra = e.cfg.Forward.ExtraParams
+	}
+	slim := *env
+	slim.EventRaw = nil
+	return json.Marshal(&slim)
+}
+
+func (e *Engine) writeEnvelopeToFolder(env *ForwardEnvelope) error {
+	if e.cfg.Forward.Mode != ForwardFolder {
+		return nil
+	}
+	if e.fileSink == nil {
+		return errors.New("file sink not initialized")
+	}
+	b, err := e.marshalEnvelopeForIO(env)
+	if err != nil {
+		return err
+	}
+	return e.fileSink.Append(env, b)
+}
+
+func (e *Engine) signBodyHMACSHA256(secret string, body []byte) string {
+	return webhooksig.Sign(secret, body)
 }
 
+const webhookAttempts = 3
+
 func (e *Engine) postJSONWithRetry(ctx context.Context, url string, secret string, headers map[string]string, payload any) error {
 	body, _ := json.Marshal(payload)
 	client := &http.Client{Timeout: 7 * time.Second}
 
 	var lastErr error
-	for i := 0; i < 3; i++ {
+	for i := 0; i < webhookAttempts; i++ {
 		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
 		if err != nil {
 			return err
 		}
 		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("X-Whatsbot-Timestamp", time.Now().UTC().Format(time.RFC3339))
+		ts := time.Now().UTC().Format(time.RFC3339)
+		nonce := webhooksig.NewNonce()
+		req.Header.Set(webhooksig.HeaderTimestamp, ts)
+		req.Header.Set(webhooksig.HeaderNonce, nonce)
 		for k, v := range headers {
 			req.Header.Set(k, v)
 		}
 		if sig := e.signBodyHMACSHA256(secret, body); sig != "" {
-			req.Header.Set("X-Whatsbot-Signature", sig)
+			req.Header.Set(webhooksig.HeaderSignature, sig)
+			req.Header.Set(webhooksig.HeaderSignatureBound, webhooksig.SignBound(secret, ts, nonce, body))
 		}
 
 		resp, err := client.Do(req)
@@ -636,10 +2375,12 @@ func (e *Engine) postJSONWithRetry(ctx context.Context, url string, secret strin
 		} else {
 			_ = resp.Body.Close()
 			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				metrics.WebhookAttempts.WithLabelValues("ok").Inc()
 				return nil
 			}
 			lastErr = fmt.Errorf("webhook non-2xx: %d", resp.StatusCode)
 		}
+		metrics.WebhookAttempts.WithLabelValues("error").Inc()
 
 		select {
 		case <-time.After(time.Duration(250*(1<<i)) * time.Millisecond):
@@ -662,17 +2403,64 @@ func (e *Engine) sendEnvelopeToWebhook(_ context.Context, env *ForwardEnvelope)
 			}
 			return
 		}
-		if err := e.postJSONWithRetry(context.Background(),
-			e.cfg.Forward.Webhook.URL,
-			e.cfg.Forward.Webhook.Secret,
-			e.cfg.Forward.Webhook.Headers,
-			json.RawMessage(b),
-		); err != nil && e.logger != nil {
-			e.logger.Warnf("webhook post failed: %v", err)
+		if err := e.postEnvelopeBytes(context.Background(), b, nil); err != nil {
+			metrics.WebhookFailures.Inc()
+			if e.logger != nil {
+				e.logger.Warnf("webhook post failed: %v", err)
+			}
+			e.deadLetter(b, err, webhookAttempts)
 		}
 	}(*env)
 }
 
+// DeadLetter es la línea guardada en dead/ cuando el webhook agota los reintentos
+type DeadLetter struct {
+	DeadAt   string          `json:"dead_at"`
+	Attempts int             `json:"attempts"`
+	Reason   string          `json:"reason"`
+	Envelope json.RawMessage `json:"envelope"`
+}
+
+const deadCategory = "dead"
+
+func (e *Engine) deadLetter(envelope []byte, cause error, attempts int) {
+	if e.fileSink == nil {
+		return
+	}
+	b, err := json.Marshal(DeadLetter{
+		DeadAt:   time.Now().UTC().Format(time.RFC3339),
+		Attempts: attempts,
+		Reason:   cause.Error(),
+		Envelope: envelope,
+	})
+	if err == nil {
+		err = e.fileSink.AppendTo(deadCategory, hostID()+".ndjson", b)
+	}
+	if err != nil && e.logger != nil {
+		e.logger.Errorf("dead-letter write failed (envelope perdido): %v", err)
+	}
+}
+
+// postEnvelopeBytes envía un envelope ya serializado (síncrono, con reintentos)
+func (e *Engine) postEnvelopeBytes(ctx context.Context, b []byte, extra map[string]string) error {
+	headers := e.cfg.Forward.Webhook.Headers
+	if len(extra) > 0 {
+		headers = make(map[string]string, len(e.cfg.Forward.Webhook.Headers)+len(extra))
+		for k, v := range e.cfg.Forward.Webhook.Headers {
+			headers[k] = v
+		}
+		for k, v := range extra {
+			headers[k] = v
+		}
+	}
+	return e.postJSONWithRetry(ctx,
+		e.cfg.Forward.Webhook.URL,
+		e.cfg.Forward.Webhook.Secret,
+		headers,
+		json.RawMessage(b),
+	)
+}
+
 // helper para forwardear OUT
 func (e *Engine) forwardOutgoing(to types.JID, id, text, mt, mime, filename string) {
 	env := &ForwardEnvelope{
@@ -694,6 +2482,7 @@ func (e *Engine) forwardOutgoing(to types.JID, id, text, mt, mime, filename stri
 		}
 		env.Media = m
 	}
+	metrics.Messages.WithLabelValues(metrics.ComponentEngine, metrics.DirectionOut).Inc()
 	_ = e.writeEnvelopeToFolder(env)
 	e.sendEnvelopeToWebhook(context.Background(), env)
 }
@@ -708,6 +2497,115 @@ func (e *Engine) forwardOutgoingWithMedia(to types.JID, id, text string, media m
 		Text:      text,
 		Media:     media,
 	}
+	metrics.Messages.WithLabelValues(metrics.ComponentEngine, metrics.DirectionOut).Inc()
+	_ = e.writeEnvelopeToFolder(env)
+	e.sendEnvelopeToWebhook(context.Background(), env)
+}
+
+func (e *Engine) forwardOutgoingLocation(to types.JID, id, text string, loc map[string]any) {
+	env := &ForwardEnvelope{
+		EventType: "message",
+		Direction: "out",
+		ChatJID:   canonicalChatJID(to.String()),
+		SenderJID: "",
+		ChatName:  e.ResolveChatName(to, canonicalChatJID(to.String()), nil, ""),
+		MessageID: id,
+		Text:      text,
+		Location:  loc,
+	}
+	e.humanInfof(colorize(ansiOUT, "[OUT]")+" [%s] To:%s | ID:%s | UBICACIÓN:%s",
+		kindOfChat(to), colorize(ansiBold, to.String()), id, locationSummary(loc))
+	metrics.Messages.WithLabelValues(metrics.ComponentEngine, metrics.DirectionOut).Inc()
+	_ = e.writeEnvelopeToFolder(env)
+	e.sendEnvelopeToWebhook(context.Background(), env)
+}
+
+func (e *Engine) forwardOutgoingContacts(to types.JID, id string, cs []map[string]any) {
+	env := &ForwardEnvelope{
+		EventType: "contact",
+		Direction: "out",
+		ChatJID:   canonicalChatJID(to.String()),
+		SenderJID: "",
+		ChatName:  e.ResolveChatName(to, canonicalChatJID(to.String()), nil, ""),
+		MessageID: id,
+		Text:      contactNames(cs),
+		Contacts:  cs,
+	}
+	e.humanInfof(colorize(ansiOUT, "[OUT]")+" [%s] To:%s | ID:%s | CONTACTO:%s",
+		kindOfChat(to), colorize(ansiBold, to.String()), id, short(env.Text, 60))
+	metrics.Messages.WithLabelValues(metrics.ComponentEngine, metrics.DirectionOut).Inc()
+	_ = e.writeEnvelopeToFolder(env)
+	e.sendEnvelopeToWebhook(context.Background(), env)
+}
+
+func (e *Engine) forwardOutgoingReaction(to types.JID, id string, react map[string]any) {
+	env := &ForwardEnvelope{
+		EventType: "reaction",
+		Direction: "out",
+		ChatJID:   canonicalChatJID(to.String()),
+		ChatName:  e.ResolveChatName(to, canonicalChatJID(to.String()), nil, ""),
+		MessageID: id,
+		Text:      react["emoji"].(string),
+		Reaction:  react,
+	}
+	e.humanInfof(colorize(ansiOUT, "[OUT]")+" [%s] To:%s | REACCIÓN:%s | MsgID:%s",
+		kindOfChat(to), colorize(ansiBold, to.String()), env.Text, react["target_id"])
+	metrics.Messages.WithLabelValues(metrics.ComponentEngine, metrics.DirectionOut).Inc()
+	_ = e.writeEnvelopeToFolder(env)
+	e.sendEnvelopeToWebhook(context.Background(), env)
+}
+
+// forwardOutgoingProtocol emite message_edit/message_revoke; message_id es el mensaje afectado
+func (e *Engine) forwardOutgoingProtocol(to types.JID, eventType, targetID, text string) {
+	env := &ForwardEnvelope{
+		EventType: eventType,
+		Direction: "out",
+		ChatJID:   canonicalChatJID(to.String()),
+		ChatName:  e.ResolveChatName(to, canonicalChatJID(to.String()), nil, ""),
+		MessageID: targetID,
+		Text:      text,
+	}
+	if eventType == "message_revoke" {
+		e.humanInfof(colorize(ansiOUT, "[OUT]")+" [%s] To:%s | BORRADO | MsgID:%s", kindOfChat(to), colorize(ansiBold, to.String()), targetID)
+	} else {
+		e.humanInfof(colorize(ansiOUT, "[OUT]")+" [%s] To:%s | EDITADO | MsgID:%s | Texto:\"%s\"", kindOfChat(to), colorize(ansiBold, to.String()), targetID, short(text, 80))
+	}
+	metrics.Messages.WithLabelValues(metrics.ComponentEngine, metrics.DirectionOut).Inc()
+	_ = e.writeEnvelopeToFolder(env)
+	e.sendEnvelopeToWebhook(context.Background(), env)
+}
+
+// forwardReaction emite event_type=reaction para reacciones propias y ajenas
+func (e *Engine) forwardReaction(v *events.Message, react map[string]any) {
+	dir := "in"
+	sender := v.Info.Sender.String()
+	if v.Info.IsFromMe {
+		dir = "out"
+		sender = ""
+	}
+	chatJID := canonicalChatJID(v.Info.Chat.String())
+	env := &ForwardEnvelope{
+		EventType: "reaction",
+		Direction: dir,
+		EventRaw:  v,
+		ChatJID:   chatJID,
+		SenderJID: sender,
+		ChatName:  e.ResolveChatName(v.Info.Chat, chatJID, nil, v.Info.Sender.User),
+		MessageID: v.Info.ID,
+		Text:      react["emoji"].(string),
+		Reaction:  react,
+	}
+	prefix := colorize(ansiIN, "[IN]")
+	if dir == "out" {
+		prefix = colorize(ansiOUT, "[OUT]")
+	}
+	if react["removed"].(bool) {
+		e.humanInfof(prefix+" [%s] Chat:%s | De:%s | REACCIÓN quitada | MsgID:%s",
+			kindOfChat(v.Info.Chat), colorize(ansiBold, chatJID), colorize(ansiBold, sender), react["target_id"])
+	} else {
+		e.humanInfof(prefix+" [%s] Chat:%s | De:%s | REACCIÓN:%s | MsgID:%s",
+			kindOfChat(v.Info.Chat), colorize(ansiBold, chatJID), colorize(ansiBold, sender), env.Text, react["target_id"])
+	}
 	_ = e.writeEnvelopeToFolder(env)
 	e.sendEnvelopeToWebhook(context.Background(), env)
 }
@@ -769,114 +2667,44 @@ func extractJIDFromIdentityChange(ev any) string {
 }
 
 func (e *Engine) RunEventLoop(ctx context.Context, h Handlers) {
-	e.client.AddEventHandler(func(evt interface{}) {
-		switch v := evt.(type) {
-
-		case *events.Message:
-			// Si el mensaje es nuestro, trátalo como OUT y no dispares OnMessage
-			if v.Info.IsFromMe {
-				id := v.Info.ID
-				to := v.Info.Chat
-				txt := ""
-				if v.Message != nil {
-					switch {
-					case v.Message.GetExtendedTextMessage() != nil && v.Message.GetExtendedTextMessage().GetText() != "":
-						txt = v.Message.GetExtendedTextMessage().GetText()
-					case v.Message.GetConversation() != "":
-						txt = v.Message.GetConversation()
-					}
-				}
+	e.client.AddEventHandler(func(evt interface{}) { e.handleEvent(ctx, h, evt) })
+}
 
-				// Si hay media, extrae el ticket como en IN y forwardea con media
-				if m := v.Message; m != nil {
-					var media map[string]any
-					if im := m.GetImageMessage(); im != nil {
-						media = map[string]any{
-							"type":                "image",
-							"mimetype":            im.GetMimetype(),
-							"url":                 im.GetURL(),
-							"direct_path":         im.GetDirectPath(),
-							"file_length":         im.GetFileLength(),
-							"media_key_b64":       b64(im.GetMediaKey()),
-							"file_sha256_b64":     b64(im.GetFileSHA256()),
-							"file_enc_sha256_b64": b64(im.GetFileEncSHA256()),
-							"media_type":          "image",
-						}
-					} else if au := m.GetAudioMessage(); au != nil {
-						media = map[string]any{
-							"type":                "audio",
-							"mimetype":            au.GetMimetype(),
-							"seconds":             au.GetSeconds(),
-							"url":                 au.GetURL(),
-							"direct_path":         au.GetDirectPath(),
-							"file_length":         au.GetFileLength(),
-							"media_key_b64":       b64(au.GetMediaKey()),
-							"file_sha256_b64":     b64(au.GetFileSHA256()),
-							"file_enc_sha256_b64": b64(au.GetFileEncSHA256()),
-							"media_type":          "audio",
-						}
-					} else if vi := m.GetVideoMessage(); vi != nil {
-						media = map[string]any{
-							"type":                "video",
-							"mimetype":            vi.GetMimetype(),
-							"url":                 vi.GetURL(),
-							"direct_path":         vi.GetDirectPath(),
-							"file_length":         vi.GetFileLength(),
-							"media_key_b64":       b64(vi.GetMediaKey()),
-							"file_sha256_b64":     b64(vi.GetFileSHA256()),
-							"file_enc_sha256_b64": b64(vi.GetFileEncSHA256()),
-							"media_type":          "video",
-						}
-					} else if doc := m.GetDocumentMessage(); doc != nil {
-						media = map[string]any{
-							"type":                "document",
-							"mimetype":            doc.GetMimetype(),
-							"title":               doc.GetTitle(),
-							"url":                 doc.GetURL(),
-							"direct_path":         doc.GetDirectPath(),
-							"file_length":         doc.GetFileLength(),
-							"media_key_b64":       b64(doc.GetMediaKey()),
-							"file_sha256_b64":     b64(doc.GetFileSHA256()),
-							"file_enc_sha256_b64": b64(doc.GetFileEncSHA256()),
-							"media_type":          "document",
-						}
-					}
-					if media != nil {
-						e.forwardOutgoingWithMedia(to, id, txt, media)
-					} else {
-						e.forwardOutgoing(to, id, txt, "", "", "")
-					}
-				} else {
-					e.forwardOutgoing(to, id, txt, "", "", "")
-				}
-				return
+// handleEvent procesa un evento de whatsmeow: envelope (carpeta/webhook), persistencia y handlers
+func (e *Engine) handleEvent(ctx context.Context, h Handlers, evt interface{}) {
+	e.lastEventAt.Store(time.Now().UnixNano())
+	e.invalidateChatName(evt)
+	switch v := evt.(type) {
+
+	case *events.Message:
+		// Reacciones: envelope propio (in/out), no se persisten como mensajes
+		if react := reactionFromMessage(v.Message); react != nil {
+			e.forwardReaction(v, react)
+			if !v.Info.IsFromMe && h.OnMessage != nil {
+				_ = h.OnMessage(ctx, v)
 			}
+			return
+		}
 
-			env := &ForwardEnvelope{EventType: "message", Direction: "in", EventRaw: v}
-			msg := v.Message
-			from := v.Info.Sender
-			chat := v.Info.Chat
-
-			env.ChatJID = canonicalChatJID(chat.String())
-			env.SenderJID = from.String()
-			env.ChatName = e.ResolveChatName(chat, env.ChatJID, v, v.Info.Sender.User)
-			env.MessageID = v.Info.ID
-
-			if msg != nil {
+		// Si el mensaje es nuestro, trátalo como OUT y no dispares OnMessage
+		if v.Info.IsFromMe {
+			id := v.Info.ID
+			to := v.Info.Chat
+			txt := ""
+			if v.Message != nil {
 				switch {
-				case msg.GetExtendedTextMessage() != nil && msg.GetExtendedTextMessage().GetText() != "":
-					env.Text = msg.GetExtendedTextMessage().GetText()
-				case msg.GetConversation() != "":
-					env.Text = msg.GetConversation()
-				case msg.GetImageMessage() != nil && msg.GetImageMessage().GetCaption() != "":
-					env.Text = msg.GetImageMessage().GetCaption()
-				case msg.GetVideoMessage() != nil && msg.GetVideoMessage().GetCaption() != "":
-					env.Text = msg.GetVideoMessage().GetCaption()
+				case v.Message.GetExtendedTextMessage() != nil && v.Message.GetExtendedTextMessage().GetText() != "":
+					txt = v.Message.GetExtendedTextMessage().GetText()
+				case v.Message.GetConversation() != "":
+					txt = v.Message.GetConversation()
 				}
+			}
 
-				// 🔐 Ticket completo por tipo
-				if im := msg.GetImageMessage(); im != nil {
-					env.Media = map[string]any{
+			// Si hay media, extrae el ticket como en IN y forwardea con media
+			if m := v.Message; m != nil {
+				var media map[string]any
+				if im := m.GetImageMessage(); im != nil {
+					media = map[string]any{
 						"type":                "image",
 						"mimetype":            im.GetMimetype(),
 						"url":                 im.GetURL(),
@@ -887,8 +2715,8 @@ func (e *Engine) RunEventLoop(ctx context.Context, h Handlers) {
 						"file_enc_sha256_b64": b64(im.GetFileEncSHA256()),
 						"media_type":          "image",
 					}
-				} else if au := msg.GetAudioMessage(); au != nil {
-					env.Media = map[string]any{
+				} else if au := m.GetAudioMessage(); au != nil {
+					media = map[string]any{
 						"type":                "audio",
 						"mimetype":            au.GetMimetype(),
 						"seconds":             au.GetSeconds(),
@@ -900,8 +2728,8 @@ func (e *Engine) RunEventLoop(ctx context.Context, h Handlers) {
 						"file_enc_sha256_b64": b64(au.GetFileEncSHA256()),
 						"media_type":          "audio",
 					}
-				} else if vi := msg.GetVideoMessage(); vi != nil {
-					env.Media = map[string]any{
+				} else if vi := m.GetVideoMessage(); vi != nil {
+					media = map[string]any{
 						"type":                "video",
 						"mimetype":            vi.GetMimetype(),
 						"url":                 vi.GetURL(),
@@ -912,8 +2740,8 @@ func (e *Engine) RunEventLoop(ctx context.Context, h Handlers) {
 						"file_enc_sha256_b64": b64(vi.GetFileEncSHA256()),
 						"media_type":          "video",
 					}
-				} else if doc := msg.GetDocumentMessage(); doc != nil {
-					env.Media = map[string]any{
+				} else if doc := m.GetDocumentMessage(); doc != nil {
+					media = map[string]any{
 						"type":                "document",
 						"mimetype":            doc.GetMimetype(),
 						"title":               doc.GetTitle(),
@@ -926,201 +2754,357 @@ func (e *Engine) RunEventLoop(ctx context.Context, h Handlers) {
 						"media_type":          "document",
 					}
 				}
+				if loc := locationFromMessage(m); loc != nil {
+					e.forwardOutgoingLocation(to, id, txt, loc)
+				} else if cs := contactsFromMessage(m); cs != nil {
+					e.forwardOutgoingContacts(to, id, cs)
+				} else if media != nil {
+					e.forwardOutgoingWithMedia(to, id, txt, media)
+				} else {
+					e.forwardOutgoing(to, id, txt, "", "", "")
+				}
+			} else {
+				e.forwardOutgoing(to, id, txt, "", "", "")
 			}
+			return
+		}
 
-			if e.msgStore != nil {
-				var mediaType, filename, url sql.NullString
-				if msg.GetImageMessage() != nil {
-					mediaType = sql.NullString{String: "image", Valid: true}
-				} else if msg.GetAudioMessage() != nil {
-					mediaType = sql.NullString{String: "audio", Valid: true}
-				} else if msg.GetVideoMessage() != nil {
-					mediaType = sql.NullString{String: "video", Valid: true}
-				} else if msg.GetDocumentMessage() != nil {
-					mediaType = sql.NullString{String: "document", Valid: true}
-					filename = sql.NullString{String: msg.GetDocumentMessage().GetTitle(), Valid: msg.GetDocumentMessage().GetTitle() != ""}
-				}
-				ts := v.Info.Timestamp
-				if ts.IsZero() {
-					ts = time.Now()
-				}
-				_ = e.msgStore.SaveMessage(
-					storageChatJID(env.ChatJID),
-					env.MessageID,
-					env.SenderJID,
-					env.Text,
-					ts,
-					false,
-					mediaType, filename, url,
-				)
+		env := &ForwardEnvelope{EventType: "message", Direction: "in", EventRaw: v}
+		metrics.Messages.WithLabelValues(metrics.ComponentEngine, metrics.DirectionIn).Inc()
+		msg := v.Message
+		from := v.Info.Sender
+		chat := v.Info.Chat
+
+		env.ChatJID = canonicalChatJID(chat.String())
+		env.SenderJID = from.String()
+		env.ChatName = e.ResolveChatName(chat, env.ChatJID, v, v.Info.Sender.User)
+		env.MessageID = v.Info.ID
+
+		if msg != nil {
+			switch {
+			case msg.GetExtendedTextMessage() != nil && msg.GetExtendedTextMessage().GetText() != "":
+				env.Text = msg.GetExtendedTextMessage().GetText()
+			case msg.GetConversation() != "":
+				env.Text = msg.GetConversation()
+			case msg.GetImageMessage() != nil && msg.GetImageMessage().GetCaption() != "":
+				env.Text = msg.GetImageMessage().GetCaption()
+			case msg.GetVideoMessage() != nil && msg.GetVideoMessage().GetCaption() != "":
+				env.Text = msg.GetVideoMessage().GetCaption()
 			}
 
-			{
-				k := kindOfChat(v.Info.Chat)
-				who := env.SenderJID
-				txt := env.Text
-				mt := ""
-				if env.Media != nil {
-					if t, ok := env.Media["type"].(string); ok && t != "" {
-						mt = strings.ToUpper(t)
-					}
+			// 🔐 Ticket completo por tipo
+			if im := msg.GetImageMessage(); im != nil {
+				env.Media = map[string]any{
+					"type":                "image",
+					"mimetype":            im.GetMimetype(),
+					"url":                 im.GetURL(),
+					"direct_path":         im.GetDirectPath(),
+					"file_length":         im.GetFileLength(),
+					"media_key_b64":       b64(im.GetMediaKey()),
+					"file_sha256_b64":     b64(im.GetFileSHA256()),
+					"file_enc_sha256_b64": b64(im.GetFileEncSHA256()),
+					"media_type":          "image",
 				}
-				prefix := colorize(ansiIN, "[IN]") + " "
-				if env.ChatJID == "status@broadcast" {
-					e.humanInfof(prefix+"[STATUS] De %s | ID:%s | %s",
-						colorize(ansiBold, who),
-						env.MessageID,
-						map[bool]string{true: "CON MEDIA", false: "SIN MEDIA"}[mt != ""],
-					)
-				} else if mt != "" {
-					e.humanInfof(prefix+"[%s] Chat:%s | De:%s | ID:%s | MEDIA:%s | Caption:\"%s\"",
-						k, colorize(ansiBold, env.ChatJID), colorize(ansiBold, who),
-						env.MessageID, mt, short(txt, 60))
-				} else {
-					e.humanInfof(prefix+"[%s] Chat:%s | De:%s | ID:%s | Texto:\"%s\"",
-						k, colorize(ansiBold, env.ChatJID), colorize(ansiBold, who),
-						env.MessageID, short(txt, 80))
+			} else if au := msg.GetAudioMessage(); au != nil {
+				env.Media = map[string]any{
+					"type":                "audio",
+					"mimetype":            au.GetMimetype(),
+					"seconds":             au.GetSeconds(),
+					"url":                 au.GetURL(),
+					"direct_path":         au.GetDirectPath(),
+					"file_length":         au.GetFileLength(),
+					"media_key_b64":       b64(au.GetMediaKey()),
+					"file_sha256_b64":     b64(au.GetFileSHA256()),
+					"file_enc_sha256_b64": b64(au.GetFileEncSHA256()),
+					"media_type":          "audio",
+				}
+			} else if vi := msg.GetVideoMessage(); vi != nil {
+				env.Media = map[string]any{
+					"type":                "video",
+					"mimetype":            vi.GetMimetype(),
+					"url":                 vi.GetURL(),
+					"direct_path":         vi.GetDirectPath(),
+					"file_length":         vi.GetFileLength(),
+					"media_key_b64":       b64(vi.GetMediaKey()),
+					"file_sha256_b64":     b64(vi.GetFileSHA256()),
+					"file_enc_sha256_b64": b64(vi.GetFileEncSHA256()),
+					"media_type":          "video",
+				}
+			} else if doc := msg.GetDocumentMessage(); doc != nil {
+				env.Media = map[string]any{
+					"type":                "document",
+					"mimetype":            doc.GetMimetype(),
+					"title":               doc.GetTitle(),
+					"url":                 doc.GetURL(),
+					"direct_path":         doc.GetDirectPath(),
+					"file_length":         doc.GetFileLength(),
+					"media_key_b64":       b64(doc.GetMediaKey()),
+					"file_sha256_b64":     b64(doc.GetFileSHA256()),
+					"file_enc_sha256_b64": b64(doc.GetFileEncSHA256()),
+					"media_type":          "document",
 				}
 			}
 
-			if err := e.writeEnvelopeToFolder(env); err != nil && h.OnError != nil {
-				h.OnError(ctx, err)
+			// ↩️ Respuesta citando un mensaje previo (+ @menciones)
+			fillQuoted(env, msg)
+
+			// 👤 Contactos compartidos (vCard)
+			if cs := contactsFromMessage(msg); cs != nil {
+				env.EventType = "contact"
+				env.Contacts = cs
+				if env.Text == "" {
+					env.Text = contactNames(cs)
+				}
 			}
-			e.sendEnvelopeToWebhook(ctx, env)
 
-			if h.OnMessage != nil {
-				_ = h.OnMessage(ctx, v)
+			// 📍 Ubicación (estática o en vivo)
+			if loc := locationFromMessage(msg); loc != nil {
+				env.Location = loc
+				if env.Text == "" {
+					if c, _ := loc["comment"].(string); c != "" {
+						env.Text = c
+					}
+				}
 			}
+		}
 
-		case *events.Receipt:
-			env := &ForwardEnvelope{
-				EventType:   "receipt",
-				EventRaw:    v,
-				ChatJID:     canonicalChatJID(v.Chat.String()),
-				SenderJID:   v.MessageSender.String(),
-				MessageIDs:  append([]string{}, v.MessageIDs...),
-				ReceiptType: string(v.Type),
+		if e.msgStore != nil {
+			var mediaType, filename, url sql.NullString
+			if msg.GetImageMessage() != nil {
+				mediaType = sql.NullString{String: "image", Valid: true}
+			} else if msg.GetAudioMessage() != nil {
+				mediaType = sql.NullString{String: "audio", Valid: true}
+			} else if msg.GetVideoMessage() != nil {
+				mediaType = sql.NullString{String: "video", Valid: true}
+			} else if msg.GetDocumentMessage() != nil {
+				mediaType = sql.NullString{String: "document", Valid: true}
+				filename = sql.NullString{String: msg.GetDocumentMessage().GetTitle(), Valid: msg.GetDocumentMessage().GetTitle() != ""}
+			} else if env.Contacts != nil {
+				mediaType = sql.NullString{String: "contact", Valid: true}
+			} else if env.Location != nil {
+				lt, _ := env.Location["type"].(string)
+				mediaType = sql.NullString{String: lt, Valid: true}
+				filename = sql.NullString{String: locationSummary(env.Location), Valid: true}
+				if u, _ := env.Location["url"].(string); u != "" {
+					url = sql.NullString{String: u, Valid: true}
+				}
 			}
-			key := env.ChatJID + "|" + env.ReceiptType + "|" + strings.Join(env.MessageIDs, ",")
-			if seenReceiptOnce(key) {
-				break
+			ts := v.Info.Timestamp
+			if ts.IsZero() {
+				ts = time.Now()
 			}
-			{
-				k := kindOfChat(v.Chat)
-				tag := map[string]string{"": "ENTREGADO", "read": "LEÍDO", "played": "REPRODUCIDO", "sender": "ENVIADO"}[env.ReceiptType]
-				prefix := colorize(ansiRCPT, "[RCPT]") + " "
-				if len(env.MessageIDs) == 1 {
-					e.humanInfof(prefix+"[%s] Chat:%s | Tipo:%s | MsgID:%s", k, colorize(ansiBold, env.ChatJID), tag, env.MessageIDs[0])
-				} else {
-					e.humanInfof(prefix+"[%s] Chat:%s | Tipo:%s | MsgIDs:%d", k, colorize(ansiBold, env.ChatJID), tag, len(env.MessageIDs))
+			_ = e.msgStore.SaveMessage(
+				storageChatJID(env.ChatJID),
+				env.MessageID,
+				env.SenderJID,
+				env.Text,
+				ts,
+				false,
+				mediaType, filename, url,
+			)
+		}
+
+		{
+			k := kindOfChat(v.Info.Chat)
+			who := env.SenderJID
+			txt := env.Text
+			mt := ""
+			if env.Media != nil {
+				if t, ok := env.Media["type"].(string); ok && t != "" {
+					mt = strings.ToUpper(t)
 				}
 			}
-			_ = e.writeEnvelopeToFolder(env)
-			e.sendEnvelopeToWebhook(ctx, env)
-			if h.OnReceipt != nil {
-				_ = h.OnReceipt(ctx, v)
-			}
-
-		case *events.ChatPresence:
-			env := &ForwardEnvelope{
-				EventType: "chat_presence",
-				EventRaw:  v,
-				ChatJID:   canonicalChatJID(v.Chat.String()),
-				SenderJID: v.Sender.String(),
-				Extra: map[string]any{
-					"state": string(v.State),
-					"media": string(v.Media),
-				},
-			}
-			prefix := colorize(ansiPRES, "[PRESENCIA][CHAT]") + " "
-			add := ""
-			if v.Media != "" {
-				add = " (" + string(v.Media) + ")"
-			}
-			e.humanInfof(prefix+"Chat:%s | %s%s", colorize(ansiBold, env.ChatJID), strings.ToUpper(string(v.State)), add)
-			_ = e.writeEnvelopeToFolder(env)
-			e.sendEnvelopeToWebhook(ctx, env)
-
-		case *events.Presence:
-			env := &ForwardEnvelope{
-				EventType: "presence",
-				EventRaw:  v,
-				SenderJID: canonicalChatJID(v.From.String()),
-				Extra: map[string]any{
-					"unavailable": v.Unavailable,
-					"last_seen":   v.LastSeen.UTC().Format(time.RFC3339),
-				},
-			}
-			if v.Unavailable {
-				e.humanInfof(colorize(ansiPRES, "[PRESENCIA] ")+"%s ahora OFFLINE | last_seen=%s", colorize(ansiBold, env.SenderJID), env.Extra["last_seen"])
+			prefix := colorize(ansiIN, "[IN]") + " "
+			if env.ChatJID == "status@broadcast" {
+				e.humanInfof(prefix+"[STATUS] De %s | ID:%s | %s",
+					colorize(ansiBold, who),
+					env.MessageID,
+					map[bool]string{true: "CON MEDIA", false: "SIN MEDIA"}[mt != ""],
+				)
+			} else if env.Contacts != nil {
+				e.humanInfof(prefix+"[%s] Chat:%s | De:%s | ID:%s | CONTACTO:%s",
+					k, colorize(ansiBold, env.ChatJID), colorize(ansiBold, who),
+					env.MessageID, short(txt, 60))
+			} else if env.Location != nil {
+				e.humanInfof(prefix+"[%s] Chat:%s | De:%s | ID:%s | UBICACIÓN:%s",
+					k, colorize(ansiBold, env.ChatJID), colorize(ansiBold, who),
+					env.MessageID, locationSummary(env.Location))
+			} else if mt != "" {
+				e.humanInfof(prefix+"[%s] Chat:%s | De:%s | ID:%s | MEDIA:%s | Caption:\"%s\"",
+					k, colorize(ansiBold, env.ChatJID), colorize(ansiBold, who),
+					env.MessageID, mt, short(txt, 60))
+			} else if env.QuotedMessageID != "" {
+				e.humanInfof(prefix+"[%s] Chat:%s | De:%s | ID:%s | Texto:\"%s\" | Cita:%s \"%s\"",
+					k, colorize(ansiBold, env.ChatJID), colorize(ansiBold, who),
+					env.MessageID, short(txt, 80), env.QuotedMessageID, short(env.QuotedText, 40))
 			} else {
-				e.humanInfof(colorize(ansiPRES, "[PRESENCIA] ")+"%s ahora ONLINE", colorize(ansiBold, env.SenderJID))
-			}
-			_ = e.writeEnvelopeToFolder(env)
-			e.sendEnvelopeToWebhook(ctx, env)
-			if h.OnPresence != nil {
-				_ = h.OnPresence(ctx, v)
-			}
-
-		case *events.GroupInfo:
-			env := &ForwardEnvelope{EventType: "group_update", EventRaw: v, ChatJID: canonicalChatJID(v.JID.String())}
-			e.humanInfof(colorize(ansiGROUP, "[GRUPO][UPDATE] ")+"JID:%s | (cambios en miembros/título/foto…)", colorize(ansiBold, env.ChatJID))
-			_ = e.writeEnvelopeToFolder(env)
-			e.sendEnvelopeToWebhook(ctx, env)
-			if h.OnGroupUpdate != nil {
-				_ = h.OnGroupUpdate(ctx, v)
-			}
-
-		case *events.JoinedGroup:
-			env := &ForwardEnvelope{EventType: "joined_group", EventRaw: v, ChatJID: canonicalChatJID(v.JID.String())}
-			e.humanInfof(colorize(ansiGROUP, "[GRUPO][JOINED] ")+"Te uniste a %s", colorize(ansiBold, env.ChatJID))
-			_ = e.writeEnvelopeToFolder(env)
-			e.sendEnvelopeToWebhook(ctx, env)
-
-		case *events.HistorySync:
-			env := &ForwardEnvelope{EventType: "history_sync", EventRaw: v}
-			e.humanInfof(colorize(ansiDEFAULT, "[HISTORY] ") + "Se recibió HistorySync (mensajes antiguos).")
-			_ = e.writeEnvelopeToFolder(env)
-			e.sendEnvelopeToWebhook(ctx, env)
-			e.handleHistorySync(v)
-
-		case *events.Connected:
-			env := &ForwardEnvelope{EventType: "connected", EventRaw: v}
-			e.humanInfof(colorize(ansiSTATE, "[ESTADO] ") + "Autenticado y CONECTADO.")
+				e.humanInfof(prefix+"[%s] Chat:%s | De:%s | ID:%s | Texto:\"%s\"",
+					k, colorize(ansiBold, env.ChatJID), colorize(ansiBold, who),
+					env.MessageID, short(txt, 80))
+			}
+		}
 
-			// 👉 Reafirma presencia tras reconectar
-			_ = e.client.SendPresence(ctx, types.PresenceAvailable)
-			_ = e.writeEnvelopeToFolder(env)
-			e.sendEnvelopeToWebhook(ctx, env)
-
-		case *events.LoggedOut:
-			env := &ForwardEnvelope{EventType: "logged_out", EventRaw: v}
-			e.humanWarnf(colorize(ansiWARN, "[ESTADO] ") + "Sesión cerrada. Puede requerir re-vinculación (QR).")
-			_ = e.writeEnvelopeToFolder(env)
-			e.sendEnvelopeToWebhook(ctx, env)
-
-		case *events.IdentityChange:
-			chatJID := extractJIDFromIdentityChange(v)
-			env := &ForwardEnvelope{
-				EventType: "events.IdentityChange",
-				EventRaw:  v,
-				ChatJID:   canonicalChatJID(chatJID),
-			}
-			if chatJID != "" {
-				e.humanInfof(colorize(ansiDEFAULT, "[IDENTITY] ")+"Cambio de identidad en %s", colorize(ansiBold, env.ChatJID))
+		if err := e.writeEnvelopeToFolder(env); err != nil && h.OnError != nil {
+			h.OnError(ctx, err)
+		}
+		e.sendEnvelopeToWebhook(ctx, env)
+
+		if h.OnMessage != nil {
+			_ = h.OnMessage(ctx, v)
+		}
+
+	case *events.Receipt:
+		env := &ForwardEnvelope{
+			EventType:   "receipt",
+			EventRaw:    v,
+			ChatJID:     canonicalChatJID(v.Chat.String()),
+			SenderJID:   v.MessageSender.String(),
+			MessageIDs:  append([]string{}, v.MessageIDs...),
+			ReceiptType: string(v.Type),
+		}
+		key := env.ChatJID + "|" + env.ReceiptType + "|" + strings.Join(env.MessageIDs, ",")
+		if seenReceiptOnce(key) {
+			break
+		}
+		{
+			k := kindOfChat(v.Chat)
+			tag := map[string]string{"": "ENTREGADO", "read": "LEÍDO", "played": "REPRODUCIDO", "sender": "ENVIADO"}[env.ReceiptType]
+			prefix := colorize(ansiRCPT, "[RCPT]") + " "
+			if len(env.MessageIDs) == 1 {
+				e.humanInfof(prefix+"[%s] Chat:%s | Tipo:%s | MsgID:%s", k, colorize(ansiBold, env.ChatJID), tag, env.MessageIDs[0])
 			} else {
-				e.humanInfof(colorize(ansiDEFAULT, "[IDENTITY] ") + "Cambio de identidad (sin JID detectable)")
+				e.humanInfof(prefix+"[%s] Chat:%s | Tipo:%s | MsgIDs:%d", k, colorize(ansiBold, env.ChatJID), tag, len(env.MessageIDs))
+			}
+		}
+		if e.msgStore != nil {
+			ts := v.Timestamp
+			if ts.IsZero() {
+				ts = time.Now()
 			}
-			_ = e.writeEnvelopeToFolder(env)
-			e.sendEnvelopeToWebhook(ctx, env)
+			_ = e.msgStore.SaveReceipt(storageChatJID(env.ChatJID), env.MessageIDs, env.ReceiptType, env.SenderJID, v.IsFromMe, ts)
+		}
+		_ = e.writeEnvelopeToFolder(env)
+		e.sendEnvelopeToWebhook(ctx, env)
+		if h.OnReceipt != nil {
+			_ = h.OnReceipt(ctx, v)
+		}
 
-		default:
-			env := &ForwardEnvelope{EventType: fmt.Sprintf("%T", v), EventRaw: v}
-			e.humanInfof(colorize(ansiDEFAULT, "[EVENTO] ")+"%T", v)
-			_ = e.writeEnvelopeToFolder(env)
-			e.sendEnvelopeToWebhook(ctx, env)
+	case *events.ChatPresence:
+		env := &ForwardEnvelope{
+			EventType: "chat_presence",
+			EventRaw:  v,
+			ChatJID:   canonicalChatJID(v.Chat.String()),
+			SenderJID: v.Sender.String(),
+			Extra: map[string]any{
+				"state": string(v.State),
+				"media": string(v.Media),
+			},
 		}
-	})
+		prefix := colorize(ansiPRES, "[PRESENCIA][CHAT]") + " "
+		add := ""
+		if v.Media != "" {
+			add = " (" + string(v.Media) + ")"
+		}
+		e.humanInfof(prefix+"Chat:%s | %s%s", colorize(ansiBold, env.ChatJID), strings.ToUpper(string(v.State)), add)
+		_ = e.writeEnvelopeToFolder(env)
+		e.sendEnvelopeToWebhook(ctx, env)
+
+	case *events.Presence:
+		env := &ForwardEnvelope{
+			EventType: "presence",
+			EventRaw:  v,
+			SenderJID: canonicalChatJID(v.From.String()),
+			Extra: map[string]any{
+				"unavailable": v.Unavailable,
+				"last_seen":   v.LastSeen.UTC().Format(time.RFC3339),
+			},
+		}
+		if v.Unavailable {
+			e.humanInfof(colorize(ansiPRES, "[PRESENCIA] ")+"%s ahora OFFLINE | last_seen=%s", colorize(ansiBold, env.SenderJID), env.Extra["last_seen"])
+		} else {
+			e.humanInfof(colorize(ansiPRES, "[PRESENCIA] ")+"%s ahora ONLINE", colorize(ansiBold, env.SenderJID))
+		}
+		_ = e.writeEnvelopeToFolder(env)
+		e.sendEnvelopeToWebhook(ctx, env)
+		if h.OnPresence != nil {
+			_ = h.OnPresence(ctx, v)
+		}
+
+	case *events.GroupInfo:
+		env := &ForwardEnvelope{EventType: "group_update", EventRaw: v, ChatJID: canonicalChatJID(v.JID.String())}
+		e.humanInfof(colorize(ansiGROUP, "[GRUPO][UPDATE] ")+"JID:%s | (cambios en miembros/título/foto…)", colorize(ansiBold, env.ChatJID))
+		_ = e.writeEnvelopeToFolder(env)
+		e.sendEnvelopeToWebhook(ctx, env)
+		if h.OnGroupUpdate != nil {
+			_ = h.OnGroupUpdate(ctx, v)
+		}
+
+	case *events.JoinedGroup:
+		env := &ForwardEnvelope{EventType: "joined_group", EventRaw: v, ChatJID: canonicalChatJID(v.JID.String())}
+		e.humanInfof(colorize(ansiGROUP, "[GRUPO][JOINED] ")+"Te uniste a %s", colorize(ansiBold, env.ChatJID))
+		_ = e.writeEnvelopeToFolder(env)
+		e.sendEnvelopeToWebhook(ctx, env)
+
+	case *events.HistorySync:
+		env := &ForwardEnvelope{EventType: "history_sync", EventRaw: v}
+		e.humanInfof(colorize(ansiDEFAULT, "[HISTORY] ") + "Se recibió HistorySync (mensajes antiguos).")
+		_ = e.writeEnvelopeToFolder(env)
+		e.sendEnvelopeToWebhook(ctx, env)
+		// fuera del goroutine de eventos: un chunk puede traer miles de mensajes
+		go e.handleHistorySync(v)
+
+	case *events.Connected:
+		env := &ForwardEnvelope{EventType: "connected", EventRaw: v}
+		// 👉 Abre el gate: los envíos encolados durante la caída salen ahora
+		if reconnected, downtime := e.conn.markOnline(); reconnected {
+			env.EventType = "reconnected"
+			env.Extra = map[string]any{"downtime_ms": downtime.Milliseconds()}
+			e.humanInfof(colorize(ansiSTATE, "[ESTADO] ")+"RECONECTADO tras %s. Reenviando cola pendiente (%d).", downtime.Round(time.Second), e.sendQ.pending())
+		} else {
+			e.humanInfof(colorize(ansiSTATE, "[ESTADO] ") + "Autenticado y CONECTADO.")
+		}
+
+		// 👉 Reafirma presencia tras reconectar (según modo y auto-away)
+		_ = e.client.SendPresence(ctx, e.presence.current())
+		_ = e.writeEnvelopeToFolder(env)
+		e.sendEnvelopeToWebhook(ctx, env)
+
+	case *events.Disconnected:
+		env := &ForwardEnvelope{EventType: "disconnected", EventRaw: v}
+		e.conn.markOffline()
+		e.humanWarnf(colorize(ansiWARN, "[ESTADO] ") + "DESCONECTADO. Reintentando con backoff; los envíos quedan en cola.")
+		_ = e.writeEnvelopeToFolder(env)
+		e.sendEnvelopeToWebhook(ctx, env)
+		go e.reconnectLoop(ctx)
+
+	case *events.LoggedOut:
+		env := &ForwardEnvelope{EventType: "logged_out", EventRaw: v}
+		e.conn.markOffline()
+		e.humanWarnf(colorize(ansiWARN, "[ESTADO] ") + "Sesión cerrada. Puede requerir re-vinculación (QR).")
+		_ = e.writeEnvelopeToFolder(env)
+		e.sendEnvelopeToWebhook(ctx, env)
+
+	case *events.IdentityChange:
+		chatJID := extractJIDFromIdentityChange(v)
+		env := &ForwardEnvelope{
+			EventType: "events.IdentityChange",
+			EventRaw:  v,
+			ChatJID:   canonicalChatJID(chatJID),
+		}
+		if chatJID != "" {
+			e.humanInfof(colorize(ansiDEFAULT, "[IDENTITY] ")+"Cambio de identidad en %s", colorize(ansiBold, env.ChatJID))
+		} else {
+			e.humanInfof(colorize(ansiDEFAULT, "[IDENTITY] ") + "Cambio de identidad (sin JID detectable)")
+		}
+		_ = e.writeEnvelopeToFolder(env)
+		e.sendEnvelopeToWebhook(ctx, env)
+
+	default:
+		env := &ForwardEnvelope{EventType: fmt.Sprintf("%T", v), EventRaw: v}
+		e.humanInfof(colorize(ansiDEFAULT, "[EVENTO] ")+"%T", v)
+		_ = e.writeEnvelopeToFolder(env)
+		e.sendEnvelopeToWebhook(ctx, env)
+	}
 }
 
 //
@@ -1140,6 +3124,10 @@ type MediaInput struct {
 }
 
 func (e *Engine) SendText(ctx context.Context, to types.JID, text string) (string, error) {
+	return e.EnqueueSend(ctx, &SendJob{To: to, Text: text, Priority: PriorityHigh})
+}
+
+func (e *Engine) sendTextNow(ctx context.Context, to types.JID, text string) (string, error) {
 	base := func(ctx context.Context, to types.JID, payload any) (string, error) {
 		msg := &waProto.Message{Conversation: proto.String(text)}
 		resp, err := e.client.SendMessage(ctx, to, msg)
@@ -1176,6 +3164,10 @@ func (e *Engine) SendText(ctx context.Context, to types.JID, text string) (strin
 }
 
 func (e *Engine) SendMedia(ctx context.Context, to types.JID, in MediaInput) (string, error) {
+	return e.EnqueueSend(ctx, &SendJob{To: to, Media: &in, Priority: PriorityLow})
+}
+
+func (e *Engine) sendMediaNow(ctx context.Context, to types.JID, in MediaInput) (string, error) {
 	base := func(ctx context.Context, to types.JID, payload any) (string, error) {
 		respUp, err := e.client.Upload(ctx, in.Bytes, in.MediaType)
 
@@ -1314,6 +3306,144 @@ func (e *Engine) SendMedia(ctx context.Context, to types.JID, in MediaInput) (st
 	return fn(ctx, to, in)
 }
 
+// --- ubicación / reacciones
+
+func buildLocationMessage(lat, lng float64, name, address string) *waProto.Message {
+	loc := &waProto.LocationMessage{
+		DegreesLatitude:  proto.Float64(lat),
+		DegreesLongitude: proto.Float64(lng),
+	}
+	if name != "" {
+		loc.Name = proto.String(name)
+	}
+	if address != "" {
+		loc.Address = proto.String(address)
+	}
+	return &waProto.Message{LocationMessage: loc}
+}
+
+func (e *Engine) SendLocation(ctx context.Context, to types.JID, lat, lng float64, name, address string) (string, error) {
+	if lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return "", fmt.Errorf("invalid coordinates: %f,%f", lat, lng)
+	}
+	msg := buildLocationMessage(lat, lng, name, address)
+	base := func(ctx context.Context, to types.JID, payload any) (string, error) {
+		resp, err := e.client.SendMessage(ctx, to, msg)
+		if err != nil {
+			return "", err
+		}
+		loc := locationFromMessage(msg)
+		if e.msgStore != nil {
+			_ = e.msgStore.SaveMessage(
+				storageChatJID(to.String()),
+				resp.ID,
+				"me",
+				"",
+				time.Now(),
+				true,
+				sql.NullString{String: "location", Valid: true},
+				sql.NullString{String: locationSummary(loc), Valid: true},
+				sql.NullString{},
+			)
+		}
+		e.forwardOutgoingLocation(to, resp.ID, "", loc)
+		return resp.ID, nil
+	}
+	fn := WithRetry(3, 250*time.Millisecond, WithRateLimit(e.limiterSend, base))
+	return e.EnqueueSend(ctx, &SendJob{To: to, Priority: PriorityHigh, quiet: true, run: func(ctx context.Context) (string, error) {
+		return fn(ctx, to, msg)
+	}})
+}
+
+// SendReaction reacciona a targetID. sender es el autor del mensaje original
+// (EmptyJID si el mensaje es nuestro). emoji vacío quita la reacción.
+func (e *Engine) SendReaction(ctx context.Context, chat, sender types.JID, targetID, emoji string) (string, error) {
+	if strings.TrimSpace(targetID) == "" {
+		return "", errors.New("target message id required")
+	}
+	base := func(ctx context.Context, to types.JID, payload any) (string, error) {
+		msg := e.client.BuildReaction(chat, sender, types.MessageID(targetID), emoji)
+		resp, err := e.client.SendMessage(ctx, chat, msg)
+		if err != nil {
+			return "", err
+		}
+		react := reactionFromMessage(msg)
+		e.forwardOutgoingReaction(chat, resp.ID, react)
+		return resp.ID, nil
+	}
+	fn := WithRetry(3, 250*time.Millisecond, WithRateLimit(e.limiterSend, base))
+	return e.EnqueueSend(ctx, &SendJob{To: chat, Priority: PriorityHigh, run: func(ctx context.Context) (string, error) {
+		return fn(ctx, chat, emoji)
+	}})
+}
+
+// --- edición / borrado (revoke) de mensajes propios
+
+// ownMessageCheck valida contra el MessageStore que msgID exista y sea nuestro
+func (e *Engine) ownMessageCheck(to types.JID, msgID string) error {
+	if strings.TrimSpace(msgID) == "" {
+		return errors.New("message id required")
+	}
+	if e.msgStore == nil {
+		return nil
+	}
+	fromMe, err := e.msgStore.GetMessageFromMe(storageChatJID(to.String()), msgID)
+	if err != nil {
+		if errors.Is(err, ErrMessageNotFound) {
+			return fmt.Errorf("%w: %s in %s", ErrMessageNotFound, msgID, to.String())
+		}
+		return err
+	}
+	if !fromMe {
+		return fmt.Errorf("message %s was not sent by us", msgID)
+	}
+	return nil
+}
+
+func (e *Engine) EditMessage(ctx context.Context, to types.JID, msgID, newText string) (string, error) {
+	if err := e.ownMessageCheck(to, msgID); err != nil {
+		return "", err
+	}
+	base := func(ctx context.Context, to types.JID, payload any) (string, error) {
+		msg := e.client.BuildEdit(to, types.MessageID(msgID), &waProto.Message{Conversation: proto.String(newText)})
+		resp, err := e.client.SendMessage(ctx, to, msg)
+		if err != nil {
+			return "", err
+		}
+		if e.msgStore != nil {
+			_ = e.msgStore.UpdateMessageContent(storageChatJID(to.String()), msgID, newText)
+		}
+		e.forwardOutgoingProtocol(to, "message_edit", msgID, newText)
+		return resp.ID, nil
+	}
+	fn := WithRetry(3, 250*time.Millisecond, WithRateLimit(e.limiterSend, base))
+	return e.EnqueueSend(ctx, &SendJob{To: to, Priority: PriorityHigh, run: func(ctx context.Context) (string, error) {
+		return fn(ctx, to, newText)
+	}})
+}
+
+func (e *Engine) RevokeMessage(ctx context.Context, to types.JID, msgID string) (string, error) {
+	if err := e.ownMessageCheck(to, msgID); err != nil {
+		return "", err
+	}
+	base := func(ctx context.Context, to types.JID, payload any) (string, error) {
+		msg := e.client.BuildRevoke(to, types.EmptyJID, types.MessageID(msgID))
+		resp, err := e.client.SendMessage(ctx, to, msg)
+		if err != nil {
+			return "", err
+		}
+		if e.msgStore != nil {
+			_ = e.msgStore.MarkRevoked(storageChatJID(to.String()), msgID)
+		}
+		e.forwardOutgoingProtocol(to, "message_revoke", msgID, "")
+		return resp.ID, nil
+	}
+	fn := WithRetry(3, 250*time.Millisecond, WithRateLimit(e.limiterSend, base))
+	return e.EnqueueSend(ctx, &SendJob{To: to, Priority: PriorityHigh, run: func(ctx context.Context) (string, error) {
+		return fn(ctx, to, msgID)
+	}})
+}
+
 // --- receipts / presence
 
 func toMsgIDs(ids []string) []types.MessageID {
@@ -1332,7 +3462,19 @@ func (e *Engine) MarkRead(ctx context.Context, chat types.JID, ids []string) err
 		return nil
 	}
 	// 1:1 → sender vacío
-	return e.client.MarkRead(ctx, msgIDs, time.Now(), chat, types.EmptyJID)
+	if err := e.client.MarkRead(ctx, msgIDs, time.Now(), chat, types.EmptyJID); err != nil {
+		return err
+	}
+	e.recordOwnRead(chat, ids, string(types.ReceiptTypeRead))
+	return nil
+}
+
+// recordOwnRead deja constancia local de los acuses que enviamos (WA no nos los devuelve como evento)
+func (e *Engine) recordOwnRead(chat types.JID, ids []string, receiptType string) {
+	if e.msgStore == nil {
+		return
+	}
+	_ = e.msgStore.SaveReceipt(storageChatJID(canonicalChatJID(chat.String())), ids, receiptType, "", true, time.Now())
 }
 
 func (e *Engine) MarkReadWithSender(ctx context.Context, chat, sender types.JID, ids []string) error {
@@ -1341,7 +3483,11 @@ func (e *Engine) MarkReadWithSender(ctx context.Context, chat, sender types.JID,
 		return nil
 	}
 	// Grupos → sender obligatorio (todos los IDs deben ser del mismo remitente)
-	return e.client.MarkRead(ctx, msgIDs, time.Now(), chat, sender)
+	if err := e.client.MarkRead(ctx, msgIDs, time.Now(), chat, sender); err != nil {
+		return err
+	}
+	e.recordOwnRead(chat, ids, string(types.ReceiptTypeRead))
+	return nil
 }
 
 func (e *Engine) MarkPlayedVoice(ctx context.Context, chat, sender types.JID, ids []string) error {
@@ -1350,7 +3496,11 @@ func (e *Engine) MarkPlayedVoice(ctx context.Context, chat, sender types.JID, id
 		return nil
 	}
 	// “played” (notas de voz) en grupos → requiere sender
-	return e.client.MarkRead(ctx, msgIDs, time.Now(), chat, sender, types.ReceiptTypePlayed)
+	if err := e.client.MarkRead(ctx, msgIDs, time.Now(), chat, sender, types.ReceiptTypePlayed); err != nil {
+		return err
+	}
+	e.recordOwnRead(chat, ids, string(types.ReceiptTypePlayed))
+	return nil
 }
 
 // Nota: este stub alinea la firma con whserver/whbot y el endpoint /api/markread.
@@ -1361,8 +3511,32 @@ func (e *Engine) SetTyping(ctx context.Context, chat types.JID, typing bool, med
 	state := types.ChatPresencePaused
 	if typing {
 		state = types.ChatPresenceComposing
+		// "escribiendo" no se muestra con la cuenta unavailable: salir del auto-away
+		if e.presence.touch() {
+			_ = e.client.SendPresence(ctx, types.PresenceAvailable)
+		}
+	}
+	return e.chatPresence(ctx, chat, state, media)
+}
+
+// sendWithTyping muestra "escribiendo…" en chat durante cfg.Typing.Wait(text), envía con
+// send y después pausa el "escribiendo". Si falla el "escribiendo" se envía igual;
+// cancelar ctx durante la espera corta el envío.
+func (e *Engine) sendWithTyping(ctx context.Context, chat types.JID, text string, send func() (string, error)) (string, error) {
+	if err := e.SetTyping(ctx, chat, true, types.ChatPresenceMediaText); err != nil {
+		e.humanWarnf(colorize(ansiWARN, "[TYPING] ")+"No se pudo enviar composing a %s: %v", chat, err)
+		return send()
 	}
-	return e.client.SendChatPresence(ctx, chat, state, media)
+	defer func() { _ = e.SetTyping(context.WithoutCancel(ctx), chat, false, types.ChatPresenceMediaText) }()
+
+	t := time.NewTimer(e.cfg.Typing.Wait(text))
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	return send()
 }
 
 // --- grupos (stubs)
@@ -1475,133 +3649,1300 @@ func (e *Engine) DownloadMedia(ctx context.Context, info struct {
 // =======================
 //
 
+type SessionInfo struct {
+	LoggedIn  bool   `json:"logged_in"`
+	Connected bool   `json:"connected"`
+	JID       string `json:"jid,omitempty"`
+	PushName  string `json:"push_name,omitempty"`
+	Platform  string `json:"platform,omitempty"`
+}
+
+// Session describe el emparejamiento actual (logged_in=false => falta escanear QR)
+func (e *Engine) Session() SessionInfo {
+	cli := e.clientRef.Load()
+	if cli == nil || cli.Store == nil || cli.Store.ID == nil {
+		return SessionInfo{}
+	}
+	return SessionInfo{
+		LoggedIn:  true,
+		Connected: cli.IsConnected(),
+		JID:       cli.Store.ID.String(),
+		PushName:  cli.Store.PushName,
+		Platform:  cli.Store.Platform,
+	}
+}
+
+// Logout desvincula el dispositivo y borra la sesión local; requiere nuevo QR.
+func (e *Engine) Logout(ctx context.Context) error {
+	cli := e.clientRef.Load()
+	if cli == nil || cli.Store == nil || cli.Store.ID == nil {
+		return errors.New("not logged in")
+	}
+	e.conn.markOffline()
+	return cli.Logout(ctx)
+}
+
 type SendMessageRequest struct {
 	Recipient string `json:"recipient"`
 	Message   string `json:"message"`
-	MediaPath string `json:"media_path,omitempty"`
+	MediaPath string `json:"media_path,omitempty"` // relativo a MediaBaseDir
+
+	// Media remota (http/https), p. ej. fotos de vehículos del backend
+	MediaURL string `json:"media_url,omitempty"`
+
+	// Media inline (alternativa a media_path)
+	MediaB64      string `json:"media_b64,omitempty"`
+	MediaFileName string `json:"media_filename,omitempty"`
+	MediaMime     string `json:"media_mime,omitempty"`
+
+	// "escribiendo…" proporcional al largo de message antes de enviar (como whserver)
+	SimulateTyping bool `json:"simulate_typing,omitempty"`
 }
 
-type TypingRequest struct {
+func (e *Engine) maxMediaBytes() int64 {
+	if e.cfg.MaxMediaBytes > 0 {
+		return e.cfg.MaxMediaBytes
+	}
+	return 16 << 20
+}
+
+// resolveMediaPath ancla media_path a MediaBaseDir y rechaza escapes (../, absolutas fuera
+// de la base, symlinks hacia afuera) y archivos demasiado grandes.
+func (e *Engine) resolveMediaPath(p string) (string, error) {
+	if strings.TrimSpace(e.cfg.MediaBaseDir) == "" {
+		return "", errors.New("media_path disabled (no media base dir configured)")
+	}
+	base, err := filepath.Abs(e.cfg.MediaBaseDir)
+	if err != nil {
+		return "", errors.New("invalid media base dir")
+	}
+	if realBase, err := filepath.EvalSymlinks(base); err == nil {
+		base = realBase
+	}
+	inBase := func(p string) bool {
+		rel, err := filepath.Rel(base, p)
+		return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+	}
+	p = filepath.Clean(p)
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(base, p)
+	}
+	if !inBase(p) {
+		return "", errors.New("media_path outside allowed directory")
+	}
+	real, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", errors.New("media_path not found")
+	}
+	if p = real; !inBase(p) {
+		return "", errors.New("media_path outside allowed directory")
+	}
+	info, err := os.Stat(p)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", errors.New("media_path is not a regular file")
+	}
+	if info.Size() > e.maxMediaBytes() {
+		return "", fmt.Errorf("media exceeds %d bytes", e.maxMediaBytes())
+	}
+	return p, nil
+}
+
+// fetchMediaURL descarga media http(s) con timeout y tope de tamaño; el MIME sale
+// del Content-Type y, si no es útil, de la extensión del path.
+func (e *Engine) fetchMediaURL(ctx context.Context, rawURL, caption string) (MediaInput, error) {
+	u, err := neturl.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return MediaInput{}, errors.New("media_url must be an absolute http(s) url")
+	}
+	timeout := e.cfg.MediaFetchTimeout
+	if timeout <= 0 {
+		timeout = 15 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return MediaInput{}, err
+	}
+	client := e.mediaHTTP
+	if client == nil {
+		client = newMediaHTTPClient()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return MediaInput{}, fmt.Errorf("media_url fetch failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return MediaInput{}, fmt.Errorf("media_url fetch non-2xx: %d", resp.StatusCode)
+	}
+	max := e.maxMediaBytes()
+	if resp.ContentLength > max {
+		return MediaInput{}, fmt.Errorf("media exceeds %d bytes", max)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return MediaInput{}, fmt.Errorf("media_url read failed: %v", err)
+	}
+	if int64(len(data)) > max {
+		return MediaInput{}, fmt.Errorf("media exceeds %d bytes", max)
+	}
+
+	mimeType := ""
+	if ct, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil && ct != "application/octet-stream" {
+		mimeType = ct
+	}
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		name = ""
+	}
+	if filepath.Ext(name) == "" && mimeType != "" {
+		if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+			name = strings.TrimSuffix(name, ".") + exts[0]
+		}
+	}
+	return mediaInputFromBytes(data, name, mimeType, caption), nil
+}
+
+// newMediaHTTPClient cliente para media_url que evita SSRF: la IP se valida al
+// conectar (después de resolver DNS), así que también cubre cada redirect.
+func newMediaHTTPClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("media_url points to a non-public address (%s)", host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // un proxy saltaría el chequeo de IP
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return errors.New("redirect to non-http(s) url")
+			}
+			return nil
+		},
+	}
+}
+
+// isPublicIP descarta loopback, redes privadas, link-local (metadata de la nube),
+// multicast y no especificadas.
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// mediaInputFromBytes infiere MIME/MediaType por extensión (o mimeType si viene).
+func mediaInputFromBytes(data []byte, fileName, mimeType, caption string) MediaInput {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if mimeType == "" {
+		mimeType = mime.TypeByExtension(ext)
+	}
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	mediaType := wm.MediaDocument
+	switch ext {
+	case ".jpg", ".jpeg", ".png", ".webp", ".gif":
+		mediaType = wm.MediaImage
+	case ".mp4", ".mov", ".m4v", ".webm":
+		mediaType = wm.MediaVideo
+	case ".ogg", ".opus", ".mp3", ".m4a", ".wav":
+		mediaType = wm.MediaAudio
+	default:
+		switch {
+		case strings.HasPrefix(mimeType, "image/"):
+			mediaType = wm.MediaImage
+		case strings.HasPrefix(mimeType, "video/"):
+			mediaType = wm.MediaVideo
+		case strings.HasPrefix(mimeType, "audio/"):
+			mediaType = wm.MediaAudio
+		}
+	}
+	return MediaInput{
+		Bytes:     data,
+		Caption:   caption,
+		Mime:      mimeType,
+		MediaType: mediaType,
+		FileName:  fileName,
+	}
+}
+
+type LocationRequest struct {
+	Recipient string  `json:"recipient"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Name      string  `json:"name,omitempty"`
+	Address   string  `json:"address,omitempty"`
+}
+
+type ReactionRequest struct {
 	Recipient string `json:"recipient"`
-	Typing    bool   `json:"typing"`
-	Media     string `json:"media,omitempty"` // text|audio
+	MessageID string `json:"message_id"`
+	Emoji     string `json:"emoji"`            // vacío = quitar reacción
+	Sender    string `json:"sender,omitempty"` // autor del mensaje (grupos); 1:1 usa recipient
+	FromMe    bool   `json:"from_me,omitempty"`
 }
 
-type MarkReadRequest struct {
-	Sender      string   `json:"sender,omitempty"`
-	Recipient   string   `json:"recipient"`
-	MessageIDs  []string `json:"message_ids"`
-	ReceiptType string   `json:"receipt_type,omitempty"` // read|played (por ahora ignorado)
+// parseRecipientJID acepta número suelto, JID completo o @lid
+func parseRecipientJID(raw string) (types.JID, error) {
+	rcpt := canonicalChatJID(raw)
+	if rcpt == "" {
+		return types.JID{}, errors.New("recipient required")
+	}
+	if j, err := types.ParseJID(rcpt); err == nil {
+		return j, nil
+	}
+	if strings.HasSuffix(rcpt, "@lid") {
+		parts := strings.SplitN(rcpt, "@", 2)
+		return types.JID{User: parts[0], Server: "lid"}, nil
+	}
+	return types.JID{}, errors.New("bad jid")
+}
+
+// ScheduleRequest body de POST /api/schedule: send_at o delay (uno de los dos)
+type ScheduleRequest struct {
+	Recipient string `json:"recipient"`
+	Message   string `json:"message"`
+	SendAt    string `json:"send_at,omitempty"` // RFC3339
+	Delay     string `json:"delay,omitempty"`   // duración Go: "2h", "90m"
 }
 
-func (e *Engine) StartREST() {
-	// /api/send
-	http.HandleFunc("/api/send", func(w http.ResponseWriter, r *http.Request) {
+// GET /api/schedule: programados por página
+const scheduleListLimit = 500
+
+// BroadcastRequest body de /api/broadcast: el mismo texto (o media con caption) a varios destinatarios
+type BroadcastRequest struct {
+	Recipients []string `json:"recipients"`
+	Message    string   `json:"message"`
+	MediaPath  string   `json:"media_path,omitempty"` // relativo a MediaBaseDir
+	MediaURL   string   `json:"media_url,omitempty"`
+	DryRun     bool     `json:"dry_run,omitempty"` // solo validar destinatarios
+}
+
+// BroadcastResult resultado de un destinatario, en el orden del request
+type BroadcastResult struct {
+	Recipient string `json:"recipient"`
+	Success   bool   `json:"success"`
+	MessageID string `json:"message_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+
+	ScheduledID int64 `json:"scheduled_id,omitempty"` // diferido por horario de silencio
+}
+
+// Tope de destinatarios por /api/broadcast
+const broadcastMaxRecipients = 500
+
+// Broadcast envía a cada destinatario en orden, uno a la vez: send pasa por la cola de
+// salida y sus limiters, así que el ritmo lo marcan limiterSend/limiterMedia. Los JIDs
+// inválidos o repetidos fallan sin cortar el resto; si ctx se cancela, los pendientes
+// quedan como no enviados. send == nil = dry-run (solo valida).
+func (e *Engine) Broadcast(ctx context.Context, recipients []string, send func(ctx context.Context, to types.JID) (string, error)) []BroadcastResult {
+	results := make([]BroadcastResult, len(recipients))
+	seen := make(map[string]bool, len(recipients))
+	for i, raw := range recipients {
+		res := &results[i]
+		res.Recipient = raw
+		to, err := parseRecipientJID(raw)
+		switch {
+		case err != nil:
+			res.Error = err.Error()
+			continue
+		case seen[to.String()]:
+			res.Error = "duplicate recipient"
+			continue
+		}
+		seen[to.String()] = true
+		if err := ctx.Err(); err != nil {
+			res.Error = "not sent: " + err.Error()
+			continue
+		}
+		if send == nil {
+			res.Success = true
+			continue
+		}
+		id, err := send(ctx, to)
+		if err != nil {
+			res.Error = err.Error()
+			if qerr := (*QuietHoursError)(nil); errors.As(err, &qerr) {
+				res.ScheduledID = qerr.ScheduledID
+			}
+			continue
+		}
+		res.Success, res.MessageID = true, id
+	}
+	return results
+}
+
+type EditRequest struct {
+	Recipient string `json:"recipient"`
+	MessageID string `json:"message_id"`
+	Message   string `json:"message"`
+}
+
+type RevokeRequest struct {
+	Recipient string `json:"recipient"`
+	MessageID string `json:"message_id"`
+}
+
+type TypingRequest struct {
+	Recipient string `json:"recipient"`
+	Typing    bool   `json:"typing"`
+	Media     string `json:"media,omitempty"` // text|audio
+}
+
+type PresenceRequest struct {
+	Mode string `json:"mode"` // available|unavailable
+}
+
+// MediaDownloadRequest body de POST /api/media/download: el "ticket" de media que trae el
+// envelope de un mensaje (mismos nombres de campo), así el server lo reenvía tal cual.
+type MediaDownloadRequest struct {
+	Type             string `json:"type"` // image|audio|video|document
+	Mimetype         string `json:"mimetype"`
+	URL              string `json:"url"`
+	DirectPath       string `json:"direct_path"`
+	MediaKeyB64      string `json:"media_key_b64"`
+	FileSHA256B64    string `json:"file_sha256_b64"`
+	FileEncSHA256B64 string `json:"file_enc_sha256_b64"`
+	FileLength       uint64 `json:"file_length"`
+}
+
+var mediaTypesByName = map[string]wm.MediaType{
+	"image":    wm.MediaImage,
+	"audio":    wm.MediaAudio,
+	"video":    wm.MediaVideo,
+	"document": wm.MediaDocument,
+}
+
+// downloadable arma el ticket para client.Download
+func (req MediaDownloadRequest) downloadable() (*downloadable, error) {
+	mt, ok := mediaTypesByName[strings.ToLower(req.Type)]
+	if !ok {
+		return nil, fmt.Errorf("invalid media type %q", req.Type)
+	}
+	d := &downloadable{URL: req.URL, DirectPath: req.DirectPath, FileLength: req.FileLength, MT: mt}
+	var err error
+	if d.MediaKey, err = base64.StdEncoding.DecodeString(req.MediaKeyB64); err != nil || len(d.MediaKey) == 0 {
+		return nil, errors.New("invalid media_key_b64")
+	}
+	if d.FileSHA256, err = base64.StdEncoding.DecodeString(req.FileSHA256B64); err != nil {
+		return nil, errors.New("invalid file_sha256_b64")
+	}
+	if d.FileEncSHA256, err = base64.StdEncoding.DecodeString(req.FileEncSHA256B64); err != nil {
+		return nil, errors.New("invalid file_enc_sha256_b64")
+	}
+	if d.DirectPath == "" && d.URL == "" {
+		return nil, errors.New("url or direct_path required")
+	}
+	return d, nil
+}
+
+type MarkReadRequest struct {
+	Sender      string   `json:"sender,omitempty"`
+	Recipient   string   `json:"recipient"`
+	MessageIDs  []string `json:"message_ids"`
+	ReceiptType string   `json:"receipt_type,omitempty"` // read|played (por ahora ignorado)
+}
+
+type ReplayRequest struct {
+	Category string `json:"category"`           // contacts|groups|devices|system
+	Since    string `json:"since,omitempty"`    // RFC3339
+	DryRun   bool   `json:"dry_run,omitempty"`  // solo contar
+	EveryMS  int    `json:"every_ms,omitempty"` // ritmo de reenvío
+}
+
+// PruneRequest body de /api/messages/prune ({} = retención configurada)
+type PruneRequest struct {
+	OlderThan string `json:"older_than,omitempty"` // RFC3339
+	Days      int    `json:"days,omitempty"`       // o: más viejos que N días
+}
+
+// readiness resume el estado real de conexión para /readyz
+func (e *Engine) readiness() (ready bool, body map[string]any) {
+	connected := e.conn.up() && e.clientConnected()
+	storeOK := e.msgStore != nil && e.msgStore.Ping() == nil
+	body = map[string]any{
+		"connected": connected,
+		"store_ok":  storeOK,
+		"jid":       "",
+	}
+	if connected && e.client != nil && e.client.Store.ID != nil {
+		body["jid"] = e.client.Store.ID.String()
+	}
+	if ns := e.lastEventAt.Load(); ns > 0 {
+		body["last_event_at"] = time.Unix(0, ns).UTC().Format(time.RFC3339)
+	}
+	return connected && storeOK, body
+}
+
+// decodeJSONBody limita el tamaño del body y decodifica en modo estricto:
+// rechaza campos desconocidos y basura después del objeto JSON.
+func (e *Engine) decodeJSONBody(w http.ResponseWriter, r *http.Request, dst any) error {
+	return e.decodeJSONBodyLimit(w, r, dst, e.restBodyLimit())
+}
+
+func (e *Engine) restBodyLimit() int64 {
+	if e.cfg.RESTBodyLimit > 0 {
+		return e.cfg.RESTBodyLimit
+	}
+	return 1 << 20
+}
+
+// mediaBodyLimit tope de body de las rutas que aceptan media_b64: la media máxima
+// en base64 más margen para el resto de los campos (nunca menos que el tope general)
+func (e *Engine) mediaBodyLimit() int64 {
+	limit := int64(base64.StdEncoding.EncodedLen(int(e.maxMediaBytes()))) + 64<<10
+	if rest := e.restBodyLimit(); rest > limit {
+		return rest
+	}
+	return limit
+}
+
+func (e *Engine) decodeJSONBodyLimit(w http.ResponseWriter, r *http.Request, dst any, limit int64) error {
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		var maxErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxErr):
+			return fmt.Errorf("body exceeds %d bytes", limit)
+		case errors.Is(err, io.EOF):
+			return errors.New("empty body")
+		case strings.HasPrefix(err.Error(), "json: unknown field"):
+			return errors.New(strings.TrimPrefix(err.Error(), "json: "))
+		default:
+			return fmt.Errorf("invalid json: %v", err)
+		}
+	}
+	if dec.More() {
+		return errors.New("unexpected data after json object")
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return errors.New("unexpected data after json object")
+	}
+	return nil
+}
+
+// requireToken exige "Authorization: Bearer <APIToken>" en el control plane.
+// Sin token configurado solo se permite si AllowNoTokenDev está activo.
+func (e *Engine) requireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tok := e.cfg.APIToken
+		if tok == "" {
+			if e.cfg.AllowNoTokenDev {
+				next(w, r)
+				return
+			}
+			http.Error(w, "unauthorized: engine API token not configured", http.StatusUnauthorized)
+			return
+		}
+		got := ""
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			got = strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+		}
+		if got == "" || !hmac.Equal([]byte(got), []byte(tok)) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (e *Engine) StartREST() {
+	handler := e.restHandler()
+	addr := fmt.Sprintf(":%d", e.cfg.HTTPPort)
+	go func() {
+		if err := http.ListenAndServe(addr, handler); err != nil {
+			if e.logger != nil {
+				e.logger.Warnf("REST server error on %s: %v", addr, err)
+			}
+		}
+	}()
+}
+
+// restHandler rutas del REST (health, métricas y /api/*)
+func (e *Engine) restHandler() http.Handler {
+	// Mux propio: no compartir http.DefaultServeMux con otros servidores del proceso
+	mux := http.NewServeMux()
+	if e.cfg.APIToken == "" && e.cfg.AllowNoTokenDev {
+		e.humanWarnf(colorize(ansiWARN, "[REST] ") + "API sin token (modo dev): cualquiera con acceso al puerto puede enviar mensajes.")
+	}
+
+	// /healthz: el proceso está vivo
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	// /metrics: Prometheus (mensajes in/out, intentos y fallos del webhook)
+	mux.Handle("/metrics", metrics.Handler())
+
+	// /readyz: 503 mientras no haya conexión con WhatsApp (p. ej. esperando QR) o el store esté caído
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		ready, body := e.readiness()
+		w.Header().Set("Content-Type", "application/json")
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		body["ready"] = ready
+		_ = json.NewEncoder(w).Encode(body)
+	})
+
+	// /api/session
+	mux.HandleFunc("/api/session", e.requireToken(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(e.Session())
+	}))
+
+	// /api/unread (chats con entrantes sin leer)
+	mux.HandleFunc("/api/unread", e.requireToken(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if e.msgStore == nil {
+			http.Error(w, "message store disabled", http.StatusServiceUnavailable)
+			return
+		}
+		chats, err := e.msgStore.GetUnreadChats()
+		if err != nil {
+			http.Error(w, "store error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"count": len(chats), "chats": chats})
+	}))
+
+	// /api/message-status?chat=...&id=...
+	mux.HandleFunc("/api/message-status", e.requireToken(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if e.msgStore == nil {
+			http.Error(w, "message store disabled", http.StatusServiceUnavailable)
+			return
+		}
+		chat := strings.TrimSpace(r.URL.Query().Get("chat"))
+		id := strings.TrimSpace(r.URL.Query().Get("id"))
+		if chat == "" || id == "" {
+			http.Error(w, "chat and id required", http.StatusBadRequest)
+			return
+		}
+		status, seen, err := e.msgStore.GetMessageStatus(storageChatJID(canonicalChatJID(chat)), id)
+		if errors.Is(err, ErrMessageNotFound) {
+			http.Error(w, "message not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "store error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"chat_jid": chat, "message_id": id, "status": status, "timestamps": seen})
+	}))
+
+	// /api/transcript: conversación completa de un chat (auditoría), paginada hacia atrás
+	mux.HandleFunc("/api/transcript", e.requireToken(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if e.msgStore == nil {
+			http.Error(w, "message store disabled", http.StatusServiceUnavailable)
+			return
+		}
+		q := r.URL.Query()
+		chat := strings.TrimSpace(q.Get("chat"))
+		if chat == "" {
+			http.Error(w, "chat required", http.StatusBadRequest)
+			return
+		}
+		limit := transcriptDefaultLimit
+		if raw := q.Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n <= 0 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = min(n, transcriptMaxLimit)
+		}
+		var before time.Time
+		if raw := q.Get("before"); raw != "" {
+			t, err := time.Parse(time.RFC3339Nano, raw)
+			if err != nil {
+				http.Error(w, "invalid before (RFC3339)", http.StatusBadRequest)
+				return
+			}
+			before = t
+		}
+		beforeID := q.Get("before_id")
+		if beforeID != "" && before.IsZero() {
+			http.Error(w, "before_id requires before", http.StatusBadRequest)
+			return
+		}
+
+		jid := storageChatJID(canonicalChatJID(chat))
+		msgs, err := e.msgStore.GetRecentMessages(jid, limit, before, beforeID)
+		if err != nil {
+			http.Error(w, "store error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// página llena: puede haber más atrás (cursor = timestamp + id del más antiguo)
+		nextBefore, nextBeforeID := "", ""
+		if len(msgs) == limit {
+			nextBefore, _ = msgs[0]["timestamp"].(string)
+			nextBeforeID, _ = msgs[0]["id"].(string)
+		}
+
+		if q.Get("format") == "text" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="transcript-%s.txt"`, sanitizePathPart(jid)))
+			if nextBefore != "" {
+				w.Header().Set("X-Next-Before", nextBefore)
+				w.Header().Set("X-Next-Before-Id", nextBeforeID)
+			}
+			_, _ = io.WriteString(w, formatTranscript(msgs))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"chat_jid":    jid,
+			"count":       len(msgs),
+			"messages":    msgs,
+			"next_before":    nextBefore,
+			"next_before_id": nextBeforeID,
+		})
+	}))
+
+	// /api/messages/search?q=hilux&limit=50: mensajes guardados que mencionan los términos
+	mux.HandleFunc("/api/messages/search", e.requireToken(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if e.msgStore == nil {
+			http.Error(w, "message store disabled", http.StatusServiceUnavailable)
+			return
+		}
+		q := strings.TrimSpace(r.URL.Query().Get("q"))
+		if q == "" || len([]rune(q)) > searchMaxQuery {
+			http.Error(w, fmt.Sprintf("q required (max %d chars)", searchMaxQuery), http.StatusBadRequest)
+			return
+		}
+		limit := searchDefaultLimit
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n <= 0 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = min(n, searchMaxLimit)
+		}
+		msgs, err := e.msgStore.SearchMessages(q, limit)
+		if err != nil {
+			http.Error(w, "store error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		mode := "like"
+		if e.msgStore.fts {
+			mode = "fts5"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"query": q, "mode": mode, "count": len(msgs), "messages": msgs})
+	}))
+
+	// /api/messages/prune (poda manual; borra datos, exige además el secreto admin)
+	mux.HandleFunc("/api/messages/prune", e.requireToken(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		got := r.Header.Get("X-Engine-Admin-Secret")
+		if e.cfg.AdminSecret == "" || !hmac.Equal([]byte(got), []byte(e.cfg.AdminSecret)) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if e.msgStore == nil {
+			http.Error(w, "message store disabled", http.StatusServiceUnavailable)
+			return
+		}
+		var req PruneRequest
+		if err := e.decodeJSONBody(w, r, &req); err != nil {
+			http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		var olderThan time.Time
+		switch {
+		case req.OlderThan != "":
+			t, err := time.Parse(time.RFC3339, req.OlderThan)
+			if err != nil {
+				http.Error(w, "bad older_than (RFC3339)", http.StatusBadRequest)
+				return
+			}
+			olderThan = t
+		case req.Days > 0:
+			olderThan = time.Now().AddDate(0, 0, -req.Days)
+		case e.cfg.MsgRetention > 0:
+			olderThan = time.Now().Add(-e.cfg.MsgRetention)
+		default:
+			http.Error(w, "older_than or days required (no retention configured)", http.StatusBadRequest)
+			return
+		}
+		n, err := e.msgStore.PruneMessages(olderThan)
+		w.Header().Set("Content-Type", "application/json")
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(map[string]any{"success": false, "message": err.Error(), "deleted": n})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"success": true, "deleted": n, "older_than": olderThan.UTC().Format(time.RFC3339)})
+	}))
+
+	// /api/replay (reenvía NDJSON del outbox al webhook)
+	mux.HandleFunc("/api/replay", e.requireToken(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req ReplayRequest
+		if err := e.decodeJSONBody(w, r, &req); err != nil {
+			http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		opts := ReplayOptions{DryRun: req.DryRun, Every: time.Duration(req.EveryMS) * time.Millisecond}
+		if req.Since != "" {
+			t, err := time.Parse(time.RFC3339, req.Since)
+			if err != nil {
+				http.Error(w, "bad since (RFC3339)", http.StatusBadRequest)
+				return
+			}
+			opts.Since = t
+		}
+		res, err := e.ReplayFolder(r.Context(), req.Category, opts)
+		w.Header().Set("Content-Type", "application/json")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]any{"success": false, "message": err.Error(), "result": res})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"success": true, "result": res})
+	}))
+
+	// /api/replay-dead (reintenta envelopes que agotaron los reintentos del webhook)
+	mux.HandleFunc("/api/replay-dead", e.requireToken(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req ReplayRequest
+		if r.ContentLength != 0 {
+			if err := e.decodeJSONBody(w, r, &req); err != nil {
+				http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		res, err := e.ReplayDead(r.Context(), ReplayOptions{DryRun: req.DryRun, Every: time.Duration(req.EveryMS) * time.Millisecond})
+		w.Header().Set("Content-Type", "application/json")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]any{"success": false, "message": err.Error(), "result": res})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"success": true, "result": res})
+	}))
+
+	// /api/logout (protegido por secreto compartido)
+	mux.HandleFunc("/api/logout", e.requireToken(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		got := r.Header.Get("X-Engine-Admin-Secret")
+		if e.cfg.AdminSecret == "" || !hmac.Equal([]byte(got), []byte(e.cfg.AdminSecret)) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		type resp struct {
+			Success bool
+			Message string
+		}
+		if err := e.Logout(r.Context()); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(resp{false, err.Error()})
+			return
+		}
+		e.humanWarnf(colorize(ansiWARN, "[ESTADO] ") + "Logout solicitado vía REST. Se requiere nuevo QR.")
+		_ = json.NewEncoder(w).Encode(resp{true, "logged out"})
+	}))
+
+	// /api/send
+	mux.HandleFunc("/api/send", e.requireToken(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req SendMessageRequest
+		if err := e.decodeJSONBodyLimit(w, r, &req, e.mediaBodyLimit()); err != nil { // admite media_b64
+			http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		to, err := parseRecipientJID(req.Recipient)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Preparar texto o media (validaciones antes de cualquier "escribiendo…")
+		var send func() (string, error)
+		switch {
+		case req.MediaPath != "":
+			path, pathErr := e.resolveMediaPath(req.MediaPath)
+			if pathErr != nil {
+				http.Error(w, pathErr.Error(), http.StatusBadRequest)
+				return
+			}
+			data, readErr := os.ReadFile(path)
+			if readErr != nil {
+				http.Error(w, "cannot read media_path", http.StatusBadRequest)
+				return
+			}
+			send = func() (string, error) {
+				return e.SendMedia(r.Context(), to, mediaInputFromBytes(data, filepath.Base(path), "", req.Message))
+			}
+		case req.MediaURL != "":
+			mi, fetchErr := e.fetchMediaURL(r.Context(), req.MediaURL, req.Message)
+			if fetchErr != nil {
+				http.Error(w, fetchErr.Error(), http.StatusBadRequest)
+				return
+			}
+			send = func() (string, error) { return e.SendMedia(r.Context(), to, mi) }
+		case req.MediaB64 != "":
+			data, decErr := base64.StdEncoding.DecodeString(req.MediaB64)
+			if decErr != nil {
+				http.Error(w, "invalid media_b64", http.StatusBadRequest)
+				return
+			}
+			if int64(len(data)) > e.maxMediaBytes() {
+				http.Error(w, fmt.Sprintf("media exceeds %d bytes", e.maxMediaBytes()), http.StatusBadRequest)
+				return
+			}
+			name := filepath.Base(strings.TrimSpace(req.MediaFileName))
+			if name == "." || name == "/" {
+				name = ""
+			}
+			send = func() (string, error) {
+				return e.SendMedia(r.Context(), to, mediaInputFromBytes(data, name, req.MediaMime, req.Message))
+			}
+		default:
+			send = func() (string, error) { return e.SendText(r.Context(), to, req.Message) }
+		}
+
+		simulate := req.SimulateTyping
+		if simulate {
+			// en horario de silencio no tiene sentido "escribir" algo que no va a salir
+			_, quiet := e.quietUntil(to, time.Now())
+			simulate = !quiet
+		}
+		var id string
+		if simulate {
+			id, err = e.sendWithTyping(r.Context(), to, req.Message, send)
+		} else {
+			id, err = send()
+		}
+
+		type resp struct {
+			Success bool
+			Message string
+		}
+		if qerr := (*QuietHoursError)(nil); errors.As(err, &qerr) {
+			// horario de silencio: 202 si quedó programado, 409 si se descartó
+			if qerr.ScheduledID > 0 {
+				w.WriteHeader(http.StatusAccepted)
+				_ = json.NewEncoder(w).Encode(resp{true, err.Error()})
+				return
+			}
+			w.WriteHeader(http.StatusConflict)
+			_ = json.NewEncoder(w).Encode(resp{false, err.Error()})
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(resp{false, err.Error()})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(resp{true, "sent: " + id})
+	}))
+
+	// /api/broadcast (mismo mensaje a varios destinatarios, prioridad baja en la cola)
+	mux.HandleFunc("/api/broadcast", e.requireToken(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req BroadcastRequest
+		if err := e.decodeJSONBody(w, r, &req); err != nil {
+			http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(req.Recipients) == 0 || len(req.Recipients) > broadcastMaxRecipients {
+			http.Error(w, fmt.Sprintf("recipients required (max %d)", broadcastMaxRecipients), http.StatusBadRequest)
+			return
+		}
+		if req.MediaPath != "" && req.MediaURL != "" {
+			http.Error(w, "media_path and media_url are exclusive", http.StatusBadRequest)
+			return
+		}
+		if strings.TrimSpace(req.Message) == "" && req.MediaPath == "" && req.MediaURL == "" {
+			http.Error(w, "message or media required", http.StatusBadRequest)
+			return
+		}
+
+		// la media se carga una sola vez para todos
+		var media *MediaInput
+		switch {
+		case req.MediaPath != "":
+			path, err := e.resolveMediaPath(req.MediaPath)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				http.Error(w, "cannot read media_path", http.StatusBadRequest)
+				return
+			}
+			mi := mediaInputFromBytes(data, filepath.Base(path), "", req.Message)
+			media = &mi
+		case req.MediaURL != "" && !req.DryRun:
+			mi, err := e.fetchMediaURL(r.Context(), req.MediaURL, req.Message)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			media = &mi
+		}
+
+		var send func(ctx context.Context, to types.JID) (string, error)
+		if !req.DryRun {
+			if !e.conn.up() {
+				http.Error(w, "not connected", http.StatusServiceUnavailable)
+				return
+			}
+			send = func(ctx context.Context, to types.JID) (string, error) {
+				if media != nil {
+					return e.SendMedia(ctx, to, *media)
+				}
+				return e.EnqueueSend(ctx, &SendJob{To: to, Text: req.Message, Priority: PriorityLow})
+			}
+		}
+		results := e.Broadcast(r.Context(), req.Recipients, send)
+
+		sent, deferred, failed := 0, 0, 0
+		for _, res := range results {
+			switch {
+			case res.Success:
+				sent++
+			case res.ScheduledID > 0:
+				deferred++
+			default:
+				failed++
+			}
+		}
+		if !req.DryRun {
+			e.humanInfof(colorize(ansiOUT, "[BROADCAST] ")+"%d enviados, %d diferidos, %d fallidos de %d destinatarios", sent, deferred, failed, len(results))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"success": failed == 0, "dry_run": req.DryRun,
+			"sent": sent, "deferred": deferred, "failed": failed, "results": results,
+		})
+	}))
+
+	// /api/schedule (POST programa un envío, GET lista) y /api/schedule/{id} (DELETE cancela)
+	mux.HandleFunc("/api/schedule", e.requireToken(func(w http.ResponseWriter, r *http.Request) {
+		if e.msgStore == nil {
+			http.Error(w, "message store disabled", http.StatusServiceUnavailable)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			status := r.URL.Query().Get("status")
+			switch status {
+			case "":
+				status = ScheduledPending
+			case "all":
+				status = ""
+			case ScheduledPending, ScheduledSending, ScheduledSent, ScheduledFailed, ScheduledCanceled:
+			default:
+				http.Error(w, "invalid status", http.StatusBadRequest)
+				return
+			}
+			list, err := e.msgStore.ListScheduled(status, scheduleListLimit)
+			if err != nil {
+				http.Error(w, "store error: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]any{"count": len(list), "scheduled": list})
+
+		case http.MethodPost:
+			var req ScheduleRequest
+			if err := e.decodeJSONBody(w, r, &req); err != nil {
+				http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			to, err := parseRecipientJID(req.Recipient)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if strings.TrimSpace(req.Message) == "" {
+				http.Error(w, "message required", http.StatusBadRequest)
+				return
+			}
+			var sendAt time.Time
+			switch {
+			case req.SendAt != "" && req.Delay != "":
+				http.Error(w, "send_at and delay are exclusive", http.StatusBadRequest)
+				return
+			case req.SendAt != "":
+				if sendAt, err = time.Parse(time.RFC3339, req.SendAt); err != nil {
+					http.Error(w, "bad send_at (RFC3339)", http.StatusBadRequest)
+					return
+				}
+			case req.Delay != "":
+				d, err := time.ParseDuration(req.Delay)
+				if err != nil || d < 0 {
+					http.Error(w, "bad delay (e.g. 2h, 90m)", http.StatusBadRequest)
+					return
+				}
+				sendAt = time.Now().Add(d)
+			default:
+				http.Error(w, "send_at or delay required", http.StatusBadRequest)
+				return
+			}
+			id, err := e.msgStore.ScheduleMessage(to.String(), req.Message, sendAt)
+			if err != nil {
+				http.Error(w, "store error: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			e.humanInfof(colorize(ansiSTATE, "[SCHEDULE] ")+"#%d para %s a las %s", id, to, sendAt.Format(time.RFC3339))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(map[string]any{"success": true, "id": id, "send_at": sendAt.UTC().Format(time.RFC3339)})
+
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	mux.HandleFunc("/api/schedule/{id}", e.requireToken(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if e.msgStore == nil {
+			http.Error(w, "message store disabled", http.StatusServiceUnavailable)
+			return
+		}
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid id", http.StatusBadRequest)
+			return
+		}
+		if err := e.msgStore.CancelScheduled(id); err != nil {
+			if errors.Is(err, ErrScheduledNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, "store error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"success": true, "id": id, "status": ScheduledCanceled})
+	}))
+
+	// /api/location
+	mux.HandleFunc("/api/location", e.requireToken(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req LocationRequest
+		if err := e.decodeJSONBody(w, r, &req); err != nil {
+			http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		to, err := parseRecipientJID(req.Recipient)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		type resp struct {
+			Success bool
+			Message string
+		}
+		id, err := e.SendLocation(r.Context(), to, req.Latitude, req.Longitude, req.Name, req.Address)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(resp{false, err.Error()})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(resp{true, "sent: " + id})
+	}))
+
+	// /api/reaction
+	mux.HandleFunc("/api/reaction", e.requireToken(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
-
-		var req SendMessageRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "bad request", http.StatusBadRequest)
-			return
-		}
-
-		// Parse recipient → types.JID
-		var to types.JID
-		rcpt := canonicalChatJID(req.Recipient)
-		if strings.Contains(rcpt, "@") {
-		    if j, err := types.ParseJID(rcpt); err == nil {
-		        to = j
-		    } else if strings.HasSuffix(rcpt, "@lid") {
-		        parts := strings.SplitN(rcpt, "@", 2)
-		        to = types.JID{User: parts[0], Server: "lid"}
-		    } else {
-		        http.Error(w, "bad jid", http.StatusBadRequest)
-		        return
-		    }
-		} else {
-		    to = types.JID{User: rcpt, Server: "s.whatsapp.net"}
+		var req ReactionRequest
+		if err := e.decodeJSONBody(w, r, &req); err != nil {
+			http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+			return
 		}
-
-
-		// Enviar texto o media
-		var id string
-		var err error
-		if req.MediaPath == "" {
-			id, err = e.SendText(r.Context(), to, req.Message)
-		} else {
-			// dentro del handler /api/send, en el else de MediaPath:
-			data, readErr := os.ReadFile(req.MediaPath)
-			if readErr != nil {
-				http.Error(w, readErr.Error(), http.StatusBadRequest)
-				return
-			}
-
-			ext := strings.ToLower(filepath.Ext(req.MediaPath))
-			mimeType := mime.TypeByExtension(ext)
-			if mimeType == "" {
-				mimeType = "application/octet-stream"
-			}
-
-			mediaType := wm.MediaDocument
-			switch ext {
-			case ".jpg", ".jpeg", ".png", ".webp", ".gif":
-				mediaType = wm.MediaImage
-			case ".mp4", ".mov", ".m4v", ".webm":
-				mediaType = wm.MediaVideo
-			case ".ogg", ".opus", ".mp3", ".m4a", ".wav":
-				mediaType = wm.MediaAudio
+		chat, err := parseRecipientJID(req.Recipient)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sender := types.EmptyJID
+		if !req.FromMe {
+			sender = chat
+			if strings.TrimSpace(req.Sender) != "" {
+				if sender, err = parseRecipientJID(req.Sender); err != nil {
+					http.Error(w, "bad sender jid", http.StatusBadRequest)
+					return
+				}
 			}
+		}
+		type resp struct {
+			Success bool
+			Message string
+		}
+		id, err := e.SendReaction(r.Context(), chat, sender, req.MessageID, req.Emoji)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(resp{false, err.Error()})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(resp{true, "sent: " + id})
+	}))
 
-			mi := MediaInput{
-				Bytes:     data,
-				Caption:   req.Message,
-				Mime:      mimeType,
-				MediaType: mediaType,
-				FileName:  filepath.Base(req.MediaPath),
+	// /api/edit
+	mux.HandleFunc("/api/edit", e.requireToken(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req EditRequest
+		if err := e.decodeJSONBody(w, r, &req); err != nil {
+			http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		to, err := parseRecipientJID(req.Recipient)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if strings.TrimSpace(req.Message) == "" {
+			http.Error(w, "message required", http.StatusBadRequest)
+			return
+		}
+		type resp struct {
+			Success bool
+			Message string
+		}
+		id, err := e.EditMessage(r.Context(), to, req.MessageID, req.Message)
+		if err != nil {
+			code := http.StatusInternalServerError
+			if errors.Is(err, ErrMessageNotFound) {
+				code = http.StatusNotFound
 			}
-			id, err = e.SendMedia(r.Context(), to, mi)
+			w.WriteHeader(code)
+			_ = json.NewEncoder(w).Encode(resp{false, err.Error()})
+			return
 		}
+		_ = json.NewEncoder(w).Encode(resp{true, "edited: " + id})
+	}))
 
+	// /api/revoke
+	mux.HandleFunc("/api/revoke", e.requireToken(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req RevokeRequest
+		if err := e.decodeJSONBody(w, r, &req); err != nil {
+			http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		to, err := parseRecipientJID(req.Recipient)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		type resp struct {
 			Success bool
 			Message string
 		}
+		id, err := e.RevokeMessage(r.Context(), to, req.MessageID)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			code := http.StatusInternalServerError
+			if errors.Is(err, ErrMessageNotFound) {
+				code = http.StatusNotFound
+			}
+			w.WriteHeader(code)
 			_ = json.NewEncoder(w).Encode(resp{false, err.Error()})
 			return
 		}
-		_ = json.NewEncoder(w).Encode(resp{true, "sent: " + id})
-	})
+		_ = json.NewEncoder(w).Encode(resp{true, "revoked: " + id})
+	}))
 
 	// /api/typing
-	http.HandleFunc("/api/typing", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/api/typing", e.requireToken(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
+		if !e.conn.up() {
+			http.Error(w, "not connected", http.StatusServiceUnavailable)
+			return
+		}
 
 		var req TypingRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "bad request", http.StatusBadRequest)
+		if err := e.decodeJSONBody(w, r, &req); err != nil {
+			http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		rcpt := canonicalChatJID(req.Recipient)
-		j, err := types.ParseJID(rcpt)
+		to, err := parseRecipientJID(req.Recipient)
 		if err != nil {
-		    if strings.HasSuffix(rcpt, "@lid") {
-		        parts := strings.SplitN(rcpt, "@", 2)
-		        j = types.JID{User: parts[0], Server: "lid"}
-		    } else {
-		        http.Error(w, "bad jid", http.StatusBadRequest)
-		        return
-		    }
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
-		to := j
 
 		media := types.ChatPresenceMediaText
 		if strings.ToLower(req.Media) == "audio" {
@@ -1620,48 +4961,107 @@ func (e *Engine) StartREST() {
 			return
 		}
 		_ = json.NewEncoder(w).Encode(resp{true, "typing updated"})
-	})
+	}))
+
+	// /api/presence (modo de presencia global en caliente)
+	mux.HandleFunc("/api/presence", e.requireToken(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req PresenceRequest
+		if err := e.decodeJSONBody(w, r, &req); err != nil {
+			http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		mode, err := parsePresenceMode(req.Mode)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		e.presence.set(mode)
+
+		type resp struct {
+			Success bool
+			Message string
+		}
+		// sin conexión se aplica al reconectar
+		if e.conn.up() {
+			if err := e.client.SendPresence(r.Context(), mode); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				_ = json.NewEncoder(w).Encode(resp{false, err.Error()})
+				return
+			}
+		}
+		_ = json.NewEncoder(w).Encode(resp{true, "presence " + string(mode)})
+	}))
+
+	// /api/media/download: bytes descifrados de la media de un mensaje (p. ej. notas de voz a transcribir)
+	mux.HandleFunc("/api/media/download", e.requireToken(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req MediaDownloadRequest
+		if err := e.decodeJSONBody(w, r, &req); err != nil {
+			http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		d, err := req.downloadable()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.FileLength > uint64(e.maxMediaBytes()) {
+			http.Error(w, fmt.Sprintf("media exceeds %d bytes", e.maxMediaBytes()), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if !e.conn.up() {
+			http.Error(w, "not connected", http.StatusServiceUnavailable)
+			return
+		}
+		data, err := e.client.Download(r.Context(), d)
+		if err != nil {
+			http.Error(w, "download failed: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+		ct := req.Mimetype
+		if ct == "" {
+			ct = "application/octet-stream"
+		}
+		w.Header().Set("Content-Type", ct)
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		_, _ = w.Write(data)
+	}))
 
 	// /api/markread
-	http.HandleFunc("/api/markread", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/api/markread", e.requireToken(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
+		if !e.conn.up() {
+			http.Error(w, "not connected", http.StatusServiceUnavailable)
+			return
+		}
 
 		var req MarkReadRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "bad request", http.StatusBadRequest)
+		if err := e.decodeJSONBody(w, r, &req); err != nil {
+			http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		// Parse recipient
-		rcpt := canonicalChatJID(req.Recipient)
-		j, err := types.ParseJID(rcpt)
+		j, err := parseRecipientJID(req.Recipient)
 		if err != nil {
-		    if strings.HasSuffix(rcpt, "@lid") {
-		        parts := strings.SplitN(rcpt, "@", 2)
-		        j = types.JID{User: parts[0], Server: "lid"}
-		    } else {
-		        http.Error(w, "bad jid", http.StatusBadRequest)
-		        return
-		    }
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
-
 		var senderJ types.JID
 		if strings.TrimSpace(req.Sender) != "" {
-			src := strings.TrimSpace(req.Sender)
-			if s, errS := types.ParseJID(src); errS == nil {
-				senderJ = s
-			} else if strings.HasSuffix(src, "@lid") {
-				// parse manual para LID si el parser no lo reconoce en tu versión
-				parts := strings.SplitN(src, "@", 2)
-				if len(parts) == 2 {
-					senderJ = types.JID{User: parts[0], Server: "lid"}
-				}
-			} else if !strings.Contains(src, "@") {
-				senderJ = types.JID{User: src, Server: "s.whatsapp.net"}
+			if senderJ, err = parseRecipientJID(req.Sender); err != nil {
+				http.Error(w, "bad sender jid", http.StatusBadRequest)
+				return
 			}
 		}
 
@@ -1709,16 +5109,9 @@ func (e *Engine) StartREST() {
 		}
 
 		_ = json.NewEncoder(w).Encode(resp{true, "marked"})
-	})
+	}))
 
-	addr := fmt.Sprintf(":%d", e.cfg.HTTPPort)
-	go func() {
-		if err := http.ListenAndServe(addr, nil); err != nil {
-			if e.logger != nil {
-				e.logger.Warnf("REST server error on %s: %v", addr, err)
-			}
-		}
-	}()
+	return mux
 }
 
 //
@@ -1729,6 +5122,22 @@ func (e *Engine) StartREST() {
 
 func NewEngine(cfg Config) (*Engine, error) {
 	logger := waLog.Stdout("Engine", "INFO", term.IsTerminal(int(os.Stdout.Fd())))
+	cfg.RateLimits = cfg.RateLimits.withDefaults()
+	if err := cfg.RateLimits.validate(); err != nil {
+		return nil, err
+	}
+	presenceMode, err := parsePresenceMode(cfg.PresenceMode)
+	if err != nil {
+		return nil, err
+	}
+	quiet, err := parseQuietHours(cfg.QuietHours, cfg.QuietTimezone, cfg.QuietMode)
+	if err != nil {
+		return nil, err
+	}
+	if quiet != nil {
+		quiet.replyWindow = cfg.QuietReplyWindow
+		quiet.recipientLoc = cfg.RecipientLocation
+	}
 	msgs, err := NewMessageStore(cfg.MsgDBPath)
 	if err != nil {
 		return nil, err
@@ -1737,19 +5146,37 @@ func NewEngine(cfg Config) (*Engine, error) {
 		cfg:          cfg,
 		logger:       logger,
 		msgStore:     msgs,
-		limiterSend:  rate.NewLimiter(rate.Every(50*time.Millisecond), 5),
-		limiterMedia: rate.NewLimiter(rate.Every(150*time.Millisecond), 2),
-		limiterStat:  rate.NewLimiter(rate.Every(500*time.Millisecond), 1),
+		limiterSend:  cfg.RateLimits.Send.limiter(),
+		limiterMedia: cfg.RateLimits.Media.limiter(),
+		limiterStat:  cfg.RateLimits.Status.limiter(),
+		sendQ:        newSendQueue(cfg.SendQueueSize),
+		conn:         newConnState(),
+		names:        newNameCache(cfg.ChatNameTTL),
+		presence:     newPresenceState(presenceMode, cfg.PresenceAwayAfter),
+		quiet:        quiet,
 	}
+	e.clientConnected = func() bool { return e.client.IsConnected() }
+	e.chatPresence = func(ctx context.Context, chat types.JID, state types.ChatPresence, media types.ChatPresenceMedia) error {
+		return e.client.SendChatPresence(ctx, chat, state, media)
+	}
+	e.mediaHTTP = newMediaHTTPClient()
+	go e.runSendQueue()
 	base := cfg.Forward.OutFolder
 	if base == "" {
 		base = "outbox"
 	}
-	e.fileSink = NewFlatSink(base, 0)
+	e.fileSink = NewFlatSink(base, FlatSinkOptions{
+		MaxBytes: cfg.Forward.MaxFileBytes,
+		Gzip:     cfg.Forward.GzipRotated,
+		Retain:   cfg.Forward.RetainParts,
+		Fsync:    cfg.Forward.FsyncWrites,
+	})
 	return e, nil
 }
 
 func (e *Engine) Run(ctx context.Context, h Handlers) error {
+	// REST antes de la sesión: /readyz responde 503 mientras se escanea el QR
+	e.StartREST()
 	if err := e.CheckSession(ctx); err != nil {
 		return err
 	}
@@ -1767,15 +5194,119 @@ func (e *Engine) Run(ctx context.Context, h Handlers) error {
 			}
 		}()
 	}
-	e.StartREST()
+	if e.cfg.MsgRetention > 0 && e.msgStore != nil {
+		go e.runMessagePrune(ctx)
+	}
+	if e.cfg.PresenceAwayAfter > 0 {
+		go e.runAutoAway(ctx)
+	}
+	if e.msgStore != nil {
+		go e.runScheduler(ctx)
+	}
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
 	<-sig
+	e.sendQ.close()
 	e.client.Disconnect()
 	_ = e.msgStore.Close()
 	return nil
 }
 
+// runMessagePrune aplica la retención de mensajes al arrancar y luego cada MsgPruneEvery
+func (e *Engine) runMessagePrune(ctx context.Context) {
+	every := e.cfg.MsgPruneEvery
+	if every <= 0 {
+		every = 24 * time.Hour
+	}
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		n, err := e.msgStore.PruneMessages(time.Now().Add(-e.cfg.MsgRetention))
+		if err != nil {
+			e.humanWarnf(colorize(ansiWARN, "[STORE] ")+"Poda de mensajes falló: %v", err)
+		} else if n > 0 {
+			e.humanInfof(colorize(ansiSTATE, "[STORE] ")+"Poda de mensajes: %d borrados (retención %s)", n, e.cfg.MsgRetention)
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Programados reclamados por vuelta del scheduler
+const scheduleBatch = 50
+
+// runScheduler envía los mensajes programados vencidos por la cola normal (prioridad baja).
+// Al arrancar descarta los que un reinicio dejó a mitad de envío.
+func (e *Engine) runScheduler(ctx context.Context) {
+	if n, err := e.msgStore.FailInterruptedScheduled(); err != nil {
+		e.humanWarnf(colorize(ansiWARN, "[SCHEDULE] ")+"No se pudo revisar programados interrumpidos: %v", err)
+	} else if n > 0 {
+		e.humanWarnf(colorize(ansiWARN, "[SCHEDULE] ")+"%d programados quedaron a mitad de envío por un reinicio: marcados como fallidos.", n)
+	}
+	every := e.cfg.ScheduleTick
+	if every <= 0 {
+		every = 5 * time.Second
+	}
+	t := time.NewTicker(every)
+	defer t.Stop()
+	send := func(ctx context.Context, to types.JID, text string) (string, error) {
+		return e.EnqueueSend(ctx, &SendJob{To: to, Text: text, Priority: PriorityLow, skipQuiet: true})
+	}
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+		// sin conexión quedan pendientes (no se reclaman) hasta reconectar
+		if e.conn.up() {
+			e.sendDueScheduled(ctx, time.Now(), send)
+		}
+	}
+}
+
+// sendDueScheduled reclama los programados vencidos a now, los envía en orden con send y
+// registra cada resultado. Devuelve cuántos procesó.
+func (e *Engine) sendDueScheduled(ctx context.Context, now time.Time, send func(ctx context.Context, to types.JID, text string) (string, error)) int {
+	due, err := e.msgStore.ClaimDueScheduled(now, scheduleBatch)
+	if err != nil {
+		e.humanWarnf(colorize(ansiWARN, "[SCHEDULE] ")+"No se pudieron leer los programados: %v", err)
+		return 0
+	}
+	for _, m := range due {
+		to, err := parseRecipientJID(m.Recipient)
+		var id string
+		if err == nil {
+			if until, quiet := e.quietUntil(to, now); quiet {
+				if !e.quiet.drop {
+					if rerr := e.msgStore.RescheduleScheduled(m.ID, until); rerr != nil {
+						e.humanWarnf(colorize(ansiWARN, "[SCHEDULE] ")+"No se pudo diferir el programado #%d: %v", m.ID, rerr)
+					} else {
+						e.humanInfof(colorize(ansiSTATE, "[QUIET] ")+"Programado #%d a %s diferido a %s", m.ID, m.Recipient, until.Format(time.RFC3339))
+					}
+					continue
+				}
+				err = &QuietHoursError{Until: until}
+			}
+		}
+		if err == nil {
+			id, err = send(ctx, to, m.Message)
+		}
+		if ferr := e.msgStore.FinishScheduled(m.ID, id, err); ferr != nil {
+			e.humanWarnf(colorize(ansiWARN, "[SCHEDULE] ")+"No se pudo registrar el programado #%d: %v", m.ID, ferr)
+		}
+		if err != nil {
+			e.humanWarnf(colorize(ansiWARN, "[SCHEDULE] ")+"Programado #%d a %s falló: %v", m.ID, m.Recipient, err)
+		} else {
+			e.humanInfof(colorize(ansiOUT, "[SCHEDULE] ")+"Programado #%d enviado a %s | ID:%s", m.ID, m.Recipient, id)
+		}
+	}
+	return len(due)
+}
+
 //
 // =======================
 // 10) Utils inspirados
@@ -1785,36 +5316,28 @@ func (e *Engine) Run(ctx context.Context, h Handlers) error {
 func (e *Engine) ResolveChatName(jid types.JID, chatJID string, conversation interface{}, sender string) string {
 	var name string
 	if jid.Server == "g.us" {
-		if conversation != nil {
-			var dn, cn *string
-			v := reflect.ValueOf(conversation)
-			if v.Kind() == reflect.Ptr && !v.IsNil() {
-				v = v.Elem()
-				if f := v.FieldByName("DisplayName"); f.IsValid() && f.Kind() == reflect.Ptr && !f.IsNil() {
-					tmp := f.Elem().String()
-					dn = &tmp
-				}
-				if f := v.FieldByName("Name"); f.IsValid() && f.Kind() == reflect.Ptr && !f.IsNil() {
-					tmp := f.Elem().String()
-					cn = &tmp
-				}
-			}
-			if dn != nil && *dn != "" {
-				name = *dn
-			} else if cn != nil && *cn != "" {
-				name = *cn
-			}
-		}
+		name = conversationName(conversation)
 		if name == "" {
-			if gi, err := e.client.GetGroupInfo(context.Background(), jid); err == nil && gi.Name != "" {
-				name = gi.Name
+			gn, err := e.names.resolve(jid.String(), func() (string, error) {
+				gi, err := e.client.GetGroupInfo(context.Background(), jid)
+				if err != nil {
+					return "", err
+				}
+				return gi.Name, nil
+			})
+			if err == nil && gn != "" {
+				name = gn
 			} else {
 				name = "Group " + jid.User
 			}
 		}
 	} else {
-		if c, err := e.client.Store.Contacts.GetContact(context.Background(), jid); err == nil && c.FullName != "" {
-			name = c.FullName
+		fn, err := e.names.resolve(jid.String(), func() (string, error) {
+			c, err := e.client.Store.Contacts.GetContact(context.Background(), jid)
+			return c.FullName, err
+		})
+		if err == nil && fn != "" {
+			name = fn
 		} else if sender != "" {
 			name = sender
 		} else {
@@ -1824,6 +5347,106 @@ func (e *Engine) ResolveChatName(jid types.JID, chatJID string, conversation int
 	return name
 }
 
+// conversationName nombre del grupo que trae el propio evento, si lo trae.
+// *events.Message no lo incluye (PushName es del remitente): ahí decide GetGroupInfo.
+// Cualquier otro tipo con GetDisplayName/GetName (p. ej. *waHistorySync.Conversation) sirve.
+func conversationName(conversation any) string {
+	switch c := conversation.(type) {
+	case nil, *events.Message:
+		return ""
+	case interface {
+		GetDisplayName() string
+		GetName() string
+	}:
+		if dn := c.GetDisplayName(); dn != "" {
+			return dn
+		}
+		return c.GetName()
+	}
+	return ""
+}
+
+// invalidateChatName olvida el nombre cacheado de un grupo o contacto que cambió
+func (e *Engine) invalidateChatName(evt any) {
+	switch v := evt.(type) {
+	case *events.GroupInfo:
+		if v.Name != nil {
+			e.names.forget(v.JID.String())
+		}
+	case *events.Contact:
+		e.names.forget(v.JID.String())
+	case *events.PushName:
+		e.names.forget(v.JID.String())
+	case *events.BusinessName:
+		e.names.forget(v.JID.String())
+	}
+}
+
+// Entradas de nameCache a partir de las cuales se barren las vencidas
+const nameCacheMaxEntries = 5000
+
+// nameCache TTL de nombres resueltos por JID (GetGroupInfo va a la red,
+// GetContact a la base de la sesión). Solo se guardan lookups exitosos.
+type nameCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]nameCacheEntry
+}
+
+type nameCacheEntry struct {
+	name    string
+	expires time.Time
+}
+
+func newNameCache(ttl time.Duration) *nameCache {
+	if ttl == 0 {
+		ttl = 10 * time.Minute
+	}
+	return &nameCache{ttl: ttl, now: time.Now, entries: map[string]nameCacheEntry{}}
+}
+
+// resolve devuelve el nombre cacheado de key o llama a fetch y lo guarda si no falla
+func (c *nameCache) resolve(key string, fetch func() (string, error)) (string, error) {
+	if c == nil || c.ttl < 0 {
+		return fetch()
+	}
+	now := c.now()
+	c.mu.Lock()
+	if ent, ok := c.entries[key]; ok && now.Before(ent.expires) {
+		c.mu.Unlock()
+		return ent.name, nil
+	}
+	c.mu.Unlock()
+
+	name, err := fetch()
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= nameCacheMaxEntries {
+		for k, ent := range c.entries {
+			if !now.Before(ent.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[key] = nameCacheEntry{name: name, expires: now.Add(c.ttl)}
+	return name, nil
+}
+
+func (c *nameCache) forget(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+}
+
 func placeholderWaveform(duration uint32) []byte {
 	const N = 64
 	w := make([]byte, N)
@@ -1900,4 +5523,129 @@ func analyzeOggOpus(data []byte) (duration uint32, waveform []byte, err error) {
 	return duration, placeholderWaveform(duration), nil
 }
 
-func (e *Engine) handleHistorySync(h *events.HistorySync) { _ = h /* no-op */ }
+// handleHistorySync persiste los chats y mensajes del historial en MessageStore (solo los
+// que faltan: no pisa lo ya guardado), hasta HistoryMaxPerChat por chat. Corre en su propio
+// goroutine; los chunks se procesan de a uno. El forward ya salió como evento history_sync.
+func (e *Engine) handleHistorySync(h *events.HistorySync) {
+	if e.msgStore == nil || h == nil || h.Data == nil || e.cfg.HistoryMaxPerChat < 0 {
+		return
+	}
+	e.historyMu.Lock()
+	defer e.historyMu.Unlock()
+
+	start := time.Now()
+	msgs, names := historyMessages(h.Data, e.cfg.HistoryMaxPerChat)
+	n, err := e.msgStore.SaveHistory(msgs, names)
+	if err != nil {
+		e.humanWarnf(colorize(ansiWARN, "[HISTORY] ")+"No se pudo guardar el historial: %v", err)
+		return
+	}
+	e.humanInfof(colorize(ansiDEFAULT, "[HISTORY] ")+"%s chunk %d (%d%%): %d chats, %d mensajes nuevos de %d importables en %s.",
+		h.Data.GetSyncType(), h.Data.GetChunkOrder(), h.Data.GetProgress(),
+		len(names), n, len(msgs), time.Since(start).Round(time.Millisecond))
+}
+
+// historyMessages convierte un HistorySync en filas de messages (mismo formato que en vivo:
+// chat en storageChatJID, sender "me" para los propios) y el nombre de cada chat (el de la
+// conversación o, en 1:1, el pushname del contacto). maxPerChat > 0 deja los N más recientes.
+// Se omiten reacciones, mensajes de protocolo (borrados/ediciones) y stubs sin contenido.
+func historyMessages(data *waHistorySync.HistorySync, maxPerChat int) ([]StoredMessage, map[string]string) {
+	pushnames := map[string]string{}
+	for _, pn := range data.GetPushnames() {
+		if pn.GetPushname() != "" {
+			pushnames[storageChatJID(canonicalChatJID(pn.GetID()))] = pn.GetPushname()
+		}
+	}
+
+	var out []StoredMessage
+	names := map[string]string{}
+	for _, conv := range data.GetConversations() {
+		chat := storageChatJID(canonicalChatJID(conv.GetID()))
+		if chat == "" || chat == "status@broadcast" {
+			continue
+		}
+		switch {
+		case conv.GetName() != "":
+			names[chat] = conv.GetName()
+		case conv.GetDisplayName() != "":
+			names[chat] = conv.GetDisplayName()
+		default:
+			names[chat] = pushnames[chat] // "" = solo crear el chat
+		}
+
+		var chatMsgs []StoredMessage
+		for _, hm := range conv.GetMessages() {
+			info := hm.GetMessage()
+			raw := info.GetMessage()
+			if raw == nil || info.GetKey().GetID() == "" {
+				continue
+			}
+			msg := (&events.Message{RawMessage: raw}).UnwrapRaw().Message
+			if msg.GetProtocolMessage() != nil || reactionFromMessage(msg) != nil {
+				continue
+			}
+
+			m := StoredMessage{
+				ChatJID:   chat,
+				ID:        info.GetKey().GetID(),
+				Timestamp: time.Unix(int64(info.GetMessageTimestamp()), 0),
+				IsFromMe:  info.GetKey().GetFromMe(),
+			}
+			switch {
+			case m.IsFromMe:
+				m.Sender = "me"
+			case info.GetParticipant() != "":
+				m.Sender = info.GetParticipant()
+			case info.GetKey().GetParticipant() != "":
+				m.Sender = info.GetKey().GetParticipant()
+			default:
+				m.Sender = canonicalChatJID(conv.GetID())
+			}
+
+			switch {
+			case msg.GetExtendedTextMessage().GetText() != "":
+				m.Content = msg.GetExtendedTextMessage().GetText()
+			case msg.GetConversation() != "":
+				m.Content = msg.GetConversation()
+			case msg.GetImageMessage().GetCaption() != "":
+				m.Content = msg.GetImageMessage().GetCaption()
+			case msg.GetVideoMessage().GetCaption() != "":
+				m.Content = msg.GetVideoMessage().GetCaption()
+			}
+
+			if msg.GetImageMessage() != nil {
+				m.MediaType = sql.NullString{String: "image", Valid: true}
+			} else if msg.GetAudioMessage() != nil {
+				m.MediaType = sql.NullString{String: "audio", Valid: true}
+			} else if msg.GetVideoMessage() != nil {
+				m.MediaType = sql.NullString{String: "video", Valid: true}
+			} else if doc := msg.GetDocumentMessage(); doc != nil {
+				m.MediaType = sql.NullString{String: "document", Valid: true}
+				m.Filename = sql.NullString{String: doc.GetTitle(), Valid: doc.GetTitle() != ""}
+			} else if cs := contactsFromMessage(msg); cs != nil {
+				m.MediaType = sql.NullString{String: "contact", Valid: true}
+				if m.Content == "" {
+					m.Content = contactNames(cs)
+				}
+			} else if loc := locationFromMessage(msg); loc != nil {
+				lt, _ := loc["type"].(string)
+				m.MediaType = sql.NullString{String: lt, Valid: true}
+				m.Filename = sql.NullString{String: locationSummary(loc), Valid: true}
+				if u, _ := loc["url"].(string); u != "" {
+					m.URL = sql.NullString{String: u, Valid: true}
+				}
+			}
+			if m.Content == "" && !m.MediaType.Valid {
+				continue
+			}
+			chatMsgs = append(chatMsgs, m)
+		}
+
+		if maxPerChat > 0 && len(chatMsgs) > maxPerChat {
+			sort.SliceStable(chatMsgs, func(i, j int) bool { return chatMsgs[i].Timestamp.After(chatMsgs[j].Timestamp) })
+			chatMsgs = chatMsgs[:maxPerChat]
+		}
+		out = append(out, chatMsgs...)
+	}
+	return out, names
+}
@@ -0,0 +1,151 @@
+package engine
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// line de 10 bytes + '\n' para que el umbral de rotación sea fácil de contar
+func sinkLine(i int) []byte { return []byte(fmt.Sprintf(`{"n":%04d}`, i)) }
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var r interface{ Read([]byte) (int, error) } = f
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("invalid gzip %s: %v", path, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	var out []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		out = append(out, sc.Text())
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return out
+}
+
+func TestFlatSinkRotation(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      FlatSinkOptions
+		writes    int
+		wantParts []string // sufijos de las partes que deben quedar
+		wantLive  int      // líneas en el archivo vivo
+	}{
+		{"rotation disabled appends", FlatSinkOptions{}, 10, nil, 10},
+		{"below threshold", FlatSinkOptions{MaxBytes: 33}, 3, nil, 3},
+		{"rotates at threshold", FlatSinkOptions{MaxBytes: 33}, 4, []string{".part1"}, 1},
+		{"several parts", FlatSinkOptions{MaxBytes: 33}, 10, []string{".part1", ".part2", ".part3"}, 1},
+		{"gzip parts", FlatSinkOptions{MaxBytes: 33, Gzip: true}, 7, []string{".part1.gz", ".part2.gz"}, 1},
+		{"retention prunes oldest", FlatSinkOptions{MaxBytes: 33, Retain: 2}, 13, []string{".part3", ".part4"}, 1},
+		{"retention with gzip", FlatSinkOptions{MaxBytes: 33, Gzip: true, Retain: 1}, 10, []string{".part3.gz"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s := NewFlatSink(dir, tt.opts)
+			for i := 0; i < tt.writes; i++ {
+				if err := s.AppendTo("contacts", "a.ndjson", sinkLine(i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			path := filepath.Join(dir, "contacts", "a.ndjson")
+			var got []string
+			for _, p := range listParts(path) {
+				got = append(got, strings.TrimPrefix(p.path, path))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantParts, ",") {
+				t.Fatalf("parts = %v, want %v", got, tt.wantParts)
+			}
+			if n := len(readLines(t, path)); n != tt.wantLive {
+				t.Fatalf("live file has %d lines, want %d", n, tt.wantLive)
+			}
+			// cada parte tiene líneas contiguas y en orden cronológico
+			for _, p := range listParts(path) {
+				lines := readLines(t, p.path)
+				first := (p.n - 1) * 3
+				for j, l := range lines {
+					if l != string(sinkLine(first+j)) {
+						t.Fatalf("%s line %d = %s, want %s", p.path, j, l, sinkLine(first+j))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNewEngineWiresFlatSinkOptions(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) {
+		cfg.Forward.MaxFileBytes = 1 << 20
+		cfg.Forward.GzipRotated = true
+		cfg.Forward.RetainParts = 5
+	})
+	if got := e.fileSink.opts; got.MaxBytes != 1<<20 || !got.Gzip || got.Retain != 5 {
+		t.Fatalf("sink opts = %+v", got)
+	}
+}
+
+func TestFlatSinkConcurrentAppends(t *testing.T) {
+	for _, opts := range []FlatSinkOptions{{}, {Fsync: true}, {MaxBytes: 4 << 10}} {
+		t.Run(fmt.Sprintf("%+v", opts), func(t *testing.T) {
+			dir := t.TempDir()
+			s := NewFlatSink(dir, opts)
+			const writers, perWriter = 16, 50
+			// líneas largas: un write sin lock se intercalaría entre goroutines
+			pad := strings.Repeat("x", 2048)
+			var wg sync.WaitGroup
+			for w := 0; w < writers; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for i := 0; i < perWriter; i++ {
+						env := &ForwardEnvelope{EventType: "message", ChatJID: "51911000020@s.whatsapp.net", MessageID: fmt.Sprintf("W%d-%d", w, i), Text: pad}
+						payload, _ := json.Marshal(env)
+						if err := s.Append(env, payload); err != nil {
+							t.Error(err)
+							return
+						}
+					}
+				}(w)
+			}
+			wg.Wait()
+
+			path := filepath.Join(dir, "contacts", sanitizePathPart("51911000020@s.whatsapp.net")+".ndjson")
+			files := []string{path}
+			for _, p := range listParts(path) {
+				files = append(files, p.path)
+			}
+			seen := map[string]bool{}
+			for _, f := range files {
+				for _, l := range readLines(t, f) {
+					var env ForwardEnvelope
+					if err := json.Unmarshal([]byte(l), &env); err != nil {
+						t.Fatalf("invalid JSON line in %s: %v", f, err)
+					}
+					seen[env.MessageID] = true
+				}
+			}
+			if len(seen) != writers*perWriter {
+				t.Fatalf("got %d distinct lines, want %d", len(seen), writers*perWriter)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthAndReadiness(t *testing.T) {
+	e := newTestEngine(t, nil)
+	connected := false
+	e.clientConnected = func() bool { return connected }
+	h := e.restHandler()
+
+	get := func(path string) (*httptest.ResponseRecorder, map[string]any) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var body map[string]any
+		if path == "/readyz" {
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("readyz body %q: %v", rec.Body.String(), err)
+			}
+		}
+		return rec, body
+	}
+
+	// desconectado (p. ej. esperando QR): vivo pero no listo
+	if rec, _ := get("/healthz"); rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+		t.Errorf("healthz disconnected = %d %q", rec.Code, rec.Body.String())
+	}
+	rec, body := get("/readyz")
+	if rec.Code != http.StatusServiceUnavailable || body["ready"] != false || body["connected"] != false || body["store_ok"] != true {
+		t.Errorf("readyz disconnected = %d %v", rec.Code, body)
+	}
+
+	// conectado
+	connected = true
+	e.conn.markOnline()
+	e.lastEventAt.Store(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC).UnixNano())
+	if rec, _ := get("/healthz"); rec.Code != http.StatusOK {
+		t.Errorf("healthz connected = %d", rec.Code)
+	}
+	rec, body = get("/readyz")
+	if rec.Code != http.StatusOK || body["ready"] != true || body["connected"] != true {
+		t.Errorf("readyz connected = %d %v", rec.Code, body)
+	}
+	if body["last_event_at"] != "2026-01-02T03:04:05Z" {
+		t.Errorf("last_event_at = %v", body["last_event_at"])
+	}
+
+	// conectado pero con el store caído
+	_ = e.msgStore.Close()
+	rec, body = get("/readyz")
+	if rec.Code != http.StatusServiceUnavailable || body["store_ok"] != false {
+		t.Errorf("readyz store down = %d %v", rec.Code, body)
+	}
+}
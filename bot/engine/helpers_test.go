@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// newTestEngine engine sin cliente de WhatsApp: MessageStore y outbox en un directorio temporal
+func newTestEngine(t *testing.T, mutate func(cfg *Config)) *Engine {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := Config{
+		MsgDBPath: filepath.Join(dir, "messages.db"),
+		Forward:   ForwardingConfig{Mode: ForwardFolder, OutFolder: filepath.Join(dir, "outbox")},
+	}
+	if mutate != nil {
+		mutate(&cfg)
+	}
+	e, err := NewEngine(cfg)
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	t.Cleanup(func() {
+		e.sendQ.close()
+		_ = e.msgStore.Close()
+	})
+	return e
+}
+
+// knownName precarga el nombre de jid: ResolveChatName no llega al cliente (nil en tests)
+func knownName(e *Engine, jid types.JID, name string) {
+	e.names.mu.Lock()
+	defer e.names.mu.Unlock()
+	e.names.entries[jid.String()] = nameCacheEntry{name: name, expires: time.Now().Add(time.Hour)}
+}
+
+// mustJID parsea un JID de test
+func mustJID(t *testing.T, s string) types.JID {
+	t.Helper()
+	j, err := types.ParseJID(s)
+	if err != nil {
+		t.Fatalf("ParseJID(%q): %v", s, err)
+	}
+	return j
+}
+
+// outboxEnvelopes envelopes escritos en <outbox>/<cat>/<file>, en orden
+func outboxEnvelopes(t *testing.T, e *Engine, cat, file string) []ForwardEnvelope {
+	t.Helper()
+	f, err := os.Open(filepath.Join(e.cfg.Forward.OutFolder, cat, file))
+	if err != nil {
+		t.Fatalf("open outbox: %v", err)
+	}
+	defer f.Close()
+	var out []ForwardEnvelope
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		var env ForwardEnvelope
+		if err := json.Unmarshal(sc.Bytes(), &env); err != nil {
+			t.Fatalf("invalid NDJSON line %q: %v", sc.Text(), err)
+		}
+		out = append(out, env)
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatalf("read outbox: %v", err)
+	}
+	return out
+}
@@ -0,0 +1,223 @@
+package engine
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	waCommon "go.mau.fi/whatsmeow/proto/waCommon"
+	waE2E "go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/proto/waHistorySync"
+	waWeb "go.mau.fi/whatsmeow/proto/waWeb"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// historyMsg mensaje de texto de un HistorySync sintético
+func historyMsg(id, text string, fromMe bool, at time.Time) *waHistorySync.HistorySyncMsg {
+	return &waHistorySync.HistorySyncMsg{Message: &waWeb.WebMessageInfo{
+		Key:              &waCommon.MessageKey{ID: proto.String(id), FromMe: proto.Bool(fromMe)},
+		Message:          &waE2E.Message{Conversation: proto.String(text)},
+		MessageTimestamp: proto.Uint64(uint64(at.Unix())),
+	}}
+}
+
+// historySync evento con una conversación por chat
+func historySync(convs ...*waHistorySync.Conversation) *events.HistorySync {
+	return &events.HistorySync{Data: &waHistorySync.HistorySync{
+		SyncType:      waHistorySync.HistorySync_INITIAL_BOOTSTRAP.Enum(),
+		Conversations: convs,
+	}}
+}
+
+type storedRow struct {
+	content  string
+	fromMe   bool
+	unixTime int64
+}
+
+func loadRow(t *testing.T, s *MessageStore, chat, id string) (storedRow, bool) {
+	t.Helper()
+	var r storedRow
+	var ts time.Time
+	err := s.db.QueryRow(`SELECT content, is_from_me, timestamp FROM messages WHERE chat_jid = ? AND id = ?`, chat, id).Scan(&r.content, &r.fromMe, &ts)
+	if err == sql.ErrNoRows {
+		return r, false
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.unixTime = ts.Unix()
+	return r, true
+}
+
+func TestHistorySyncDoesNotRegressRows(t *testing.T) {
+	e := newTestEngine(t, nil)
+	chat := mustJID(t, "51911000040@s.whatsapp.net").String()
+	live := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	// visto en vivo: nuestra respuesta, con su hora real
+	if err := e.msgStore.SaveMessage(chat, "H1", "me", "respuesta en vivo", live, true, sql.NullString{}, sql.NullString{}, sql.NullString{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// el historial trae el mismo (id, chat) con datos distintos y uno nuevo
+	old := live.Add(-24 * time.Hour)
+	sync := historySync(&waHistorySync.Conversation{
+		ID: proto.String(chat),
+		Messages: []*waHistorySync.HistorySyncMsg{
+			historyMsg("H1", "texto viejo", false, old),
+			historyMsg("H0", "hola", false, old),
+		},
+	})
+	e.handleHistorySync(sync)
+	e.handleHistorySync(sync) // re-entrega del mismo chunk
+
+	got, ok := loadRow(t, e.msgStore, chat, "H1")
+	if !ok {
+		t.Fatal("live row lost")
+	}
+	if want := (storedRow{"respuesta en vivo", true, live.Unix()}); got != want {
+		t.Fatalf("live row = %+v, want %+v", got, want)
+	}
+	if got, ok := loadRow(t, e.msgStore, chat, "H0"); !ok || got.content != "hola" || got.fromMe || got.unixTime != old.Unix() {
+		t.Fatalf("history row = %+v (found %v)", got, ok)
+	}
+
+	var n int
+	if err := e.msgStore.db.QueryRow(`SELECT COUNT(*) FROM messages WHERE chat_jid = ?`, chat).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("rows = %d after repeated sync, want 2", n)
+	}
+}
+
+func TestSaveHistoryCountsOnlyNewRows(t *testing.T) {
+	e := newTestEngine(t, nil)
+	chat := mustJID(t, "51911000041@s.whatsapp.net").String()
+	msgs := []StoredMessage{
+		{ChatJID: chat, ID: "C1", Sender: chat, Content: "uno", Timestamp: time.Now()},
+		{ChatJID: chat, ID: "C2", Sender: chat, Content: "dos", Timestamp: time.Now()},
+		{ChatJID: chat, Content: "sin id"},
+	}
+	if n, err := e.msgStore.SaveHistory(msgs, nil); err != nil || n != 2 {
+		t.Fatalf("first SaveHistory = %d, %v; want 2", n, err)
+	}
+	if n, err := e.msgStore.SaveHistory(msgs, nil); err != nil || n != 0 {
+		t.Fatalf("second SaveHistory = %d, %v; want 0", n, err)
+	}
+}
+
+func TestHistoryMessagesMinimalPayload(t *testing.T) {
+	group := "120363000000000001@g.us"
+	ana := mustJID(t, "51911000042@s.whatsapp.net").String()
+	base := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	at := func(min int) time.Time { return base.Add(time.Duration(min) * time.Minute) }
+
+	fromParticipant := historyMsg("G1", "¿precio de la Hilux?", false, at(1))
+	fromParticipant.Message.Participant = proto.String(ana)
+	photo := historyMsg("A3", "", false, at(3))
+	photo.Message.Message = &waE2E.Message{ImageMessage: &waE2E.ImageMessage{Caption: proto.String("esta")}}
+	reaction := historyMsg("A4", "", false, at(4))
+	reaction.Message.Message = &waE2E.Message{ReactionMessage: &waE2E.ReactionMessage{
+		Key: &waCommon.MessageKey{ID: proto.String("A1")}, Text: proto.String("👍"),
+	}}
+
+	data := &waHistorySync.HistorySync{
+		SyncType:  waHistorySync.HistorySync_INITIAL_BOOTSTRAP.Enum(),
+		Pushnames: []*waHistorySync.Pushname{{ID: proto.String(ana), Pushname: proto.String("Ana")}},
+		Conversations: []*waHistorySync.Conversation{
+			{ID: proto.String(group), Name: proto.String("Subastas Lima"), Messages: []*waHistorySync.HistorySyncMsg{fromParticipant}},
+			{ID: proto.String(ana), Messages: []*waHistorySync.HistorySyncMsg{
+				historyMsg("A1", "hola", false, at(1)),
+				historyMsg("A2", "¡hola Ana!", true, at(2)),
+				photo,
+				reaction,
+			}},
+			{ID: proto.String("status@broadcast"), Messages: []*waHistorySync.HistorySyncMsg{historyMsg("S1", "estado", false, at(1))}},
+		},
+	}
+
+	msgs, names := historyMessages(data, 0)
+	if names[group] != "Subastas Lima" || names[ana] != "Ana" || len(names) != 2 {
+		t.Fatalf("names = %v", names)
+	}
+	byID := map[string]StoredMessage{}
+	for _, m := range msgs {
+		byID[m.ID] = m
+	}
+	if len(byID) != 4 {
+		t.Fatalf("imported %d messages, want 4 (reaction and status skipped): %v", len(byID), msgs)
+	}
+	if m := byID["G1"]; m.ChatJID != group || m.Sender != ana {
+		t.Fatalf("group message = %+v", m)
+	}
+	if m := byID["A2"]; m.Sender != "me" || !m.IsFromMe {
+		t.Fatalf("own message = %+v", m)
+	}
+	if m := byID["A3"]; m.Content != "esta" || m.MediaType.String != "image" {
+		t.Fatalf("photo = %+v", m)
+	}
+
+	// tope por chat: quedan los más recientes
+	capped, _ := historyMessages(data, 2)
+	var kept []string
+	for _, m := range capped {
+		if m.ChatJID == ana {
+			kept = append(kept, m.ID)
+		}
+	}
+	if len(kept) != 2 || kept[0] != "A3" || kept[1] != "A2" {
+		t.Fatalf("capped ana = %v, want [A3 A2]", kept)
+	}
+}
+
+func TestHistorySyncBackfillsOffEventLoop(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) { cfg.HistoryMaxPerChat = 1 })
+	ana := mustJID(t, "51911000043@s.whatsapp.net").String()
+	base := time.Now().Add(-time.Hour)
+	sync := historySync(&waHistorySync.Conversation{
+		ID:          proto.String(ana),
+		DisplayName: proto.String("Ana Torres"),
+		Messages: []*waHistorySync.HistorySyncMsg{
+			historyMsg("B1", "viejo", false, base),
+			historyMsg("B2", "nuevo", false, base.Add(time.Minute)),
+		},
+	})
+
+	e.handleEvent(context.Background(), Handlers{}, sync)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, ok := loadRow(t, e.msgStore, ana, "B2"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("history not persisted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	e.historyMu.Lock() // espera a que termine el import en curso
+	defer e.historyMu.Unlock()
+	if _, ok := loadRow(t, e.msgStore, ana, "B1"); ok {
+		t.Fatal("message beyond HistoryMaxPerChat imported")
+	}
+	var name sql.NullString
+	if err := e.msgStore.db.QueryRow(`SELECT name FROM chats WHERE jid = ?`, ana).Scan(&name); err != nil || name.String != "Ana Torres" {
+		t.Fatalf("chat name = %q, %v", name.String, err)
+	}
+}
+
+func TestHistorySyncDisabled(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) { cfg.HistoryMaxPerChat = -1 })
+	ana := mustJID(t, "51911000044@s.whatsapp.net").String()
+	e.handleHistorySync(historySync(&waHistorySync.Conversation{
+		ID:       proto.String(ana),
+		Messages: []*waHistorySync.HistorySyncMsg{historyMsg("D1", "hola", false, time.Now())},
+	}))
+	if _, ok := loadRow(t, e.msgStore, ana, "D1"); ok {
+		t.Fatal("history imported with HistoryMaxPerChat < 0")
+	}
+}
@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestHandleEventLocationMessage(t *testing.T) {
+	e := newTestEngine(t, nil)
+	chat := mustJID(t, "51999888777@s.whatsapp.net")
+	knownName(e, chat, "Vendedor Norte")
+
+	var handled bool
+	e.handleEvent(context.Background(), Handlers{
+		OnMessage: func(ctx context.Context, m *events.Message) error { handled = true; return nil },
+	}, &events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: chat, Sender: chat},
+			ID:            "LOC1",
+			Timestamp:     time.Now(),
+		},
+		Message: &waProto.Message{LocationMessage: &waProto.LocationMessage{
+			DegreesLatitude:  proto.Float64(-12.046374),
+			DegreesLongitude: proto.Float64(-77.042793),
+			Name:             proto.String("Plaza de Armas"),
+			Address:          proto.String("Jr. de la Unión, Lima"),
+			URL:              proto.String("https://maps.example/loc"),
+		}},
+	})
+	if !handled {
+		t.Fatal("OnMessage not called")
+	}
+
+	envs := outboxEnvelopes(t, e, "contacts", sanitizePathPart(chat.String())+".ndjson")
+	if len(envs) != 1 {
+		t.Fatalf("got %d envelopes, want 1", len(envs))
+	}
+	loc := envs[0].Location
+	if loc["type"] != "location" || loc["latitude"] != -12.046374 || loc["longitude"] != -77.042793 {
+		t.Errorf("location = %v", loc)
+	}
+	if loc["name"] != "Plaza de Armas" || loc["address"] != "Jr. de la Unión, Lima" {
+		t.Errorf("location name/address = %v / %v", loc["name"], loc["address"])
+	}
+	if envs[0].EventType != "message" || envs[0].Direction != "in" || envs[0].ChatName != "Vendedor Norte" {
+		t.Errorf("envelope = %+v", envs[0])
+	}
+
+	msgs, err := e.msgStore.GetRecentMessages(chat.String(), 10, time.Time{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("stored %d messages, want 1", len(msgs))
+	}
+	if msgs[0]["media_type"] != "location" || msgs[0]["filename"] != "Plaza de Armas (-12.046374,-77.042793)" || msgs[0]["url"] != "https://maps.example/loc" {
+		t.Errorf("stored message = %v", msgs[0])
+	}
+}
+
+func TestLocationFromMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     *waProto.Message
+		want    map[string]any
+		summary string
+	}{
+		{name: "nil", msg: nil},
+		{name: "text", msg: &waProto.Message{Conversation: proto.String("hola")}},
+		{
+			name: "static",
+			msg: &waProto.Message{LocationMessage: &waProto.LocationMessage{
+				DegreesLatitude: proto.Float64(-12.5), DegreesLongitude: proto.Float64(-76.25), Name: proto.String("Almacén"),
+			}},
+			want:    map[string]any{"type": "location", "latitude": -12.5, "longitude": -76.25, "name": "Almacén", "is_live": false},
+			summary: "Almacén (-12.500000,-76.250000)",
+		},
+		{
+			name: "live",
+			msg: &waProto.Message{LiveLocationMessage: &waProto.LiveLocationMessage{
+				DegreesLatitude: proto.Float64(1), DegreesLongitude: proto.Float64(2), Caption: proto.String("voy llegando"), SequenceNumber: proto.Int64(7),
+			}},
+			want:    map[string]any{"type": "live_location", "latitude": 1.0, "longitude": 2.0, "comment": "voy llegando", "sequence": int64(7), "is_live": true},
+			summary: "1.000000,2.000000",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := locationFromMessage(tt.msg)
+			if tt.want == nil {
+				if got != nil {
+					t.Fatalf("got %v, want nil", got)
+				}
+				return
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("%s = %#v, want %#v", k, got[k], v)
+				}
+			}
+			if s := locationSummary(got); s != tt.summary {
+				t.Errorf("summary = %q, want %q", s, tt.summary)
+			}
+		})
+	}
+}
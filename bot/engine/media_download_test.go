@@ -0,0 +1,54 @@
+package engine
+
+import (
+	"net/http"
+	"testing"
+
+	wm "go.mau.fi/whatsmeow"
+)
+
+func TestMediaDownloadRequestDownloadable(t *testing.T) {
+	ok := MediaDownloadRequest{
+		Type: "Audio", DirectPath: "/v/t62.7117-24/nota", MediaKeyB64: "a2V5", FileSHA256B64: "c2hh", FileEncSHA256B64: "ZW5j", FileLength: 1234,
+	}
+	d, err := ok.downloadable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.MT != wm.MediaAudio || string(d.MediaKey) != "key" || string(d.FileSHA256) != "sha" || string(d.FileEncSHA256) != "enc" || d.FileLength != 1234 {
+		t.Fatalf("downloadable = %+v", d)
+	}
+
+	for name, mutate := range map[string]func(*MediaDownloadRequest){
+		"unknown type":   func(r *MediaDownloadRequest) { r.Type = "sticker" },
+		"no media key":   func(r *MediaDownloadRequest) { r.MediaKeyB64 = "" },
+		"bad sha256":     func(r *MediaDownloadRequest) { r.FileSHA256B64 = "%%" },
+		"no url or path": func(r *MediaDownloadRequest) { r.DirectPath = "" },
+	} {
+		req := ok
+		mutate(&req)
+		if _, err := req.downloadable(); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestRESTMediaDownloadValidation(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) { cfg.APIToken = testAPIToken })
+	valid := `{"type":"audio","direct_path":"/v/nota","media_key_b64":"a2V5","file_sha256_b64":"c2hh","file_enc_sha256_b64":"ZW5j","file_length":100}`
+
+	cases := []struct {
+		name, method, body string
+		want               int
+	}{
+		{"GET", http.MethodGet, "", http.StatusMethodNotAllowed},
+		{"invalid ticket", http.MethodPost, `{"type":"audio"}`, http.StatusBadRequest},
+		{"too large", http.MethodPost, `{"type":"audio","direct_path":"/v/nota","media_key_b64":"a2V5","file_length":1099511627776}`, http.StatusRequestEntityTooLarge},
+		{"offline", http.MethodPost, valid, http.StatusServiceUnavailable},
+	}
+	for _, c := range cases {
+		if rec := serveREST(e, c.method, "/api/media/download", c.body, nil); rec.Code != c.want {
+			t.Errorf("%s = %d %s, want %d", c.name, rec.Code, rec.Body.String(), c.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveMediaPath(t *testing.T) {
+	root := t.TempDir()
+	base := filepath.Join(root, "media")
+	if err := os.MkdirAll(filepath.Join(base, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(path string, size int) {
+		t.Helper()
+		if err := os.WriteFile(path, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(base, "foto.jpg"), 10)
+	write(filepath.Join(base, "sub", "doc.pdf"), 10)
+	write(filepath.Join(base, "grande.bin"), 200)
+	write(filepath.Join(root, "secreto.txt"), 10)
+	if err := os.Symlink(filepath.Join(root, "secreto.txt"), filepath.Join(base, "link.txt")); err != nil {
+		t.Skipf("symlinks no disponibles: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr string
+	}{
+		{"relative file", "foto.jpg", filepath.Join(base, "foto.jpg"), ""},
+		{"nested file", "sub/doc.pdf", filepath.Join(base, "sub", "doc.pdf"), ""},
+		{"absolute inside base", filepath.Join(base, "foto.jpg"), filepath.Join(base, "foto.jpg"), ""},
+		{"dot-dot traversal", "../../etc/passwd", "", "outside allowed directory"},
+		{"traversal to sibling", "../secreto.txt", "", "outside allowed directory"},
+		{"absolute outside base", "/etc/passwd", "", "outside allowed directory"},
+		{"symlink escape", "link.txt", "", "outside allowed directory"},
+		{"missing file", "nope.jpg", "", "not found"},
+		{"directory", "sub", "", "not a regular file"},
+		{"too large", "grande.bin", "", "media exceeds 100 bytes"},
+	}
+	e := &Engine{cfg: Config{MediaBaseDir: base, MaxMediaBytes: 100}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := e.resolveMediaPath(tt.path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("resolveMediaPath(%q) = %q, %v; want error %q", tt.path, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("resolveMediaPath(%q) = %q, %v; want %q", tt.path, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveMediaPathDisabledWithoutBaseDir(t *testing.T) {
+	e := &Engine{}
+	if _, err := e.resolveMediaPath("foto.jpg"); err == nil || !strings.Contains(err.Error(), "disabled") {
+		t.Fatalf("err = %v, want media_path disabled", err)
+	}
+}
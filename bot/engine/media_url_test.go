@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	wm "go.mau.fi/whatsmeow"
+)
+
+// png 1x1 transparente
+var tinyPNG, _ = base64.StdEncoding.DecodeString("iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNkYPhfDwAChwGA60e6kgAAAABJRU5ErkJggg==")
+
+func TestFetchMediaURL(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fotos/hilux", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(tinyPNG)
+	})
+	mux.HandleFunc("/fotos/hilux.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(tinyPNG)
+	})
+	mux.HandleFunc("/grande.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(bytes.Repeat([]byte{0}, 2048))
+	})
+	mux.HandleFunc("/missing.png", http.NotFound)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		url      string
+		wantMime string
+		wantFile string
+		wantErr  string
+	}{
+		{"mime from content-type", srv.URL + "/fotos/hilux", "image/png", "hilux.png", ""},
+		{"mime from extension", srv.URL + "/fotos/hilux.png", "image/png", "hilux.png", ""},
+		{"oversized", srv.URL + "/grande.png", "", "", "media exceeds 1024 bytes"},
+		{"non-2xx", srv.URL + "/missing.png", "", "", "non-2xx: 404"},
+		{"bad scheme", "ftp://example.com/foto.png", "", "", "absolute http(s) url"},
+		{"relative url", "/fotos/hilux.png", "", "", "absolute http(s) url"},
+	}
+	// el cliente del servidor de prueba (loopback) reemplaza al cliente con guarda de IP
+	e := &Engine{cfg: Config{MaxMediaBytes: 1024}, mediaHTTP: srv.Client()}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mi, err := e.fetchMediaURL(context.Background(), tt.url, "Toyota Hilux 2019")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mi.Mime != tt.wantMime || mi.FileName != tt.wantFile || mi.MediaType != wm.MediaImage {
+				t.Fatalf("got mime=%q file=%q type=%v", mi.Mime, mi.FileName, mi.MediaType)
+			}
+			if !bytes.Equal(mi.Bytes, tinyPNG) || mi.Caption != "Toyota Hilux 2019" {
+				t.Fatalf("bytes/caption mismatch: %d bytes, caption %q", len(mi.Bytes), mi.Caption)
+			}
+		})
+	}
+}
+
+func TestFetchMediaURLRejectsNonPublicAddresses(t *testing.T) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(tinyPNG)
+	}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(srv.URL, "http://"))
+
+	e := &Engine{} // cliente por defecto: con guarda de IP
+	for _, url := range []string{srv.URL + "/foto.png", "http://localhost:" + port + "/foto.png"} {
+		if _, err := e.fetchMediaURL(context.Background(), url, ""); err == nil || !strings.Contains(err.Error(), "non-public address") {
+			t.Errorf("fetchMediaURL(%q) err = %v, want non-public address", url, err)
+		}
+	}
+	if hits != 0 {
+		t.Fatalf("server was hit %d times", hits)
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"8.8.8.8", true},
+		{"157.240.1.35", true},
+		{"2a03:2880:f12f:83:face:b00c::25de", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.0.0.5", false},
+		{"172.16.3.4", false},
+		{"192.168.1.10", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := isPublicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("isPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
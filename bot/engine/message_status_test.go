@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestGetMessageStatusProgression(t *testing.T) {
+	tests := []struct {
+		name     string
+		receipts []string // en orden de llegada
+		want     string
+	}{
+		{"no receipts", nil, "sent"},
+		{"server ack only", []string{"sender"}, "sent"},
+		{"delivered", []string{""}, "delivered"},
+		{"read after delivered upgrades", []string{"", "read"}, "read"},
+		{"late delivered does not downgrade", []string{"read", ""}, "read"},
+		{"played beats read", []string{"", "read", "played"}, "played"},
+		{"retry is ignored", []string{"", "retry"}, "delivered"},
+	}
+	e := newTestEngine(t, nil)
+	chat := "51911000010@s.whatsapp.net"
+	base := time.Now().Add(-time.Hour)
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := fmt.Sprintf("ST%d", i)
+			if err := e.msgStore.SaveMessage(chat, id, "me", "hola", base, true, sql.NullString{}, sql.NullString{}, sql.NullString{}); err != nil {
+				t.Fatal(err)
+			}
+			for j, rt := range tt.receipts {
+				if err := e.msgStore.SaveReceipt(chat, []string{id}, rt, chat, false, base.Add(time.Duration(j+1)*time.Minute)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, seen, err := e.msgStore.GetMessageStatus(chat, id)
+			if err != nil || got != tt.want {
+				t.Fatalf("status = %q, %v; want %q", got, err, tt.want)
+			}
+			if got != "sent" && seen[got] == "" {
+				t.Fatalf("missing timestamp for %q: %v", got, seen)
+			}
+		})
+	}
+}
+
+func TestGetMessageStatusIgnoresOwnReceipts(t *testing.T) {
+	e := newTestEngine(t, nil)
+	chat := "51911000011@s.whatsapp.net"
+	if err := e.msgStore.SaveMessage(chat, "OWN1", "me", "hola", time.Now(), true, sql.NullString{}, sql.NullString{}, sql.NullString{}); err != nil {
+		t.Fatal(err)
+	}
+	// un read-self de otro dispositivo nuestro no dice nada del destinatario
+	if err := e.msgStore.SaveReceipt(chat, []string{"OWN1"}, "read", "", true, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if got, _, _ := e.msgStore.GetMessageStatus(chat, "OWN1"); got != "sent" {
+		t.Fatalf("status = %q, want sent", got)
+	}
+}
+
+func TestRESTMessageStatus(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) { cfg.APIToken = testAPIToken })
+	chat := "51911000012@s.whatsapp.net"
+	if err := e.msgStore.SaveMessage(chat, "M1", "me", "hola", time.Now(), true, sql.NullString{}, sql.NullString{}, sql.NullString{}); err != nil {
+		t.Fatal(err)
+	}
+	_ = e.msgStore.SaveReceipt(chat, []string{"M1"}, "read", chat, false, time.Now())
+
+	tests := []struct {
+		name       string
+		query      url.Values
+		wantCode   int
+		wantStatus string
+	}{
+		{"read", url.Values{"chat": {"51911000012"}, "id": {"M1"}}, http.StatusOK, "read"},
+		{"unknown message", url.Values{"chat": {"51911000012"}, "id": {"NOPE"}}, http.StatusNotFound, ""},
+		{"missing id", url.Values{"chat": {"51911000012"}}, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveREST(e, http.MethodGet, "/api/message-status?"+tt.query.Encode(), "", nil)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("code = %d %s", rec.Code, rec.Body.String())
+			}
+			if tt.wantStatus == "" {
+				return
+			}
+			var body map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["status"] != tt.wantStatus {
+				t.Fatalf("body = %s (%v)", rec.Body.String(), err)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waHistorySync"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestNameCacheResolveWithinTTL(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	c := newNameCache(time.Minute)
+	c.now = func() time.Time { return now }
+
+	calls := 0
+	fetch := func() (string, error) {
+		calls++
+		return "Subastas Lima", nil
+	}
+	for i := 0; i < 3; i++ {
+		if got, err := c.resolve("120363000000000001@g.us", fetch); err != nil || got != "Subastas Lima" {
+			t.Fatalf("resolve #%d = %q, %v", i+1, got, err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("client called %d times within TTL, want 1", calls)
+	}
+
+	// vencido el TTL se vuelve a consultar
+	now = now.Add(time.Minute)
+	if _, err := c.resolve("120363000000000001@g.us", fetch); err != nil || calls != 2 {
+		t.Fatalf("after TTL calls = %d, %v; want 2", calls, err)
+	}
+}
+
+func TestNameCacheErrorsAreNotCached(t *testing.T) {
+	c := newNameCache(time.Minute)
+	calls := 0
+	failing := func() (string, error) {
+		calls++
+		return "", errors.New("timeout")
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := c.resolve("51911000050@s.whatsapp.net", failing); err == nil {
+			t.Fatal("error swallowed")
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("failed lookups called %d times, want 2", calls)
+	}
+}
+
+func TestNameCacheDisabled(t *testing.T) {
+	c := newNameCache(-1)
+	calls := 0
+	for i := 0; i < 2; i++ {
+		_, _ = c.resolve("x", func() (string, error) { calls++; return "x", nil })
+	}
+	if calls != 2 {
+		t.Fatalf("negative TTL cached the name (calls = %d)", calls)
+	}
+}
+
+func TestInvalidateChatName(t *testing.T) {
+	e := newTestEngine(t, nil)
+	group := mustJID(t, "120363000000000002@g.us")
+	contact := mustJID(t, "51911000051@s.whatsapp.net")
+	cached := func(key string) bool {
+		e.names.mu.Lock()
+		defer e.names.mu.Unlock()
+		_, ok := e.names.entries[key]
+		return ok
+	}
+
+	knownName(e, group, "Grupo viejo")
+	// un cambio de GroupInfo sin nombre (p. ej. participantes) no invalida
+	e.invalidateChatName(&events.GroupInfo{JID: group})
+	if !cached(group.String()) {
+		t.Fatal("GroupInfo without name change invalidated the cache")
+	}
+	e.invalidateChatName(&events.GroupInfo{JID: group, Name: &types.GroupName{Name: "Grupo nuevo"}})
+	if cached(group.String()) {
+		t.Fatal("group rename did not invalidate the cache")
+	}
+
+	for _, evt := range []any{
+		&events.Contact{JID: contact},
+		&events.PushName{JID: contact},
+		&events.BusinessName{JID: contact},
+	} {
+		knownName(e, contact, "Ana")
+		e.invalidateChatName(evt)
+		if cached(contact.String()) {
+			t.Fatalf("%T did not invalidate the cache", evt)
+		}
+	}
+}
+
+func TestResolveChatNameGroupMessage(t *testing.T) {
+	group := mustJID(t, "120363000000000003@g.us")
+	msg := &events.Message{Info: types.MessageInfo{
+		MessageSource: types.MessageSource{Chat: group, Sender: mustJID(t, "51911000052@s.whatsapp.net"), IsGroup: true},
+		PushName:      "Ana",
+	}}
+
+	// con la info del grupo cacheada: el nombre del grupo, nunca el PushName del remitente
+	e := newTestEngine(t, nil)
+	knownName(e, group, "Subastas Lima")
+	if got := e.ResolveChatName(group, group.String(), msg, "51911000052"); got != "Subastas Lima" {
+		t.Fatalf("with cached group info = %q", got)
+	}
+
+	// sin cache: una conversación tipada con nombre se usa sin ir al cliente (nil en tests)
+	fresh := newTestEngine(t, nil)
+	conv := &waHistorySync.Conversation{ID: proto.String(group.String()), Name: proto.String("Subastas Lima")}
+	if got := fresh.ResolveChatName(group, group.String(), conv, "51911000052"); got != "Subastas Lima" {
+		t.Fatalf("without cached group info = %q", got)
+	}
+}
+
+func TestConversationName(t *testing.T) {
+	cases := []struct {
+		name string
+		conv any
+		want string
+	}{
+		{"nil", nil, ""},
+		{"message has no group name", &events.Message{Info: types.MessageInfo{PushName: "Ana"}}, ""},
+		{"display name wins", &waHistorySync.Conversation{DisplayName: proto.String("Display"), Name: proto.String("Name")}, "Display"},
+		{"name fallback", &waHistorySync.Conversation{Name: proto.String("Name")}, "Name"},
+		{"unknown type", "Subastas", ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := conversationName(c.conv); got != c.want {
+				t.Fatalf("conversationName = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
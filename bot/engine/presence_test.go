@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestParsePresenceMode(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    types.Presence
+		wantErr bool
+	}{
+		{"", types.PresenceAvailable, false},
+		{"available", types.PresenceAvailable, false},
+		{" Online ", types.PresenceAvailable, false},
+		{"unavailable", types.PresenceUnavailable, false},
+		{"OFFLINE", types.PresenceUnavailable, false},
+		{"paused", "", true},
+		{"away", "", true},
+	}
+	for _, c := range cases {
+		got, err := parsePresenceMode(c.in)
+		if (err != nil) != c.wantErr || got != c.want {
+			t.Errorf("parsePresenceMode(%q) = %q, %v", c.in, got, err)
+		}
+	}
+}
+
+func TestNewEngineRejectsInvalidPresenceMode(t *testing.T) {
+	_, err := NewEngine(Config{MsgDBPath: t.TempDir() + "/messages.db", PresenceMode: "invisible"})
+	if err == nil {
+		t.Fatal("NewEngine accepted an invalid PresenceMode")
+	}
+	e := newTestEngine(t, func(cfg *Config) { cfg.PresenceMode = "unavailable" })
+	if got := e.presence.current(); got != types.PresenceUnavailable {
+		t.Fatalf("current = %q, want unavailable", got)
+	}
+}
+
+func TestPresenceIdleAway(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	p := newPresenceState(types.PresenceAvailable, 5*time.Minute)
+	p.now = func() time.Time { return now }
+	p.set(types.PresenceAvailable)
+
+	now = now.Add(4 * time.Minute)
+	if p.idle() || p.current() != types.PresenceAvailable {
+		t.Fatal("went away before awayAfter")
+	}
+	now = now.Add(time.Minute)
+	if !p.idle() || p.current() != types.PresenceUnavailable {
+		t.Fatal("did not go away after awayAfter without sends")
+	}
+	if p.idle() {
+		t.Fatal("away announced twice")
+	}
+
+	// un envío vuelve a available (una sola vez) y reinicia el contador
+	if !p.touch() || p.current() != types.PresenceAvailable {
+		t.Fatal("send did not leave auto-away")
+	}
+	if p.touch() {
+		t.Fatal("touch reported away while available")
+	}
+	now = now.Add(4 * time.Minute)
+	if p.idle() {
+		t.Fatal("idle timer not reset by the send")
+	}
+}
+
+func TestPresenceIdleAwayOnlyInAvailableMode(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	p := newPresenceState(types.PresenceUnavailable, time.Minute)
+	p.now = func() time.Time { return now }
+
+	now = now.Add(time.Hour)
+	if p.idle() {
+		t.Fatal("auto-away triggered in unavailable mode")
+	}
+
+	off := newPresenceState(types.PresenceAvailable, 0)
+	off.now = func() time.Time { return now.Add(24 * time.Hour) }
+	if off.idle() {
+		t.Fatal("auto-away triggered with awayAfter = 0")
+	}
+}
+
+func TestRESTPresence(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) { cfg.APIToken = testAPIToken })
+
+	// sin conexión: se guarda y se aplica al reconectar
+	if rec := serveREST(e, http.MethodPost, "/api/presence", `{"mode":"unavailable"}`, nil); rec.Code != http.StatusOK {
+		t.Fatalf("POST unavailable = %d %s", rec.Code, rec.Body.String())
+	}
+	if got := e.presence.current(); got != types.PresenceUnavailable {
+		t.Fatalf("current = %q after POST", got)
+	}
+	if rec := serveREST(e, http.MethodPost, "/api/presence", `{"mode":"paused"}`, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid mode = %d", rec.Code)
+	}
+	if got := e.presence.current(); got != types.PresenceUnavailable {
+		t.Fatalf("invalid mode changed presence to %q", got)
+	}
+	if rec := serveREST(e, http.MethodGet, "/api/presence", "", nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET = %d", rec.Code)
+	}
+}
@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPruneMessages(t *testing.T) {
+	e := newTestEngine(t, nil)
+	s := e.msgStore
+	oldChat := mustJID(t, "51911000030@s.whatsapp.net").String()
+	mixedChat := mustJID(t, "51911000031@s.whatsapp.net").String()
+	now := time.Now()
+	save := func(chat, id string, at time.Time) {
+		t.Helper()
+		if err := s.SaveMessage(chat, id, chat, "msg "+id, at, false, sql.NullString{}, sql.NullString{}, sql.NullString{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	save(oldChat, "P1", now.AddDate(0, 0, -120))
+	save(mixedChat, "P2", now.AddDate(0, 0, -100))
+	save(mixedChat, "P3", now.AddDate(0, 0, -10))
+	save(mixedChat, "P4", now.Add(-time.Minute))
+
+	n, err := s.PruneMessages(now.AddDate(0, 0, -90))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("pruned = %d, want 2", n)
+	}
+
+	count := func(query string, args ...any) int {
+		t.Helper()
+		var c int
+		if err := s.db.QueryRow(query, args...).Scan(&c); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	if got := count(`SELECT COUNT(*) FROM messages WHERE id IN ('P3','P4')`); got != 2 {
+		t.Fatalf("recent messages left = %d, want 2", got)
+	}
+	if got := count(`SELECT COUNT(*) FROM messages`); got != 2 {
+		t.Fatalf("messages left = %d, want 2", got)
+	}
+	// el chat que quedó vacío se borra; el que tiene mensajes recientes no
+	if count(`SELECT COUNT(*) FROM chats WHERE jid = ?`, oldChat) != 0 || count(`SELECT COUNT(*) FROM chats WHERE jid = ?`, mixedChat) != 1 {
+		t.Fatal("chat rows not pruned along with their messages")
+	}
+	if got := count(`SELECT COUNT(*) FROM pragma_foreign_key_check`); got != 0 {
+		t.Fatalf("foreign key violations = %d", got)
+	}
+	if got := count(`PRAGMA auto_vacuum`); got != 2 {
+		t.Fatalf("auto_vacuum = %d after prune, want 2 (incremental)", got)
+	}
+
+	// nada que podar: no falla ni borra
+	if n, err := s.PruneMessages(now.AddDate(0, 0, -90)); err != nil || n != 0 {
+		t.Fatalf("second prune = %d, %v", n, err)
+	}
+}
+
+func TestRESTMessagesPrune(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) {
+		cfg.APIToken = testAPIToken
+		cfg.AdminSecret = "admin"
+	})
+	chat := mustJID(t, "51911000032@s.whatsapp.net").String()
+	for id, at := range map[string]time.Time{"R1": time.Now().AddDate(0, 0, -40), "R2": time.Now()} {
+		if err := e.msgStore.SaveMessage(chat, id, chat, "x", at, false, sql.NullString{}, sql.NullString{}, sql.NullString{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if rec := serveREST(e, http.MethodPost, "/api/messages/prune", `{"days":30}`, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("without admin secret = %d", rec.Code)
+	}
+	admin := map[string]string{"X-Engine-Admin-Secret": "admin"}
+	// sin retención configurada hace falta days u older_than
+	if rec := serveREST(e, http.MethodPost, "/api/messages/prune", `{}`, admin); rec.Code != http.StatusBadRequest {
+		t.Fatalf("empty body without retention = %d", rec.Code)
+	}
+	rec := serveREST(e, http.MethodPost, "/api/messages/prune", `{"days":30}`, admin)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("prune = %d %s", rec.Code, rec.Body.String())
+	}
+	var body struct {
+		Deleted int `json:"deleted"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Deleted != 1 {
+		t.Fatalf("body = %s", rec.Body.String())
+	}
+}
+
+func TestPruneMessagesMixedOffsets(t *testing.T) {
+	e := newTestEngine(t, nil)
+	s := e.msgStore
+	chat := mustJID(t, "51911000033@s.whatsapp.net").String()
+	cutoff := time.Now().AddDate(0, 0, -90)
+
+	// mismo instante escrito con offsets extremos: el texto ya no ordena como el tiempo
+	east, west := time.FixedZone("UTC+14", 14*3600), time.FixedZone("UTC-12", -12*3600)
+	for id, at := range map[string]time.Time{
+		"OLD_EAST": cutoff.Add(-time.Hour).In(east),
+		"NEW_WEST": cutoff.Add(time.Hour).In(west),
+		"NEW_UTC":  cutoff.Add(time.Minute).UTC(),
+	} {
+		if err := s.SaveMessage(chat, id, chat, "x", at, false, sql.NullString{}, sql.NullString{}, sql.NullString{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n, err := s.PruneMessages(cutoff); err != nil || n != 1 {
+		t.Fatalf("pruned = %d, %v; want 1", n, err)
+	}
+	var left int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM messages WHERE id IN ('NEW_WEST','NEW_UTC')`).Scan(&left); err != nil || left != 2 {
+		t.Fatalf("recent messages left = %d, %v", left, err)
+	}
+}
@@ -0,0 +1,239 @@
+package engine
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// quietAroundNow ventana de silencio (UTC) de una hora a cada lado de ahora
+func quietAroundNow(drop bool) *quietHours {
+	now := time.Now().UTC()
+	mins := now.Hour()*60 + now.Minute()
+	return &quietHours{start: (mins + 1440 - 60) % 1440, end: (mins + 60) % 1440, loc: time.UTC, drop: drop}
+}
+
+func TestParseQuietHours(t *testing.T) {
+	if q, err := parseQuietHours("", "", ""); q != nil || err != nil {
+		t.Fatalf("empty spec = %+v, %v; want no quiet hours", q, err)
+	}
+	q, err := parseQuietHours(" 22:00-08:30 ", "America/Lima", "DROP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.start != 22*60 || q.end != 8*60+30 || q.loc.String() != "America/Lima" || !q.drop {
+		t.Fatalf("parsed = %+v", q)
+	}
+	for _, c := range []struct{ spec, tz, mode string }{
+		{"22:00", "", ""},
+		{"22:00-25:00", "", ""},
+		{"08:00-08:00", "", ""},
+		{"22:00-08:00", "Marte/Olympus", ""},
+		{"22:00-08:00", "", "later"},
+	} {
+		if _, err := parseQuietHours(c.spec, c.tz, c.mode); err == nil {
+			t.Errorf("parseQuietHours(%q, %q, %q) accepted", c.spec, c.tz, c.mode)
+		}
+	}
+}
+
+func TestQuietHoursUntil(t *testing.T) {
+	lima, err := time.LoadLocation("America/Lima") // UTC-5, sin horario de verano
+	if err != nil {
+		t.Skip("tzdata not available:", err)
+	}
+	night := &quietHours{start: 22 * 60, end: 8 * 60}
+	lunch := &quietHours{start: 13 * 60, end: 14 * 60}
+	at := func(h, m int) time.Time { return time.Date(2026, 3, 1, h, m, 0, 0, lima) }
+
+	cases := []struct {
+		name  string
+		q     *quietHours
+		now   time.Time
+		quiet bool
+		until time.Time
+	}{
+		{"before overnight window", night, at(21, 59), false, time.Time{}},
+		{"overnight, before midnight", night, at(23, 30), true, time.Date(2026, 3, 2, 8, 0, 0, 0, lima)},
+		{"overnight, after midnight", night, at(3, 0), true, at(8, 0)},
+		{"end is exclusive", night, at(8, 0), false, time.Time{}},
+		{"same-day window", lunch, at(13, 15), true, at(14, 0)},
+		{"after same-day window", lunch, at(14, 1), false, time.Time{}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			until, quiet := c.q.until(c.now, lima)
+			if quiet != c.quiet || !until.Equal(c.until) {
+				t.Fatalf("until(%s) = %s, %v; want %s, %v", c.now.Format("15:04"), until, quiet, c.until, c.quiet)
+			}
+		})
+	}
+}
+
+func TestQuietUntilRecipientTimezoneAndReplyWindow(t *testing.T) {
+	e := newTestEngine(t, nil)
+	lima, err := time.LoadLocation("America/Lima")
+	if err != nil {
+		t.Skip("tzdata not available:", err)
+	}
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	if err != nil {
+		t.Skip("tzdata not available:", err)
+	}
+	peru := mustJID(t, "51911000100@s.whatsapp.net")
+	spain := mustJID(t, "34611000100@s.whatsapp.net")
+	e.quiet = &quietHours{start: 22 * 60, end: 8 * 60, loc: lima, recipientLoc: func(to types.JID) *time.Location {
+		if to.User[:2] == "34" {
+			return madrid
+		}
+		return nil // zona por defecto
+	}}
+
+	// 23:00 en Lima = 05:00 en Madrid: ambos en silencio, cada uno hasta las 08:00 locales
+	now := time.Date(2026, 3, 1, 23, 0, 0, 0, lima)
+	if until, quiet := e.quietUntil(peru, now); !quiet || !until.Equal(time.Date(2026, 3, 2, 8, 0, 0, 0, lima)) {
+		t.Fatalf("peru = %s, %v", until, quiet)
+	}
+	if until, quiet := e.quietUntil(spain, now); !quiet || !until.Equal(time.Date(2026, 3, 2, 8, 0, 0, 0, madrid)) {
+		t.Fatalf("spain = %s, %v", until, quiet)
+	}
+	// 10:00 en Lima = 16:00 en Madrid: fuera del horario para ambos
+	if _, quiet := e.quietUntil(spain, time.Date(2026, 3, 1, 10, 0, 0, 0, lima)); quiet {
+		t.Fatal("spain in quiet hours at 16:00 local")
+	}
+
+	// conversación activa: si el contacto escribió hace poco se responde igual
+	e.quiet.replyWindow = 10 * time.Minute
+	if err := e.msgStore.SaveMessage(peru.String(), "Q1", peru.String(), "hola", now.Add(-5*time.Minute), false, sql.NullString{}, sql.NullString{}, sql.NullString{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, quiet := e.quietUntil(peru, now); quiet {
+		t.Fatal("reply within QuietReplyWindow deferred")
+	}
+	if _, quiet := e.quietUntil(peru, now.Add(10*time.Minute)); !quiet {
+		t.Fatal("reply window did not expire")
+	}
+}
+
+func TestEnqueueSendDefersDuringQuietHours(t *testing.T) {
+	e := newTestEngine(t, nil)
+	e.quiet = quietAroundNow(false)
+	to := mustJID(t, "51911000101@s.whatsapp.net")
+
+	_, err := e.EnqueueSend(context.Background(), &SendJob{To: to, Text: "oferta nocturna"})
+	var qerr *QuietHoursError
+	if !errors.As(err, &qerr) || qerr.ScheduledID == 0 {
+		t.Fatalf("EnqueueSend = %v, want deferred QuietHoursError", err)
+	}
+	m := scheduled(t, e.msgStore, qerr.ScheduledID)
+	if m.Status != ScheduledPending || m.Message != "oferta nocturna" || m.Recipient != to.String() || !m.SendAt.Equal(qerr.Until) {
+		t.Fatalf("deferred = %+v, until %s", m, qerr.Until)
+	}
+
+	// en modo drop no queda nada programado
+	e.quiet.drop = true
+	_, err = e.EnqueueSend(context.Background(), &SendJob{To: to, Text: "descartado"})
+	if !errors.As(err, &qerr) || qerr.ScheduledID != 0 {
+		t.Fatalf("drop mode = %v", err)
+	}
+	if list, _ := e.msgStore.ListScheduled("", 10); len(list) != 1 {
+		t.Fatalf("drop mode scheduled %d messages", len(list))
+	}
+
+	// reacciones, ediciones, etc. (jobs con run) no se difieren: esperan conexión en la cola
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = e.EnqueueSend(ctx, &SendJob{To: to, run: func(context.Context) (string, error) { return "R1", nil }})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("run job during quiet hours = %v, want queued until the deadline", err)
+	}
+}
+
+func TestQuietHoursRejectsMediaAndLocationInDeferMode(t *testing.T) {
+	e := newTestEngine(t, nil)
+	e.quiet = quietAroundNow(false)
+	to := mustJID(t, "51911000103@s.whatsapp.net")
+
+	// la media no cabe en scheduled_messages: se rechaza con un error claro, no se descarta en silencio
+	_, err := e.EnqueueSend(context.Background(), &SendJob{To: to, Media: &MediaInput{Bytes: []byte("jpg"), Mime: "image/jpeg", Caption: "foto"}})
+	var qerr *QuietHoursError
+	if !errors.As(err, &qerr) || qerr.ScheduledID != 0 || !errors.Is(err, ErrQuietNotDeferrable) {
+		t.Fatalf("media in defer mode = %v, want ErrQuietNotDeferrable", err)
+	}
+
+	// la ubicación también respeta el horario (antes salía igual por ser un job con run)
+	_, err = e.SendLocation(context.Background(), to, -12.0464, -77.0428, "Local BOB", "Lima")
+	if !errors.As(err, &qerr) || !errors.Is(err, ErrQuietNotDeferrable) {
+		t.Fatalf("location during quiet hours = %v, want ErrQuietNotDeferrable", err)
+	}
+	if list, _ := e.msgStore.ListScheduled("", 10); len(list) != 0 {
+		t.Fatalf("media or location scheduled as text: %+v", list)
+	}
+
+	// en modo drop se descartan como el texto
+	e.quiet.drop = true
+	_, err = e.SendLocation(context.Background(), to, -12.0464, -77.0428, "", "")
+	if !errors.As(err, &qerr) || errors.Is(err, ErrQuietNotDeferrable) {
+		t.Fatalf("location in drop mode = %v", err)
+	}
+}
+
+func TestEnqueueSendOutsideQuietHoursGoesToQueue(t *testing.T) {
+	e := newTestEngine(t, nil)
+	q := quietAroundNow(false)
+	q.start, q.end = (q.end+60)%1440, (q.end+120)%1440 // ventana que no incluye ahora
+	e.quiet = q
+
+	// sin conexión el job queda en cola hasta el timeout: no se difiere
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := e.EnqueueSend(ctx, &SendJob{To: mustJID(t, "51911000102@s.whatsapp.net"), Text: "hola"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("EnqueueSend = %v, want queued until the deadline", err)
+	}
+	if list, _ := e.msgStore.ListScheduled("", 10); len(list) != 0 {
+		t.Fatalf("send outside quiet hours scheduled: %+v", list)
+	}
+}
+
+func TestSendDueScheduledRespectsQuietHours(t *testing.T) {
+	e := newTestEngine(t, nil)
+	e.quiet = &quietHours{start: 22 * 60, end: 8 * 60, loc: time.UTC}
+	night := time.Date(2026, 3, 1, 23, 0, 0, 0, time.UTC)
+	id, _ := e.msgStore.ScheduleMessage("51911000103@s.whatsapp.net", "recordatorio", night.Add(-time.Minute))
+
+	var sent []string
+	send := func(ctx context.Context, to types.JID, text string) (string, error) {
+		sent = append(sent, text)
+		return "ID1", nil
+	}
+
+	// vence dentro del horario: se difiere al fin de la ventana sin enviar
+	if n := e.sendDueScheduled(context.Background(), night, send); n != 1 || len(sent) != 0 {
+		t.Fatalf("during quiet hours processed %d, sent %v", n, sent)
+	}
+	morning := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+	if m := scheduled(t, e.msgStore, id); m.Status != ScheduledPending || !m.SendAt.Equal(morning) {
+		t.Fatalf("deferred = %+v, want pending at %s", m, morning)
+	}
+
+	// al terminar la ventana sale de inmediato
+	if n := e.sendDueScheduled(context.Background(), morning, send); n != 1 || len(sent) != 1 {
+		t.Fatalf("after quiet hours processed %d, sent %v", n, sent)
+	}
+	if m := scheduled(t, e.msgStore, id); m.Status != ScheduledSent {
+		t.Fatalf("status = %q, want sent", m.Status)
+	}
+
+	// modo drop: falla en vez de diferirse
+	e.quiet.drop = true
+	dropped, _ := e.msgStore.ScheduleMessage("51911000103@s.whatsapp.net", "nocturno", night)
+	e.sendDueScheduled(context.Background(), night, send)
+	if m := scheduled(t, e.msgStore, dropped); m.Status != ScheduledFailed || len(sent) != 1 {
+		t.Fatalf("drop mode = %+v, sent %v", m, sent)
+	}
+}
@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestHandleEventQuotedReply(t *testing.T) {
+	e := newTestEngine(t, nil)
+	chat := mustJID(t, "51977666555@s.whatsapp.net")
+	knownName(e, chat, "Cliente")
+
+	e.handleEvent(context.Background(), Handlers{}, inboundMessage(chat, "R1", &waProto.Message{
+		ExtendedTextMessage: &waProto.ExtendedTextMessage{
+			Text: proto.String("¿y ese cuánto cuesta?"),
+			ContextInfo: &waProto.ContextInfo{
+				StanzaID:      proto.String("OUT7"),
+				Participant:   proto.String("51900000000@s.whatsapp.net"),
+				QuotedMessage: &waProto.Message{Conversation: proto.String("Toyota Hilux 2019 - subasta el viernes")},
+			},
+		},
+	}))
+
+	envs := outboxEnvelopes(t, e, "contacts", sanitizePathPart(chat.String())+".ndjson")
+	if len(envs) != 1 {
+		t.Fatalf("got %d envelopes, want 1", len(envs))
+	}
+	env := envs[0]
+	if env.Text != "¿y ese cuánto cuesta?" {
+		t.Errorf("text = %q", env.Text)
+	}
+	if env.QuotedMessageID != "OUT7" || env.QuotedSender != "51900000000@s.whatsapp.net" || env.QuotedText != "Toyota Hilux 2019 - subasta el viernes" {
+		t.Errorf("quoted = %q %q %q", env.QuotedMessageID, env.QuotedSender, env.QuotedText)
+	}
+}
+
+func TestFillQuoted(t *testing.T) {
+	tests := []struct {
+		name     string
+		msg      *waProto.Message
+		wantID   string
+		wantText string
+		wantMent []string
+	}{
+		{name: "plain text", msg: &waProto.Message{Conversation: proto.String("hola")}},
+		{
+			name:     "image caption quoting a caption",
+			msg:      &waProto.Message{ImageMessage: &waProto.ImageMessage{ContextInfo: &waProto.ContextInfo{StanzaID: proto.String("A"), QuotedMessage: &waProto.Message{ImageMessage: &waProto.ImageMessage{Caption: proto.String("foto del auto")}}}}},
+			wantID:   "A",
+			wantText: "foto del auto",
+		},
+		{
+			name:     "quoting a location",
+			msg:      &waProto.Message{ExtendedTextMessage: &waProto.ExtendedTextMessage{Text: proto.String("ahí"), ContextInfo: &waProto.ContextInfo{StanzaID: proto.String("B"), QuotedMessage: &waProto.Message{LocationMessage: &waProto.LocationMessage{DegreesLatitude: proto.Float64(1), DegreesLongitude: proto.Float64(2)}}}}},
+			wantID:   "B",
+			wantText: "1.000000,2.000000",
+		},
+		{
+			name:     "mention without quote",
+			msg:      &waProto.Message{ExtendedTextMessage: &waProto.ExtendedTextMessage{Text: proto.String("@bob"), ContextInfo: &waProto.ContextInfo{MentionedJID: []string{"1@s.whatsapp.net"}}}},
+			wantMent: []string{"1@s.whatsapp.net"},
+		},
+		{
+			name:     "mentions and quote",
+			msg:      &waProto.Message{ExtendedTextMessage: &waProto.ExtendedTextMessage{Text: proto.String("@bob @ana mira"), ContextInfo: &waProto.ContextInfo{StanzaID: proto.String("C"), QuotedMessage: &waProto.Message{Conversation: proto.String("precio?")}, MentionedJID: []string{"1@s.whatsapp.net", "2@lid"}}}},
+			wantID:   "C",
+			wantText: "precio?",
+			wantMent: []string{"1@s.whatsapp.net", "2@lid"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var env ForwardEnvelope
+			fillQuoted(&env, tt.msg)
+			if env.QuotedMessageID != tt.wantID || env.QuotedText != tt.wantText {
+				t.Errorf("quoted = %q %q, want %q %q", env.QuotedMessageID, env.QuotedText, tt.wantID, tt.wantText)
+			}
+			if !slices.Equal(env.MentionedJIDs, tt.wantMent) {
+				t.Errorf("mentions = %v, want %v", env.MentionedJIDs, tt.wantMent)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package engine
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestNewEngineRateLimits(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) {
+		cfg.RateLimits = RateLimits{
+			Send:  RateLimit{Every: 200 * time.Millisecond, Burst: 3},
+			Media: RateLimit{Every: time.Second, Burst: 1},
+			// Status sin configurar: toma el valor por defecto
+		}
+	})
+
+	tests := []struct {
+		name  string
+		lim   *rate.Limiter
+		limit rate.Limit
+		burst int
+	}{
+		{"send", e.limiterSend, rate.Every(200 * time.Millisecond), 3},
+		{"media", e.limiterMedia, rate.Every(time.Second), 1},
+		{"status", e.limiterStat, rate.Every(500 * time.Millisecond), 1},
+	}
+	for _, tt := range tests {
+		if got := tt.lim.Limit(); got != tt.limit {
+			t.Errorf("%s Limit() = %v, want %v", tt.name, got, tt.limit)
+		}
+		if got := tt.lim.Burst(); got != tt.burst {
+			t.Errorf("%s Burst() = %d, want %d", tt.name, got, tt.burst)
+		}
+	}
+}
+
+func TestNewEngineRejectsInvalidRateLimits(t *testing.T) {
+	for name, rl := range map[string]RateLimits{
+		"zero burst":     {Send: RateLimit{Every: time.Second}},
+		"negative every": {Media: RateLimit{Every: -time.Second, Burst: 1}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewEngine(Config{MsgDBPath: filepath.Join(t.TempDir(), "m.db"), RateLimits: rl})
+			if err == nil {
+				t.Fatal("NewEngine accepted invalid rate limits")
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestHandleEventDisconnectConnectSequence(t *testing.T) {
+	e := newTestEngine(t, nil)
+	ctx := context.Background()
+	// sin cliente no hay a qué reconectar: el reconnectLoop del Disconnected sale de inmediato
+	stopped, cancel := context.WithCancel(ctx)
+	cancel()
+
+	e.handleEvent(ctx, Handlers{}, &events.Connected{})
+	if !e.conn.up() {
+		t.Fatal("not online after Connected")
+	}
+	e.handleEvent(stopped, Handlers{}, &events.Disconnected{})
+	if e.conn.up() {
+		t.Fatal("still online after Disconnected")
+	}
+
+	// un envío durante la caída queda retenido hasta reconectar
+	sent := make(chan string, 1)
+	go func() {
+		id, err := e.EnqueueSend(ctx, &SendJob{To: mustJID(t, "51900000001@s.whatsapp.net"), run: func(ctx context.Context) (string, error) {
+			return "queued-while-down", nil
+		}})
+		if err == nil {
+			sent <- id
+		}
+	}()
+	select {
+	case id := <-sent:
+		t.Fatalf("job %q sent while disconnected", id)
+	case <-time.After(30 * time.Millisecond):
+	}
+
+	e.handleEvent(ctx, Handlers{}, &events.Connected{})
+	select {
+	case id := <-sent:
+		if id != "queued-while-down" {
+			t.Errorf("sent %q", id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("queued job not flushed after reconnect")
+	}
+
+	envs := outboxEnvelopes(t, e, "devices", hostID()+".ndjson")
+	var got []string
+	for _, env := range envs {
+		got = append(got, env.EventType)
+	}
+	want := []string{"connected", "disconnected", "reconnected"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Fatalf("event types = %v, want %v", got, want)
+	}
+	if _, ok := envs[2].Extra["downtime_ms"]; !ok {
+		t.Errorf("reconnected envelope without downtime_ms: %v", envs[2].Extra)
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		base, max time.Duration
+		attempt   int
+		want      time.Duration
+	}{
+		{time.Second, time.Minute, 0, time.Second},
+		{time.Second, time.Minute, 3, 8 * time.Second},
+		{time.Second, 10 * time.Second, 5, 10 * time.Second},
+		{0, 0, 10, 60 * time.Second}, // defaults: 1s base, 60s tope
+	}
+	for _, tt := range tests {
+		got := backoffDelay(tt.base, tt.max, tt.attempt)
+		lo, hi := tt.want-tt.want/5, tt.want+tt.want/5
+		if got < lo || got > hi {
+			t.Errorf("backoffDelay(%s, %s, %d) = %s, want %s ±20%%", tt.base, tt.max, tt.attempt, got, tt.want)
+		}
+	}
+}
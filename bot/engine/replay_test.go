@@ -0,0 +1,145 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookRecorder servidor de webhook de prueba que guarda cada envelope recibido
+type webhookRecorder struct {
+	mu       sync.Mutex
+	status   int
+	bodies   [][]byte
+	replayed int
+}
+
+func newWebhookRecorder(t *testing.T, status int) (*webhookRecorder, *httptest.Server) {
+	t.Helper()
+	rec := &webhookRecorder{status: status}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		rec.mu.Lock()
+		rec.bodies = append(rec.bodies, b)
+		if r.Header.Get("X-Whatsbot-Replay") == "1" {
+			rec.replayed++
+		}
+		rec.mu.Unlock()
+		w.WriteHeader(rec.status)
+	}))
+	t.Cleanup(srv.Close)
+	return rec, srv
+}
+
+// ids message_id de los envelopes recibidos, en orden de llegada
+func (r *webhookRecorder) ids() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []string
+	for _, b := range r.bodies {
+		var env ForwardEnvelope
+		_ = json.Unmarshal(b, &env)
+		out = append(out, env.MessageID)
+	}
+	return out
+}
+
+func withWebhook(url string) func(cfg *Config) {
+	return func(cfg *Config) {
+		cfg.APIToken = testAPIToken
+		cfg.Forward.Webhook = WebhookConfig{Enabled: true, URL: url}
+	}
+}
+
+func TestReplayFolder(t *testing.T) {
+	hook, srv := newWebhookRecorder(t, http.StatusOK)
+	e := newTestEngine(t, withWebhook(srv.URL))
+	e.fileSink.opts.MaxBytes = 200 // fuerza partes rotadas
+
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	write := func(file, id string, at time.Time) {
+		t.Helper()
+		b, _ := json.Marshal(ForwardEnvelope{EventType: "message", ChatJID: "x", MessageID: id, At: at.Format(time.RFC3339)})
+		if err := e.fileSink.AppendTo("contacts", file, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// dos chats intercalados en el tiempo; el primero con varias partes rotadas
+	for i := 0; i < 6; i++ {
+		write("a.ndjson", fmt.Sprintf("A%d", i), base.Add(time.Duration(2*i)*time.Minute))
+		write("b.ndjson", fmt.Sprintf("B%d", i), base.Add(time.Duration(2*i+1)*time.Minute))
+	}
+
+	tests := []struct {
+		name      string
+		opts      ReplayOptions
+		wantIDs   []string
+		wantMatch int
+	}{
+		{"dry run sends nothing", ReplayOptions{DryRun: true}, nil, 12},
+		{"since filter", ReplayOptions{Since: base.Add(8 * time.Minute), Every: time.Millisecond}, []string{"A4", "B4", "A5", "B5"}, 4},
+		{"all in At order", ReplayOptions{Every: time.Millisecond}, []string{"A0", "B0", "A1", "B1", "A2", "B2", "A3", "B3", "A4", "B4", "A5", "B5"}, 12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook.mu.Lock()
+			hook.bodies, hook.replayed = nil, 0
+			hook.mu.Unlock()
+			res, err := e.ReplayFolder(context.Background(), "contacts", tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Matched != tt.wantMatch || res.Sent != len(tt.wantIDs) || res.Failed != 0 {
+				t.Fatalf("result = %+v", res)
+			}
+			if got := hook.ids(); strings.Join(got, ",") != strings.Join(tt.wantIDs, ",") {
+				t.Fatalf("webhook got %v, want %v", got, tt.wantIDs)
+			}
+			if hook.replayed != len(tt.wantIDs) {
+				t.Fatalf("%d requests flagged X-Whatsbot-Replay, want %d", hook.replayed, len(tt.wantIDs))
+			}
+		})
+	}
+	if parts := listParts(filepath.Join(e.fileSink.base, "contacts", "a.ndjson")); len(parts) == 0 {
+		t.Fatal("expected rotated parts in the outbox")
+	}
+}
+
+func TestReplayFolderErrors(t *testing.T) {
+	e := newTestEngine(t, nil)
+	if _, err := e.ReplayFolder(context.Background(), "../etc", ReplayOptions{DryRun: true}); err == nil || !strings.Contains(err.Error(), "unknown category") {
+		t.Errorf("bad category err = %v", err)
+	}
+	if _, err := e.ReplayFolder(context.Background(), "contacts", ReplayOptions{}); err == nil || !strings.Contains(err.Error(), "webhook disabled") {
+		t.Errorf("webhook disabled err = %v", err)
+	}
+}
+
+func TestRESTReplay(t *testing.T) {
+	_, srv := newWebhookRecorder(t, http.StatusOK)
+	e := newTestEngine(t, withWebhook(srv.URL))
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+	}{
+		{"dry run", `{"category":"contacts","dry_run":true}`, http.StatusOK},
+		{"bad since", `{"category":"contacts","since":"ayer"}`, http.StatusBadRequest},
+		{"unknown category", `{"category":"nope"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := serveREST(e, http.MethodPost, "/api/replay", tt.body, nil); rec.Code != tt.wantCode {
+				t.Fatalf("code = %d %s", rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// scheduled estado actual del programado id (todos los estados)
+func scheduled(t *testing.T, s *MessageStore, id int64) ScheduledMessage {
+	t.Helper()
+	list, err := s.ListScheduled("", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range list {
+		if m.ID == id {
+			return m
+		}
+	}
+	t.Fatalf("scheduled #%d not found", id)
+	return ScheduledMessage{}
+}
+
+func TestSendDueScheduledFiresAtDueTime(t *testing.T) {
+	e := newTestEngine(t, nil)
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	first, _ := e.msgStore.ScheduleMessage("51911000080@s.whatsapp.net", "recordatorio 1", base.Add(time.Minute))
+	second, _ := e.msgStore.ScheduleMessage("51911000081@s.whatsapp.net", "recordatorio 2", base.Add(2*time.Minute))
+	failing, _ := e.msgStore.ScheduleMessage("51911000082@s.whatsapp.net", "recordatorio 3", base.Add(2*time.Minute))
+
+	var sent []string
+	send := func(ctx context.Context, to types.JID, text string) (string, error) {
+		sent = append(sent, to.User+":"+text)
+		if to.User == "51911000082" {
+			return "", errors.New("not on WhatsApp")
+		}
+		return "ID-" + to.User, nil
+	}
+
+	// antes de la hora no sale nada
+	if n := e.sendDueScheduled(context.Background(), base, send); n != 0 || len(sent) != 0 {
+		t.Fatalf("before due: processed %d, sent %v", n, sent)
+	}
+	if n := e.sendDueScheduled(context.Background(), base.Add(time.Minute), send); n != 1 {
+		t.Fatalf("at first due time processed %d, want 1", n)
+	}
+	if m := scheduled(t, e.msgStore, first); m.Status != ScheduledSent || m.MessageID != "ID-51911000080" || m.SentAt == nil {
+		t.Fatalf("first = %+v", m)
+	}
+	if m := scheduled(t, e.msgStore, second); m.Status != ScheduledPending {
+		t.Fatalf("second fired early: %+v", m)
+	}
+
+	if n := e.sendDueScheduled(context.Background(), base.Add(time.Hour), send); n != 2 {
+		t.Fatalf("later processed %d, want 2", n)
+	}
+	if m := scheduled(t, e.msgStore, second); m.Status != ScheduledSent || m.MessageID != "ID-51911000081" {
+		t.Fatalf("second = %+v", m)
+	}
+	if m := scheduled(t, e.msgStore, failing); m.Status != ScheduledFailed || m.Error != "not on WhatsApp" || m.MessageID != "" {
+		t.Fatalf("failing = %+v", m)
+	}
+
+	// cada programado sale una sola vez
+	if n := e.sendDueScheduled(context.Background(), base.Add(2*time.Hour), send); n != 0 || len(sent) != 3 {
+		t.Fatalf("re-run processed %d, sent %v", n, sent)
+	}
+	if sent[0] != "51911000080:recordatorio 1" {
+		t.Fatalf("sent = %v", sent)
+	}
+}
+
+func TestScheduledCancelNeverSends(t *testing.T) {
+	e := newTestEngine(t, nil)
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	id, err := e.msgStore.ScheduleMessage("51911000083@s.whatsapp.net", "cancelado", base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.msgStore.CancelScheduled(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.msgStore.CancelScheduled(id); !errors.Is(err, ErrScheduledNotFound) {
+		t.Fatalf("second cancel = %v, want ErrScheduledNotFound", err)
+	}
+
+	send := func(ctx context.Context, to types.JID, text string) (string, error) {
+		t.Fatalf("canceled message sent to %s", to)
+		return "", nil
+	}
+	if n := e.sendDueScheduled(context.Background(), base.Add(time.Hour), send); n != 0 {
+		t.Fatalf("processed %d canceled messages", n)
+	}
+	if m := scheduled(t, e.msgStore, id); m.Status != ScheduledCanceled {
+		t.Fatalf("status = %q, want canceled", m.Status)
+	}
+
+	// lo que ya salió no se puede cancelar
+	sentID, _ := e.msgStore.ScheduleMessage("51911000083@s.whatsapp.net", "enviado", base)
+	e.sendDueScheduled(context.Background(), base, func(context.Context, types.JID, string) (string, error) { return "ID1", nil })
+	if err := e.msgStore.CancelScheduled(sentID); !errors.Is(err, ErrScheduledNotFound) {
+		t.Fatalf("cancel after send = %v", err)
+	}
+}
+
+func TestFailInterruptedScheduled(t *testing.T) {
+	e := newTestEngine(t, nil)
+	now := time.Now()
+	id, _ := e.msgStore.ScheduleMessage("51911000084@s.whatsapp.net", "a medias", now)
+	if _, err := e.msgStore.ClaimDueScheduled(now, 10); err != nil {
+		t.Fatal(err)
+	}
+	// reinicio con el programado en "sending": no se reintenta
+	if n, err := e.msgStore.FailInterruptedScheduled(); err != nil || n != 1 {
+		t.Fatalf("FailInterruptedScheduled = %d, %v", n, err)
+	}
+	if m := scheduled(t, e.msgStore, id); m.Status != ScheduledFailed || m.Error == "" {
+		t.Fatalf("interrupted = %+v", m)
+	}
+}
+
+func TestRESTSchedule(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) { cfg.APIToken = testAPIToken })
+
+	rec := serveREST(e, http.MethodPost, "/api/schedule", `{"recipient":"51911000085","message":"hola","delay":"2h"}`, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST = %d %s", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || created.ID == 0 {
+		t.Fatalf("POST body %s: %v", rec.Body.String(), err)
+	}
+	if m := scheduled(t, e.msgStore, created.ID); m.Recipient != "51911000085@s.whatsapp.net" || time.Until(m.SendAt) < time.Hour {
+		t.Fatalf("stored = %+v", m)
+	}
+
+	for name, payload := range map[string]string{
+		"no message":     `{"recipient":"51911000085","delay":"1h"}`,
+		"no time":        `{"recipient":"51911000085","message":"hola"}`,
+		"both times":     `{"recipient":"51911000085","message":"hola","delay":"1h","send_at":"2030-01-01T10:00:00Z"}`,
+		"bad send_at":    `{"recipient":"51911000085","message":"hola","send_at":"mañana"}`,
+		"negative delay": `{"recipient":"51911000085","message":"hola","delay":"-1h"}`,
+	} {
+		if rec := serveREST(e, http.MethodPost, "/api/schedule", payload, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s = %d, want 400", name, rec.Code)
+		}
+	}
+
+	var list struct {
+		Count     int                `json:"count"`
+		Scheduled []ScheduledMessage `json:"scheduled"`
+	}
+	rec = serveREST(e, http.MethodGet, "/api/schedule", "", nil)
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || list.Count != 1 || list.Scheduled[0].ID != created.ID {
+		t.Fatalf("GET = %d %s", rec.Code, rec.Body.String())
+	}
+
+	path := "/api/schedule/" + strconv.FormatInt(created.ID, 10)
+	if rec := serveREST(e, http.MethodDelete, path, "", nil); rec.Code != http.StatusOK {
+		t.Fatalf("DELETE = %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := serveREST(e, http.MethodDelete, path, "", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("second DELETE = %d, want 404", rec.Code)
+	}
+	if rec := serveREST(e, http.MethodDelete, "/api/schedule/abc", "", nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("DELETE invalid id = %d, want 400", rec.Code)
+	}
+	rec = serveREST(e, http.MethodGet, "/api/schedule", "", nil)
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || list.Count != 0 {
+		t.Fatalf("pending after DELETE = %s", rec.Body.String())
+	}
+	rec = serveREST(e, http.MethodGet, "/api/schedule?status=canceled", "", nil)
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || list.Count != 1 {
+		t.Fatalf("canceled list = %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSearchMessages(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) { cfg.APIToken = testAPIToken })
+	ana := mustJID(t, "51911000020@s.whatsapp.net").String()
+	luis := mustJID(t, "51911000021@s.whatsapp.net").String()
+	base := time.Now().Add(-time.Hour)
+	for i, m := range []struct{ chat, id, text string }{
+		{ana, "S1", "Hola, ¿la Hilux 2019 sigue disponible?"},
+		{luis, "S2", "Busco un Kia Rio"},
+		{luis, "S3", "¿y alguna hilux automática?"},
+		{ana, "S4", "descuento del 100%"},
+	} {
+		if err := e.msgStore.SaveMessage(m.chat, m.id, m.chat, m.text, base.Add(time.Duration(i)*time.Minute), false, sql.NullString{}, sql.NullString{}, sql.NullString{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	modes := map[string]bool{"like": false}
+	if e.msgStore.fts {
+		modes["fts5"] = true
+	}
+	for name, fts := range modes {
+		t.Run(name, func(t *testing.T) {
+			e.msgStore.fts = fts
+
+			hits, err := e.msgStore.SearchMessages("HILUX", 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// más recientes primero, con el chat de cada mensaje
+			if len(hits) != 2 || hits[0]["id"] != "S3" || hits[0]["chat_jid"] != luis || hits[1]["id"] != "S1" || hits[1]["chat_jid"] != ana {
+				t.Fatalf("hits = %v", hits)
+			}
+			if hits[0]["timestamp"] == "" {
+				t.Fatal("hit without timestamp")
+			}
+
+			// todos los términos deben aparecer
+			if hits, _ := e.msgStore.SearchMessages("hilux 2019", 10); len(hits) != 1 || hits[0]["id"] != "S1" {
+				t.Fatalf("multi-term hits = %v", hits)
+			}
+
+			for _, q := range []string{"corolla", `"`, "   "} {
+				miss, err := e.msgStore.SearchMessages(q, 10)
+				if err != nil || miss == nil || len(miss) != 0 {
+					t.Fatalf("SearchMessages(%q) = %v, %v; want empty list", q, miss, err)
+				}
+			}
+		})
+	}
+
+	// en LIKE los comodines del usuario son literales
+	e.msgStore.fts = false
+	if hits, _ := e.msgStore.SearchMessages("%", 10); len(hits) != 1 || hits[0]["id"] != "S4" {
+		t.Fatalf("%% hits = %v", hits)
+	}
+}
+
+func TestRESTMessagesSearch(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) { cfg.APIToken = testAPIToken })
+	chat := mustJID(t, "51911000022@s.whatsapp.net").String()
+	if err := e.msgStore.SaveMessage(chat, "Q1", chat, "precio de la Hilux", time.Now(), false, sql.NullString{}, sql.NullString{}, sql.NullString{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var body struct {
+		Count    int              `json:"count"`
+		Mode     string           `json:"mode"`
+		Messages []map[string]any `json:"messages"`
+	}
+	rec := serveREST(e, http.MethodGet, "/api/messages/search?q=hilux", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("search = %d %s", rec.Code, rec.Body.String())
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Count != 1 || body.Messages[0]["chat_jid"] != chat || body.Mode == "" {
+		t.Fatalf("body = %+v", body)
+	}
+
+	rec = serveREST(e, http.MethodGet, "/api/messages/search?q=corolla", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("no-match = %d", rec.Code)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Count != 0 || body.Messages == nil {
+		t.Fatalf("no-match body = %s", rec.Body.String())
+	}
+
+	for _, path := range []string{"/api/messages/search", "/api/messages/search?q=hilux&limit=-1"} {
+		if rec := serveREST(e, http.MethodGet, path, "", nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("GET %s = %d, want 400", path, rec.Code)
+		}
+	}
+}
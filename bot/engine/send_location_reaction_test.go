@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestBuildLocationMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		lat, lng    float64
+		locName     string
+		address     string
+		wantName    bool
+		wantAddress bool
+	}{
+		{"coordinates only", -12.046374, -77.042793, "", "", false, false},
+		{"with name", -12.046374, -77.042793, "Oficina Surquillo", "", true, false},
+		{"with name and address", -12.1, -77.0, "Oficina", "Av. Principal 123", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc := buildLocationMessage(tt.lat, tt.lng, tt.locName, tt.address).GetLocationMessage()
+			if loc == nil {
+				t.Fatal("LocationMessage is nil")
+			}
+			if loc.GetDegreesLatitude() != tt.lat || loc.GetDegreesLongitude() != tt.lng {
+				t.Errorf("coords = %v,%v", loc.GetDegreesLatitude(), loc.GetDegreesLongitude())
+			}
+			if (loc.Name != nil) != tt.wantName || loc.GetName() != tt.locName {
+				t.Errorf("name = %v", loc.Name)
+			}
+			if (loc.Address != nil) != tt.wantAddress || loc.GetAddress() != tt.address {
+				t.Errorf("address = %v", loc.Address)
+			}
+		})
+	}
+}
+
+func TestReactionProto(t *testing.T) {
+	private := types.NewJID("51911222333", types.DefaultUserServer)
+	group := types.NewJID("120363000000000001", types.GroupServer)
+	member := types.NewJID("51944555666", types.DefaultUserServer)
+	tests := []struct {
+		name            string
+		chat, sender    types.JID
+		emoji           string
+		wantFromMe      bool
+		wantParticipant string
+	}{
+		{"our message", private, types.EmptyJID, "👍", true, ""},
+		{"customer message", private, private, "👍", false, ""},
+		{"group member message", group, member, "❤️", false, member.String()},
+		{"remove reaction", private, private, "", false, ""},
+	}
+	e := &Engine{} // BuildReaction no necesita conexión
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := e.client.BuildReaction(tt.chat, tt.sender, "MSG1", tt.emoji)
+			key := msg.GetReactionMessage().GetKey()
+			if key.GetID() != "MSG1" || key.GetRemoteJID() != tt.chat.String() || key.GetFromMe() != tt.wantFromMe || key.GetParticipant() != tt.wantParticipant {
+				t.Fatalf("key = %v", key)
+			}
+			react := reactionFromMessage(msg)
+			if react["emoji"] != tt.emoji || react["target_id"] != "MSG1" || react["target_from_me"] != tt.wantFromMe || react["removed"] != (tt.emoji == "") {
+				t.Fatalf("reaction = %v", react)
+			}
+		})
+	}
+}
+
+func TestSendLocationAndReactionValidation(t *testing.T) {
+	e := &Engine{}
+	to := types.NewJID("51911222333", types.DefaultUserServer)
+	for _, c := range [][2]float64{{91, 0}, {-91, 0}, {0, 181}, {0, -181}} {
+		if _, err := e.SendLocation(context.Background(), to, c[0], c[1], "", ""); err == nil || !strings.Contains(err.Error(), "invalid coordinates") {
+			t.Errorf("SendLocation(%v) err = %v", c, err)
+		}
+	}
+	if _, err := e.SendReaction(context.Background(), to, to, "  ", "👍"); err == nil || !strings.Contains(err.Error(), "target message id required") {
+		t.Errorf("SendReaction without target err = %v", err)
+	}
+}
+
+func TestParseRecipientJID(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"51911222333", "51911222333@s.whatsapp.net", false},
+		{"51911222333@s.whatsapp.net", "51911222333@s.whatsapp.net", false},
+		{"120363000000000001@g.us", "120363000000000001@g.us", false},
+		{"98765@lid", "98765@lid", false},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseRecipientJID(tt.in)
+		if (err != nil) != tt.wantErr || (!tt.wantErr && got.String() != tt.want) {
+			t.Errorf("parseRecipientJID(%q) = %v, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestRESTLocationAndReactionRejectBadInput(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) { cfg.APIToken = testAPIToken })
+	tests := []struct {
+		name, path, body string
+		wantCode         int
+		wantBody         string
+	}{
+		{"location without recipient", "/api/location", `{"latitude":1,"longitude":2}`, http.StatusBadRequest, "recipient required"},
+		{"location bad coordinates", "/api/location", `{"recipient":"51911222333","latitude":100,"longitude":2}`, http.StatusInternalServerError, "invalid coordinates"},
+		{"reaction without recipient", "/api/reaction", `{"message_id":"M1","emoji":"👍"}`, http.StatusBadRequest, "recipient required"},
+		{"reaction without message id", "/api/reaction", `{"recipient":"51911222333","emoji":"👍"}`, http.StatusInternalServerError, "target message id required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveREST(e, http.MethodPost, tt.path, tt.body, nil)
+			if rec.Code != tt.wantCode || !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Fatalf("%s = %d %s", tt.path, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
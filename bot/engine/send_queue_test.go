@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitFor reintenta cond hasta que se cumpla (o falla a los 2s)
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSendQueueHighPriorityJumpsAhead(t *testing.T) {
+	e := newTestEngine(t, nil)
+	e.conn.markOnline()
+	to := mustJID(t, "51900000001@s.whatsapp.net")
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	started, release := make(chan struct{}), make(chan struct{})
+	enqueue := func(name string, prio SendPriority) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			job := &SendJob{To: to, Priority: prio, run: func(ctx context.Context) (string, error) {
+				mu.Lock()
+				order = append(order, name)
+				mu.Unlock()
+				if name == "low1" {
+					close(started)
+					<-release // ocupa el dispatcher mientras se encola el resto
+				}
+				return name, nil
+			}}
+			if id, err := e.EnqueueSend(context.Background(), job); err != nil || id != name {
+				t.Errorf("EnqueueSend(%s) = %q, %v", name, id, err)
+			}
+		}()
+	}
+
+	enqueue("low1", PriorityLow)
+	<-started
+	enqueue("low2", PriorityLow)
+	waitFor(t, "low2 queued", func() bool { return e.sendQ.pending() == 1 })
+	enqueue("low3", PriorityLow)
+	waitFor(t, "low3 queued", func() bool { return e.sendQ.pending() == 2 })
+	enqueue("high", PriorityHigh)
+	waitFor(t, "high queued", func() bool { return e.sendQ.pending() == 3 })
+	close(release)
+	wg.Wait()
+
+	want := []string{"low1", "high", "low2", "low3"}
+	if len(order) != len(want) {
+		t.Fatalf("order = %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("order = %v, want %v", order, want)
+		}
+	}
+}
+
+func TestEnqueueSendBackpressure(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) { cfg.SendQueueSize = 1 })
+	e.conn.markOnline()
+	to := mustJID(t, "51900000001@s.whatsapp.net")
+
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	busy := func(ctx context.Context) (string, error) { close(started); <-release; return "", nil }
+	noop := func(ctx context.Context) (string, error) { return "", nil }
+
+	go func() { _, _ = e.EnqueueSend(context.Background(), &SendJob{To: to, run: busy}) }()
+	<-started
+	go func() { _, _ = e.EnqueueSend(context.Background(), &SendJob{To: to, run: noop}) }() // llena la cola
+	waitFor(t, "queue full", func() bool { return e.sendQ.pending() == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := e.EnqueueSend(ctx, &SendJob{To: to, run: noop}); err != context.DeadlineExceeded {
+		t.Fatalf("EnqueueSend on full queue = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestSendQueueCloseReleasesPendingJobs(t *testing.T) {
+	e := newTestEngine(t, nil) // sin conexión: el primer job queda retenido y el resto en cola
+	to := mustJID(t, "51900000001@s.whatsapp.net")
+
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, err := e.EnqueueSend(context.Background(), &SendJob{To: to, run: func(context.Context) (string, error) {
+				t.Error("job ran after the queue closed")
+				return "", nil
+			}})
+			errs <- err
+		}()
+	}
+	waitFor(t, "jobs queued", func() bool { return e.sendQ.pending() == 2 })
+	e.sendQ.close()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case err := <-errs:
+			if !errors.Is(err, ErrQueueClosed) {
+				t.Fatalf("EnqueueSend = %v, want ErrQueueClosed", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("EnqueueSend still blocked after close")
+		}
+	}
+	waitFor(t, "queue drained", func() bool { return e.sendQ.pending() == 0 })
+}
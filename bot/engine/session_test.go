@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testAPIToken = "test-token"
+
+// serveREST request autenticado contra restHandler
+func serveREST(e *Engine, method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testAPIToken)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	e.restHandler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestSessionNotLoggedIn(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) { cfg.APIToken = testAPIToken })
+
+	if got := e.Session(); got != (SessionInfo{}) {
+		t.Errorf("Session() without client = %+v", got)
+	}
+
+	rec := serveREST(e, http.MethodGet, "/api/session", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/session = %d %s", rec.Code, rec.Body.String())
+	}
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["logged_in"] != false || body["connected"] != false {
+		t.Errorf("session body = %v", body)
+	}
+	if _, ok := body["jid"]; ok {
+		t.Errorf("jid present without session: %v", body)
+	}
+
+	if rec := serveREST(e, http.MethodPost, "/api/session", "", nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /api/session = %d", rec.Code)
+	}
+}
+
+func TestLogoutRequiresAdminSecret(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string // AdminSecret configurado
+		header string
+		want   int
+	}{
+		{"disabled without secret", "", "", http.StatusUnauthorized},
+		{"missing header", "s3cret", "", http.StatusUnauthorized},
+		{"wrong header", "s3cret", "nope", http.StatusUnauthorized},
+		{"not logged in", "s3cret", "s3cret", http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEngine(t, func(cfg *Config) {
+				cfg.APIToken = testAPIToken
+				cfg.AdminSecret = tt.secret
+			})
+			rec := serveREST(e, http.MethodPost, "/api/logout", "", map[string]string{"X-Engine-Admin-Secret": tt.header})
+			if rec.Code != tt.want {
+				t.Fatalf("POST /api/logout = %d %s, want %d", rec.Code, rec.Body.String(), tt.want)
+			}
+			if tt.want == http.StatusInternalServerError && !strings.Contains(rec.Body.String(), "not logged in") {
+				t.Errorf("body = %s", rec.Body.String())
+			}
+		})
+	}
+}
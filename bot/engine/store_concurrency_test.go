@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMessageStoreConnectionSettings(t *testing.T) {
+	s, err := NewMessageStore(filepath.Join(t.TempDir(), "messages.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var mode string
+	var timeout int
+	if err := s.db.QueryRow(`PRAGMA journal_mode`).Scan(&mode); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.db.QueryRow(`PRAGMA busy_timeout`).Scan(&timeout); err != nil {
+		t.Fatal(err)
+	}
+	if mode != "wal" || timeout != 5000 {
+		t.Fatalf("journal_mode = %q busy_timeout = %d, want wal 5000", mode, timeout)
+	}
+	if got := s.db.Stats().MaxOpenConnections; got != msgStoreMaxConns {
+		t.Fatalf("MaxOpenConnections = %d, want %d", got, msgStoreMaxConns)
+	}
+}
+
+func TestMessageStoreConcurrentWrites(t *testing.T) {
+	s, err := NewMessageStore(filepath.Join(t.TempDir(), "messages.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	const writers, perWriter = 24, 40
+	base := time.Now().Add(-time.Hour)
+	errs := make(chan error, writers*perWriter*2)
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			// IN y OUT alternados sobre unos pocos chats compartidos, con lecturas intercaladas
+			chat := fmt.Sprintf("5191100%04d@s.whatsapp.net", w%4)
+			for i := 0; i < perWriter; i++ {
+				id := fmt.Sprintf("W%02d-%03d", w, i)
+				if err := s.SaveMessage(chat, id, chat, "msg "+id, base.Add(time.Duration(i)*time.Millisecond), i%2 == 1, sql.NullString{}, sql.NullString{}, sql.NullString{}); err != nil {
+					errs <- fmt.Errorf("save %s: %w", id, err)
+				}
+				if i%5 == 0 {
+					if _, err := s.GetRecentMessages(chat, 20, time.Time{}, ""); err != nil {
+						errs <- fmt.Errorf("read %s: %w", chat, err)
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err) // incluye "database is locked"
+	}
+
+	var n int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM messages`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != writers*perWriter {
+		t.Fatalf("stored %d messages, want %d", n, writers*perWriter)
+	}
+}
@@ -0,0 +1,142 @@
+package engine
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type transcriptPage struct {
+	ChatJID      string           `json:"chat_jid"`
+	Count        int              `json:"count"`
+	Messages     []map[string]any `json:"messages"`
+	NextBefore   string           `json:"next_before"`
+	NextBeforeID string           `json:"next_before_id"`
+}
+
+func getTranscript(t *testing.T, e *Engine, query string) transcriptPage {
+	t.Helper()
+	rec := serveREST(e, http.MethodGet, "/api/transcript?"+query, "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/transcript?%s = %d %s", query, rec.Code, rec.Body.String())
+	}
+	var page transcriptPage
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
+
+func TestRESTTranscriptPagination(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) { cfg.APIToken = testAPIToken })
+	chat := mustJID(t, "51911000010@s.whatsapp.net")
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for i := 1; i <= 5; i++ {
+		id := "T" + strconv.Itoa(i)
+		if err := e.msgStore.SaveMessage(chat.String(), id, chat.String(), "msg "+id, base.Add(time.Duration(i)*time.Minute), i%2 == 0, sql.NullString{}, sql.NullString{}, sql.NullString{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ids := func(p transcriptPage) string {
+		var out []string
+		for _, m := range p.Messages {
+			out = append(out, m["id"].(string))
+		}
+		return strings.Join(out, ",")
+	}
+	q := url.Values{"chat": {chat.String()}, "limit": {"2"}}
+
+	first := getTranscript(t, e, q.Encode())
+	if ids(first) != "T4,T5" || first.Count != 2 || first.NextBefore == "" {
+		t.Fatalf("page 1 = %s next %q", ids(first), first.NextBefore)
+	}
+	q.Set("before", first.NextBefore)
+	q.Set("before_id", first.NextBeforeID)
+	second := getTranscript(t, e, q.Encode())
+	if ids(second) != "T2,T3" || second.NextBefore == "" {
+		t.Fatalf("page 2 = %s next %q", ids(second), second.NextBefore)
+	}
+	q.Set("before", second.NextBefore)
+	q.Set("before_id", second.NextBeforeID)
+	last := getTranscript(t, e, q.Encode())
+	if ids(last) != "T1" || last.NextBefore != "" {
+		t.Fatalf("page 3 = %s next %q", ids(last), last.NextBefore)
+	}
+
+	// texto descargable con dirección por línea
+	rec := serveREST(e, http.MethodGet, "/api/transcript?format=text&chat="+url.QueryEscape(chat.String()), "", nil)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Disposition"), "attachment") {
+		t.Fatalf("text = %d %v", rec.Code, rec.Header())
+	}
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != 5 || !strings.Contains(lines[0], "[IN]") || !strings.Contains(lines[1], "[OUT] me: msg T2") {
+		t.Fatalf("text transcript = %q", rec.Body.String())
+	}
+}
+
+func TestRESTTranscriptSameSecondPagination(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) { cfg.APIToken = testAPIToken })
+	chat := mustJID(t, "51911000011@s.whatsapp.net")
+	// tres mensajes en el mismo segundo: el cursor solo por timestamp se saltaba el tercero
+	ts := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, id := range []string{"S1", "S2", "S3"} {
+		if err := e.msgStore.SaveMessage(chat.String(), id, chat.String(), "msg "+id, ts, false, sql.NullString{}, sql.NullString{}, sql.NullString{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	q := url.Values{"chat": {chat.String()}, "limit": {"2"}}
+
+	seen := map[string]int{}
+	for page := 0; page < 3; page++ {
+		p := getTranscript(t, e, q.Encode())
+		for _, m := range p.Messages {
+			seen[m["id"].(string)]++
+		}
+		if p.NextBefore == "" {
+			break
+		}
+		q.Set("before", p.NextBefore)
+		q.Set("before_id", p.NextBeforeID)
+	}
+	if len(seen) != 3 || seen["S1"] != 1 || seen["S2"] != 1 || seen["S3"] != 1 {
+		t.Fatalf("messages seen across pages = %v, want S1..S3 once each", seen)
+	}
+}
+
+func TestRESTTranscriptUnknownChat(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) { cfg.APIToken = testAPIToken })
+	rec := serveREST(e, http.MethodGet, "/api/transcript?chat=51999999999@s.whatsapp.net", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unknown chat = %d %s", rec.Code, rec.Body.String())
+	}
+	// lista vacía (no null) y sin cursor
+	if !strings.Contains(rec.Body.String(), `"messages":[]`) {
+		t.Fatalf("body = %s", rec.Body.String())
+	}
+	page := getTranscript(t, e, "chat=51999999999@s.whatsapp.net")
+	if page.Count != 0 || page.NextBefore != "" {
+		t.Fatalf("page = %+v", page)
+	}
+}
+
+func TestRESTTranscriptValidation(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) { cfg.APIToken = testAPIToken })
+	for _, path := range []string{
+		"/api/transcript",
+		"/api/transcript?chat=51911000010@s.whatsapp.net&limit=0",
+		"/api/transcript?chat=51911000010@s.whatsapp.net&before=ayer",
+		"/api/transcript?chat=51911000010@s.whatsapp.net&before_id=T1",
+	} {
+		if rec := serveREST(e, http.MethodGet, path, "", nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("GET %s = %d, want 400", path, rec.Code)
+		}
+	}
+	if rec := serveREST(e, http.MethodPost, "/api/transcript?chat=x", "", nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST = %d", rec.Code)
+	}
+}
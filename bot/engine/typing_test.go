@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/investigadorinexperto/bot/pkg/typing"
+)
+
+// presenceRecorder reemplaza chatPresence y anota el orden de presencias y envíos
+type presenceRecorder struct {
+	mu     sync.Mutex
+	events []string
+	err    error
+}
+
+func (p *presenceRecorder) install(e *Engine) {
+	e.chatPresence = func(_ context.Context, chat types.JID, state types.ChatPresence, _ types.ChatPresenceMedia) error {
+		p.add(string(state))
+		return p.err
+	}
+}
+
+func (p *presenceRecorder) add(ev string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, ev)
+}
+
+func (p *presenceRecorder) String() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return strings.Join(p.events, ",")
+}
+
+func TestSendWithTypingOrder(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) { cfg.Typing = typing.Timing{Base: 30 * time.Millisecond} })
+	rec := &presenceRecorder{}
+	rec.install(e)
+	chat := mustJID(t, "51911000060@s.whatsapp.net")
+
+	start := time.Now()
+	var sentAfter time.Duration
+	id, err := e.sendWithTyping(context.Background(), chat, "hola", func() (string, error) {
+		sentAfter = time.Since(start)
+		rec.add("message")
+		return "MSG1", nil
+	})
+	if err != nil || id != "MSG1" {
+		t.Fatalf("sendWithTyping = %q, %v", id, err)
+	}
+	if got := rec.String(); got != "composing,message,paused" {
+		t.Fatalf("order = %s, want composing,message,paused", got)
+	}
+	if sentAfter < 30*time.Millisecond {
+		t.Fatalf("sent after %s, before the typing wait", sentAfter)
+	}
+}
+
+func TestSendWithTypingComposingFails(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) { cfg.Typing = typing.Timing{Base: time.Hour} })
+	rec := &presenceRecorder{err: errors.New("not connected")}
+	rec.install(e)
+
+	// sin "escribiendo" se envía igual, sin esperar
+	id, err := e.sendWithTyping(context.Background(), mustJID(t, "51911000061@s.whatsapp.net"), "hola", func() (string, error) {
+		rec.add("message")
+		return "MSG2", nil
+	})
+	if err != nil || id != "MSG2" || rec.String() != "composing,message" {
+		t.Fatalf("sendWithTyping = %q, %v; events %s", id, err, rec)
+	}
+}
+
+func TestSendWithTypingCanceled(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) { cfg.Typing = typing.Timing{Base: time.Hour} })
+	rec := &presenceRecorder{}
+	rec.install(e)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := e.sendWithTyping(ctx, mustJID(t, "51911000062@s.whatsapp.net"), "hola", func() (string, error) {
+		rec.add("message")
+		return "MSG3", nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v", err)
+	}
+	// cancelado durante la espera: no se envía, pero el "escribiendo" se pausa
+	if got := rec.String(); got != "composing,paused" {
+		t.Fatalf("order = %s", got)
+	}
+}
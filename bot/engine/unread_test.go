@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func TestUnreadChatsReadStateTransitions(t *testing.T) {
+	e := newTestEngine(t, nil)
+	ana := mustJID(t, "51911000001@s.whatsapp.net")
+	luis := mustJID(t, "51911000002@s.whatsapp.net")
+	base := time.Now().Add(-time.Hour)
+	save := func(chat types.JID, id string, fromMe bool, at time.Duration) {
+		t.Helper()
+		if err := e.msgStore.SaveMessage(chat.String(), id, chat.String(), "msg "+id, base.Add(at), fromMe, sql.NullString{}, sql.NullString{}, sql.NullString{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	receipt := func(chat types.JID, id string, rt types.ReceiptType, fromMe bool) {
+		e.handleEvent(context.Background(), Handlers{}, &events.Receipt{
+			MessageSource: types.MessageSource{Chat: chat, Sender: chat, IsFromMe: fromMe},
+			MessageIDs:    []types.MessageID{types.MessageID(id)},
+			Timestamp:     time.Now(),
+			Type:          rt,
+		})
+	}
+	unread := func() map[string]int {
+		t.Helper()
+		chats, err := e.msgStore.GetUnreadChats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := map[string]int{}
+		for _, c := range chats {
+			out[c["chat_jid"].(string)] = c["unread_count"].(int)
+		}
+		return out
+	}
+	expect := func(step string, want map[string]int) {
+		t.Helper()
+		got := unread()
+		if len(got) != len(want) {
+			t.Fatalf("%s: unread = %v, want %v", step, got, want)
+		}
+		for k, v := range want {
+			if got[k] != v {
+				t.Fatalf("%s: unread = %v, want %v", step, got, want)
+			}
+		}
+	}
+
+	save(ana, "UA1", false, 1*time.Minute)
+	save(ana, "UA2", false, 2*time.Minute)
+	save(luis, "UL1", false, 3*time.Minute)
+	expect("two inbound chats", map[string]int{ana.String(): 2, luis.String(): 1})
+
+	// nuestra respuesta no marca como leído
+	save(ana, "UA-OUT", true, 4*time.Minute)
+	expect("reply without read", map[string]int{ana.String(): 2, luis.String(): 1})
+
+	// el acuse del cliente (from_me=0) es sobre nuestros mensajes, no cuenta
+	receipt(ana, "UA-OUT", types.ReceiptTypeRead, false)
+	expect("customer read receipt", map[string]int{ana.String(): 2, luis.String(): 1})
+
+	// leído sólo el primero: queda uno pendiente
+	e.recordOwnRead(ana, []string{"UA1"}, string(types.ReceiptTypeRead))
+	expect("first read", map[string]int{ana.String(): 1, luis.String(): 1})
+
+	// leído desde otro dispositivo (read-self)
+	receipt(ana, "UA2", types.ReceiptTypeReadSelf, true)
+	expect("read-self", map[string]int{luis.String(): 1})
+
+	// entregado no es leído
+	receipt(luis, "UL1", types.ReceiptTypeDelivered, true)
+	expect("delivered only", map[string]int{luis.String(): 1})
+
+	// un mensaje nuevo reabre el chat
+	save(ana, "UA3", false, 5*time.Minute)
+	expect("new inbound", map[string]int{ana.String(): 1, luis.String(): 1})
+}
+
+func TestRESTUnread(t *testing.T) {
+	e := newTestEngine(t, func(cfg *Config) { cfg.APIToken = testAPIToken })
+	chat := mustJID(t, "51911000003@s.whatsapp.net")
+	if err := e.msgStore.SaveMessage(chat.String(), "R1", chat.String(), "¿sigue disponible?", time.Now(), false, sql.NullString{}, sql.NullString{}, sql.NullString{}); err != nil {
+		t.Fatal(err)
+	}
+	rec := serveREST(e, http.MethodGet, "/api/unread", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/api/unread = %d %s", rec.Code, rec.Body.String())
+	}
+	var body struct {
+		Count int              `json:"count"`
+		Chats []map[string]any `json:"chats"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Count != 1 || body.Chats[0]["last_message_id"] != "R1" || body.Chats[0]["last_text"] != "¿sigue disponible?" {
+		t.Fatalf("body = %+v", body)
+	}
+	if rec := serveREST(e, http.MethodPost, "/api/unread", "", nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST /api/unread = %d", rec.Code)
+	}
+}
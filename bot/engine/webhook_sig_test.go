@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/investigadorinexperto/bot/pkg/webhooksig"
+)
+
+func TestWebhookPostIsVerifiableWithSharedHelper(t *testing.T) {
+	const secret = "compartido"
+	var verified, timestampOK bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		verified = webhooksig.Verify(secret, body, r.Header.Get(webhooksig.HeaderSignature))
+		timestampOK = webhooksig.CheckTimestamp(r.Header.Get(webhooksig.HeaderTimestamp), time.Minute) == nil
+	}))
+	defer srv.Close()
+
+	e := &Engine{}
+	if err := e.postJSONWithRetry(context.Background(), srv.URL, secret, nil, map[string]string{"event_type": "message"}); err != nil {
+		t.Fatal(err)
+	}
+	if !verified || !timestampOK {
+		t.Fatalf("verified = %v, timestamp ok = %v", verified, timestampOK)
+	}
+}
+
+func TestWebhookPostSignsFreshNonce(t *testing.T) {
+	const secret = "compartido"
+	var nonces []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		nonce := r.Header.Get(webhooksig.HeaderNonce)
+		if !webhooksig.VerifyBound(secret, r.Header.Get(webhooksig.HeaderTimestamp), nonce, body, r.Header.Get(webhooksig.HeaderSignatureBound)) {
+			t.Errorf("bound signature does not verify for nonce %q", nonce)
+		}
+		nonces = append(nonces, nonce)
+	}))
+	defer srv.Close()
+
+	e := &Engine{}
+	for i := 0; i < 2; i++ {
+		if err := e.postJSONWithRetry(context.Background(), srv.URL, secret, nil, map[string]string{"event_type": "message"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(nonces) != 2 || nonces[0] == "" || nonces[0] == nonces[1] {
+		t.Fatalf("nonces = %q, want two distinct", nonces)
+	}
+}
+
+func TestWebhookPostWithoutSecretIsUnsigned(t *testing.T) {
+	var sig string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sig = r.Header.Get(webhooksig.HeaderSignature)
+	}))
+	defer srv.Close()
+
+	e := &Engine{}
+	if err := e.postJSONWithRetry(context.Background(), srv.URL, "", nil, map[string]string{"event_type": "message"}); err != nil {
+		t.Fatal(err)
+	}
+	if sig != "" {
+		t.Fatalf("unexpected signature header %q", sig)
+	}
+}
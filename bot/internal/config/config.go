@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -17,11 +18,43 @@ type AppConfig struct {
 	BackupEvery           time.Duration
 	MaxConnAttempts       int
 	ReconnectBaseDelay    time.Duration
-	SendPresenceAvailable bool // nuevo
+	ReconnectMaxDelay     time.Duration
+	SendPresenceAvailable bool          // nuevo
+	MsgRetentionDays      int           // días de mensajes a conservar en MsgDBPath (0 = sin poda)
+	MsgPruneEvery         time.Duration // intervalo de la poda
+	HistoryMaxPerChat     int           // mensajes por chat a importar del HistorySync (0 = todos, <0 = no importar)
+	ChatNameTTL           time.Duration // caché de nombres de grupos/contactos (<0 = sin caché)
+	PresenceMode          string        // available|unavailable (por defecto según SendPresenceAvailable)
+	PresenceAwayAfter     time.Duration // auto-away tras este tiempo sin envíos (0 = off)
+	ScheduleTick          time.Duration // revisión de mensajes programados (/api/schedule)
+	QuietHours            string        // horario de silencio "22:00-08:00" (vacío = sin horario)
+	QuietTimezone         string        // zona IANA del horario de silencio (vacío = local)
+	QuietMode             string        // defer|drop para envíos en horario de silencio
+	QuietReplyWindow      time.Duration // responder igual si el contacto escribió hace menos de esto
+
+	// ===== Rate limits de envío (intervalo mínimo + ráfaga) =====
+	RateSendEvery   time.Duration
+	RateSendBurst   int
+	RateMediaEvery  time.Duration
+	RateMediaBurst  int
+	RateStatusEvery time.Duration
+	RateStatusBurst int
+	SendQueueSize   int
+	EngineAdminKey  string // secreto para /api/logout
+	EngineAPIToken  string // bearer del REST del engine (lo usa también whserver)
+	EngineNoAuthDev bool
+	EngineBodyLimit int64
+	MediaBaseDir    string
+	MaxMediaBytes   int64
+	MediaFetchTO    time.Duration
 
 	// ===== Forward (Folder + Webhook) =====
 	ForwardMode      string
 	Outbox           string
+	OutboxMaxBytes   int64
+	OutboxGzip       bool
+	OutboxRetain     int
+	OutboxFsync      bool
 	ContextDepth     int
 	ForwardExtraJSON map[string]any
 
@@ -49,19 +82,50 @@ type AppConfig struct {
 	ServerDedupeWindow     time.Duration
 	ServerUseTimestamp     bool
 	ServerAllowNoSecretDev bool
+	ServerRequireNonce     bool          // anti-replay: nonce único + firma ligada a ts/nonce
+	ServerRequireJSONCT    bool          // 415 si Content-Type no es application/json
+	ServerProfileCache     int           // perfiles en memoria (LRU); el resto queda en disco
+	ServerProfileFlush     time.Duration // 0 = persistir en cada evento
+	ServerStreakTZ         string        // zona IANA para contar días de racha (p. ej. America/Lima)
+	ServerAdminToken       string        // Bearer para endpoints admin (bloqueos); vacío = deshabilitados
+	ServerBlockListFile    string        // JIDs bloqueados, uno por línea
+	ServerRatePerChatMax   int           // mensajes por chat por ventana (0 = sin límite)
+	ServerRatePerChatWin   time.Duration
+	ServerGroupMentionOnly bool     // en grupos, responder solo si mencionan/citan al bot
+	ServerBotJIDs          []string // JIDs propios (teléfono y/o LID)
+	ServerOTLPEndpoint     string   // collector OTLP/HTTP para tracing (vacío = no-op)
 
 	// Punteros REST del server hacia el engine
 	ServerEngineSendURL     string // WH_ENGINE_SEND_URL
 	ServerEngineTypingURL   string // WH_ENGINE_TYPING_URL
 	ServerEngineMarkReadURL string // WH_ENGINE_MARKREAD_URL   <-- NUEVO
+	ServerEngineMediaURL    string // WH_ENGINE_MEDIA_URL (descarga de notas de voz, imágenes y documentos)
+
+	// ===== Backend BOB (orquestador IA) =====
+	BOBBackendURL     string        // WH_BOB_BACKEND_URL
+	BOBBackendTimeout time.Duration // WH_BOB_BACKEND_TIMEOUT
+	BOBTranscribeURL  string        // WH_BOB_TRANSCRIBE_URL (vacío = notas de voz sin respuesta)
+	VoiceMaxSeconds   int           // WH_VOICE_MAX_SECONDS: notas más largas no se transcriben (0 = sin tope)
+	BOBExtractURL     string        // WH_BOB_EXTRACT_URL (vacío = imágenes/PDF sin OCR)
+	OCRMaxBytes       int64         // WH_OCR_MAX_BYTES: adjuntos más pesados no pasan por OCR (0 = sin tope)
 
 	// ===== Reply typing wait (tunable por .env) =====
-	ReplyBaseWait  time.Duration
-	ReplyPerCharMs int
-	ReplyJitterMs  int
-	ReplyMaxWait   time.Duration
-	PreReplyDelay  time.Duration
-	AggWindow      time.Duration
+	ReplyBaseWait    time.Duration
+	ReplyPerCharMs   int
+	ReplyJitterMs    int
+	ReplyMaxWait     time.Duration
+	ReplyMinWait     time.Duration // piso de la espera (se aplica antes del tope)
+	ReplyBubbleMax   int           // >0: respuestas más largas se parten en varias burbujas
+	ReplyBubblePause time.Duration // pausa entre burbujas
+	PreReplyDelay    time.Duration
+	ReplyCooldown    time.Duration // >0: intervalo mínimo entre respuestas al mismo chat
+	AggWindow        time.Duration
+	AggMaxBatch      int                      // flush anticipado al llegar a N mensajes (0 = off)
+	AggWindows       map[string]time.Duration // ventana por chat (JID → duración)
+	AggMaxWait       time.Duration            // tope desde el primer mensaje (0 = sin tope)
+	AggTypingWin     time.Duration            // extensión por "escribiendo" (0 = igual a la ventana)
+	AggFirstWindow   time.Duration            // ventana mínima del primer contacto de un chat (0 = off)
+	AggFirstMinMsgs  int                      // con N mensajes el primer contacto usa la ventana normal (0 = off)
 }
 
 // ---------- helpers ----------
@@ -97,18 +161,43 @@ func getenvDur(k, def string) time.Duration {
 	}
 	return d
 }
+func splitCSV(raw string) []string {
+	var out []string
+	for _, p := range strings.Split(raw, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
 
 func Load() *AppConfig {
 	// Headers extra para webhook
 	var hdrs map[string]string
 	_ = json.Unmarshal([]byte(getenv("WH_WEBHOOK_HEADERS_JSON", "{}")), &hdrs)
 
+	// Ventanas del agregador por chat: {"<jid>":"5s"}
+	aggWindows := map[string]time.Duration{}
+	var rawWins map[string]string
+	_ = json.Unmarshal([]byte(getenv("WH_AGGREGATOR_WINDOWS_JSON", "{}")), &rawWins)
+	for jid, v := range rawWins {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			aggWindows[jid] = d
+		}
+	}
+
 	// Extra params para adjuntar en el envelope
 	var extra map[string]any
 	_ = json.Unmarshal([]byte(getenv("WH_FORWARD_EXTRA_JSON", `{"tenant":"acme","lang":"es"}`)), &extra)
 
 	base := getenv("WH_ENGINE_BASE_URL", "http://localhost:8080")
 
+	// Presencia: WH_PRESENCE_MODE; sin ella manda el flag WH_SEND_PRESENCE_AVAILABLE
+	presenceMode := "available"
+	if !getenvBool01("WH_SEND_PRESENCE_AVAILABLE", true) {
+		presenceMode = "unavailable"
+	}
+
 	return &AppConfig{
 		// ===== Engine/Bot =====
 		DBPath:                getenv("WH_DB_PATH", "data/session.db"),
@@ -118,11 +207,43 @@ func Load() *AppConfig {
 		BackupEvery:           getenvDur("WH_BACKUP_EVERY", "30m"),
 		MaxConnAttempts:       getenvInt("WH_MAX_CONN_ATTEMPTS", 5),
 		ReconnectBaseDelay:    getenvDur("WH_RECONNECT_BASE_DELAY", "2s"),
+		ReconnectMaxDelay:     getenvDur("WH_RECONNECT_MAX_DELAY", "60s"),
 		SendPresenceAvailable: getenvBool01("WH_SEND_PRESENCE_AVAILABLE", true),
+		MsgRetentionDays:      getenvInt("WH_MSG_RETENTION_DAYS", 0),
+		MsgPruneEvery:         getenvDur("WH_MSG_PRUNE_EVERY", "24h"),
+		HistoryMaxPerChat:     getenvInt("WH_HISTORY_MAX_PER_CHAT", 200),
+		ChatNameTTL:           getenvDur("WH_CHAT_NAME_TTL", "10m"),
+		PresenceMode:          getenv("WH_PRESENCE_MODE", presenceMode),
+		PresenceAwayAfter:     getenvDur("WH_PRESENCE_AWAY_AFTER", "0"),
+		ScheduleTick:          getenvDur("WH_SCHEDULE_TICK", "5s"),
+		QuietHours:            getenv("WH_QUIET_HOURS", ""),
+		QuietTimezone:         getenv("WH_QUIET_TZ", ""),
+		QuietMode:             getenv("WH_QUIET_MODE", "defer"),
+		QuietReplyWindow:      getenvDur("WH_QUIET_REPLY_WINDOW", "30m"),
+
+		// ===== Rate limits =====
+		RateSendEvery:   getenvDur("WH_RATE_SEND_EVERY", "50ms"),
+		RateSendBurst:   getenvInt("WH_RATE_SEND_BURST", 5),
+		RateMediaEvery:  getenvDur("WH_RATE_MEDIA_EVERY", "150ms"),
+		RateMediaBurst:  getenvInt("WH_RATE_MEDIA_BURST", 2),
+		RateStatusEvery: getenvDur("WH_RATE_STATUS_EVERY", "500ms"),
+		RateStatusBurst: getenvInt("WH_RATE_STATUS_BURST", 1),
+		SendQueueSize:   getenvInt("WH_SEND_QUEUE_SIZE", 256),
+		EngineAdminKey:  getenv("WH_ENGINE_ADMIN_SECRET", ""),
+		EngineAPIToken:  getenv("WH_ENGINE_API_TOKEN", ""),
+		EngineNoAuthDev: getenvBool01("WH_ENGINE_ALLOW_NO_TOKEN_DEV", false),
+		EngineBodyLimit: int64(getenvInt("WH_ENGINE_BODY_LIMIT", 1<<20)),
+		MediaBaseDir:    getenv("WH_MEDIA_BASE_DIR", "media"),
+		MaxMediaBytes:   int64(getenvInt("WH_MAX_MEDIA_BYTES", 16<<20)),
+		MediaFetchTO:    getenvDur("WH_MEDIA_FETCH_TIMEOUT", "15s"),
 
 		// ===== Forward (Folder + Webhook) =====
 		ForwardMode:      getenv("WH_FORWARD_MODE", "folder"),
 		Outbox:           getenv("WH_OUTBOX", "outbox"),
+		OutboxMaxBytes:   int64(getenvInt("WH_OUTBOX_MAX_BYTES", 0)),
+		OutboxGzip:       getenvBool01("WH_OUTBOX_GZIP", false),
+		OutboxRetain:     getenvInt("WH_OUTBOX_RETAIN", 0),
+		OutboxFsync:      getenvBool01("WH_OUTBOX_FSYNC", false),
 		ContextDepth:     getenvInt("WH_CONTEXT_DEPTH", 3),
 		ForwardExtraJSON: extra,
 
@@ -149,19 +270,50 @@ func Load() *AppConfig {
 		ServerLogJSON:          getenvBool01("WH_LOG_JSON", false),
 		ServerDedupeWindow:     getenvDur("WH_DEDUPE_WINDOW", "10m"),
 		ServerUseTimestamp:     getenvBool01("WH_USE_TIMESTAMP", false),
-		ServerAllowNoSecretDev: getenvBool01("WH_ALLOW_NO_SECRET_DEV", true),
+		ServerAllowNoSecretDev: getenvBool01("WH_ALLOW_NO_SECRET_DEV", false),
+		ServerRequireNonce:     getenvBool01("WH_REQUIRE_NONCE", false),
+		ServerRequireJSONCT:    getenvBool01("WH_REQUIRE_JSON_CT", true),
+		ServerProfileCache:     getenvInt("WH_PROFILE_CACHE_SIZE", 1000),
+		ServerProfileFlush:     getenvDur("WH_PROFILE_FLUSH_INTERVAL", "2s"),
+		ServerStreakTZ:         getenv("WH_STREAK_TZ", "UTC"),
+		ServerAdminToken:       getenv("WH_SERVER_ADMIN_TOKEN", ""),
+		ServerBlockListFile:    getenv("WH_BLOCKLIST_FILE", "blocklist.txt"),
+		ServerRatePerChatMax:   getenvInt("WH_RATE_PER_CHAT_MAX", 0),
+		ServerRatePerChatWin:   getenvDur("WH_RATE_PER_CHAT_WINDOW", "1m"),
+		ServerGroupMentionOnly: getenvBool01("WH_GROUP_MENTION_ONLY", false),
+		ServerBotJIDs:          splitCSV(getenv("WH_BOT_JIDS", "")),
+		ServerOTLPEndpoint:     getenv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
 
 		// Punteros al engine
 		ServerEngineSendURL:     getenv("WH_ENGINE_SEND_URL", base+"/api/send"),
 		ServerEngineTypingURL:   getenv("WH_ENGINE_TYPING_URL", base+"/api/typing"),
 		ServerEngineMarkReadURL: getenv("WH_ENGINE_MARKREAD_URL", base+"/api/markread"),
+		ServerEngineMediaURL:    getenv("WH_ENGINE_MEDIA_URL", base+"/api/media/download"),
+
+		// ===== Backend BOB =====
+		BOBBackendURL:     getenv("WH_BOB_BACKEND_URL", "http://localhost:3000/api/chat/message"),
+		BOBBackendTimeout: getenvDur("WH_BOB_BACKEND_TIMEOUT", "20s"),
+		BOBTranscribeURL:  getenv("WH_BOB_TRANSCRIBE_URL", "http://localhost:3000/api/chat/transcribe"),
+		VoiceMaxSeconds:   getenvInt("WH_VOICE_MAX_SECONDS", 180),
+		BOBExtractURL:     getenv("WH_BOB_EXTRACT_URL", "http://localhost:3000/api/chat/extract"),
+		OCRMaxBytes:       int64(getenvInt("WH_OCR_MAX_BYTES", 4<<20)),
 
 		// ===== Reply typing wait =====
-		ReplyBaseWait:  getenvDur("WH_REPLY_BASE_WAIT", "400ms"),
-		ReplyPerCharMs: getenvInt("WH_REPLY_PER_CHAR_MS", 35),
-		ReplyJitterMs:  getenvInt("WH_REPLY_JITTER_MS", 400),
-		ReplyMaxWait:   getenvDur("WH_REPLY_MAX_WAIT", "4s"),
-		PreReplyDelay:  getenvDur("WH_PRE_REPLY_DELAY", "900ms"),
-		AggWindow:      getenvDur("WH_AGGREGATOR_WINDOW", "2s"),
+		ReplyBaseWait:    getenvDur("WH_REPLY_BASE_WAIT", "400ms"),
+		ReplyPerCharMs:   getenvInt("WH_REPLY_PER_CHAR_MS", 35),
+		ReplyJitterMs:    getenvInt("WH_REPLY_JITTER_MS", 400),
+		ReplyMaxWait:     getenvDur("WH_REPLY_MAX_WAIT", "4s"),
+		ReplyMinWait:     getenvDur("WH_REPLY_MIN_WAIT", "1200ms"),
+		ReplyBubbleMax:   getenvInt("WH_REPLY_BUBBLE_MAX_CHARS", 400),
+		ReplyBubblePause: getenvDur("WH_REPLY_BUBBLE_PAUSE", "800ms"),
+		PreReplyDelay:    getenvDur("WH_PRE_REPLY_DELAY", "900ms"),
+		ReplyCooldown:    getenvDur("WH_REPLY_COOLDOWN", "3s"),
+		AggWindow:        getenvDur("WH_AGGREGATOR_WINDOW", "2s"),
+		AggMaxBatch:      getenvInt("WH_AGGREGATOR_MAX_BATCH", 0),
+		AggWindows:       aggWindows,
+		AggMaxWait:       getenvDur("WH_AGGREGATOR_MAX_WAIT", "20s"),
+		AggTypingWin:     getenvDur("WH_AGGREGATOR_TYPING_WINDOW", "0s"),
+		AggFirstWindow:   getenvDur("WH_AGGREGATOR_FIRST_CONTACT_WINDOW", "0s"),
+		AggFirstMinMsgs:  getenvInt("WH_AGGREGATOR_FIRST_CONTACT_MIN_MESSAGES", 0),
 	}
 }
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadEngineNoTokenBypassIsOptIn(t *testing.T) {
+	t.Setenv("WH_ENGINE_ALLOW_NO_TOKEN_DEV", "")
+	if Load().EngineNoAuthDev {
+		t.Error("EngineNoAuthDev defaults to true; the no-token bypass must be opt-in")
+	}
+	t.Setenv("WH_ENGINE_ALLOW_NO_TOKEN_DEV", "1")
+	if !Load().EngineNoAuthDev {
+		t.Error("WH_ENGINE_ALLOW_NO_TOKEN_DEV=1 not honored")
+	}
+}
+
+func TestLoadServerSignatureDefaultsFailClosed(t *testing.T) {
+	t.Setenv("WH_REQUIRE_SIG", "")
+	t.Setenv("WH_ALLOW_NO_SECRET_DEV", "")
+	cfg := Load()
+	if !cfg.ServerRequireSig {
+		t.Error("ServerRequireSig defaults to false")
+	}
+	if cfg.ServerAllowNoSecretDev {
+		t.Error("ServerAllowNoSecretDev defaults to true; unsigned webhooks must be opt-in")
+	}
+}
+
+func TestLoadBOBBackend(t *testing.T) {
+	tests := []struct {
+		name, url, timeout string
+		wantURL            string
+		wantTimeout        time.Duration
+	}{
+		{"defaults", "", "", "http://localhost:3000/api/chat/message", 20 * time.Second},
+		{"overrides", "https://bob.example.com/api/chat/message", "5s", "https://bob.example.com/api/chat/message", 5 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WH_BOB_BACKEND_URL", tt.url)
+			t.Setenv("WH_BOB_BACKEND_TIMEOUT", tt.timeout)
+			cfg := Load()
+			if cfg.BOBBackendURL != tt.wantURL || cfg.BOBBackendTimeout != tt.wantTimeout {
+				t.Fatalf("got %q %v, want %q %v", cfg.BOBBackendURL, cfg.BOBBackendTimeout, tt.wantURL, tt.wantTimeout)
+			}
+		})
+	}
+}
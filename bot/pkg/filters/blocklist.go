@@ -0,0 +1,83 @@
+package filters
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BlockList rechaza mensajes cuyo sender o chat esté bloqueado.
+// Es seguro para uso concurrente y se puede actualizar en caliente.
+// until cero = bloqueo permanente.
+type BlockList struct {
+	mu  sync.RWMutex
+	set map[string]time.Time
+	now func() time.Time
+}
+
+func NewBlockList() *BlockList {
+	return &BlockList{set: make(map[string]time.Time), now: time.Now}
+}
+
+func (b *BlockList) Block(jid string, until time.Time) {
+	jid = strings.TrimSpace(jid)
+	if jid == "" {
+		return
+	}
+	b.mu.Lock()
+	b.set[jid] = until
+	b.mu.Unlock()
+}
+
+func (b *BlockList) Unblock(jid string) {
+	b.mu.Lock()
+	delete(b.set, strings.TrimSpace(jid))
+	b.mu.Unlock()
+}
+
+func (b *BlockList) Blocked(jid string) bool {
+	if jid == "" {
+		return false
+	}
+	b.mu.RLock()
+	until, ok := b.set[jid]
+	b.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	if until.IsZero() || b.now().Before(until) {
+		return true
+	}
+	b.Unblock(jid) // expirado
+	return false
+}
+
+// LoadFile agrega JIDs (uno por línea, # comenta) como bloqueos permanentes.
+// Un archivo inexistente no es error: la lista queda como está.
+func (b *BlockList) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line != "" {
+			b.Block(line, time.Time{})
+		}
+	}
+	return sc.Err()
+}
+
+func (b *BlockList) Apply(e EnvView) bool {
+	return !b.Blocked(e.SenderJID) && !b.Blocked(e.ChatJID)
+}
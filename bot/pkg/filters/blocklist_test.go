@@ -0,0 +1,68 @@
+package filters
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBlockListApply(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	b := NewBlockList()
+	b.now = func() time.Time { return now }
+	b.Block("spam@s.whatsapp.net", time.Time{})
+	b.Block("temp@s.whatsapp.net", now.Add(time.Hour))
+	b.Block("expired@s.whatsapp.net", now.Add(-time.Minute))
+	b.Block("120363000000000001@g.us", time.Time{})
+
+	tests := []struct {
+		name string
+		env  EnvView
+		want bool
+	}{
+		{"permanent sender", EnvView{SenderJID: "spam@s.whatsapp.net", ChatJID: "spam@s.whatsapp.net"}, false},
+		{"temporary sender", EnvView{SenderJID: "temp@s.whatsapp.net"}, false},
+		{"expired block", EnvView{SenderJID: "expired@s.whatsapp.net"}, true},
+		{"blocked group", EnvView{SenderJID: "ok@s.whatsapp.net", ChatJID: "120363000000000001@g.us"}, false},
+		{"blocked sender in open group", EnvView{SenderJID: "spam@s.whatsapp.net", ChatJID: "120363000000000002@g.us"}, false},
+		{"clean", EnvView{SenderJID: "ok@s.whatsapp.net", ChatJID: "ok@s.whatsapp.net"}, true},
+		{"empty", EnvView{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := b.Apply(tt.env); got != tt.want {
+				t.Fatalf("Apply(%+v) = %v, want %v", tt.env, got, tt.want)
+			}
+		})
+	}
+
+	b.Unblock("spam@s.whatsapp.net")
+	if !b.Apply(EnvView{SenderJID: "spam@s.whatsapp.net"}) {
+		t.Fatal("unblocked sender still rejected")
+	}
+	now = now.Add(2 * time.Hour)
+	if !b.Apply(EnvView{SenderJID: "temp@s.whatsapp.net"}) {
+		t.Fatal("temporary block did not expire")
+	}
+}
+
+func TestBlockListLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocked.txt")
+	content := "# lista de spam\nspam@s.whatsapp.net\n\n  otro@s.whatsapp.net  # reincidente\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	b := NewBlockList()
+	if err := b.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	for jid, want := range map[string]bool{"spam@s.whatsapp.net": true, "otro@s.whatsapp.net": true, "# lista de spam": false, "ok@s.whatsapp.net": false} {
+		if got := b.Blocked(jid); got != want {
+			t.Errorf("Blocked(%q) = %v, want %v", jid, got, want)
+		}
+	}
+	if err := NewBlockList().LoadFile(filepath.Join(t.TempDir(), "missing.txt")); err != nil {
+		t.Fatalf("missing file must not be an error: %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package filters
+
+import "strings"
+
+// GroupMentionOnly: en grupos (@g.us) solo pasan mensajes que @mencionan al bot
+// o citan un mensaje del bot. Privados y eventos que no son mensajes pasan siempre.
+// SelfJIDs admite el JID de teléfono y el LID del bot; se compara por usuario
+// (sin dispositivo), así "519...:12@s.whatsapp.net" cuenta como "519...@s.whatsapp.net".
+type GroupMentionOnly struct {
+	SelfJIDs []string
+}
+
+func jidUser(j string) string {
+	j = strings.TrimSpace(j)
+	user, server, _ := strings.Cut(j, "@")
+	if i := strings.IndexByte(user, ':'); i >= 0 {
+		user = user[:i]
+	}
+	return user + "@" + server
+}
+
+func (g GroupMentionOnly) isSelf(j string) bool {
+	if j == "" {
+		return false
+	}
+	u := jidUser(j)
+	for _, s := range g.SelfJIDs {
+		if s != "" && jidUser(s) == u {
+			return true
+		}
+	}
+	return false
+}
+
+func (g GroupMentionOnly) Apply(e EnvView) bool {
+	if !strings.HasSuffix(e.ChatJID, "@g.us") || !isMessageEvent(e.EventType) || len(g.SelfJIDs) == 0 {
+		return true
+	}
+	for _, m := range e.MentionedJIDs {
+		if g.isSelf(m) {
+			return true
+		}
+	}
+	return g.isSelf(e.QuotedSender)
+}
@@ -0,0 +1,34 @@
+package filters
+
+import "testing"
+
+func TestGroupMentionOnly(t *testing.T) {
+	const group = "120363000000000001@g.us"
+	bot := GroupMentionOnly{SelfJIDs: []string{"51900000000@s.whatsapp.net", "123456789@lid"}}
+	tests := []struct {
+		name string
+		f    GroupMentionOnly
+		env  EnvView
+		want bool
+	}{
+		{"group mentioning bot", bot, EnvView{EventType: "message", ChatJID: group, MentionedJIDs: []string{"51911111111@s.whatsapp.net", "51900000000@s.whatsapp.net"}}, true},
+		{"group mentioning bot lid", bot, EnvView{EventType: "message", ChatJID: group, MentionedJIDs: []string{"123456789@lid"}}, true},
+		{"group mentioning bot device", bot, EnvView{EventType: "message", ChatJID: group, MentionedJIDs: []string{"51900000000:12@s.whatsapp.net"}}, true},
+		{"group quoting bot", bot, EnvView{EventType: "message", ChatJID: group, QuotedSender: "51900000000:3@s.whatsapp.net"}, true},
+		{"group mentioning someone else", bot, EnvView{EventType: "message", ChatJID: group, MentionedJIDs: []string{"51911111111@s.whatsapp.net"}}, false},
+		{"group quoting someone else", bot, EnvView{EventType: "message", ChatJID: group, QuotedSender: "51911111111@s.whatsapp.net"}, false},
+		{"group plain message", bot, EnvView{EventType: "message", ChatJID: group}, false},
+		{"same user other server", bot, EnvView{EventType: "message", ChatJID: group, MentionedJIDs: []string{"51900000000@lid"}}, false},
+		{"group contact card", bot, EnvView{EventType: "contact", ChatJID: group}, false},
+		{"group receipt", bot, EnvView{EventType: "receipt", ChatJID: group}, true},
+		{"private chat", bot, EnvView{EventType: "message", ChatJID: "51911111111@s.whatsapp.net"}, true},
+		{"no self jids", GroupMentionOnly{}, EnvView{EventType: "message", ChatJID: group}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.f.Apply(tt.env); got != tt.want {
+				t.Fatalf("Apply(%+v) = %v, want %v", tt.env, got, tt.want)
+			}
+		})
+	}
+}
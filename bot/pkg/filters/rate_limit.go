@@ -0,0 +1,68 @@
+package filters
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimitPerChat deja pasar como máximo Max mensajes por chat en una ventana deslizante.
+// Solo cuenta mensajes (receipts, presencia, etc. pasan sin consumir cupo).
+type RateLimitPerChat struct {
+	Max    int
+	Window time.Duration
+
+	mu        sync.Mutex
+	hits      map[string][]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewRateLimitPerChat(max int, window time.Duration) *RateLimitPerChat {
+	return &RateLimitPerChat{Max: max, Window: window, hits: make(map[string][]time.Time), now: time.Now}
+}
+
+func isMessageEvent(t string) bool {
+	return t == "" || t == "message" || t == "contact"
+}
+
+func (r *RateLimitPerChat) Apply(e EnvView) bool {
+	if r.Max <= 0 || r.Window <= 0 || e.ChatJID == "" || !isMessageEvent(e.EventType) {
+		return true
+	}
+	now := r.now()
+	cut := now.Add(-r.Window)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sweep(now, cut)
+	h := r.hits[e.ChatJID]
+	i := 0
+	for i < len(h) && !h[i].After(cut) {
+		i++
+	}
+	h = h[i:]
+	if len(h) == 0 {
+		delete(r.hits, e.ChatJID) // no retener el arreglo viejo de un chat que se calmó
+		h = nil
+	}
+	if len(h) >= r.Max {
+		r.hits[e.ChatJID] = h
+		return false
+	}
+	r.hits[e.ChatJID] = append(h, now)
+	return true
+}
+
+// sweep borra, como mucho una vez por ventana, los chats sin hits dentro de la ventana:
+// sin esto cada chat que escribió alguna vez queda en el mapa para siempre.
+func (r *RateLimitPerChat) sweep(now, cut time.Time) {
+	if now.Sub(r.lastSweep) < r.Window {
+		return
+	}
+	r.lastSweep = now
+	for k, h := range r.hits {
+		if len(h) == 0 || !h[len(h)-1].After(cut) {
+			delete(r.hits, k)
+		}
+	}
+}
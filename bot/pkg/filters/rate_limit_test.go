@@ -0,0 +1,63 @@
+package filters
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimitPerChat(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	type step struct {
+		at   time.Duration
+		chat string
+		typ  string
+		want bool
+	}
+	tests := []struct {
+		name  string
+		max   int
+		steps []step
+	}{
+		{"under limit", 2, []step{{0, "a", "message", true}, {time.Second, "a", "message", true}}},
+		{"over limit", 2, []step{{0, "a", "", true}, {1, "a", "", true}, {2, "a", "", false}}},
+		{"per chat", 1, []step{{0, "a", "message", true}, {0, "b", "message", true}, {1, "a", "message", false}}},
+		{"window slides", 1, []step{{0, "a", "message", true}, {30 * time.Second, "a", "message", false}, {61 * time.Second, "a", "message", true}}},
+		{"rejected do not consume", 1, []step{{0, "a", "message", true}, {50 * time.Second, "a", "message", false}, {61 * time.Second, "a", "message", true}}},
+		{"receipts pass free", 1, []step{{0, "a", "message", true}, {1, "a", "receipt", true}, {2, "a", "presence", true}, {3, "a", "message", false}}},
+		{"contacts count", 1, []step{{0, "a", "contact", true}, {1, "a", "message", false}}},
+		{"no chat passes", 1, []step{{0, "", "message", true}, {1, "", "message", true}}},
+		{"disabled", 0, []step{{0, "a", "message", true}, {1, "a", "message", true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := NewRateLimitPerChat(tt.max, time.Minute)
+			var now time.Time
+			rl.now = func() time.Time { return now }
+			for i, s := range tt.steps {
+				now = start.Add(s.at)
+				if got := rl.Apply(EnvView{EventType: s.typ, ChatJID: s.chat}); got != s.want {
+					t.Fatalf("step %d (%+v) = %v, want %v", i, s, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitPerChatForgetsIdleChats(t *testing.T) {
+	rl := NewRateLimitPerChat(5, time.Minute)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	rl.now = func() time.Time { return now }
+	for _, chat := range []string{"a", "b", "c"} {
+		rl.Apply(EnvView{EventType: "message", ChatJID: chat})
+	}
+	if len(rl.hits) != 3 {
+		t.Fatalf("hits = %d chats, want 3", len(rl.hits))
+	}
+
+	// pasada la ventana, el próximo mensaje (de otro chat) barre a los inactivos
+	now = now.Add(2 * time.Minute)
+	rl.Apply(EnvView{EventType: "message", ChatJID: "d"})
+	if len(rl.hits) != 1 || len(rl.hits["d"]) != 1 {
+		t.Fatalf("hits after sweep = %v, want only d", rl.hits)
+	}
+}
@@ -1,9 +1,14 @@
 package filters
 
 type EnvView struct {
+	EventType string
 	Direction string
 	SenderJID string
 	ChatJID   string
+
+	// Solo mensajes: a quién menciona y de quién es el mensaje citado
+	MentionedJIDs []string
+	QuotedSender  string
 }
 
 type Filter interface{ Apply(e EnvView) bool }
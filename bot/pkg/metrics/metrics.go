@@ -0,0 +1,95 @@
+// Package metrics: métricas Prometheus compartidas por engine y whserver.
+// Cada proceso expone su propio Registry en /metrics; los nombres van con
+// prefijo whatsbot_ y el label component distingue engine de whserver.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	ComponentEngine   = "engine"
+	ComponentWhserver = "whserver"
+
+	DirectionIn  = "in"
+	DirectionOut = "out"
+)
+
+// Registry propio del proceso (sin el registry global de client_golang)
+var Registry = prometheus.NewRegistry()
+
+var (
+	// Messages mensajes vistos por componente y dirección
+	Messages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "whatsbot_messages_total",
+		Help: "Mensajes procesados por componente y dirección (in|out).",
+	}, []string{"component", "direction"})
+
+	// WebhookAttempts intentos de POST engine → whserver (cada reintento cuenta)
+	WebhookAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "whatsbot_webhook_post_attempts_total",
+		Help: "Intentos de POST al webhook por resultado (ok|error).",
+	}, []string{"result"})
+
+	// WebhookFailures envelopes que agotaron los reintentos (van a dead/)
+	WebhookFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "whatsbot_webhook_failures_total",
+		Help: "Envelopes que agotaron los reintentos del webhook.",
+	})
+
+	// AggregatorFlushes lotes del agregador que llegaron a responderse
+	AggregatorFlushes = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "whatsbot_aggregator_flushes_total",
+		Help: "Flushes del agregador de mensajes.",
+	})
+
+	// ReplyWait espera simulada de "escribiendo" antes de cada respuesta
+	ReplyWait = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "whatsbot_reply_wait_seconds",
+		Help:    "Espera de typing antes de enviar una respuesta.",
+		Buckets: []float64{0.5, 1, 1.5, 2, 3, 4, 6, 10},
+	})
+
+	// BackendCall duración de las llamadas al backend BOB por resultado
+	BackendCall = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "whatsbot_backend_call_seconds",
+		Help:    "Duración de las llamadas al backend BOB.",
+		Buckets: []float64{0.25, 0.5, 1, 2, 4, 8, 15, 30},
+	}, []string{"result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		Messages,
+		WebhookAttempts,
+		WebhookFailures,
+		AggregatorFlushes,
+		ReplyWait,
+		BackendCall,
+	)
+}
+
+// Handler handler de /metrics sobre Registry
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Result "ok" o "error" según err
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// Since segundos transcurridos desde start (para Observe)
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// sample valor actual de la serie name con esos labels (counter) o su
+// número de observaciones (histogram); -1 si la serie no existe
+func sample(t *testing.T, name string, labels map[string]string) float64 {
+	t.Helper()
+	families, err := Registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, mf := range families {
+		if mf.GetName() != name {
+			continue
+		}
+	metric:
+		for _, m := range mf.GetMetric() {
+			got := map[string]string{}
+			for _, lp := range m.GetLabel() {
+				got[lp.GetName()] = lp.GetValue()
+			}
+			for k, v := range labels {
+				if got[k] != v {
+					continue metric
+				}
+			}
+			if m.GetCounter() != nil {
+				return m.GetCounter().GetValue()
+			}
+			if m.GetHistogram() != nil {
+				return float64(m.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	return -1
+}
+
+func TestMetricsIncrement(t *testing.T) {
+	in := map[string]string{"component": ComponentWhserver, "direction": DirectionIn}
+	ok := map[string]string{"result": "ok"}
+	failed := map[string]string{"result": "error"}
+
+	// las series con labels solo aparecen tras el primer uso
+	Messages.With(in)
+	WebhookAttempts.With(ok)
+	BackendCall.With(failed)
+
+	before := map[string]float64{
+		"messages":       sample(t, "whatsbot_messages_total", in),
+		"attempts":       sample(t, "whatsbot_webhook_post_attempts_total", ok),
+		"failures":       sample(t, "whatsbot_webhook_failures_total", nil),
+		"flushes":        sample(t, "whatsbot_aggregator_flushes_total", nil),
+		"reply_wait":     sample(t, "whatsbot_reply_wait_seconds", nil),
+		"backend_failed": sample(t, "whatsbot_backend_call_seconds", failed),
+	}
+
+	Messages.WithLabelValues(ComponentWhserver, DirectionIn).Inc()
+	WebhookAttempts.WithLabelValues(Result(nil)).Inc()
+	WebhookFailures.Inc()
+	AggregatorFlushes.Inc()
+	ReplyWait.Observe(1.2)
+	BackendCall.WithLabelValues(Result(errors.New("boom"))).Observe(0.3)
+
+	after := map[string]float64{
+		"messages":       sample(t, "whatsbot_messages_total", in),
+		"attempts":       sample(t, "whatsbot_webhook_post_attempts_total", ok),
+		"failures":       sample(t, "whatsbot_webhook_failures_total", nil),
+		"flushes":        sample(t, "whatsbot_aggregator_flushes_total", nil),
+		"reply_wait":     sample(t, "whatsbot_reply_wait_seconds", nil),
+		"backend_failed": sample(t, "whatsbot_backend_call_seconds", failed),
+	}
+	for k, b := range before {
+		if b < 0 {
+			t.Fatalf("%s: series missing before increment", k)
+		}
+		if after[k] != b+1 {
+			t.Fatalf("%s = %v after increment, want %v", k, after[k], b+1)
+		}
+	}
+}
+
+func TestHandlerExposesMetricNames(t *testing.T) {
+	Messages.WithLabelValues(ComponentEngine, DirectionOut).Inc()
+	WebhookAttempts.WithLabelValues("error").Inc()
+	BackendCall.WithLabelValues("ok").Observe(0.1)
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != 200 {
+		t.Fatalf("GET /metrics status = %d", rec.Code)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	for _, name := range []string{
+		`whatsbot_messages_total{component="engine",direction="out"}`,
+		`whatsbot_webhook_post_attempts_total{result="error"}`,
+		"whatsbot_webhook_failures_total",
+		"whatsbot_aggregator_flushes_total",
+		"whatsbot_reply_wait_seconds_bucket",
+		`whatsbot_backend_call_seconds_count{result="ok"}`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(string(body), name) {
+			t.Errorf("/metrics missing %s", name)
+		}
+	}
+}
+
+func TestResult(t *testing.T) {
+	if Result(nil) != "ok" || Result(errors.New("x")) != "error" {
+		t.Fatal("Result must map nil to ok and errors to error")
+	}
+}
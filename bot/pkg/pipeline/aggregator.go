@@ -9,20 +9,31 @@ import (
 // Llama onFlush(chat, count) cuando cierra la ventana.
 // Ventana DESLIZANTE: cada Add o Touch reinicia el timer.
 // - Add(chat): incrementa el contador y reinicia la ventana.
-// - Touch(chat): NO incrementa el contador, pero reinicia la ventana.
+// - Touch(chat): NO incrementa el contador; extiende la ventana (SetTypingWindow) sin acortarla.
+// - MaxWait/MaxBatch acotan cuánto puede demorarse la respuesta.
 // Uso de "generación" para evitar carreras con timers viejos.
 type Aggregator struct {
-	mu      sync.Mutex
-	perChat map[string]*batch
-	window  time.Duration
-	onFlush func(chat string, count int)
-	onReset func(chat string, reason string, count int, window time.Duration)
+	mu       sync.Mutex
+	perChat  map[string]*batch
+	window   time.Duration
+	windows  map[string]time.Duration // override por chat (si no, window)
+	maxBatch int                      // >0: flush anticipado al llegar a N mensajes
+	maxWait  time.Duration            // >0: tope duro desde el primer mensaje hasta el flush
+	typing   time.Duration            // >0: cuánto extiende un Touch (menos que un mensaje)
+	first    time.Duration            // >0: ventana mínima del primer contacto (MarkFirstContact)
+	firstMin int                      // >0: con N mensajes el primer contacto vuelve a la ventana normal
+	onFlush  func(chat string, count int)
+	onReset  func(chat string, reason string, count int, window time.Duration)
 }
 
 type batch struct {
-	count int
-	timer *time.Timer
-	gen   uint64
+	count    int
+	timer    *time.Timer
+	gen      uint64
+	firstAt  time.Time // primer mensaje (Add) del lote; base de maxWait
+	deadline time.Time // cuándo dispara el timer actual
+	capped   bool      // el deadline actual lo fijó maxWait
+	first    bool      // primer contacto del chat (MarkFirstContact)
 }
 
 // NewAggregator crea un agregador de ventana deslizante.
@@ -31,6 +42,11 @@ type batch struct {
 //   - "start": cuando se crea el batch para un chat
 //   - "message": después de Add (count ya incrementado)
 //   - "typing": después de Touch (count NO cambia)
+//   - "max_batch": Add alcanzó SetMaxBatch; el flush sale ya, sin esperar la ventana
+//   - "max_wait": se cumplió SetMaxWait desde el primer mensaje; window = tiempo esperado
+//
+// En "message"/"typing" window es la espera efectiva (recortada por maxWait, o lo que
+// resta si un Touch no alcanzó a extender).
 func NewAggregator(
 	window time.Duration,
 	onFlush func(chat string, count int),
@@ -39,28 +55,146 @@ func NewAggregator(
 	return &Aggregator{
 		perChat: make(map[string]*batch),
 		window:  window,
+		windows: make(map[string]time.Duration),
 		onFlush: onFlush,
 		onReset: onReset,
 	}
 }
 
+// SetChatWindow fija una ventana propia para chat (d<=0 la quita y vuelve al default).
+// Aplica desde el próximo reinicio de ventana.
+func (a *Aggregator) SetChatWindow(chat string, d time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if d <= 0 {
+		delete(a.windows, chat)
+		return
+	}
+	a.windows[chat] = d
+}
+
+// SetMaxBatch fuerza el flush cuando un chat acumula n mensajes,
+// aunque la ventana siga reiniciándose (n<=0 desactiva).
+func (a *Aggregator) SetMaxBatch(n int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.maxBatch = n
+}
+
+// SetMaxWait limita el tiempo total desde el primer mensaje hasta el flush,
+// por mucho que Add/Touch sigan reiniciando la ventana (d<=0 desactiva).
+func (a *Aggregator) SetMaxWait(d time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.maxWait = d
+}
+
+// SetTypingWindow fija cuánto extiende un Touch ("escribiendo"); nunca acorta
+// una ventana ya más larga (d<=0 = misma ventana que un mensaje).
+func (a *Aggregator) SetTypingWindow(d time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.typing = d
+}
+
+// SetFirstContact alarga la ventana del primer contacto de un chat a al menos d, para no
+// contestar un "hola" al instante. Con minMessages>0, al juntar esa cantidad el lote
+// vuelve a la ventana normal. maxWait sigue siendo el tope. d<=0 desactiva.
+func (a *Aggregator) SetFirstContact(d time.Duration, minMessages int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.first = d
+	a.firstMin = minMessages
+}
+
+// MarkFirstContact marca el lote actual del chat como primer contacto (llamar antes de Add).
+// La marca se va con el flush; el llamador decide qué es "primer contacto".
+func (a *Aggregator) MarkFirstContact(chat string) {
+	if chat == "" {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.first <= 0 {
+		return
+	}
+	a.ensureBatchLocked(chat).first = true
+}
+
+// batchWindowLocked ventana del lote: la del chat o, en un primer contacto que aún no
+// juntó firstMin mensajes, la del primer contacto si es mayor. Con el candado tomado.
+func (a *Aggregator) batchWindowLocked(chat string, b *batch) time.Duration {
+	win := a.windowForLocked(chat)
+	if b.first && a.first > win && (a.firstMin <= 0 || b.count < a.firstMin) {
+		return a.first
+	}
+	return win
+}
+
+// windowForLocked devuelve la ventana efectiva del chat. Debe llamarse con el candado tomado.
+func (a *Aggregator) windowForLocked(chat string) time.Duration {
+	if d, ok := a.windows[chat]; ok {
+		return d
+	}
+	return a.window
+}
+
 // Add incrementa el conteo y reinicia la ventana.
+// Con maxBatch alcanzado hace flush inmediato (reason "max_batch") sin esperar la ventana.
 func (a *Aggregator) Add(chat string) {
 	if chat == "" {
 		return
 	}
 	a.mu.Lock()
-	defer a.mu.Unlock()
 
 	b := a.ensureBatchLocked(chat)
 	b.count++
-	a.resetTimerLocked(chat, b)
+	if b.firstAt.IsZero() {
+		b.firstAt = time.Now()
+	}
+	win := a.batchWindowLocked(chat, b)
+
+	if a.maxBatch > 0 && b.count >= a.maxBatch {
+		a.flushNowLocked(chat, b, "max_batch", win)
+		return
+	}
 
+	d, ok := a.resetTimerLocked(chat, b, win)
+	if !ok {
+		a.flushNowLocked(chat, b, "max_wait", time.Since(b.firstAt))
+		return
+	}
 	if a.onReset != nil {
-		a.onReset(chat, "message", b.count, a.window)
+		a.onReset(chat, "message", b.count, d)
+	}
+	a.mu.Unlock()
+}
+
+// flushNowLocked retira el batch y dispara onFlush sin esperar al timer.
+// Se llama con el candado tomado y lo LIBERA.
+func (a *Aggregator) flushNowLocked(chat string, b *batch, reason string, win time.Duration) {
+	count := a.takeLocked(chat, b)
+	if a.onReset != nil {
+		a.onReset(chat, reason, count, win)
+	}
+	a.mu.Unlock()
+	// mismo contexto que el timer: fuera del candado y sin bloquear al que llama
+	if count > 0 && a.onFlush != nil {
+		go a.onFlush(chat, count)
 	}
 }
 
+// takeLocked retira el batch e invalida su timer; devuelve el conteo.
+// Debe llamarse con el candado tomado.
+func (a *Aggregator) takeLocked(chat string, b *batch) int {
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	b.gen++ // un timer que ya disparó verá otra generación y no hará nada
+	delete(a.perChat, chat)
+	return b.count
+}
+
 // Touch reinicia la ventana sin incrementar el conteo.
 // Útil para eventos como "usuario está escribiendo".
 func (a *Aggregator) Touch(chat string) {
@@ -68,15 +202,30 @@ func (a *Aggregator) Touch(chat string) {
 		return
 	}
 	a.mu.Lock()
-	defer a.mu.Unlock()
 
 	b := a.ensureBatchLocked(chat)
 	// NO incrementa b.count
-	a.resetTimerLocked(chat, b)
-
+	ext := a.batchWindowLocked(chat, b)
+	if a.typing > 0 {
+		ext = a.typing
+	}
+	// escribir no acorta una ventana que ya vence más tarde
+	if left := time.Until(b.deadline); left >= ext {
+		if a.onReset != nil {
+			a.onReset(chat, "typing", b.count, left)
+		}
+		a.mu.Unlock()
+		return
+	}
+	d, ok := a.resetTimerLocked(chat, b, ext)
+	if !ok {
+		a.flushNowLocked(chat, b, "max_wait", time.Since(b.firstAt))
+		return
+	}
 	if a.onReset != nil {
-		a.onReset(chat, "typing", b.count, a.window)
+		a.onReset(chat, "typing", b.count, d)
 	}
+	a.mu.Unlock()
 }
 
 // TouchTyping es un alias semántico de Touch para eventos "usuario está escribiendo".
@@ -93,42 +242,58 @@ func (a *Aggregator) ensureBatchLocked(chat string) *batch {
 	// Primera generación
 	b := &batch{count: 0, gen: 1}
 	gen := b.gen
-	b.timer = time.AfterFunc(a.window, func() {
+	win := a.windowForLocked(chat)
+	b.deadline = time.Now().Add(win)
+	b.timer = time.AfterFunc(win, func() {
 		a.flushGen(chat, gen)
 	})
 	a.perChat[chat] = b
 
 	// Log de inicio de ventana
 	if a.onReset != nil {
-		a.onReset(chat, "start", b.count, a.window)
+		a.onReset(chat, "start", b.count, win)
 	}
 	return b
 }
 
 // resetTimerLocked reinicia el timer de un batch en una ventana deslizante,
 // manejando la carrera en que el timer pudo estar por disparar.
+// Con maxWait, win se recorta a lo que quede del tope; devuelve la espera efectiva
+// y ok=false si el tope ya venció (el llamador debe hacer flush).
 // Debe llamarse con el candado tomado.
-func (a *Aggregator) resetTimerLocked(chat string, b *batch) {
+func (a *Aggregator) resetTimerLocked(chat string, b *batch, win time.Duration) (time.Duration, bool) {
+	b.capped = false
+	if a.maxWait > 0 && !b.firstAt.IsZero() {
+		left := a.maxWait - time.Since(b.firstAt)
+		if left <= 0 {
+			return 0, false
+		}
+		if left < win {
+			win, b.capped = left, true
+		}
+	}
+	b.deadline = time.Now().Add(win)
 	if b.timer == nil {
 		b.gen++
 		gen := b.gen
-		b.timer = time.AfterFunc(a.window, func() {
+		b.timer = time.AfterFunc(win, func() {
 			a.flushGen(chat, gen)
 		})
-		return
+		return win, true
 	}
 	if b.timer.Stop() {
 		// Si alcanzamos a detenerlo, reseteamos sobre el mismo timer.
-		b.timer.Reset(a.window)
-		return
+		b.timer.Reset(win)
+		return win, true
 	}
 	// El timer pudo haber disparado o estar ejecutándose:
 	// creamos una NUEVA generación y un nuevo timer.
 	b.gen++
 	gen := b.gen
-	b.timer = time.AfterFunc(a.window, func() {
+	b.timer = time.AfterFunc(win, func() {
 		a.flushGen(chat, gen)
 	})
+	return win, true
 }
 
 // flushGen sólo hace flush si la generación del timer coincide con la generación activa.
@@ -145,9 +310,52 @@ func (a *Aggregator) flushGen(chat string, gen uint64) {
 	}
 	delete(a.perChat, chat)
 	count := b.count
+	if b.capped && a.onReset != nil {
+		a.onReset(chat, "max_wait", count, time.Since(b.firstAt))
+	}
 	a.mu.Unlock()
 
 	if count > 0 && a.onFlush != nil {
 		a.onFlush(chat, count)
 	}
 }
+
+// ChatStats es el estado pendiente de un chat en el agregador.
+type ChatStats struct {
+	Count     int
+	Age       time.Duration // desde el primer mensaje (0 si solo hubo Touch)
+	FlushesIn time.Duration // hasta el deadline actual
+	Capped    bool          // el deadline lo fija MaxWait
+}
+
+// Stats es una foto del agregador para depurar demoras en las respuestas.
+type Stats struct {
+	PendingChats     int
+	PendingMessages  int
+	OldestPendingAge time.Duration
+	Chats            map[string]ChatStats
+}
+
+// Stats copia el estado bajo el candado (solo lectura de campos, sin I/O ni callbacks),
+// así no retiene a los timers que esperan para hacer flush.
+func (a *Aggregator) Stats() Stats {
+	now := time.Now()
+	a.mu.Lock()
+	st := Stats{PendingChats: len(a.perChat), Chats: make(map[string]ChatStats, len(a.perChat))}
+	for chat, b := range a.perChat {
+		cs := ChatStats{Count: b.count, FlushesIn: b.deadline.Sub(now), Capped: b.capped}
+		if !b.firstAt.IsZero() {
+			cs.Age = now.Sub(b.firstAt)
+		}
+		st.Chats[chat] = cs
+	}
+	a.mu.Unlock()
+
+	for _, cs := range st.Chats {
+		st.PendingMessages += cs.Count
+		if cs.Age > st.OldestPendingAge {
+			st.OldestPendingAge = cs.Age
+		}
+	}
+	return st
+}
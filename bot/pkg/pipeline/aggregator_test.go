@@ -0,0 +1,400 @@
+package pipeline
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type flushed struct {
+	chat  string
+	count int
+	at    time.Time
+}
+
+// newTestAggregator agregador cuyo onFlush escribe en un canal
+func newTestAggregator(window time.Duration) (*Aggregator, chan flushed) {
+	ch := make(chan flushed, 16)
+	a := NewAggregator(window, func(chat string, count int) {
+		ch <- flushed{chat, count, time.Now()}
+	}, nil)
+	return a, ch
+}
+
+func waitFlush(t *testing.T, ch chan flushed, within time.Duration) flushed {
+	t.Helper()
+	select {
+	case f := <-ch:
+		return f
+	case <-time.After(within):
+		t.Fatalf("no flush within %v", within)
+		return flushed{}
+	}
+}
+
+func noFlush(t *testing.T, ch chan flushed, during time.Duration) {
+	t.Helper()
+	select {
+	case f := <-ch:
+		t.Fatalf("unexpected flush %+v", f)
+	case <-time.After(during):
+	}
+}
+
+func TestAggregatorPerChatWindow(t *testing.T) {
+	tests := []struct {
+		name     string
+		override time.Duration
+		want     time.Duration
+	}{
+		{"default window", 0, 150 * time.Millisecond},
+		{"shorter override", 30 * time.Millisecond, 30 * time.Millisecond},
+		{"longer override", 300 * time.Millisecond, 300 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, ch := newTestAggregator(150 * time.Millisecond)
+			a.SetChatWindow("slow", 10*time.Second) // otro chat: no debe afectar
+			if tt.override > 0 {
+				a.SetChatWindow("c", tt.override)
+			}
+			start := time.Now()
+			a.Add("c")
+			f := waitFlush(t, ch, 2*time.Second)
+			got := f.at.Sub(start)
+			if f.chat != "c" || f.count != 1 {
+				t.Fatalf("flush = %+v", f)
+			}
+			if got < tt.want || got > tt.want+200*time.Millisecond {
+				t.Fatalf("flushed after %v, want ~%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAggregatorClearChatWindow(t *testing.T) {
+	a, ch := newTestAggregator(30 * time.Millisecond)
+	a.SetChatWindow("c", 10*time.Second)
+	a.SetChatWindow("c", 0)
+	a.Add("c")
+	waitFlush(t, ch, time.Second)
+}
+
+func TestAggregatorMaxBatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxBatch  int
+		adds      int
+		wantEarly bool
+	}{
+		{"below cap waits window", 3, 2, false},
+		{"cap flushes early", 3, 3, true},
+		{"disabled", 0, 10, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, ch := newTestAggregator(time.Hour)
+			a.SetMaxBatch(tt.maxBatch)
+			for i := 0; i < tt.adds; i++ {
+				a.Add("c")
+			}
+			if !tt.wantEarly {
+				noFlush(t, ch, 50*time.Millisecond)
+				if st := a.Stats(); st.Chats["c"].Count != tt.adds {
+					t.Fatalf("pending = %+v, want %d", st.Chats["c"], tt.adds)
+				}
+				return
+			}
+			if f := waitFlush(t, ch, time.Second); f.count != tt.maxBatch {
+				t.Fatalf("count = %d, want %d", f.count, tt.maxBatch)
+			}
+			if st := a.Stats(); st.PendingChats != 0 {
+				t.Fatalf("batch not cleared: %+v", st)
+			}
+		})
+	}
+}
+
+// Un usuario que sigue escribiendo no retrasa la respuesta más allá de maxBatch mensajes
+func TestAggregatorMaxBatchBeatsTyping(t *testing.T) {
+	a, ch := newTestAggregator(100 * time.Millisecond)
+	a.SetMaxBatch(4)
+	for i := 0; i < 4; i++ {
+		a.Touch("c")
+		a.Add("c")
+		time.Sleep(20 * time.Millisecond)
+	}
+	f := waitFlush(t, ch, time.Second)
+	if f.count != 4 {
+		t.Fatalf("count = %d, want 4", f.count)
+	}
+	// el lote siguiente arranca de cero
+	a.Add("c")
+	if f := waitFlush(t, ch, time.Second); f.count != 1 {
+		t.Fatalf("next batch count = %d, want 1", f.count)
+	}
+}
+
+type resetLog struct {
+	mu      sync.Mutex
+	reasons []string
+	windows []time.Duration
+}
+
+func (l *resetLog) record(_ string, reason string, _ int, win time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reasons = append(l.reasons, reason)
+	l.windows = append(l.windows, win)
+}
+
+func (l *resetLog) last(reason string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := len(l.reasons) - 1; i >= 0; i-- {
+		if l.reasons[i] == reason {
+			return l.windows[i], true
+		}
+	}
+	return 0, false
+}
+
+func TestAggregatorMaxWait(t *testing.T) {
+	tests := []struct {
+		name  string
+		event func(a *Aggregator)
+	}{
+		{"messages keep resetting", func(a *Aggregator) { a.Add("c") }},
+		{"typing keeps resetting", func(a *Aggregator) { a.Touch("c") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := make(chan flushed, 4)
+			log := &resetLog{}
+			a := NewAggregator(80*time.Millisecond, func(chat string, count int) {
+				ch <- flushed{chat, count, time.Now()}
+			}, log.record)
+			a.SetMaxWait(250 * time.Millisecond)
+
+			start := time.Now()
+			a.Add("c")
+			stop := time.After(600 * time.Millisecond)
+			tick := time.NewTicker(20 * time.Millisecond)
+			defer tick.Stop()
+			var f flushed
+		loop:
+			for {
+				select {
+				case f = <-ch:
+					break loop
+				case <-tick.C:
+					tt.event(a)
+				case <-stop:
+					t.Fatal("max wait never fired while events kept arriving")
+				}
+			}
+			if got := f.at.Sub(start); got < 230*time.Millisecond || got > 450*time.Millisecond {
+				t.Fatalf("flushed after %v, want ~250ms", got)
+			}
+			if _, ok := log.last("max_wait"); !ok {
+				t.Fatalf("no max_wait reset reported: %v", log.reasons)
+			}
+		})
+	}
+}
+
+func TestAggregatorMaxWaitDisabled(t *testing.T) {
+	a, ch := newTestAggregator(60 * time.Millisecond)
+	for i := 0; i < 8; i++ {
+		a.Add("c")
+		time.Sleep(25 * time.Millisecond)
+	}
+	noFlush(t, ch, 0)
+	if f := waitFlush(t, ch, time.Second); f.count != 8 {
+		t.Fatalf("count = %d, want 8", f.count)
+	}
+}
+
+func TestAggregatorTypingExtendsLess(t *testing.T) {
+	tests := []struct {
+		name      string
+		typing    time.Duration
+		wantTouch time.Duration // ventana reportada por el Touch
+	}{
+		{"typing extends less than a message", 40 * time.Millisecond, 40 * time.Millisecond},
+		{"no typing window extends a full window", 0, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := make(chan flushed, 1)
+			log := &resetLog{}
+			a := NewAggregator(100*time.Millisecond, func(chat string, count int) {
+				ch <- flushed{chat, count, time.Now()}
+			}, log.record)
+			a.SetTypingWindow(tt.typing)
+			start := time.Now()
+			a.Add("c")
+			time.Sleep(80 * time.Millisecond)
+			a.Touch("c")
+			win, ok := log.last("typing")
+			if !ok || win != tt.wantTouch {
+				t.Fatalf("typing window = %v (reported %v), want %v", win, ok, tt.wantTouch)
+			}
+			f := waitFlush(t, ch, time.Second)
+			if want := 80*time.Millisecond + tt.wantTouch; f.at.Sub(start) < want {
+				t.Fatalf("flushed after %v, want >= %v", f.at.Sub(start), want)
+			}
+		})
+	}
+}
+
+func TestAggregatorTypingNeverShortens(t *testing.T) {
+	log := &resetLog{}
+	a := NewAggregator(300*time.Millisecond, nil, log.record)
+	a.SetTypingWindow(30 * time.Millisecond)
+	a.Add("c")
+	a.Touch("c")
+	win, ok := log.last("typing")
+	if !ok || win < 250*time.Millisecond {
+		t.Fatalf("typing window = %v, want the remaining message window (~300ms)", win)
+	}
+	if st := a.Stats(); st.Chats["c"].FlushesIn < 250*time.Millisecond {
+		t.Fatalf("deadline shortened: %+v", st.Chats["c"])
+	}
+}
+
+func TestAggregatorStats(t *testing.T) {
+	a, _ := newTestAggregator(time.Hour)
+	adds := map[string]int{"a": 3, "b": 1, "c": 2}
+	for chat, n := range adds {
+		for i := 0; i < n; i++ {
+			a.Add(chat)
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	a.Add("late")
+	a.Touch("typing-only")
+
+	st := a.Stats()
+	if st.PendingChats != 5 || st.PendingMessages != 7 {
+		t.Fatalf("stats = %d chats / %d messages, want 5 / 7", st.PendingChats, st.PendingMessages)
+	}
+	for chat, want := range map[string]int{"a": 3, "b": 1, "c": 2, "late": 1, "typing-only": 0} {
+		if got := st.Chats[chat].Count; got != want {
+			t.Errorf("chat %s count = %d, want %d", chat, got, want)
+		}
+	}
+	if st.Chats["typing-only"].Age != 0 {
+		t.Errorf("typing-only age = %v, want 0 (no message yet)", st.Chats["typing-only"].Age)
+	}
+	if st.OldestPendingAge < 20*time.Millisecond || st.OldestPendingAge < st.Chats["late"].Age {
+		t.Errorf("oldest age = %v (late %v)", st.OldestPendingAge, st.Chats["late"].Age)
+	}
+	if fi := st.Chats["a"].FlushesIn; fi <= 0 || fi > time.Hour {
+		t.Errorf("flushes in = %v", fi)
+	}
+
+	// la foto es una copia: mutarla no toca al agregador
+	st.Chats["a"] = ChatStats{}
+	if a.Stats().Chats["a"].Count != 3 {
+		t.Error("Stats shares state with the aggregator")
+	}
+}
+
+// Stats no debe bloquear ni ser bloqueado por flushes concurrentes
+func TestAggregatorStatsConcurrentFlushes(t *testing.T) {
+	a, ch := newTestAggregator(time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			a.Add("c")
+			_ = a.Stats()
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stats deadlocked with flushes")
+	}
+	total := 0
+	deadline := time.After(2 * time.Second)
+	for total < 200 {
+		select {
+		case f := <-ch:
+			total += f.count
+		case <-deadline:
+			t.Fatalf("flushed %d of 200 messages", total)
+		}
+	}
+}
+
+func TestAggregatorFirstContact(t *testing.T) {
+	tests := []struct {
+		name     string
+		first    time.Duration
+		minMsgs  int
+		mark     bool
+		adds     int
+		wantWait time.Duration
+	}{
+		{"first contact waits longer", 250 * time.Millisecond, 0, true, 1, 250 * time.Millisecond},
+		{"later interaction uses normal window", 250 * time.Millisecond, 0, false, 1, 60 * time.Millisecond},
+		{"min messages back to normal window", 250 * time.Millisecond, 2, true, 2, 60 * time.Millisecond},
+		{"below min messages still waits", 250 * time.Millisecond, 3, true, 2, 250 * time.Millisecond},
+		{"shorter than window is ignored", 20 * time.Millisecond, 0, true, 1, 60 * time.Millisecond},
+		{"disabled", 0, 0, true, 1, 60 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, ch := newTestAggregator(60 * time.Millisecond)
+			a.SetFirstContact(tt.first, tt.minMsgs)
+			start := time.Now()
+			for i := 0; i < tt.adds; i++ {
+				if tt.mark {
+					a.MarkFirstContact("c")
+				}
+				a.Add("c")
+			}
+			f := waitFlush(t, ch, 2*time.Second)
+			if got := f.at.Sub(start); got < tt.wantWait || got > tt.wantWait+150*time.Millisecond {
+				t.Fatalf("flushed after %v, want ~%v", got, tt.wantWait)
+			}
+			if f.count != tt.adds {
+				t.Fatalf("count = %d, want %d", f.count, tt.adds)
+			}
+		})
+	}
+}
+
+// la marca de primer contacto se va con el flush: el lote siguiente usa la ventana normal
+func TestAggregatorFirstContactClearedOnFlush(t *testing.T) {
+	a, ch := newTestAggregator(40 * time.Millisecond)
+	a.SetFirstContact(200*time.Millisecond, 0)
+
+	start := time.Now()
+	a.MarkFirstContact("c")
+	a.Add("c")
+	first := waitFlush(t, ch, time.Second).at.Sub(start)
+
+	start = time.Now()
+	a.Add("c")
+	later := waitFlush(t, ch, time.Second).at.Sub(start)
+
+	if first < 200*time.Millisecond || later >= first || later > 150*time.Millisecond {
+		t.Fatalf("first contact %v, later %v", first, later)
+	}
+}
+
+// maxWait sigue siendo el tope aunque el primer contacto pida más
+func TestAggregatorFirstContactCappedByMaxWait(t *testing.T) {
+	a, ch := newTestAggregator(40 * time.Millisecond)
+	a.SetFirstContact(time.Hour, 0)
+	a.SetMaxWait(120 * time.Millisecond)
+	start := time.Now()
+	a.MarkFirstContact("c")
+	a.Add("c")
+	if got := waitFlush(t, ch, time.Second).at.Sub(start); got > 400*time.Millisecond {
+		t.Fatalf("flushed after %v, want <= maxWait", got)
+	}
+}
@@ -15,6 +15,12 @@ type Envelope struct {
 	MessageID string
 	Text      string
 	At        time.Time
+	// Texto del mensaje citado si el usuario respondió a uno previo
+	QuotedText string
+	// Nota de voz (ticket de media del engine) si el mensaje es un audio sin texto
+	Voice map[string]any
+	// Imagen o documento (ticket de media del engine) cuyo texto se lee por OCR
+	Attachment map[string]any
 	// + lo que necesites
 }
 
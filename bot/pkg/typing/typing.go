@@ -0,0 +1,33 @@
+// Package typing: cuánto dura el "escribiendo…" simulado antes de una respuesta.
+// Lo usan whserver (respuestas del router) y el engine (/api/send con simulate_typing).
+package typing
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Timing base + por carácter + jitter aleatorio, con piso Min y luego tope Max (0 = sin tope)
+type Timing struct {
+	Base    time.Duration
+	PerChar time.Duration
+	Jitter  time.Duration
+	Min     time.Duration
+	Max     time.Duration
+}
+
+// Wait tiempo de escritura de msg (por runas, no bytes)
+func (t Timing) Wait(msg string) time.Duration {
+	jitter := time.Duration(0)
+	if t.Jitter > 0 {
+		jitter = time.Duration(rand.Int63n(int64(t.Jitter)))
+	}
+	wait := t.Base + time.Duration(len([]rune(msg)))*t.PerChar + jitter
+	if wait < t.Min {
+		wait = t.Min
+	}
+	if t.Max > 0 && wait > t.Max {
+		wait = t.Max
+	}
+	return wait
+}
@@ -0,0 +1,40 @@
+package typing
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWait(t *testing.T) {
+	timing := Timing{Base: 500 * time.Millisecond, PerChar: 50 * time.Millisecond, Min: time.Second, Max: 4 * time.Second}
+	cases := []struct {
+		name string
+		msg  string
+		want time.Duration
+	}{
+		{"floor", "ok", time.Second},
+		{"per char", strings.Repeat("a", 20), 1500 * time.Millisecond},
+		{"runes not bytes", strings.Repeat("ñ", 20), 1500 * time.Millisecond},
+		{"cap", strings.Repeat("a", 500), 4 * time.Second},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := timing.Wait(c.msg); got != c.want {
+				t.Fatalf("Wait = %s, want %s", got, c.want)
+			}
+		})
+	}
+	if got := (Timing{PerChar: time.Second}).Wait(strings.Repeat("a", 100)); got != 100*time.Second {
+		t.Fatalf("Max = 0 capped the wait: %s", got)
+	}
+}
+
+func TestWaitJitter(t *testing.T) {
+	timing := Timing{Base: time.Second, Jitter: 200 * time.Millisecond}
+	for i := 0; i < 50; i++ {
+		if got := timing.Wait("hola"); got < time.Second || got >= 1200*time.Millisecond {
+			t.Fatalf("Wait = %s, outside [1s, 1.2s)", got)
+		}
+	}
+}
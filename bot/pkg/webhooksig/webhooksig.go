@@ -0,0 +1,104 @@
+// Package webhooksig firma y verifica los envelopes engine → whserver (HMAC-SHA256).
+// Engine y whserver importan este paquete para que cabeceras y formato no se desalineen.
+package webhooksig
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderSignature = "X-Whatsbot-Signature"
+	HeaderTimestamp = "X-Whatsbot-Timestamp"
+	HeaderNonce     = "X-Whatsbot-Nonce"
+	// HeaderSignatureBound firma timestamp+nonce+body: sin esto un atacante reusaría
+	// el body firmado con un nonce nuevo.
+	HeaderSignatureBound = "X-Whatsbot-Signature-Bound"
+
+	prefix = "sha256="
+)
+
+// Sign devuelve "sha256=<hex>" o "" si no hay secreto.
+func Sign(secret string, body []byte) string {
+	if secret == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return prefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify compara en tiempo constante la cabecera recibida con la firma esperada.
+// Sin secreto, cabecera vacía o sin prefijo "sha256=" → false.
+func Verify(secret string, body []byte, sigHeader string) bool {
+	if secret == "" {
+		return false
+	}
+	sigHeader = strings.TrimSpace(sigHeader)
+	if !strings.HasPrefix(sigHeader, prefix) {
+		return false
+	}
+	got := strings.ToLower(strings.TrimPrefix(sigHeader, prefix))
+	want := strings.TrimPrefix(Sign(secret, body), prefix)
+	return hmac.Equal([]byte(got), []byte(want))
+}
+
+// NewNonce genera 16 bytes aleatorios en hex (uno por request).
+func NewNonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func boundPayload(ts, nonce string, body []byte) []byte {
+	out := make([]byte, 0, len(ts)+len(nonce)+2+len(body))
+	out = append(out, ts...)
+	out = append(out, '.')
+	out = append(out, nonce...)
+	out = append(out, '.')
+	return append(out, body...)
+}
+
+// SignBound firma "<ts>.<nonce>.<body>".
+func SignBound(secret, ts, nonce string, body []byte) string {
+	return Sign(secret, boundPayload(ts, nonce, body))
+}
+
+// VerifyBound verifica HeaderSignatureBound; exige timestamp y nonce no vacíos.
+func VerifyBound(secret, ts, nonce string, body []byte, sigHeader string) bool {
+	if ts == "" || nonce == "" {
+		return false
+	}
+	return Verify(secret, boundPayload(ts, nonce, body), sigHeader)
+}
+
+// CheckTimestamp acepta unix (segundos) o RFC3339 y rechaza desfases mayores a skew.
+func CheckTimestamp(tsHeader string, skew time.Duration) error {
+	if tsHeader == "" {
+		return errors.New("missing timestamp")
+	}
+	var ts time.Time
+	if n, err := strconv.ParseInt(tsHeader, 10, 64); err == nil {
+		ts = time.Unix(n, 0)
+	} else {
+		t, err2 := time.Parse(time.RFC3339, tsHeader)
+		if err2 != nil {
+			return errors.New("bad timestamp format")
+		}
+		ts = t
+	}
+	diff := time.Since(ts)
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff > skew {
+		return errors.New("timestamp skew too large")
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package webhooksig
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	// HMAC-SHA256("secreto", `{"a":1}`)
+	const want = "sha256=87c6bf752c360faf8b89e2d9ed15dcc45e947f9ecdf9c4b637c8fa62d691c598"
+	got := Sign("secreto", []byte(`{"a":1}`))
+	if got != want {
+		t.Fatalf("Sign = %q, want %q", got, want)
+	}
+	if Sign("otro", []byte(`{"a":1}`)) == got || Sign("secreto", []byte(`{"a":2}`)) == got {
+		t.Fatal("signature does not depend on secret and body")
+	}
+	if Sign("", []byte("x")) != "" {
+		t.Fatal("Sign without secret must be empty")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"event_type":"message"}`)
+	sig := Sign("secreto", body)
+	hexPart := strings.TrimPrefix(sig, "sha256=")
+	flipped := hexPart[:len(hexPart)-1] + string("0123456789abcdef"[(strings.IndexByte("0123456789abcdef", hexPart[len(hexPart)-1])+1)%16])
+
+	tests := []struct {
+		name   string
+		secret string
+		body   []byte
+		header string
+		want   bool
+	}{
+		{"valid", "secreto", body, sig, true},
+		{"surrounding spaces", "secreto", body, "  " + sig + " ", true},
+		{"uppercase hex", "secreto", body, "sha256=" + strings.ToUpper(hexPart), true},
+		{"wrong secret", "otro", body, sig, false},
+		{"tampered body", "secreto", []byte(`{"event_type":"receipt"}`), sig, false},
+		{"last hex char differs", "secreto", body, "sha256=" + flipped, false},
+		{"truncated", "secreto", body, sig[:len(sig)-2], false},
+		{"missing prefix", "secreto", body, hexPart, false},
+		{"other algorithm", "secreto", body, "sha1=" + hexPart, false},
+		{"prefix only", "secreto", body, "sha256=", false},
+		{"empty header", "secreto", body, "", false},
+		{"no secret", "", body, sig, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.secret, tt.body, tt.header); got != tt.want {
+				t.Fatalf("Verify(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckTimestamp(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		header  string
+		wantErr string
+	}{
+		{"rfc3339 now", now.UTC().Format(time.RFC3339), ""},
+		{"unix now", strconv.FormatInt(now.Unix(), 10), ""},
+		{"slightly in the future", now.Add(30 * time.Second).UTC().Format(time.RFC3339), ""},
+		{"too old", now.Add(-10 * time.Minute).UTC().Format(time.RFC3339), "skew"},
+		{"too far in the future", strconv.FormatInt(now.Add(10*time.Minute).Unix(), 10), "skew"},
+		{"missing", "", "missing timestamp"},
+		{"garbage", "ayer", "bad timestamp format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckTimestamp(tt.header, 5*time.Minute)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("err = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignBound(t *testing.T) {
+	body := []byte(`{"a":1}`)
+	sig := SignBound("secreto", "1700000000", "abc", body)
+	tests := []struct {
+		name      string
+		ts, nonce string
+		body      []byte
+		header    string
+		want      bool
+	}{
+		{"valid", "1700000000", "abc", body, sig, true},
+		{"other nonce", "1700000000", "abd", body, sig, false},
+		{"other timestamp", "1700000001", "abc", body, sig, false},
+		{"other body", "1700000000", "abc", []byte(`{"a":2}`), sig, false},
+		{"plain body signature", "1700000000", "abc", body, Sign("secreto", body), false},
+		{"empty nonce", "1700000000", "", body, SignBound("secreto", "1700000000", "", body), false},
+		{"empty timestamp", "", "abc", body, SignBound("secreto", "", "abc", body), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyBound("secreto", tt.ts, tt.nonce, tt.body, tt.header); got != tt.want {
+				t.Fatalf("VerifyBound = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewNonce(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		n := NewNonce()
+		if len(n) != 32 || seen[n] {
+			t.Fatalf("nonce %q (len %d, repeated %v)", n, len(n), seen[n])
+		}
+		seen[n] = true
+	}
+}